@@ -0,0 +1,124 @@
+package audit
+
+// Audit log of clock adjustments: every step and adjustment of the local clock
+// and of the clocks disciplined to it is recorded together with the discipline
+// and the sync round that decided it. Entries are kept in a bounded in-memory ring buffer, which can be
+// queried via the control socket, and optionally appended as JSON lines to a
+// file that is never truncated, e.g., for regulatory clock sync audits.
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+type Op string
+
+const (
+	OpStep      Op = "step"
+	OpAdjust    Op = "adjust"
+	OpFrequency Op = "frequency"
+)
+
+const DefaultCapacity = 1024
+
+// Entry describes a clock adjustment. Round is the sync round of Discipline
+// in which the adjustment was decided, starting at 1; adjustments outside of
+// a sync round, e.g., on startup, have round 0. Clock is empty for the local
+// clock and names the clock otherwise, e.g., a PHC of the clock tree.
+type Entry struct {
+	Seq        uint64        `json:"seq"`
+	Time       time.Time     `json:"time"`
+	Op         Op            `json:"op"`
+	Discipline string        `json:"discipline"`
+	Clock      string        `json:"clock,omitempty"`
+	Round      uint64        `json:"round"`
+	Offset     time.Duration `json:"offset"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	Frequency  float64       `json:"frequency"`
+}
+
+var (
+	mu    sync.Mutex
+	ring  = make([]Entry, DefaultCapacity)
+	start uint64 // first sequence number kept in ring
+	next  uint64
+	file  *os.File
+)
+
+// SetFile appends all subsequently recorded entries to the file name, which
+// is created if necessary. Sequence numbers continue after the last entry in
+// the file.
+func SetFile(name string) error {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	var last Entry
+	var found bool
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if json.Unmarshal(s.Bytes(), &last) == nil {
+			found = true
+		}
+	}
+	if err := s.Err(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if file != nil {
+		_ = file.Close()
+	}
+	file = f
+	if found && last.Seq >= next {
+		next = last.Seq + 1
+		start = next
+	}
+	return nil
+}
+
+// Record adds e to the audit log. The sequence number of e is assigned by the
+// audit log. An error is returned if e could not be written to the file.
+func Record(e Entry) error {
+	mu.Lock()
+	defer mu.Unlock()
+	e.Seq = next
+	ring[next%uint64(len(ring))] = e
+	next++
+	if file == nil {
+		return nil
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	_, err = file.Write(append(b, '\n'))
+	if err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Entries returns the recorded entries with sequence number at least since,
+// oldest first, as far as they are still kept in memory.
+func Entries(since uint64) []Entry {
+	mu.Lock()
+	defer mu.Unlock()
+	n := uint64(len(ring))
+	first := start
+	if next-start > n {
+		first = next - n
+	}
+	if since > first {
+		first = since
+	}
+	es := []Entry{}
+	for i := first; i < next; i++ {
+		es = append(es, ring[i%n])
+	}
+	return es
+}
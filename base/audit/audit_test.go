@@ -0,0 +1,43 @@
+package audit_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/scion-time/base/audit"
+)
+
+func TestAudit(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "audit.log")
+	err := audit.SetFile(name)
+	if err != nil {
+		t.Fatalf("SetFile failed: %v", err)
+	}
+	for i := 0; i != 3; i++ {
+		err = audit.Record(audit.Entry{
+			Op:         audit.OpAdjust,
+			Discipline: "local",
+			Round:      uint64(i + 1),
+			Offset:     time.Duration(i) * time.Microsecond,
+		})
+		if err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+	es := audit.Entries(1)
+	if len(es) != 2 || es[0].Seq != 1 || es[1].Round != 3 {
+		t.Fatalf("Entries(1) = %v; want entries 1 and 2", es)
+	}
+
+	// Sequence numbers continue after the entries in the file
+	err = audit.SetFile(name)
+	if err != nil {
+		t.Fatalf("SetFile failed: %v", err)
+	}
+	_ = audit.Record(audit.Entry{Op: audit.OpStep, Discipline: "global"})
+	es = audit.Entries(0)
+	if len(es) == 0 || es[len(es)-1].Seq != 3 || es[len(es)-1].Op != audit.OpStep {
+		t.Errorf("Entries(0) = %v; want step with sequence number 3 last", es)
+	}
+}
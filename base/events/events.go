@@ -0,0 +1,172 @@
+package events
+
+// Event log: notable events of the time service are recorded in a bounded
+// in-memory ring buffer, which can be queried via the control socket, and
+// optionally mirrored to syslog. Authentication failures, which can be
+// triggered by any sender of packets, are rate-limited so that they cannot
+// crowd out the other events.
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Kind string
+
+const (
+	KindAuthFailure     Kind = "auth_failure"
+	KindHoldoverEntry   Kind = "holdover_entry"
+	KindHoldoverExit    Kind = "holdover_exit"
+	KindPathSwitch      Kind = "path_switch"
+	KindPHCDivergence   Kind = "phc_divergence"
+	KindPHCRecovery     Kind = "phc_recovery"
+	KindQualityChange   Kind = "quality_change"
+	KindSourceSelection Kind = "source_selection"
+	KindStep            Kind = "step"
+	KindStepWithheld    Kind = "step_withheld"
+	KindTAIOffset       Kind = "tai_offset"
+	KindTransportSwitch Kind = "transport_switch"
+)
+
+const (
+	DefaultCapacity = 1024
+
+	authFailureRate  = 1.0 // per second
+	authFailureBurst = 16.0
+)
+
+type Event struct {
+	Seq     uint64    `json:"seq"`
+	Time    time.Time `json:"time"`
+	Kind    Kind      `json:"kind"`
+	Source  string    `json:"source,omitempty"`
+	Message string    `json:"message"`
+}
+
+var (
+	mu     sync.Mutex
+	ring   = make([]Event, DefaultCapacity)
+	next   uint64
+	syslgr syslogWriter
+
+	limits = map[Kind]*limit{
+		KindAuthFailure: {rate: authFailureRate, burst: authFailureBurst, tokens: authFailureBurst},
+	}
+
+	warnings = map[Kind]bool{
+		KindAuthFailure:   true,
+		KindHoldoverEntry: true,
+		KindPHCDivergence: true,
+		KindStep:          true,
+		KindStepWithheld:  true,
+	}
+)
+
+// SetCapacity sets the maximum number of events kept. Recorded events are
+// discarded.
+func SetCapacity(n int) {
+	if n <= 0 {
+		panic("invalid event log capacity")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	ring = make([]Event, n)
+	next = 0
+}
+
+// limit is a token bucket limiting the rate of events of one kind.
+type limit struct {
+	rate, burst float64
+	tokens      float64
+	updated     time.Time
+	suppressed  int
+}
+
+// allow reports whether an event at time t is within the limit l.
+func (l *limit) allow(t time.Time) bool {
+	l.tokens += t.Sub(l.updated).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.updated = t
+	if l.tokens < 1 {
+		l.suppressed++
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// syslogWriter is the subset of *syslog.Writer used to mirror events.
+type syslogWriter interface {
+	Info(m string) error
+	Warning(m string) error
+}
+
+func setSyslog(w syslogWriter) {
+	mu.Lock()
+	defer mu.Unlock()
+	syslgr = w
+}
+
+// Record adds an event of kind k concerning source, which may be empty, to the
+// event log.
+func Record(k Kind, source, format string, args ...any) {
+	e := Event{
+		Time:    time.Now(),
+		Kind:    k,
+		Source:  source,
+		Message: fmt.Sprintf(format, args...),
+	}
+	mu.Lock()
+	if l := limits[k]; l != nil {
+		if !l.allow(e.Time) {
+			mu.Unlock()
+			return
+		}
+		if l.suppressed != 0 {
+			e.Message += fmt.Sprintf(" (%d similar events suppressed)", l.suppressed)
+			l.suppressed = 0
+		}
+	}
+	e.Seq = next
+	ring[next%uint64(len(ring))] = e
+	next++
+	w := syslgr
+	mu.Unlock()
+	if w != nil {
+		msg := string(e.Kind) + ": " + e.Message
+		if e.Source != "" {
+			msg = string(e.Kind) + " (" + e.Source + "): " + e.Message
+		}
+		if warnings[k] {
+			_ = w.Warning(msg)
+		} else {
+			_ = w.Info(msg)
+		}
+	}
+}
+
+// Events returns the recorded events with sequence number at least since,
+// oldest first. If kind is not empty, only events of that kind are returned.
+func Events(kind Kind, since uint64) []Event {
+	mu.Lock()
+	defer mu.Unlock()
+	n := uint64(len(ring))
+	first := uint64(0)
+	if next > n {
+		first = next - n
+	}
+	if since > first {
+		first = since
+	}
+	es := []Event{}
+	for i := first; i < next; i++ {
+		e := ring[i%n]
+		if kind == "" || e.Kind == kind {
+			es = append(es, e)
+		}
+	}
+	return es
+}
@@ -0,0 +1,83 @@
+package events_test
+
+import (
+	"testing"
+
+	"example.com/scion-time/base/events"
+)
+
+func TestEvents(t *testing.T) {
+	events.SetCapacity(3)
+	defer events.SetCapacity(events.DefaultCapacity)
+
+	for i := 0; i != 5; i++ {
+		k := events.KindStep
+		if i%2 == 1 {
+			k = events.KindPathSwitch
+		}
+		events.Record(k, "src", "event %d", i)
+	}
+
+	es := events.Events("", 0)
+	if len(es) != 3 {
+		t.Fatalf("Events returned %d events; want 3", len(es))
+	}
+	for i, e := range es {
+		if e.Seq != uint64(i+2) {
+			t.Errorf("event %d has sequence number %d; want %d", i, e.Seq, i+2)
+		}
+	}
+	if es[0].Message != "event 2" {
+		t.Errorf("oldest event is %q; want %q", es[0].Message, "event 2")
+	}
+
+	es = events.Events(events.KindPathSwitch, 0)
+	if len(es) != 1 || es[0].Seq != 3 {
+		t.Errorf("Events(%q) = %v; want event 3 only", events.KindPathSwitch, es)
+	}
+	es = events.Events("", 4)
+	if len(es) != 1 || es[0].Seq != 4 {
+		t.Errorf("Events since 4 = %v; want event 4 only", es)
+	}
+}
+
+// reentrantSyslog queries the event log while an event is written to syslog.
+type reentrantSyslog struct {
+	n int
+}
+
+func (w *reentrantSyslog) Info(m string) error {
+	w.n += len(events.Events("", 0))
+	return nil
+}
+
+func (w *reentrantSyslog) Warning(m string) error {
+	return w.Info(m)
+}
+
+func TestSyslogOutsideLock(t *testing.T) {
+	w := &reentrantSyslog{}
+	events.SetSyslog(w)
+	defer events.SetSyslog(nil)
+
+	events.Record(events.KindPathSwitch, "src", "event")
+	if w.n == 0 {
+		t.Error("event not written to syslog")
+	}
+}
+
+func TestAuthFailureLimit(t *testing.T) {
+	events.SetCapacity(events.DefaultCapacity)
+	for i := 0; i != 10*events.AuthFailureBurst; i++ {
+		events.Record(events.KindAuthFailure, "src", "auth failure %d", i)
+	}
+	events.Record(events.KindStep, "src", "step")
+
+	es := events.Events(events.KindAuthFailure, 0)
+	if len(es) > events.AuthFailureBurst+1 {
+		t.Errorf("recorded %d auth failures; want at most %d", len(es), events.AuthFailureBurst+1)
+	}
+	if es := events.Events(events.KindStep, 0); len(es) != 1 {
+		t.Errorf("recorded %d steps; want 1", len(es))
+	}
+}
@@ -0,0 +1,7 @@
+package events
+
+type SyslogWriter = syslogWriter
+
+var SetSyslog = setSyslog
+
+const AuthFailureBurst = int(authFailureBurst)
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package events
+
+import (
+	"log/syslog"
+)
+
+// EnableSyslog mirrors all subsequently recorded events to the system logger
+// with facility daemon and the given tag.
+func EnableSyslog(tag string) error {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return err
+	}
+	setSyslog(w)
+	return nil
+}
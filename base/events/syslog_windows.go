@@ -0,0 +1,13 @@
+package events
+
+import (
+	"errors"
+)
+
+var errUnsupportedOperation = errors.New("unsupported operation")
+
+// EnableSyslog mirrors all subsequently recorded events to the system logger,
+// which is not available on Windows.
+func EnableSyslog(tag string) error {
+	return errUnsupportedOperation
+}
@@ -0,0 +1,96 @@
+package metrics
+
+// Export of metrics to backends other than Prometheus: all metrics are
+// registered with the default Prometheus registry, which is scraped via the
+// monitoring endpoint. In addition, snapshots of the registry can be pushed
+// periodically to a statsd server or an OpenTelemetry collector.
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ExporterStatsd = "statsd"
+	ExporterOTLP   = "otlp"
+
+	DefaultExportInterval = 10 * time.Second
+)
+
+// Exporter sends snapshots of metric families to a metrics backend.
+type Exporter interface {
+	Export(ctx context.Context, mfs []*dto.MetricFamily) error
+	Close() error
+}
+
+var errUnknownExporter = errors.New("unknown metrics exporter")
+
+// NewExporter returns the exporter exporter, ExporterStatsd or ExporterOTLP,
+// which sends metrics to the server at endpoint (default localhost:8125 for
+// statsd via UDP and localhost:4317 for OTLP via gRPC).
+func NewExporter(ctx context.Context, exporter, endpoint string) (Exporter, error) {
+	switch exporter {
+	case ExporterStatsd:
+		return newStatsdExporter(endpoint)
+	case ExporterOTLP:
+		return newOTLPExporter(ctx, endpoint)
+	}
+	return nil, errUnknownExporter
+}
+
+// Start exports the metrics of the default Prometheus registry via exporter
+// every interval, see NewExporter. The returned function exports a final
+// snapshot and stops the export.
+func Start(ctx context.Context, log *zap.Logger, exporter, endpoint string, interval time.Duration) (
+	func(context.Context) error, error) {
+	if interval <= 0 {
+		panic("invalid metrics export interval")
+	}
+	exp, err := NewExporter(ctx, exporter, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	export := func(ctx context.Context) error {
+		mfs, err := prometheus.DefaultGatherer.Gather()
+		if err != nil {
+			// Partial results are still exported
+			log.Info("failed to gather metrics", zap.Error(err))
+		}
+		return exp.Export(ctx, mfs)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			err := export(ctx)
+			if err != nil {
+				log.Info("failed to export metrics", zap.String("exporter", exporter), zap.Error(err))
+			}
+		}
+	}()
+	return func(ctx context.Context) error {
+		close(stop)
+		<-done
+		err := export(ctx)
+		if cerr := exp.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
@@ -1,6 +1,11 @@
 package metrics
 
 const (
+	ClientOffsetsH         = "The distribution of clock offsets measured per source in seconds"
+	ClientOffsetsN         = "timeservice_client_offsets"
+	ClientRoundTripDelaysH = "The distribution of round trip delays measured per source in seconds"
+	ClientRoundTripDelaysN = "timeservice_client_round_trip_delays"
+
 	DRKeyCacheKeysInsertedH = "The total number of DRKeys inserted into cache"
 	DRKeyCacheKeysInsertedN = "timeservice_drkey_cache_keys_inserted"
 	DRKeyCacheKeysExpiredH  = "The total number of DRKeys expired in the cache"
@@ -8,8 +13,14 @@ const (
 	DRKeyCacheKeysReplacedH = "The total number of DRKeys replaced in the cache"
 	DRKeyCacheKeysReplacedN = "timeservice_drkey_cache_keys_replaced"
 
+	IPClientBroadcastsAcceptedH       = "The total number of broadcast packets accepted via IP"
+	IPClientBroadcastsAcceptedN       = "timeservice_ip_client_broadcasts_accepted"
+	IPClientKoDsReceivedH             = "The total number of kiss-of-death packets received via IP"
+	IPClientKoDsReceivedN             = "timeservice_ip_client_kods_received"
 	IPClientPktsAuthenticatedH        = "The total number of packets authenticated via IP"
 	IPClientPktsAuthenticatedN        = "timeservice_ip_client_pkts_authenticated"
+	IPClientPktsDiscardedH            = "The total number of packets discarded via IP by reason"
+	IPClientPktsDiscardedN            = "timeservice_ip_client_pkts_discarded"
 	IPClientPktsReceivedH             = "The total number of packets received via IP"
 	IPClientPktsReceivedN             = "timeservice_ip_client_pkts_received"
 	IPClientReqsSentH                 = "The total number of requests sent via IP"
@@ -21,15 +32,34 @@ const (
 	IPClientRespsAcceptedInterleavedH = "The total number of responses accepted via IP in interleaved mode"
 	IPClientRespsAcceptedInterleavedN = "timeservice_ip_client_resps_accepted_interleaved"
 
-	IPServerPktsReceivedH = "The total number of packets received via IP"
-	IPServerPktsReceivedN = "timeservice_ip_server_pkts_received"
-	IPServerReqsAcceptedH = "The total number of requests accepted via IP"
-	IPServerReqsAcceptedN = "timeservice_ip_server_reqs_accepted"
-	IPServerReqsServedH   = "The total number of requests served via IP"
-	IPServerReqsServedN   = "timeservice_ip_server_reqs_served"
+	IPServerPktsMalformedH = "The total number of structurally malformed packets received via IP"
+	IPServerPktsMalformedN = "timeservice_ip_server_pkts_malformed"
+	IPServerPktsReceivedH  = "The total number of packets received via IP"
+	IPServerPktsReceivedN  = "timeservice_ip_server_pkts_received"
+	IPServerReqsAcceptedH  = "The total number of requests accepted via IP"
+	IPServerReqsAcceptedN  = "timeservice_ip_server_reqs_accepted"
+	IPServerReqsServedH    = "The total number of requests served via IP"
+	IPServerReqsServedN    = "timeservice_ip_server_reqs_served"
+
+	PHCMonitorDivergedH = "Whether the offset between the system clock and the PHC exceeds its bound, per PHC"
+	PHCMonitorDivergedN = "timeservice_phc_monitor_diverged"
+	PHCMonitorOffsetH   = "The offset of the PHC relative to the system clock in seconds, per PHC"
+	PHCMonitorOffsetN   = "timeservice_phc_monitor_offset"
 
+	SCIONClientPathDelayAttacksH         = "The total number of potential delay attacks detected per SCION path"
+	SCIONClientPathDelayAttacksN         = "timeservice_scion_client_path_delay_attacks_total"
+	SCIONClientPathMedianDelayH          = "The median round trip delay of recent measurements per SCION path"
+	SCIONClientPathMedianDelayN          = "timeservice_scion_client_path_median_delay"
+	SCIONClientPathMinDelayH             = "The minimum round trip delay of recent measurements per SCION path"
+	SCIONClientPathMinDelayN             = "timeservice_scion_client_path_min_delay"
+	SCIONClientPathOffsetStdDevH         = "The standard deviation of recent clock offset measurements per SCION path"
+	SCIONClientPathOffsetStdDevN         = "timeservice_scion_client_path_offset_stddev"
+	SCIONClientPathSamplesH              = "The total number of measurements per SCION path"
+	SCIONClientPathSamplesN              = "timeservice_scion_client_path_samples"
 	SCIONClientPktsAuthenticatedH        = "The total number of packets authenticated via SCION"
 	SCIONClientPktsAuthenticatedN        = "timeservice_scion_client_pkts_authenticated"
+	SCIONClientPktsDiscardedH            = "The total number of packets discarded via SCION by reason"
+	SCIONClientPktsDiscardedN            = "timeservice_scion_client_pkts_discarded"
 	SCIONClientPktsReceivedH             = "The total number of packets received via SCION"
 	SCIONClientPktsReceivedN             = "timeservice_scion_client_pkts_received"
 	SCIONClientReqsSentH                 = "The total number of requests sent via SCION"
@@ -40,18 +70,38 @@ const (
 	SCIONClientRespsAcceptedN            = "timeservice_scion_client_resps_accepted"
 	SCIONClientRespsAcceptedInterleavedH = "The total number of responses accepted via SCION in interleaved mode"
 	SCIONClientRespsAcceptedInterleavedN = "timeservice_scion_client_resps_accepted_interleaved"
+	SCIONClientRespsRejectedH            = "The total number of responses rejected via SCION by path and reason"
+	SCIONClientRespsRejectedN            = "timeservice_scion_client_resps_rejected"
+	SCIONClientSCMPErrorsH               = "The total number of SCMP errors received via SCION"
+	SCIONClientSCMPErrorsN               = "timeservice_scion_client_scmp_errors"
 
-	SCIONServerPktsAuthenticatedH = "The total number of packets authenticated via SCION"
-	SCIONServerPktsAuthenticatedN = "timeservice_scion_server_pkts_authenticated"
-	SCIONServerPktsForwardedH     = "The total number of packets forwarded via SCION"
-	SCIONServerPktsForwardedN     = "timeservice_scion_server_pkts_forwarded"
-	SCIONServerPktsReceivedH      = "The total number of packets received via SCION"
-	SCIONServerPktsReceivedN      = "timeservice_scion_server_pkts_received"
-	SCIONServerReqsAcceptedH      = "The total number of requests accepted via SCION"
-	SCIONServerReqsAcceptedN      = "timeservice_scion_server_reqs_accepted"
-	SCIONServerReqsServedH        = "The total number of requests served via SCION"
-	SCIONServerReqsServedN        = "timeservice_scion_server_reqs_served"
+	SCIONServerASReqsAcceptedH     = "The total number of requests accepted via SCION per source AS"
+	SCIONServerASReqsAcceptedN     = "timeservice_scion_server_as_reqs_accepted"
+	SCIONServerPathCacheEvictionsH = "The total number of reversed paths evicted from the SCION server path cache"
+	SCIONServerPathCacheEvictionsN = "timeservice_scion_server_path_cache_evictions"
+	SCIONServerPathCacheHitsH      = "The total number of responses sent via a reversed path from the SCION server path cache"
+	SCIONServerPathCacheHitsN      = "timeservice_scion_server_path_cache_hits"
+	SCIONServerPathCacheMissesH    = "The total number of responses for which the SCION server reversed the request path"
+	SCIONServerPathCacheMissesN    = "timeservice_scion_server_path_cache_misses"
+	SCIONServerPktsAuthenticatedH  = "The total number of packets authenticated via SCION"
+	SCIONServerPktsAuthenticatedN  = "timeservice_scion_server_pkts_authenticated"
+	SCIONServerPktsForwardedH      = "The total number of packets forwarded via SCION"
+	SCIONServerPktsForwardedN      = "timeservice_scion_server_pkts_forwarded"
+	SCIONServerPktsMalformedH      = "The total number of structurally malformed packets received via SCION"
+	SCIONServerPktsMalformedN      = "timeservice_scion_server_pkts_malformed"
+	SCIONServerPktsReceivedH       = "The total number of packets received via SCION"
+	SCIONServerPktsReceivedN       = "timeservice_scion_server_pkts_received"
+	SCIONServerReqsAcceptedH       = "The total number of requests accepted via SCION"
+	SCIONServerReqsAcceptedN       = "timeservice_scion_server_reqs_accepted"
+	SCIONServerReqsRefusedH        = "The total number of requests refused via SCION per service tier"
+	SCIONServerReqsRefusedN        = "timeservice_scion_server_reqs_refused"
+	SCIONServerReqsServedH         = "The total number of requests served via SCION"
+	SCIONServerReqsServedN         = "timeservice_scion_server_reqs_served"
 
+	ServerBroadcastsSentH        = "The total number of broadcast packets sent"
+	ServerBroadcastsSentN        = "timeservice_server_broadcasts_sent"
+	ServerClientOffsetsH         = "The distribution of clock offsets of downstream clients estimated from interleaved mode requests in seconds"
+	ServerClientOffsetsN         = "timeservice_server_client_offsets"
 	ServerReqsServedInterleavedH = "The total number of requests served in interleaved mode"
 	ServerReqsServedInterleavedN = "timeservice_server_reqs_served_interleaved"
 	ServerRxtIncrementsH         = "The total number of RX timestamps incremented to ensure monotonicity"
@@ -60,13 +110,53 @@ const (
 	ServerTssItemsN              = "timeservice_server_tss_items"
 	ServerTssValuesH             = "The total number of timestamp store values stored"
 	ServerTssValuesN             = "timeservice_server_tss_values"
+	ServerTxtCorrectionH         = "The current correction applied to TX timestamps of basic mode responses per worker (in seconds)"
+	ServerTxtCorrectionN         = "timeservice_server_txt_correction"
 	ServerTxtIncrementsAfterH    = "The total number of TX timestamps incremented after transfer to ensure monotonicity"
 	ServerTxtIncrementsAfterN    = "timeservice_server_txt_increments_after"
 	ServerTxtIncrementsBeforeH   = "The total number of TX timestamps incremented before transfer to ensure monotonicity"
 	ServerTxtIncrementsBeforeN   = "timeservice_server_txt_increments_before"
+	ServerWorkerPktsReceivedH    = "The total number of packets received per server worker"
+	ServerWorkerPktsReceivedN    = "timeservice_server_worker_pkts_received"
+	ServerWorkerQueueDropsH      = "The total number of queued requests dropped per server worker"
+	ServerWorkerQueueDropsN      = "timeservice_server_worker_queue_drops"
+	ServerWorkerReqsServedH      = "The total number of requests served per server worker"
+	ServerWorkerReqsServedN      = "timeservice_server_worker_reqs_served"
 
-	SyncGlobalCorrH = "The current clock correction applied based on global sync"
-	SyncGlobalCorrN = "timeservice_sync_global_corr"
-	SyncLocalCorrH  = "The current clock correction applied based on local sync"
-	SyncLocalCorrN  = "timeservice_sync_local_corr"
+	SyncClockAccuracyH          = "The estimated accuracy of the local clock served to downstream clients in seconds"
+	SyncClockAccuracyN          = "timeservice_sync_clock_accuracy"
+	SyncClockClassH             = "Whether the clock quality served to downstream clients is of the given class (1) or not (0)"
+	SyncClockClassN             = "timeservice_sync_clock_class"
+	SyncClockStratumH           = "The stratum served to downstream clients"
+	SyncClockStratumN           = "timeservice_sync_clock_stratum"
+	SyncClockTreeOffsetH        = "The offset of a disciplined clock relative to the local clock in seconds"
+	SyncClockTreeOffsetN        = "timeservice_sync_clock_tree_offset"
+	SyncGlobalCorrH             = "The current clock correction applied based on global sync"
+	SyncGlobalCorrN             = "timeservice_sync_global_corr"
+	SyncHoldoverH               = "Whether the clock sync is in holdover (1) or not (0)"
+	SyncHoldoverN               = "timeservice_sync_holdover"
+	SyncHoldoverDispersionH     = "The estimated dispersion accumulated in holdover in seconds"
+	SyncHoldoverDispersionN     = "timeservice_sync_holdover_dispersion"
+	SyncHoldoverDurationH       = "The time spent in the current holdover in seconds"
+	SyncHoldoverDurationN       = "timeservice_sync_holdover_duration"
+	SyncInstanceCorrH           = "The current clock correction applied by an additional clock sync instance"
+	SyncInstanceCorrN           = "timeservice_sync_instance_corr"
+	SyncLocalCorrH              = "The current clock correction applied based on local sync"
+	SyncLocalCorrN              = "timeservice_sync_local_corr"
+	SyncPollIntervalH           = "The current poll interval of the clock sync in seconds"
+	SyncPollIntervalN           = "timeservice_sync_poll_interval"
+	SyncSourceRejectionsH       = "The total number of clock corrections to which a source did not contribute, by reason"
+	SyncSourceRejectionsN       = "timeservice_sync_source_rejections"
+	SyncSourceSelectedH         = "Whether a source contributed to the last clock correction (1) or not (0)"
+	SyncSourceSelectedN         = "timeservice_sync_source_selected"
+	SyncSpikesH                 = "The total number of offsets ignored as spikes"
+	SyncSpikesN                 = "timeservice_sync_spikes"
+	SyncStepsDetectedH          = "The total number of persistent offset changes detected"
+	SyncStepsDetectedN          = "timeservice_sync_steps_detected"
+	SyncStepsWithheldH          = "The total number of clock steps withheld for lack of corroboration by independent sources"
+	SyncStepsWithheldN          = "timeservice_sync_steps_withheld"
+	SyncSyntonizationFrequencyH = "The frequency error of the local oscillator estimated by frequency transfer from symmetric peers"
+	SyncSyntonizationFrequencyN = "timeservice_sync_syntonization_frequency"
+	SyncTemperatureH            = "The temperature used for the temperature compensation in degrees Celsius"
+	SyncTemperatureN            = "timeservice_sync_temperature"
 )
@@ -0,0 +1,186 @@
+package metrics
+
+// Export via the OpenTelemetry protocol (OTLP) over gRPC. Counters are sent
+// as cumulative monotonic sums, gauges as gauges, and histograms and summaries
+// as cumulative histograms and summaries, respectively.
+
+import (
+	"context"
+	"math"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	defaultOTLPEndpoint = "localhost:4317"
+
+	otlpServiceName = "timeservice"
+	otlpScopeName   = "example.com/scion-time"
+)
+
+type otlpExporter struct {
+	conn   *grpc.ClientConn
+	client colmetricspb.MetricsServiceClient
+	start  uint64
+}
+
+func newOTLPExporter(ctx context.Context, endpoint string) (*otlpExporter, error) {
+	if endpoint == "" {
+		endpoint = defaultOTLPEndpoint
+	}
+	conn, err := grpc.DialContext(ctx, endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	return &otlpExporter{
+		conn:   conn,
+		client: colmetricspb.NewMetricsServiceClient(conn),
+		start:  uint64(time.Now().UnixNano()),
+	}, nil
+}
+
+func stringKeyValue(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   k,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}},
+	}
+}
+
+func otlpAttributes(lps []*dto.LabelPair) []*commonpb.KeyValue {
+	var kvs []*commonpb.KeyValue
+	for _, lp := range lps {
+		kvs = append(kvs, stringKeyValue(lp.GetName(), lp.GetValue()))
+	}
+	return kvs
+}
+
+func (e *otlpExporter) numberDataPoint(m *dto.Metric, now uint64, value float64) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		Attributes:        otlpAttributes(m.GetLabel()),
+		StartTimeUnixNano: e.start,
+		TimeUnixNano:      now,
+		Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+	}
+}
+
+func (e *otlpExporter) histogramDataPoint(m *dto.Metric, now uint64) *metricspb.HistogramDataPoint {
+	h := m.GetHistogram()
+	sum := h.GetSampleSum()
+	p := &metricspb.HistogramDataPoint{
+		Attributes:        otlpAttributes(m.GetLabel()),
+		StartTimeUnixNano: e.start,
+		TimeUnixNano:      now,
+		Count:             h.GetSampleCount(),
+		Sum:               &sum,
+	}
+	// Prometheus buckets are cumulative, OTLP buckets are not. The implicit
+	// +Inf bucket of Prometheus is the last bucket of OTLP.
+	var prev uint64
+	for _, b := range h.GetBucket() {
+		if math.IsInf(b.GetUpperBound(), +1) {
+			continue
+		}
+		p.ExplicitBounds = append(p.ExplicitBounds, b.GetUpperBound())
+		p.BucketCounts = append(p.BucketCounts, b.GetCumulativeCount()-prev)
+		prev = b.GetCumulativeCount()
+	}
+	p.BucketCounts = append(p.BucketCounts, h.GetSampleCount()-prev)
+	return p
+}
+
+func (e *otlpExporter) summaryDataPoint(m *dto.Metric, now uint64) *metricspb.SummaryDataPoint {
+	s := m.GetSummary()
+	p := &metricspb.SummaryDataPoint{
+		Attributes:        otlpAttributes(m.GetLabel()),
+		StartTimeUnixNano: e.start,
+		TimeUnixNano:      now,
+		Count:             s.GetSampleCount(),
+		Sum:               s.GetSampleSum(),
+	}
+	for _, q := range s.GetQuantile() {
+		p.QuantileValues = append(p.QuantileValues, &metricspb.SummaryDataPoint_ValueAtQuantile{
+			Quantile: q.GetQuantile(),
+			Value:    q.GetValue(),
+		})
+	}
+	return p
+}
+
+func (e *otlpExporter) metric(mf *dto.MetricFamily, now uint64) *metricspb.Metric {
+	x := &metricspb.Metric{
+		Name:        mf.GetName(),
+		Description: mf.GetHelp(),
+	}
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		s := &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			IsMonotonic:            true,
+		}
+		for _, m := range mf.GetMetric() {
+			s.DataPoints = append(s.DataPoints, e.numberDataPoint(m, now, m.GetCounter().GetValue()))
+		}
+		x.Data = &metricspb.Metric_Sum{Sum: s}
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		g := &metricspb.Gauge{}
+		for _, m := range mf.GetMetric() {
+			v := m.GetGauge().GetValue()
+			if mf.GetType() == dto.MetricType_UNTYPED {
+				v = m.GetUntyped().GetValue()
+			}
+			g.DataPoints = append(g.DataPoints, e.numberDataPoint(m, now, v))
+		}
+		x.Data = &metricspb.Metric_Gauge{Gauge: g}
+	case dto.MetricType_HISTOGRAM:
+		h := &metricspb.Histogram{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+		}
+		for _, m := range mf.GetMetric() {
+			h.DataPoints = append(h.DataPoints, e.histogramDataPoint(m, now))
+		}
+		x.Data = &metricspb.Metric_Histogram{Histogram: h}
+	case dto.MetricType_SUMMARY:
+		s := &metricspb.Summary{}
+		for _, m := range mf.GetMetric() {
+			s.DataPoints = append(s.DataPoints, e.summaryDataPoint(m, now))
+		}
+		x.Data = &metricspb.Metric_Summary{Summary: s}
+	default:
+		return nil
+	}
+	return x
+}
+
+func (e *otlpExporter) Export(ctx context.Context, mfs []*dto.MetricFamily) error {
+	now := uint64(time.Now().UnixNano())
+	sm := &metricspb.ScopeMetrics{
+		Scope: &commonpb.InstrumentationScope{Name: otlpScopeName},
+	}
+	for _, mf := range mfs {
+		if m := e.metric(mf, now); m != nil {
+			sm.Metrics = append(sm.Metrics, m)
+		}
+	}
+	_, err := e.client.Export(ctx, &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{
+				Attributes: []*commonpb.KeyValue{stringKeyValue("service.name", otlpServiceName)},
+			},
+			ScopeMetrics: []*metricspb.ScopeMetrics{sm},
+		}},
+	})
+	return err
+}
+
+func (e *otlpExporter) Close() error {
+	return e.conn.Close()
+}
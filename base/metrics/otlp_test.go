@@ -0,0 +1,114 @@
+package metrics_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"google.golang.org/grpc"
+
+	"example.com/scion-time/base/metrics"
+)
+
+type otlpCollector struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	reqs chan *colmetricspb.ExportMetricsServiceRequest
+}
+
+func (c *otlpCollector) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (
+	*colmetricspb.ExportMetricsServiceResponse, error) {
+	c.reqs <- req
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+func TestOTLPExporter(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &otlpCollector{reqs: make(chan *colmetricspb.ExportMetricsServiceRequest, 1)}
+	srv := grpc.NewServer()
+	colmetricspb.RegisterMetricsServiceServer(srv, c)
+	go func() { _ = srv.Serve(l) }()
+	defer srv.Stop()
+
+	reg := prometheus.NewRegistry()
+	cnt := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "reqs", Help: "Requests"}, []string{"src"})
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "offset"})
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "corr", Buckets: []float64{0, 1}})
+	reg.MustRegister(cnt, g, h)
+	cnt.WithLabelValues("a").Add(3)
+	g.Set(-0.5)
+	for _, x := range []float64{-1, 0.5, 0.5, 2} {
+		h.Observe(x)
+	}
+
+	ctx := context.Background()
+	exp, err := metrics.NewExporter(ctx, metrics.ExporterOTLP, l.Addr().String())
+	if err != nil {
+		t.Fatalf("NewExporter failed: %v", err)
+	}
+	defer exp.Close()
+	mfs, _ := reg.Gather()
+	err = exp.Export(ctx, mfs)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	req := <-c.reqs
+
+	if len(req.GetResourceMetrics()) != 1 || len(req.GetResourceMetrics()[0].GetScopeMetrics()) != 1 {
+		t.Fatalf("Export sent %v; want one resource and scope", req)
+	}
+	ms := make(map[string]*metricspb.Metric)
+	for _, m := range req.GetResourceMetrics()[0].GetScopeMetrics()[0].GetMetrics() {
+		ms[m.GetName()] = m
+	}
+
+	s := ms["reqs"].GetSum()
+	if s == nil || !s.GetIsMonotonic() ||
+		s.GetAggregationTemporality() != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE ||
+		len(s.GetDataPoints()) != 1 || s.GetDataPoints()[0].GetAsDouble() != 3 {
+		t.Errorf("Export sent counter %v; want cumulative monotonic sum 3", ms["reqs"])
+	} else if a := s.GetDataPoints()[0].GetAttributes(); len(a) != 1 ||
+		a[0].GetKey() != "src" || a[0].GetValue().GetStringValue() != "a" {
+		t.Errorf("Export sent counter attributes %v; want src=a", a)
+	}
+	if ms["reqs"].GetDescription() != "Requests" {
+		t.Errorf("Export sent description %q; want %q", ms["reqs"].GetDescription(), "Requests")
+	}
+
+	gg := ms["offset"].GetGauge()
+	if gg == nil || len(gg.GetDataPoints()) != 1 || gg.GetDataPoints()[0].GetAsDouble() != -0.5 {
+		t.Errorf("Export sent gauge %v; want -0.5", ms["offset"])
+	}
+
+	// Cumulative Prometheus buckets are converted to OTLP buckets with an
+	// implicit +Inf bucket
+	hh := ms["corr"].GetHistogram()
+	if hh == nil || len(hh.GetDataPoints()) != 1 {
+		t.Fatalf("Export sent histogram %v; want one data point", ms["corr"])
+	}
+	p := hh.GetDataPoints()[0]
+	wantBounds := []float64{0, 1}
+	wantCounts := []uint64{1, 2, 1}
+	if p.GetCount() != 4 || p.GetSum() != 2 ||
+		len(p.GetExplicitBounds()) != len(wantBounds) || len(p.GetBucketCounts()) != len(wantCounts) {
+		t.Fatalf("Export sent histogram data point %v; want count 4, sum 2, bounds %v, counts %v",
+			p, wantBounds, wantCounts)
+	}
+	for i := range wantBounds {
+		if p.GetExplicitBounds()[i] != wantBounds[i] {
+			t.Errorf("histogram bound %d == %v; want %v", i, p.GetExplicitBounds()[i], wantBounds[i])
+		}
+	}
+	for i := range wantCounts {
+		if p.GetBucketCounts()[i] != wantCounts[i] {
+			t.Errorf("histogram bucket %d == %v; want %v", i, p.GetBucketCounts()[i], wantCounts[i])
+		}
+	}
+}
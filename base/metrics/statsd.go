@@ -0,0 +1,170 @@
+package metrics
+
+// Export via the statsd protocol with DogStatsD tags for labels, see
+// https://github.com/statsd/statsd/blob/master/docs/metric_types.md
+//
+// Counters are sent as the increments since the previous export, gauges as
+// absolute values. Histograms and summaries are sent as the counters
+// <name>_count and <name>_bucket with tag le, or as the gauge <name> with tag
+// quantile, respectively. Their <name>_sum is sent as a gauge since it
+// decreases on negative observations.
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	defaultStatsdEndpoint = "localhost:8125"
+
+	// Maximum payload of a statsd datagram that avoids IP fragmentation on
+	// common networks.
+	statsdMaxPacketLen = 1432
+)
+
+type statsdExporter struct {
+	conn net.Conn
+	prev map[string]float64 // previous values of counters by series
+	buf  []byte
+}
+
+func newStatsdExporter(endpoint string) (*statsdExporter, error) {
+	if endpoint == "" {
+		endpoint = defaultStatsdEndpoint
+	}
+	conn, err := net.Dial("udp", endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdExporter{
+		conn: conn,
+		prev: make(map[string]float64),
+	}, nil
+}
+
+func statsdTags(lps []*dto.LabelPair, extra ...string) string {
+	var tags []string
+	for _, lp := range lps {
+		tags = append(tags, lp.GetName()+":"+lp.GetValue())
+	}
+	tags = append(tags, extra...)
+	if len(tags) == 0 {
+		return ""
+	}
+	sort.Strings(tags)
+	return "|#" + strings.Join(tags, ",")
+}
+
+func formatFloat(x float64) string {
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
+
+func (e *statsdExporter) line(l string) error {
+	if len(e.buf) != 0 && len(e.buf)+1+len(l) > statsdMaxPacketLen {
+		err := e.flush()
+		if err != nil {
+			return err
+		}
+	}
+	if len(e.buf) != 0 {
+		e.buf = append(e.buf, '\n')
+	}
+	e.buf = append(e.buf, l...)
+	return nil
+}
+
+func (e *statsdExporter) flush() error {
+	if len(e.buf) == 0 {
+		return nil
+	}
+	_, err := e.conn.Write(e.buf)
+	e.buf = e.buf[:0]
+	return err
+}
+
+func (e *statsdExporter) counter(name, tags string, value float64) error {
+	key := name + tags
+	d := value - e.prev[key]
+	if d < 0 {
+		// Counter reset
+		d = value
+	}
+	e.prev[key] = value
+	if d == 0 {
+		return nil
+	}
+	return e.line(name + ":" + formatFloat(d) + "|c" + tags)
+}
+
+func (e *statsdExporter) gauge(name, tags string, value float64) error {
+	if value < 0 {
+		// A signed value would be interpreted as a change of the gauge
+		err := e.line(name + ":0|g" + tags)
+		if err != nil {
+			return err
+		}
+	}
+	return e.line(name + ":" + formatFloat(value) + "|g" + tags)
+}
+
+func (e *statsdExporter) Export(ctx context.Context, mfs []*dto.MetricFamily) error {
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			tags := statsdTags(m.GetLabel())
+			var err error
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				err = e.counter(name, tags, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				err = e.gauge(name, tags, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				err = e.gauge(name, tags, m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					if err == nil {
+						err = e.counter(name+"_bucket",
+							statsdTags(m.GetLabel(), "le:"+formatFloat(b.GetUpperBound())),
+							float64(b.GetCumulativeCount()))
+					}
+				}
+				if err == nil {
+					err = e.counter(name+"_count", tags, float64(h.GetSampleCount()))
+				}
+				if err == nil {
+					err = e.gauge(name+"_sum", tags, h.GetSampleSum())
+				}
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					if err == nil {
+						err = e.gauge(name,
+							statsdTags(m.GetLabel(), "quantile:"+formatFloat(q.GetQuantile())),
+							q.GetValue())
+					}
+				}
+				if err == nil {
+					err = e.counter(name+"_count", tags, float64(s.GetSampleCount()))
+				}
+				if err == nil {
+					err = e.gauge(name+"_sum", tags, s.GetSampleSum())
+				}
+			}
+			if err != nil {
+				e.buf = e.buf[:0]
+				return err
+			}
+		}
+	}
+	return e.flush()
+}
+
+func (e *statsdExporter) Close() error {
+	return e.conn.Close()
+}
@@ -0,0 +1,110 @@
+package metrics_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"example.com/scion-time/base/metrics"
+)
+
+func TestStatsdExporter(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	reg := prometheus.NewRegistry()
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "reqs"}, []string{"src"})
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "offset"})
+	reg.MustRegister(c, g)
+
+	ctx := context.Background()
+	exp, err := metrics.NewExporter(ctx, metrics.ExporterStatsd, conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("NewExporter failed: %v", err)
+	}
+	defer exp.Close()
+
+	read := func() string {
+		b := make([]byte, 2048)
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(b)
+		if err != nil {
+			t.Fatalf("failed to read statsd packet: %v", err)
+		}
+		return string(b[:n])
+	}
+
+	c.WithLabelValues("a").Add(3)
+	g.Set(-0.5)
+	mfs, _ := reg.Gather()
+	err = exp.Export(ctx, mfs)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	want := "offset:0|g\noffset:-0.5|g\nreqs:3|c|#src:a"
+	if p := read(); p != want {
+		t.Errorf("Export sent %q; want %q", p, want)
+	}
+
+	// Counters are sent as increments
+	c.WithLabelValues("a").Add(2)
+	mfs, _ = reg.Gather()
+	err = exp.Export(ctx, mfs)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if p := read(); !strings.Contains(p, "reqs:2|c|#src:a") {
+		t.Errorf("Export sent %q; want counter increment 2", p)
+	}
+}
+
+func TestStatsdExporterHistogramSum(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	reg := prometheus.NewRegistry()
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "corr", Buckets: []float64{0}})
+	reg.MustRegister(h)
+
+	ctx := context.Background()
+	exp, err := metrics.NewExporter(ctx, metrics.ExporterStatsd, conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("NewExporter failed: %v", err)
+	}
+	defer exp.Close()
+
+	for _, tc := range []struct {
+		observe float64
+		want    string
+	}{
+		{2, "corr_count:1|c\ncorr_sum:2|g"},
+		// A decreasing sum is not a counter reset
+		{-3, "corr_bucket:1|c|#le:0\ncorr_count:1|c\ncorr_sum:0|g\ncorr_sum:-1|g"},
+	} {
+		h.Observe(tc.observe)
+		mfs, _ := reg.Gather()
+		err = exp.Export(ctx, mfs)
+		if err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+		b := make([]byte, 2048)
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(b)
+		if err != nil {
+			t.Fatalf("failed to read statsd packet: %v", err)
+		}
+		if p := string(b[:n]); p != tc.want {
+			t.Errorf("Export sent %q; want %q", p, tc.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+//go:build linux
+
+package privilege
+
+// Privilege separation: once all privileged resources have been acquired, the
+// process changes to an unprivileged user, optionally into a chroot
+// directory, and limits its capabilities to CAP_SYS_TIME. All other
+// capabilities are also removed from the bounding set and no_new_privs is set,
+// so that neither the process nor programs it executes can regain them.
+//
+// Sockets opened afterwards must not depend on capabilities other than
+// CAP_SYS_TIME: SO_TIMESTAMPING requires none, but configuring hardware
+// timestamping on a network interface requires CAP_NET_ADMIN, as do socket
+// priorities above 6, and SO_BINDTODEVICE requires CAP_NET_RAW before Linux
+// 5.7. Callers must configure such settings before dropping privileges.
+//
+// Capabilities are per-thread attributes on Linux. They are therefore changed
+// on all threads of the process via syscall.AllThreadsSyscall which is not
+// supported in binaries using cgo (build with CGO_ENABLED=0).
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+var errCgo = errors.New("dropping capabilities requires a binary built with CGO_ENABLED=0")
+
+func allThreadsPrctl(option, arg uintptr) error {
+	_, _, errno := syscall.AllThreadsSyscall6(syscall.SYS_PRCTL, option, arg, 0, 0, 0, 0)
+	if errno == syscall.ENOTSUP {
+		return errCgo
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// dropBoundingSet removes all capabilities except keep from the capability
+// bounding set. This requires CAP_SETPCAP.
+func dropBoundingSet(keep int) error {
+	for c := 0; ; c++ {
+		r, _, errno := syscall.Syscall(syscall.SYS_PRCTL, unix.PR_CAPBSET_READ, uintptr(c), 0)
+		if errno == syscall.EINVAL {
+			// c is beyond the last capability supported by the kernel
+			return nil
+		}
+		if errno != 0 {
+			return errno
+		}
+		if c == keep || r == 0 {
+			continue
+		}
+		err := allThreadsPrctl(unix.PR_CAPBSET_DROP, uintptr(c))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func allThreadsCapset(caps uint32) error {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	data[0].Effective = caps
+	data[0].Permitted = caps
+	_, _, errno := syscall.AllThreadsSyscall(syscall.SYS_CAPSET,
+		uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0)
+	if errno == syscall.ENOTSUP {
+		return errCgo
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func lookupUser(name string) (uid, gid int, groups []int, err error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	uid, err = strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	gid, err = strconv.Atoi(u.Gid)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	gids, err := u.GroupIds()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	for _, s := range gids {
+		g, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		groups = append(groups, g)
+	}
+	return uid, gid, groups, nil
+}
+
+// Drop changes the root directory to dir and the user to userName, if not
+// empty, drops all capabilities except CAP_SYS_TIME, also from the bounding
+// set, and sets no_new_privs.
+func Drop(userName, dir string) error {
+	var uid, gid int
+	var groups []int
+	var err error
+	if userName != "" {
+		uid, gid, groups, err = lookupUser(userName)
+		if err != nil {
+			return err
+		}
+	}
+	// Fails early if capabilities cannot be changed on all threads
+	err = allThreadsPrctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL)
+	if err != nil {
+		return err
+	}
+	// Requires CAP_SETPCAP, which is no longer effective after setuid
+	err = dropBoundingSet(unix.CAP_SYS_TIME)
+	if err != nil {
+		return err
+	}
+	if dir != "" {
+		err = syscall.Chroot(dir)
+		if err != nil {
+			return err
+		}
+		err = os.Chdir("/")
+		if err != nil {
+			return err
+		}
+	}
+	if userName != "" {
+		// Retain the permitted capabilities across the change of user IDs
+		err = allThreadsPrctl(unix.PR_SET_KEEPCAPS, 1)
+		if err != nil {
+			return err
+		}
+		err = syscall.Setgroups(groups)
+		if err != nil {
+			return err
+		}
+		err = syscall.Setgid(gid)
+		if err != nil {
+			return err
+		}
+		err = syscall.Setuid(uid)
+		if err != nil {
+			return err
+		}
+		err = allThreadsPrctl(unix.PR_SET_KEEPCAPS, 0)
+		if err != nil {
+			return err
+		}
+	}
+	err = allThreadsCapset(1 << unix.CAP_SYS_TIME)
+	if err != nil {
+		return err
+	}
+	return allThreadsPrctl(unix.PR_SET_NO_NEW_PRIVS, 1)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package privilege
+
+import (
+	"errors"
+)
+
+var errUnsupportedOperation = errors.New("unsupported operation")
+
+func Drop(userName, dir string) error {
+	return errUnsupportedOperation
+}
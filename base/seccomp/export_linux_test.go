@@ -0,0 +1,20 @@
+//go:build linux && (amd64 || arm64)
+
+package seccomp
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+const (
+	AuditArch = auditArch
+
+	RetKillProcess = seccompRetKillProcess
+	RetAllow       = seccompRetAllow
+)
+
+var Syscalls = append(append([]uintptr(nil), syscalls...), archSyscalls...)
+
+func Filter(defaultAction uint32) []unix.SockFilter {
+	return filter(defaultAction)
+}
@@ -0,0 +1,22 @@
+package seccomp
+
+// Restriction of the system calls available to the process with a seccomp
+// filter, similar to chronyd's -F option. System calls not required by the
+// service are either logged or cause the process to be killed.
+
+import (
+	"errors"
+)
+
+const (
+	ModeOff     = "off"
+	ModeLog     = "log"
+	ModeEnforce = "enforce"
+)
+
+var errUnknownMode = errors.New("unknown seccomp mode")
+
+// ValidMode reports whether m is a supported filter mode.
+func ValidMode(m string) bool {
+	return m == "" || m == ModeOff || m == ModeLog || m == ModeEnforce
+}
@@ -0,0 +1,190 @@
+//go:build linux && (amd64 || arm64)
+
+package seccomp
+
+import (
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTSync = 1
+
+	seccompRetKillProcess = 0x80000000
+	seccompRetLog         = 0x7ffc0000
+	seccompRetAllow       = 0x7fff0000
+
+	seccompDataNr   = 0
+	seccompDataArch = 4
+
+	x32SyscallBit = 0x40000000
+)
+
+// System calls used by the Go runtime (with and without cgo), the network
+// and clock code of the service, and its drivers.
+var syscalls = []uintptr{
+	// Runtime
+	unix.SYS_BRK,
+	unix.SYS_CLONE,
+	unix.SYS_CLONE3,
+	unix.SYS_CLOCK_GETRES,
+	unix.SYS_CLOCK_GETTIME,
+	unix.SYS_CLOCK_NANOSLEEP,
+	unix.SYS_EPOLL_CREATE1,
+	unix.SYS_EPOLL_CTL,
+	unix.SYS_EPOLL_PWAIT,
+	unix.SYS_EVENTFD2,
+	unix.SYS_EXIT,
+	unix.SYS_EXIT_GROUP,
+	unix.SYS_FUTEX,
+	unix.SYS_GETPID,
+	unix.SYS_GETRANDOM,
+	unix.SYS_GETRLIMIT,
+	unix.SYS_GETTID,
+	unix.SYS_GETTIMEOFDAY,
+	unix.SYS_MADVISE,
+	unix.SYS_MEMBARRIER,
+	unix.SYS_MMAP,
+	unix.SYS_MPROTECT,
+	unix.SYS_MREMAP,
+	unix.SYS_MUNMAP,
+	unix.SYS_NANOSLEEP,
+	unix.SYS_PIPE2,
+	unix.SYS_PRLIMIT64,
+	unix.SYS_RESTART_SYSCALL,
+	unix.SYS_RSEQ,
+	unix.SYS_RT_SIGACTION,
+	unix.SYS_RT_SIGPROCMASK,
+	unix.SYS_RT_SIGRETURN,
+	unix.SYS_SCHED_GETAFFINITY,
+	unix.SYS_SCHED_SETAFFINITY,
+	unix.SYS_SCHED_YIELD,
+	unix.SYS_SET_ROBUST_LIST,
+	unix.SYS_SET_TID_ADDRESS,
+	unix.SYS_SIGALTSTACK,
+	unix.SYS_TGKILL,
+	unix.SYS_TIMER_CREATE,
+	unix.SYS_TIMER_DELETE,
+	unix.SYS_TIMER_SETTIME,
+	unix.SYS_UNAME,
+
+	// Files
+	unix.SYS_CLOSE,
+	unix.SYS_DUP3,
+	unix.SYS_FCNTL,
+	unix.SYS_FSTAT,
+	unix.SYS_FSTATFS,
+	unix.SYS_FSYNC,
+	unix.SYS_FTRUNCATE,
+	unix.SYS_GETCWD,
+	unix.SYS_GETDENTS64,
+	unix.SYS_IOCTL,
+	unix.SYS_LSEEK,
+	unix.SYS_MKDIRAT,
+	unix.SYS_OPENAT,
+	unix.SYS_PPOLL,
+	unix.SYS_PREAD64,
+	unix.SYS_PSELECT6,
+	unix.SYS_READ,
+	unix.SYS_READLINKAT,
+	unix.SYS_RENAMEAT,
+	unix.SYS_STATFS,
+	unix.SYS_STATX,
+	unix.SYS_UNLINKAT,
+	unix.SYS_WRITE,
+	unix.SYS_WRITEV,
+
+	// Sockets
+	unix.SYS_ACCEPT4,
+	unix.SYS_BIND,
+	unix.SYS_CONNECT,
+	unix.SYS_GETPEERNAME,
+	unix.SYS_GETSOCKNAME,
+	unix.SYS_GETSOCKOPT,
+	unix.SYS_LISTEN,
+	unix.SYS_RECVFROM,
+	unix.SYS_RECVMMSG,
+	unix.SYS_RECVMSG,
+	unix.SYS_SENDMMSG,
+	unix.SYS_SENDMSG,
+	unix.SYS_SENDTO,
+	unix.SYS_SETSOCKOPT,
+	unix.SYS_SHUTDOWN,
+	unix.SYS_SOCKET,
+
+	// Clock
+	unix.SYS_ADJTIMEX,
+	unix.SYS_CLOCK_ADJTIME,
+	unix.SYS_CLOCK_SETTIME,
+	unix.SYS_SETTIMEOFDAY,
+	unix.SYS_TIMERFD_CREATE,
+	unix.SYS_TIMERFD_GETTIME,
+	unix.SYS_TIMERFD_SETTIME,
+
+	// XDP
+	unix.SYS_BPF,
+}
+
+func filter(defaultAction uint32) []unix.SockFilter {
+	all := append(syscalls, archSyscalls...)
+	n := len(all)
+	if n > 255 {
+		panic("too many system calls for seccomp filter")
+	}
+	// Layout: architecture check, x32 check, one comparison per system
+	// call, default action, allow.
+	p := []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: seccompDataArch},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 1, Jf: 0, K: auditArch},
+		{Code: unix.BPF_RET | unix.BPF_K, K: seccompRetKillProcess},
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: seccompDataNr},
+		{Code: unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, Jt: uint8(n), Jf: 0, K: x32SyscallBit},
+	}
+	for i, nr := range all {
+		p = append(p, unix.SockFilter{
+			Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K,
+			Jt:   uint8(n - i),
+			Jf:   0,
+			K:    uint32(nr),
+		})
+	}
+	return append(p,
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: defaultAction},
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: seccompRetAllow},
+	)
+}
+
+// Apply installs the seccomp filter in mode m on all threads of the process.
+func Apply(m string) error {
+	var action uint32
+	switch m {
+	case "", ModeOff:
+		return nil
+	case ModeLog:
+		action = seccompRetLog
+	case ModeEnforce:
+		action = seccompRetKillProcess
+	default:
+		return errUnknownMode
+	}
+	p := filter(action)
+	prog := unix.SockFprog{Len: uint16(len(p)), Filter: &p[0]}
+
+	// The filter is synchronized to all other threads, which inherit the
+	// no_new_privs attribute of the calling thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0)
+	if err != nil {
+		return err
+	}
+	_, _, errno := unix.Syscall(unix.SYS_SECCOMP, seccompSetModeFilter, seccompFilterFlagTSync,
+		uintptr(unsafe.Pointer(&prog)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package seccomp
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+const auditArch = unix.AUDIT_ARCH_X86_64
+
+var archSyscalls = []uintptr{
+	unix.SYS_ACCEPT,
+	unix.SYS_ARCH_PRCTL,
+	unix.SYS_DUP2,
+	unix.SYS_EPOLL_CREATE,
+	unix.SYS_EPOLL_WAIT,
+	unix.SYS_LSTAT,
+	unix.SYS_MKDIR,
+	unix.SYS_NEWFSTATAT,
+	unix.SYS_OPEN,
+	unix.SYS_PIPE,
+	unix.SYS_POLL,
+	unix.SYS_READLINK,
+	unix.SYS_RENAME,
+	unix.SYS_SELECT,
+	unix.SYS_STAT,
+	unix.SYS_TIME,
+	unix.SYS_UNLINK,
+}
@@ -0,0 +1,96 @@
+//go:build linux && (amd64 || arm64)
+
+package seccomp_test
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"example.com/scion-time/base/seccomp"
+)
+
+// run evaluates the classic BPF program p for a system call nr on
+// architecture arch and returns the resulting action.
+func run(t *testing.T, p []unix.SockFilter, arch, nr uint32) uint32 {
+	t.Helper()
+	var a uint32
+	for pc := 0; pc < len(p); pc++ {
+		ins := p[pc]
+		switch ins.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			switch ins.K {
+			case 0:
+				a = nr
+			case 4:
+				a = arch
+			default:
+				t.Fatalf("unexpected load offset %d at %d", ins.K, pc)
+			}
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K:
+			if a == ins.K {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K:
+			if a >= ins.K {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case unix.BPF_RET | unix.BPF_K:
+			return ins.K
+		default:
+			t.Fatalf("unexpected instruction %#x at %d", ins.Code, pc)
+		}
+	}
+	t.Fatal("program did not return")
+	return 0
+}
+
+func TestFilter(t *testing.T) {
+	const defaultAction = seccomp.RetKillProcess
+	p := seccomp.Filter(defaultAction)
+	for pc, ins := range p {
+		if ins.Code&0x07 == unix.BPF_JMP {
+			if pc+1+int(ins.Jt) >= len(p) || pc+1+int(ins.Jf) >= len(p) {
+				t.Fatalf("jump out of program at %d", pc)
+			}
+		}
+	}
+
+	seen := make(map[uintptr]bool)
+	for _, nr := range seccomp.Syscalls {
+		if seen[nr] {
+			t.Errorf("system call %d listed more than once", nr)
+		}
+		seen[nr] = true
+		if a := run(t, p, seccomp.AuditArch, uint32(nr)); a != seccomp.RetAllow {
+			t.Errorf("system call %d: action = %#x; want allow", nr, a)
+		}
+	}
+
+	required := []uintptr{
+		unix.SYS_MKDIRAT,
+		unix.SYS_OPENAT,
+		unix.SYS_UNLINKAT,
+		unix.SYS_CLOCK_ADJTIME,
+		unix.SYS_RECVMSG,
+	}
+	for _, nr := range required {
+		if !seen[nr] {
+			t.Errorf("required system call %d not allowed", nr)
+		}
+	}
+
+	if a := run(t, p, seccomp.AuditArch, unix.SYS_PTRACE); a != defaultAction {
+		t.Errorf("ptrace: action = %#x; want %#x", a, uint32(defaultAction))
+	}
+	if a := run(t, p, seccomp.AuditArch, 0x40000000|unix.SYS_READ); a != defaultAction {
+		t.Errorf("x32 read: action = %#x; want %#x", a, uint32(defaultAction))
+	}
+	if a := run(t, p, seccomp.AuditArch^1, unix.SYS_READ); a != seccomp.RetKillProcess {
+		t.Errorf("foreign architecture: action = %#x; want kill", a)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux || !(amd64 || arm64)
+
+package seccomp
+
+import (
+	"errors"
+)
+
+var errUnsupportedOperation = errors.New("unsupported operation")
+
+// Apply installs the seccomp filter in mode m on all threads of the process.
+func Apply(m string) error {
+	switch m {
+	case "", ModeOff:
+		return nil
+	case ModeLog, ModeEnforce:
+		return errUnsupportedOperation
+	default:
+		return errUnknownMode
+	}
+}
@@ -0,0 +1,122 @@
+package systemd
+
+// Integration with the systemd service manager: readiness and watchdog
+// notifications via sd_notify(3) and socket activation via sd_listen_fds(3).
+// All functions are no-ops if the service has not been started by systemd.
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+
+	listenFDsStart = 3
+)
+
+var (
+	listenOnce sync.Once
+	listenMu   sync.Mutex
+	listenFDs  []*os.File
+)
+
+// Notify sends state to the service manager.
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' {
+		// Abstract socket namespace
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// WatchdogInterval returns the interval within which the service manager
+// expects watchdog keepalives, if the watchdog is enabled for this process.
+func WatchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	if s := os.Getenv("WATCHDOG_PID"); s != "" {
+		pid, err := strconv.Atoi(s)
+		if err != nil || pid != os.Getpid() {
+			return 0, false
+		}
+	}
+	return time.Duration(usec) * time.Microsecond, true
+}
+
+func loadListenFDs() {
+	defer func() {
+		// Sockets are not passed on to child processes
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for fd := listenFDsStart; fd != listenFDsStart+n; fd++ {
+		closeOnExec(fd)
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i := fd - listenFDsStart; i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		listenFDs = append(listenFDs, os.NewFile(uintptr(fd), name))
+	}
+}
+
+func udpAddrPort(a *net.UDPAddr) netip.AddrPort {
+	ip, _ := netip.AddrFromSlice(a.IP)
+	return netip.AddrPortFrom(ip.Unmap(), uint16(a.Port))
+}
+
+// ListenUDP returns the UDP socket bound to localAddr that has been passed to
+// the process by the service manager, if any. Each socket is returned at most
+// once.
+func ListenUDP(localAddr *net.UDPAddr) (*net.UDPConn, bool) {
+	listenOnce.Do(loadListenFDs)
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	for i, f := range listenFDs {
+		if f == nil {
+			continue
+		}
+		c, err := net.FilePacketConn(f)
+		if err != nil {
+			continue
+		}
+		conn, ok := c.(*net.UDPConn)
+		if !ok || udpAddrPort(conn.LocalAddr().(*net.UDPAddr)) != udpAddrPort(localAddr) {
+			c.Close()
+			continue
+		}
+		f.Close()
+		listenFDs[i] = nil
+		return conn, true
+	}
+	return nil, false
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package systemd
+
+import (
+	"syscall"
+)
+
+func closeOnExec(fd int) {
+	syscall.CloseOnExec(fd)
+}
@@ -0,0 +1,4 @@
+package systemd
+
+// Sockets are never passed on socket activation on Windows.
+func closeOnExec(fd int) {}
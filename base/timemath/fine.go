@@ -0,0 +1,232 @@
+package timemath
+
+// Durations and instants with sub-nanosecond resolution: the fraction of a
+// nanosecond is carried in units of 2^-16 ns next to the whole nanoseconds, so
+// that the range of time.Duration and time.Time is preserved.
+//
+// Fine values are carried from the NTP timestamps of servers through the
+// client filters to the discipline of reference clocks and the terms of its
+// PLL. The other inputs are whole nanoseconds: client timestamps come from the
+// kernel or the NIC, the discipline of network peers combines offsets dominated
+// by path asymmetry, and the local clock is adjusted in whole nanoseconds.
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// FineFracBits is the number of bits of the fraction of a nanosecond.
+	FineFracBits = 16
+
+	fineFracOne = 1 << FineFracBits
+)
+
+// FineDuration is a duration with a resolution of 2^-16 ns.
+type FineDuration struct {
+	ns   time.Duration // rounded down
+	frac uint16
+}
+
+// FineTime is an instant with a resolution of 2^-16 ns.
+type FineTime struct {
+	t    time.Time // rounded down
+	frac uint16
+}
+
+// FineDurationOf returns the duration ns + frac * 2^-16 ns.
+func FineDurationOf(ns time.Duration, frac int64) FineDuration {
+	return FineDuration{
+		ns:   ns + time.Duration(frac>>FineFracBits),
+		frac: uint16(frac & (fineFracOne - 1)),
+	}
+}
+
+func FineFromDuration(d time.Duration) FineDuration {
+	return FineDuration{ns: d}
+}
+
+func (d FineDuration) Add(e FineDuration) FineDuration {
+	return FineDurationOf(d.ns+e.ns, int64(d.frac)+int64(e.frac))
+}
+
+func (d FineDuration) Sub(e FineDuration) FineDuration {
+	return FineDurationOf(d.ns-e.ns, int64(d.frac)-int64(e.frac))
+}
+
+// Half returns d/2 rounded down to the resolution of d.
+func (d FineDuration) Half() FineDuration {
+	return FineDurationOf(d.ns>>1, (int64(d.ns&1)<<FineFracBits+int64(d.frac))>>1)
+}
+
+func (d FineDuration) Neg() FineDuration {
+	return FineDurationOf(-d.ns, -int64(d.frac))
+}
+
+func (d FineDuration) Less(e FineDuration) bool {
+	return d.ns < e.ns || d.ns == e.ns && d.frac < e.frac
+}
+
+// Duration returns d rounded to the nearest nanosecond.
+func (d FineDuration) Duration() time.Duration {
+	if d.frac >= fineFracOne/2 {
+		return d.ns + 1
+	}
+	return d.ns
+}
+
+// FineFromSeconds returns the duration of s seconds, see Duration.
+func FineFromSeconds(s float64) FineDuration {
+	ns := s * float64(time.Second)
+	whole := math.Floor(ns)
+	return FineDurationOf(time.Duration(whole), int64((ns-whole)*fineFracOne+0.5))
+}
+
+func (d FineDuration) Nanoseconds() float64 {
+	return float64(d.ns) + float64(d.frac)/fineFracOne
+}
+
+func (d FineDuration) Seconds() float64 {
+	return d.Nanoseconds() / 1e9
+}
+
+func (d FineDuration) String() string {
+	return d.Duration().String()
+}
+
+// FineTimeOf returns the instant t + frac * 2^-16 ns for frac in [0, 2^16).
+func FineTimeOf(t time.Time, frac uint16) FineTime {
+	return FineTime{t: t, frac: frac}
+}
+
+// Time returns t rounded to the nearest nanosecond.
+func (t FineTime) Time() time.Time {
+	if t.frac >= fineFracOne/2 {
+		return t.t.Add(1)
+	}
+	return t.t
+}
+
+func (t FineTime) Add(d time.Duration) FineTime {
+	return FineTime{t: t.t.Add(d), frac: t.frac}
+}
+
+func (t FineTime) Sub(u FineTime) FineDuration {
+	return FineDurationOf(t.t.Sub(u.t), int64(t.frac)-int64(u.frac))
+}
+
+// FineMedian is the FineDuration variant of Median.
+func FineMedian(ds []FineDuration) FineDuration {
+	n := len(ds)
+	if n == 0 {
+		panic("unexpected number of duration values")
+	}
+	sort.Slice(ds, func(i, j int) bool {
+		return ds[i].Less(ds[j])
+	})
+	i := n / 2
+	if n%2 != 0 {
+		return ds[i]
+	}
+	return ds[i-1].Add(ds[i].Sub(ds[i-1]).Half())
+}
+
+// RejectFineOutliers is the FineDuration variant of RejectOutliers, with
+// deviations evaluated at nanosecond resolution.
+func RejectFineOutliers(ds []FineDuration, k float64) []FineDuration {
+	idx := FineInliers(ds, k)
+	for j, i := range idx {
+		ds[j] = ds[i]
+	}
+	return ds[:len(idx)]
+}
+
+// FineInliers returns the indices of the values of ds that RejectFineOutliers
+// keeps, in increasing order. ds is not modified.
+func FineInliers(ds []FineDuration, k float64) []int {
+	n := len(ds)
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	if n < 3 {
+		return idx
+	}
+	m := FineMedian(append([]FineDuration(nil), ds...)).Duration()
+	devs := make([]time.Duration, n)
+	for i, d := range ds {
+		devs[i] = Abs(d.Duration() - m)
+	}
+	limit := outlierLimit(devs, k)
+	j := 0
+	for i, d := range ds {
+		if Abs(d.Duration()-m) <= limit {
+			idx[j] = i
+			j++
+		}
+	}
+	return idx[:j]
+}
+
+type weightedFine struct {
+	ds []FineDuration
+	ws []float64
+}
+
+func (x weightedFine) Len() int           { return len(x.ds) }
+func (x weightedFine) Less(i, j int) bool { return x.ds[i].Less(x.ds[j]) }
+
+func (x weightedFine) Swap(i, j int) {
+	x.ds[i], x.ds[j] = x.ds[j], x.ds[i]
+	x.ws[i], x.ws[j] = x.ws[j], x.ws[i]
+}
+
+// FineWeightedMedian returns the weighted median of ds with the non-negative
+// weights ws: the value below and above which at most half of the total weight
+// lies, or the midpoint of the two values enclosing exactly half of it. ds and
+// ws are sorted in place. Without positive weights, the median is returned.
+func FineWeightedMedian(ds []FineDuration, ws []float64) FineDuration {
+	n := len(ds)
+	if n == 0 || len(ws) != n {
+		panic("unexpected number of duration values")
+	}
+	sort.Sort(weightedFine{ds, ws})
+	var total float64
+	for _, w := range ws {
+		total += w
+	}
+	if !(total > 0) {
+		return FineMedian(ds)
+	}
+	var sum float64
+	for i := 0; i != n; i++ {
+		sum += ws[i]
+		if sum > total/2 {
+			return ds[i]
+		}
+		if sum == total/2 {
+			for j := i + 1; j != n; j++ {
+				if ws[j] > 0 {
+					return ds[i].Add(ds[j].Sub(ds[i]).Half())
+				}
+			}
+			return ds[i]
+		}
+	}
+	return ds[n-1]
+}
+
+// RejectWeightedFineOutliers is the variant of RejectFineOutliers for values
+// with weights, which are kept with their values.
+func RejectWeightedFineOutliers(ds []FineDuration, ws []float64, k float64) (
+	[]FineDuration, []float64) {
+	if len(ws) != len(ds) {
+		panic("unexpected number of weight values")
+	}
+	idx := FineInliers(ds, k)
+	for j, i := range idx {
+		ds[j], ws[j] = ds[i], ws[i]
+	}
+	return ds[:len(idx)], ws[:len(idx)]
+}
@@ -72,3 +72,58 @@ func FaultTolerantMidpoint(ds []time.Duration) time.Duration {
 	m = ds[f] + (ds[n-1-f]-ds[f])/2
 	return m
 }
+
+// minMAD is the lower bound of the median absolute deviation used for outlier
+// rejection, on the order of the resolution of offset measurements. Without
+// it, values that agree to within the resolution would be rejected as soon as
+// the majority of the values happen to be identical.
+const minMAD = 1 * time.Microsecond
+
+// outlierLimit returns the maximum deviation from the median of values with
+// absolute deviations devs that is not considered an outlier.
+func outlierLimit(devs []time.Duration, k float64) time.Duration {
+	mad := Median(devs)
+	if mad < minMAD {
+		mad = minMAD
+	}
+	return time.Duration(k * float64(mad))
+}
+
+// RejectOutliers returns the values of ds that are at most k median absolute
+// deviations (MAD) away from the median of ds, with the MAD bounded below by
+// the measurement resolution. The order of ds is not preserved. Less than
+// three values are returned unchanged.
+func RejectOutliers(ds []time.Duration, k float64) []time.Duration {
+	idx := Inliers(ds, k)
+	for j, i := range idx {
+		ds[j] = ds[i]
+	}
+	return ds[:len(idx)]
+}
+
+// Inliers returns the indices of the values of ds that RejectOutliers keeps,
+// in increasing order. ds is not modified.
+func Inliers(ds []time.Duration, k float64) []int {
+	n := len(ds)
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	if n < 3 {
+		return idx
+	}
+	m := Median(append([]time.Duration(nil), ds...))
+	devs := make([]time.Duration, n)
+	for i, d := range ds {
+		devs[i] = Abs(d - m)
+	}
+	limit := outlierLimit(devs, k)
+	j := 0
+	for i, d := range ds {
+		if Abs(d-m) <= limit {
+			idx[j] = i
+			j++
+		}
+	}
+	return idx[:j]
+}
@@ -30,3 +30,127 @@ func TestFaultTolerantMidpoint(t *testing.T) {
 		t.Errorf("FaultTolerantMidpoint(%v) == %d; want %d", ds, x, m)
 	}
 }
+
+func TestRejectOutliers(t *testing.T) {
+	ds := []time.Duration{
+		3 * time.Millisecond,
+		-1 * time.Millisecond,
+		1 * time.Millisecond,
+		2 * time.Millisecond,
+		time.Second,
+	}
+	x := timemath.RejectOutliers(ds, 3)
+	if len(x) != 4 || timemath.Median(x) != 3*time.Millisecond/2 {
+		t.Errorf("RejectOutliers(%v, 3) == %v; want 4 values with median 1.5ms", ds, x)
+	}
+	ds = []time.Duration{time.Second, 0}
+	x = timemath.RejectOutliers(ds, 3)
+	if len(x) != 2 {
+		t.Errorf("RejectOutliers(%v, 3) == %v; want %v", ds, x, ds)
+	}
+	// Values within the measurement resolution of identical values are kept
+	ds = []time.Duration{5 * time.Millisecond, 5 * time.Millisecond, 5 * time.Millisecond, 5*time.Millisecond + 500}
+	x = timemath.RejectOutliers(ds, 3)
+	if len(x) != 4 {
+		t.Errorf("RejectOutliers(%v, 3) == %v; want %v", ds, x, ds)
+	}
+	ds = []time.Duration{5 * time.Millisecond, 5 * time.Millisecond, 5 * time.Millisecond, 6 * time.Millisecond}
+	x = timemath.RejectOutliers(ds, 3)
+	if len(x) != 3 {
+		t.Errorf("RejectOutliers(%v, 3) == %v; want 3 values", ds, x)
+	}
+}
+
+func TestRejectFineOutliers(t *testing.T) {
+	ms := func(x float64) timemath.FineDuration {
+		return timemath.FineFromDuration(time.Duration(x * float64(time.Millisecond)))
+	}
+	ds := []timemath.FineDuration{ms(2), ms(2), ms(2), ms(2.0005), ms(40)}
+	x := timemath.RejectFineOutliers(ds, 3)
+	if len(x) != 4 {
+		t.Errorf("RejectFineOutliers() == %v; want 4 values", x)
+	}
+	ds = []timemath.FineDuration{ms(2), ms(2), ms(2), ms(2.0005), ms(40)}
+	ws := []float64{1, 2, 3, 4, 5}
+	x, w := timemath.RejectWeightedFineOutliers(ds, ws, 3)
+	if len(x) != 4 || len(w) != 4 || w[3] != 4 {
+		t.Errorf("RejectWeightedFineOutliers() == %v, %v; want 4 values with their weights", x, w)
+	}
+}
+
+func TestFineDuration(t *testing.T) {
+	t0 := timemath.FineTimeOf(time.Unix(0, 10), 0x8000) // 10.5 ns
+	t1 := timemath.FineTimeOf(time.Unix(0, 13), 0x4000) // 13.25 ns
+	d := t1.Sub(t0)
+	if d.Nanoseconds() != 2.75 || d.Duration() != 3 {
+		t.Errorf("Sub == %v ns; want 2.75 ns", d.Nanoseconds())
+	}
+	d = t0.Sub(t1)
+	if d.Nanoseconds() != -2.75 || d.Duration() != -3 {
+		t.Errorf("Sub == %v ns; want -2.75 ns", d.Nanoseconds())
+	}
+	if h := d.Half(); h.Nanoseconds() != -1.375 {
+		t.Errorf("Half == %v ns; want -1.375 ns", h.Nanoseconds())
+	}
+	if h := timemath.FineFromDuration(-3).Half(); h.Nanoseconds() != -1.5 {
+		t.Errorf("Half == %v ns; want -1.5 ns", h.Nanoseconds())
+	}
+	ds := []timemath.FineDuration{
+		timemath.FineDurationOf(1, 0),
+		timemath.FineDurationOf(1, 0x4000),
+		timemath.FineDurationOf(-1, 0),
+		timemath.FineDurationOf(1, 0x8000),
+	}
+	if m := timemath.FineMedian(ds); m.Nanoseconds() != 1.125 {
+		t.Errorf("FineMedian == %v ns; want 1.125 ns", m.Nanoseconds())
+	}
+}
+
+func TestFineWeightedMedian(t *testing.T) {
+	ds := []timemath.FineDuration{
+		timemath.FineFromDuration(30),
+		timemath.FineFromDuration(10),
+		timemath.FineFromDuration(20),
+	}
+	ws := []float64{1, 5, 1}
+	if m := timemath.FineWeightedMedian(ds, ws); m.Duration() != 10 {
+		t.Errorf("FineWeightedMedian == %v; want 10ns", m)
+	}
+	ws = []float64{1, 1, 1}
+	if m := timemath.FineWeightedMedian(ds, ws); m.Duration() != 20 {
+		t.Errorf("FineWeightedMedian == %v; want 20ns", m)
+	}
+	ds = []timemath.FineDuration{timemath.FineFromDuration(10), timemath.FineFromDuration(20)}
+	ws = []float64{2, 2}
+	if m := timemath.FineWeightedMedian(ds, ws); m.Duration() != 15 {
+		t.Errorf("FineWeightedMedian == %v; want 15ns", m)
+	}
+	ws = []float64{0, 0}
+	if m := timemath.FineWeightedMedian(ds, ws); m.Duration() != 15 {
+		t.Errorf("FineWeightedMedian == %v; want 15ns", m)
+	}
+}
+
+func TestRejectWeightedFineOutliers(t *testing.T) {
+	var ds []timemath.FineDuration
+	for _, d := range []time.Duration{
+		3 * time.Millisecond,
+		-1 * time.Millisecond,
+		time.Second,
+		1 * time.Millisecond,
+		2 * time.Millisecond,
+	} {
+		ds = append(ds, timemath.FineFromDuration(d))
+	}
+	ws := []float64{3, 4, 100, 1, 2}
+	x, y := timemath.RejectWeightedFineOutliers(ds, ws, 3)
+	if len(x) != 4 || len(y) != 4 {
+		t.Fatalf("RejectWeightedFineOutliers returned %d values; want 4", len(x))
+	}
+	for i := range x {
+		if w := x[i].Duration() / time.Millisecond; w < -1 || w > 3 || y[i] == 100 ||
+			(w == -1 && y[i] != 4) || (w == 3 && y[i] != 3) {
+			t.Errorf("RejectWeightedFineOutliers returned %v with weight %v", x[i], y[i])
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package benchmark
+
+// Burst mode of the IP benchmark: each client sends its basic mode requests in
+// bursts of equal sized packets with a single system call using UDP generic
+// segmentation offload (GSO) and receives the responses, where supported,
+// coalesced with generic receive offload (GRO). This puts a higher packet rate
+// on the server than the regular benchmark, which measures one request at a
+// time per client.
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/net/ntp"
+	"example.com/scion-time/net/udp"
+)
+
+func runIPBurst(cfg Config, log *zap.Logger, conn *net.UDPConn, remoteAddr *net.UDPAddr,
+	gso bool, round uint32) (map[ntp.Time64]time.Time, error) {
+	pending := make(map[ntp.Time64]time.Time, cfg.Burst)
+	buf := make([]byte, 0, cfg.Burst*ntp.PacketLen)
+	var pkt []byte
+	for i := 0; i != cfg.Burst; i++ {
+		req := ntp.Packet{}
+		req.SetVersion(ntp.VersionMax)
+		req.SetMode(ntp.ModeClient)
+		// transmit times only identify requests, see RFC 9109
+		req.TransmitTime = ntp.Time64{Seconds: round, Fraction: uint32(i)}
+		ntp.EncodePacket(&pkt, &req)
+		buf = append(buf, pkt...)
+		pending[req.TransmitTime] = time.Time{}
+	}
+	t0 := time.Now()
+	for k := range pending {
+		pending[k] = t0
+	}
+	if gso {
+		return pending, udp.WriteSegments(conn, buf, ntp.PacketLen, remoteAddr.AddrPort())
+	}
+	for len(buf) != 0 {
+		_, err := conn.WriteToUDPAddrPort(buf[:ntp.PacketLen], remoteAddr.AddrPort())
+		if err != nil {
+			return pending, err
+		}
+		buf = buf[ntp.PacketLen:]
+	}
+	return pending, nil
+}
+
+func runIPBurstClient(cfg Config, log *zap.Logger, localAddr, remoteAddr *net.UDPAddr, st *stats) {
+	hg := newHistogram()
+	errs := make(map[string]int)
+	numRequests := 0
+	defer func() { st.add(hg, numRequests, errs) }()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: localAddr.IP, Zone: localAddr.Zone})
+	if err != nil {
+		errs[errorKind(err)] += cfg.NumRequests
+		numRequests = cfg.NumRequests
+		return
+	}
+	defer conn.Close()
+	err = udp.EnableGRO(conn)
+	if err != nil {
+		log.Debug("failed to enable generic receive offload", zap.Error(err))
+	}
+
+	gso := true
+	buf := make([]byte, 1<<16)
+	oob := make([]byte, udp.SegmentLen())
+	var segs [][]byte
+	for round := uint32(1); numRequests < cfg.NumRequests; round++ {
+		pending, err := runIPBurst(cfg, log, conn, remoteAddr, gso, round)
+		if err != nil && gso {
+			log.Info("failed to send burst with generic segmentation offload", zap.Error(err))
+			gso = false
+			pending, err = runIPBurst(cfg, log, conn, remoteAddr, gso, round)
+		}
+		numRequests += cfg.Burst
+		if err != nil {
+			errs[errorKind(err)] += cfg.Burst
+			continue
+		}
+		err = conn.SetReadDeadline(time.Now().Add(cfg.Timeout))
+		if err != nil {
+			errs[errorKind(err)] += len(pending)
+			continue
+		}
+		for len(pending) != 0 {
+			n, oobn, _, _, err := conn.ReadMsgUDPAddrPort(buf, oob)
+			t3 := time.Now()
+			if err != nil {
+				if !errors.Is(err, os.ErrDeadlineExceeded) {
+					log.Info("failed to read packet", zap.Error(err))
+				}
+				errs[errorKind(err)] += len(pending)
+				break
+			}
+			segs = append(segs[:0], buf[:n])
+			if segSize, ok := udp.SegmentSizeFromOOBData(oob[:oobn]); ok {
+				segs = udp.AppendSegments(segs[:0], buf[:n], segSize)
+			}
+			for _, seg := range segs {
+				var resp ntp.Packet
+				err = ntp.DecodePacket(&resp, seg)
+				if err != nil {
+					continue
+				}
+				t0, ok := pending[resp.OriginTime]
+				if !ok {
+					continue
+				}
+				delete(pending, resp.OriginTime)
+				hg.RecordValue(t3.Sub(t0).Microseconds())
+			}
+		}
+	}
+}
+
+func runIPBurstBenchmark(cfg Config, localAddr, remoteAddr *net.UDPAddr, log *zap.Logger) {
+	st := newStats()
+	sg := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(cfg.NumClients)
+	for i := cfg.NumClients; i > 0; i-- {
+		go func() {
+			defer wg.Done()
+			<-sg
+			runIPBurstClient(cfg, log, localAddr, remoteAddr, st)
+		}()
+	}
+	t0 := time.Now()
+	close(sg)
+	wg.Wait()
+	st.print(os.Stdout, time.Since(t0))
+}
@@ -1,5 +1,32 @@
 package benchmark
 
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+type Config struct {
+	NumClients  int
+	NumRequests int // per client
+	Timeout     time.Duration
+	Burst       int // requests per burst, IP only
+}
+
+type stats struct {
+	mu              sync.Mutex
+	latency         *hdrhistogram.Histogram
+	numMeasurements int
+	numErrors       int
+	errors          map[string]int
+}
+
 func contains(s []string, v string) bool {
 	for _, x := range s {
 		if x == v {
@@ -8,3 +35,73 @@ func contains(s []string, v string) bool {
 	}
 	return false
 }
+
+// errorKind classifies err without details that vary between requests, such
+// as local addresses.
+func errorKind(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return opErr.Op + ": " + opErr.Err.Error()
+	}
+	return err.Error()
+}
+
+func newHistogram() *hdrhistogram.Histogram {
+	return hdrhistogram.New(1, 50000, 5)
+}
+
+func newStats() *stats {
+	return &stats{
+		latency: newHistogram(),
+		errors:  make(map[string]int),
+	}
+}
+
+func (s *stats) add(hg *hdrhistogram.Histogram, numMeasurements int, errs map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency.Merge(hg)
+	s.numMeasurements += numMeasurements
+	for e, n := range errs {
+		s.errors[e] += n
+		s.numErrors += n
+	}
+}
+
+func (s *stats) print(w io.Writer, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	numResponses := s.latency.TotalCount()
+	fmt.Fprintf(w, "duration: %v\n", d)
+	fmt.Fprintf(w, "measurements: %d, errors: %d (%.2f%%)\n",
+		s.numMeasurements, s.numErrors, 100*float64(s.numErrors)/float64(max(s.numMeasurements, 1)))
+	fmt.Fprintf(w, "responses: %d (%.1f/s)\n", numResponses, float64(numResponses)/d.Seconds())
+	fmt.Fprintf(w, "latency [us]: min %d, p50 %d, p90 %d, p99 %d, p99.9 %d, max %d\n",
+		s.latency.Min(),
+		s.latency.ValueAtQuantile(50),
+		s.latency.ValueAtQuantile(90),
+		s.latency.ValueAtQuantile(99),
+		s.latency.ValueAtQuantile(99.9),
+		s.latency.Max(),
+	)
+	errs := make([]string, 0, len(s.errors))
+	for e := range s.errors {
+		errs = append(errs, e)
+	}
+	sort.Strings(errs)
+	for _, e := range errs {
+		fmt.Fprintf(w, "error: %q: %d\n", e, s.errors[e])
+	}
+	s.latency.PercentilesPrint(w, 1, 1.0)
+}
+
+func max(x, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
@@ -8,26 +8,32 @@ import (
 	"sync"
 	"time"
 
-	"github.com/HdrHistogram/hdrhistogram-go"
 	"go.uber.org/zap"
 
 	"example.com/scion-time/core/client"
 )
 
-func RunIPBenchmark(localAddr, remoteAddr *net.UDPAddr, authModes []string, ntskeServer string, log *zap.Logger) {
-	// const numClientGoroutine = 8
-	// const numRequestPerClient = 10000
-	const numClientGoroutine = 1
-	const numRequestPerClient = 20_000
-	var mu sync.Mutex
+func RunIPBenchmark(cfg Config, localAddr, remoteAddr *net.UDPAddr, authModes []string, ntskeServer string, log *zap.Logger) {
+	if cfg.NumClients <= 0 || cfg.NumRequests <= 0 || cfg.Timeout <= 0 {
+		panic("invalid benchmark configuration")
+	}
+	if cfg.Burst > 1 {
+		if len(authModes) != 0 {
+			log.Fatal("burst mode does not support authentication")
+		}
+		runIPBurstBenchmark(cfg, localAddr, remoteAddr, log)
+		return
+	}
+	st := newStats()
 	sg := make(chan struct{})
 	var wg sync.WaitGroup
-	wg.Add(numClientGoroutine)
+	wg.Add(cfg.NumClients)
 
-	for i := numClientGoroutine; i > 0; i-- {
+	for i := cfg.NumClients; i > 0; i-- {
 		go func() {
 			var err error
-			hg := hdrhistogram.New(1, 50000, 5)
+			hg := newHistogram()
+			errs := make(map[string]int)
 			ctx := context.Background()
 
 			c := &client.IPClient{
@@ -52,19 +58,20 @@ func RunIPBenchmark(localAddr, remoteAddr *net.UDPAddr, authModes []string, ntsk
 
 			defer wg.Done()
 			<-sg
-			for j := numRequestPerClient; j > 0; j-- {
+			for j := cfg.NumRequests; j > 0; j-- {
+				ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
 				_, err = client.MeasureClockOffsetIP(ctx, log, c, localAddr, remoteAddr)
+				cancel()
 				if err != nil {
+					errs[errorKind(err)]++
 					log.Info("failed to measure clock offset", zap.Error(err))
 				}
 			}
-			mu.Lock()
-			defer mu.Unlock()
-			hg.PercentilesPrint(os.Stdout, 1, 1.0)
+			st.add(hg, cfg.NumRequests, errs)
 		}()
 	}
 	t0 := time.Now()
 	close(sg)
 	wg.Wait()
-	log.Info(time.Since(t0).String())
+	st.print(os.Stdout, time.Since(t0))
 }
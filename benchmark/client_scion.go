@@ -8,7 +8,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/HdrHistogram/hdrhistogram-go"
 	"go.uber.org/zap"
 
 	"github.com/scionproto/scion/pkg/daemon"
@@ -20,20 +19,20 @@ import (
 	"example.com/scion-time/net/udp"
 )
 
-func RunSCIONBenchmark(daemonAddr string, localAddr, remoteAddr *snet.UDPAddr, authModes []string, ntskeServer string, log *zap.Logger) {
-	// const numClientGoroutine = 8
-	// const numRequestPerClient = 10000
-	const numClientGoroutine = 1
-	const numRequestPerClient = 20_000
-	var mu sync.Mutex
+func RunSCIONBenchmark(cfg Config, daemonAddr string, localAddr, remoteAddr *snet.UDPAddr, authModes []string, ntskeServer string, log *zap.Logger) {
+	if cfg.NumClients <= 0 || cfg.NumRequests <= 0 || cfg.Timeout <= 0 {
+		panic("invalid benchmark configuration")
+	}
+	st := newStats()
 	sg := make(chan struct{})
 	var wg sync.WaitGroup
-	wg.Add(numClientGoroutine)
+	wg.Add(cfg.NumClients)
 
-	for i := numClientGoroutine; i > 0; i-- {
+	for i := cfg.NumClients; i > 0; i-- {
 		go func() {
 			var err error
-			hg := hdrhistogram.New(1, 50000, 5)
+			hg := newHistogram()
+			errs := make(map[string]int)
 			ctx := context.Background()
 
 			dc := scion.NewDaemonConnector(ctx, daemonAddr)
@@ -90,9 +89,12 @@ func RunSCIONBenchmark(daemonAddr string, localAddr, remoteAddr *snet.UDPAddr, a
 			defer wg.Done()
 			<-sg
 			ntpcs := []*client.SCIONClient{c}
-			for j := numRequestPerClient; j > 0; j-- {
+			for j := cfg.NumRequests; j > 0; j-- {
+				ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
 				_, err = client.MeasureClockOffsetSCION(ctx, log, ntpcs, laddr, raddr, ps)
+				cancel()
 				if err != nil {
+					errs[errorKind(err)]++
 					log.Info("failed to measure clock offset",
 						zap.Stringer("remoteIA", raddr.IA),
 						zap.Stringer("remoteHost", raddr.Host),
@@ -100,13 +102,11 @@ func RunSCIONBenchmark(daemonAddr string, localAddr, remoteAddr *snet.UDPAddr, a
 					)
 				}
 			}
-			mu.Lock()
-			defer mu.Unlock()
-			hg.PercentilesPrint(os.Stdout, 1, 1.0)
+			st.add(hg, cfg.NumRequests, errs)
 		}()
 	}
 	t0 := time.Now()
 	close(sg)
 	wg.Wait()
-	log.Info(time.Since(t0).String())
+	st.print(os.Stdout, time.Since(t0))
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net"
+	"sort"
 	"sync/atomic"
 	"time"
 
@@ -11,44 +12,182 @@ import (
 
 	"go.uber.org/zap"
 
-	"example.com/scion-time/base/crypto"
 	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/net/ntp"
 	"example.com/scion-time/net/scion"
 	"example.com/scion-time/net/udp"
 )
 
 type measurement struct {
-	off time.Duration
-	err error
+	off    timemath.FineDuration
+	weight float64
+	err    error
+}
+
+// Measurement is the result of an offset measurement of a reference clock.
+// Weight is the filter weight of the measurement, see SampleWeight.
+type Measurement struct {
+	Offset timemath.FineDuration
+	Weight float64
+	Err    error
 }
 
 type ReferenceClock interface {
 	MeasureClockOffset(ctx context.Context, log *zap.Logger) (time.Duration, error)
 }
 
+// Stopper is implemented by reference clocks that run goroutines in the
+// background, which are stopped when the clock is removed.
+type Stopper interface {
+	Stop()
+}
+
+// FineReferenceClock is implemented by reference clocks that measure clock
+// offsets with sub-nanosecond resolution.
+type FineReferenceClock interface {
+	ReferenceClock
+	MeasureClockOffsetFine(ctx context.Context, log *zap.Logger) (timemath.FineDuration, error)
+}
+
+// upstream identifies the server answering on behalf of a reference, which
+// may change over time for anycast addresses or servers behind load
+// balancers.
+type upstream struct {
+	stratum uint8
+	refID   uint32
+}
+
+func upstreamOf(pkt *ntp.Packet) upstream {
+	return upstream{stratum: pkt.Stratum, refID: pkt.ReferenceID}
+}
+
 type ReferenceClockClient struct {
 	numOpsInProgress uint32
 }
 
+// OffsetGate bounds the absolute clock offset of accepted measurements by
+// Fraction of their round trip delay plus Budget.
+type OffsetGate struct {
+	Fraction float64
+	Budget   time.Duration
+}
+
 var (
-	errNoPaths = errors.New("failed to measure clock offset: no paths")
+	errNoPaths        = errors.New("failed to measure clock offset: no paths")
+	errNoMeasurements = errors.New("failed to measure clock offset: no successful measurements")
+	errOffsetGate     = errors.New("failed to measure clock offset: offset exceeds round trip delay gate")
 
 	ipMetrics    atomic.Pointer[ipClientMetrics]
 	scionMetrics atomic.Pointer[scionClientMetrics]
+
+	interleavedMaxAge atomic.Int64
+
+	offsetGate           atomic.Pointer[OffsetGate]
+	offsetGateArmed      atomic.Bool
+	offsetGateRejections atomic.Int64
+)
+
+const (
+	defaultInterleavedMaxAge = 1 * time.Second
+
+	// offsetGateMaxRejections is the number of consecutive measurements
+	// rejected by the offset gate after which the gate is disarmed, e.g.,
+	// because the local clock has been disturbed and needs to be stepped.
+	offsetGateMaxRejections = 16
 )
 
 func init() {
 	ipMetrics.Store(newIPClientMetrics())
 	scionMetrics.Store(newSCIONClientMetrics())
+	interleavedMaxAge.Store(int64(defaultInterleavedMaxAge))
+}
+
+// SetInterleavedMaxAge sets the maximum time since the previous exchange with
+// a server for which a client continues in interleaved mode. It should exceed
+// the polling interval of the clients in order to keep interleaved mode
+// across measurement rounds. Servers that dropped their interleaved state in
+// the meantime answer in basic mode, which is accepted.
+func SetInterleavedMaxAge(d time.Duration) {
+	if d <= 0 {
+		panic("invalid interleaved mode maximum age")
+	}
+	interleavedMaxAge.Store(int64(d))
+}
+
+func interleavedStateValid(t time.Time, prevTxTime ntp.Time64) bool {
+	return t.Sub(ntp.TimeFromTime64(prevTxTime)) <= time.Duration(interleavedMaxAge.Load())
+}
+
+// SetOffsetGate rejects measurements outside of gate g, e.g., measurements
+// affected by delay asymmetry attacks. Since large offsets are expected until
+// the local clock has been synchronized, g only applies once ArmOffsetGate has
+// been called. The gate disarms itself after offsetGateMaxRejections
+// consecutive rejections so that the local clock can recover from a large
+// offset; it should be armed again once the local clock has been stepped.
+func SetOffsetGate(g OffsetGate) {
+	if g.Fraction < 0 || g.Budget < 0 {
+		panic("invalid offset gate")
+	}
+	offsetGate.Store(&g)
+}
+
+// ArmOffsetGate activates the offset gate, if any.
+func ArmOffsetGate() {
+	offsetGateRejections.Store(0)
+	offsetGateArmed.Store(true)
+}
+
+func checkOffsetGate(off, rtd time.Duration) error {
+	g := offsetGate.Load()
+	if g == nil || !offsetGateArmed.Load() {
+		return nil
+	}
+	if timemath.Abs(off) > time.Duration(g.Fraction*float64(rtd))+g.Budget {
+		if offsetGateRejections.Add(1) >= offsetGateMaxRejections {
+			offsetGateArmed.Store(false)
+		}
+		return errOffsetGate
+	}
+	offsetGateRejections.Store(0)
+	return nil
 }
 
 func MeasureClockOffsetIP(ctx context.Context, log *zap.Logger,
 	ntpc *IPClient, localAddr, remoteAddr *net.UDPAddr) (
 	time.Duration, error) {
+	off, err := MeasureClockOffsetIPFine(ctx, log, ntpc, localAddr, remoteAddr)
+	return off.Duration(), err
+}
+
+func MeasureClockOffsetIPFine(ctx context.Context, log *zap.Logger,
+	ntpc *IPClient, localAddr, remoteAddr *net.UDPAddr) (
+	timemath.FineDuration, error) {
 	mtrcs := ipMetrics.Load()
+	if !ntpc.Train.Enabled() {
+		return measureExchangeIP(ctx, log, mtrcs, ntpc, localAddr, remoteAddr)
+	}
+	return measureTrain(ctx, ntpc.Train, func() (Sample, error) {
+		_, err := measureExchangeIP(ctx, log, mtrcs, ntpc, localAddr, remoteAddr)
+		if err != nil {
+			return Sample{}, err
+		}
+		return lastSample(ntpc)
+	})
+}
 
+func lastSample(r SampleReporter) (Sample, error) {
+	s, ok := r.LastSample()
+	if !ok {
+		return Sample{}, errNoMeasurements
+	}
+	return s, nil
+}
+
+func measureExchangeIP(ctx context.Context, log *zap.Logger, mtrcs *ipClientMetrics,
+	ntpc *IPClient, localAddr, remoteAddr *net.UDPAddr) (
+	timemath.FineDuration, error) {
 	var err error
-	var off time.Duration
+	var off timemath.FineDuration
 	var nerr, n int
 	if ntpc.InterleavedMode {
 		n = 2
@@ -59,6 +198,9 @@ func MeasureClockOffsetIP(ctx context.Context, log *zap.Logger,
 		o, _, e := ntpc.measureClockOffsetIP(ctx, log, mtrcs, localAddr, remoteAddr)
 		if e == nil {
 			off, err = o, e
+			if ntpc.prev.interleaved || ntpc.useNTPv5() {
+				break
+			}
 		} else {
 			if nerr == i {
 				off, err = o, e
@@ -71,19 +213,20 @@ func MeasureClockOffsetIP(ctx context.Context, log *zap.Logger,
 	return off, err
 }
 
-func collectMeasurements(ctx context.Context, off []time.Duration, ms chan measurement) int {
+// collectMeasurements receives n measurements from ms until ctx is done and
+// returns the successful ones, or the first error if there are none.
+func collectMeasurements(ctx context.Context, n int, ms chan measurement) ([]measurement, error) {
+	var err error
+	var res []measurement
 	i := 0
-	j := 0
-	n := len(off)
 loop:
 	for i != n {
 		select {
 		case m := <-ms:
 			if m.err == nil {
-				if j != len(off) {
-					off[j] = m.off
-					j++
-				}
+				res = append(res, m)
+			} else if err == nil {
+				err = m.err
 			}
 			i++
 		case <-ctx.Done():
@@ -96,72 +239,191 @@ loop:
 			n--
 		}
 	}(n - i)
-	return j
+	if len(res) == 0 {
+		if err == nil {
+			err = classify(ErrTimeout, ctx.Err())
+		}
+		if err != nil {
+			err = &noMeasurementsError{err: err}
+		} else {
+			err = errNoMeasurements
+		}
+	}
+	return res, err
+}
+
+// medianMeasurement returns the median of the offsets of ms with the weight
+// of the measurement selected, or the mean weight of the two measurements
+// enclosing the median. ms is sorted in place.
+func medianMeasurement(ms []measurement) measurement {
+	n := len(ms)
+	if n == 0 {
+		panic("unexpected number of measurements")
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		return ms[i].off.Less(ms[j].off)
+	})
+	i := n / 2
+	if n%2 != 0 {
+		return ms[i]
+	}
+	return measurement{
+		off:    ms[i-1].off.Add(ms[i].off.Sub(ms[i-1].off).Half()),
+		weight: (ms[i-1].weight + ms[i].weight) / 2,
+	}
 }
 
 func MeasureClockOffsetSCION(ctx context.Context, log *zap.Logger,
 	ntpcs []*SCIONClient, localAddr, remoteAddr udp.UDPAddr, ps []snet.Path) (
 	time.Duration, error) {
+	off, err := MeasureClockOffsetSCIONFine(ctx, log, ntpcs, localAddr, remoteAddr, ps)
+	return off.Duration(), err
+}
+
+func MeasureClockOffsetSCIONFine(ctx context.Context, log *zap.Logger,
+	ntpcs []*SCIONClient, localAddr, remoteAddr udp.UDPAddr, ps []snet.Path) (
+	timemath.FineDuration, error) {
+	off, _, err := MeasureWeightedClockOffsetSCION(ctx, log, ntpcs, localAddr, remoteAddr, ps)
+	return off, err
+}
+
+// MeasureWeightedClockOffsetSCION is like MeasureClockOffsetSCIONFine, but
+// also returns the filter weight of the median of the measurements via the
+// paths ps.
+func MeasureWeightedClockOffsetSCION(ctx context.Context, log *zap.Logger,
+	ntpcs []*SCIONClient, localAddr, remoteAddr udp.UDPAddr, ps []snet.Path) (
+	timemath.FineDuration, float64, error) {
 	mtrcs := scionMetrics.Load()
 
-	sps := make([]snet.Path, len(ntpcs))
-	n, err := crypto.Sample(ctx, len(sps), len(ps), func(dst, src int) {
-		sps[dst] = ps[src]
-	})
+	ps = usablePaths(ps)
+	sps, ntpcs, err := selectPaths(ctx, ntpcs, localAddr, remoteAddr, ps)
 	if err != nil {
-		return 0, err
+		return timemath.FineDuration{}, 0, err
 	}
-	if n == 0 {
-		return 0, errNoPaths
+	if len(sps) == 0 {
+		return timemath.FineDuration{}, 0, errNoPaths
 	}
-	sps = sps[:n]
 
-	off := make([]time.Duration, len(sps))
 	ms := make(chan measurement)
 	for i := 0; i != len(sps); i++ {
 		go func(ctx context.Context, log *zap.Logger, mtrcs *scionClientMetrics,
 			ntpc *SCIONClient, localAddr, remoteAddr udp.UDPAddr, p snet.Path) {
-			var err error
-			var off time.Duration
-			var nerr, n int
+			fp := snet.Fingerprint(p).String()
 			log.Debug("measuring clock offset",
 				zap.Stringer("to", remoteAddr.IA),
 				zap.Object("via", scion.PathMarshaler{Path: p}),
+				zap.String("path", fp),
 			)
-			if ntpc.InterleavedMode {
-				ntpc.ResetInterleavedMode()
-				n = 2
-			} else {
-				n = 1
-			}
-			for j := 0; j != n; j++ {
-				o, _, e := ntpc.measureClockOffsetSCION(ctx, log, mtrcs, localAddr, remoteAddr, p)
-				if e == nil {
-					off, err = o, e
+			exchange := func() (timemath.FineDuration, error) {
+				var err error
+				var off timemath.FineDuration
+				var nerr, n int
+				if ntpc.InterleavedMode {
+					n = 2
 				} else {
-					if nerr == j {
+					n = 1
+				}
+				for j := 0; j != n; j++ {
+					o, _, rtd, interleaved, e := ntpc.measureClockOffsetSCION(ctx, log, mtrcs, localAddr, remoteAddr, p)
+					if e == nil {
 						off, err = o, e
+						recordPathStats(remoteAddr.String(), p, o.Duration(), rtd)
+						if interleaved {
+							break
+						}
+					} else {
+						if nerr == j {
+							off, err = o, e
+						}
+						nerr++
+						log.Info("failed to measure clock offset",
+							zap.Stringer("to", remoteAddr.IA),
+							zap.Object("via", scion.PathMarshaler{Path: p}),
+							zap.String("path", fp),
+							zap.Error(e),
+						)
+						var scmpErr *SCMPError
+						if errors.As(e, &scmpErr) && scmpErr.PathDown() {
+							reportPathDown(p, scmpErr)
+							break
+						}
 					}
-					nerr++
-					log.Info("failed to measure clock offset",
-						zap.Stringer("to", remoteAddr.IA),
-						zap.Object("via", scion.PathMarshaler{Path: p}),
-						zap.Error(e),
-					)
 				}
+				return off, err
 			}
-			ms <- measurement{off, err}
+			var off timemath.FineDuration
+			var err error
+			if ntpc.Train.Enabled() {
+				off, err = measureTrain(ctx, ntpc.Train, func() (Sample, error) {
+					_, err := exchange()
+					if err != nil {
+						return Sample{}, err
+					}
+					return lastSample(ntpc)
+				})
+			} else {
+				off, err = exchange()
+			}
+			var weight float64
+			if err == nil {
+				if s, ok := ntpc.LastSample(); ok {
+					weight = s.Weight
+				}
+			}
+			ms <- measurement{off: off, weight: weight, err: err}
 		}(ctx, log, mtrcs, ntpcs[i], localAddr, remoteAddr, sps[i])
 	}
-	collectMeasurements(ctx, off, ms)
-	return timemath.Median(off), nil
+	res, err := collectMeasurements(ctx, len(sps), ms)
+	if len(res) == 0 {
+		return timemath.FineDuration{}, 0, err
+	}
+	m := medianMeasurement(res)
+	return m.off, m.weight, nil
 }
 
+// MeasureClockOffsets measures the offsets to refclks and returns the number
+// of successful measurements, which are stored at the beginning of off.
+// Reference clocks implementing FineReferenceClock are measured with
+// sub-nanosecond resolution.
 func (c *ReferenceClockClient) MeasureClockOffsets(ctx context.Context, log *zap.Logger,
-	refclks []ReferenceClock, off []time.Duration) {
+	refclks []ReferenceClock, off []timemath.FineDuration) int {
+	return c.MeasureWeightedClockOffsets(ctx, log, refclks, off, nil /* weights */)
+}
+
+// MeasureWeightedClockOffsets is like MeasureClockOffsets, but also stores the
+// weights of the successful measurements at the beginning of weights, see
+// SampleWeight.
+func (c *ReferenceClockClient) MeasureWeightedClockOffsets(ctx context.Context, log *zap.Logger,
+	refclks []ReferenceClock, off []timemath.FineDuration, weights []float64) int {
 	if len(off) != len(refclks) {
 		panic("number of result offsets must be equal to the number of reference clocks")
 	}
+	if weights != nil && len(weights) != len(refclks) {
+		panic("number of result weights must be equal to the number of reference clocks")
+	}
+	rs := make([]Measurement, len(refclks))
+	c.MeasureClockOffsetResults(ctx, log, refclks, rs)
+	j := 0
+	for _, r := range rs {
+		if r.Err == nil {
+			off[j] = r.Offset
+			if weights != nil {
+				weights[j] = r.Weight
+			}
+			j++
+		}
+	}
+	return j
+}
+
+// MeasureClockOffsetResults measures the offsets to refclks, stores the result
+// of refclks[i] in rs[i], and returns the number of successful measurements.
+// Measurements that are not complete when ctx is done fail with ErrTimeout.
+func (c *ReferenceClockClient) MeasureClockOffsetResults(ctx context.Context, log *zap.Logger,
+	refclks []ReferenceClock, rs []Measurement) int {
+	if len(rs) != len(refclks) {
+		panic("number of results must be equal to the number of reference clocks")
+	}
 	swapped := atomic.CompareAndSwapUint32(&c.numOpsInProgress, 0, 1)
 	if !swapped {
 		panic("too many reference clock offset measurements in progress")
@@ -173,12 +435,66 @@ func (c *ReferenceClockClient) MeasureClockOffsets(ctx context.Context, log *zap
 		}
 	}(&c.numOpsInProgress)
 
-	ms := make(chan measurement)
-	for _, refclk := range refclks {
-		go func(ctx context.Context, log *zap.Logger, refclk ReferenceClock) {
-			off, err := refclk.MeasureClockOffset(ctx, log)
-			ms <- measurement{off, err}
-		}(ctx, log, refclk)
+	type result struct {
+		i int
+		m Measurement
+	}
+	ch := make(chan result)
+	for i, refclk := range refclks {
+		go func(ctx context.Context, log *zap.Logger, i int, refclk ReferenceClock) {
+			var off timemath.FineDuration
+			var err error
+			if fine, ok := refclk.(FineReferenceClock); ok {
+				off, err = fine.MeasureClockOffsetFine(ctx, log)
+			} else {
+				var d time.Duration
+				d, err = refclk.MeasureClockOffset(ctx, log)
+				off = timemath.FineFromDuration(d)
+			}
+			ch <- result{i, Measurement{Offset: off, Weight: SampleWeight(refclk, err), Err: err}}
+		}(ctx, log, i, refclk)
+	}
+	done := make([]bool, len(rs))
+	n, pending := 0, len(refclks)
+loop:
+	for pending != 0 {
+		select {
+		case r := <-ch:
+			rs[r.i], done[r.i] = r.m, true
+			if r.m.Err == nil {
+				n++
+			}
+			pending--
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	go func(n int) { // drain channel
+		for n != 0 {
+			<-ch
+			n--
+		}
+	}(pending)
+	for i := range rs {
+		if !done[i] {
+			rs[i] = Measurement{Err: classify(ErrTimeout, ctx.Err())}
+		}
+	}
+	return n
+}
+
+// SampleWeight returns the filter weight of the last sample of refclk after a
+// successful measurement, or zero if refclk does not report weighted samples,
+// e.g., hardware reference clocks. Reference clocks measuring via multiple
+// paths report the weight of the median, see MeasureWeightedClockOffsetSCION.
+func SampleWeight(refclk ReferenceClock, err error) float64 {
+	if err != nil {
+		return 0
+	}
+	if r, ok := refclk.(SampleReporter); ok {
+		if s, ok := r.LastSample(); ok {
+			return s.Weight
+		}
 	}
-	collectMeasurements(ctx, off, ms)
+	return 0
 }
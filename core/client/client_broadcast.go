@@ -0,0 +1,223 @@
+package client
+
+// Broadcast client mode: clock offsets are measured from the packets of a
+// broadcast or multicast server on the LAN, see RFC 5905, Section 8. The
+// one-way delay from the server is calibrated with unicast exchanges, initially
+// and whenever the calibration has expired. Broadcast packets are only accepted
+// with a valid MAC computed with the symmetric key shared with the server.
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-reuseport"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/net/ntp"
+	"example.com/scion-time/net/udp"
+)
+
+const broadcastCalibrationInterval = 15 * time.Minute
+
+type broadcastPacket struct {
+	cRxTime time.Time
+	sTxTime time.Time
+	source  Source
+}
+
+type BroadcastClient struct {
+	localAddr   *net.UDPAddr
+	serverAddr  *net.UDPAddr
+	calibration *IPClient
+	keys        ntp.SymmetricKeys
+	calibrated  time.Time
+	delay       time.Duration
+	latest      atomic.Pointer[broadcastPacket]
+	source      sourceValue
+	sample      atomic.Pointer[Sample]
+}
+
+func listenBroadcast(localAddr, groupAddr *net.UDPAddr) (*net.UDPConn, error) {
+	if groupAddr.IP.IsMulticast() {
+		var ifi *net.Interface
+		if localAddr.Zone != "" {
+			var err error
+			ifi, err = net.InterfaceByName(localAddr.Zone)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return net.ListenMulticastUDP("udp", ifi, groupAddr)
+	}
+	// Broadcast packets are only delivered to sockets bound to the wildcard
+	// address, which may have to be shared with a local server.
+	conn, err := reuseport.ListenPacket("udp", (&net.UDPAddr{Port: groupAddr.Port}).String())
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UDPConn), nil
+}
+
+// StartBroadcastClient starts receiving the packets sent by the server at
+// serverAddr to groupAddr, a broadcast or multicast address, authenticated with
+// key. The calibration client is used for the unicast exchanges with the
+// server, also authenticated with key.
+func StartBroadcastClient(ctx context.Context, log *zap.Logger,
+	localAddr, groupAddr, serverAddr *net.UDPAddr, calibration *IPClient,
+	key ntp.SymmetricKey) (*BroadcastClient, error) {
+	conn, err := listenBroadcast(localAddr, groupAddr)
+	if err != nil {
+		return nil, err
+	}
+	err = udp.EnableTimestamping(conn, localAddr.Zone)
+	if err != nil {
+		log.Error("failed to enable timestamping", zap.Error(err))
+	}
+	calibration.Auth.SymmetricKey = &key
+	c := &BroadcastClient{
+		localAddr:   localAddr,
+		serverAddr:  serverAddr,
+		calibration: calibration,
+		keys:        ntp.SymmetricKeys{key.ID: key},
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go c.run(ctx, log, conn)
+	return c, nil
+}
+
+func (c *BroadcastClient) run(ctx context.Context, log *zap.Logger, conn *net.UDPConn) {
+	mtrcs := ipMetrics.Load()
+	serverIP := c.serverAddr.AddrPort().Addr()
+	var prevTxTime ntp.Time64
+	buf := make([]byte, udp.MaxPayloadLen)
+	oob := make([]byte, udp.TimestampLen())
+	for {
+		buf = buf[:cap(buf)]
+		oob = oob[:cap(oob)]
+		n, oobn, flags, srcAddr, err := conn.ReadMsgUDPAddrPort(buf, oob)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Info("failed to read packet", zap.Error(err))
+			continue
+		}
+		if flags != 0 {
+			log.Info("failed to read packet", zap.Int("flags", flags))
+			continue
+		}
+		cRxTime, err := udp.TimestampFromOOBData(oob[:oobn])
+		if err != nil {
+			cRxTime = timebase.RawNow()
+			log.Error("failed to read packet rx timestamp", zap.Error(err))
+		}
+		mtrcs.pktsReceived.Inc()
+
+		if compareAddrs(srcAddr.Addr(), serverIP) != 0 {
+			continue
+		}
+
+		_, err = ntp.VerifyMAC(buf[:n], c.keys)
+		if err != nil {
+			log.Info("failed to authenticate broadcast packet", zap.Error(err))
+			continue
+		}
+		var pkt ntp.Packet
+		err = ntp.DecodePacket(&pkt, buf[:n])
+		if err != nil {
+			log.Info("failed to decode packet payload", zap.Error(err))
+			continue
+		}
+		err = ntp.ValidateBroadcastMetadata(&pkt)
+		if err != nil {
+			log.Info("failed to validate packet payload", zap.Error(err))
+			continue
+		}
+		if !pkt.TransmitTime.After(prevTxTime) {
+			// Replayed or reordered packet
+			log.Info("received stale broadcast packet", zap.Stringer("from", srcAddr))
+			continue
+		}
+		prevTxTime = pkt.TransmitTime
+
+		mtrcs.broadcastsAccepted.Inc()
+		c.latest.Store(&broadcastPacket{
+			cRxTime: cRxTime,
+			sTxTime: ntp.TimeFromTime64(pkt.TransmitTime),
+			source:  Source{Stratum: pkt.Stratum, RefID: pkt.ReferenceID},
+		})
+	}
+}
+
+// MeasureClockOffset returns the clock offset based on the latest broadcast
+// packet received since the previous call, or based on a unicast exchange if
+// the delay calibration is due.
+func (c *BroadcastClient) MeasureClockOffset(ctx context.Context, log *zap.Logger) (
+	time.Duration, error) {
+	now := timebase.RawNow()
+	if c.calibrated.IsZero() || now.Sub(c.calibrated) > broadcastCalibrationInterval {
+		off, err := MeasureClockOffsetIP(ctx, log, c.calibration, c.localAddr, c.serverAddr)
+		if err == nil {
+			s, _ := c.calibration.LastSample()
+			c.delay = s.Delay / 2
+			c.calibrated = now
+			if src, ok := c.calibration.Source(); ok {
+				c.source.store(src)
+			}
+			c.sample.Store(&s)
+			log.Debug("calibrated broadcast delay",
+				zap.Stringer("server", c.serverAddr),
+				zap.Duration("delay", c.delay),
+			)
+			return off, nil
+		}
+		if c.calibrated.IsZero() {
+			return 0, err
+		}
+		log.Info("failed to calibrate broadcast delay",
+			zap.Stringer("server", c.serverAddr), zap.Error(err))
+	}
+
+	p := c.latest.Swap(nil)
+	if p == nil {
+		return 0, errNoBroadcast
+	}
+	off := p.sTxTime.Add(c.delay).Sub(p.cRxTime)
+	c.source.store(p.source)
+	c.sample.Store(&Sample{
+		Time:          p.cRxTime,
+		Offset:        off,
+		Delay:         2 * c.delay,
+		Authenticated: true,
+		Transport:     TransportIP,
+		Server:        c.serverAddr.IP.String(),
+	})
+	log.Debug("evaluated broadcast packet",
+		zap.Stringer("from", c.serverAddr),
+		zap.Duration("clock offset", off),
+	)
+	return off, nil
+}
+
+// Source returns the stratum and reference ID reported by the server in the
+// last accepted packet.
+func (c *BroadcastClient) Source() (Source, bool) {
+	return c.source.load()
+}
+
+// LastSample returns the last accepted offset measurement.
+func (c *BroadcastClient) LastSample() (Sample, bool) {
+	x := c.sample.Load()
+	if x == nil {
+		return Sample{}, false
+	}
+	return *x, true
+}
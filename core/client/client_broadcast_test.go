@@ -0,0 +1,94 @@
+package client_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/driver/clock"
+
+	"example.com/scion-time/net/ntp"
+)
+
+func broadcastPacket(t *testing.T, key *ntp.SymmetricKey) []byte {
+	t.Helper()
+	var pkt ntp.Packet
+	pkt.SetVersion(ntp.VersionMax)
+	pkt.SetMode(ntp.ModeBroadcast)
+	pkt.Stratum = 1
+	pkt.TransmitTime = ntp.Time64FromTime(timebase.Now())
+	var b []byte
+	ntp.EncodePacket(&b, &pkt)
+	if key != nil {
+		ntp.AppendMAC(&b, *key)
+	}
+	return b
+}
+
+func TestBroadcastAuthentication(t *testing.T) {
+	timebase.RegisterClockIfUnset(&clock.SystemClock{Log: zap.NewNop()})
+
+	key := ntp.SymmetricKey{ID: 1, Type: ntp.SymmetricKeyTypeSHA1, Value: []byte("broadcast")}
+	wrongKey := ntp.SymmetricKey{ID: 1, Type: ntp.SymmetricKeyTypeSHA1, Value: []byte("attacker")}
+	unknownKey := ntp.SymmetricKey{ID: 2, Type: ntp.SymmetricKeyTypeSHA1, Value: []byte("broadcast")}
+
+	tests := []struct {
+		name string
+		key  *ntp.SymmetricKey
+		ok   bool
+	}{
+		{"valid", &key, true},
+		{"unauthenticated", nil, false},
+		{"wrong key", &wrongKey, false},
+		{"unknown key", &unknownKey, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			srv, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer srv.Close()
+
+			c := client.NewCalibratedBroadcastClient(ctx, conn,
+				srv.LocalAddr().(*net.UDPAddr), key, 100*time.Microsecond)
+			_, err = srv.WriteToUDP(broadcastPacket(t, test.key), conn.LocalAddr().(*net.UDPAddr))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var accepted bool
+			deadline := time.Now().Add(500 * time.Millisecond)
+			for !accepted && time.Now().Before(deadline) {
+				_, err = c.MeasureClockOffset(ctx, zap.NewNop())
+				accepted = err == nil
+				if !accepted {
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+			if accepted != test.ok {
+				t.Fatalf("accepted = %v; want %v", accepted, test.ok)
+			}
+			if accepted {
+				s, _ := c.LastSample()
+				if !s.Authenticated {
+					t.Error("sample not marked as authenticated")
+				}
+			}
+		})
+	}
+}
@@ -4,15 +4,21 @@ import (
 	"context"
 	"net"
 	"net/netip"
+	"sync/atomic"
 	"time"
 
 	"github.com/HdrHistogram/hdrhistogram-go"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	"go.uber.org/zap"
 
+	"example.com/scion-time/base/events"
 	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/base/tracing"
 
 	"example.com/scion-time/core/config"
 	"example.com/scion-time/core/timebase"
@@ -20,35 +26,67 @@ import (
 	"example.com/scion-time/net/ntp"
 	"example.com/scion-time/net/nts"
 	"example.com/scion-time/net/ntske"
+	"example.com/scion-time/net/pcap"
 	"example.com/scion-time/net/udp"
 )
 
 type IPClient struct {
 	InterleavedMode bool
-	Auth            struct {
+	MinTTL          int
+	NTPv5           bool
+	// Device is the network interface or VRF to which client sockets are
+	// bound, if not empty. It does not apply to NTS-KE connections, see
+	// ntske.Fetcher. On Linux before 5.7, binding requires CAP_NET_RAW.
+	Device string
+	Auth   struct {
 		Enabled      bool
 		NTSKEFetcher ntske.Fetcher
+		SymmetricKey *ntp.SymmetricKey
+	}
+	Histo  *hdrhistogram.Histogram
+	Faults *FaultInjector
+	// Train configures experimental packet train measurements.
+	Train  Train
+	source sourceValue
+	sample atomic.Pointer[Sample]
+	prev   struct {
+		key         string
+		interleaved bool
+		cTxTime     ntp.Time64
+		cRxTime     ntp.Time64
+		sRxTime     ntp.Time64
+		upstream    upstream
 	}
-	Histo *hdrhistogram.Histogram
-	prev  struct {
-		reference string
-		cTxTime   ntp.Time64
-		cRxTime   ntp.Time64
-		sRxTime   ntp.Time64
+	v5  bool
+	kod struct {
+		denied  bool
+		until   time.Time
+		backoff time.Duration
 	}
 }
 
 type ipClientMetrics struct {
+	broadcastsAccepted       prometheus.Counter
+	kodsReceived             *prometheus.CounterVec
 	reqsSent                 prometheus.Counter
 	reqsSentInterleaved      prometheus.Counter
 	pktsReceived             prometheus.Counter
 	pktsAuthenticated        prometheus.Counter
+	pktsDiscarded            *prometheus.CounterVec
 	respsAccepted            prometheus.Counter
 	respsAcceptedInterleaved prometheus.Counter
 }
 
 func newIPClientMetrics() *ipClientMetrics {
 	return &ipClientMetrics{
+		broadcastsAccepted: promauto.NewCounter(prometheus.CounterOpts{
+			Name: metrics.IPClientBroadcastsAcceptedN,
+			Help: metrics.IPClientBroadcastsAcceptedH,
+		}),
+		kodsReceived: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: metrics.IPClientKoDsReceivedN,
+			Help: metrics.IPClientKoDsReceivedH,
+		}, []string{"code"}),
 		reqsSent: promauto.NewCounter(prometheus.CounterOpts{
 			Name: metrics.IPClientReqsSentN,
 			Help: metrics.IPClientReqsSentH,
@@ -65,6 +103,10 @@ func newIPClientMetrics() *ipClientMetrics {
 			Name: metrics.IPClientPktsAuthenticatedN,
 			Help: metrics.IPClientPktsAuthenticatedH,
 		}),
+		pktsDiscarded: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: metrics.IPClientPktsDiscardedN,
+			Help: metrics.IPClientPktsDiscardedH,
+		}, discardReasonLbls),
 		respsAccepted: promauto.NewCounter(prometheus.CounterOpts{
 			Name: metrics.IPClientRespsAcceptedN,
 			Help: metrics.IPClientRespsAcceptedH,
@@ -87,13 +129,74 @@ func compareAddrs(x, y netip.Addr) int {
 }
 
 func (c *IPClient) ResetInterleavedMode() {
-	c.prev.reference = ""
+	c.prev.key = ""
+}
+
+// Source returns the stratum and reference ID reported by the server in the
+// last accepted response.
+func (c *IPClient) Source() (Source, bool) {
+	return c.source.load()
+}
+
+// LastSample returns the last accepted offset measurement.
+func (c *IPClient) LastSample() (Sample, bool) {
+	x := c.sample.Load()
+	if x == nil {
+		return Sample{}, false
+	}
+	return *x, true
+}
+
+const (
+	kodMinBackoff = 64 * time.Second
+	kodMaxBackoff = 24 * time.Hour
+)
+
+// handleKoD processes a kiss-of-death packet with kiss code code: DENY and
+// RSTR stop the polling of the server, RATE suspends it for an exponentially
+// increasing time. Other codes are ignored, as recommended by RFC 5905.
+func (c *IPClient) handleKoD(log *zap.Logger, reference, code string, now time.Time) error {
+	switch code {
+	case ntp.KissCodeDENY, ntp.KissCodeRSTR:
+		c.kod.denied = true
+		log.Error("server denied access, stopped polling",
+			zap.String("from", reference), zap.String("code", code))
+		return errKoDDeny
+	case ntp.KissCodeRATE:
+		c.kod.backoff *= 2
+		if c.kod.backoff < kodMinBackoff {
+			c.kod.backoff = kodMinBackoff
+		}
+		if c.kod.backoff > kodMaxBackoff {
+			c.kod.backoff = kodMaxBackoff
+		}
+		c.kod.until = now.Add(c.kod.backoff)
+		log.Info("server requested rate reduction, suspended polling",
+			zap.String("from", reference), zap.Duration("duration", c.kod.backoff))
+		return errKoDRate
+	default:
+		return errUnexpectedPacket
+	}
 }
 
 func (c *IPClient) measureClockOffsetIP(ctx context.Context, log *zap.Logger, mtrcs *ipClientMetrics,
 	localAddr, remoteAddr *net.UDPAddr) (
-	offset time.Duration, weight float64, err error) {
-	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: localAddr.IP})
+	offset timemath.FineDuration, weight float64, err error) {
+	ctx, span := tracing.StartSpan(ctx, "measure_clock_offset", attribute.Stringer("remote", remoteAddr))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	if c.kod.denied {
+		return offset, weight, errKoDDeny
+	}
+	if timebase.RawNow().Before(c.kod.until) {
+		return offset, weight, errKoDRate
+	}
+
+	if c.useNTPv5() {
+		return c.measureClockOffsetIPv5(ctx, log, mtrcs, localAddr, remoteAddr)
+	}
+
+	conn, err := udp.ListenRandomPort(ctx, localAddr.IP, c.Device)
 	if err != nil {
 		return offset, weight, err
 	}
@@ -109,14 +212,28 @@ func (c *IPClient) measureClockOffsetIP(ctx context.Context, log *zap.Logger, mt
 	if err != nil {
 		log.Error("failed to enable timestamping", zap.Error(err))
 	}
-	err = udp.SetDSCP(conn, config.DSCP)
+	err = udp.SetDSCP(conn, config.DSCP())
 	if err != nil {
 		log.Info("failed to set DSCP", zap.Error(err))
 	}
+	if prio := config.SocketPriority(); prio != 0 {
+		err = udp.SetPriority(conn, prio)
+		if err != nil {
+			log.Info("failed to set socket priority", zap.Error(err))
+		}
+	}
+	if c.MinTTL != 0 {
+		err = udp.EnableRecvTTL(conn)
+		if err != nil {
+			return offset, weight, err
+		}
+	}
 
 	var ntskeData ntske.Data
 	if c.Auth.Enabled {
+		_, kspan := tracing.StartSpan(ctx, "fetch_nts_key")
 		ntskeData, err = c.Auth.NTSKEFetcher.FetchData()
+		tracing.EndSpan(kspan, err)
 		if err != nil {
 			log.Info("failed to fetch key exchange data", zap.Error(err))
 			return offset, weight, err
@@ -132,20 +249,28 @@ func (c *IPClient) measureClockOffsetIP(ctx context.Context, log *zap.Logger, mt
 	buf := make([]byte, ntp.PacketLen)
 
 	reference := remoteAddr.String()
-	cTxTime0 := timebase.Now()
+	cTxTime0 := timebase.RawNow()
 	interleaved := false
 
 	ntpreq := ntp.Packet{}
 	ntpreq.SetVersion(ntp.VersionMax)
 	ntpreq.SetMode(ntp.ModeClient)
-	if c.InterleavedMode && reference == c.prev.reference &&
-		cTxTime0.Sub(ntp.TimeFromTime64(c.prev.cTxTime)) <= time.Second {
+	// Interleaved mode state is kept per local address, server and path.
+	key := localAddr.IP.String() + " " + reference
+	if c.InterleavedMode && key == c.prev.key && interleavedStateValid(cTxTime0, c.prev.cTxTime) {
 		interleaved = true
 		ntpreq.OriginTime = c.prev.sRxTime
 		ntpreq.ReceiveTime = c.prev.cRxTime
 		ntpreq.TransmitTime = c.prev.cTxTime
 	} else {
-		ntpreq.TransmitTime = ntp.Time64FromTime(cTxTime0)
+		ntpreq.TransmitTime, err = transmitNonce(ctx, cTxTime0)
+		if err != nil {
+			return offset, weight, err
+		}
+	}
+
+	if c.NTPv5 {
+		ntpreq.ReferenceTime = ntp.NegotiationV5
 	}
 
 	ntp.EncodePacket(&buf, &ntpreq)
@@ -155,76 +280,110 @@ func (c *IPClient) measureClockOffsetIP(ctx context.Context, log *zap.Logger, mt
 	if c.Auth.Enabled {
 		ntsreq, requestID = nts.NewRequestPacket(ntskeData)
 		nts.EncodePacket(&buf, &ntsreq)
+	} else if c.Auth.SymmetricKey != nil {
+		ntp.AppendMAC(&buf, *c.Auth.SymmetricKey)
 	}
 
-	n, err := conn.WriteToUDPAddrPort(buf, remoteAddr.AddrPort())
+	_, sspan := tracing.StartSpan(ctx, "send")
+	n, err := c.Faults.writeTo(log, conn, buf, remoteAddr.AddrPort())
 	if err != nil {
+		tracing.EndSpan(sspan, err)
 		return offset, weight, err
 	}
 	if n != len(buf) {
+		tracing.EndSpan(sspan, errWrite)
 		return offset, weight, errWrite
 	}
 	cTxTime1, id, err := udp.ReadTXTimestamp(conn)
 	if err != nil || id != 0 {
-		cTxTime1 = timebase.Now()
+		cTxTime1 = timebase.RawNow()
 		log.Error("failed to read packet tx timestamp", zap.Error(err))
 	}
+	if pcap.Enabled() {
+		pcap.Write(cTxTime1, localAddrPort(conn), remoteAddr.AddrPort(), buf)
+	}
+	tracing.EndSpan(sspan, nil)
 	mtrcs.reqsSent.Inc()
 	if interleaved {
 		mtrcs.reqsSentInterleaved.Inc()
 	}
 
-	numRetries := 0
-	oob := make([]byte, udp.TimestampLen())
+	_, rspan := tracing.StartSpan(ctx, "receive")
+	defer func() { tracing.EndSpan(rspan, err) }()
+	reqInterleaved := interleaved
+	retries := newRetrier(deadline, deadlineIsSet, mtrcs.pktsDiscarded)
+	oob := make([]byte, udp.TimestampLen()+udp.TTLLen())
 	for {
 		buf = buf[:cap(buf)]
 		oob = oob[:cap(oob)]
+		err = retries.prepareRead(conn)
+		if err != nil {
+			return offset, weight, err
+		}
 		n, oobn, flags, srcAddr, err := conn.ReadMsgUDPAddrPort(buf, oob)
 		if err != nil {
-			if numRetries != maxNumRetries && deadlineIsSet && timebase.Now().Before(deadline) {
+			if retries.retry(discardReasonRead) {
 				log.Info("failed to read packet", zap.Error(err))
-				numRetries++
 				continue
 			}
-			return offset, weight, err
+			return offset, weight, retries.fail(err)
 		}
 		if flags != 0 {
 			err = errUnexpectedPacketFlags
-			if numRetries != maxNumRetries && deadlineIsSet && timebase.Now().Before(deadline) {
+			if retries.retry(discardReasonFlags) {
 				log.Info("failed to read packet", zap.Int("flags", flags))
-				numRetries++
 				continue
 			}
-			return offset, weight, err
+			return offset, weight, retries.fail(err)
 		}
 		oob = oob[:oobn]
 		cRxTime, err := udp.TimestampFromOOBData(oob)
 		if err != nil {
-			cRxTime = timebase.Now()
+			cRxTime = timebase.RawNow()
 			log.Error("failed to read packet rx timestamp", zap.Error(err))
 		}
 		buf = buf[:n]
+		if pcap.Enabled() {
+			pcap.Write(cRxTime, srcAddr, localAddrPort(conn), buf)
+		}
+		if c.Faults.received(log, buf, &cRxTime) {
+			continue
+		}
 		mtrcs.pktsReceived.Inc()
 
-		if compareAddrs(srcAddr.Addr(), remoteAddr.AddrPort().Addr()) != 0 {
+		if compareAddrs(srcAddr.Addr(), remoteAddr.AddrPort().Addr()) != 0 ||
+			srcAddr.Port() != remoteAddr.AddrPort().Port() {
 			err = errUnexpectedPacketSource
-			if numRetries != maxNumRetries && deadlineIsSet && timebase.Now().Before(deadline) {
+			if retries.retry(discardReasonSource) {
 				log.Info("received packet from unexpected source")
-				numRetries++
 				continue
 			}
-			return offset, weight, err
+			return offset, weight, retries.fail(err)
+		}
+
+		if c.MinTTL != 0 {
+			var ttl int
+			ttl, err = udp.TTLFromOOBData(oob)
+			if err == nil && ttl < c.MinTTL {
+				err = errUnexpectedPacketTTL
+			}
+			if err != nil {
+				if retries.retry(discardReasonTTL) {
+					log.Info("received packet with unexpected TTL", zap.Int("ttl", ttl), zap.Error(err))
+					continue
+				}
+				return offset, weight, retries.fail(err)
+			}
 		}
 
 		var ntpresp ntp.Packet
 		err = ntp.DecodePacket(&ntpresp, buf)
 		if err != nil {
-			if numRetries != maxNumRetries && deadlineIsSet && timebase.Now().Before(deadline) {
+			if retries.retry(decodeDiscardReason(err)) {
 				log.Info("failed to decode packet payload", zap.Error(err))
-				numRetries++
 				continue
 			}
-			return offset, weight, err
+			return offset, weight, retries.fail(err)
 		}
 
 		authenticated := false
@@ -232,44 +391,84 @@ func (c *IPClient) measureClockOffsetIP(ctx context.Context, log *zap.Logger, mt
 		if c.Auth.Enabled {
 			err = nts.DecodePacket(&ntsresp, buf)
 			if err != nil {
-				if numRetries != maxNumRetries && deadlineIsSet && timebase.Now().Before(deadline) {
+				if retries.retry(discardReasonDecode) {
 					log.Info("failed to decode NTS packet", zap.Error(err))
-					numRetries++
 					continue
 				}
-				return offset, weight, err
+				return offset, weight, retries.fail(err)
 			}
 
 			err = nts.ProcessResponse(buf, ntskeData.S2cKey, &c.Auth.NTSKEFetcher, &ntsresp, requestID)
 			if err != nil {
-				if numRetries != maxNumRetries && deadlineIsSet && timebase.Now().Before(deadline) {
+				events.Record(events.KindAuthFailure, reference, "failed to process NTS packet: %v", err)
+				if retries.retry(discardReasonAuth) {
 					log.Info("failed to process NTS packet", zap.Error(err))
-					numRetries++
 					continue
 				}
-				return offset, weight, err
+				return offset, weight, retries.fail(err)
 			}
 
+			authenticated = true
+			mtrcs.pktsAuthenticated.Inc()
+		} else if c.Auth.SymmetricKey != nil {
+			_, err = ntp.VerifyMAC(buf, ntp.SymmetricKeys{c.Auth.SymmetricKey.ID: *c.Auth.SymmetricKey})
+			if err != nil {
+				events.Record(events.KindAuthFailure, reference, "failed to verify MAC: %v", err)
+				if retries.retry(discardReasonAuth) {
+					log.Info("failed to verify MAC", zap.Error(err))
+					continue
+				}
+				return offset, weight, retries.fail(err)
+			}
 			authenticated = true
 			mtrcs.pktsAuthenticated.Inc()
 		}
 
 		interleaved = false
-		if c.InterleavedMode && ntpresp.OriginTime == c.prev.cRxTime {
+		if c.InterleavedMode && originMatches(ntpresp.OriginTime, c.prev.cRxTime) {
 			interleaved = true
-		} else if ntpresp.OriginTime != ntpreq.TransmitTime {
+		} else if !originMatches(ntpresp.OriginTime, ntpreq.TransmitTime) {
 			err = errUnexpectedPacket
-			if numRetries != maxNumRetries && deadlineIsSet && timebase.Now().Before(deadline) {
+			if retries.retry(discardReasonUnexpected) {
 				log.Info("received packet with unexpected type or structure")
-				numRetries++
 				continue
 			}
-			return offset, weight, err
+			return offset, weight, retries.fail(err)
 		}
+		if reqInterleaved && !interleaved {
+			// The server no longer has the state of the previous exchange,
+			// continue in basic mode.
+			log.Debug("received basic mode response to interleaved request",
+				zap.String("from", reference))
+		}
+
+		if ntp.IsKissOfDeath(&ntpresp) {
+			code := ntp.KissCode(&ntpresp)
+			mtrcs.kodsReceived.WithLabelValues(code).Inc()
+			return offset, weight, c.handleKoD(log, reference, code, cRxTime)
+		}
+		c.kod.backoff = 0
 
 		err = ntp.ValidateResponseMetadata(&ntpresp)
 		if err != nil {
-			return offset, weight, err
+			return offset, weight, classify(ErrBadPacket, err)
+		}
+
+		// Interleaved state is only meaningful for the same upstream server.
+		// A different stratum or reference ID indicates that another server
+		// answered behind the same address, e.g., in case of anycast.
+		if c.InterleavedMode && c.prev.key == key &&
+			upstreamOf(&ntpresp) != c.prev.upstream {
+			log.Info("upstream server changed",
+				zap.String("reference", reference),
+				zap.Uint8("stratum", ntpresp.Stratum),
+				zap.Uint32("refid", ntpresp.ReferenceID),
+			)
+			c.ResetInterleavedMode()
+			if interleaved {
+				err = errUpstreamChanged
+				return offset, weight, err
+			}
 		}
 
 		log.Debug("received response",
@@ -279,34 +478,33 @@ func (c *IPClient) measureClockOffsetIP(ctx context.Context, log *zap.Logger, mt
 			zap.Object("data", ntp.PacketMarshaler{Pkt: &ntpresp}),
 		)
 
-		sRxTime := ntp.TimeFromTime64(ntpresp.ReceiveTime)
-		sTxTime := ntp.TimeFromTime64(ntpresp.TransmitTime)
-
-		var t0, t1, t2, t3 time.Time
+		var x exchangeTimes
 		if interleaved {
-			t0 = ntp.TimeFromTime64(c.prev.cTxTime)
-			t1 = ntp.TimeFromTime64(c.prev.sRxTime)
-			t2 = sTxTime
-			t3 = ntp.TimeFromTime64(c.prev.cRxTime)
+			x = interleavedExchangeTimes(&ntpresp, c.prev.cTxTime, c.prev.sRxTime, c.prev.cRxTime)
 		} else {
-			t0 = cTxTime1
-			t1 = sRxTime
-			t2 = sTxTime
-			t3 = cRxTime
+			x = basicExchangeTimes(&ntpresp, cTxTime1, cRxTime)
 		}
 
-		err = ntp.ValidateResponseTimestamps(t0, t1, t1, t3)
+		var off, rtd time.Duration
+		off, rtd, err = x.evaluate(false)
 		if err != nil {
 			return offset, weight, err
 		}
 
-		off := ntp.ClockOffset(t0, t1, t2, t3)
-		rtd := ntp.RoundTripDelay(t0, t1, t2, t3)
-
 		mtrcs.respsAccepted.Inc()
 		if interleaved {
 			mtrcs.respsAcceptedInterleaved.Inc()
 		}
+		sample := &Sample{
+			Time:          cRxTime,
+			Offset:        off,
+			Delay:         rtd,
+			Authenticated: authenticated,
+			Transport:     TransportIP,
+			Server:        remoteAddr.IP.String(),
+		}
+		observeSample(reference, off, rtd)
+		c.source.store(Source{Stratum: ntpresp.Stratum, RefID: RefIDFromIP(remoteAddr.IP)})
 		log.Debug("evaluated response",
 			zap.String("from", reference),
 			zap.Bool("interleaved", interleaved),
@@ -314,16 +512,27 @@ func (c *IPClient) measureClockOffsetIP(ctx context.Context, log *zap.Logger, mt
 			zap.Duration("round trip delay", rtd),
 		)
 
+		if c.NTPv5 && ntpresp.ReferenceTime == ntp.NegotiationV5 {
+			c.v5 = true
+			log.Debug("negotiated NTPv5", zap.String("with", reference))
+		}
+
 		if c.InterleavedMode {
-			c.prev.reference = reference
+			c.prev.key = key
+			c.prev.interleaved = interleaved
 			c.prev.cTxTime = ntp.Time64FromTime(cTxTime1)
 			c.prev.cRxTime = ntp.Time64FromTime(cRxTime)
 			c.prev.sRxTime = ntpresp.ReceiveTime
+			c.prev.upstream = upstreamOf(&ntpresp)
 		}
 
 		// offset, weight = off, 1000.0
 
-		offset, weight = filter(log, reference, t0, t1, t2, t3)
+		_, fspan := tracing.StartSpan(ctx, "filter")
+		offset, weight = filter(log, reference, x.t0, x.t1, x.t2, x.t3)
+		fspan.End()
+		sample.Weight = weight
+		c.sample.Store(sample)
 
 		if c.Histo != nil {
 			c.Histo.RecordValue(rtd.Microseconds())
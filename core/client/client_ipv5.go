@@ -0,0 +1,223 @@
+package client
+
+// Experimental NTPv5 client mode: NTPv5 is offered in NTPv4 requests and used
+// in basic mode once the server has confirmed the offer. Authenticated clients
+// keep using NTPv4.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/base/tracing"
+
+	"example.com/scion-time/core/config"
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/net/ntp"
+	"example.com/scion-time/net/pcap"
+	"example.com/scion-time/net/udp"
+)
+
+func (c *IPClient) useNTPv5() bool {
+	return c.NTPv5 && c.v5 && !c.Auth.Enabled && c.Auth.SymmetricKey == nil
+}
+
+func (c *IPClient) measureClockOffsetIPv5(ctx context.Context, log *zap.Logger, mtrcs *ipClientMetrics,
+	localAddr, remoteAddr *net.UDPAddr) (
+	offset timemath.FineDuration, weight float64, err error) {
+	defer func() {
+		if err != nil {
+			// Fall back to NTPv4 and negotiate again
+			c.v5 = false
+		}
+	}()
+
+	conn, err := udp.ListenRandomPort(ctx, localAddr.IP, c.Device)
+	if err != nil {
+		return offset, weight, err
+	}
+	defer conn.Close()
+	deadline, deadlineIsSet := ctx.Deadline()
+	if deadlineIsSet {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			return offset, weight, err
+		}
+	}
+	err = udp.EnableTimestamping(conn, localAddr.Zone)
+	if err != nil {
+		log.Error("failed to enable timestamping", zap.Error(err))
+	}
+	err = udp.SetDSCP(conn, config.DSCP())
+	if err != nil {
+		log.Info("failed to set DSCP", zap.Error(err))
+	}
+	if prio := config.SocketPriority(); prio != 0 {
+		err = udp.SetPriority(conn, prio)
+		if err != nil {
+			log.Info("failed to set socket priority", zap.Error(err))
+		}
+	}
+
+	ip4 := remoteAddr.IP.To4()
+	if ip4 != nil {
+		remoteAddr.IP = ip4
+	}
+	reference := remoteAddr.String()
+
+	var cookie [8]byte
+	_, err = rand.Read(cookie[:])
+	if err != nil {
+		return offset, weight, err
+	}
+
+	ntpreq := ntp.PacketV5{}
+	ntpreq.SetVersion(ntp.Version5)
+	ntpreq.SetMode(ntp.ModeClient)
+	ntpreq.Timescale = ntp.TimescaleUTC
+	ntpreq.ClientCookie = binary.BigEndian.Uint64(cookie[:])
+
+	buf := make([]byte, ntp.PacketLen)
+	ntp.EncodePacketV5(&buf, &ntpreq)
+
+	_, sspan := tracing.StartSpan(ctx, "send")
+	n, err := c.Faults.writeTo(log, conn, buf, remoteAddr.AddrPort())
+	if err != nil {
+		tracing.EndSpan(sspan, err)
+		return offset, weight, err
+	}
+	if n != len(buf) {
+		tracing.EndSpan(sspan, errWrite)
+		return offset, weight, errWrite
+	}
+	cTxTime, id, err := udp.ReadTXTimestamp(conn)
+	if err != nil || id != 0 {
+		cTxTime = timebase.RawNow()
+		log.Error("failed to read packet tx timestamp", zap.Error(err))
+	}
+	if pcap.Enabled() {
+		pcap.Write(cTxTime, localAddrPort(conn), remoteAddr.AddrPort(), buf)
+	}
+	tracing.EndSpan(sspan, nil)
+	mtrcs.reqsSent.Inc()
+
+	_, rspan := tracing.StartSpan(ctx, "receive")
+	defer func() { tracing.EndSpan(rspan, err) }()
+	retries := newRetrier(deadline, deadlineIsSet, mtrcs.pktsDiscarded)
+	oob := make([]byte, udp.TimestampLen())
+	for {
+		buf = buf[:cap(buf)]
+		oob = oob[:cap(oob)]
+		err = retries.prepareRead(conn)
+		if err != nil {
+			return offset, weight, err
+		}
+		n, oobn, flags, srcAddr, err := conn.ReadMsgUDPAddrPort(buf, oob)
+		if err != nil {
+			if retries.retry(discardReasonRead) {
+				log.Info("failed to read packet", zap.Error(err))
+				continue
+			}
+			return offset, weight, retries.fail(err)
+		}
+		if flags != 0 {
+			err = errUnexpectedPacketFlags
+			if retries.retry(discardReasonFlags) {
+				log.Info("failed to read packet", zap.Int("flags", flags))
+				continue
+			}
+			return offset, weight, retries.fail(err)
+		}
+		cRxTime, err := udp.TimestampFromOOBData(oob[:oobn])
+		if err != nil {
+			cRxTime = timebase.RawNow()
+			log.Error("failed to read packet rx timestamp", zap.Error(err))
+		}
+		buf = buf[:n]
+		if pcap.Enabled() {
+			pcap.Write(cRxTime, srcAddr, localAddrPort(conn), buf)
+		}
+		if c.Faults.received(log, buf, &cRxTime) {
+			continue
+		}
+		mtrcs.pktsReceived.Inc()
+
+		if compareAddrs(srcAddr.Addr(), remoteAddr.AddrPort().Addr()) != 0 ||
+			srcAddr.Port() != remoteAddr.AddrPort().Port() {
+			err = errUnexpectedPacketSource
+			if retries.retry(discardReasonSource) {
+				log.Info("received packet from unexpected source")
+				continue
+			}
+			return offset, weight, retries.fail(err)
+		}
+
+		var ntpresp ntp.PacketV5
+		err = ntp.DecodePacketV5(&ntpresp, buf)
+		if err == nil && ntpresp.ClientCookie != ntpreq.ClientCookie {
+			err = errUnexpectedPacket
+		}
+		if err != nil {
+			if retries.retry(decodeDiscardReason(err)) {
+				log.Info("failed to decode packet payload", zap.Error(err))
+				continue
+			}
+			return offset, weight, retries.fail(err)
+		}
+
+		err = ntp.ValidateResponseMetadataV5(&ntpresp)
+		if err != nil {
+			return offset, weight, classify(ErrBadPacket, err)
+		}
+
+		x := exchangeTimes{
+			t0: timemath.FineTimeOf(cTxTime, 0),
+			t1: ntp.FineTimeFromTime64Era(ntpresp.ReceiveTime, ntpresp.Era),
+			t2: ntp.FineTimeFromTime64Era(ntpresp.TransmitTime, ntpresp.Era),
+			t3: timemath.FineTimeOf(cRxTime, 0),
+		}
+
+		// Unlike in NTPv4 exchanges, the server transmit timestamp is validated too
+		var off, rtd time.Duration
+		off, rtd, err = x.evaluate(true)
+		if err != nil {
+			return offset, weight, err
+		}
+
+		mtrcs.respsAccepted.Inc()
+		sample := &Sample{
+			Time:      cRxTime,
+			Offset:    off,
+			Delay:     rtd,
+			Transport: TransportIP,
+			Server:    remoteAddr.IP.String(),
+		}
+		observeSample(reference, off, rtd)
+		c.source.store(Source{Stratum: ntpresp.Stratum, RefID: RefIDFromIP(remoteAddr.IP)})
+		log.Debug("evaluated NTPv5 response",
+			zap.String("from", reference),
+			zap.Duration("clock offset", off),
+			zap.Duration("round trip delay", rtd),
+		)
+
+		_, fspan := tracing.StartSpan(ctx, "filter")
+		offset, weight = filter(log, reference, x.t0, x.t1, x.t2, x.t3)
+		fspan.End()
+		sample.Weight = weight
+		c.sample.Store(sample)
+
+		if c.Histo != nil {
+			c.Histo.RecordValue(rtd.Microseconds())
+		}
+
+		break
+	}
+
+	return offset, weight, nil
+}
@@ -3,8 +3,11 @@ package client
 import (
 	"context"
 	"crypto/subtle"
+	"errors"
 	"net"
 	"net/netip"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/HdrHistogram/hdrhistogram-go"
@@ -15,11 +18,15 @@ import (
 	"github.com/scionproto/scion/pkg/drkey"
 	"github.com/scionproto/scion/pkg/slayers"
 	"github.com/scionproto/scion/pkg/snet"
-	"github.com/scionproto/scion/pkg/spao"
+
+	"go.opentelemetry.io/otel/attribute"
 
 	"go.uber.org/zap"
 
+	"example.com/scion-time/base/events"
 	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/base/tracing"
 
 	"example.com/scion-time/core/config"
 	"example.com/scion-time/core/timebase"
@@ -27,28 +34,45 @@ import (
 	"example.com/scion-time/net/ntp"
 	"example.com/scion-time/net/nts"
 	"example.com/scion-time/net/ntske"
+	"example.com/scion-time/net/pcap"
 	"example.com/scion-time/net/scion"
+	"example.com/scion-time/net/scion/spao"
 	"example.com/scion-time/net/udp"
 )
 
+// SCIONClient measures clock offsets via NTP over SCION. After configuration,
+// a SCIONClient may be used by multiple goroutines concurrently: all state of
+// a measurement is local to the call, except for the interleaved mode state,
+// which is kept per local address, server, and path.
 type SCIONClient struct {
 	InterleavedMode bool
+	Symmetric       bool
 	Auth            struct {
 		Enabled      bool
 		NTSEnabled   bool
 		DRKeyFetcher *scion.Fetcher
-		opt          *slayers.EndToEndOption
-		buf          []byte
-		mac          []byte
 		NTSKEFetcher ntske.Fetcher
 	}
-	Histo *hdrhistogram.Histogram
-	prev  struct {
-		reference string
-		cTxTime   ntp.Time64
-		cRxTime   ntp.Time64
-		sRxTime   ntp.Time64
-	}
+	Histo  *hdrhistogram.Histogram
+	Faults *FaultInjector
+	// Train configures experimental packet train measurements.
+	Train Train
+	// Listen opens the connection of a measurement. If nil, a UDP socket in
+	// the SCION end host port range is used.
+	Listen ListenFunc
+	source sourceValue
+	sample atomic.Pointer[Sample]
+	synt   atomic.Pointer[ntp.Syntonization]
+	mu     sync.Mutex
+	prev   map[string]scionInterleavedState
+}
+
+type scionInterleavedState struct {
+	cTxTime  ntp.Time64
+	cRxTime  ntp.Time64
+	sRxTime  ntp.Time64
+	flowID   uint32
+	upstream upstream
 }
 
 type scionClientMetrics struct {
@@ -56,10 +80,24 @@ type scionClientMetrics struct {
 	reqsSentInterleaved      prometheus.Counter
 	pktsReceived             prometheus.Counter
 	pktsAuthenticated        prometheus.Counter
+	pktsDiscarded            *prometheus.CounterVec
 	respsAccepted            prometheus.Counter
 	respsAcceptedInterleaved prometheus.Counter
+	respsRejected            *prometheus.CounterVec
+	scmpErrors               *prometheus.CounterVec
 }
 
+// Reasons for rejecting responses that were received and decoded
+// successfully.
+const (
+	rejectReasonMetadata   = "metadata"
+	rejectReasonOffsetGate = "offset_gate"
+	rejectReasonTimestamps = "timestamps"
+	rejectReasonUpstream   = "upstream"
+)
+
+var rejectReasonLbls = []string{"path", "reason"}
+
 func newSCIONClientMetrics() *scionClientMetrics {
 	return &scionClientMetrics{
 		reqsSent: promauto.NewCounter(prometheus.CounterOpts{
@@ -78,6 +116,10 @@ func newSCIONClientMetrics() *scionClientMetrics {
 			Name: metrics.SCIONClientPktsAuthenticatedN,
 			Help: metrics.SCIONClientPktsAuthenticatedH,
 		}),
+		pktsDiscarded: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: metrics.SCIONClientPktsDiscardedN,
+			Help: metrics.SCIONClientPktsDiscardedH,
+		}, discardReasonLbls),
 		respsAccepted: promauto.NewCounter(prometheus.CounterOpts{
 			Name: metrics.SCIONClientRespsAcceptedN,
 			Help: metrics.SCIONClientRespsAcceptedH,
@@ -86,14 +128,43 @@ func newSCIONClientMetrics() *scionClientMetrics {
 			Name: metrics.SCIONClientRespsAcceptedInterleavedN,
 			Help: metrics.SCIONClientRespsAcceptedInterleavedH,
 		}),
+		respsRejected: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: metrics.SCIONClientRespsRejectedN,
+			Help: metrics.SCIONClientRespsRejectedH,
+		}, rejectReasonLbls),
+		scmpErrors: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: metrics.SCIONClientSCMPErrorsN,
+			Help: metrics.SCIONClientSCMPErrorsH,
+		}, scmpErrorLbls),
 	}
 }
 
-func compareIPs(x, y []byte) int {
+// equalIPs reports whether x and y are the same IP address. Byte slices that
+// are not valid IP addresses, e.g., from malformed packets, are never equal.
+// scionNextHop returns the underlay address to which packets to remoteAddr
+// via path are sent: the next hop of path or, within the local AS, the
+// underlay address of remoteAddr itself.
+func scionNextHop(localAddr, remoteAddr udp.UDPAddr, path snet.Path) netip.AddrPort {
+	nextHop := path.UnderlayNextHop().AddrPort()
+	nextHopAddr := nextHop.Addr()
+	if nextHopAddr.Is4In6() {
+		nextHop = netip.AddrPortFrom(
+			netip.AddrFrom4(nextHopAddr.As4()),
+			nextHop.Port())
+	}
+	if nextHop == (netip.AddrPort{}) && remoteAddr.IA.Equal(localAddr.IA) {
+		nextHop = netip.AddrPortFrom(
+			netip.AddrFrom4(remoteAddr.Host.AddrPort().Addr().As4()),
+			uint16(scion.UnderlayPort(remoteAddr.Host.Port)))
+	}
+	return nextHop
+}
+
+func equalIPs(x, y []byte) bool {
 	addrX, okX := netip.AddrFromSlice(x)
 	addrY, okY := netip.AddrFromSlice(y)
 	if !okX || !okY {
-		panic("unexpected IP address byte slice")
+		return false
 	}
 	if addrX.Is4In6() {
 		addrX = netip.AddrFrom4(addrX.As4())
@@ -101,53 +172,176 @@ func compareIPs(x, y []byte) int {
 	if addrY.Is4In6() {
 		addrY = netip.AddrFrom4(addrY.As4())
 	}
-	return addrX.Compare(addrY)
+	return addrX == addrY
 }
 
+// maxSCIONInterleavedStates bounds the number of exchanges for which a client
+// keeps interleaved mode state; stale states are pruned beyond this limit.
+const maxSCIONInterleavedStates = 64
+
 func (c *SCIONClient) ResetInterleavedMode() {
-	c.prev.reference = ""
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prev = nil
+}
+
+// scionInterleavedKey identifies the interleaved mode state of exchanges from
+// localAddr to remoteAddr via path.
+func scionInterleavedKey(localAddr, remoteAddr udp.UDPAddr, path snet.Path) string {
+	return localAddr.String() + " " + remoteAddr.IA.String() + "," + remoteAddr.Host.String() +
+		" " + snet.Fingerprint(path).String()
+}
+
+func (c *SCIONClient) interleavedState(key string) (scionInterleavedState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.prev[key]
+	return s, ok
+}
+
+func (c *SCIONClient) storeInterleavedState(key string, s scionInterleavedState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.prev == nil {
+		c.prev = make(map[string]scionInterleavedState)
+	}
+	if _, ok := c.prev[key]; !ok && len(c.prev) >= maxSCIONInterleavedStates {
+		t := ntp.TimeFromTime64(s.cTxTime)
+		for k, x := range c.prev {
+			if !interleavedStateValid(t, x.cTxTime) {
+				delete(c.prev, k)
+			}
+		}
+		if len(c.prev) >= maxSCIONInterleavedStates {
+			return
+		}
+	}
+	c.prev[key] = s
+}
+
+func (c *SCIONClient) resetInterleavedState(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.prev, key)
+}
+
+// Source returns the stratum and reference ID reported by the server in the
+// last accepted response.
+func (c *SCIONClient) Source() (Source, bool) {
+	return c.source.load()
+}
+
+// LastSample returns the last accepted offset measurement.
+func (c *SCIONClient) LastSample() (Sample, bool) {
+	x := c.sample.Load()
+	if x == nil {
+		return Sample{}, false
+	}
+	return *x, true
+}
+
+// Syntonization returns the syntonization message of the peer in the last
+// accepted response in symmetric mode.
+func (c *SCIONClient) Syntonization() (ntp.Syntonization, bool) {
+	x := c.synt.Load()
+	if x == nil {
+		return ntp.Syntonization{}, false
+	}
+	return *x, true
+}
+
+// storeSyntonization stores the syntonization message in the response b. Only
+// messages authenticated via SPAO are accepted since an unauthenticated
+// frequency would let an attacker pull the oscillator estimate. Servers do not
+// send syntonization messages in NTS responses.
+func (c *SCIONClient) storeSyntonization(b []byte, authenticated bool) {
+	if authenticated {
+		efs, _, err := ntp.DecodeExtensionFields(b)
+		if err == nil {
+			s, ok := ntp.DecodeSyntonization(efs)
+			if ok {
+				c.synt.Store(&s)
+				return
+			}
+		}
+	}
+	c.synt.Store(nil)
 }
 
 func (c *SCIONClient) measureClockOffsetSCION(ctx context.Context, log *zap.Logger, mtrcs *scionClientMetrics,
 	localAddr, remoteAddr udp.UDPAddr, path snet.Path) (
-	offset time.Duration, weight float64, err error) {
-	if c.Auth.Enabled && c.Auth.opt == nil {
-		c.Auth.opt = &slayers.EndToEndOption{}
-		c.Auth.opt.OptData = make([]byte, scion.PacketAuthOptDataLen)
-		c.Auth.buf = make([]byte, spao.MACBufferSize)
-		c.Auth.mac = make([]byte, scion.PacketAuthMACLen)
+	offset timemath.FineDuration, weight float64, delay time.Duration, interleaved bool, err error) {
+	fp := snet.Fingerprint(path).String()
+	ctx, span := tracing.StartSpan(ctx, "measure_clock_offset", attribute.Stringer("remote", remoteAddr), attribute.String("path", fp))
+	defer func() { tracing.EndSpan(span, err) }()
+	log = log.With(zap.String("path", fp))
+	reject := func(reason string, err error, fields ...zap.Field) {
+		mtrcs.respsRejected.WithLabelValues(fp, reason).Inc()
+		log.Info("rejected response", append([]zap.Field{
+			zap.String("from", remoteAddr.String()),
+			zap.String("reason", reason),
+			zap.Error(err),
+		}, fields...)...)
+	}
+
+	var authOpt *slayers.EndToEndOption
+	var authBuf, authMAC []byte
+	if c.Auth.Enabled {
+		authOpt = &slayers.EndToEndOption{}
+		authOpt.OptData = make([]byte, scion.PacketAuthOptDataLen)
+		authBuf = make([]byte, spao.MACBufferSize)
+		authMAC = make([]byte, scion.PacketAuthMACLen)
 	}
 	var authKey []byte
 
-	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: localAddr.Host.IP})
+	listen := c.Listen
+	if listen == nil {
+		listen = listenEndhostUDP
+	}
+	conn, err := listen(localAddr.Host.IP, "")
 	if err != nil {
-		return offset, weight, err
+		return offset, weight, delay, interleaved, err
 	}
 	defer conn.Close()
 	deadline, deadlineIsSet := ctx.Deadline()
 	if deadlineIsSet {
 		err = conn.SetDeadline(deadline)
 		if err != nil {
-			return offset, weight, err
+			return offset, weight, delay, interleaved, err
 		}
 	}
-	err = udp.EnableTimestamping(conn, localAddr.Host.Zone)
-	if err != nil {
-		log.Error("failed to enable timestamping", zap.Error(err))
-	}
-	err = udp.SetDSCP(conn, config.DSCP)
-	if err != nil {
-		log.Info("failed to set DSCP", zap.Error(err))
+	if udpConn, ok := conn.(*net.UDPConn); ok {
+		err = udp.EnableTimestamping(udpConn, localAddr.Host.Zone)
+		if err != nil {
+			log.Error("failed to enable timestamping", zap.Error(err))
+		}
+		err = udp.SetDSCP(udpConn, config.DSCP())
+		if err != nil {
+			log.Info("failed to set DSCP", zap.Error(err))
+		}
+		if prio := config.SocketPriority(); prio != 0 {
+			err = udp.SetPriority(udpConn, prio)
+			if err != nil {
+				log.Info("failed to set socket priority", zap.Error(err))
+			}
+		}
 	}
 
 	localPort := conn.LocalAddr().(*net.UDPAddr).Port
 
+	// The remote host address is updated below and may be shared with
+	// concurrent measurements.
+	remoteHost := *remoteAddr.Host
+	remoteAddr.Host = &remoteHost
+
 	var ntskeData ntske.Data
 	if c.Auth.NTSEnabled {
+		_, kspan := tracing.StartSpan(ctx, "fetch_nts_key")
 		ntskeData, err = c.Auth.NTSKEFetcher.FetchData()
+		tracing.EndSpan(kspan, err)
 		if err != nil {
 			log.Info("failed to fetch key exchange data", zap.Error(err))
-			return offset, weight, err
+			return offset, weight, delay, interleaved, err
 		}
 		remoteAddr.Host.IP = net.ParseIP(ntskeData.Server)
 		remoteAddr.Host.Port = int(ntskeData.Port)
@@ -157,39 +351,52 @@ func (c *SCIONClient) measureClockOffsetSCION(ctx context.Context, log *zap.Logg
 		remoteAddr.Host.IP = ip4
 	}
 
-	nextHop := path.UnderlayNextHop().AddrPort()
-	nextHopAddr := nextHop.Addr()
-	if nextHopAddr.Is4In6() {
-		nextHop = netip.AddrPortFrom(
-			netip.AddrFrom4(nextHopAddr.As4()),
-			nextHop.Port())
-	}
-	if nextHop == (netip.AddrPort{}) && remoteAddr.IA.Equal(localAddr.IA) {
-		nextHop = netip.AddrPortFrom(
-			netip.AddrFrom4(remoteAddr.Host.AddrPort().Addr().As4()),
-			scion.EndhostPort)
-	}
+	nextHop := scionNextHop(localAddr, remoteAddr, path)
 
 	srcAddr := &net.IPAddr{IP: localAddr.Host.IP}
 	dstAddr := &net.IPAddr{IP: remoteAddr.Host.IP}
 
-	buf := make([]byte, scion.MTU)
+	// Packets exceeding the path MTU are neither sent nor accepted; larger
+	// responses are truncated on receipt and rejected because of MSG_TRUNC.
+	mtu := scion.PathMTU(path)
+	buf := make([]byte, mtu)
 
 	reference := remoteAddr.IA.String() + "," + remoteAddr.Host.String()
-	cTxTime0 := timebase.Now()
-	interleaved := false
+	cTxTime0 := timebase.RawNow()
 
 	ntpreq := ntp.Packet{}
 	ntpreq.SetVersion(ntp.VersionMax)
-	ntpreq.SetMode(ntp.ModeClient)
-	if c.InterleavedMode && reference == c.prev.reference &&
-		cTxTime0.Sub(ntp.TimeFromTime64(c.prev.cTxTime)) <= time.Second {
+	if c.Symmetric {
+		ntpreq.SetMode(ntp.ModeSymmetricActive)
+	} else {
+		ntpreq.SetMode(ntp.ModeClient)
+	}
+	// Interleaved mode state is kept per local address, server and path.
+	key := scionInterleavedKey(localAddr, remoteAddr, path)
+	var prev scionInterleavedState
+	var prevOK bool
+	if c.InterleavedMode {
+		prev, prevOK = c.interleavedState(key)
+	}
+	if prevOK && interleavedStateValid(cTxTime0, prev.cTxTime) {
 		interleaved = true
-		ntpreq.OriginTime = c.prev.sRxTime
-		ntpreq.ReceiveTime = c.prev.cRxTime
-		ntpreq.TransmitTime = c.prev.cTxTime
+		ntpreq.OriginTime = prev.sRxTime
+		ntpreq.ReceiveTime = prev.cRxTime
+		ntpreq.TransmitTime = prev.cTxTime
 	} else {
-		ntpreq.TransmitTime = ntp.Time64FromTime(cTxTime0)
+		ntpreq.TransmitTime, err = transmitNonce(ctx, cTxTime0)
+		if err != nil {
+			return offset, weight, delay, interleaved, err
+		}
+	}
+	// Interleaved exchanges keep the flow ID of the previous exchange if
+	// pinned, other exchanges may use a new flow ID.
+	flowID := prev.flowID
+	if !interleaved || !pathDiversity().PinInterleaved {
+		flowID, err = nextFlowID(ctx)
+		if err != nil {
+			return offset, weight, delay, interleaved, err
+		}
 	}
 	ntp.EncodePacket(&buf, &ntpreq)
 
@@ -201,20 +408,21 @@ func (c *SCIONClient) measureClockOffsetSCION(ctx context.Context, log *zap.Logg
 	}
 
 	var scionLayer slayers.SCION
-	scionLayer.TrafficClass = config.DSCP << 2
+	scionLayer.TrafficClass = config.DSCP() << 2
+	scionLayer.FlowID = flowID
 	scionLayer.SrcIA = localAddr.IA
 	err = scionLayer.SetSrcAddr(srcAddr)
 	if err != nil {
-		panic(err)
+		return offset, weight, delay, interleaved, &PacketError{Op: "set source address", Err: err}
 	}
 	scionLayer.DstIA = remoteAddr.IA
 	err = scionLayer.SetDstAddr(dstAddr)
 	if err != nil {
-		panic(err)
+		return offset, weight, delay, interleaved, &PacketError{Op: "set destination address", Err: err}
 	}
 	err = path.Dataplane().SetPath(&scionLayer)
 	if err != nil {
-		panic(err)
+		return offset, weight, delay, interleaved, &PacketError{Op: "set path", Err: err}
 	}
 	scionLayer.NextHdr = slayers.L4UDP
 
@@ -233,18 +441,28 @@ func (c *SCIONClient) measureClockOffsetSCION(ctx context.Context, log *zap.Logg
 
 	err = payload.SerializeTo(buffer, options)
 	if err != nil {
-		panic(err)
+		return offset, weight, delay, interleaved, &PacketError{Op: "serialize payload", Err: err}
 	}
 	buffer.PushLayer(payload.LayerType())
 
 	err = udpLayer.SerializeTo(buffer, options)
 	if err != nil {
-		panic(err)
+		return offset, weight, delay, interleaved, &PacketError{Op: "serialize UDP header", Err: err}
 	}
 	buffer.PushLayer(udpLayer.LayerType())
 
+	e2eExtn := slayers.EndToEndExtn{}
+	e2eExtn.NextHdr = scionLayer.NextHdr
+	tsRequested := requestServerTimestamp(reference, cTxTime0)
+	if tsRequested {
+		tsOpt := &slayers.EndToEndOption{}
+		scion.PrepareTimestampCapabilityOpt(tsOpt)
+		e2eExtn.Options = append(e2eExtn.Options, tsOpt)
+	}
+
 	if c.Auth.Enabled {
-		hostHostKey, err := c.Auth.DRKeyFetcher.FetchHostHostKey(ctx, drkey.HostHostMeta{
+		kctx, kspan := tracing.StartSpan(ctx, "fetch_drkey")
+		hostHostKey, err := c.Auth.DRKeyFetcher.FetchHostHostKey(kctx, drkey.HostHostMeta{
 			ProtoId:  scion.DRKeyProtocolTS,
 			Validity: cTxTime0,
 			SrcIA:    remoteAddr.IA,
@@ -252,94 +470,116 @@ func (c *SCIONClient) measureClockOffsetSCION(ctx context.Context, log *zap.Logg
 			SrcHost:  remoteAddr.Host.IP.String(),
 			DstHost:  localAddr.Host.IP.String(),
 		})
+		tracing.EndSpan(kspan, err)
 		if err != nil {
 			log.Info("failed to fetch DRKey level 3: host-host key", zap.Error(err))
 		} else {
 			authKey = hostHostKey.Key[:]
 
-			scion.PreparePacketAuthOpt(c.Auth.opt, scion.PacketAuthSPIClient, scion.PacketAuthAlgorithm)
-			_, err = spao.ComputeAuthCMAC(
+			scion.PreparePacketAuthOpt(authOpt, scion.PacketAuthSPIClient, spao.Algorithm())
+			_, err = spao.ComputeAuthMAC(
 				spao.MACInput{
 					Key:        authKey,
-					Header:     slayers.PacketAuthOption{EndToEndOption: c.Auth.opt},
+					Header:     slayers.PacketAuthOption{EndToEndOption: authOpt},
 					ScionLayer: &scionLayer,
 					PldType:    scionLayer.NextHdr,
 					Pld:        buffer.Bytes(),
 				},
-				c.Auth.buf,
-				scion.PacketAuthOptMAC(c.Auth.opt),
+				authBuf,
+				scion.PacketAuthOptMAC(authOpt),
 			)
 			if err != nil {
-				panic(err)
+				return offset, weight, delay, interleaved, &PacketError{Op: "compute authenticator", Err: err}
 			}
 
-			e2eExtn := slayers.EndToEndExtn{}
-			e2eExtn.NextHdr = scionLayer.NextHdr
-			e2eExtn.Options = []*slayers.EndToEndOption{c.Auth.opt}
-
-			err = e2eExtn.SerializeTo(buffer, options)
-			if err != nil {
-				panic(err)
-			}
-			buffer.PushLayer(e2eExtn.LayerType())
+			e2eExtn.Options = append([]*slayers.EndToEndOption{authOpt}, e2eExtn.Options...)
+		}
+	}
 
-			scionLayer.NextHdr = slayers.End2EndClass
+	if len(e2eExtn.Options) != 0 {
+		err = e2eExtn.SerializeTo(buffer, options)
+		if err != nil {
+			return offset, weight, delay, interleaved, &PacketError{Op: "serialize end-to-end extension", Err: err}
 		}
+		buffer.PushLayer(e2eExtn.LayerType())
+
+		scionLayer.NextHdr = slayers.End2EndClass
 	}
 
 	err = scionLayer.SerializeTo(buffer, options)
 	if err != nil {
-		panic(err)
+		return offset, weight, delay, interleaved, &PacketError{Op: "serialize SCION header", Err: err}
 	}
 	buffer.PushLayer(scionLayer.LayerType())
 
-	n, err := conn.WriteToUDPAddrPort(buffer.Bytes(), nextHop)
+	if len(buffer.Bytes()) > mtu {
+		return offset, weight, delay, interleaved, errPacketTooLarge
+	}
+	_, sspan := tracing.StartSpan(ctx, "send")
+	n, err := c.Faults.writeTo(log, conn, buffer.Bytes(), nextHop)
 	if err != nil {
-		return offset, weight, err
+		tracing.EndSpan(sspan, err)
+		return offset, weight, delay, interleaved, err
 	}
 	if n != len(buffer.Bytes()) {
-		return offset, weight, errWrite
+		tracing.EndSpan(sspan, errWrite)
+		return offset, weight, delay, interleaved, errWrite
 	}
-	cTxTime1, id, err := udp.ReadTXTimestamp(conn)
+	cTxTime1, id, err := readTXTimestamp(conn)
 	if err != nil || id != 0 {
-		cTxTime1 = timebase.Now()
+		cTxTime1 = timebase.RawNow()
 		log.Error("failed to read packet tx timestamp", zap.Error(err))
 	}
+	if pcap.Enabled() {
+		pcap.Write(cTxTime1, localAddrPort(conn), nextHop, buffer.Bytes())
+	}
+	tracing.EndSpan(sspan, nil)
 	mtrcs.reqsSent.Inc()
 	if interleaved {
 		mtrcs.reqsSentInterleaved.Inc()
 	}
 
-	numRetries := 0
+	_, rspan := tracing.StartSpan(ctx, "receive")
+	defer func() { tracing.EndSpan(rspan, err) }()
+	reqInterleaved := interleaved
+	retries := newRetrier(deadline, deadlineIsSet, mtrcs.pktsDiscarded)
 	oob := make([]byte, udp.TimestampLen())
 	for {
 		buf = buf[:cap(buf)]
 		oob = oob[:cap(oob)]
+		err = retries.prepareRead(conn)
+		if err != nil {
+			return offset, weight, delay, interleaved, err
+		}
 		n, oobn, flags, lastHop, err := conn.ReadMsgUDPAddrPort(buf, oob)
 		if err != nil {
-			if numRetries != maxNumRetries && deadlineIsSet && timebase.Now().Before(deadline) {
+			if retries.retry(discardReasonRead) {
 				log.Info("failed to read packet", zap.Error(err))
-				numRetries++
 				continue
 			}
-			return offset, weight, err
+			return offset, weight, delay, interleaved, retries.fail(err)
 		}
 		if flags != 0 {
 			err = errUnexpectedPacketFlags
-			if numRetries != maxNumRetries && deadlineIsSet && timebase.Now().Before(deadline) {
+			if retries.retry(discardReasonFlags) {
 				log.Info("failed to read packet", zap.Int("flags", flags))
-				numRetries++
 				continue
 			}
-			return offset, weight, err
+			return offset, weight, delay, interleaved, retries.fail(err)
 		}
 		oob = oob[:oobn]
 		cRxTime, err := udp.TimestampFromOOBData(oob)
 		if err != nil {
-			cRxTime = timebase.Now()
+			cRxTime = timebase.RawNow()
 			log.Error("failed to read packet rx timestamp", zap.Error(err))
 		}
 		buf = buf[:n]
+		if pcap.Enabled() {
+			pcap.Write(cRxTime, lastHop, localAddrPort(conn), buf)
+		}
+		if c.Faults.received(log, buf, &cRxTime) {
+			continue
+		}
 		mtrcs.pktsReceived.Inc()
 
 		var (
@@ -354,43 +594,58 @@ func (c *SCIONClient) measureClockOffsetSCION(ctx context.Context, log *zap.Logg
 		decoded := make([]gopacket.LayerType, 4)
 		err = parser.DecodeLayers(buf, &decoded)
 		if err != nil {
-			if numRetries != maxNumRetries && deadlineIsSet && timebase.Now().Before(deadline) {
+			if retries.retry(discardReasonDecode) {
 				log.Info("failed to decode packet", zap.Error(err))
-				numRetries++
 				continue
 			}
-			return offset, weight, err
+			return offset, weight, delay, interleaved, retries.fail(err)
+		}
+		if len(decoded) >= 2 &&
+			decoded[len(decoded)-1] == slayers.LayerTypeSCMP {
+			validDst := scionLayer.DstIA.Equal(localAddr.IA) &&
+				equalIPs(scionLayer.RawDstAddr, localAddr.Host.IP)
+			scmpErr, ok := decodeSCMPError(&scmpLayer, localAddr, remoteAddr, localPort)
+			if validDst && ok {
+				mtrcs.scmpErrors.WithLabelValues(scmpErrorType(scmpErr.TypeCode.Type())).Inc()
+				if c.Auth.Enabled || c.Auth.NTSEnabled {
+					// SCMP messages are unauthenticated and must not abort an
+					// authenticated exchange; only count them
+					log.Info("ignored SCMP error", zap.Error(scmpErr))
+					continue
+				}
+				return offset, weight, delay, interleaved, scmpErr
+			}
 		}
 		validType := len(decoded) >= 2 &&
 			decoded[len(decoded)-1] == slayers.LayerTypeSCIONUDP
 		if !validType {
 			err = errUnexpectedPacket
-			if numRetries != maxNumRetries && deadlineIsSet && timebase.Now().Before(deadline) {
+			if retries.retry(discardReasonDecode) {
 				log.Info("failed to decode packet", zap.String("cause", "unexpected type or structure"))
-				numRetries++
 				continue
 			}
-			return offset, weight, err
+			return offset, weight, delay, interleaved, retries.fail(err)
 		}
 		validSrc := scionLayer.SrcIA.Equal(remoteAddr.IA) &&
-			compareIPs(scionLayer.RawSrcAddr, remoteAddr.Host.IP) == 0
+			equalIPs(scionLayer.RawSrcAddr, remoteAddr.Host.IP)
 		validDst := scionLayer.DstIA.Equal(localAddr.IA) &&
-			compareIPs(scionLayer.RawDstAddr, localAddr.Host.IP) == 0
+			equalIPs(scionLayer.RawDstAddr, localAddr.Host.IP)
 		if !validSrc || !validDst {
 			err = errUnexpectedPacket
-			if numRetries != maxNumRetries && deadlineIsSet && timebase.Now().Before(deadline) {
+			if retries.retry(discardReasonSource) {
 				if !validSrc {
 					log.Info("received packet from unexpected source")
 				}
 				if !validDst {
 					log.Info("received packet to unexpected destination")
 				}
-				numRetries++
 				continue
 			}
-			return offset, weight, err
+			return offset, weight, delay, interleaved, retries.fail(err)
 		}
 
+		var sRxTimeOpt time.Time
+		sRxTimeOptFound := false
 		authenticated := false
 		if len(decoded) >= 3 &&
 			decoded[len(decoded)-2] == slayers.LayerTypeEndToEndExtn {
@@ -401,34 +656,44 @@ func (c *SCIONClient) measureClockOffsetSCION(ctx context.Context, log *zap.Logg
 					cRxTime = cRxTime0
 				}
 			}
+			sRxTimeOpt, sRxTimeOptFound = scion.FindServerTimestampOpt(e2eLayer.Options)
 			if authKey != nil {
-				authOpt, err := e2eLayer.FindOption(slayers.OptTypeAuthenticator)
+				respAuthOpt, err := e2eLayer.FindOption(slayers.OptTypeAuthenticator)
 				if err == nil {
-					spi, algo := scion.PacketAuthOptMetadata(authOpt)
-					if spi == scion.PacketAuthSPIServer && algo == scion.PacketAuthAlgorithm {
-						_, err = spao.ComputeAuthCMAC(
+					err = scion.ValidatePacketAuthOpt(respAuthOpt)
+					if err != nil {
+						events.Record(events.KindAuthFailure, reference, "failed to authenticate packet: %v", err)
+						if retries.retry(discardReasonAuth) {
+							log.Info("failed to authenticate packet", zap.Error(err))
+							continue
+						}
+						return offset, weight, delay, interleaved, retries.fail(err)
+					}
+					spi, algo := scion.PacketAuthOptMetadata(respAuthOpt)
+					if spi == scion.PacketAuthSPIServer && algo == uint8(authOpt.OptData[4]) {
+						_, err = spao.ComputeAuthMAC(
 							spao.MACInput{
 								Key:        authKey,
-								Header:     slayers.PacketAuthOption{EndToEndOption: authOpt},
+								Header:     slayers.PacketAuthOption{EndToEndOption: respAuthOpt},
 								ScionLayer: &scionLayer,
 								PldType:    slayers.L4UDP,
 								Pld:        buf[len(buf)-int(udpLayer.Length):],
 							},
-							c.Auth.buf,
-							c.Auth.mac,
+							authBuf,
+							authMAC,
 						)
 						if err != nil {
-							panic(err)
+							return offset, weight, delay, interleaved, &PacketError{Op: "compute authenticator", Err: err}
 						}
-						authenticated = subtle.ConstantTimeCompare(scion.PacketAuthOptMAC(authOpt), c.Auth.mac) != 0
+						authenticated = subtle.ConstantTimeCompare(scion.PacketAuthOptMAC(respAuthOpt), authMAC) != 0
 						if !authenticated {
 							err = errInvalidPacketAuthenticator
-							if numRetries != maxNumRetries && deadlineIsSet && timebase.Now().Before(deadline) {
+							events.Record(events.KindAuthFailure, reference, "failed to authenticate packet: %v", err)
+							if retries.retry(discardReasonAuth) {
 								log.Info("failed to authenticate packet", zap.Error(err))
-								numRetries++
 								continue
 							}
-							return offset, weight, err
+							return offset, weight, delay, interleaved, retries.fail(err)
 						}
 						mtrcs.pktsAuthenticated.Inc()
 					}
@@ -439,12 +704,11 @@ func (c *SCIONClient) measureClockOffsetSCION(ctx context.Context, log *zap.Logg
 		var ntpresp ntp.Packet
 		err = ntp.DecodePacket(&ntpresp, udpLayer.Payload)
 		if err != nil {
-			if numRetries != maxNumRetries && deadlineIsSet && timebase.Now().Before(deadline) {
+			if retries.retry(decodeDiscardReason(err)) {
 				log.Info("failed to decode packet payload", zap.Error(err))
-				numRetries++
 				continue
 			}
-			return offset, weight, err
+			return offset, weight, delay, interleaved, retries.fail(err)
 		}
 
 		ntsAuthenticated := false
@@ -452,42 +716,67 @@ func (c *SCIONClient) measureClockOffsetSCION(ctx context.Context, log *zap.Logg
 		if c.Auth.NTSEnabled {
 			err = nts.DecodePacket(&ntsresp, udpLayer.Payload)
 			if err != nil {
-				if numRetries != maxNumRetries && deadlineIsSet && timebase.Now().Before(deadline) {
+				if retries.retry(discardReasonDecode) {
 					log.Info("failed to decode NTS packet", zap.Error(err))
-					numRetries++
 					continue
 				}
-				return offset, weight, err
+				return offset, weight, delay, interleaved, retries.fail(err)
 			}
 
 			err = nts.ProcessResponse(udpLayer.Payload, ntskeData.S2cKey, &c.Auth.NTSKEFetcher, &ntsresp, requestID)
 			if err != nil {
-				if numRetries != maxNumRetries && deadlineIsSet && timebase.Now().Before(deadline) {
+				if retries.retry(discardReasonAuth) {
 					log.Info("failed to process NTS packet", zap.Error(err))
-					numRetries++
 					continue
 				}
-				return offset, weight, err
+				return offset, weight, delay, interleaved, retries.fail(err)
 			}
 			ntsAuthenticated = true
 		}
 
 		interleaved = false
-		if c.InterleavedMode && ntpresp.OriginTime == c.prev.cRxTime {
+		if prevOK && originMatches(ntpresp.OriginTime, prev.cRxTime) {
 			interleaved = true
-		} else if ntpresp.OriginTime != ntpreq.TransmitTime {
+		} else if !originMatches(ntpresp.OriginTime, ntpreq.TransmitTime) {
 			err = errUnexpectedPacket
-			if numRetries != maxNumRetries && deadlineIsSet && timebase.Now().Before(deadline) {
+			if retries.retry(discardReasonUnexpected) {
 				log.Info("received packet with unexpected type or structure")
-				numRetries++
 				continue
 			}
-			return offset, weight, err
+			return offset, weight, delay, interleaved, retries.fail(err)
+		}
+		if reqInterleaved && !interleaved {
+			// The server no longer has the state of the previous exchange,
+			// continue in basic mode.
+			log.Debug("received basic mode response to interleaved request",
+				zap.String("from", reference))
 		}
 
-		err = ntp.ValidateResponseMetadata(&ntpresp)
+		if c.Symmetric {
+			err = ntp.ValidateSymmetricResponseMetadata(&ntpresp)
+		} else {
+			err = ntp.ValidateResponseMetadata(&ntpresp)
+		}
 		if err != nil {
-			return offset, weight, err
+			reject(rejectReasonMetadata, err)
+			return offset, weight, delay, interleaved, classify(ErrBadPacket, err)
+		}
+
+		// Interleaved state is only meaningful for the same upstream server.
+		// A different stratum or reference ID indicates that another server
+		// answered behind the same address, e.g., in case of anycast.
+		if prevOK && upstreamOf(&ntpresp) != prev.upstream {
+			log.Info("upstream server changed",
+				zap.String("reference", reference),
+				zap.Uint8("stratum", ntpresp.Stratum),
+				zap.Uint32("refid", ntpresp.ReferenceID),
+			)
+			c.resetInterleavedState(key)
+			if interleaved {
+				err = errUpstreamChanged
+				reject(rejectReasonUpstream, err)
+				return offset, weight, delay, interleaved, err
+			}
 		}
 
 		dscp := scionLayer.TrafficClass >> 2
@@ -502,34 +791,54 @@ func (c *SCIONClient) measureClockOffsetSCION(ctx context.Context, log *zap.Logg
 			zap.Object("data", ntp.PacketMarshaler{Pkt: &ntpresp}),
 		)
 
-		sRxTime := ntp.TimeFromTime64(ntpresp.ReceiveTime)
-		sTxTime := ntp.TimeFromTime64(ntpresp.TransmitTime)
+		if tsRequested {
+			recordServerTimestamp(reference, sRxTimeOptFound, cRxTime)
+		}
 
-		var t0, t1, t2, t3 time.Time
+		var x exchangeTimes
 		if interleaved {
-			t0 = ntp.TimeFromTime64(c.prev.cTxTime)
-			t1 = ntp.TimeFromTime64(c.prev.sRxTime)
-			t2 = sTxTime
-			t3 = ntp.TimeFromTime64(c.prev.cRxTime)
+			x = interleavedExchangeTimes(&ntpresp, prev.cTxTime, prev.sRxTime, prev.cRxTime)
 		} else {
-			t0 = cTxTime1
-			t1 = sRxTime
-			t2 = sTxTime
-			t3 = cRxTime
+			x = basicExchangeTimes(&ntpresp, cTxTime1, cRxTime)
+			// The timestamp option is not covered by the authenticator, only
+			// use it to refine the receive timestamp of the NTP payload.
+			if sRxTimeOptFound && timemath.Abs(sRxTimeOpt.Sub(x.t1.Time())) < time.Microsecond {
+				x.t1 = timemath.FineTimeOf(sRxTimeOpt, 0)
+			}
 		}
 
-		err = ntp.ValidateResponseTimestamps(t0, t1, t1, t3)
+		var off, rtd time.Duration
+		off, rtd, err = x.evaluate(false)
 		if err != nil {
-			return offset, weight, err
+			if errors.Is(err, errOffsetGate) {
+				reject(rejectReasonOffsetGate, err,
+					zap.Duration("clock offset", off),
+					zap.Duration("round trip delay", rtd))
+			} else {
+				reject(rejectReasonTimestamps, err)
+			}
+			return offset, weight, delay, interleaved, err
 		}
 
-		off := ntp.ClockOffset(t0, t1, t2, t3)
-		rtd := ntp.RoundTripDelay(t0, t1, t2, t3)
-
 		mtrcs.respsAccepted.Inc()
 		if interleaved {
 			mtrcs.respsAcceptedInterleaved.Inc()
 		}
+		sample := &Sample{
+			Time:          cRxTime,
+			Offset:        off,
+			Delay:         rtd,
+			Authenticated: authenticated || ntsAuthenticated,
+			Transport:     TransportSCION,
+			Server:        remoteAddr.Host.IP.String(),
+			IA:            remoteAddr.IA,
+			Path:          pathInterfaces(path),
+		}
+		observeSample(reference, off, rtd)
+		c.source.store(Source{Stratum: ntpresp.Stratum, RefID: RefIDFromSCION(remoteAddr.IA, remoteAddr.Host.IP)})
+		if c.Symmetric {
+			c.storeSyntonization(udpLayer.Payload, authenticated && !ntsAuthenticated)
+		}
 		log.Debug("evaluated response",
 			zap.String("from", reference),
 			zap.Bool("interleaved", interleaved),
@@ -538,22 +847,32 @@ func (c *SCIONClient) measureClockOffsetSCION(ctx context.Context, log *zap.Logg
 		)
 
 		if c.InterleavedMode {
-			c.prev.reference = reference
-			c.prev.cTxTime = ntp.Time64FromTime(cTxTime1)
-			c.prev.cRxTime = ntp.Time64FromTime(cRxTime)
-			c.prev.sRxTime = ntpresp.ReceiveTime
+			c.storeInterleavedState(key, scionInterleavedState{
+				cTxTime:  ntp.Time64FromTime(cTxTime1),
+				cRxTime:  ntp.Time64FromTime(cRxTime),
+				sRxTime:  ntpresp.ReceiveTime,
+				flowID:   flowID,
+				upstream: upstreamOf(&ntpresp),
+			})
 		}
 
 		// offset, weight = off, 1000.0
 
-		offset, weight = filter(log, reference, t0, t1, t2, t3)
+		_, fspan := tracing.StartSpan(ctx, "filter")
+		offset, weight = filter(log, reference, x.t0, x.t1, x.t2, x.t3)
+		fspan.End()
+		delay = rtd
+		sample.Weight = weight
+		c.sample.Store(sample)
 
 		if c.Histo != nil {
+			c.mu.Lock()
 			c.Histo.RecordValue(rtd.Microseconds())
+			c.mu.Unlock()
 		}
 
 		break
 	}
 
-	return offset, weight, nil
+	return offset, weight, delay, interleaved, nil
 }
@@ -0,0 +1,194 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"go.uber.org/zap"
+
+	"github.com/scionproto/scion/pkg/snet"
+
+	"example.com/scion-time/base/timemath"
+
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/net/ntp"
+	"example.com/scion-time/net/scion"
+	"example.com/scion-time/net/udp"
+)
+
+// SCIONStreamClient measures clock offsets via NTP packets framed on QUIC
+// streams over SCION, see ntp.WriteFrame. It is meant as a fallback for paths
+// on which NTP packets are not delivered as UDP datagrams. Exchanges are in
+// basic mode and share a connection until it fails.
+//
+// The streams are QUIC rather than TCP streams because SCION end hosts and
+// border routers only carry UDP as transport protocol, so there is no TCP over
+// SCION to build on. QUIC provides reliable byte streams over SCION/UDP,
+// splits frames into packets that fit the path MTU, and is already used for
+// NTS-KE over SCION, see scion.DialQUIC.
+//
+// Overhead is the estimated delay added by the stream transport between the
+// timestamps of a frame and the transmission or reception of its packets. It
+// is applied to both client timestamps, but to at most half the round trip
+// time measured.
+type SCIONStreamClient struct {
+	TLSConfig tls.Config
+	Overhead  time.Duration
+	source    sourceValue
+	sample    atomic.Pointer[Sample]
+	mu        sync.Mutex
+	conn      *scion.QUICConnection
+	path      snet.Path
+}
+
+// Source returns the stratum and reference ID of the server at the time of
+// the last accepted offset measurement.
+func (c *SCIONStreamClient) Source() (Source, bool) {
+	return c.source.load()
+}
+
+// LastSample returns the last accepted offset measurement.
+func (c *SCIONStreamClient) LastSample() (Sample, bool) {
+	x := c.sample.Load()
+	if x == nil {
+		return Sample{}, false
+	}
+	return *x, true
+}
+
+func (c *SCIONStreamClient) connection(ctx context.Context, localAddr, remoteAddr udp.UDPAddr,
+	ps []snet.Path) (*scion.QUICConnection, error) {
+	if c.conn != nil {
+		return c.conn, nil
+	}
+	ps = usablePaths(ps)
+	if len(ps) == 0 {
+		return nil, errNoPaths
+	}
+	remoteAddr.Host = &net.UDPAddr{IP: remoteAddr.Host.IP, Port: ntp.ServerPortSCIONStream}
+	tlsCfg := c.TLSConfig.Clone()
+	tlsCfg.NextProtos = []string{ntp.StreamALPN}
+	conn, err := scion.DialQUIC(ctx, localAddr, remoteAddr, ps[0],
+		"" /* host */, tlsCfg, &quic.Config{KeepAlivePeriod: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	c.path = ps[0]
+	return conn, nil
+}
+
+func (c *SCIONStreamClient) closeConnection() {
+	if c.conn != nil {
+		_ = c.conn.CloseWithError(0, "")
+		c.conn = nil
+		c.path = nil
+	}
+}
+
+// streamTransport carries framed NTP packets on a QUIC stream. The client
+// timestamps are corrected by the estimated overhead of the stream transport.
+type streamTransport struct {
+	stream   quic.Stream
+	overhead time.Duration
+}
+
+func (t streamTransport) Exchange(ctx context.Context, req []byte, resp *[]byte) (
+	cTxTime, cRxTime time.Time, err error) {
+	cTxTime = timebase.Now()
+	err = ntp.WriteFrame(t.stream, req)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	err = ntp.ReadFrame(t.stream, resp)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	cRxTime = timebase.Now()
+	overhead := t.overhead
+	if rtt := cRxTime.Sub(cTxTime); overhead > rtt/2 {
+		overhead = rtt / 2
+	}
+	if overhead < 0 {
+		overhead = 0
+	}
+	return cTxTime.Add(overhead), cRxTime.Add(-overhead), nil
+}
+
+func (t streamTransport) Name() string {
+	return TransportSCIONStream
+}
+
+// MeasureClockOffset performs a single exchange with the server at
+// remoteAddr. A new connection is established via the first usable path in
+// ps if there is none.
+func (c *SCIONStreamClient) MeasureClockOffset(ctx context.Context, log *zap.Logger,
+	localAddr, remoteAddr udp.UDPAddr, ps []snet.Path) (
+	offset timemath.FineDuration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conn, err := c.connection(ctx, localAddr, remoteAddr, ps)
+	if err != nil {
+		return offset, err
+	}
+	defer func() {
+		if err != nil {
+			c.closeConnection()
+		}
+	}()
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return offset, err
+	}
+	defer stream.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		err = stream.SetDeadline(deadline)
+		if err != nil {
+			return offset, err
+		}
+	}
+
+	reference := remoteAddr.IA.String() + "," + remoteAddr.Host.String() + "/stream"
+
+	t := streamTransport{stream: stream, overhead: c.Overhead}
+	ntpresp, x, err := exchangeBasic(ctx, t)
+	if err != nil {
+		return offset, err
+	}
+	off, rtd, err := x.evaluate(false)
+	if err != nil {
+		return offset, err
+	}
+
+	log.Debug("evaluated response",
+		zap.String("from", reference),
+		zap.Duration("clock offset", off),
+		zap.Duration("round trip delay", rtd),
+	)
+
+	observeSample(reference, off, rtd)
+	c.source.store(Source{Stratum: ntpresp.Stratum, RefID: RefIDFromSCION(remoteAddr.IA, remoteAddr.Host.IP)})
+
+	var weight float64
+	offset, weight = filter(log, reference, x.t0, x.t1, x.t2, x.t3)
+	c.sample.Store(&Sample{
+		Time:          x.t3.Time(),
+		Offset:        off,
+		Delay:         rtd,
+		Weight:        weight,
+		Authenticated: !c.TLSConfig.InsecureSkipVerify,
+		Transport:     t.Name(),
+		Server:        remoteAddr.Host.IP.String(),
+		IA:            remoteAddr.IA,
+		Path:          pathInterfaces(c.path),
+	})
+
+	return offset, nil
+}
@@ -0,0 +1,242 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/snet"
+	"github.com/scionproto/scion/pkg/snet/path"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/timebase"
+	"example.com/scion-time/driver/clock"
+	"example.com/scion-time/net/ntp"
+	"example.com/scion-time/net/scion"
+	"example.com/scion-time/net/udp"
+)
+
+// cannedConn answers each request with the response of a server whose clock is
+// ahead of the local clock by offset.
+type cannedConn struct {
+	offset time.Duration
+	resps  chan []byte
+}
+
+func (c *cannedConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 31000}
+}
+
+func (c *cannedConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *cannedConn) WriteToUDPAddrPort(b []byte, addr netip.AddrPort) (int, error) {
+	var (
+		scionLayer slayers.SCION
+		e2eLayer   slayers.EndToEndExtn
+		udpLayer   slayers.UDP
+	)
+	parser := gopacket.NewDecodingLayerParser(slayers.LayerTypeSCION, &scionLayer, &e2eLayer, &udpLayer)
+	parser.IgnoreUnsupported = true
+	decoded := make([]gopacket.LayerType, 3)
+	err := parser.DecodeLayers(b, &decoded)
+	if err != nil {
+		return 0, err
+	}
+	var req ntp.Packet
+	err = ntp.DecodePacket(&req, udpLayer.Payload)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Add(c.offset)
+	resp := ntp.Packet{
+		Stratum:      1,
+		OriginTime:   req.TransmitTime,
+		ReceiveTime:  ntp.Time64FromTime(now),
+		TransmitTime: ntp.Time64FromTime(now.Add(10 * time.Microsecond)),
+	}
+	resp.SetVersion(ntp.VersionMax)
+	resp.SetMode(ntp.ModeServer)
+	var payload []byte
+	ntp.EncodePacket(&payload, &resp)
+
+	scionLayer.DstIA, scionLayer.SrcIA = scionLayer.SrcIA, scionLayer.DstIA
+	scionLayer.DstAddrType, scionLayer.SrcAddrType = scionLayer.SrcAddrType, scionLayer.DstAddrType
+	scionLayer.RawDstAddr, scionLayer.RawSrcAddr = scionLayer.RawSrcAddr, scionLayer.RawDstAddr
+	var pkt []byte
+	err = scion.EncodeUDPPacket(&pkt, &scionLayer, udpLayer.DstPort, udpLayer.SrcPort, payload)
+	if err != nil {
+		return 0, err
+	}
+	c.resps <- pkt
+	return len(b), nil
+}
+
+func (c *cannedConn) ReadMsgUDPAddrPort(b, oob []byte) (n, oobn, flags int, addr netip.AddrPort, err error) {
+	select {
+	case pkt := <-c.resps:
+		return copy(b, pkt), 0, 0, netip.AddrPort{}, nil
+	case <-time.After(time.Second):
+		return 0, 0, 0, netip.AddrPort{}, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *cannedConn) Close() error {
+	return nil
+}
+
+// silentConn drops all requests.
+type silentConn struct {
+	cannedConn
+}
+
+func (c *silentConn) WriteToUDPAddrPort(b []byte, addr netip.AddrPort) (int, error) {
+	return len(b), nil
+}
+
+func (c *silentConn) ReadMsgUDPAddrPort(b, oob []byte) (n, oobn, flags int, addr netip.AddrPort, err error) {
+	return 0, 0, 0, netip.AddrPort{}, os.ErrDeadlineExceeded
+}
+
+func TestMeasureClockOffsetSCION(t *testing.T) {
+	timebase.RegisterClockIfUnset(&clock.SystemClock{Log: zap.NewNop()})
+
+	const offset = 25 * time.Millisecond
+	ia := addr.MustIAFrom(1, 0xff0000000110)
+	localAddr := udp.UDPAddr{IA: ia, Host: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}}
+	remoteAddr := udp.UDPAddr{IA: ia, Host: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: ntp.ServerPortSCION}}
+	ps := []snet.Path{path.Path{
+		Src:           ia,
+		Dst:           ia,
+		DataplanePath: path.Empty{},
+	}}
+
+	c := &client.SCIONClient{
+		Listen: func(ip net.IP, zone string) (client.PacketConn, error) {
+			return &cannedConn{offset: offset, resps: make(chan []byte, 1)}, nil
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	off, err := client.MeasureClockOffsetSCION(ctx, zap.NewNop(), []*client.SCIONClient{c}, localAddr, remoteAddr, ps)
+	if err != nil {
+		t.Fatalf("MeasureClockOffsetSCION failed: %v", err)
+	}
+	if d := off - offset; d < -time.Millisecond || d > time.Millisecond {
+		t.Errorf("MeasureClockOffsetSCION = %v; want %v", off, offset)
+	}
+
+	_, w, err := client.MeasureWeightedClockOffsetSCION(ctx, zap.NewNop(), []*client.SCIONClient{c}, localAddr, remoteAddr, ps)
+	if err != nil {
+		t.Fatalf("MeasureWeightedClockOffsetSCION failed: %v", err)
+	}
+	s, ok := c.LastSample()
+	if !ok || w != s.Weight || w < 1 {
+		t.Errorf("MeasureWeightedClockOffsetSCION weight = %v; want %v", w, s.Weight)
+	}
+}
+
+func TestMedianMeasurement(t *testing.T) {
+	const ms = time.Millisecond
+	for _, tc := range []struct {
+		offs       []time.Duration
+		ws         []float64
+		wantOff    time.Duration
+		wantWeight float64
+	}{
+		{[]time.Duration{5 * ms}, []float64{10}, 5 * ms, 10},
+		// The weight is that of the path selected, not of the most recent one
+		{[]time.Duration{3 * ms, 1 * ms, 2 * ms}, []float64{300, 100, 200}, 2 * ms, 200},
+		{[]time.Duration{4 * ms, 1 * ms, 2 * ms, 3 * ms}, []float64{400, 100, 200, 300}, 2500 * time.Microsecond, 250},
+	} {
+		off, w := client.MedianMeasurement(tc.offs, tc.ws)
+		if off != tc.wantOff || w != tc.wantWeight {
+			t.Errorf("MedianMeasurement(%v, %v) = %v, %v; want %v, %v",
+				tc.offs, tc.ws, off, w, tc.wantOff, tc.wantWeight)
+		}
+	}
+}
+
+func TestMeasureClockOffsetSCIONConcurrent(t *testing.T) {
+	timebase.RegisterClockIfUnset(&clock.SystemClock{Log: zap.NewNop()})
+
+	const offset = -10 * time.Millisecond
+	ia := addr.MustIAFrom(1, 0xff0000000110)
+	localAddr := udp.UDPAddr{IA: ia, Host: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}}
+	remoteAddr := udp.UDPAddr{IA: ia, Host: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: ntp.ServerPortSCION}}
+	ps := []snet.Path{path.Path{
+		Src:           ia,
+		Dst:           ia,
+		DataplanePath: path.Empty{},
+	}}
+
+	c := &client.SCIONClient{
+		InterleavedMode: true,
+		Listen: func(ip net.IP, zone string) (client.PacketConn, error) {
+			return &cannedConn{offset: offset, resps: make(chan []byte, 1)}, nil
+		},
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i != cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			off, err := client.MeasureClockOffsetSCION(ctx, zap.NewNop(), []*client.SCIONClient{c}, localAddr, remoteAddr, ps)
+			if err == nil && (off-offset < -time.Millisecond || off-offset > time.Millisecond) {
+				t.Errorf("MeasureClockOffsetSCION = %v; want %v", off, offset)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("MeasureClockOffsetSCION failed: %v", err)
+		}
+	}
+}
+
+func TestMeasureClockOffsetSCIONTimeout(t *testing.T) {
+	timebase.RegisterClockIfUnset(&clock.SystemClock{Log: zap.NewNop()})
+
+	ia := addr.MustIAFrom(1, 0xff0000000110)
+	localAddr := udp.UDPAddr{IA: ia, Host: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}}
+	remoteAddr := udp.UDPAddr{IA: ia, Host: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: ntp.ServerPortSCION}}
+	ps := []snet.Path{path.Path{
+		Src:           ia,
+		Dst:           ia,
+		DataplanePath: path.Empty{},
+	}}
+
+	c := &client.SCIONClient{
+		Listen: func(ip net.IP, zone string) (client.PacketConn, error) {
+			return &silentConn{}, nil
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := client.MeasureClockOffsetSCION(ctx, zap.NewNop(), []*client.SCIONClient{c}, localAddr, remoteAddr, ps)
+	if !errors.Is(err, client.ErrTimeout) {
+		t.Errorf("MeasureClockOffsetSCION = %v; want %v", err, client.ErrTimeout)
+	}
+	if errors.Is(err, client.ErrBadPacket) {
+		t.Errorf("MeasureClockOffsetSCION = %v; must not match %v", err, client.ErrBadPacket)
+	}
+}
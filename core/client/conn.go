@@ -0,0 +1,63 @@
+package client
+
+// Packet I/O and path lookup of the SCION client. Both are abstracted so that
+// tests can inject synthetic paths and canned responses instead of depending
+// on a SCION daemon and a network.
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/snet"
+
+	"example.com/scion-time/net/scion"
+	"example.com/scion-time/net/udp"
+)
+
+// PacketConn is the connection over which SCIONClient exchanges packets. It is
+// implemented by *net.UDPConn. Socket options and kernel timestamps are only
+// available with *net.UDPConn.
+type PacketConn interface {
+	LocalAddr() net.Addr
+	SetDeadline(t time.Time) error
+	WriteToUDPAddrPort(b []byte, addr netip.AddrPort) (int, error)
+	ReadMsgUDPAddrPort(b, oob []byte) (n, oobn, flags int, addr netip.AddrPort, err error)
+	Close() error
+}
+
+// ListenFunc returns a PacketConn bound to ip.
+type ListenFunc func(ip net.IP, zone string) (PacketConn, error)
+
+// PathProvider returns the paths to destination AS dst, e.g., *scion.Pather.
+type PathProvider interface {
+	Paths(dst addr.IA) []snet.Path
+}
+
+var errNoTXTimestamp = errors.New("tx timestamp not supported")
+
+func listenEndhostUDP(ip net.IP, zone string) (PacketConn, error) {
+	conn, err := scion.ListenEndhostUDP(ip, zone)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+func readTXTimestamp(conn PacketConn) (time.Time, uint32, error) {
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		return time.Time{}, 0, errNoTXTimestamp
+	}
+	return udp.ReadTXTimestamp(udpConn)
+}
+
+func localAddrPort(conn PacketConn) netip.AddrPort {
+	a, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return netip.AddrPort{}
+	}
+	return a.AddrPort()
+}
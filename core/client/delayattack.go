@@ -0,0 +1,169 @@
+package client
+
+// Detection of delay attacks on SCION paths based on constant-rate probing: an
+// on-path attacker that delays the packets of one direction only shifts the
+// measured clock offset by half of the added delay, which cannot be detected
+// from a single measurement. With probes sent at a fixed interval, however,
+// such an attack shows up as a persistent increase of the round trip delay
+// over its baseline. The increase is tracked with a one-sided CUSUM test and
+// classified as unilateral if the clock offset shifts along with it. Probes
+// that time out count as evidence as well since an attacker may just as well
+// delay packets beyond the probe timeout. The baseline is learned again
+// periodically to follow legitimate changes of the path delay.
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/scionproto/scion/pkg/snet"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/net/scion"
+)
+
+const (
+	delayBaselineLen    = 16                     // number of probes that establish the baseline
+	delayMinDeviation   = 100 * time.Microsecond // lower bound of the delay deviation
+	delayCUSUMSlack     = 0.5                    // allowed drift in deviations per probe
+	delayCUSUMThreshold = 5.0                    // alarm threshold in deviations
+	delayMinAsymmetry   = 0.25                   // minimum ratio of offset shift to delay increase
+	delayAttackHoldTime = 1 * time.Hour          // time a suspicious path is avoided
+	delayBaselineMaxAge = 24 * time.Hour         // time after which the baseline is learned again
+	delayTimeoutZ       = 2.0                    // deviations a timed out probe counts for
+)
+
+var delayAttacks = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: metrics.SCIONClientPathDelayAttacksN,
+	Help: metrics.SCIONClientPathDelayAttacksH,
+}, pathStatsLbl)
+
+type delayMonitor struct {
+	delays    []time.Duration
+	offsets   []time.Duration
+	baseDelay time.Duration
+	baseOff   time.Duration
+	dev       time.Duration
+	learned   time.Time
+	sum       float64
+	suspected time.Time
+}
+
+func (m *delayMonitor) learn(now time.Time, off, rtd time.Duration) {
+	m.delays = append(m.delays, rtd)
+	m.offsets = append(m.offsets, off)
+	if len(m.delays) != delayBaselineLen {
+		return
+	}
+	m.learned = now
+	m.baseDelay = timemath.Median(m.delays)
+	m.baseOff = timemath.Median(m.offsets)
+	for i := range m.delays {
+		m.delays[i] = timemath.Abs(m.delays[i] - m.baseDelay)
+	}
+	m.dev = timemath.Median(m.delays)
+	if m.dev < delayMinDeviation {
+		m.dev = delayMinDeviation
+	}
+}
+
+func (m *delayMonitor) established(now time.Time) bool {
+	if len(m.delays) != delayBaselineLen {
+		return false
+	}
+	if now.Sub(m.learned) > delayBaselineMaxAge && m.sum == 0 && !m.suspicious(now) {
+		m.delays = m.delays[:0]
+		m.offsets = m.offsets[:0]
+		return false
+	}
+	return true
+}
+
+// accumulate adds z deviations to the CUSUM statistic and reports whether it
+// exceeds the alarm threshold.
+func (m *delayMonitor) accumulate(z float64) bool {
+	m.sum += z - delayCUSUMSlack
+	if m.sum < 0 {
+		m.sum = 0
+	}
+	if m.sum <= delayCUSUMThreshold {
+		return false
+	}
+	m.sum = 0
+	return true
+}
+
+// add updates the monitor with the probe result off and rtd at time now and
+// reports whether it indicates a unilateral delay increase.
+func (m *delayMonitor) add(now time.Time, off, rtd time.Duration) bool {
+	if !m.established(now) {
+		m.learn(now, off, rtd)
+		return false
+	}
+	if !m.accumulate(float64(rtd-m.baseDelay) / float64(m.dev)) {
+		return false
+	}
+	inc := rtd - m.baseDelay
+	shift := timemath.Abs(off - m.baseOff)
+	return inc > 0 && float64(shift) >= delayMinAsymmetry*float64(inc)
+}
+
+// timeout updates the monitor with a probe that timed out at time now and
+// reports whether persistent timeouts indicate a delay attack.
+func (m *delayMonitor) timeout(now time.Time) bool {
+	if !m.established(now) {
+		return false
+	}
+	return m.accumulate(delayTimeoutZ)
+}
+
+func (m *delayMonitor) suspicious(now time.Time) bool {
+	return !m.suspected.IsZero() && now.Sub(m.suspected) < delayAttackHoldTime
+}
+
+func (s *PathSelector) monitor(fp snet.PathFingerprint) *delayMonitor {
+	m, ok := s.monitors[fp]
+	if !ok {
+		m = &delayMonitor{}
+		s.monitors[fp] = m
+	}
+	return m
+}
+
+func (s *PathSelector) checkDelayAttack(p snet.Path, fp snet.PathFingerprint, off, rtd time.Duration) {
+	m := s.monitor(fp)
+	now := time.Now()
+	if !m.add(now, off, rtd) {
+		return
+	}
+	s.log.Warn("detected potential delay attack",
+		zap.Stringer("to", s.remoteAddr.IA),
+		zap.Object("via", scion.PathMarshaler{Path: p}),
+		zap.Duration("delay", rtd),
+		zap.Duration("baseline_delay", m.baseDelay),
+		zap.Duration("offset", off),
+		zap.Duration("baseline_offset", m.baseOff),
+	)
+	delayAttacks.WithLabelValues(s.remoteAddr.String(), fp.String()).Inc()
+	m.suspected = now
+}
+
+func (s *PathSelector) checkDelayAttackTimeout(p snet.Path, fp snet.PathFingerprint) {
+	m := s.monitor(fp)
+	now := time.Now()
+	if !m.timeout(now) {
+		return
+	}
+	s.log.Warn("detected potential delay attack",
+		zap.Stringer("to", s.remoteAddr.IA),
+		zap.Object("via", scion.PathMarshaler{Path: p}),
+		zap.String("reason", "timeout"),
+		zap.Duration("baseline_delay", m.baseDelay),
+	)
+	delayAttacks.WithLabelValues(s.remoteAddr.String(), fp.String()).Inc()
+	m.suspected = now
+}
@@ -0,0 +1,54 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"example.com/scion-time/core/client"
+)
+
+func learnBaseline(m *client.DelayMonitor, now time.Time, rtd time.Duration) {
+	for i := 0; i != client.DelayBaselineLen; i++ {
+		m.Add(now, 0, rtd)
+	}
+}
+
+func TestDelayMonitorUnilateralDelay(t *testing.T) {
+	var m client.DelayMonitor
+	t0 := time.Unix(0, 0)
+	learnBaseline(&m, t0, 10*time.Millisecond)
+	for i := 0; i != 10; i++ {
+		if m.Add(t0, 2*time.Millisecond, 14*time.Millisecond) {
+			return
+		}
+	}
+	t.Error("unilateral delay increase not detected")
+}
+
+func TestDelayMonitorTimeouts(t *testing.T) {
+	var m client.DelayMonitor
+	t0 := time.Unix(0, 0)
+	if m.Timeout(t0) {
+		t.Fatal("timeout before baseline detected as delay attack")
+	}
+	learnBaseline(&m, t0, 10*time.Millisecond)
+	for i := 0; i != 10; i++ {
+		if m.Timeout(t0) {
+			return
+		}
+	}
+	t.Error("persistent timeouts not detected")
+}
+
+func TestDelayMonitorBaselineAging(t *testing.T) {
+	var m client.DelayMonitor
+	t0 := time.Unix(0, 0)
+	learnBaseline(&m, t0, 10*time.Millisecond)
+	t1 := t0.Add(client.DelayBaselineMaxAge + time.Second)
+	learnBaseline(&m, t1, 20*time.Millisecond)
+	for i := 0; i != 10; i++ {
+		if m.Add(t1, 5*time.Millisecond, 20*time.Millisecond) {
+			t.Fatal("delay of relearned baseline detected as delay attack")
+		}
+	}
+}
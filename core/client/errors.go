@@ -4,11 +4,106 @@ import (
 	"errors"
 )
 
+// Classes of measurement failures. Errors returned by measurements match at
+// most one class with errors.Is; errors that match none of them, e.g., local
+// socket errors, are not specific to the server or the network.
+var (
+	// ErrTimeout indicates that no valid response was received in time.
+	ErrTimeout = errors.New("timeout")
+	// ErrAuthFailed indicates that a response failed authentication.
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrUnexpectedSource indicates that a response was received from an
+	// unexpected address.
+	ErrUnexpectedSource = errors.New("unexpected source")
+	// ErrBadPacket indicates that a response was malformed or did not match
+	// the request.
+	ErrBadPacket = errors.New("bad packet")
+	// ErrKoD indicates that the server sent a kiss-of-death packet or that
+	// polling is suspended because of an earlier one.
+	ErrKoD = errors.New("kiss-of-death")
+)
+
 var (
 	errWrite                  = errors.New("failed to write packet")
-	errUnexpectedPacketFlags  = errors.New("failed to read packet: unexpected flags")
-	errUnexpectedPacketSource = errors.New("failed to read packet: unexpected source")
-	errUnexpectedPacket       = errors.New("failed to read packet: unexpected type or structure")
+	errPacketTooLarge         = errors.New("failed to write packet: exceeds path MTU")
+	errUnexpectedPacketFlags  = newClassError(ErrBadPacket, "failed to read packet: unexpected flags")
+	errUnexpectedPacketSource = newClassError(ErrUnexpectedSource, "failed to read packet: unexpected source")
+	errUnexpectedPacketTTL    = newClassError(ErrBadPacket, "failed to read packet: unexpected TTL")
+	errUnexpectedPacket       = newClassError(ErrBadPacket, "failed to read packet: unexpected type or structure")
+	errUpstreamChanged        = newClassError(ErrBadPacket, "failed to read packet: upstream server changed")
+
+	errNoBroadcast = newClassError(ErrTimeout, "failed to measure clock offset: no broadcast packet received")
+
+	errKoDDeny = newClassError(ErrKoD, "server denied access (kiss-of-death)")
+	errKoDRate = newClassError(ErrKoD, "server requested rate reduction (kiss-of-death)")
 
-	errInvalidPacketAuthenticator = errors.New("invalid authenticator")
+	errInvalidPacketAuthenticator = newClassError(ErrAuthFailed, "invalid authenticator")
 )
+
+// PacketError reports a failure to construct or process a packet, e.g., if
+// the packet could not be serialized.
+type PacketError struct {
+	Op  string
+	Err error
+}
+
+func (e *PacketError) Error() string {
+	return "failed to " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *PacketError) Unwrap() error {
+	return e.Err
+}
+
+// classError assigns err to a class of measurement failures without changing
+// its message.
+type classError struct {
+	class error
+	err   error
+}
+
+func newClassError(class error, msg string) error {
+	return &classError{class: class, err: errors.New(msg)}
+}
+
+// classify assigns err to class unless err is nil or already classified.
+func classify(class, err error) error {
+	if err == nil || class == nil {
+		return err
+	}
+	var cerr *classError
+	if errors.As(err, &cerr) {
+		return err
+	}
+	return &classError{class: class, err: err}
+}
+
+func (e *classError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classError) Is(target error) bool {
+	return target == e.class
+}
+
+func (e *classError) Unwrap() error {
+	return e.err
+}
+
+// noMeasurementsError reports that all measurements of an offset failed. It
+// wraps the error of the first failed measurement.
+type noMeasurementsError struct {
+	err error
+}
+
+func (e *noMeasurementsError) Error() string {
+	return errNoMeasurements.Error() + ": " + e.err.Error()
+}
+
+func (e *noMeasurementsError) Is(target error) bool {
+	return target == errNoMeasurements
+}
+
+func (e *noMeasurementsError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,106 @@
+package client
+
+// Transport-independent parts of measurement exchanges: the timestamps of an
+// exchange are taken from the response, or from the state of the previous
+// exchange in interleaved mode, and are then validated and evaluated the same
+// way regardless of how the packets were carried.
+
+import (
+	"context"
+	"time"
+
+	"example.com/scion-time/base/timemath"
+
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/net/ntp"
+)
+
+// Transport carries the packets of basic mode exchanges for clients that do
+// not process the packets below the NTP layer, see IPTransport,
+// SCIONTransport, and SCIONStreamClient.
+type Transport interface {
+	// Exchange sends req and reads the response into *resp. cTxTime and
+	// cRxTime are the client transmit and receive timestamps.
+	Exchange(ctx context.Context, req []byte, resp *[]byte) (cTxTime, cRxTime time.Time, err error)
+	// Name returns the transport reported in samples, e.g., TransportIP.
+	Name() string
+}
+
+// exchangeTimes are the client transmit (t0), server receive (t1), server
+// transmit (t2), and client receive (t3) timestamps of an exchange.
+type exchangeTimes struct {
+	t0, t1, t2, t3 timemath.FineTime
+}
+
+func basicExchangeTimes(resp *ntp.Packet, cTxTime, cRxTime time.Time) exchangeTimes {
+	return exchangeTimes{
+		t0: timemath.FineTimeOf(cTxTime, 0),
+		t1: ntp.FineTimeFromTime64(resp.ReceiveTime),
+		t2: ntp.FineTimeFromTime64(resp.TransmitTime),
+		t3: timemath.FineTimeOf(cRxTime, 0),
+	}
+}
+
+// interleavedExchangeTimes returns the timestamps of the previous exchange,
+// completed by the server transmit timestamp in resp.
+func interleavedExchangeTimes(resp *ntp.Packet, cTxTime, sRxTime, cRxTime ntp.Time64) exchangeTimes {
+	return exchangeTimes{
+		t0: ntp.FineTimeFromTime64(cTxTime),
+		t1: ntp.FineTimeFromTime64(sRxTime),
+		t2: ntp.FineTimeFromTime64(resp.TransmitTime),
+		t3: ntp.FineTimeFromTime64(cRxTime),
+	}
+}
+
+// evaluate returns the clock offset and round trip delay of the exchange. It
+// fails with an ErrBadPacket error if the timestamps are inconsistent and with
+// errOffsetGate if the offset gate rejects the exchange. The server transmit
+// timestamp is validated only if validateTransmit is set, as in NTPv5.
+func (x exchangeTimes) evaluate(validateTransmit bool) (off, rtd time.Duration, err error) {
+	t2 := x.t1
+	if validateTransmit {
+		t2 = x.t2
+	}
+	err = ntp.ValidateResponseTimestamps(x.t0.Time(), x.t1.Time(), t2.Time(), x.t3.Time())
+	if err != nil {
+		return 0, 0, classify(ErrBadPacket, err)
+	}
+	off = ntp.ClockOffsetFine(x.t0, x.t1, x.t2, x.t3).Duration()
+	rtd = ntp.RoundTripDelayFine(x.t0, x.t1, x.t2, x.t3).Duration()
+	return off, rtd, checkOffsetGate(off, rtd)
+}
+
+// exchangeBasic performs a basic mode client exchange over t and returns the
+// validated response and the timestamps of the exchange.
+func exchangeBasic(ctx context.Context, t Transport) (ntp.Packet, exchangeTimes, error) {
+	var err error
+	ntpreq := ntp.Packet{}
+	ntpreq.SetVersion(ntp.VersionMax)
+	ntpreq.SetMode(ntp.ModeClient)
+	ntpreq.TransmitTime, err = transmitNonce(ctx, timebase.RawNow())
+	if err != nil {
+		return ntp.Packet{}, exchangeTimes{}, err
+	}
+	var buf []byte
+	ntp.EncodePacket(&buf, &ntpreq)
+
+	cTxTime, cRxTime, err := t.Exchange(ctx, buf, &buf)
+	if err != nil {
+		return ntp.Packet{}, exchangeTimes{}, err
+	}
+
+	var ntpresp ntp.Packet
+	err = ntp.DecodePacket(&ntpresp, buf)
+	if err != nil {
+		return ntp.Packet{}, exchangeTimes{}, classify(ErrBadPacket, err)
+	}
+	if !originMatches(ntpresp.OriginTime, ntpreq.TransmitTime) {
+		return ntp.Packet{}, exchangeTimes{}, errUnexpectedPacket
+	}
+	err = ntp.ValidateResponseMetadata(&ntpresp)
+	if err != nil {
+		return ntp.Packet{}, exchangeTimes{}, classify(ErrBadPacket, err)
+	}
+	return ntpresp, basicExchangeTimes(&ntpresp, cTxTime, cRxTime), nil
+}
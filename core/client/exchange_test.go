@@ -0,0 +1,110 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/timebase"
+	"example.com/scion-time/driver/clock"
+	"example.com/scion-time/net/ntp"
+)
+
+// cannedTransport answers each request with the response of a server whose
+// clock is ahead of the local clock by offset, after a round trip delay of
+// delay.
+type cannedTransport struct {
+	offset, delay time.Duration
+	origin        bool
+}
+
+func (t cannedTransport) Exchange(ctx context.Context, req []byte, resp *[]byte) (
+	cTxTime, cRxTime time.Time, err error) {
+	var ntpreq ntp.Packet
+	err = ntp.DecodePacket(&ntpreq, req)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	cTxTime = timebase.Now()
+	cRxTime = cTxTime.Add(t.delay)
+	sTime := cTxTime.Add(t.delay / 2).Add(t.offset)
+
+	var ntpresp ntp.Packet
+	ntpresp.SetVersion(ntp.VersionMax)
+	ntpresp.SetMode(ntp.ModeServer)
+	ntpresp.Stratum = 1
+	if t.origin {
+		ntpresp.OriginTime = ntpreq.TransmitTime
+	}
+	ntpresp.ReceiveTime = ntp.Time64FromTime(sTime)
+	ntpresp.TransmitTime = ntp.Time64FromTime(sTime)
+	ntp.EncodePacket(resp, &ntpresp)
+	return cTxTime, cRxTime, nil
+}
+
+func (t cannedTransport) Name() string {
+	return "canned"
+}
+
+func TestExchangeBasic(t *testing.T) {
+	timebase.RegisterClockIfUnset(&clock.SystemClock{Log: zap.NewNop()})
+
+	tr := cannedTransport{offset: 3 * time.Millisecond, delay: 2 * time.Millisecond, origin: true}
+	off, rtd, err := client.ExchangeBasic(context.Background(), tr)
+	if err != nil {
+		t.Fatalf("ExchangeBasic failed: %v", err)
+	}
+	if d := off - tr.offset; d < -time.Microsecond || d > time.Microsecond {
+		t.Errorf("offset = %v; want %v", off, tr.offset)
+	}
+	if d := rtd - tr.delay; d < -time.Microsecond || d > time.Microsecond {
+		t.Errorf("round trip delay = %v; want %v", rtd, tr.delay)
+	}
+
+	tr.origin = false
+	_, _, err = client.ExchangeBasic(context.Background(), tr)
+	if !errors.Is(err, client.ErrBadPacket) {
+		t.Errorf("ExchangeBasic with unexpected origin: err = %v; want %v", err, client.ErrBadPacket)
+	}
+}
+
+func TestOffsetGateRecovery(t *testing.T) {
+	timebase.RegisterClockIfUnset(&clock.SystemClock{Log: zap.NewNop()})
+
+	client.SetOffsetGate(client.OffsetGate{Fraction: 0.5, Budget: 1 * time.Millisecond})
+	t.Cleanup(client.ClearOffsetGate)
+
+	tr := cannedTransport{offset: 100 * time.Millisecond, delay: 2 * time.Millisecond, origin: true}
+	if _, _, err := client.ExchangeBasic(context.Background(), tr); err != nil {
+		t.Fatalf("ExchangeBasic with unarmed gate failed: %v", err)
+	}
+
+	client.ArmOffsetGate()
+	for i := 0; i < client.OffsetGateMaxRejections; i++ {
+		_, _, err := client.ExchangeBasic(context.Background(), tr)
+		if err == nil {
+			t.Fatalf("ExchangeBasic %d with armed gate succeeded; want rejection", i)
+		}
+	}
+	off, _, err := client.ExchangeBasic(context.Background(), tr)
+	if err != nil {
+		t.Fatalf("ExchangeBasic after consistent rejections failed: %v", err)
+	}
+	if d := off - tr.offset; d < -time.Microsecond || d > time.Microsecond {
+		t.Errorf("offset = %v; want %v", off, tr.offset)
+	}
+
+	// Rearmed after the local clock has been stepped
+	client.ArmOffsetGate()
+	if _, _, err := client.ExchangeBasic(context.Background(), tr); err == nil {
+		t.Error("ExchangeBasic with rearmed gate succeeded; want rejection")
+	}
+	tr.offset = 1 * time.Millisecond
+	if _, _, err := client.ExchangeBasic(context.Background(), tr); err != nil {
+		t.Errorf("ExchangeBasic within gate failed: %v", err)
+	}
+}
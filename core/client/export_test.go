@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/net/ntp"
+)
+
+var TrainOffset = trainOffset
+
+var RotatePaths = rotatePaths
+
+func ExchangeBasic(ctx context.Context, t Transport) (off, rtd time.Duration, err error) {
+	_, x, err := exchangeBasic(ctx, t)
+	if err != nil {
+		return 0, 0, err
+	}
+	return x.evaluate(false)
+}
+
+// NewCalibratedBroadcastClient returns a broadcast client for the packets of
+// the server at serverAddr received on conn, with the one-way delay already
+// calibrated.
+func NewCalibratedBroadcastClient(ctx context.Context, conn *net.UDPConn,
+	serverAddr *net.UDPAddr, key ntp.SymmetricKey, delay time.Duration) *BroadcastClient {
+	c := &BroadcastClient{
+		serverAddr: serverAddr,
+		keys:       ntp.SymmetricKeys{key.ID: key},
+		calibrated: timebase.RawNow(),
+		delay:      delay,
+	}
+	go c.run(ctx, zap.NewNop(), conn)
+	return c
+}
+
+const OffsetGateMaxRejections = offsetGateMaxRejections
+
+// ClearOffsetGate removes the offset gate set by SetOffsetGate.
+func ClearOffsetGate() {
+	offsetGate.Store(nil)
+	offsetGateArmed.Store(false)
+	offsetGateRejections.Store(0)
+}
+
+type DelayMonitor struct {
+	m delayMonitor
+}
+
+func (m *DelayMonitor) Add(now time.Time, off, rtd time.Duration) bool {
+	return m.m.add(now, off, rtd)
+}
+
+func (m *DelayMonitor) Timeout(now time.Time) bool {
+	return m.m.timeout(now)
+}
+
+const (
+	DelayBaselineLen    = delayBaselineLen
+	DelayBaselineMaxAge = delayBaselineMaxAge
+)
+
+var (
+	DecadeBuckets = decadeBuckets
+	NewHistograms = newHistograms
+)
+
+const DiscardReasonDecode = discardReasonDecode
+
+var DecodeDiscardReason = decodeDiscardReason
+
+type Retrier struct {
+	r retrier
+}
+
+func NewRetrier(deadline time.Time) *Retrier {
+	discarded := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "discarded"}, discardReasonLbls)
+	return &Retrier{r: newRetrier(deadline, true, discarded)}
+}
+
+func (r *Retrier) Retry(reason string) bool {
+	return r.r.retry(reason)
+}
+
+func (r *Retrier) Fail(err error) error {
+	return r.r.fail(err)
+}
+
+// CombineWeight returns the weight the filter assigns to a sample with the
+// given bounds, jitter, and trust.
+func CombineWeight(lo, mid, hi timemath.FineDuration, jitter, trust float64) float64 {
+	_, w := combine(lo, mid, hi, jitter, trust)
+	return w
+}
+
+// MedianMeasurement returns the median of offs and the weight of the
+// measurements it is taken from.
+func MedianMeasurement(offs []time.Duration, ws []float64) (time.Duration, float64) {
+	ms := make([]measurement, len(offs))
+	for i := range offs {
+		ms[i] = measurement{off: timemath.FineFromDuration(offs[i]), weight: ws[i]}
+	}
+	m := medianMeasurement(ms)
+	return m.off.Duration(), m.weight
+}
@@ -0,0 +1,112 @@
+package client
+
+// Fault injection for testing the robustness of the clients and of the path
+// selection and filtering logic against lossy or misbehaving networks
+
+import (
+	"math/rand"
+	"net/netip"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/timemath"
+)
+
+// FaultPolicy specifies the probabilities with which packets are dropped,
+// duplicated (outgoing packets only), corrupted, or delayed (incoming packets
+// only) by up to MaxDelay.
+type FaultPolicy struct {
+	Drop      float64
+	Duplicate float64
+	Corrupt   float64
+	Delay     float64
+	MaxDelay  time.Duration
+}
+
+// FaultInjector applies a FaultPolicy using a seedable source of randomness so
+// that fault patterns are reproducible. A nil *FaultInjector injects no
+// faults.
+type FaultInjector struct {
+	policy FaultPolicy
+	mu     sync.Mutex
+	rand   *rand.Rand
+}
+
+func NewFaultInjector(p FaultPolicy, seed int64) *FaultInjector {
+	if p.Drop < 0 || p.Duplicate < 0 || p.Corrupt < 0 || p.Delay < 0 || p.MaxDelay < 0 {
+		panic("invalid fault policy")
+	}
+	return &FaultInjector{
+		policy: p,
+		rand:   rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (f *FaultInjector) chance(p float64) bool {
+	return p != 0 && f.rand.Float64() < p
+}
+
+func (f *FaultInjector) corrupt(b []byte) {
+	if len(b) != 0 {
+		b[f.rand.Intn(len(b))] ^= byte(1 + f.rand.Intn(255))
+	}
+}
+
+// writeTo sends b to addr on conn, subject to the injector's faults. Dropped
+// packets are reported as sent.
+func (f *FaultInjector) writeTo(log *zap.Logger, conn PacketConn, b []byte, addr netip.AddrPort) (
+	int, error) {
+	if f == nil {
+		return conn.WriteToUDPAddrPort(b, addr)
+	}
+	f.mu.Lock()
+	drop := f.chance(f.policy.Drop)
+	dup := f.chance(f.policy.Duplicate)
+	if f.chance(f.policy.Corrupt) {
+		b = append([]byte(nil), b...)
+		f.corrupt(b)
+		log.Debug("injecting fault: corrupting outgoing packet")
+	}
+	f.mu.Unlock()
+	if drop {
+		log.Debug("injecting fault: dropping outgoing packet")
+		return len(b), nil
+	}
+	n, err := conn.WriteToUDPAddrPort(b, addr)
+	if err == nil && dup {
+		log.Debug("injecting fault: duplicating outgoing packet")
+		_, _ = conn.WriteToUDPAddrPort(b, addr)
+	}
+	return n, err
+}
+
+// received applies the injector's faults to the incoming packet in b with
+// receive timestamp *rxt. It reports whether the packet is to be dropped.
+func (f *FaultInjector) received(log *zap.Logger, b []byte, rxt *time.Time) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	drop := f.chance(f.policy.Drop)
+	if f.chance(f.policy.Corrupt) {
+		f.corrupt(b)
+		log.Debug("injecting fault: corrupting incoming packet")
+	}
+	var delay time.Duration
+	if f.policy.MaxDelay != 0 && f.chance(f.policy.Delay) {
+		delay = timemath.Duration(f.rand.Float64() * timemath.Seconds(f.policy.MaxDelay))
+	}
+	f.mu.Unlock()
+	if drop {
+		log.Debug("injecting fault: dropping incoming packet")
+		return true
+	}
+	if delay != 0 {
+		log.Debug("injecting fault: delaying incoming packet", zap.Duration("delay", delay))
+		time.Sleep(delay)
+		*rxt = rxt.Add(delay)
+	}
+	return false
+}
@@ -3,7 +3,7 @@ package client
 import (
 	"math"
 	"sync"
-	"time"
+	"sync/atomic"
 
 	"go.uber.org/zap"
 
@@ -11,9 +11,7 @@ import (
 	"example.com/scion-time/core/timebase"
 )
 
-const (
-	maxNumRetries = 1
-)
+const maxWeight = 1e12
 
 type filterContext struct {
 	epoch          uint64
@@ -22,30 +20,76 @@ type filterContext struct {
 	navg           float64
 }
 
+// Weighting computes the weight of a filtered sample from its round trip
+// delay and from the jitter of the samples of the same reference, both in
+// seconds. Weights are relative; the filter clamps them to at least 1.
+type Weighting func(delay, jitter float64) float64
+
 var (
 	filters   = make(map[string]filterContext)
 	filtersMu = sync.Mutex{}
+
+	weighting atomic.Pointer[Weighting]
 )
 
-func combine(lo, mid, hi time.Duration, trust float64) (offset time.Duration, weight float64) {
+func init() {
+	SetWeighting(DelayWeighting)
+}
+
+// DelayWeighting weights samples by the inverse of half their round trip
+// delay, i.e., the maximum error of the offset due to delay asymmetry.
+func DelayWeighting(delay, jitter float64) float64 {
+	return 2.0 / delay
+}
+
+// SquaredDelayWeighting weights samples by the inverse of the square of half
+// their round trip delay, favoring close references more strongly.
+func SquaredDelayWeighting(delay, jitter float64) float64 {
+	return 4.0 / (delay * delay)
+}
+
+// DispersionWeighting weights samples by the inverse of their dispersion,
+// i.e., half the round trip delay plus the jitter of the reference.
+func DispersionWeighting(delay, jitter float64) float64 {
+	return 1.0 / (delay/2.0 + jitter)
+}
+
+// UniformWeighting weights all samples equally.
+func UniformWeighting(delay, jitter float64) float64 {
+	return 1.0
+}
+
+// SetWeighting sets the weighting of filtered samples, DelayWeighting by
+// default.
+func SetWeighting(w Weighting) {
+	if w == nil {
+		panic("invalid weighting")
+	}
+	weighting.Store(&w)
+}
+
+func combine(lo, mid, hi timemath.FineDuration, jitter, trust float64) (offset timemath.FineDuration, weight float64) {
 	offset = mid
-	weight = 0.001 + trust*2.0/timemath.Seconds(hi-lo)
-	if weight < 1.0 {
+	w := *weighting.Load()
+	weight = 0.001 + trust*w(hi.Sub(lo).Seconds(), jitter)
+	if weight < 1.0 || math.IsNaN(weight) {
 		weight = 1.0
+	} else if weight > maxWeight {
+		weight = maxWeight
 	}
 	return
 }
 
-func filter(log *zap.Logger, reference string, cTxTime, sRxTime, sTxTime, cRxTime time.Time) (
-	offset time.Duration, weight float64) {
+func filter(log *zap.Logger, reference string, cTxTime, sRxTime, sTxTime, cRxTime timemath.FineTime) (
+	offset timemath.FineDuration, weight float64) {
 
 	// Based on Ntimed by Poul-Henning Kamp, https://github.com/bsdphk/Ntimed
 
 	filtersMu.Lock()
 	f := filters[reference]
 
-	lo := timemath.Seconds(cTxTime.Sub(sRxTime))
-	hi := timemath.Seconds(cRxTime.Sub(sTxTime))
+	lo := cTxTime.Sub(sRxTime).Seconds()
+	hi := cRxTime.Sub(sTxTime).Seconds()
 	mid := (lo + hi) / 2
 
 	if f.epoch != timebase.Epoch() {
@@ -107,7 +151,8 @@ func filter(log *zap.Logger, reference string, cTxTime, sRxTime, sTxTime, cRxTim
 
 	trust := 1.0
 
-	offset, weight = combine(timemath.Duration(lo), timemath.Duration(mid), timemath.Duration(hi), trust)
+	jitter := (loNoise + hiNoise) / 2.0
+	offset, weight = combine(timemath.FineFromSeconds(lo), timemath.FineFromSeconds(mid), timemath.FineFromSeconds(hi), jitter, trust)
 
 	log.Debug("filtered response",
 		zap.String("from", reference),
@@ -118,9 +163,9 @@ func filter(log *zap.Logger, reference string, cTxTime, sRxTime, sTxTime, cRxTim
 		zap.Float64("loLim [s]", loLim),
 		zap.Float64("amid [s]", f.amid),
 		zap.Float64("hiLim [s]", hiLim),
-		zap.Float64("offset [s]", timemath.Seconds(offset)),
+		zap.Float64("offset [s]", offset.Seconds()),
 		zap.Float64("weight", weight),
 	)
 
-	return timemath.Inv(offset), weight
+	return offset.Neg(), weight
 }
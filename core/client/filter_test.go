@@ -0,0 +1,80 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/core/client"
+)
+
+func TestWeighting(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		w      client.Weighting
+		delay  float64
+		jitter float64
+		want   float64
+	}{
+		{"delay", client.DelayWeighting, 0.002, 0.0005, 1000},
+		{"delay_squared", client.SquaredDelayWeighting, 0.002, 0.0005, 1e6},
+		{"dispersion", client.DispersionWeighting, 0.002, 0.0005, 1.0 / 0.0015},
+		{"uniform", client.UniformWeighting, 0.002, 0.0005, 1},
+	} {
+		if got := tc.w(tc.delay, tc.jitter); !approxEqual(got, tc.want) {
+			t.Errorf("%s(%v, %v) = %v; want %v", tc.name, tc.delay, tc.jitter, got, tc.want)
+		}
+	}
+}
+
+func TestWeightingOrder(t *testing.T) {
+	// Lower delays must never result in lower weights
+	for _, w := range []client.Weighting{
+		client.DelayWeighting, client.SquaredDelayWeighting, client.DispersionWeighting,
+	} {
+		if w(0.001, 0) <= w(0.01, 0) {
+			t.Errorf("weight of low delay %v not above weight of high delay %v", w(0.001, 0), w(0.01, 0))
+		}
+		if w(0.001, 0) < w(0.001, 0.001) {
+			t.Errorf("weight without jitter %v below weight with jitter %v", w(0.001, 0), w(0.001, 0.001))
+		}
+	}
+}
+
+func TestCombineWeight(t *testing.T) {
+	t.Cleanup(func() {
+		client.SetWeighting(client.DelayWeighting)
+	})
+	bounds := func(delay time.Duration) (lo, mid, hi timemath.FineDuration) {
+		return timemath.FineFromDuration(-delay / 2), timemath.FineDuration{}, timemath.FineFromDuration(delay / 2)
+	}
+	for _, tc := range []struct {
+		name  string
+		w     client.Weighting
+		delay time.Duration
+		want  float64
+	}{
+		{"delay", client.DelayWeighting, 2 * time.Millisecond, 1000.001},
+		{"uniform", client.UniformWeighting, 2 * time.Millisecond, 1.001},
+		// Weights are clamped to at least 1
+		{"low", client.DelayWeighting, 10 * time.Second, 1},
+		{"zero", func(delay, jitter float64) float64 { return 0 }, 2 * time.Millisecond, 1},
+		{"nan", func(delay, jitter float64) float64 { return 0 / delay }, 0, 1},
+		// and to at most 1e12
+		{"high", client.SquaredDelayWeighting, time.Nanosecond, 1e12},
+	} {
+		client.SetWeighting(tc.w)
+		lo, mid, hi := bounds(tc.delay)
+		if got := client.CombineWeight(lo, mid, hi, 0, 1); !approxEqual(got, tc.want) {
+			t.Errorf("%s: weight = %v; want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func approxEqual(x, y float64) bool {
+	d := x - y
+	if d < 0 {
+		d = -d
+	}
+	return d <= 1e-9*y
+}
@@ -0,0 +1,109 @@
+package client
+
+// Histograms of the clock offsets and round trip delays measured per source.
+// Offset buckets are symmetric around zero: each configured bound b yields the
+// buckets -b and b.
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/base/timemath"
+)
+
+var (
+	// DefaultOffsetBuckets range from 100ns to 100ms.
+	DefaultOffsetBuckets = decadeBuckets(100*time.Nanosecond, 100*time.Millisecond)
+	// DefaultDelayBuckets range from 1µs to 1s.
+	DefaultDelayBuckets = decadeBuckets(1*time.Microsecond, 1*time.Second)
+
+	histogramsMu     sync.Mutex
+	histogramsOnce   sync.Once
+	offsetBuckets    = DefaultOffsetBuckets
+	delayBuckets     = DefaultDelayBuckets
+	offsetHistograms *prometheus.HistogramVec
+	delayHistograms  *prometheus.HistogramVec
+)
+
+// decadeBuckets returns the bounds 1, 2, and 5 times the powers of ten from
+// lo up to hi.
+func decadeBuckets(lo, hi time.Duration) []time.Duration {
+	var bs []time.Duration
+	for d := lo; d <= hi; d *= 10 {
+		bs = append(bs, d)
+		if 2*d <= hi {
+			bs = append(bs, 2*d)
+		}
+		if 5*d <= hi {
+			bs = append(bs, 5*d)
+		}
+	}
+	return bs
+}
+
+// SetHistogramBuckets sets the bucket bounds of the offset and delay
+// histograms. Nil slices select the defaults. It must be called before the
+// first measurement.
+func SetHistogramBuckets(offsets, delays []time.Duration) {
+	histogramsMu.Lock()
+	defer histogramsMu.Unlock()
+	if offsetHistograms != nil {
+		panic("histogram buckets set after first measurement")
+	}
+	if offsets == nil {
+		offsets = DefaultOffsetBuckets
+	}
+	if delays == nil {
+		delays = DefaultDelayBuckets
+	}
+	offsetBuckets, delayBuckets = offsets, delays
+}
+
+func seconds(ds []time.Duration) []float64 {
+	xs := make([]float64, len(ds))
+	for i, d := range ds {
+		xs[i] = timemath.Seconds(d)
+	}
+	sort.Float64s(xs)
+	return xs
+}
+
+// newHistograms returns unregistered offset and delay histograms with the
+// bucket bounds offsets and delays.
+func newHistograms(offsets, delays []time.Duration) (*prometheus.HistogramVec, *prometheus.HistogramVec) {
+	bs := seconds(offsets)
+	obs := make([]float64, 0, 2*len(bs))
+	for i := len(bs) - 1; i >= 0; i-- {
+		obs = append(obs, -bs[i])
+	}
+	obs = append(obs, bs...)
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    metrics.ClientOffsetsN,
+			Help:    metrics.ClientOffsetsH,
+			Buckets: obs,
+		}, []string{"source"}),
+		prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    metrics.ClientRoundTripDelaysN,
+			Help:    metrics.ClientRoundTripDelaysH,
+			Buckets: seconds(delays),
+		}, []string{"source"})
+}
+
+func initHistograms() {
+	histogramsMu.Lock()
+	defer histogramsMu.Unlock()
+	offsetHistograms, delayHistograms = newHistograms(offsetBuckets, delayBuckets)
+	prometheus.MustRegister(offsetHistograms, delayHistograms)
+}
+
+// observeSample records the clock offset off and round trip delay rtd
+// measured with source.
+func observeSample(source string, off, rtd time.Duration) {
+	histogramsOnce.Do(initHistograms)
+	offsetHistograms.WithLabelValues(source).Observe(timemath.Seconds(off))
+	delayHistograms.WithLabelValues(source).Observe(timemath.Seconds(rtd))
+}
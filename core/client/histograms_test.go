@@ -0,0 +1,57 @@
+package client_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"example.com/scion-time/core/client"
+)
+
+func TestDecadeBuckets(t *testing.T) {
+	bs := client.DecadeBuckets(100*time.Nanosecond, 1*time.Microsecond)
+	want := []time.Duration{100 * time.Nanosecond, 200 * time.Nanosecond, 500 * time.Nanosecond, 1 * time.Microsecond}
+	if !reflect.DeepEqual(bs, want) {
+		t.Errorf("DecadeBuckets = %v; want %v", bs, want)
+	}
+}
+
+func histogram(t *testing.T, h *prometheus.HistogramVec, source string) *dto.Histogram {
+	var m dto.Metric
+	err := h.WithLabelValues(source).(prometheus.Metric).Write(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram()
+}
+
+func TestHistograms(t *testing.T) {
+	offs, delays := client.NewHistograms(
+		[]time.Duration{10 * time.Microsecond, 1 * time.Microsecond},
+		[]time.Duration{1 * time.Millisecond})
+	offs.WithLabelValues("a").Observe(-5e-6)
+	offs.WithLabelValues("a").Observe(0.5e-6)
+	delays.WithLabelValues("a").Observe(2e-3)
+
+	oh := histogram(t, offs, "a")
+	wantBounds := []float64{-10e-6, -1e-6, 1e-6, 10e-6}
+	wantCounts := []uint64{0, 1, 2, 2}
+	if len(oh.Bucket) != len(wantBounds) {
+		t.Fatalf("offset histogram has %d buckets; want %d", len(oh.Bucket), len(wantBounds))
+	}
+	for i, b := range oh.Bucket {
+		if b.GetUpperBound() != wantBounds[i] || b.GetCumulativeCount() != wantCounts[i] {
+			t.Errorf("offset bucket %d = (%v, %d); want (%v, %d)",
+				i, b.GetUpperBound(), b.GetCumulativeCount(), wantBounds[i], wantCounts[i])
+		}
+	}
+
+	dh := histogram(t, delays, "a")
+	if len(dh.Bucket) != 1 || dh.Bucket[0].GetCumulativeCount() != 0 || dh.GetSampleCount() != 1 {
+		t.Errorf("delay histogram = %v; want one sample above 1ms", dh)
+	}
+}
@@ -0,0 +1,38 @@
+package client
+
+// Transmit timestamp nonces for basic mode requests: the low-order bits of the
+// transmit timestamp are randomized and responses must echo the timestamp in
+// their origin timestamp, which makes unauthenticated exchanges harder to
+// spoof for off-path attackers. Offsets are always computed from the locally
+// recorded transmit time, never from the nonce.
+
+import (
+	"context"
+	"crypto/subtle"
+	"time"
+
+	"example.com/scion-time/base/crypto"
+	"example.com/scion-time/net/ntp"
+)
+
+// Randomized bits of the transmit timestamp fraction, i.e., everything below
+// 2^-8 s. The remaining bits keep the timestamp plausible for middleboxes and
+// servers which inspect it.
+const nonceMask = 1<<24 - 1
+
+func transmitNonce(ctx context.Context, t time.Time) (ntp.Time64, error) {
+	n, err := crypto.RandIntn(ctx, nonceMask+1)
+	if err != nil {
+		return ntp.Time64{}, err
+	}
+	ts := ntp.Time64FromTime(t)
+	ts.Fraction = ts.Fraction&^nonceMask | uint32(n)
+	return ts, nil
+}
+
+// originMatches reports whether the origin timestamp of a response matches
+// timestamp t of the corresponding request in constant time.
+func originMatches(origin, t ntp.Time64) bool {
+	return subtle.ConstantTimeEq(int32(origin.Seconds), int32(t.Seconds))&
+		subtle.ConstantTimeEq(int32(origin.Fraction), int32(t.Fraction)) == 1
+}
@@ -0,0 +1,157 @@
+package client
+
+// Path diversity of consecutive measurements to the same peer: network
+// elements that balance load over several links, e.g., by hashing the flow ID
+// of SCION packets, are only sampled uniformly if consecutive measurements
+// vary their path and flow ID. Clients in interleaved mode may keep their path
+// and flow ID since the interleaved state of an exchange refers to the path of
+// the previous exchange.
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/scionproto/scion/pkg/snet"
+
+	"example.com/scion-time/base/crypto"
+
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/net/udp"
+)
+
+const maxFlowID = 1<<20 - 1
+
+// PathDiversity configures the paths and flow IDs of consecutive
+// measurements to the same peer.
+type PathDiversity struct {
+	RotatePaths    bool // measure the paths to a peer in turn instead of at random
+	RotateFlowIDs  bool // use a random flow ID for each request
+	PinInterleaved bool // keep the path and flow ID of clients in interleaved mode
+}
+
+var (
+	diversity atomic.Pointer[PathDiversity]
+
+	rotationsMu sync.Mutex
+	rotations   = make(map[string]int)
+)
+
+func init() {
+	diversity.Store(&PathDiversity{})
+}
+
+// SetPathDiversity configures the paths and flow IDs used by SCION clients.
+func SetPathDiversity(d PathDiversity) {
+	diversity.Store(&d)
+}
+
+func pathDiversity() PathDiversity {
+	return *diversity.Load()
+}
+
+// nextFlowID returns the flow ID of a new request.
+func nextFlowID(ctx context.Context) (uint32, error) {
+	if !pathDiversity().RotateFlowIDs {
+		return 0, nil
+	}
+	x, err := crypto.RandIntn(ctx, maxFlowID)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(x) + 1, nil
+}
+
+// rotatePaths returns n of the paths ps to the peer identified by key,
+// continuing with the paths following those of the previous call.
+func rotatePaths(key string, ps []snet.Path, n int) []snet.Path {
+	if n > len(ps) {
+		n = len(ps)
+	}
+	if n == 0 {
+		return nil
+	}
+	fps := make([]string, len(ps))
+	idx := make([]int, len(ps))
+	for i, p := range ps {
+		fps[i] = snet.Fingerprint(p).String()
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool {
+		return fps[idx[i]] < fps[idx[j]]
+	})
+	rotationsMu.Lock()
+	start := rotations[key] % len(ps)
+	rotations[key] = start + n
+	rotationsMu.Unlock()
+	sps := make([]snet.Path, n)
+	for i := 0; i != n; i++ {
+		sps[i] = ps[idx[(start+i)%len(ps)]]
+	}
+	return sps
+}
+
+// selectPaths selects a path among ps for each of the clients ntpcs. Clients
+// with interleaved mode state on one of the paths keep this path if
+// PinInterleaved is set; the remaining clients are assigned further paths in
+// turn if RotatePaths is set, and at random otherwise.
+func selectPaths(ctx context.Context, ntpcs []*SCIONClient, localAddr, remoteAddr udp.UDPAddr,
+	ps []snet.Path) ([]snet.Path, []*SCIONClient, error) {
+	d := pathDiversity()
+	var pinned []snet.Path
+	var pinnedcs, others []*SCIONClient
+	used := make(map[snet.PathFingerprint]bool)
+	for _, c := range ntpcs {
+		if d.PinInterleaved {
+			if p, ok := c.interleavedPath(localAddr, remoteAddr, ps, used); ok {
+				used[snet.Fingerprint(p)] = true
+				pinned = append(pinned, p)
+				pinnedcs = append(pinnedcs, c)
+				continue
+			}
+		}
+		others = append(others, c)
+	}
+	var rest []snet.Path
+	for _, p := range ps {
+		if !used[snet.Fingerprint(p)] {
+			rest = append(rest, p)
+		}
+	}
+	var sps []snet.Path
+	if d.RotatePaths {
+		sps = rotatePaths(localAddr.String()+" "+remoteAddr.String(), rest, len(others))
+	} else {
+		sps = make([]snet.Path, len(others))
+		n, err := crypto.Sample(ctx, len(sps), len(rest), func(dst, src int) {
+			sps[dst] = rest[src]
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		sps = sps[:n]
+	}
+	return append(pinned, sps...), append(pinnedcs, others[:len(sps)]...), nil
+}
+
+// interleavedPath returns the path among ps, except those in used, on which
+// c has valid interleaved mode state for the exchange with remoteAddr.
+func (c *SCIONClient) interleavedPath(localAddr, remoteAddr udp.UDPAddr, ps []snet.Path,
+	used map[snet.PathFingerprint]bool) (snet.Path, bool) {
+	if !c.InterleavedMode {
+		return nil, false
+	}
+	now := timebase.RawNow()
+	for _, p := range ps {
+		if used[snet.Fingerprint(p)] {
+			continue
+		}
+		s, ok := c.interleavedState(scionInterleavedKey(localAddr, remoteAddr, p))
+		if ok && interleavedStateValid(now, s.cTxTime) {
+			return p, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,50 @@
+package client_test
+
+import (
+	"testing"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/private/common"
+	"github.com/scionproto/scion/pkg/snet"
+	"github.com/scionproto/scion/pkg/snet/path"
+
+	"example.com/scion-time/core/client"
+)
+
+func TestRotatePaths(t *testing.T) {
+	ia := addr.MustIAFrom(1, 0xff0000000110)
+	var ps []snet.Path
+	for i := 1; i <= 3; i++ {
+		ps = append(ps, path.Path{
+			Src:           ia,
+			Dst:           ia,
+			DataplanePath: path.Empty{},
+			Meta: snet.PathMetadata{
+				Interfaces: []snet.PathInterface{{IA: ia, ID: common.IFIDType(i)}},
+			},
+		})
+	}
+
+	n := make(map[snet.PathFingerprint]int)
+	for i := 0; i != 3; i++ {
+		sps := client.RotatePaths(t.Name(), ps, 2)
+		if len(sps) != 2 {
+			t.Fatalf("RotatePaths returned %d paths; want 2", len(sps))
+		}
+		if snet.Fingerprint(sps[0]) == snet.Fingerprint(sps[1]) {
+			t.Errorf("RotatePaths returned the same path twice")
+		}
+		for _, p := range sps {
+			n[snet.Fingerprint(p)]++
+		}
+	}
+	for _, p := range ps {
+		if n[snet.Fingerprint(p)] != 2 {
+			t.Errorf("path %v measured %d times; want 2", snet.Fingerprint(p), n[snet.Fingerprint(p)])
+		}
+	}
+
+	if sps := client.RotatePaths(t.Name(), ps, 5); len(sps) != len(ps) {
+		t.Errorf("RotatePaths returned %d paths; want %d", len(sps), len(ps))
+	}
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/scionproto/scion/pkg/snet"
+
+	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/base/timemath"
+)
+
+const (
+	pathStatsWindow  = 64
+	pathStatsMaxIdle = 1 * time.Hour
+)
+
+type pathStatsKey struct {
+	peer string
+	fp   snet.PathFingerprint
+}
+
+type pathStatsItem struct {
+	delays  [pathStatsWindow]time.Duration
+	offsets [pathStatsWindow]time.Duration
+	len     int
+	next    int
+	n       uint64
+	updated time.Time
+}
+
+type PathStats struct {
+	Peer         string        `json:"peer"`
+	Path         string        `json:"path"`
+	NumSamples   uint64        `json:"num_samples"`
+	MinDelay     time.Duration `json:"min_delay_ns"`
+	MedianDelay  time.Duration `json:"median_delay_ns"`
+	OffsetStdDev time.Duration `json:"offset_stddev_ns"`
+}
+
+var (
+	pathStatsMu  sync.Mutex
+	pathStats    = make(map[pathStatsKey]*pathStatsItem)
+	pathMetrics  = newPathStatsMetrics()
+	pathStatsLbl = []string{"peer", "path"}
+)
+
+type pathStatsMetrics struct {
+	samples      *prometheus.GaugeVec
+	minDelay     *prometheus.GaugeVec
+	medianDelay  *prometheus.GaugeVec
+	offsetStdDev *prometheus.GaugeVec
+}
+
+func newPathStatsMetrics() *pathStatsMetrics {
+	return &pathStatsMetrics{
+		samples: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: metrics.SCIONClientPathSamplesN,
+			Help: metrics.SCIONClientPathSamplesH,
+		}, pathStatsLbl),
+		minDelay: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: metrics.SCIONClientPathMinDelayN,
+			Help: metrics.SCIONClientPathMinDelayH,
+		}, pathStatsLbl),
+		medianDelay: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: metrics.SCIONClientPathMedianDelayN,
+			Help: metrics.SCIONClientPathMedianDelayH,
+		}, pathStatsLbl),
+		offsetStdDev: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: metrics.SCIONClientPathOffsetStdDevN,
+			Help: metrics.SCIONClientPathOffsetStdDevH,
+		}, pathStatsLbl),
+	}
+}
+
+func (it *pathStatsItem) stats(k pathStatsKey) PathStats {
+	s := PathStats{
+		Peer:       k.peer,
+		Path:       k.fp.String(),
+		NumSamples: it.n,
+	}
+	if it.len == 0 {
+		return s
+	}
+	ds := make([]time.Duration, it.len)
+	copy(ds, it.delays[:it.len])
+	s.MedianDelay = timemath.Median(ds)
+	s.MinDelay = ds[0]
+	var sum, sumsq float64
+	for i := 0; i != it.len; i++ {
+		o := timemath.Seconds(it.offsets[i])
+		sum += o
+		sumsq += o * o
+	}
+	n := float64(it.len)
+	v := sumsq/n - (sum/n)*(sum/n)
+	if v > 0 {
+		s.OffsetStdDev = timemath.Duration(math.Sqrt(v))
+	}
+	return s
+}
+
+func recordPathStats(peer string, p snet.Path, off, rtd time.Duration) {
+	now := time.Now()
+	k := pathStatsKey{peer: peer, fp: snet.Fingerprint(p)}
+
+	pathStatsMu.Lock()
+	defer pathStatsMu.Unlock()
+
+	for x, it := range pathStats {
+		if now.Sub(it.updated) > pathStatsMaxIdle {
+			delete(pathStats, x)
+			lbls := prometheus.Labels{"peer": x.peer, "path": x.fp.String()}
+			pathMetrics.samples.Delete(lbls)
+			pathMetrics.minDelay.Delete(lbls)
+			pathMetrics.medianDelay.Delete(lbls)
+			pathMetrics.offsetStdDev.Delete(lbls)
+		}
+	}
+
+	it, ok := pathStats[k]
+	if !ok {
+		it = &pathStatsItem{}
+		pathStats[k] = it
+	}
+	it.delays[it.next] = rtd
+	it.offsets[it.next] = off
+	it.next = (it.next + 1) % len(it.delays)
+	if it.len != len(it.delays) {
+		it.len++
+	}
+	it.n++
+	it.updated = now
+
+	s := it.stats(k)
+	lbls := prometheus.Labels{"peer": s.Peer, "path": s.Path}
+	pathMetrics.samples.With(lbls).Set(float64(s.NumSamples))
+	pathMetrics.minDelay.With(lbls).Set(timemath.Seconds(s.MinDelay))
+	pathMetrics.medianDelay.With(lbls).Set(timemath.Seconds(s.MedianDelay))
+	pathMetrics.offsetStdDev.With(lbls).Set(timemath.Seconds(s.OffsetStdDev))
+}
+
+// PathStatistics returns a snapshot of the per path measurement statistics,
+// ordered by peer and by median round trip delay.
+func PathStatistics() []PathStats {
+	pathStatsMu.Lock()
+	ss := make([]PathStats, 0, len(pathStats))
+	for k, it := range pathStats {
+		ss = append(ss, it.stats(k))
+	}
+	pathStatsMu.Unlock()
+	sort.Slice(ss, func(i, j int) bool {
+		if ss[i].Peer != ss[j].Peer {
+			return ss[i].Peer < ss[j].Peer
+		}
+		return ss[i].MedianDelay < ss[j].MedianDelay
+	})
+	return ss
+}
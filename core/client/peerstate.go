@@ -0,0 +1,242 @@
+package client
+
+// State of the clients of a peer that is persisted across restarts of the
+// daemon: the last accepted sample and upstream source, the interleaved mode
+// state of SCION clients while it is still fresh, and the delay statistics of
+// the paths to the peer. Peers only become reachable again with a fresh
+// sample.
+
+import (
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"github.com/scionproto/scion/pkg/snet"
+
+	"example.com/scion-time/core/timebase"
+	"example.com/scion-time/net/ntp"
+)
+
+// PeerState is the persisted state of the clients of a peer. Source is only
+// set if the peer was reachable.
+type PeerState struct {
+	Source      *Source            `json:"source,omitempty"`
+	Sample      *Sample            `json:"sample,omitempty"`
+	Interleaved []InterleavedState `json:"interleaved,omitempty"`
+	Paths       []PathState        `json:"paths,omitempty"`
+}
+
+// InterleavedState is the interleaved mode state of an exchange identified by
+// Key, see SCIONClient.
+type InterleavedState struct {
+	Key     string `json:"key"`
+	CTxTime uint64 `json:"ctx_time"`
+	CRxTime uint64 `json:"crx_time"`
+	SRxTime uint64 `json:"srx_time"`
+	FlowID  uint32 `json:"flow_id,omitempty"`
+	Stratum uint8  `json:"stratum"`
+	RefID   uint32 `json:"refid"`
+}
+
+// PathState holds the most recent round trip delays and offsets measured via
+// the path with the hex encoded fingerprint Path, oldest first.
+type PathState struct {
+	Path    string          `json:"path"`
+	Delays  []time.Duration `json:"delays_ns"`
+	Offsets []time.Duration `json:"offsets_ns"`
+}
+
+// PeerStateKeeper is implemented by reference clocks whose state may be
+// persisted across restarts.
+type PeerStateKeeper interface {
+	PeerState() PeerState
+	RestorePeerState(s PeerState)
+}
+
+func time64(x uint64) ntp.Time64 {
+	return ntp.Time64{Seconds: uint32(x >> 32), Fraction: uint32(x)}
+}
+
+func uint64FromTime64(t ntp.Time64) uint64 {
+	return uint64(t.Seconds)<<32 | uint64(t.Fraction)
+}
+
+// restoreSample restores the last sample, tagged as restored, and source of a
+// client unless it has accepted a more recent sample in the meantime.
+func restoreSample(sample *atomic.Pointer[Sample], source *sourceValue, s PeerState) {
+	if s.Sample == nil {
+		return
+	}
+	x := *s.Sample
+	x.Restored = true
+	for {
+		y := sample.Load()
+		if y != nil && !y.Time.Before(x.Time) {
+			return
+		}
+		if sample.CompareAndSwap(y, &x) {
+			break
+		}
+	}
+	if s.Source != nil {
+		source.store(*s.Source)
+	}
+}
+
+// PeerState returns the last sample and source of the client.
+func (c *IPClient) PeerState() PeerState {
+	var s PeerState
+	if x, ok := c.LastSample(); ok {
+		s.Sample = &x
+	}
+	if x, ok := c.Source(); ok {
+		s.Source = &x
+	}
+	return s
+}
+
+// RestorePeerState restores the last sample and source of the client. The
+// interleaved mode state of IP clients is not persisted.
+func (c *IPClient) RestorePeerState(s PeerState) {
+	restoreSample(&c.sample, &c.source, s)
+}
+
+// PeerState returns the last sample and source of the client and its valid
+// interleaved mode states.
+func (c *SCIONClient) PeerState() PeerState {
+	var s PeerState
+	if x, ok := c.LastSample(); ok {
+		s.Sample = &x
+	}
+	if x, ok := c.Source(); ok {
+		s.Source = &x
+	}
+	now := timebase.RawNow()
+	c.mu.Lock()
+	for k, x := range c.prev {
+		if interleavedStateValid(now, x.cTxTime) {
+			s.Interleaved = append(s.Interleaved, InterleavedState{
+				Key:     k,
+				CTxTime: uint64FromTime64(x.cTxTime),
+				CRxTime: uint64FromTime64(x.cRxTime),
+				SRxTime: uint64FromTime64(x.sRxTime),
+				FlowID:  x.flowID,
+				Stratum: x.upstream.stratum,
+				RefID:   x.upstream.refID,
+			})
+		}
+	}
+	c.mu.Unlock()
+	return s
+}
+
+// RestorePeerState restores the last sample and source of the client and
+// those interleaved mode states of s that are still valid and not superseded
+// by a more recent exchange.
+func (c *SCIONClient) RestorePeerState(s PeerState) {
+	restoreSample(&c.sample, &c.source, s)
+	if !c.InterleavedMode {
+		return
+	}
+	now := timebase.RawNow()
+	for _, x := range s.Interleaved {
+		if x.FlowID > maxFlowID || !interleavedStateValid(now, time64(x.CTxTime)) {
+			continue
+		}
+		if _, ok := c.interleavedState(x.Key); ok {
+			continue
+		}
+		c.storeInterleavedState(x.Key, scionInterleavedState{
+			cTxTime:  time64(x.CTxTime),
+			cRxTime:  time64(x.CRxTime),
+			sRxTime:  time64(x.SRxTime),
+			flowID:   x.FlowID,
+			upstream: upstream{stratum: x.Stratum, refID: x.RefID},
+		})
+	}
+}
+
+func pathFingerprint(s string) (snet.PathFingerprint, bool) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return "", false
+	}
+	return snet.PathFingerprint(b), true
+}
+
+// PathStates returns the delay statistics of the paths to peer.
+func PathStates(peer string) []PathState {
+	pathStatsMu.Lock()
+	defer pathStatsMu.Unlock()
+	var ss []PathState
+	for k, it := range pathStats {
+		if k.peer != peer {
+			continue
+		}
+		s := PathState{
+			Path:    k.fp.String(),
+			Delays:  make([]time.Duration, it.len),
+			Offsets: make([]time.Duration, it.len),
+		}
+		for i := 0; i != it.len; i++ {
+			j := (it.next - it.len + i + len(it.delays)) % len(it.delays)
+			s.Delays[i] = it.delays[j]
+			s.Offsets[i] = it.offsets[j]
+		}
+		ss = append(ss, s)
+	}
+	return ss
+}
+
+// RestorePathStates restores the delay statistics of the paths to peer for
+// which no measurements have been recorded yet.
+func RestorePathStates(peer string, ss []PathState) {
+	now := time.Now()
+	pathStatsMu.Lock()
+	defer pathStatsMu.Unlock()
+	for _, s := range ss {
+		fp, ok := pathFingerprint(s.Path)
+		if !ok || len(s.Delays) != len(s.Offsets) {
+			continue
+		}
+		k := pathStatsKey{peer: peer, fp: fp}
+		if _, ok := pathStats[k]; ok {
+			continue
+		}
+		it := &pathStatsItem{updated: now}
+		for i := range s.Delays {
+			it.delays[it.next] = s.Delays[i]
+			it.offsets[it.next] = s.Offsets[i]
+			it.next = (it.next + 1) % len(it.delays)
+			if it.len != len(it.delays) {
+				it.len++
+			}
+			it.n++
+		}
+		pathStats[k] = it
+	}
+}
+
+// RestorePathStates seeds the probe statistics of the selector with the
+// delays of ss so that paths known to perform well are preferred before they
+// have been probed again.
+func (s *PathSelector) RestorePathStates(ss []PathState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, x := range ss {
+		fp, ok := pathFingerprint(x.Path)
+		if !ok {
+			continue
+		}
+		if _, ok := s.stats[fp]; ok {
+			continue
+		}
+		st := &pathProbeStats{}
+		for _, d := range x.Delays {
+			st.add(d)
+		}
+		if st.len != 0 {
+			s.stats[fp] = st
+		}
+	}
+}
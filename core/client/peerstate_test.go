@@ -0,0 +1,77 @@
+package client_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/timebase"
+	"example.com/scion-time/driver/clock"
+)
+
+func TestRestorePathStates(t *testing.T) {
+	const peer = "1-ff00:0:110,127.0.0.1:123"
+	ss := []client.PathState{{
+		Path:    "0123456789abcdef",
+		Delays:  []time.Duration{3 * time.Millisecond, 1 * time.Millisecond, 2 * time.Millisecond},
+		Offsets: []time.Duration{10 * time.Microsecond, 20 * time.Microsecond, 30 * time.Microsecond},
+	}, {
+		Path: "not hex",
+	}}
+	client.RestorePathStates(peer, ss)
+
+	rs := client.PathStates(peer)
+	if len(rs) != 1 {
+		t.Fatalf("PathStates returned %d paths; want 1", len(rs))
+	}
+	if rs[0].Path != ss[0].Path {
+		t.Errorf("PathStates returned path %s; want %s", rs[0].Path, ss[0].Path)
+	}
+	for i := range ss[0].Delays {
+		if rs[0].Delays[i] != ss[0].Delays[i] || rs[0].Offsets[i] != ss[0].Offsets[i] {
+			t.Errorf("PathStates returned %v, %v; want %v, %v",
+				rs[0].Delays, rs[0].Offsets, ss[0].Delays, ss[0].Offsets)
+			break
+		}
+	}
+
+	for _, s := range client.PathStatistics() {
+		if s.Peer == peer && s.MinDelay != 1*time.Millisecond {
+			t.Errorf("restored min delay = %v; want %v", s.MinDelay, 1*time.Millisecond)
+		}
+	}
+}
+
+func TestRestorePeerState(t *testing.T) {
+	timebase.RegisterClockIfUnset(&clock.SystemClock{Log: zap.NewNop()})
+
+	c := &client.SCIONClient{InterleavedMode: true}
+	now := time.Now()
+	s := client.PeerState{
+		Source: &client.Source{Stratum: 2, RefID: 0x01020304},
+		Sample: &client.Sample{Time: now, Offset: 5 * time.Millisecond, Transport: client.TransportSCION},
+	}
+	c.RestorePeerState(s)
+	want := *s.Sample
+	want.Restored = true
+	x, ok := c.LastSample()
+	if !ok || !reflect.DeepEqual(x, want) {
+		t.Errorf("LastSample() = %v, %v; want %v, true", x, ok, want)
+	}
+	src, ok := c.Source()
+	if !ok || src != *s.Source {
+		t.Errorf("Source() = %v, %v; want %v, true", src, ok, *s.Source)
+	}
+
+	old := client.PeerState{
+		Sample: &client.Sample{Time: now.Add(-time.Minute), Offset: time.Second},
+	}
+	c.RestorePeerState(old)
+	x, _ = c.LastSample()
+	if !reflect.DeepEqual(x, want) {
+		t.Errorf("RestorePeerState replaced a more recent sample with %v", x)
+	}
+}
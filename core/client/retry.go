@@ -0,0 +1,139 @@
+package client
+
+// Retry budget of the receive loops: a measurement discards unexpected,
+// malformed, or unauthenticated packets until its budget is exhausted, so that
+// a flood of such packets fails the measurement early instead of occupying it
+// until the deadline. Optionally, each read is bounded by its own deadline.
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/net/ntp"
+)
+
+// RetryBudget bounds the receive loop of a measurement.
+type RetryBudget struct {
+	// MaxRetries is the number of failed reads and discarded packets after
+	// which a measurement fails.
+	MaxRetries int
+	// AttemptTimeout bounds each read, in addition to the deadline of the
+	// measurement, if not 0.
+	AttemptTimeout time.Duration
+}
+
+// DefaultMaxRetries is the number of retries per measurement by default.
+const DefaultMaxRetries = 1
+
+// Reasons for discarding received packets.
+const (
+	discardReasonAuth       = "auth"
+	discardReasonDecode     = "decode"
+	discardReasonFlags      = "flags"
+	discardReasonMalformed  = "malformed"
+	discardReasonRead       = "read"
+	discardReasonSource     = "source"
+	discardReasonTTL        = "ttl"
+	discardReasonUnexpected = "unexpected"
+)
+
+var (
+	retryBudget atomic.Pointer[RetryBudget]
+
+	discardReasonLbls = []string{"reason"}
+
+	discardReasonClasses = map[string]error{
+		discardReasonAuth:       ErrAuthFailed,
+		discardReasonDecode:     ErrBadPacket,
+		discardReasonFlags:      ErrBadPacket,
+		discardReasonMalformed:  ErrBadPacket,
+		discardReasonSource:     ErrUnexpectedSource,
+		discardReasonTTL:        ErrBadPacket,
+		discardReasonUnexpected: ErrBadPacket,
+	}
+)
+
+func init() {
+	retryBudget.Store(&RetryBudget{MaxRetries: DefaultMaxRetries})
+}
+
+// SetRetryBudget sets the retry budget of subsequent measurements.
+func SetRetryBudget(b RetryBudget) {
+	if b.MaxRetries < 0 || b.AttemptTimeout < 0 {
+		panic("invalid retry budget")
+	}
+	retryBudget.Store(&b)
+}
+
+type retrier struct {
+	budget        RetryBudget
+	numRetries    int
+	reason        string
+	deadline      time.Time
+	deadlineIsSet bool
+	discarded     *prometheus.CounterVec
+}
+
+func newRetrier(deadline time.Time, deadlineIsSet bool, discarded *prometheus.CounterVec) retrier {
+	return retrier{
+		budget:        *retryBudget.Load(),
+		deadline:      deadline,
+		deadlineIsSet: deadlineIsSet,
+		discarded:     discarded,
+	}
+}
+
+// prepareRead sets the deadline of the next read on conn if reads are bounded
+// by an attempt timeout.
+func (r *retrier) prepareRead(conn interface{ SetDeadline(time.Time) error }) error {
+	if r.budget.AttemptTimeout == 0 {
+		return nil
+	}
+	t := timebase.RawNow().Add(r.budget.AttemptTimeout)
+	if r.deadlineIsSet && r.deadline.Before(t) {
+		t = r.deadline
+	}
+	return conn.SetDeadline(t)
+}
+
+// retry records a failed read or discarded packet and reports whether the
+// measurement may continue to receive.
+func (r *retrier) retry(reason string) bool {
+	r.discarded.WithLabelValues(reason).Inc()
+	r.reason = reason
+	if r.numRetries == r.budget.MaxRetries ||
+		!r.deadlineIsSet || !timebase.RawNow().Before(r.deadline) {
+		return false
+	}
+	r.numRetries++
+	return true
+}
+
+// decodeDiscardReason returns the reason for discarding a packet that failed
+// to decode with err. Structurally malformed packets, see ntp.FormatError, are
+// told apart from packets that are well-formed but unexpected.
+func decodeDiscardReason(err error) string {
+	var ferr *ntp.FormatError
+	if errors.As(err, &ferr) {
+		return discardReasonMalformed
+	}
+	return discardReasonDecode
+}
+
+// fail assigns err, the cause of the last retry, to its class of measurement
+// failures.
+func (r *retrier) fail(err error) error {
+	if r.reason == discardReasonRead {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return classify(ErrTimeout, err)
+		}
+		return err
+	}
+	return classify(discardReasonClasses[r.reason], err)
+}
@@ -0,0 +1,84 @@
+package client_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/driver/clock"
+
+	"example.com/scion-time/net/ntp"
+)
+
+var errTestDecode = errors.New("decode failed")
+
+func TestRetryBudget(t *testing.T) {
+	timebase.RegisterClockIfUnset(&clock.SystemClock{Log: zap.NewNop()})
+	t.Cleanup(func() {
+		client.SetRetryBudget(client.RetryBudget{MaxRetries: client.DefaultMaxRetries})
+	})
+	for _, tc := range []struct {
+		maxRetries int
+		deadline   time.Duration
+		want       int
+	}{
+		{maxRetries: client.DefaultMaxRetries, deadline: time.Minute, want: client.DefaultMaxRetries},
+		{maxRetries: 0, deadline: time.Minute, want: 0},
+		{maxRetries: 3, deadline: time.Minute, want: 3},
+		{maxRetries: 3, deadline: -time.Second, want: 0},
+	} {
+		client.SetRetryBudget(client.RetryBudget{MaxRetries: tc.maxRetries})
+		r := client.NewRetrier(timebase.RawNow().Add(tc.deadline))
+		n := 0
+		for r.Retry(client.DiscardReasonDecode) {
+			n++
+			if n > tc.maxRetries {
+				break
+			}
+		}
+		if n != tc.want {
+			t.Errorf("MaxRetries %d, deadline %v: %d retries; want %d",
+				tc.maxRetries, tc.deadline, n, tc.want)
+		}
+		err := r.Fail(errTestDecode)
+		if !errors.Is(err, client.ErrBadPacket) || !errors.Is(err, errTestDecode) {
+			t.Errorf("MaxRetries %d: Fail = %v; want %v classified as %v",
+				tc.maxRetries, err, errTestDecode, client.ErrBadPacket)
+		}
+	}
+}
+
+func TestSetRetryBudgetInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("SetRetryBudget accepted a negative budget")
+		}
+	}()
+	client.SetRetryBudget(client.RetryBudget{MaxRetries: -1})
+}
+
+func TestDecodeDiscardReason(t *testing.T) {
+	timebase.RegisterClockIfUnset(&clock.SystemClock{Log: zap.NewNop()})
+
+	var pkt ntp.Packet
+	err := ntp.DecodePacket(&pkt, make([]byte, ntp.PacketLen-1))
+	if reason := client.DecodeDiscardReason(err); reason == client.DiscardReasonDecode {
+		t.Errorf("DecodeDiscardReason(%v) = %q; want malformed", err, reason)
+	}
+	if reason := client.DecodeDiscardReason(errTestDecode); reason != client.DiscardReasonDecode {
+		t.Errorf("DecodeDiscardReason(%v) = %q; want %q", errTestDecode, reason, client.DiscardReasonDecode)
+	}
+
+	r := client.NewRetrier(timebase.RawNow().Add(time.Second))
+	r.Retry(client.DecodeDiscardReason(err))
+	err = r.Fail(err)
+	var ferr *ntp.FormatError
+	if !errors.Is(err, client.ErrBadPacket) || !errors.As(err, &ferr) {
+		t.Errorf("Fail = %v; want *ntp.FormatError classified as %v", err, client.ErrBadPacket)
+	}
+}
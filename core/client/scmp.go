@@ -0,0 +1,251 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/snet"
+
+	"example.com/scion-time/net/udp"
+)
+
+const pathDownHoldTime = 1 * time.Minute
+
+// SCMPError is returned if a request was answered with an SCMP error message.
+// For interface down errors, IA and Ingress/Egress identify the affected
+// interface(s).
+type SCMPError struct {
+	TypeCode slayers.SCMPTypeCode
+	IA       addr.IA
+	Ingress  uint64
+	Egress   uint64
+}
+
+type ifKey struct {
+	ia   addr.IA
+	ifID uint64
+}
+
+type ifPairKey struct {
+	ia      addr.IA
+	ingress uint64
+	egress  uint64
+}
+
+var (
+	pathsDownMu   sync.Mutex
+	pathsDown     = make(map[snet.PathFingerprint]time.Time)
+	ifsDown       = make(map[ifKey]time.Time)
+	ifPairsDown   = make(map[ifPairKey]time.Time)
+	scmpErrorLbls = []string{"type"}
+)
+
+func (e *SCMPError) Error() string {
+	switch e.TypeCode.Type() {
+	case slayers.SCMPTypeExternalInterfaceDown:
+		return fmt.Sprintf("received SCMP error: %s (%s#%d)", e.TypeCode, e.IA, e.Ingress)
+	case slayers.SCMPTypeInternalConnectivityDown:
+		return fmt.Sprintf("received SCMP error: %s (%s#%d-%d)", e.TypeCode, e.IA, e.Ingress, e.Egress)
+	default:
+		return fmt.Sprintf("received SCMP error: %s", e.TypeCode)
+	}
+}
+
+// PathDown reports whether the error indicates that the path used is not
+// usable anymore.
+func (e *SCMPError) PathDown() bool {
+	switch e.TypeCode.Type() {
+	case slayers.SCMPTypeDestinationUnreachable,
+		slayers.SCMPTypeParameterProblem,
+		slayers.SCMPTypeExternalInterfaceDown,
+		slayers.SCMPTypeInternalConnectivityDown:
+		return true
+	default:
+		return false
+	}
+}
+
+func scmpErrorType(t slayers.SCMPType) string {
+	switch t {
+	case slayers.SCMPTypeDestinationUnreachable:
+		return "destination_unreachable"
+	case slayers.SCMPTypePacketTooBig:
+		return "packet_too_big"
+	case slayers.SCMPTypeParameterProblem:
+		return "parameter_problem"
+	case slayers.SCMPTypeExternalInterfaceDown:
+		return "external_interface_down"
+	case slayers.SCMPTypeInternalConnectivityDown:
+		return "internal_connectivity_down"
+	default:
+		return "other"
+	}
+}
+
+// decodeSCMPError returns the error carried by an SCMP error message if the
+// quoted packet is a request sent from localAddr:localPort to remoteAddr.
+func decodeSCMPError(scmpLayer *slayers.SCMP, localAddr, remoteAddr udp.UDPAddr, localPort int) (
+	*SCMPError, bool) {
+	t := scmpLayer.TypeCode.Type()
+	if t >= 128 {
+		// informational message
+		return nil, false
+	}
+	e := &SCMPError{TypeCode: scmpLayer.TypeCode}
+	var quote []byte
+	switch t {
+	case slayers.SCMPTypeDestinationUnreachable:
+		var m slayers.SCMPDestinationUnreachable
+		if m.DecodeFromBytes(scmpLayer.Payload, gopacket.NilDecodeFeedback) != nil {
+			return nil, false
+		}
+		quote = m.Payload
+	case slayers.SCMPTypePacketTooBig:
+		var m slayers.SCMPPacketTooBig
+		if m.DecodeFromBytes(scmpLayer.Payload, gopacket.NilDecodeFeedback) != nil {
+			return nil, false
+		}
+		quote = m.Payload
+	case slayers.SCMPTypeParameterProblem:
+		var m slayers.SCMPParameterProblem
+		if m.DecodeFromBytes(scmpLayer.Payload, gopacket.NilDecodeFeedback) != nil {
+			return nil, false
+		}
+		quote = m.Payload
+	case slayers.SCMPTypeExternalInterfaceDown:
+		var m slayers.SCMPExternalInterfaceDown
+		if m.DecodeFromBytes(scmpLayer.Payload, gopacket.NilDecodeFeedback) != nil {
+			return nil, false
+		}
+		e.IA, e.Ingress = m.IA, m.IfID
+		quote = m.Payload
+	case slayers.SCMPTypeInternalConnectivityDown:
+		var m slayers.SCMPInternalConnectivityDown
+		if m.DecodeFromBytes(scmpLayer.Payload, gopacket.NilDecodeFeedback) != nil {
+			return nil, false
+		}
+		e.IA, e.Ingress, e.Egress = m.IA, m.Ingress, m.Egress
+		quote = m.Payload
+	default:
+		return nil, false
+	}
+
+	var (
+		scionLayer slayers.SCION
+		hbhLayer   slayers.HopByHopExtnSkipper
+		e2eLayer   slayers.EndToEndExtnSkipper
+		udpLayer   slayers.UDP
+	)
+	parser := gopacket.NewDecodingLayerParser(
+		slayers.LayerTypeSCION, &scionLayer, &hbhLayer, &e2eLayer, &udpLayer,
+	)
+	parser.IgnoreUnsupported = true
+	decoded := make([]gopacket.LayerType, 4)
+	// The quoted packet may be truncated, decoding errors beyond the UDP
+	// header are therefore ignored.
+	_ = parser.DecodeLayers(quote, &decoded)
+	if len(decoded) < 2 || decoded[len(decoded)-1] != slayers.LayerTypeSCIONUDP {
+		return nil, false
+	}
+	n := len(scionLayer.RawSrcAddr)
+	valid := scionLayer.SrcIA.Equal(localAddr.IA) &&
+		(n == net.IPv4len || n == net.IPv6len) &&
+		equalIPs(scionLayer.RawSrcAddr, localAddr.Host.IP) &&
+		scionLayer.DstIA.Equal(remoteAddr.IA) &&
+		int(udpLayer.SrcPort) == localPort &&
+		int(udpLayer.DstPort) == remoteAddr.Host.Port
+	if !valid {
+		return nil, false
+	}
+	return e, true
+}
+
+func reportPathDown(p snet.Path, e *SCMPError) {
+	now := time.Now()
+	pathsDownMu.Lock()
+	defer pathsDownMu.Unlock()
+	pathsDown[snet.Fingerprint(p)] = now
+	switch e.TypeCode.Type() {
+	case slayers.SCMPTypeExternalInterfaceDown:
+		ifsDown[ifKey{e.IA, e.Ingress}] = now
+	case slayers.SCMPTypeInternalConnectivityDown:
+		ifPairsDown[ifPairKey{e.IA, e.Ingress, e.Egress}] = now
+	}
+}
+
+func expired(t, now time.Time) bool {
+	return now.Sub(t) > pathDownHoldTime
+}
+
+func isPathDown(p snet.Path, now time.Time) bool {
+	if t, ok := pathsDown[snet.Fingerprint(p)]; ok && !expired(t, now) {
+		return true
+	}
+	md := p.Metadata()
+	if md == nil {
+		return false
+	}
+	for i, pi := range md.Interfaces {
+		if t, ok := ifsDown[ifKey{pi.IA, uint64(pi.ID)}]; ok && !expired(t, now) {
+			return true
+		}
+		if i%2 == 0 || i+1 == len(md.Interfaces) {
+			continue
+		}
+		next := md.Interfaces[i+1]
+		if next.IA != pi.IA {
+			continue
+		}
+		for _, k := range []ifPairKey{
+			{pi.IA, uint64(pi.ID), uint64(next.ID)},
+			{pi.IA, uint64(next.ID), uint64(pi.ID)},
+		} {
+			if t, ok := ifPairsDown[k]; ok && !expired(t, now) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// usablePaths returns the paths in ps that have not been reported down via
+// SCMP recently. If all paths are down, ps is returned unchanged.
+func usablePaths(ps []snet.Path) []snet.Path {
+	now := time.Now()
+	pathsDownMu.Lock()
+	defer pathsDownMu.Unlock()
+	for fp, t := range pathsDown {
+		if expired(t, now) {
+			delete(pathsDown, fp)
+		}
+	}
+	for k, t := range ifsDown {
+		if expired(t, now) {
+			delete(ifsDown, k)
+		}
+	}
+	for k, t := range ifPairsDown {
+		if expired(t, now) {
+			delete(ifPairsDown, k)
+		}
+	}
+	if len(pathsDown) == 0 && len(ifsDown) == 0 && len(ifPairsDown) == 0 {
+		return ps
+	}
+	ups := make([]snet.Path, 0, len(ps))
+	for _, p := range ps {
+		if !isPathDown(p, now) {
+			ups = append(ups, p)
+		}
+	}
+	if len(ups) == 0 {
+		return ps
+	}
+	return ups
+}
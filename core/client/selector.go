@@ -0,0 +1,240 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/pkg/snet"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/events"
+	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/core/timebase"
+	"example.com/scion-time/net/scion"
+	"example.com/scion-time/net/udp"
+)
+
+const (
+	pathProbeTimeout = 1 * time.Second
+	pathProbeWindow  = 8
+)
+
+type pathProbeStats struct {
+	delays [pathProbeWindow]time.Duration
+	len    int
+	next   int
+}
+
+type PathSelector struct {
+	log        *zap.Logger
+	ntpc       *SCIONClient
+	localAddr  udp.UDPAddr
+	remoteAddr udp.UDPAddr
+	mu         sync.Mutex
+	stats      map[snet.PathFingerprint]*pathProbeStats
+	monitors   map[snet.PathFingerprint]*delayMonitor
+	best       snet.PathFingerprint
+}
+
+func (s *pathProbeStats) add(delay time.Duration) {
+	s.delays[s.next] = delay
+	s.next = (s.next + 1) % len(s.delays)
+	if s.len != len(s.delays) {
+		s.len++
+	}
+}
+
+// score returns the minimum round trip delay plus its standard deviation so
+// that paths with low and stable delays are preferred.
+func (s *pathProbeStats) score() float64 {
+	if s.len == 0 {
+		return math.Inf(1)
+	}
+	var min, sum, sumsq float64
+	for i := 0; i != s.len; i++ {
+		d := timemath.Seconds(s.delays[i])
+		if i == 0 || d < min {
+			min = d
+		}
+		sum += d
+		sumsq += d * d
+	}
+	n := float64(s.len)
+	mean := sum / n
+	v := sumsq/n - mean*mean
+	if v < 0 {
+		v = 0
+	}
+	return min + math.Sqrt(v)
+}
+
+func (s *PathSelector) probe(ctx context.Context, ps []snet.Path) {
+	mtrcs := scionMetrics.Load()
+	fps := make(map[snet.PathFingerprint]bool, len(ps))
+	for _, p := range ps {
+		fp := snet.Fingerprint(p)
+		fps[fp] = true
+		ctx, cancel := context.WithTimeout(ctx, pathProbeTimeout)
+		epoch, start := timebase.Epoch(), time.Now()
+		off, _, rtd, _, err := s.ntpc.measureClockOffsetSCION(ctx, s.log, mtrcs, s.localAddr, s.remoteAddr, p)
+		elapsed := time.Since(start)
+		cancel()
+		if err != nil {
+			if s.monitors != nil && errors.Is(err, ErrTimeout) {
+				s.mu.Lock()
+				s.checkDelayAttackTimeout(p, fp)
+				s.mu.Unlock()
+			}
+			s.log.Info("failed to probe path",
+				zap.Stringer("to", s.remoteAddr.IA),
+				zap.Object("via", scion.PathMarshaler{Path: p}),
+				zap.Error(err),
+			)
+			var scmpErr *SCMPError
+			if errors.As(err, &scmpErr) && scmpErr.PathDown() {
+				reportPathDown(p, scmpErr)
+			}
+			continue
+		}
+		recordPathStats(s.remoteAddr.String(), p, off.Duration(), rtd)
+		s.mu.Lock()
+		st, ok := s.stats[fp]
+		if !ok {
+			st = &pathProbeStats{}
+			s.stats[fp] = st
+		}
+		st.add(rtd)
+		// The round trip delay is based on the local clock, which may be
+		// adjusted during the probe, so bound it by the elapsed monotonic time
+		// and ignore probes across a clock step.
+		if s.monitors != nil && timebase.Epoch() == epoch {
+			if rtd > elapsed {
+				rtd = elapsed
+			}
+			s.checkDelayAttack(p, fp, off.Duration(), rtd)
+		}
+		s.mu.Unlock()
+	}
+	s.mu.Lock()
+	for fp := range s.stats {
+		if !fps[fp] {
+			delete(s.stats, fp)
+		}
+	}
+	for fp := range s.monitors {
+		if !fps[fp] {
+			delete(s.monitors, fp)
+		}
+	}
+	s.mu.Unlock()
+}
+
+// Select returns up to n paths from ps, preferring the paths with the lowest
+// and most stable round trip delays observed by probing. Paths that have not
+// been probed successfully yet are only used to fill up the result. Paths
+// recently reported down via SCMP, or suspected of a delay attack, are skipped.
+func (s *PathSelector) Select(ps []snet.Path, n int) []snet.Path {
+	ps = s.trustedPaths(usablePaths(ps))
+	if n >= len(ps) {
+		return ps
+	}
+	scores := make([]float64, len(ps))
+	s.mu.Lock()
+	for i, p := range ps {
+		st, ok := s.stats[snet.Fingerprint(p)]
+		if ok {
+			scores[i] = st.score()
+		} else {
+			scores[i] = math.Inf(1)
+		}
+	}
+	s.mu.Unlock()
+	idx := make([]int, len(ps))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return scores[idx[i]] < scores[idx[j]]
+	})
+	sps := make([]snet.Path, n)
+	for i := 0; i != n; i++ {
+		sps[i] = ps[idx[i]]
+	}
+	if n != 0 && !math.IsInf(scores[idx[0]], 1) {
+		s.switchBest(snet.Fingerprint(sps[0]))
+	}
+	return sps
+}
+
+// switchBest records a change of the best path to fp.
+func (s *PathSelector) switchBest(fp snet.PathFingerprint) {
+	s.mu.Lock()
+	prev := s.best
+	s.best = fp
+	s.mu.Unlock()
+	if prev != "" && prev != fp {
+		events.Record(events.KindPathSwitch, s.remoteAddr.String(),
+			"switched from path %s to path %s", prev, fp)
+	}
+}
+
+// trustedPaths returns the paths in ps that are not suspected of a delay
+// attack, or all of ps if every path is suspected.
+func (s *PathSelector) trustedPaths(ps []snet.Path) []snet.Path {
+	if s.monitors == nil {
+		return ps
+	}
+	now := time.Now()
+	tps := make([]snet.Path, 0, len(ps))
+	s.mu.Lock()
+	for _, p := range ps {
+		m, ok := s.monitors[snet.Fingerprint(p)]
+		if !ok || !m.suspicious(now) {
+			tps = append(tps, p)
+		}
+	}
+	s.mu.Unlock()
+	if len(tps) == 0 {
+		return ps
+	}
+	return tps
+}
+
+// StartPathSelector probes the paths to remoteAddr every interval. If
+// detectDelayAttacks is set, the probes are also used to detect delay attacks
+// on the individual paths.
+func StartPathSelector(ctx context.Context, log *zap.Logger, ntpc *SCIONClient,
+	localAddr, remoteAddr udp.UDPAddr, paths func() []snet.Path, interval time.Duration,
+	detectDelayAttacks bool) *PathSelector {
+	if interval <= 0 {
+		panic("invalid path probe interval")
+	}
+	s := &PathSelector{
+		log:        log,
+		ntpc:       ntpc,
+		localAddr:  localAddr,
+		remoteAddr: remoteAddr,
+		stats:      make(map[snet.PathFingerprint]*pathProbeStats),
+	}
+	if detectDelayAttacks {
+		s.monitors = make(map[snet.PathFingerprint]*delayMonitor)
+	}
+	go func(ctx context.Context, s *PathSelector, paths func() []snet.Path) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.probe(ctx, paths())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}(ctx, s, paths)
+	return s
+}
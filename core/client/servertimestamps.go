@@ -0,0 +1,68 @@
+package client
+
+// Server RX timestamps over SCION: clients that opt in request the kernel or
+// hardware RX timestamp of their requests in an end-to-end option of the
+// response, see scion.OptTypeServerTimestamp. Since requests with an
+// end-to-end extension take the slow path on servers, the capability option
+// is not sent to servers that declined it, i.e., that answered a request with
+// the capability without a timestamp option, until serverTimestampsRetry has
+// passed.
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	serverTimestampsRetry       = time.Hour
+	maxServerTimestampsDeclined = 1024
+)
+
+var (
+	serverTimestamps atomic.Bool
+
+	serverTimestampsMu       sync.Mutex
+	serverTimestampsDeclined = make(map[string]time.Time)
+)
+
+// SetServerTimestamps sets whether SCION clients request server RX timestamps.
+func SetServerTimestamps(enabled bool) {
+	serverTimestamps.Store(enabled)
+}
+
+// requestServerTimestamp reports whether a request to server sent at now
+// should carry the capability option.
+func requestServerTimestamp(server string, now time.Time) bool {
+	if !serverTimestamps.Load() {
+		return false
+	}
+	serverTimestampsMu.Lock()
+	defer serverTimestampsMu.Unlock()
+	t, ok := serverTimestampsDeclined[server]
+	if !ok {
+		return true
+	}
+	if now.Sub(t) < serverTimestampsRetry {
+		return false
+	}
+	delete(serverTimestampsDeclined, server)
+	return true
+}
+
+// recordServerTimestamp records at now whether server answered a request with
+// the capability option with a timestamp option.
+func recordServerTimestamp(server string, found bool, now time.Time) {
+	serverTimestampsMu.Lock()
+	defer serverTimestampsMu.Unlock()
+	if found {
+		delete(serverTimestampsDeclined, server)
+		return
+	}
+	if len(serverTimestampsDeclined) >= maxServerTimestampsDeclined {
+		for k := range serverTimestampsDeclined {
+			delete(serverTimestampsDeclined, k)
+		}
+	}
+	serverTimestampsDeclined[server] = now
+}
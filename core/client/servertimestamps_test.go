@@ -0,0 +1,149 @@
+package client_test
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/snet"
+	"github.com/scionproto/scion/pkg/snet/path"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/timebase"
+	"example.com/scion-time/driver/clock"
+	"example.com/scion-time/net/ntp"
+	"example.com/scion-time/net/scion"
+	"example.com/scion-time/net/udp"
+)
+
+// timestampingConn answers each request like cannedConn and includes the
+// server RX timestamp option in the response if supported is set and the
+// request carries the capability option.
+type timestampingConn struct {
+	cannedConn
+	supported bool
+	capable   *int
+}
+
+func (c *timestampingConn) WriteToUDPAddrPort(b []byte, addr netip.AddrPort) (int, error) {
+	var (
+		scionLayer slayers.SCION
+		e2eLayer   slayers.EndToEndExtn
+		udpLayer   slayers.UDP
+	)
+	parser := gopacket.NewDecodingLayerParser(slayers.LayerTypeSCION, &scionLayer, &e2eLayer, &udpLayer)
+	parser.IgnoreUnsupported = true
+	decoded := make([]gopacket.LayerType, 3)
+	err := parser.DecodeLayers(b, &decoded)
+	if err != nil {
+		return 0, err
+	}
+	var opts []*slayers.EndToEndOption
+	if len(decoded) == 3 {
+		opts = e2eLayer.Options
+	}
+	_, capable := scion.TimestampCapability(opts)
+	if capable {
+		*c.capable++
+	}
+	var req ntp.Packet
+	err = ntp.DecodePacket(&req, udpLayer.Payload)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	resp := ntp.Packet{
+		Stratum:      1,
+		OriginTime:   req.TransmitTime,
+		ReceiveTime:  ntp.Time64FromTime(now),
+		TransmitTime: ntp.Time64FromTime(now.Add(10 * time.Microsecond)),
+	}
+	resp.SetVersion(ntp.VersionMax)
+	resp.SetMode(ntp.ModeServer)
+	var payload []byte
+	ntp.EncodePacket(&payload, &resp)
+
+	scionLayer.DstIA, scionLayer.SrcIA = scionLayer.SrcIA, scionLayer.DstIA
+	scionLayer.DstAddrType, scionLayer.SrcAddrType = scionLayer.SrcAddrType, scionLayer.DstAddrType
+	scionLayer.RawDstAddr, scionLayer.RawSrcAddr = scionLayer.RawSrcAddr, scionLayer.RawDstAddr
+	scionLayer.NextHdr = slayers.L4UDP
+	udpLayer.DstPort, udpLayer.SrcPort = udpLayer.SrcPort, udpLayer.DstPort
+	udpLayer.SetNetworkLayerForChecksum(&scionLayer)
+	layers := []gopacket.SerializableLayer{&scionLayer}
+	if c.supported && capable {
+		rxtOpt := &slayers.EndToEndOption{}
+		scion.PrepareServerTimestampOpt(rxtOpt, scion.TimestampOptVersion, now)
+		e2eExtn := &slayers.EndToEndExtn{Options: []*slayers.EndToEndOption{rxtOpt}}
+		e2eExtn.NextHdr = slayers.L4UDP
+		scionLayer.NextHdr = slayers.End2EndClass
+		layers = append(layers, e2eExtn)
+	}
+	layers = append(layers, &udpLayer, gopacket.Payload(payload))
+	buffer := gopacket.NewSerializeBuffer()
+	err = gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{
+		ComputeChecksums: true,
+		FixLengths:       true,
+	}, layers...)
+	if err != nil {
+		return 0, err
+	}
+	c.resps <- append([]byte(nil), buffer.Bytes()...)
+	return len(b), nil
+}
+
+func TestServerTimestampNegotiation(t *testing.T) {
+	timebase.RegisterClockIfUnset(&clock.SystemClock{Log: zap.NewNop()})
+	client.SetServerTimestamps(true)
+	t.Cleanup(func() {
+		client.SetServerTimestamps(false)
+	})
+
+	ia := addr.MustIAFrom(1, 0xff0000000110)
+	localAddr := udp.UDPAddr{IA: ia, Host: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}}
+	ps := []snet.Path{path.Path{
+		Src:           ia,
+		Dst:           ia,
+		DataplanePath: path.Empty{},
+	}}
+	for i, tc := range []struct {
+		supported bool
+		want      int
+	}{
+		// Servers that support the option are asked for it in every request
+		{supported: true, want: 3},
+		// Servers that decline it are only asked once
+		{supported: false, want: 1},
+	} {
+		remoteAddr := udp.UDPAddr{IA: ia, Host: &net.UDPAddr{IP: net.IPv4(127, 0, 1, byte(i)), Port: ntp.ServerPortSCION}}
+		var capable int
+		c := &client.SCIONClient{
+			Listen: func(ip net.IP, zone string) (client.PacketConn, error) {
+				return &timestampingConn{
+					cannedConn: cannedConn{resps: make(chan []byte, 1)},
+					supported:  tc.supported,
+					capable:    &capable,
+				}, nil
+			},
+		}
+		for j := 0; j != 3; j++ {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			_, err := client.MeasureClockOffsetSCION(ctx, zap.NewNop(), []*client.SCIONClient{c}, localAddr, remoteAddr, ps)
+			cancel()
+			if err != nil {
+				t.Fatalf("MeasureClockOffsetSCION failed: %v", err)
+			}
+		}
+		if capable != tc.want {
+			t.Errorf("supported %t: %d requests with capability option; want %d", tc.supported, capable, tc.want)
+		}
+	}
+}
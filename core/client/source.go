@@ -0,0 +1,148 @@
+package client
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/snet"
+
+	"example.com/scion-time/net/ntp"
+)
+
+// Source describes the upstream server of a reference clock.
+type Source struct {
+	Stratum uint8  `json:"stratum"`
+	RefID   uint32 `json:"refid"`
+}
+
+// SourceReporter is implemented by reference clocks that know the stratum and
+// reference ID of their upstream source. The result is only valid if the
+// last offset measurement succeeded.
+type SourceReporter interface {
+	Source() (Source, bool)
+}
+
+// Transports over which samples are obtained.
+const (
+	TransportIP          = "ip"
+	TransportSCION       = "scion"
+	TransportSCIONStream = "scion-stream" // framed NTP on QUIC streams over SCION
+	TransportRefClock    = "refclock"     // hardware reference clocks, e.g., GNSS receivers
+)
+
+// Sample is the result of the last accepted offset measurement of a client,
+// before filtering. Weight is the weight assigned to the measurement by the
+// filter, see Weighting, or zero if it was not filtered. Restored samples were
+// measured before a restart of the daemon, see PeerState; they neither count
+// as fresh measurements nor make a peer reachable.
+//
+// Server identifies the source of the sample independently of the transport:
+// the host address of NTP servers, qualified by IA for SCION servers, or the
+// device of reference clocks. Path lists the interfaces traversed by the SCION
+// path the sample was measured on, see Independent.
+type Sample struct {
+	Time          time.Time            `json:"time"`
+	Offset        time.Duration        `json:"offset_ns"`
+	Delay         time.Duration        `json:"delay_ns"`
+	Weight        float64              `json:"weight,omitempty"`
+	Authenticated bool                 `json:"authenticated,omitempty"`
+	Transport     string               `json:"transport,omitempty"`
+	Server        string               `json:"server,omitempty"`
+	IA            addr.IA              `json:"ia,omitempty"`
+	Path          []snet.PathInterface `json:"path,omitempty"`
+	Restored      bool                 `json:"restored,omitempty"`
+}
+
+// Independent reports whether samples s and x were obtained from different
+// sources such that a single compromised server or link cannot affect both.
+// Samples from the same host are not independent, even via different
+// transports, unless both are from SCION servers in different ASes. Samples
+// from SCION servers are also not independent if their paths share an
+// interface.
+func (s Sample) Independent(x Sample) bool {
+	if s.Server == "" || x.Server == "" {
+		return false
+	}
+	if s.Server == x.Server && (s.IA == 0 || x.IA == 0 || s.IA == x.IA) {
+		return false
+	}
+	for _, a := range s.Path {
+		for _, b := range x.Path {
+			if a.IA == b.IA && a.ID == b.ID {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// pathInterfaces returns the interfaces traversed by path p, if known.
+func pathInterfaces(p snet.Path) []snet.PathInterface {
+	if p == nil {
+		return nil
+	}
+	md := p.Metadata()
+	if md == nil {
+		return nil
+	}
+	return md.Interfaces
+}
+
+// SampleReporter is implemented by reference clocks that expose the last
+// accepted offset measurement of their clients.
+type SampleReporter interface {
+	LastSample() (Sample, bool)
+}
+
+// SyntonizationReporter is implemented by reference clocks that receive
+// syntonization messages from their peers.
+type SyntonizationReporter interface {
+	Syntonization() (ntp.Syntonization, bool)
+}
+
+type sourceValue struct {
+	v atomic.Uint64
+}
+
+func (s *sourceValue) store(src Source) {
+	s.v.Store(uint64(src.Stratum)<<32 | uint64(src.RefID))
+}
+
+func (s *sourceValue) load() (Source, bool) {
+	x := s.v.Load()
+	if x == 0 {
+		return Source{}, false
+	}
+	return Source{Stratum: uint8(x >> 32), RefID: uint32(x)}, true
+}
+
+func refIDFromHash(b []byte) uint32 {
+	h := md5.Sum(b)
+	return binary.BigEndian.Uint32(h[:4])
+}
+
+// RefIDFromIP returns the reference ID for an upstream server at ip: the IPv4
+// address or the first four bytes of the MD5 hash of the IPv6 address, see
+// RFC 5905, Section 7.3.
+func RefIDFromIP(ip net.IP) uint32 {
+	if ip4 := ip.To4(); ip4 != nil {
+		return binary.BigEndian.Uint32(ip4)
+	}
+	return refIDFromHash(ip.To16())
+}
+
+// RefIDFromSCION returns the reference ID for an upstream server at host ip in
+// AS ia, derived from the first four bytes of the MD5 hash of both.
+func RefIDFromSCION(ia addr.IA, ip net.IP) uint32 {
+	b := binary.BigEndian.AppendUint64(nil, uint64(ia))
+	if ip4 := ip.To4(); ip4 != nil {
+		b = append(b, ip4...)
+	} else {
+		b = append(b, ip.To16()...)
+	}
+	return refIDFromHash(b)
+}
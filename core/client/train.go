@@ -0,0 +1,106 @@
+package client
+
+// Packet trains, an experimental measurement mode: instead of a single
+// exchange per measurement, a client sends a short train of requests spaced
+// by Spacing. Queuing only ever adds to the round trip delay of an exchange,
+// so the offset is estimated from the exchanges of the train with the lowest
+// delays, and a slope fitted across these exchanges accounts for the frequency
+// error of the local clock during the train.
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"example.com/scion-time/base/timemath"
+)
+
+// Train configures packet train measurements. Trains of length 0 or 1
+// correspond to single exchanges.
+type Train struct {
+	Len     int
+	Spacing time.Duration
+}
+
+// Enabled reports whether t consists of more than one exchange.
+func (t Train) Enabled() bool {
+	return t.Len > 1
+}
+
+// trainOffset estimates the offset at the time of the last sample of a train
+// from the samples with the lowest delays.
+func trainOffset(samples []Sample) timemath.FineDuration {
+	if len(samples) == 0 {
+		panic("unexpected number of train samples")
+	}
+	last := samples[0].Time
+	for _, s := range samples[1:] {
+		if s.Time.After(last) {
+			last = s.Time
+		}
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Delay < samples[j].Delay
+	})
+	samples = samples[:(len(samples)+1)/2]
+	if len(samples) == 1 {
+		return timemath.FineFromDuration(samples[0].Offset)
+	}
+
+	// Least squares fit of the offsets over the time relative to last
+	var mt, mo float64
+	for _, s := range samples {
+		mt += s.Time.Sub(last).Seconds()
+		mo += s.Offset.Seconds()
+	}
+	n := float64(len(samples))
+	mt, mo = mt/n, mo/n
+	var stt, sto float64
+	for _, s := range samples {
+		dt := s.Time.Sub(last).Seconds() - mt
+		stt += dt * dt
+		sto += dt * (s.Offset.Seconds() - mo)
+	}
+	if stt == 0 {
+		return timemath.FineFromSeconds(mo)
+	}
+	return timemath.FineFromSeconds(mo - sto/stt*mt)
+}
+
+// measureTrain runs the exchanges of train t with measure, which returns the
+// sample of a successful exchange, and estimates the offset from all
+// successful exchanges. The error of the first failed exchange is returned if
+// none succeeded.
+func measureTrain(ctx context.Context, t Train, measure func() (Sample, error)) (
+	timemath.FineDuration, error) {
+	var samples []Sample
+	var err error
+	for i := 0; i != t.Len; i++ {
+		if i != 0 && t.Spacing != 0 {
+			timer := time.NewTimer(t.Spacing)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+		if ctx.Err() != nil {
+			if err == nil {
+				err = ctx.Err()
+			}
+			break
+		}
+		s, e := measure()
+		if e != nil {
+			if err == nil {
+				err = e
+			}
+			continue
+		}
+		samples = append(samples, s)
+	}
+	if len(samples) == 0 {
+		return timemath.FineDuration{}, err
+	}
+	return trainOffset(samples), nil
+}
@@ -0,0 +1,35 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"example.com/scion-time/core/client"
+)
+
+func TestTrainOffset(t *testing.T) {
+	// Offset drifting by 1µs per 10ms, two exchanges delayed by queuing
+	t0 := time.Unix(0, 0)
+	var samples []client.Sample
+	for i := 0; i != 6; i++ {
+		s := client.Sample{
+			Time:   t0.Add(time.Duration(i) * 10 * time.Millisecond),
+			Offset: time.Duration(i) * time.Microsecond,
+			Delay:  100 * time.Microsecond,
+		}
+		if i == 1 || i == 5 {
+			s.Offset += 200 * time.Microsecond
+			s.Delay += 400 * time.Microsecond
+		}
+		samples = append(samples, s)
+	}
+	off := client.TrainOffset(samples).Duration()
+	if d := off - 5*time.Microsecond; d < -time.Nanosecond || d > time.Nanosecond {
+		t.Errorf("TrainOffset() = %v, want %v", off, 5*time.Microsecond)
+	}
+
+	off = client.TrainOffset([]client.Sample{{Time: t0, Offset: time.Millisecond}}).Duration()
+	if off != time.Millisecond {
+		t.Errorf("TrainOffset() = %v, want %v", off, time.Millisecond)
+	}
+}
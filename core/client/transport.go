@@ -0,0 +1,205 @@
+package client
+
+// Transports for basic mode exchanges as UDP datagrams, over IP or over SCION.
+// The packets are timestamped by the kernel if timestamping is enabled on the
+// connection, and by the time service otherwise. Packets from other sources
+// than the server are discarded until the deadline of the exchange.
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/snet"
+
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/net/scion"
+	"example.com/scion-time/net/udp"
+)
+
+// IPTransport carries NTP packets as UDP datagrams over IP on Conn, which
+// should have timestamping enabled, see udp.EnableTimestamping.
+type IPTransport struct {
+	Conn       *net.UDPConn
+	RemoteAddr netip.AddrPort
+}
+
+var _ Transport = IPTransport{}
+
+// SCIONTransport carries NTP packets as SCION/UDP datagrams via Path on Conn,
+// e.g., a connection returned by ListenFunc.
+type SCIONTransport struct {
+	Conn       PacketConn
+	LocalAddr  udp.UDPAddr
+	RemoteAddr udp.UDPAddr
+	Path       snet.Path
+}
+
+var _ Transport = SCIONTransport{}
+
+// prepareExchange sets the deadline of conn to that of ctx, if any.
+func prepareExchange(ctx context.Context, conn interface{ SetDeadline(time.Time) error }) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Time{}
+	}
+	return conn.SetDeadline(deadline)
+}
+
+// readError classifies the error of a failed read.
+func readError(err error) error {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return classify(ErrTimeout, err)
+	}
+	return err
+}
+
+// receiveTime returns the receive timestamp in oob, or the current time.
+func receiveTime(oob []byte) time.Time {
+	t, err := udp.TimestampFromOOBData(oob)
+	if err != nil {
+		return timebase.RawNow()
+	}
+	return t
+}
+
+func (t IPTransport) Exchange(ctx context.Context, req []byte, resp *[]byte) (
+	cTxTime, cRxTime time.Time, err error) {
+	err = prepareExchange(ctx, t.Conn)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	n, err := t.Conn.WriteToUDPAddrPort(req, t.RemoteAddr)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if n != len(req) {
+		return time.Time{}, time.Time{}, errWrite
+	}
+	cTxTime, id, err := udp.ReadTXTimestamp(t.Conn)
+	if err != nil || id != 0 {
+		cTxTime = timebase.RawNow()
+	}
+
+	buf := (*resp)[:cap(*resp)]
+	if len(buf) < udp.MaxPayloadLen {
+		buf = make([]byte, udp.MaxPayloadLen)
+	}
+	oob := make([]byte, udp.TimestampLen())
+	for {
+		oob = oob[:cap(oob)]
+		n, oobn, flags, srcAddr, err := t.Conn.ReadMsgUDPAddrPort(buf, oob)
+		if err != nil {
+			return time.Time{}, time.Time{}, readError(err)
+		}
+		if flags != 0 {
+			return time.Time{}, time.Time{}, errUnexpectedPacketFlags
+		}
+		if compareAddrs(srcAddr.Addr(), t.RemoteAddr.Addr()) != 0 ||
+			srcAddr.Port() != t.RemoteAddr.Port() {
+			continue
+		}
+		*resp = buf[:n]
+		return cTxTime, receiveTime(oob[:oobn]), nil
+	}
+}
+
+func (t IPTransport) Name() string {
+	return TransportIP
+}
+
+func (t SCIONTransport) Exchange(ctx context.Context, req []byte, resp *[]byte) (
+	cTxTime, cRxTime time.Time, err error) {
+	err = prepareExchange(ctx, t.Conn)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	localPort := uint16(localAddrPort(t.Conn).Port())
+
+	var scionLayer slayers.SCION
+	scionLayer.SrcIA = t.LocalAddr.IA
+	err = scionLayer.SetSrcAddr(&net.IPAddr{IP: t.LocalAddr.Host.IP})
+	if err != nil {
+		return time.Time{}, time.Time{}, &PacketError{Op: "set source address", Err: err}
+	}
+	scionLayer.DstIA = t.RemoteAddr.IA
+	err = scionLayer.SetDstAddr(&net.IPAddr{IP: t.RemoteAddr.Host.IP})
+	if err != nil {
+		return time.Time{}, time.Time{}, &PacketError{Op: "set destination address", Err: err}
+	}
+	err = t.Path.Dataplane().SetPath(&scionLayer)
+	if err != nil {
+		return time.Time{}, time.Time{}, &PacketError{Op: "set path", Err: err}
+	}
+	var pkt []byte
+	err = scion.EncodeUDPPacket(&pkt, &scionLayer, localPort, uint16(t.RemoteAddr.Host.Port), req)
+	if err != nil {
+		return time.Time{}, time.Time{}, &PacketError{Op: "encode packet", Err: err}
+	}
+	mtu := scion.PathMTU(t.Path)
+	if len(pkt) > mtu {
+		return time.Time{}, time.Time{}, errPacketTooLarge
+	}
+
+	n, err := t.Conn.WriteToUDPAddrPort(pkt, scionNextHop(t.LocalAddr, t.RemoteAddr, t.Path))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if n != len(pkt) {
+		return time.Time{}, time.Time{}, errWrite
+	}
+	cTxTime, id, err := readTXTimestamp(t.Conn)
+	if err != nil || id != 0 {
+		cTxTime = timebase.RawNow()
+	}
+
+	var (
+		hbhLayer slayers.HopByHopExtnSkipper
+		e2eLayer slayers.EndToEndExtnSkipper
+		udpLayer slayers.UDP
+	)
+	parser := gopacket.NewDecodingLayerParser(
+		slayers.LayerTypeSCION, &scionLayer, &hbhLayer, &e2eLayer, &udpLayer,
+	)
+	parser.IgnoreUnsupported = true
+	decoded := make([]gopacket.LayerType, 4)
+	buf := make([]byte, mtu)
+	oob := make([]byte, udp.TimestampLen())
+	for {
+		oob = oob[:cap(oob)]
+		n, oobn, flags, _, err := t.Conn.ReadMsgUDPAddrPort(buf, oob)
+		if err != nil {
+			return time.Time{}, time.Time{}, readError(err)
+		}
+		if flags != 0 {
+			return time.Time{}, time.Time{}, errUnexpectedPacketFlags
+		}
+		err = parser.DecodeLayers(buf[:n], &decoded)
+		if err != nil || len(decoded) < 2 ||
+			decoded[len(decoded)-1] != slayers.LayerTypeSCIONUDP {
+			continue
+		}
+		validSrc := scionLayer.SrcIA.Equal(t.RemoteAddr.IA) &&
+			equalIPs(scionLayer.RawSrcAddr, t.RemoteAddr.Host.IP) &&
+			int(udpLayer.SrcPort) == t.RemoteAddr.Host.Port
+		validDst := scionLayer.DstIA.Equal(t.LocalAddr.IA) &&
+			equalIPs(scionLayer.RawDstAddr, t.LocalAddr.Host.IP) &&
+			udpLayer.DstPort == localPort
+		if !validSrc || !validDst {
+			continue
+		}
+		*resp = append((*resp)[:0], udpLayer.Payload...)
+		return cTxTime, receiveTime(oob[:oobn]), nil
+	}
+}
+
+func (t SCIONTransport) Name() string {
+	return TransportSCION
+}
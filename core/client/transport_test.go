@@ -0,0 +1,137 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/snet/path"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/timebase"
+	"example.com/scion-time/driver/clock"
+	"example.com/scion-time/net/ntp"
+	"example.com/scion-time/net/udp"
+)
+
+// serveOnce answers the first request on conn with the response of a server
+// whose clock is ahead of the local clock by offset.
+func serveOnce(t *testing.T, conn *net.UDPConn, offset time.Duration) {
+	buf := make([]byte, 1024)
+	n, addr, err := conn.ReadFromUDPAddrPort(buf)
+	if err != nil {
+		t.Errorf("ReadFromUDPAddrPort failed: %v", err)
+		return
+	}
+	var req ntp.Packet
+	err = ntp.DecodePacket(&req, buf[:n])
+	if err != nil {
+		t.Errorf("DecodePacket failed: %v", err)
+		return
+	}
+	now := time.Now().Add(offset)
+	resp := ntp.Packet{
+		Stratum:      1,
+		OriginTime:   req.TransmitTime,
+		ReceiveTime:  ntp.Time64FromTime(now),
+		TransmitTime: ntp.Time64FromTime(now.Add(10 * time.Microsecond)),
+	}
+	resp.SetVersion(ntp.VersionMax)
+	resp.SetMode(ntp.ModeServer)
+	var payload []byte
+	ntp.EncodePacket(&payload, &resp)
+	_, err = conn.WriteToUDPAddrPort(payload, addr)
+	if err != nil {
+		t.Errorf("WriteToUDPAddrPort failed: %v", err)
+	}
+}
+
+func TestIPTransport(t *testing.T) {
+	timebase.RegisterClockIfUnset(&clock.SystemClock{Log: zap.NewNop()})
+
+	const offset = 15 * time.Millisecond
+	loopback := netip.AddrPortFrom(netip.MustParseAddr("127.0.0.1"), 0)
+	server, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(loopback))
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer server.Close()
+	other, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(loopback))
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer other.Close()
+	conn, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(loopback))
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer conn.Close()
+
+	// Packets from other sources than the server are discarded
+	_, err = other.WriteToUDPAddrPort(make([]byte, ntp.PacketLen), conn.LocalAddr().(*net.UDPAddr).AddrPort())
+	if err != nil {
+		t.Fatalf("WriteToUDPAddrPort failed: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serveOnce(t, server, offset)
+	}()
+
+	tr := client.IPTransport{
+		Conn:       conn,
+		RemoteAddr: server.LocalAddr().(*net.UDPAddr).AddrPort(),
+	}
+	if tr.Name() != client.TransportIP {
+		t.Errorf("Name() = %q; want %q", tr.Name(), client.TransportIP)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	off, _, err := client.ExchangeBasic(ctx, tr)
+	<-done
+	if err != nil {
+		t.Fatalf("ExchangeBasic failed: %v", err)
+	}
+	if d := off - offset; d < -time.Millisecond || d > time.Millisecond {
+		t.Errorf("ExchangeBasic offset = %v; want %v", off, offset)
+	}
+}
+
+func TestSCIONTransport(t *testing.T) {
+	timebase.RegisterClockIfUnset(&clock.SystemClock{Log: zap.NewNop()})
+
+	const offset = -20 * time.Millisecond
+	ia := addr.MustIAFrom(1, 0xff0000000110)
+	tr := client.SCIONTransport{
+		Conn:       &cannedConn{offset: offset, resps: make(chan []byte, 1)},
+		LocalAddr:  udp.UDPAddr{IA: ia, Host: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}},
+		RemoteAddr: udp.UDPAddr{IA: ia, Host: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: ntp.ServerPortSCION}},
+		Path: path.Path{
+			Src:           ia,
+			Dst:           ia,
+			DataplanePath: path.Empty{},
+		},
+	}
+	if tr.Name() != client.TransportSCION {
+		t.Errorf("Name() = %q; want %q", tr.Name(), client.TransportSCION)
+	}
+	off, _, err := client.ExchangeBasic(context.Background(), tr)
+	if err != nil {
+		t.Fatalf("ExchangeBasic failed: %v", err)
+	}
+	if d := off - offset; d < -time.Millisecond || d > time.Millisecond {
+		t.Errorf("ExchangeBasic offset = %v; want %v", off, offset)
+	}
+
+	tr.Conn = &silentConn{}
+	_, _, err = client.ExchangeBasic(context.Background(), tr)
+	if !errors.Is(err, client.ErrTimeout) {
+		t.Errorf("ExchangeBasic without response: err = %v; want %v", err, client.ErrTimeout)
+	}
+}
@@ -1,5 +1,49 @@
 package config
 
-// DSCP is the Differentiated Services Codepoint value to be used by senders of
-// time synchronization packets. Valid values must be in range [0, 63].
-const DSCP = 63
+import (
+	"sync/atomic"
+)
+
+// DefaultDSCP is the Differentiated Services Codepoint value used by senders
+// of time synchronization packets unless configured otherwise.
+const DefaultDSCP = 63
+
+var (
+	dscp     atomic.Uint32
+	priority atomic.Int32
+)
+
+func init() {
+	dscp.Store(DefaultDSCP)
+}
+
+// DSCP returns the Differentiated Services Codepoint value to be used by
+// senders of time synchronization packets, in range [0, 63].
+func DSCP() uint8 {
+	return uint8(dscp.Load())
+}
+
+// SetDSCP sets the Differentiated Services Codepoint value to be used by
+// senders of time synchronization packets. Valid values must be in range
+// [0, 63].
+func SetDSCP(v uint8) {
+	if v > 63 {
+		panic("invalid DSCP value")
+	}
+	dscp.Store(uint32(v))
+}
+
+// SocketPriority returns the priority (SO_PRIORITY) of sockets sending time
+// synchronization packets. A value of 0 leaves the priority unchanged.
+func SocketPriority() int {
+	return int(priority.Load())
+}
+
+// SetSocketPriority sets the priority (SO_PRIORITY) of sockets sending time
+// synchronization packets. Values above 6 require CAP_NET_ADMIN.
+func SetSocketPriority(p int) {
+	if p < 0 || p > 0xffff {
+		panic("invalid socket priority")
+	}
+	priority.Store(int32(p))
+}
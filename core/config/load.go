@@ -0,0 +1,734 @@
+package config
+
+// Loading and validation of the configuration file: all problems are
+// collected and reported together, with the line of the offending key.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+
+	"github.com/scionproto/scion/pkg/snet"
+
+	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/base/seccomp"
+
+	"example.com/scion-time/core/control"
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/net/ptp"
+	"example.com/scion-time/net/scion"
+	"example.com/scion-time/net/scion/spao"
+)
+
+// Error is a problem with the value of configuration key Key, which is
+// located at line Line of the configuration file if Line is not 0.
+type Error struct {
+	Line int
+	Key  string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.Line != 0 {
+		b.WriteString("line ")
+		b.WriteString(strconv.Itoa(e.Line))
+		b.WriteString(": ")
+	}
+	if e.Key != "" {
+		b.WriteString(e.Key)
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errors are all problems found in a configuration file.
+type Errors []*Error
+
+func (es Errors) Error() string {
+	s := make([]string, len(es))
+	for i, e := range es {
+		s[i] = e.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+var (
+	errMissingValue     = errors.New("missing value")
+	errUnexpectedValue  = errors.New("unexpected value")
+	errInvalidAddress   = errors.New("invalid address")
+	errInvalidDuration  = errors.New("invalid duration")
+	errInvalidAuthMode  = errors.New("unknown authentication mode")
+	errInvalidDSCP      = errors.New("invalid DSCP value")
+	errInvalidPollRange = errors.New("minimum exceeds maximum")
+)
+
+// Load reads, validates and completes with defaults the configuration file
+// at path. Validation errors are returned as Errors.
+func Load(path string) (Service, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return Service{}, err
+	}
+	return Parse(raw)
+}
+
+// Parse decodes, validates and completes with defaults the configuration
+// document raw.
+func Parse(raw []byte) (Service, error) {
+	var cfg Service
+	err := toml.NewDecoder(bytes.NewReader(raw)).DisallowUnknownFields().Decode(&cfg)
+	if err != nil {
+		return Service{}, decodeErrors(err)
+	}
+	applyDefaults(&cfg)
+	v := validator{lines: keyLines(raw)}
+	v.validate(&cfg)
+	if len(v.errs) != 0 {
+		return Service{}, v.errs
+	}
+	return cfg, nil
+}
+
+func decodeErrors(err error) error {
+	var serr *toml.StrictMissingError
+	if errors.As(err, &serr) {
+		var es Errors
+		for _, e := range serr.Errors {
+			row, _ := e.Position()
+			es = append(es, &Error{
+				Line: row,
+				Key:  strings.Join(e.Key(), "."),
+				Err:  errors.New("unknown key"),
+			})
+		}
+		return es
+	}
+	var derr *toml.DecodeError
+	if errors.As(err, &derr) {
+		row, _ := derr.Position()
+		return Errors{{Line: row, Key: strings.Join(derr.Key(), "."), Err: errors.New(derr.Error())}}
+	}
+	return err
+}
+
+// keyLines maps the keys of the document raw to their lines. Keys in arrays of
+// tables are indexed, e.g., listeners[1].local_address.
+func keyLines(raw []byte) map[string]int {
+	lines := make(map[string]int)
+	counts := make(map[string]int)
+	var p unstable.Parser
+	p.Reset(raw)
+	var prefix string
+	for p.NextExpression() {
+		e := p.Expression()
+		var key []string
+		line := 0
+		it := e.Key()
+		for it.Next() {
+			n := it.Node()
+			if line == 0 {
+				line = p.Shape(n.Raw).Start.Line
+			}
+			key = append(key, string(n.Data))
+		}
+		k := strings.Join(key, ".")
+		switch e.Kind {
+		case unstable.Table:
+			prefix = k
+		case unstable.ArrayTable:
+			prefix = k + "[" + strconv.Itoa(counts[k]) + "]"
+			counts[k]++
+		case unstable.KeyValue:
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+		default:
+			continue
+		}
+		if _, ok := lines[k]; !ok {
+			lines[k] = line
+		}
+		if e.Kind == unstable.ArrayTable {
+			if _, ok := lines[strings.Join(key, ".")]; !ok {
+				lines[strings.Join(key, ".")] = line
+			}
+		}
+	}
+	return lines
+}
+
+type validator struct {
+	lines map[string]int
+	errs  Errors
+}
+
+// line returns the line of key or, if key is not in the document, e.g.,
+// because it is part of an inline table, of its closest parent.
+func (v *validator) line(key string) int {
+	for key != "" {
+		if l, ok := v.lines[key]; ok {
+			return l
+		}
+		i := strings.LastIndexAny(key, ".[")
+		if i < 0 {
+			break
+		}
+		key = key[:i]
+	}
+	return 0
+}
+
+func (v *validator) errorf(key string, err error, format string, args ...any) {
+	if format != "" {
+		err = fmt.Errorf("%w: "+format, append([]any{err}, args...)...)
+	}
+	v.errs = append(v.errs, &Error{Line: v.line(key), Key: key, Err: err})
+}
+
+func (v *validator) require(key, s string) {
+	if s == "" {
+		v.errorf(key, errMissingValue, "")
+	}
+}
+
+func (v *validator) scionAddr(key, s string, requireIA bool) {
+	if s == "" {
+		return
+	}
+	a, err := snet.ParseUDPAddr(s)
+	if err != nil {
+		v.errorf(key, errInvalidAddress, "%q", s)
+		return
+	}
+	if requireIA && a.IA.IsZero() {
+		v.errorf(key, errInvalidAddress, "%q: missing ISD-AS", s)
+	}
+}
+
+func (v *validator) ipAddrPort(key, s string) {
+	_, err := netip.ParseAddrPort(s)
+	if err != nil {
+		v.errorf(key, errInvalidAddress, "%q", s)
+	}
+}
+
+func (v *validator) duration(key, s string, min time.Duration) time.Duration {
+	if s == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < min {
+		v.errorf(key, errInvalidDuration, "%q", s)
+		return 0
+	}
+	return d
+}
+
+// prefixes checks that ss are IP prefixes or addresses.
+func (v *validator) prefixes(key string, ss []string) {
+	for i, s := range ss {
+		_, err := netip.ParsePrefix(s)
+		if err != nil {
+			_, err = netip.ParseAddr(s)
+		}
+		if err != nil {
+			v.errorf(fmt.Sprintf("%s[%d]", key, i), errInvalidAddress, "%q", s)
+		}
+	}
+}
+
+// scionPrefixes checks that ss are IP prefixes or addresses, optionally
+// preceded by an ISD-AS, see ParsePrefix.
+func (v *validator) scionPrefixes(key string, ss []string) {
+	for i, s := range ss {
+		_, _, err := ParsePrefix(s)
+		if err != nil {
+			v.errorf(fmt.Sprintf("%s[%d]", key, i), errInvalidAddress, "%q", s)
+		}
+	}
+}
+
+// buckets checks that ss are positive durations in increasing order.
+func (v *validator) buckets(key string, ss []string) {
+	if ss != nil && len(ss) == 0 {
+		v.errorf(key, errUnexpectedValue, "empty")
+		return
+	}
+	var prev time.Duration
+	for _, s := range ss {
+		d := v.duration(key, s, 1)
+		if d == 0 {
+			return
+		}
+		if d <= prev {
+			v.errorf(key, errUnexpectedValue, "%q not in increasing order", s)
+			return
+		}
+		prev = d
+	}
+}
+
+func (v *validator) intRange(key string, x, min, max int) {
+	if x < min || x > max {
+		v.errorf(key, errUnexpectedValue, "%d not in range [%d, %d]", x, min, max)
+	}
+}
+
+func (v *validator) probability(key string, x float64) {
+	if x < 0 || x > 1 {
+		v.errorf(key, errUnexpectedValue, "%v not in range [0, 1]", x)
+	}
+}
+
+func (v *validator) pollBounds(minKey, min, maxKey, max string) {
+	lo := v.duration(minKey, min, 0)
+	hi := v.duration(maxKey, max, 0)
+	if lo > hi {
+		v.errorf(minKey, errInvalidPollRange, "")
+	}
+}
+
+// broadcastKey checks that broadcast packets are authenticated with a key
+// from the NTP keys file, broadcast mode is not meant to rely on LAN trust.
+func (v *validator) broadcastKey(key string, id uint32, keysFile string) {
+	if id == 0 {
+		v.errorf(key, errMissingValue, "")
+	} else if keysFile == "" {
+		v.errorf(key, errUnexpectedValue, "requires ntp_keys_file")
+	}
+}
+
+// sameDevice reports whether the device paths a and b refer to the same
+// device, also if one of them is a symbolic link, e.g., created by udev.
+func sameDevice(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	ra, err := filepath.EvalSymlinks(a)
+	if err != nil {
+		return false
+	}
+	rb, err := filepath.EvalSymlinks(b)
+	if err != nil {
+		return false
+	}
+	return ra == rb
+}
+
+func (v *validator) syncInstances(cfg *Service) {
+	names := make(map[string]bool)
+	for i, si := range cfg.SyncInstances {
+		key := fmt.Sprintf("sync_instances[%d]", i)
+		v.require(key+".name", si.Name)
+		if si.Name != "" && names[si.Name] {
+			v.errorf(key+".name", errUnexpectedValue, "duplicate name %q", si.Name)
+		}
+		names[si.Name] = true
+		v.require(key+".clock", si.Clock)
+		if len(si.PHCReferenceClocks) == 0 && len(si.NTPReferenceClocks) == 0 && len(si.SCIONPeers) == 0 {
+			v.errorf(key, errMissingValue, "requires at least one reference clock or peer")
+		}
+		for j, s := range si.NTPReferenceClocks {
+			v.scionAddr(fmt.Sprintf("%s.ntp_reference_clocks[%d]", key, j), s, false)
+		}
+		for j, s := range si.SCIONPeers {
+			v.scionAddr(fmt.Sprintf("%s.scion_peers[%d]", key, j), s, true)
+		}
+		if si.Clock == "" {
+			continue
+		}
+		// The clock of an instance is disciplined by that instance only
+		devs := append(append(append([]string{}, cfg.PHCClocks...), cfg.PHCReferenceClocks...),
+			si.PHCReferenceClocks...)
+		for _, x := range cfg.SyncInstances[:i] {
+			devs = append(devs, x.Clock)
+		}
+		for _, d := range devs {
+			if sameDevice(si.Clock, d) {
+				v.errorf(key+".clock", errUnexpectedValue, "%q is already in use", si.Clock)
+				break
+			}
+		}
+	}
+}
+
+func (v *validator) validate(cfg *Service) {
+	v.scionAddr("local_address", cfg.LocalAddr, false)
+	v.scionAddr("remote_address", cfg.RemoteAddr, false)
+	if cfg.DaemonAddr != "" {
+		_, _, err := net.SplitHostPort(cfg.DaemonAddr)
+		if err != nil {
+			v.errorf("daemon_address", errInvalidAddress, "%q", cfg.DaemonAddr)
+		}
+	}
+	for i, s := range cfg.NTPReferenceClocks {
+		v.scionAddr(fmt.Sprintf("ntp_reference_clocks[%d]", i), s, false)
+	}
+	for i, s := range cfg.CSACClocks {
+		for _, r := range cfg.CSACReferenceClocks {
+			if sameDevice(s, r) {
+				v.errorf(fmt.Sprintf("csac_clocks[%d]", i), errUnexpectedValue,
+					"%q is also a CSAC reference clock", s)
+			}
+		}
+	}
+	// A PHC disciplined to the system clock can't serve as its reference
+	for i, s := range cfg.PHCClocks {
+		for _, r := range cfg.PHCReferenceClocks {
+			if sameDevice(s, r) {
+				v.errorf(fmt.Sprintf("phc_clocks[%d]", i), errUnexpectedValue,
+					"%q is also a PHC reference clock", s)
+			}
+		}
+	}
+	for i, s := range cfg.SCIONPeers {
+		v.scionAddr(fmt.Sprintf("scion_peers[%d]", i), s, true)
+	}
+	for i, s := range cfg.SCIONSymmetricPeers {
+		v.scionAddr(fmt.Sprintf("scion_symmetric_peers[%d]", i), s, true)
+	}
+	if cfg.FrequencyTransfer && len(cfg.SCIONSymmetricPeers) == 0 {
+		v.errorf("frequency_transfer", errMissingValue, "requires at least one SCION symmetric peer")
+	}
+	if cfg.FrequencyTransfer && !cfg.HasAuthMode(AuthModeSPAO) {
+		v.errorf("frequency_transfer", errMissingValue, "requires authentication mode %q", AuthModeSPAO)
+	}
+	if dc := cfg.PeerDiscovery; dc != nil {
+		v.require("peer_discovery.registry", dc.Registry)
+		v.duration("peer_discovery.interval", dc.Interval, time.Nanosecond)
+		if dc.MaxPeers < 0 {
+			v.errorf("peer_discovery.max_peers", errUnexpectedValue, "%d", dc.MaxPeers)
+		}
+		if len(cfg.SCIONPeers) == 0 && len(cfg.SCIONSymmetricPeers) == 0 {
+			v.errorf("peer_discovery", errMissingValue, "requires at least one configured SCION peer")
+		}
+	}
+	if rc := cfg.ComplianceReport; rc != nil {
+		v.require("compliance_report.directory", rc.Directory)
+		v.require("compliance_report.key_file", rc.KeyFile)
+		v.require("compliance_report.reference", rc.Reference)
+		v.duration("compliance_report.interval", rc.Interval, time.Minute)
+		v.duration("compliance_report.max_divergence", rc.MaxDivergence, 0)
+	}
+	if m := cfg.PHCMonitor; m != nil {
+		v.duration("phc_monitor.interval", m.Interval, time.Millisecond)
+		v.duration("phc_monitor.nominal", m.Nominal, math.MinInt64)
+		v.duration("phc_monitor.max_offset", m.MaxOffset, time.Nanosecond)
+	}
+	for i, t := range cfg.PacketTrains {
+		key := fmt.Sprintf("packet_trains[%d]", i)
+		v.require(key+".peer", t.Peer)
+		v.intRange(key+".length", t.Length, 2, MaxTrainLength)
+		d := v.duration(key+".spacing", t.Spacing, 0)
+		if time.Duration(t.Length-1)*d > MaxTrainDuration {
+			v.errorf(key+".spacing", errUnexpectedValue, "train exceeds %v", MaxTrainDuration)
+		}
+	}
+
+	// Authentication: SPAO requires DRKeys from the SCION daemon
+	for i, m := range cfg.AuthModes {
+		if m != AuthModeNTS && m != AuthModeSPAO {
+			v.errorf(fmt.Sprintf("auth_modes[%d]", i), errInvalidAuthMode, "%q", m)
+		}
+	}
+	if cfg.HasAuthMode(AuthModeSPAO) && cfg.DaemonAddr == "" && !scion.UseMockKeys() {
+		v.errorf("auth_modes", errMissingValue, "SPAO requires daemon_address for DRKey")
+	}
+	if cfg.SPAOAlgorithm != "" {
+		_, err := spao.ParseAlgorithm(cfg.SPAOAlgorithm)
+		if err != nil {
+			v.errorf("spao_algorithm", err, "%q", cfg.SPAOAlgorithm)
+		}
+	}
+	if (cfg.NTSKECertFile == "") != (cfg.NTSKEKeyFile == "") {
+		v.errorf("ntske_cert_file", errMissingValue, "ntske_cert_file and ntske_key_file must be set together")
+	}
+	if cfg.NTPKeyID != 0 && cfg.NTPKeysFile == "" {
+		v.errorf("ntp_key_id", errMissingValue, "requires ntp_keys_file")
+	}
+	if cfg.MetricsAddress != "" {
+		_, _, err := net.SplitHostPort(cfg.MetricsAddress)
+		if err != nil {
+			v.errorf("metrics_address", errInvalidAddress, "%q", cfg.MetricsAddress)
+		}
+	}
+	if cfg.GRPCAddress != "" {
+		_, _, err := net.SplitHostPort(cfg.GRPCAddress)
+		if err != nil {
+			v.errorf("grpc_address", errInvalidAddress, "%q", cfg.GRPCAddress)
+		}
+		v.require("grpc_cert_file", cfg.GRPCCertFile)
+		v.require("grpc_key_file", cfg.GRPCKeyFile)
+		v.require("grpc_client_ca_file", cfg.GRPCClientCAFile)
+	}
+	if len(cfg.GRPCRoles) != 0 && cfg.GRPCAddress == "" {
+		v.errorf("grpc_roles", errUnexpectedValue, "requires grpc_address")
+	}
+	for i, r := range cfg.GRPCRoles {
+		key := fmt.Sprintf("grpc_roles[%d]", i)
+		v.require(key+".name", r.Name)
+		if len(r.Clients) == 0 {
+			v.errorf(key+".clients", errMissingValue, "")
+		}
+		if len(r.Commands) == 0 {
+			v.errorf(key+".commands", errMissingValue, "")
+		}
+		for j, c := range r.Commands {
+			if c != control.AllCommands && !control.IsCommand(c) {
+				v.errorf(fmt.Sprintf("%s.commands[%d]", key, j), errUnexpectedValue,
+					"%q: unknown command", c)
+			}
+		}
+	}
+
+	v.duration("scion_path_probe_interval", cfg.PathProbeInterval, time.Nanosecond)
+	if cfg.DelayAttackDetection && cfg.PathProbeInterval == "" {
+		v.errorf("scion_delay_attack_detection", errMissingValue, "requires scion_path_probe_interval")
+	}
+	if cfg.EndhostPortRange != "" {
+		if !cfg.Dispatcherless {
+			v.errorf("scion_endhost_port_range", errUnexpectedValue, "requires scion_dispatcherless")
+		}
+		_, err := scion.ParsePortRange(cfg.EndhostPortRange)
+		if err != nil {
+			v.errorf("scion_endhost_port_range", err, "%q", cfg.EndhostPortRange)
+		}
+	}
+
+	v.intRange("ntp_min_ttl", cfg.NTPMinTTL, 0, 255)
+	if len(cfg.NTPClientDevice) >= 16 /* IFNAMSIZ */ {
+		v.errorf("ntp_client_device", errUnexpectedValue, "%q: name too long", cfg.NTPClientDevice)
+	}
+	v.duration("ntp_interleaved_max_age", cfg.NTPInterleavedMaxAge, 0)
+	if cfg.NTPRetryBudget < NoRetries {
+		v.errorf("ntp_retry_budget", errUnexpectedValue, "%d", cfg.NTPRetryBudget)
+	}
+	v.duration("ntp_attempt_timeout", cfg.NTPAttemptTimeout, 0)
+	if len(cfg.NTPControlAllow) != 0 && !cfg.NTPControl {
+		v.errorf("ntp_control_allow", errUnexpectedValue, "requires ntp_control")
+	}
+	v.prefixes("ntp_control_allow", cfg.NTPControlAllow)
+	if d := v.duration("server_reduced_precision", cfg.ServerReducedPrecision, 1); d != 0 && time.Second%d != 0 {
+		v.errorf("server_reduced_precision", errUnexpectedValue,
+			"%q does not divide a second evenly", cfg.ServerReducedPrecision)
+	}
+	if len(cfg.ServerFullPrecisionAllow) != 0 && cfg.ServerReducedPrecision == "" {
+		v.errorf("server_full_precision_allow", errUnexpectedValue, "requires server_reduced_precision")
+	}
+	v.scionPrefixes("server_full_precision_allow", cfg.ServerFullPrecisionAllow)
+	v.intRange("tai_offset", cfg.TAIOffset, 0, timebase.MaxTAIOffset)
+	v.duration("leap_seconds_refresh", cfg.LeapSecondsRefresh, time.Minute)
+	if cfg.LeapSecondsCache != "" && cfg.LeapSecondsList == "" {
+		v.errorf("leap_seconds_cache", errUnexpectedValue, "requires leap_seconds_list")
+	}
+	v.intRange("ptp_domain", cfg.PTPDomain, 0, 255)
+	if cfg.PTPDomain != 0 && cfg.PTPAnnounceInterface == "" {
+		v.errorf("ptp_domain", errUnexpectedValue, "requires ptp_announce_interface")
+	}
+	if cfg.PTPAnnounceInterface != "" {
+		v.require("ptp_grandmaster", cfg.PTPGrandmaster)
+	}
+	if cfg.PTPGrandmaster != "" {
+		if cfg.PTPAnnounceInterface == "" {
+			v.errorf("ptp_grandmaster", errUnexpectedValue, "requires ptp_announce_interface")
+		}
+		if _, err := ptp.ParseClockIdentity(cfg.PTPGrandmaster); err != nil {
+			v.errorf("ptp_grandmaster", err, "%q", cfg.PTPGrandmaster)
+		}
+	}
+
+	for i, l := range cfg.Listeners {
+		key := fmt.Sprintf("listeners[%d]", i)
+		v.require(key+".local_address", l.LocalAddr)
+		scionListener := false
+		for j, p := range l.Protocols {
+			switch p {
+			case ListenerProtocolIP:
+			case ListenerProtocolSCION:
+				scionListener = true
+			default:
+				v.errorf(fmt.Sprintf("%s.protocols[%d]", key, j), errUnexpectedValue, "%q", p)
+			}
+		}
+		v.scionAddr(key+".local_address", l.LocalAddr, scionListener)
+	}
+	if cfg.ServerWorkers < 0 {
+		v.errorf("server_workers", errUnexpectedValue, "%d", cfg.ServerWorkers)
+	}
+	if cfg.ServerCPUAffinity && cfg.ServerWorkers == 0 {
+		v.errorf("server_cpu_affinity", errUnexpectedValue, "requires server_workers")
+	}
+	if cfg.ServerBatchSize < 0 {
+		v.errorf("server_batch_size", errUnexpectedValue, "%d", cfg.ServerBatchSize)
+	}
+	v.duration("server_busy_poll", cfg.ServerBusyPoll, 0)
+	if cfg.ServerQueueLength < 0 {
+		v.errorf("server_queue_length", errUnexpectedValue, "%d", cfg.ServerQueueLength)
+	}
+	if cfg.ServerQueueWorkers < 0 {
+		v.errorf("server_queue_workers", errUnexpectedValue, "%d", cfg.ServerQueueWorkers)
+	}
+	if cfg.ServerQueueWorkers != 0 && cfg.ServerQueueLength == 0 {
+		v.errorf("server_queue_workers", errUnexpectedValue, "requires server_queue_length")
+	}
+	if cfg.ServerTiers != nil {
+		for _, x := range []struct {
+			key string
+			t   *ServerTier
+		}{
+			{"server_tiers.authenticated", cfg.ServerTiers.Authenticated},
+			{"server_tiers.unauthenticated", cfg.ServerTiers.Unauthenticated},
+		} {
+			key, t := x.key, x.t
+			if t == nil {
+				continue
+			}
+			if t.Rate < 0 {
+				v.errorf(key+".rate", errUnexpectedValue, "%v", t.Rate)
+			}
+			if t.Burst < 0 {
+				v.errorf(key+".burst", errUnexpectedValue, "%d", t.Burst)
+			}
+			if t.Burst != 0 && t.Rate == 0 {
+				v.errorf(key+".burst", errUnexpectedValue, "requires rate")
+			}
+		}
+	}
+	if cfg.XDPQueues < 0 {
+		v.errorf("xdp_queues", errUnexpectedValue, "%d", cfg.XDPQueues)
+	}
+	for i, b := range cfg.NTPBroadcast {
+		key := fmt.Sprintf("ntp_broadcast[%d]", i)
+		v.ipAddrPort(key+".address", b.Address)
+		v.duration(key+".interval", b.Interval, time.Second)
+		v.broadcastKey(key+".key_id", b.KeyID, cfg.NTPKeysFile)
+	}
+	for i, b := range cfg.NTPBroadcastReferences {
+		key := fmt.Sprintf("ntp_broadcast_references[%d]", i)
+		v.ipAddrPort(key+".address", b.Address)
+		v.require(key+".server", b.Server)
+		v.scionAddr(key+".server", b.Server, false)
+		v.broadcastKey(key+".key_id", b.KeyID, cfg.NTPKeysFile)
+	}
+	for i, r := range cfg.NTPDualReferenceClocks {
+		key := fmt.Sprintf("ntp_dual_reference_clocks[%d]", i)
+		v.require(key+".scion", r.SCION)
+		v.scionAddr(key+".scion", r.SCION, true)
+		v.require(key+".ip", r.IP)
+		v.scionAddr(key+".ip", r.IP, false)
+	}
+	v.syncInstances(cfg)
+
+	switch cfg.FilterWeighting {
+	case "", FilterWeightingDelay, FilterWeightingDelaySquared,
+		FilterWeightingDispersion, FilterWeightingUniform:
+	default:
+		v.errorf("filter_weighting", errUnexpectedValue, "%q", cfg.FilterWeighting)
+	}
+
+	switch cfg.ClockStepMode {
+	case ClockStepModeInitial, ClockStepModeNever:
+		if cfg.ClockStepThreshold != "" || cfg.ClockStepLimit != 0 {
+			v.errorf("clock_step_mode", errUnexpectedValue,
+				"clock_step_threshold and clock_step_limit require threshold step mode")
+		}
+	case ClockStepModeThreshold:
+		v.duration("clock_step_threshold", cfg.ClockStepThreshold, 0)
+	default:
+		v.errorf("clock_step_mode", errUnexpectedValue, "%q", cfg.ClockStepMode)
+	}
+	if cfg.ClockStepLimit < 0 {
+		v.errorf("clock_step_limit", errUnexpectedValue, "%d", cfg.ClockStepLimit)
+	}
+	if cc := cfg.ClockStepCrossCheck; cc != nil {
+		v.duration("clock_step_cross_check.threshold", cc.Threshold, 0)
+		v.require("clock_step_cross_check.bound", cc.Bound)
+		v.duration("clock_step_cross_check.bound", cc.Bound, time.Nanosecond)
+		v.duration("clock_step_cross_check.max_age", cc.MaxAge, time.Second)
+	}
+	v.duration("clock_panic_threshold", cfg.ClockPanicThreshold, 0)
+	if cfg.ClockPanicIgnore < 0 || cfg.ClockPanicIgnore != 0 && cfg.ClockPanicThreshold == "" {
+		v.errorf("clock_panic_ignore", errUnexpectedValue, "requires clock_panic_threshold")
+	}
+	v.pollBounds("local_min_poll", cfg.LocalMinPoll, "local_max_poll", cfg.LocalMaxPoll)
+	v.pollBounds("global_min_poll", cfg.GlobalMinPoll, "global_max_poll", cfg.GlobalMaxPoll)
+
+	if cfg.OutlierThreshold < 0 {
+		v.errorf("outlier_threshold", errUnexpectedValue, "%v", cfg.OutlierThreshold)
+	}
+	if cfg.OrphanStratum != 0 {
+		v.intRange("orphan_stratum", cfg.OrphanStratum, 1, 15)
+	}
+	if cfg.OrphanThreshold != "" && cfg.OrphanStratum == 0 {
+		v.errorf("orphan_threshold", errUnexpectedValue, "requires orphan_stratum")
+	}
+	v.duration("orphan_threshold", cfg.OrphanThreshold, 0)
+	if cfg.OffsetGateFraction < 0 {
+		v.errorf("offset_gate_fraction", errUnexpectedValue, "%v", cfg.OffsetGateFraction)
+	}
+	v.duration("offset_gate_budget", cfg.OffsetGateBudget, 0)
+	if s := cfg.SCIONStream; s != nil {
+		v.duration("scion_stream.overhead", s.Overhead, 0)
+	}
+	v.buckets("offset_histogram_buckets", cfg.OffsetHistogramBuckets)
+	v.buckets("delay_histogram_buckets", cfg.DelayHistogramBuckets)
+	if cfg.TracingSampleRatio < 0 || cfg.TracingSampleRatio > 1 {
+		v.errorf("tracing_sample_ratio", errUnexpectedValue, "%v not in range [0, 1]", cfg.TracingSampleRatio)
+	}
+	switch cfg.MetricsExporter {
+	case "", metrics.ExporterStatsd, metrics.ExporterOTLP:
+	default:
+		v.errorf("metrics_exporter", errUnexpectedValue, "%q", cfg.MetricsExporter)
+	}
+	if cfg.MetricsEndpoint != "" && cfg.MetricsExporter == "" {
+		v.errorf("metrics_endpoint", errUnexpectedValue, "requires metrics_exporter")
+	}
+	v.duration("metrics_export_interval", cfg.MetricsExportInterval, time.Second)
+	if cfg.DSCP != "" {
+		_, ok := ParseDSCP(cfg.DSCP)
+		if !ok {
+			v.errorf("dscp", errInvalidDSCP, "%q", cfg.DSCP)
+		}
+	}
+	v.intRange("socket_priority", cfg.SocketPriority, 0, 0xffff)
+	if cfg.EventLogSize < 0 {
+		v.errorf("event_log_size", errUnexpectedValue, "%d", cfg.EventLogSize)
+	}
+	if cfg.Chroot != "" && !filepath.IsAbs(cfg.Chroot) {
+		v.errorf("chroot", errUnexpectedValue, "%q is not an absolute path", cfg.Chroot)
+	}
+	if (cfg.User != "" || cfg.Chroot != "") && cfg.SocketPriority > 6 {
+		// Client sockets are opened after CAP_NET_ADMIN has been dropped
+		v.errorf("socket_priority", errUnexpectedValue, "%d requires CAP_NET_ADMIN, which is dropped with user or chroot",
+			cfg.SocketPriority)
+	}
+	if !seccomp.ValidMode(cfg.Seccomp) {
+		v.errorf("seccomp", errUnexpectedValue, "%q", cfg.Seccomp)
+	}
+
+	if fc := cfg.FaultInjection; fc != nil {
+		v.probability("fault_injection.drop", fc.Drop)
+		v.probability("fault_injection.duplicate", fc.Duplicate)
+		v.probability("fault_injection.corrupt", fc.Corrupt)
+		v.probability("fault_injection.delay", fc.Delay)
+		v.duration("fault_injection.max_delay", fc.MaxDelay, 0)
+	}
+}
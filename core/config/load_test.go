@@ -0,0 +1,326 @@
+package config_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"example.com/scion-time/core/config"
+)
+
+func TestParseErrors(t *testing.T) {
+	raw := []byte(`local_address = "1-ff00:0:111,10.1.1.11:123"
+local_min_poll = "1m"
+local_max_poll = "1s"
+
+[[listeners]]
+local_address = "10.1.1.11:123"
+
+[[listeners]]
+local_address = "10.1.1.12:123"
+protocols = ["tcp"]
+`)
+	_, err := config.Parse(raw)
+	var errs config.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Parse returned %v; want config.Errors", err)
+	}
+	want := []struct {
+		line int
+		key  string
+	}{
+		{6, "listeners[0].local_address"},
+		{10, "listeners[1].protocols[0]"},
+		{9, "listeners[1].local_address"},
+		{2, "local_min_poll"},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("Parse returned %d errors; want %d: %v", len(errs), len(want), errs)
+	}
+	for i, w := range want {
+		if errs[i].Line != w.line || errs[i].Key != w.key {
+			t.Errorf("Parse error %d == %v; want line %d, key %s", i, errs[i], w.line, w.key)
+		}
+	}
+}
+
+func TestParseDeviceConflicts(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "ptp0"), nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(filepath.Join(dir, "ptp0"), filepath.Join(dir, "ptp_eth0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := []byte(fmt.Sprintf(`phc_reference_clocks = ["/dev/ptp1", "%[1]s/ptp_eth0"]
+phc_clocks = ["/dev/ptp2", "/dev/ptp1", "%[1]s/ptp0"]
+csac_reference_clocks = ["/dev/ttyS0"]
+csac_clocks = ["/dev/./ttyS0"]
+`, dir))
+	_, err = config.Parse(raw)
+	var errs config.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Parse returned %v; want config.Errors", err)
+	}
+	want := []string{"csac_clocks[0]", "phc_clocks[1]", "phc_clocks[2]"}
+	if len(errs) != len(want) {
+		t.Fatalf("Parse returned %d errors; want %d: %v", len(errs), len(want), errs)
+	}
+	for i, w := range want {
+		if errs[i].Key != w {
+			t.Errorf("Parse error %d == %v; want key %s", i, errs[i], w)
+		}
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	cfg, err := config.Parse([]byte(`local_max_poll = "16s"
+ntp_keys_file = "ntp.keys"
+
+[[ntp_broadcast]]
+address = "10.1.1.255:123"
+key_id = 1
+`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if cfg.ClockStepMode != config.ClockStepModeInitial ||
+		cfg.LocalMinPoll != "16s" ||
+		config.Duration(cfg.NTPBroadcast[0].Interval) != config.DefaultBroadcastInterval {
+		t.Errorf("Parse did not apply defaults: %+v", cfg)
+	}
+}
+
+func TestParseHistogramBuckets(t *testing.T) {
+	for _, tc := range []struct {
+		buckets string
+		ok      bool
+	}{
+		{`["100ns", "1us", "1ms"]`, true},
+		{`[]`, false},
+		{`["1us", "1us"]`, false},
+		{`["1ms", "1us"]`, false},
+		{`["0s"]`, false},
+		{`["-1us"]`, false},
+	} {
+		_, err := config.Parse([]byte("offset_histogram_buckets = " + tc.buckets))
+		if (err == nil) != tc.ok {
+			t.Errorf("Parse(offset_histogram_buckets = %s) = %v; want ok == %v", tc.buckets, err, tc.ok)
+		}
+	}
+}
+
+func TestParseSocketPriorityPrivileges(t *testing.T) {
+	for _, tc := range []struct {
+		raw string
+		ok  bool
+	}{
+		{"socket_priority = 7", true},
+		{"socket_priority = 6\nuser = \"nobody\"", true},
+		// Priorities above 6 require CAP_NET_ADMIN, which is dropped
+		{"socket_priority = 7\nuser = \"nobody\"", false},
+		{"socket_priority = 7\nchroot = \"/var/empty\"", false},
+	} {
+		_, err := config.Parse([]byte(tc.raw))
+		if (err == nil) != tc.ok {
+			t.Errorf("Parse(%q) = %v; want ok == %v", tc.raw, err, tc.ok)
+		}
+	}
+}
+
+func TestParseRetryBudget(t *testing.T) {
+	for _, tc := range []struct {
+		budget int
+		ok     bool
+	}{
+		{0, true},
+		{5, true},
+		{config.NoRetries, true},
+		{-2, false},
+	} {
+		raw := fmt.Sprintf("ntp_retry_budget = %d", tc.budget)
+		cfg, err := config.Parse([]byte(raw))
+		if (err == nil) != tc.ok {
+			t.Errorf("Parse(%q) = %v; want ok == %v", raw, err, tc.ok)
+		}
+		if err == nil && cfg.NTPRetryBudget != tc.budget {
+			t.Errorf("Parse(%q): ntp_retry_budget == %d; want %d", raw, cfg.NTPRetryBudget, tc.budget)
+		}
+	}
+}
+
+func TestParsePTPGrandmaster(t *testing.T) {
+	for _, tc := range []struct {
+		raw string
+		ok  bool
+	}{
+		{`ptp_announce_interface = "eth0"
+ptp_grandmaster = "00:11:22:ff:fe:33:44:55"`, true},
+		{`ptp_announce_interface = "eth0"
+ptp_grandmaster = "001122fffe334455"`, true},
+		{`ptp_announce_interface = "eth0"`, false},
+		{`ptp_announce_interface = "eth0"
+ptp_grandmaster = "00:11:22"`, false},
+		{`ptp_grandmaster = "001122fffe334455"`, false},
+	} {
+		_, err := config.Parse([]byte(tc.raw))
+		if (err == nil) != tc.ok {
+			t.Errorf("Parse(%q) = %v; want ok == %v", tc.raw, err, tc.ok)
+		}
+	}
+}
+
+func TestParseSyncInstances(t *testing.T) {
+	raw := []byte(`phc_clocks = ["/dev/ptp0"]
+
+[[sync_instances]]
+name = "a"
+clock = "/dev/ptp1"
+ntp_reference_clocks = ["0-0,10.1.1.11:123"]
+
+[[sync_instances]]
+name = "b"
+clock = "/dev/ptp2"
+scion_peers = ["1-ff00:0:111,10.1.1.11:123"]
+`)
+	cfg, err := config.Parse(raw)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(cfg.SyncInstances) != 2 || cfg.SyncInstances[1].Name != "b" ||
+		len(cfg.SyncInstances[1].SCIONPeers) != 1 {
+		t.Errorf("Parse returned sync instances %+v", cfg.SyncInstances)
+	}
+
+	raw = []byte(`phc_clocks = ["/dev/ptp0"]
+
+[[sync_instances]]
+name = "a"
+clock = "/dev/ptp0"
+ntp_reference_clocks = ["0-0,10.1.1.11:123"]
+
+[[sync_instances]]
+name = "a"
+clock = "/dev/ptp1"
+
+[[sync_instances]]
+clock = "/dev/ptp1"
+scion_peers = ["0-0,10.1.1.11:123"]
+`)
+	_, err = config.Parse(raw)
+	var errs config.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Parse returned %v; want config.Errors", err)
+	}
+	want := []string{
+		"sync_instances[0].clock",
+		"sync_instances[1].name",
+		"sync_instances[1]",
+		"sync_instances[2].name",
+		"sync_instances[2].scion_peers[0]",
+		"sync_instances[2].clock",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("Parse returned %d errors; want %d: %v", len(errs), len(want), errs)
+	}
+	for i, w := range want {
+		if errs[i].Key != w {
+			t.Errorf("Parse error %d == %v; want key %s", i, errs[i], w)
+		}
+	}
+}
+
+func TestParseSCIONStreamOverhead(t *testing.T) {
+	_, err := config.Parse([]byte(`[scion_stream]
+overhead = "2ms"
+`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	_, err = config.Parse([]byte(`[scion_stream]
+overhead = "-2ms"
+`))
+	var errs config.Errors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Key != "scion_stream.overhead" {
+		t.Errorf("Parse returned %v; want error for scion_stream.overhead", err)
+	}
+}
+
+func TestParsePrefix(t *testing.T) {
+	for _, tc := range []struct {
+		s      string
+		ia     string
+		prefix string
+		ok     bool
+	}{
+		{"10.1.1.0/24", "0-0", "10.1.1.0/24", true},
+		{"10.1.1.1", "0-0", "10.1.1.1/32", true},
+		{"2001:db8::1/32", "0-0", "2001:db8::/32", true},
+		{"1-ff00:0:111,10.1.1.0/24", "1-ff00:0:111", "10.1.1.0/24", true},
+		{"1-ff00:0:111,2001:db8::1", "1-ff00:0:111", "2001:db8::1/128", true},
+		{"0-0,10.1.1.0/24", "", "", false},
+		{"1-ff00:0:111,", "", "", false},
+		{"x,10.1.1.0/24", "", "", false},
+		{"10.1.1.0/33", "", "", false},
+	} {
+		ia, p, err := config.ParsePrefix(tc.s)
+		if (err == nil) != tc.ok {
+			t.Errorf("ParsePrefix(%q) = %v; want ok == %v", tc.s, err, tc.ok)
+			continue
+		}
+		if err == nil && (ia.String() != tc.ia || p.String() != tc.prefix) {
+			t.Errorf("ParsePrefix(%q) = %v, %v; want %s, %s", tc.s, ia, p, tc.ia, tc.prefix)
+		}
+	}
+}
+
+func TestParseGRPCRoles(t *testing.T) {
+	const prefix = `grpc_address = "127.0.0.1:9090"
+grpc_cert_file = "server.crt"
+grpc_key_file = "server.key"
+grpc_client_ca_file = "ca.crt"
+
+[[grpc_roles]]
+name = "ops"
+clients = ["ops.example.com"]
+`
+	for _, tc := range []struct {
+		commands string
+		ok       bool
+	}{
+		{`["*"]`, true},
+		{`["sources", "tracking"]`, true},
+		{`["sources", "trackin"]`, false},
+		{`["step/"]`, false},
+		{`[]`, false},
+	} {
+		raw := prefix + "commands = " + tc.commands
+		_, err := config.Parse([]byte(raw))
+		if (err == nil) != tc.ok {
+			t.Errorf("Parse(commands = %s) = %v; want ok == %v", tc.commands, err, tc.ok)
+		}
+	}
+}
+
+func TestParseOrphanMode(t *testing.T) {
+	for _, tc := range []struct {
+		raw string
+		ok  bool
+	}{
+		{"orphan_stratum = 10\norphan_threshold = \"5m\"", true},
+		{"orphan_stratum = 10", true},
+		{"orphan_stratum = 16", false},
+		{"orphan_threshold = \"5m\"", false},
+		{"orphan_stratum = 10\norphan_threshold = \"-5m\"", false},
+	} {
+		_, err := config.Parse([]byte(tc.raw))
+		if (err == nil) != tc.ok {
+			t.Errorf("Parse(%q) = %v; want ok == %v", tc.raw, err, tc.ok)
+		}
+	}
+}
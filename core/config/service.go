@@ -0,0 +1,439 @@
+package config
+
+// Configuration file of the time service: the schema of the TOML document and
+// the defaults applied to it.
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+
+	"example.com/scion-time/base/metrics"
+)
+
+const (
+	AuthModeNTS  = "nts"
+	AuthModeSPAO = "spao"
+
+	ClockStepModeInitial   = "initial"
+	ClockStepModeThreshold = "threshold"
+	ClockStepModeNever     = "never"
+
+	FilterWeightingDelay        = "delay"
+	FilterWeightingDelaySquared = "delay_squared"
+	FilterWeightingDispersion   = "dispersion"
+	FilterWeightingUniform      = "uniform"
+
+	ListenerProtocolIP    = "ip"
+	ListenerProtocolSCION = "scion"
+
+	DefaultBroadcastInterval   = 64 * time.Second
+	DefaultDiscoveryInterval   = time.Hour
+	DefaultReportInterval      = 24 * time.Hour
+	DefaultLeapSecondsRefresh  = 24 * time.Hour
+	DefaultTrainSpacing        = 10 * time.Millisecond
+	DefaultCrossCheckMaxAge    = 15 * time.Minute
+	DefaultPHCMonitorInterval  = time.Second
+	DefaultPHCMonitorMaxOffset = time.Millisecond
+	MaxTrainLength             = 16
+	MaxTrainDuration           = 500 * time.Millisecond
+	DefaultTemperatureScale    = 0.001 // sysfs hwmon values are in millidegrees Celsius
+	DefaultMetricsAddress      = "127.0.0.1:8080"
+
+	// NoRetries is the value of ntp_retry_budget for measurements that fail
+	// on the first discarded packet, as 0 selects the default budget.
+	NoRetries = -1
+)
+
+type Service struct {
+	LocalAddr                   string               `toml:"local_address,omitempty"`
+	DaemonAddr                  string               `toml:"daemon_address,omitempty"`
+	RemoteAddr                  string               `toml:"remote_address,omitempty"`
+	MBGReferenceClocks          []string             `toml:"mbg_reference_clocks,omitempty"`
+	NTPReferenceClocks          []string             `toml:"ntp_reference_clocks,omitempty"`
+	PHCReferenceClocks          []string             `toml:"phc_reference_clocks,omitempty"`
+	PHCClocks                   []string             `toml:"phc_clocks,omitempty"`
+	CSACReferenceClocks         []string             `toml:"csac_reference_clocks,omitempty"`
+	CSACClocks                  []string             `toml:"csac_clocks,omitempty"`
+	SCIONPeers                  []string             `toml:"scion_peers,omitempty"`
+	SCIONSymmetricPeers         []string             `toml:"scion_symmetric_peers,omitempty"`
+	FrequencyTransfer           bool                 `toml:"frequency_transfer,omitempty"`
+	PeerDiscovery               *Discovery           `toml:"peer_discovery,omitempty"`
+	NTSKECertFile               string               `toml:"ntske_cert_file,omitempty"`
+	NTSKEKeyFile                string               `toml:"ntske_key_file,omitempty"`
+	NTSKEServerName             string               `toml:"ntske_server_name,omitempty"`
+	AuthModes                   []string             `toml:"auth_modes,omitempty"`
+	SPAOAlgorithm               string               `toml:"spao_algorithm,omitempty"`
+	NTSKEInsecureSkipVerify     bool                 `toml:"ntske_insecure_skip_verify,omitempty"`
+	PathProbeInterval           string               `toml:"scion_path_probe_interval,omitempty"`
+	DelayAttackDetection        bool                 `toml:"scion_delay_attack_detection,omitempty"`
+	ServerTimestamps            bool                 `toml:"scion_server_timestamps,omitempty"`
+	ControlSocket               string               `toml:"control_socket,omitempty"`
+	MetricsAddress              string               `toml:"metrics_address,omitempty"`
+	GRPCAddress                 string               `toml:"grpc_address,omitempty"`
+	GRPCCertFile                string               `toml:"grpc_cert_file,omitempty"`
+	GRPCKeyFile                 string               `toml:"grpc_key_file,omitempty"`
+	GRPCClientCAFile            string               `toml:"grpc_client_ca_file,omitempty"`
+	GRPCRoles                   []GRPCRole           `toml:"grpc_roles,omitempty"`
+	Dispatcherless              bool                 `toml:"scion_dispatcherless,omitempty"`
+	EndhostPortRange            string               `toml:"scion_endhost_port_range,omitempty"`
+	NTPKeysFile                 string               `toml:"ntp_keys_file,omitempty"`
+	NTPKeyID                    uint32               `toml:"ntp_key_id,omitempty"`
+	NTPMinTTL                   int                  `toml:"ntp_min_ttl,omitempty"`
+	NTPInterleavedMaxAge        string               `toml:"ntp_interleaved_max_age,omitempty"`
+	NTPRetryBudget              int                  `toml:"ntp_retry_budget,omitempty"`
+	NTPClientDevice             string               `toml:"ntp_client_device,omitempty"`
+	NTPAttemptTimeout           string               `toml:"ntp_attempt_timeout,omitempty"`
+	NTPControl                  bool                 `toml:"ntp_control,omitempty"`
+	NTPControlAllow             []string             `toml:"ntp_control_allow,omitempty"`
+	Listeners                   []Listener           `toml:"listeners,omitempty"`
+	ServerWorkers               int                  `toml:"server_workers,omitempty"`
+	ServerCPUAffinity           bool                 `toml:"server_cpu_affinity,omitempty"`
+	ServerBatchSize             int                  `toml:"server_batch_size,omitempty"`
+	ServerBusyPoll              string               `toml:"server_busy_poll,omitempty"`
+	ServerGRO                   bool                 `toml:"server_gro,omitempty"`
+	ServerQueueLength           int                  `toml:"server_queue_length,omitempty"`
+	ServerQueueWorkers          int                  `toml:"server_queue_workers,omitempty"`
+	ServerTiers                 *ServerTiers         `toml:"server_tiers,omitempty"`
+	ServerTXTimestampCorrection bool                 `toml:"server_tx_timestamp_correction,omitempty"`
+	ServerReducedPrecision      string               `toml:"server_reduced_precision,omitempty"`
+	ServerFullPrecisionAllow    []string             `toml:"server_full_precision_allow,omitempty"`
+	NTPv5                       bool                 `toml:"ntpv5_experimental,omitempty"`
+	NTPTAIOffsetExtension       bool                 `toml:"ntp_tai_offset_extension,omitempty"`
+	TAIOffset                   int                  `toml:"tai_offset,omitempty"`
+	LeapSecondsList             string               `toml:"leap_seconds_list,omitempty"`
+	LeapSecondsCache            string               `toml:"leap_seconds_cache,omitempty"`
+	LeapSecondsRefresh          string               `toml:"leap_seconds_refresh,omitempty"`
+	PTPAnnounceInterface        string               `toml:"ptp_announce_interface,omitempty"`
+	PTPDomain                   int                  `toml:"ptp_domain,omitempty"`
+	PTPGrandmaster              string               `toml:"ptp_grandmaster,omitempty"`
+	NTPBroadcast                []Broadcast          `toml:"ntp_broadcast,omitempty"`
+	NTPBroadcastReferences      []BroadcastReference `toml:"ntp_broadcast_references,omitempty"`
+	NTPDualReferenceClocks      []DualReference      `toml:"ntp_dual_reference_clocks,omitempty"`
+	SyncInstances               []SyncInstance       `toml:"sync_instances,omitempty"`
+	XDPInterface                string               `toml:"xdp_interface,omitempty"`
+	XDPQueues                   int                  `toml:"xdp_queues,omitempty"`
+	ClockStepMode               string               `toml:"clock_step_mode,omitempty"`
+	ClockStepThreshold          string               `toml:"clock_step_threshold,omitempty"`
+	ClockStepLimit              int                  `toml:"clock_step_limit,omitempty"`
+	ClockStepCrossCheck         *StepCrossCheck      `toml:"clock_step_cross_check,omitempty"`
+	ClockPanicThreshold         string               `toml:"clock_panic_threshold,omitempty"`
+	ClockPanicIgnore            int                  `toml:"clock_panic_ignore,omitempty"`
+	LocalMinPoll                string               `toml:"local_min_poll,omitempty"`
+	LocalMaxPoll                string               `toml:"local_max_poll,omitempty"`
+	GlobalMinPoll               string               `toml:"global_min_poll,omitempty"`
+	GlobalMaxPoll               string               `toml:"global_max_poll,omitempty"`
+	TracingExporter             string               `toml:"tracing_exporter,omitempty"`
+	TracingEndpoint             string               `toml:"tracing_endpoint,omitempty"`
+	TracingSampleRatio          float64              `toml:"tracing_sample_ratio,omitempty"`
+	MetricsExporter             string               `toml:"metrics_exporter,omitempty"`
+	MetricsEndpoint             string               `toml:"metrics_endpoint,omitempty"`
+	MetricsExportInterval       string               `toml:"metrics_export_interval,omitempty"`
+	DriftFile                   string               `toml:"drift_file,omitempty"`
+	PeerStateFile               string               `toml:"peer_state_file,omitempty"`
+	OrphanStratum               int                  `toml:"orphan_stratum,omitempty"`
+	OrphanThreshold             string               `toml:"orphan_threshold,omitempty"`
+	ClockInterpolation          bool                 `toml:"clock_interpolation,omitempty"`
+	OutlierThreshold            float64              `toml:"outlier_threshold,omitempty"`
+	FilterWeighting             string               `toml:"filter_weighting,omitempty"`
+	WeightedCombination         bool                 `toml:"weighted_combination,omitempty"`
+	OffsetGateFraction          float64              `toml:"offset_gate_fraction,omitempty"`
+	OffsetGateBudget            string               `toml:"offset_gate_budget,omitempty"`
+	OffsetHistogramBuckets      []string             `toml:"offset_histogram_buckets,omitempty"`
+	DelayHistogramBuckets       []string             `toml:"delay_histogram_buckets,omitempty"`
+	TemperatureSensor           string               `toml:"temperature_sensor,omitempty"`
+	TemperatureScale            float64              `toml:"temperature_scale,omitempty"`
+	User                        string               `toml:"user,omitempty"`
+	Chroot                      string               `toml:"chroot,omitempty"`
+	Seccomp                     string               `toml:"seccomp,omitempty"`
+	DSCP                        string               `toml:"dscp,omitempty"`
+	SocketPriority              int                  `toml:"socket_priority,omitempty"`
+	FaultInjection              *FaultInjection      `toml:"fault_injection,omitempty"`
+	PcapFile                    string               `toml:"pcap_file,omitempty"`
+	EventLogSize                int                  `toml:"event_log_size,omitempty"`
+	EventLogSyslog              bool                 `toml:"event_log_syslog,omitempty"`
+	AuditLogFile                string               `toml:"audit_log_file,omitempty"`
+	ComplianceReport            *ComplianceReport    `toml:"compliance_report,omitempty"`
+	PacketTrains                []PacketTrain        `toml:"packet_trains,omitempty"`
+	PathDiversity               *PathDiversity       `toml:"path_diversity,omitempty"`
+	SCIONStream                 *SCIONStream         `toml:"scion_stream,omitempty"`
+	PHCMonitor                  *PHCMonitor          `toml:"phc_monitor,omitempty"`
+}
+
+type FaultInjection struct {
+	Seed      int64   `toml:"seed,omitempty"`
+	Drop      float64 `toml:"drop,omitempty"`
+	Duplicate float64 `toml:"duplicate,omitempty"`
+	Corrupt   float64 `toml:"corrupt,omitempty"`
+	Delay     float64 `toml:"delay,omitempty"`
+	MaxDelay  string  `toml:"max_delay,omitempty"`
+}
+
+// ComplianceReport configures periodic reports of the clock offsets relative
+// to Reference, e.g., "UTC(PTB)", signed with the Ed25519 key in KeyFile.
+type ComplianceReport struct {
+	Directory     string `toml:"directory,omitempty"`
+	Interval      string `toml:"interval,omitempty"`
+	KeyFile       string `toml:"key_file,omitempty"`
+	Reference     string `toml:"reference,omitempty"`
+	MaxDivergence string `toml:"max_divergence,omitempty"`
+}
+
+// ServerTiers configures the service of requests received via SCION depending
+// on whether they are authenticated via SPAO/DRKey or NTS.
+type ServerTiers struct {
+	Authenticated   *ServerTier `toml:"authenticated,omitempty"`
+	Unauthenticated *ServerTier `toml:"unauthenticated,omitempty"`
+}
+
+// ServerTier restricts the service of a tier. Rate limits the requests per
+// second and client with bursts of up to Burst requests.
+type ServerTier struct {
+	Refuse             bool    `toml:"refuse,omitempty"`
+	Rate               float64 `toml:"rate,omitempty"`
+	Burst              int     `toml:"burst,omitempty"`
+	NoInterleaved      bool    `toml:"no_interleaved,omitempty"`
+	SoftwareTimestamps bool    `toml:"software_timestamps,omitempty"`
+}
+
+// StepCrossCheck withholds clock steps larger than Threshold unless the
+// offsets measured from at least two independent sources, e.g., a reference
+// clock and a SCION peer, or SCION peers reached via disjoint paths, agree
+// with the step within Bound. Offsets older than
+// MaxAge are not considered.
+type StepCrossCheck struct {
+	Threshold string `toml:"threshold,omitempty"`
+	Bound     string `toml:"bound,omitempty"`
+	MaxAge    string `toml:"max_age,omitempty"`
+}
+
+// PacketTrain enables experimental packet train measurements of Length
+// exchanges spaced by Spacing to the reference clock or peer Peer, given as
+// in ntp_reference_clocks or scion_peers.
+type PacketTrain struct {
+	Peer    string `toml:"peer,omitempty"`
+	Length  int    `toml:"length,omitempty"`
+	Spacing string `toml:"spacing,omitempty"`
+}
+
+// PathDiversity varies the SCION paths and flow IDs of consecutive
+// measurements to the same peer so that load-balanced network elements are
+// sampled uniformly. PinInterleaved keeps the path and flow ID of clients in
+// interleaved mode.
+type PathDiversity struct {
+	RotatePaths    bool `toml:"rotate_paths,omitempty"`
+	RotateFlowIDs  bool `toml:"rotate_flow_ids,omitempty"`
+	PinInterleaved bool `toml:"pin_interleaved,omitempty"`
+}
+
+// SCIONStream configures NTP over QUIC streams over SCION for paths on which
+// middleboxes drop NTP packets sent as UDP datagrams. Serve enables the stream
+// server on all SCION listeners, Fallback lets SCION peers and reference clocks
+// fall back to the stream transport if their datagram exchanges fail. Overhead
+// is the estimated delay added by the stream transport on either side.
+type SCIONStream struct {
+	Serve    bool   `toml:"serve,omitempty"`
+	Fallback bool   `toml:"fallback,omitempty"`
+	Overhead string `toml:"overhead,omitempty"`
+}
+
+// PHCMonitor configures the monitoring of the offsets of the PHCs in use and
+// of the additional PHC Devices relative to the system clock every Interval. A
+// PHC diverges if its offset deviates from Nominal by more than MaxOffset.
+type PHCMonitor struct {
+	Devices   []string `toml:"devices,omitempty"`
+	Interval  string   `toml:"interval,omitempty"`
+	Nominal   string   `toml:"nominal,omitempty"`
+	MaxOffset string   `toml:"max_offset,omitempty"`
+}
+
+type Listener struct {
+	LocalAddr string   `toml:"local_address,omitempty"`
+	Protocols []string `toml:"protocols,omitempty"`
+}
+
+type Discovery struct {
+	Registry string   `toml:"registry,omitempty"`
+	Interval string   `toml:"interval,omitempty"`
+	ISDs     []uint16 `toml:"isds,omitempty"`
+	MaxPeers int      `toml:"max_peers,omitempty"`
+}
+
+// Broadcast packets are authenticated with the symmetric key KeyID from the
+// NTP keys file, which is also used for the unicast calibration exchanges of
+// broadcast clients.
+type Broadcast struct {
+	Address  string `toml:"address,omitempty"`
+	Interval string `toml:"interval,omitempty"`
+	KeyID    uint32 `toml:"key_id,omitempty"`
+}
+
+type BroadcastReference struct {
+	Address string `toml:"address,omitempty"`
+	Server  string `toml:"server,omitempty"`
+	KeyID   uint32 `toml:"key_id,omitempty"`
+}
+
+// GRPCRole grants the gRPC clients with a certificate common name or DNS name
+// in Clients the control commands in Commands, "*" standing for all commands.
+type GRPCRole struct {
+	Name     string   `toml:"name,omitempty"`
+	Clients  []string `toml:"clients,omitempty"`
+	Commands []string `toml:"commands,omitempty"`
+}
+
+// DualReference is a server reachable both via SCION and IP. NTP over SCION is
+// preferred; NTP over IP is used while no SCION paths are available or SCION
+// measurements fail.
+type DualReference struct {
+	SCION string `toml:"scion,omitempty"`
+	IP    string `toml:"ip,omitempty"`
+}
+
+// SyncInstance disciplines the PHC Clock, e.g., the clock of a containerized
+// tenant, to its own reference clocks and peers, independently of the system
+// clock. Their offsets are measured relative to Clock.
+type SyncInstance struct {
+	Name               string   `toml:"name,omitempty"`
+	Clock              string   `toml:"clock,omitempty"`
+	PHCReferenceClocks []string `toml:"phc_reference_clocks,omitempty"`
+	NTPReferenceClocks []string `toml:"ntp_reference_clocks,omitempty"`
+	SCIONPeers         []string `toml:"scion_peers,omitempty"`
+}
+
+// HasAuthMode reports whether authentication mode m is configured.
+func (cfg *Service) HasAuthMode(m string) bool {
+	for _, x := range cfg.AuthModes {
+		if x == m {
+			return true
+		}
+	}
+	return false
+}
+
+func applyDefaults(cfg *Service) {
+	if cfg.ClockStepMode == "" {
+		cfg.ClockStepMode = ClockStepModeInitial
+	}
+	if cfg.TracingExporter != "" && cfg.TracingSampleRatio == 0 {
+		cfg.TracingSampleRatio = 1.0
+	}
+	if cfg.MetricsExporter != "" && cfg.MetricsExportInterval == "" {
+		cfg.MetricsExportInterval = metrics.DefaultExportInterval.String()
+	}
+	if m := cfg.PHCMonitor; m != nil {
+		if m.Interval == "" {
+			m.Interval = DefaultPHCMonitorInterval.String()
+		}
+		if m.MaxOffset == "" {
+			m.MaxOffset = DefaultPHCMonitorMaxOffset.String()
+		}
+	}
+	// A missing poll interval bound defaults to the other one
+	if cfg.LocalMinPoll == "" {
+		cfg.LocalMinPoll = cfg.LocalMaxPoll
+	}
+	if cfg.LocalMaxPoll == "" {
+		cfg.LocalMaxPoll = cfg.LocalMinPoll
+	}
+	if cfg.GlobalMinPoll == "" {
+		cfg.GlobalMinPoll = cfg.GlobalMaxPoll
+	}
+	if cfg.GlobalMaxPoll == "" {
+		cfg.GlobalMaxPoll = cfg.GlobalMinPoll
+	}
+	for i := range cfg.Listeners {
+		if len(cfg.Listeners[i].Protocols) == 0 {
+			cfg.Listeners[i].Protocols = []string{ListenerProtocolIP, ListenerProtocolSCION}
+		}
+	}
+	for i := range cfg.NTPBroadcast {
+		if cfg.NTPBroadcast[i].Interval == "" {
+			cfg.NTPBroadcast[i].Interval = DefaultBroadcastInterval.String()
+		}
+	}
+	if cfg.TemperatureSensor != "" && cfg.TemperatureScale == 0 {
+		cfg.TemperatureScale = DefaultTemperatureScale
+	}
+	if cfg.PeerDiscovery != nil && cfg.PeerDiscovery.Interval == "" {
+		cfg.PeerDiscovery.Interval = DefaultDiscoveryInterval.String()
+	}
+	if cfg.LeapSecondsList != "" && cfg.LeapSecondsRefresh == "" {
+		cfg.LeapSecondsRefresh = DefaultLeapSecondsRefresh.String()
+	}
+	if cfg.ComplianceReport != nil && cfg.ComplianceReport.Interval == "" {
+		cfg.ComplianceReport.Interval = DefaultReportInterval.String()
+	}
+	if cfg.ClockStepCrossCheck != nil && cfg.ClockStepCrossCheck.MaxAge == "" {
+		cfg.ClockStepCrossCheck.MaxAge = DefaultCrossCheckMaxAge.String()
+	}
+	for i := range cfg.PacketTrains {
+		if cfg.PacketTrains[i].Spacing == "" {
+			cfg.PacketTrains[i].Spacing = DefaultTrainSpacing.String()
+		}
+	}
+}
+
+// ParseDSCP parses a DSCP value given either as a number in range [0, 63] or
+// as a class name (CS0-CS7, AF11-AF43, VA or EF), see RFC 4594.
+func ParseDSCP(s string) (uint8, bool) {
+	v, err := strconv.ParseUint(s, 0, 8)
+	if err == nil {
+		return uint8(v), v <= 63
+	}
+	s = strings.ToUpper(s)
+	switch {
+	case s == "EF":
+		return 46, true
+	case s == "VA":
+		return 44, true
+	case len(s) == 3 && s[:2] == "CS" && s[2] >= '0' && s[2] <= '7':
+		return (s[2] - '0') << 3, true
+	case len(s) == 4 && s[:2] == "AF" && s[2] >= '1' && s[2] <= '4' && s[3] >= '1' && s[3] <= '3':
+		return (s[2]-'0')<<3 | (s[3]-'0')<<1, true
+	}
+	return 0, false
+}
+
+// Duration parses the duration s of a validated configuration, an empty
+// string is a zero duration.
+func Duration(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		panic("unexpected duration value")
+	}
+	return d
+}
+
+// ParsePrefix parses an IP prefix or address, optionally preceded by an ISD-AS
+// and a comma as in SCION addresses, e.g., "1-ff00:0:111,10.0.0.0/8". The
+// returned IA is zero if s has no ISD-AS.
+func ParsePrefix(s string) (addr.IA, netip.Prefix, error) {
+	var ia addr.IA
+	if i := strings.LastIndexByte(s, ','); i >= 0 {
+		var err error
+		ia, err = addr.ParseIA(s[:i])
+		if err != nil {
+			return 0, netip.Prefix{}, err
+		}
+		if ia.IsZero() {
+			return 0, netip.Prefix{}, errInvalidAddress
+		}
+		s = s[i+1:]
+	}
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		a, aerr := netip.ParseAddr(s)
+		if aerr != nil {
+			return 0, netip.Prefix{}, err
+		}
+		p = netip.PrefixFrom(a, a.BitLen())
+	}
+	return ia, p.Masked(), nil
+}
@@ -0,0 +1,165 @@
+package control
+
+// Control socket: commands are served as JSON documents via HTTP over a Unix
+// domain socket, e.g., "GET /paths?peer=1-ff00:0:111,10.1.1.11:10123".
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+type Handler func(args url.Values) (any, error)
+
+// commands are the names of the control commands of the time service. Only
+// these may be registered and granted to gRPC roles.
+var commands = []string{
+	"add-peer",
+	"as-stats",
+	"audit",
+	"clients",
+	"events",
+	"paths",
+	"remove-peer",
+	"sources",
+	"step",
+	"tai",
+	"tracking",
+}
+
+var (
+	errUnknownCommand = errors.New("unknown command")
+
+	handlersMu sync.Mutex
+	handlers   = make(map[string]Handler)
+)
+
+// IsCommand reports whether cmd is the name of a control command.
+func IsCommand(cmd string) bool {
+	for _, c := range commands {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+func Register(cmd string, h Handler) {
+	if !IsCommand(cmd) {
+		panic("invalid control command name")
+	}
+	if h == nil {
+		panic("control command handler must not be nil")
+	}
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	if _, ok := handlers[cmd]; ok {
+		panic("control command already registered")
+	}
+	handlers[cmd] = h
+}
+
+func lookup(cmd string) (Handler, bool) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	h, ok := handlers[cmd]
+	return h, ok
+}
+
+func serveHTTP(log *zap.Logger, w http.ResponseWriter, r *http.Request) {
+	cmd := strings.TrimPrefix(r.URL.Path, "/")
+	h, ok := lookup(cmd)
+	if !ok {
+		http.Error(w, errUnknownCommand.Error(), http.StatusNotFound)
+		return
+	}
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := h(r.Form)
+	if err != nil {
+		log.Info("failed to handle control command", zap.String("cmd", cmd), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(res)
+	if err != nil {
+		log.Info("failed to write control response", zap.String("cmd", cmd), zap.Error(err))
+	}
+}
+
+func Handle(log *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveHTTP(log, w, r)
+	})
+}
+
+func StartServer(ctx context.Context, log *zap.Logger, socketPath string) {
+	err := os.Remove(socketPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatal("failed to remove stale control socket", zap.String("path", socketPath), zap.Error(err))
+	}
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		log.Fatal("failed to listen on control socket", zap.String("path", socketPath), zap.Error(err))
+	}
+	err = os.Chmod(socketPath, 0o600)
+	if err != nil {
+		log.Fatal("failed to restrict control socket permissions", zap.String("path", socketPath), zap.Error(err))
+	}
+	log.Info("control socket listening", zap.String("path", socketPath))
+	srv := &http.Server{Handler: Handle(log)}
+	go func() {
+		<-ctx.Done()
+		err := srv.Close()
+		if err != nil {
+			log.Info("failed to close control socket", zap.Error(err))
+		}
+		_ = os.Remove(socketPath)
+	}()
+	go func() {
+		err := srv.Serve(l)
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("failed to serve control socket", zap.Error(err))
+		}
+	}()
+}
+
+func Query(socketPath, cmd string, args url.Values) ([]byte, error) {
+	c := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+	u := url.URL{Scheme: "http", Host: "control", Path: "/" + cmd, RawQuery: args.Encode()}
+	resp, err := c.PostForm(u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(strings.TrimSpace(string(b)))
+	}
+	return b, nil
+}
@@ -0,0 +1,10 @@
+package control
+
+var Permitted = permitted
+
+// SetRoles sets the roles of the gRPC server without starting it.
+func SetRoles(rs []Role) {
+	rolesMu.Lock()
+	defer rolesMu.Unlock()
+	roles = rs
+}
@@ -0,0 +1,206 @@
+package control
+
+// gRPC service mirroring the control socket: each registered command is served
+// as unary method "/timeservice.Control/<cmd>". Arguments (url.Values) and
+// results are encoded as JSON, i.e., clients use content subtype "json".
+//
+// Clients authenticate with certificates. If roles are configured, a client may
+// only invoke the commands of the roles that list its identity, i.e., the
+// common name or a DNS name of its certificate.
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"go.uber.org/zap"
+)
+
+const (
+	GRPCServiceName = "timeservice.Control"
+	GRPCCodecName   = "json"
+
+	// AllCommands stands for all commands in Role.Commands.
+	AllCommands = "*"
+)
+
+// Role grants the clients identified by Clients the commands in Commands.
+type Role struct {
+	Name     string
+	Clients  []string
+	Commands []string
+}
+
+var (
+	errPermissionDenied = errors.New("command not permitted")
+
+	rolesMu sync.Mutex
+	roles   []Role
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return GRPCCodecName
+}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+func grpcHandler(log *zap.Logger, cmd string) func(any, context.Context, func(any) error, grpc.UnaryServerInterceptor) (any, error) {
+	return func(_ any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+		id, ok := permitted(ctx, cmd)
+		if !ok {
+			log.Info("denied control command", zap.String("cmd", cmd), zap.Strings("client", id))
+			return nil, status.Error(codes.PermissionDenied, errPermissionDenied.Error())
+		}
+		var args url.Values
+		err := dec(&args)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		h, ok := lookup(cmd)
+		if !ok {
+			return nil, status.Error(codes.Unimplemented, errUnknownCommand.Error())
+		}
+		res, err := h(args)
+		if err != nil {
+			log.Info("failed to handle control command", zap.String("cmd", cmd), zap.Error(err))
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return res, nil
+	}
+}
+
+// clientIdentities returns the common name and the DNS names of the verified
+// certificate of the client of ctx.
+func clientIdentities(ctx context.Context) []string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := info.State.VerifiedChains[0][0]
+	var ids []string
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	return append(ids, cert.DNSNames...)
+}
+
+// permitted reports whether the client of ctx may invoke cmd and returns the
+// client's identities.
+func permitted(ctx context.Context, cmd string) ([]string, bool) {
+	ids := clientIdentities(ctx)
+	rolesMu.Lock()
+	defer rolesMu.Unlock()
+	if len(roles) == 0 {
+		return ids, true
+	}
+	for _, r := range roles {
+		if !containsAny(r.Clients, ids) {
+			continue
+		}
+		for _, c := range r.Commands {
+			if c == cmd || c == AllCommands {
+				return ids, true
+			}
+		}
+	}
+	return ids, false
+}
+
+func containsAny(xs, ys []string) bool {
+	for _, x := range xs {
+		for _, y := range ys {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// StartGRPCServer serves the registered commands via gRPC at addr. The server
+// is authenticated and clients are authenticated via tlsConfig, which should
+// require client certificates. If rs is not empty, clients are authorized per
+// command according to rs.
+func StartGRPCServer(ctx context.Context, log *zap.Logger, addr string, tlsConfig *tls.Config, rs []Role) {
+	rolesMu.Lock()
+	roles = rs
+	rolesMu.Unlock()
+
+	handlersMu.Lock()
+	cmds := make([]string, 0, len(handlers))
+	for cmd := range handlers {
+		cmds = append(cmds, cmd)
+	}
+	handlersMu.Unlock()
+	sort.Strings(cmds)
+
+	desc := grpc.ServiceDesc{
+		ServiceName: GRPCServiceName,
+		HandlerType: (*any)(nil),
+	}
+	for _, cmd := range cmds {
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{
+			MethodName: cmd,
+			Handler:    grpcHandler(log, cmd),
+		})
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal("failed to listen for gRPC connections", zap.String("address", addr), zap.Error(err))
+	}
+	log.Info("gRPC control server listening", zap.String("address", addr))
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
+	srv.RegisterService(&desc, struct{}{})
+	go func() {
+		<-ctx.Done()
+		srv.Stop()
+	}()
+	go func() {
+		err := srv.Serve(l)
+		if err != nil && ctx.Err() == nil {
+			log.Fatal("failed to serve gRPC connections", zap.Error(err))
+		}
+	}()
+}
+
+// QueryGRPC invokes control command cmd with args via the gRPC connection conn.
+func QueryGRPC(ctx context.Context, conn *grpc.ClientConn, cmd string, args url.Values) ([]byte, error) {
+	if args == nil {
+		args = url.Values{}
+	}
+	var res json.RawMessage
+	err := conn.Invoke(ctx, "/"+GRPCServiceName+"/"+cmd, args, &res, grpc.CallContentSubtype(GRPCCodecName))
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,71 @@
+package control_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"example.com/scion-time/core/control"
+)
+
+func clientContext(cn string, dnsNames ...string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}, DNSNames: dnsNames}
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert}},
+		}},
+	})
+}
+
+func TestPermitted(t *testing.T) {
+	t.Cleanup(func() { control.SetRoles(nil) })
+
+	ops := clientContext("ops")
+	mon := clientContext("", "mon.example.com")
+	other := clientContext("other")
+
+	control.SetRoles(nil)
+	if _, ok := control.Permitted(other, "step"); !ok {
+		t.Error("command denied without roles")
+	}
+
+	control.SetRoles([]control.Role{
+		{Name: "admin", Clients: []string{"ops"}, Commands: []string{control.AllCommands}},
+		{Name: "monitoring", Clients: []string{"mon.example.com"}, Commands: []string{"sources", "tracking"}},
+	})
+	for _, tc := range []struct {
+		ctx context.Context
+		cmd string
+		ok  bool
+	}{
+		{ops, "step", true},
+		{ops, "sources", true},
+		{mon, "sources", true},
+		{mon, "step", false},
+		{other, "sources", false},
+		{context.Background(), "sources", false},
+	} {
+		id, ok := control.Permitted(tc.ctx, tc.cmd)
+		if ok != tc.ok {
+			t.Errorf("Permitted(%v, %s) = %t; want %t", id, tc.cmd, ok, tc.ok)
+		}
+	}
+}
+
+func TestIsCommand(t *testing.T) {
+	for _, cmd := range []string{"sources", "step", "add-peer"} {
+		if !control.IsCommand(cmd) {
+			t.Errorf("IsCommand(%q) = false; want true", cmd)
+		}
+	}
+	for _, cmd := range []string{"", "*", "source", "step/"} {
+		if control.IsCommand(cmd) {
+			t.Errorf("IsCommand(%q) = true; want false", cmd)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package discovery
+
+// Automatic discovery of network peers: a registry listing the time services
+// of a SCION deployment is fetched periodically and the services selected by
+// the discovery policy are added as network peers to the global clock sync.
+// Discovered peers that are no longer selected are removed again.
+//
+// The registry is a JSON document of the form
+//
+//	{"services": ["1-ff00:0:110,10.0.0.1:123", ...]}
+//
+// served via HTTP(S) or read from a local file.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/snet"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/sync"
+)
+
+const (
+	fetchTimeout   = 10 * time.Second
+	maxRegistryLen = 1 << 20
+)
+
+// Policy selects the time services that are added as peers. Only one service
+// per AS is selected and services in the local AS are ignored.
+type Policy struct {
+	LocalIA  addr.IA
+	ISDs     []addr.ISD // no restriction if empty
+	MaxPeers int        // no limit if 0
+}
+
+type registry struct {
+	Services []string `json:"services"`
+}
+
+var errUnexpectedStatus = errors.New("unexpected registry response status")
+
+func fetch(ctx context.Context, location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return os.ReadFile(location)
+	}
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", errUnexpectedStatus, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxRegistryLen))
+}
+
+func (p Policy) admits(ia addr.IA) bool {
+	if ia.IsZero() || ia.IsWildcard() || ia == p.LocalIA {
+		return false
+	}
+	if len(p.ISDs) == 0 {
+		return true
+	}
+	for _, isd := range p.ISDs {
+		if ia.ISD() == isd {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the services of the registry admitted by policy p, in
+// registry order.
+func (p Policy) filter(log *zap.Logger, services []string) []string {
+	var selected []string
+	ias := make(map[addr.IA]struct{})
+	for _, s := range services {
+		if p.MaxPeers != 0 && len(selected) == p.MaxPeers {
+			break
+		}
+		a, err := snet.ParseUDPAddr(s)
+		if err != nil {
+			log.Info("failed to parse discovered service address",
+				zap.String("address", s), zap.Error(err))
+			continue
+		}
+		if !p.admits(a.IA) {
+			continue
+		}
+		if _, ok := ias[a.IA]; ok {
+			continue
+		}
+		ias[a.IA] = struct{}{}
+		selected = append(selected, s)
+	}
+	return selected
+}
+
+// peerSet is the set of network peers managed by the discovery, see
+// sync.SyncInstance.
+type peerSet interface {
+	AddPeer(c client.ReferenceClock) error
+	RemovePeer(name string) error
+}
+
+type defaultPeers struct{}
+
+func (defaultPeers) AddPeer(c client.ReferenceClock) error { return sync.AddPeer(c) }
+func (defaultPeers) RemovePeer(name string) error          { return sync.RemovePeer(name) }
+
+type discoverer struct {
+	log      *zap.Logger
+	location string
+	policy   Policy
+	newPeer  func(string) (client.ReferenceClock, error)
+	sync     peerSet
+	peers    map[string]string // service address -> peer name
+}
+
+func (d *discoverer) refresh(ctx context.Context) error {
+	b, err := fetch(ctx, d.location)
+	if err != nil {
+		return err
+	}
+	var r registry
+	err = json.Unmarshal(b, &r)
+	if err != nil {
+		return err
+	}
+
+	selected := make(map[string]struct{})
+	for _, s := range d.policy.filter(d.log, r.Services) {
+		selected[s] = struct{}{}
+		if _, ok := d.peers[s]; ok {
+			continue
+		}
+		c, err := d.newPeer(s)
+		if err != nil {
+			d.log.Info("failed to create discovered peer", zap.String("address", s), zap.Error(err))
+			continue
+		}
+		err = d.sync.AddPeer(c)
+		if err != nil {
+			// Configured peers are not managed by the discovery
+			d.log.Debug("failed to add discovered peer", zap.String("address", s), zap.Error(err))
+			continue
+		}
+		d.peers[s] = fmt.Sprint(c)
+		d.log.Info("added discovered peer", zap.String("address", s))
+	}
+
+	var removed []string
+	for s := range d.peers {
+		if _, ok := selected[s]; !ok {
+			removed = append(removed, s)
+		}
+	}
+	sort.Strings(removed)
+	for _, s := range removed {
+		err = d.sync.RemovePeer(d.peers[s])
+		if err != nil {
+			d.log.Info("failed to remove discovered peer", zap.String("address", s), zap.Error(err))
+		} else {
+			d.log.Info("removed discovered peer", zap.String("address", s))
+		}
+		delete(d.peers, s)
+	}
+	return nil
+}
+
+// Start starts the periodic discovery of peers from the registry at location,
+// a HTTP(S) URL or a file path, every interval. Peers are created with
+// newPeer and added to the global clock sync, which must be enabled.
+func Start(ctx context.Context, log *zap.Logger, location string, interval time.Duration,
+	policy Policy, newPeer func(string) (client.ReferenceClock, error)) {
+	if interval <= 0 {
+		panic("invalid discovery interval")
+	}
+	d := &discoverer{
+		log:      log,
+		location: location,
+		policy:   policy,
+		newPeer:  newPeer,
+		sync:     defaultPeers{},
+		peers:    make(map[string]string),
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			err := d.refresh(ctx)
+			if err != nil {
+				log.Info("failed to discover peers", zap.String("registry", location), zap.Error(err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
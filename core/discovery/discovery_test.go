@@ -0,0 +1,185 @@
+package discovery_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/scionproto/scion/pkg/addr"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/discovery"
+)
+
+type peer string
+
+func (p peer) MeasureClockOffset(context.Context, *zap.Logger) (time.Duration, error) {
+	return 0, nil
+}
+
+func (p peer) String() string {
+	return string(p)
+}
+
+type peerSet struct {
+	peers map[string]bool
+}
+
+var errPeerExists = errors.New("peer already exists")
+
+func (s *peerSet) AddPeer(c client.ReferenceClock) error {
+	name := c.(peer).String()
+	if s.peers[name] {
+		return errPeerExists
+	}
+	s.peers[name] = true
+	return nil
+}
+
+func (s *peerSet) RemovePeer(name string) error {
+	delete(s.peers, name)
+	return nil
+}
+
+func (s *peerSet) names() []string {
+	var ns []string
+	for n := range s.peers {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	return ns
+}
+
+func localIA(t *testing.T) addr.IA {
+	t.Helper()
+	ia, err := addr.ParseIA("1-ff00:0:110")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ia
+}
+
+func TestPolicyFilter(t *testing.T) {
+	ia := localIA(t)
+	services := []string{
+		"1-ff00:0:110,10.0.0.1:123",
+		"1-ff00:0:111,10.0.0.2:123",
+		"1-ff00:0:111,10.0.0.3:123",
+		"invalid",
+		"2-ff00:0:210,10.0.0.4:123",
+		"1-ff00:0:112,10.0.0.5:123",
+	}
+	tests := []struct {
+		policy discovery.Policy
+		want   []string
+	}{
+		{
+			discovery.Policy{LocalIA: ia},
+			[]string{"1-ff00:0:111,10.0.0.2:123", "2-ff00:0:210,10.0.0.4:123", "1-ff00:0:112,10.0.0.5:123"},
+		},
+		{
+			discovery.Policy{LocalIA: ia, ISDs: []addr.ISD{1}},
+			[]string{"1-ff00:0:111,10.0.0.2:123", "1-ff00:0:112,10.0.0.5:123"},
+		},
+		{
+			discovery.Policy{LocalIA: ia, MaxPeers: 1},
+			[]string{"1-ff00:0:111,10.0.0.2:123"},
+		},
+		{
+			discovery.Policy{LocalIA: ia, ISDs: []addr.ISD{3}},
+			nil,
+		},
+	}
+	for i, test := range tests {
+		got := test.policy.Filter(services)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("#%d: Filter() = %v; want %v", i, got, test.want)
+		}
+	}
+}
+
+func newPeer(s string) (client.ReferenceClock, error) {
+	return peer(s), nil
+}
+
+func TestRefreshFromFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "registry.json")
+	write := func(data string) {
+		t.Helper()
+		err := os.WriteFile(name, []byte(data), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A configured peer is not managed by the discovery
+	ps := &peerSet{peers: map[string]bool{"1-ff00:0:113,10.0.0.6:123": true}}
+	d := discovery.NewDiscoverer(name, discovery.Policy{LocalIA: localIA(t)},
+		newPeer, ps)
+
+	write(`{"services": ["1-ff00:0:111,10.0.0.2:123", "1-ff00:0:112,10.0.0.5:123",
+		"1-ff00:0:113,10.0.0.6:123"]}`)
+	err := d.Refresh(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1-ff00:0:111,10.0.0.2:123", "1-ff00:0:112,10.0.0.5:123", "1-ff00:0:113,10.0.0.6:123"}
+	if got := ps.names(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("peers = %v; want %v", got, want)
+	}
+
+	write(`{"services": ["1-ff00:0:112,10.0.0.5:123"]}`)
+	err = d.Refresh(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"1-ff00:0:112,10.0.0.5:123", "1-ff00:0:113,10.0.0.6:123"}
+	if got := ps.names(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("peers = %v; want %v", got, want)
+	}
+
+	write(`{"services": [`)
+	err = d.Refresh(context.Background())
+	if err == nil {
+		t.Fatal("Refresh() succeeded with invalid registry; want error")
+	}
+	if got := ps.names(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("peers = %v after failed refresh; want %v", got, want)
+	}
+}
+
+func TestRefreshFromHTTP(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"services": ["1-ff00:0:111,10.0.0.2:123"]}`))
+	}))
+	defer srv.Close()
+
+	ps := &peerSet{peers: make(map[string]bool)}
+	d := discovery.NewDiscoverer(srv.URL, discovery.Policy{LocalIA: localIA(t)},
+		newPeer, ps)
+	err := d.Refresh(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1-ff00:0:111,10.0.0.2:123"}
+	if got := ps.names(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("peers = %v; want %v", got, want)
+	}
+
+	status = http.StatusNotFound
+	err = d.Refresh(context.Background())
+	if err == nil {
+		t.Fatal("Refresh() succeeded with unexpected status; want error")
+	}
+}
@@ -0,0 +1,35 @@
+package discovery
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/client"
+)
+
+type PeerSet = peerSet
+
+func (p Policy) Filter(services []string) []string {
+	return p.filter(zap.NewNop(), services)
+}
+
+type Discoverer struct {
+	d *discoverer
+}
+
+func NewDiscoverer(location string, policy Policy,
+	newPeer func(string) (client.ReferenceClock, error), peers PeerSet) *Discoverer {
+	return &Discoverer{&discoverer{
+		log:      zap.NewNop(),
+		location: location,
+		policy:   policy,
+		newPeer:  newPeer,
+		sync:     peers,
+		peers:    make(map[string]string),
+	}}
+}
+
+func (d *Discoverer) Refresh(ctx context.Context) error {
+	return d.d.refresh(ctx)
+}
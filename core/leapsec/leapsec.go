@@ -0,0 +1,334 @@
+package leapsec
+
+// Leap second list in the format of the leap-seconds.list file published by
+// IERS and NIST and distributed with tzdata, see
+// https://hpiers.obspm.fr/iers/bul/bulc/ntp/leap-seconds.list
+//
+// The list is read from a file or fetched via HTTP(S) and refreshed
+// periodically. It sets the TAI-UTC offset of the time base, from which the
+// leap indicators of responses are derived, and warnings are logged before
+// the list expires.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/events"
+	"example.com/scion-time/core/timebase"
+)
+
+const (
+	fetchTimeout  = 10 * time.Second
+	applyInterval = 1 * time.Hour
+	maxListLen    = 1 << 20
+
+	// Seconds between the NTP epoch (1900) and the Unix epoch (1970)
+	ntpEpochOffset = 2208988800
+
+	// Warn about a list expiring within this period
+	ExpiryWarning = 30 * 24 * time.Hour
+
+	// Source of the TAI-UTC offsets taken from the list
+	Source = "leap-seconds.list"
+)
+
+// Leap is the TAI-UTC offset in seconds in effect from At.
+type Leap struct {
+	At     time.Time
+	Offset int
+}
+
+type List struct {
+	Updated time.Time
+	Expires time.Time
+	Leaps   []Leap // ordered by At
+}
+
+var (
+	errMissingHash      = errors.New("missing leap second list hash")
+	errInvalidHash      = errors.New("invalid leap second list hash")
+	errMissingExpiry    = errors.New("missing leap second list expiry")
+	errInvalidEntry     = errors.New("invalid leap second list entry")
+	errUnexpectedStatus = errors.New("unexpected leap second list response status")
+)
+
+func ntpSeconds(s string) (time.Time, error) {
+	x, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || x < ntpEpochOffset {
+		return time.Time{}, errInvalidEntry
+	}
+	return time.Unix(x-ntpEpochOffset, 0).UTC(), nil
+}
+
+// digits returns the decimal digits in s, which are covered by the hash.
+func digits(s string) []byte {
+	var b []byte
+	for i := 0; i != len(s); i++ {
+		if '0' <= s[i] && s[i] <= '9' {
+			b = append(b, s[i])
+		}
+	}
+	return b
+}
+
+// Parse parses the leap second list in b and verifies its hash.
+func Parse(b []byte) (*List, error) {
+	var l List
+	var hash []string
+	h := sha1.New()
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, "#$"):
+			t, err := ntpSeconds(strings.TrimSpace(line[2:]))
+			if err != nil {
+				return nil, err
+			}
+			l.Updated = t
+			h.Write(digits(line[2:]))
+		case strings.HasPrefix(line, "#@"):
+			t, err := ntpSeconds(strings.TrimSpace(line[2:]))
+			if err != nil {
+				return nil, err
+			}
+			l.Expires = t
+			h.Write(digits(line[2:]))
+		case strings.HasPrefix(line, "#h"):
+			hash = strings.Fields(line[2:])
+		case strings.HasPrefix(line, "#"):
+		default:
+			if i := strings.IndexByte(line, '#'); i >= 0 {
+				line = line[:i]
+			}
+			fs := strings.Fields(line)
+			if len(fs) == 0 {
+				continue
+			}
+			if len(fs) != 2 {
+				return nil, errInvalidEntry
+			}
+			at, err := ntpSeconds(fs[0])
+			if err != nil {
+				return nil, err
+			}
+			off, err := strconv.Atoi(fs[1])
+			if err != nil || off < 0 || off > timebase.MaxTAIOffset {
+				return nil, errInvalidEntry
+			}
+			if n := len(l.Leaps); n != 0 && !at.After(l.Leaps[n-1].At) {
+				return nil, errInvalidEntry
+			}
+			l.Leaps = append(l.Leaps, Leap{At: at, Offset: off})
+			h.Write(digits(line))
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(hash) != 5 {
+		return nil, errMissingHash
+	}
+	var sum string
+	for _, w := range hash {
+		x, err := strconv.ParseUint(w, 16, 32)
+		if err != nil {
+			return nil, errInvalidHash
+		}
+		sum += fmt.Sprintf("%08x", x)
+	}
+	if sum != fmt.Sprintf("%x", h.Sum(nil)) {
+		return nil, errInvalidHash
+	}
+	if l.Expires.IsZero() {
+		return nil, errMissingExpiry
+	}
+	if len(l.Leaps) == 0 {
+		return nil, errInvalidEntry
+	}
+	return &l, nil
+}
+
+// TAIOffset returns the TAI-UTC offset at t and the next leap second after t,
+// if any.
+func (l *List) TAIOffset(t time.Time) (timebase.TAIOffset, bool) {
+	var o timebase.TAIOffset
+	i := 0
+	for i != len(l.Leaps) && !l.Leaps[i].At.After(t) {
+		i++
+	}
+	if i == 0 {
+		return o, false
+	}
+	o.Offset = l.Leaps[i-1].Offset
+	if i != len(l.Leaps) {
+		o.NextOffset, o.NextAt = l.Leaps[i].Offset, l.Leaps[i].At
+	}
+	return o, true
+}
+
+func fetch(ctx context.Context, location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return os.ReadFile(location)
+	}
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", errUnexpectedStatus, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxListLen))
+}
+
+func saveList(name string, b []byte) error {
+	tmp := name + ".tmp"
+	err := os.WriteFile(tmp, b, 0o644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+type refresher struct {
+	log      *zap.Logger
+	location string
+	cache    string
+	list     *List
+	expired  bool
+}
+
+// load replaces the current list with the list in b if it is valid and not
+// older than the current list.
+func (r *refresher) load(b []byte, source string) error {
+	l, err := Parse(b)
+	if err != nil {
+		return err
+	}
+	if r.list != nil && !l.Expires.After(r.list.Expires) {
+		return nil
+	}
+	r.log.Info("loaded leap second list",
+		zap.String("source", source),
+		zap.Time("updated", l.Updated),
+		zap.Time("expires", l.Expires),
+	)
+	r.list = l
+	return nil
+}
+
+func (r *refresher) refresh(ctx context.Context) error {
+	b, err := fetch(ctx, r.location)
+	if err != nil {
+		return err
+	}
+	prev := r.list
+	err = r.load(b, r.location)
+	if err != nil {
+		return err
+	}
+	if r.cache != "" && r.list != prev {
+		err = saveList(r.cache, b)
+		if err != nil {
+			r.log.Info("failed to save leap second list", zap.String("file", r.cache), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// apply sets the TAI-UTC offset of the time base from the current list.
+func (r *refresher) apply(now time.Time) {
+	if r.list == nil {
+		return
+	}
+	o, ok := r.list.TAIOffset(now)
+	if !ok {
+		return
+	}
+	o.Source = Source
+	if !o.NextAt.IsZero() && o.NextAt.After(r.list.Expires) {
+		o.NextOffset, o.NextAt = 0, time.Time{}
+	}
+	prev, ok := timebase.CurrentTAIOffset()
+	if !ok || prev.Offset != o.Offset || !prev.NextAt.Equal(o.NextAt) {
+		timebase.SetTAIOffset(o)
+	}
+	if remaining := r.list.Expires.Sub(now); remaining <= 0 {
+		r.log.Warn("leap second list expired", zap.Time("expires", r.list.Expires))
+		if !r.expired {
+			r.expired = true
+			events.Record(events.KindTAIOffset, o.Source, "leap second list expired at %v", r.list.Expires)
+		}
+	} else {
+		r.expired = false
+		if remaining <= ExpiryWarning {
+			r.log.Warn("leap second list expires soon", zap.Time("expires", r.list.Expires))
+		}
+	}
+}
+
+// Start loads the leap second list from location, a HTTP(S) URL or a file
+// path, and refreshes it every interval. If cache is not empty, the list is
+// initially loaded from the file cache and every newer list fetched from
+// location is saved to it.
+func Start(ctx context.Context, log *zap.Logger, location, cache string, interval time.Duration) {
+	if interval <= 0 {
+		panic("invalid leap second list refresh interval")
+	}
+	r := &refresher{log: log, location: location, cache: cache}
+	if cache != "" {
+		b, err := os.ReadFile(cache)
+		if err == nil {
+			err = r.load(b, cache)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Info("failed to load leap second list", zap.String("file", cache), zap.Error(err))
+		}
+	}
+	err := r.refresh(ctx)
+	if err != nil {
+		log.Info("failed to load leap second list", zap.String("location", location), zap.Error(err))
+	}
+	r.apply(timebase.Now())
+	go func() {
+		// The offset is applied more often than the list is refreshed in
+		// order to move on to the next leap second soon after it occurred.
+		ticker := time.NewTicker(applyInterval)
+		defer ticker.Stop()
+		refreshedAt := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if time.Since(refreshedAt) >= interval {
+				refreshedAt = time.Now()
+				err := r.refresh(ctx)
+				if err != nil {
+					log.Info("failed to refresh leap second list", zap.String("location", location), zap.Error(err))
+				}
+			}
+			r.apply(timebase.Now())
+		}
+	}()
+}
@@ -0,0 +1,51 @@
+package leapsec_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/scion-time/core/leapsec"
+)
+
+const list = `#	Sample excerpt of the IERS leap second list
+#
+#$	 3676924800
+#@	 3928521600
+#
+2272060800	10	# 1 Jan 1972
+2287785600	11	# 1 Jul 1972
+2303683200	12	# 1 Jan 1973
+3692217600	37	# 1 Jan 2017
+#
+#h	d5d7c873 12b4f336 1534bd4b 37bb6326 ca7ae640
+`
+
+func TestParse(t *testing.T) {
+	l, err := leapsec.Parse([]byte(list))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !l.Expires.Equal(time.Date(2024, 6, 28, 0, 0, 0, 0, time.UTC)) || len(l.Leaps) != 4 {
+		t.Fatalf("Parse() = %+v", l)
+	}
+
+	jan2017 := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	o, ok := l.TAIOffset(jan2017.Add(-time.Hour))
+	if !ok || o.Offset != 12 || o.NextOffset != 37 || !o.NextAt.Equal(jan2017) {
+		t.Errorf("TAIOffset() = %+v, %t; want leap to 37 s at %v", o, ok, jan2017)
+	}
+	o, ok = l.TAIOffset(jan2017)
+	if !ok || o.Offset != 37 || !o.NextAt.IsZero() {
+		t.Errorf("TAIOffset() = %+v, %t; want 37 s", o, ok)
+	}
+	_, ok = l.TAIOffset(time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC))
+	if ok {
+		t.Errorf("TAIOffset returned offset before first entry")
+	}
+
+	_, err = leapsec.Parse([]byte(strings.Replace(list, "\t37\t", "\t38\t", 1)))
+	if err == nil {
+		t.Errorf("Parse accepted list with invalid hash")
+	}
+}
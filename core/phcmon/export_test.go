@@ -0,0 +1,31 @@
+package phcmon
+
+import (
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Check evaluates the offsets offs of clk in order and returns after each of
+// them whether the PHC is considered to have diverged.
+func Check(clk Clock, cfg Config, offs []time.Duration) []bool {
+	m := &monitor{log: zap.NewNop(), cfg: cfg, clk: clk}
+	r := make([]bool, len(offs))
+	for i, off := range offs {
+		m.check(off)
+		r[i] = m.diverged
+	}
+	return r
+}
+
+// LoggedFailures reports for measurement failures at times ts whether they
+// are logged.
+func LoggedFailures(clk Clock, ts []time.Time) []bool {
+	m := &monitor{log: zap.NewNop(), clk: clk}
+	r := make([]bool, len(ts))
+	for i, t := range ts {
+		r[i] = m.measurementFailed(t, errors.New("measurement failed"))
+	}
+	return r
+}
@@ -0,0 +1,136 @@
+package phcmon
+
+// Monitoring of the coupling between the system clock and PTP hardware clocks
+// (PHC): if the system clock is synchronized to a PHC or vice versa, e.g., by
+// phc2sys, or if hardware timestamps of a PHC are used alongside the system
+// clock, the offset between both clocks is expected to stay close to a
+// nominal value. The offset is measured periodically and exported, and an
+// event is recorded whenever it leaves or returns to its bound.
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/events"
+	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/base/timemath"
+)
+
+// Clock is a PHC whose offset relative to the system clock can be measured,
+// see phc.Clock.
+type Clock interface {
+	MeasureOffsetPrecise(ctx context.Context) (time.Duration, error)
+	String() string
+}
+
+// Config configures the monitoring of the offsets of PHCs. Nominal is the
+// expected offset, e.g., the TAI-UTC offset for PHCs that run on TAI, and
+// MaxOffset the bound on the deviation from it. A PHC is considered to have
+// recovered once the deviation is within half of the bound again.
+type Config struct {
+	Interval  time.Duration
+	Nominal   time.Duration
+	MaxOffset time.Duration
+}
+
+// failureLogInterval is the minimum interval between logged measurement
+// failures of a PHC.
+const failureLogInterval = time.Minute
+
+type monitor struct {
+	log            *zap.Logger
+	cfg            Config
+	clk            Clock
+	diverged       bool
+	failures       int
+	lastFailureLog time.Time
+}
+
+var (
+	offsetGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: metrics.PHCMonitorOffsetN,
+		Help: metrics.PHCMonitorOffsetH,
+	}, []string{"phc"})
+	divergedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: metrics.PHCMonitorDivergedN,
+		Help: metrics.PHCMonitorDivergedH,
+	}, []string{"phc"})
+)
+
+// check evaluates the offset off of the PHC and reports whether its state
+// changed.
+func (m *monitor) check(off time.Duration) bool {
+	d := timemath.Abs(off - m.cfg.Nominal)
+	switch {
+	case !m.diverged && d > m.cfg.MaxOffset:
+		m.diverged = true
+		m.log.Warn("PHC diverged from system clock",
+			zap.String("phc", m.clk.String()), zap.Duration("offset", off))
+		events.Record(events.KindPHCDivergence, m.clk.String(),
+			"offset to system clock %v exceeds %v", off, m.cfg.Nominal+m.cfg.MaxOffset)
+		return true
+	case m.diverged && d <= m.cfg.MaxOffset/2:
+		m.diverged = false
+		m.log.Info("PHC recovered",
+			zap.String("phc", m.clk.String()), zap.Duration("offset", off))
+		events.Record(events.KindPHCRecovery, m.clk.String(),
+			"offset to system clock %v within bound again", off)
+		return true
+	}
+	return false
+}
+
+// measurementFailed logs the failed measurement, unless one was logged less
+// than failureLogInterval before now, and reports whether it was logged. The
+// failures in between are counted in the next log entry.
+func (m *monitor) measurementFailed(now time.Time, err error) bool {
+	m.failures++
+	if !m.lastFailureLog.IsZero() && now.Sub(m.lastFailureLog) < failureLogInterval {
+		return false
+	}
+	m.log.Info("failed to measure PHC offset",
+		zap.String("phc", m.clk.String()), zap.Int("failures", m.failures), zap.Error(err))
+	m.failures = 0
+	m.lastFailureLog = now
+	return true
+}
+
+func (m *monitor) run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		off, err := m.clk.MeasureOffsetPrecise(ctx)
+		if err != nil {
+			m.measurementFailed(time.Now(), err)
+		} else {
+			m.check(off)
+			offsetGauge.WithLabelValues(m.clk.String()).Set(off.Seconds())
+			diverged := 0.0
+			if m.diverged {
+				diverged = 1.0
+			}
+			divergedGauge.WithLabelValues(m.clk.String()).Set(diverged)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Start monitors the offsets of clks relative to the system clock until ctx
+// is done.
+func Start(ctx context.Context, log *zap.Logger, clks []Clock, cfg Config) {
+	if cfg.Interval <= 0 || cfg.MaxOffset <= 0 {
+		panic("invalid PHC monitor configuration")
+	}
+	for _, clk := range clks {
+		m := &monitor{log: log, cfg: cfg, clk: clk}
+		go m.run(ctx)
+	}
+}
@@ -0,0 +1,68 @@
+package phcmon_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/scion-time/base/events"
+	"example.com/scion-time/core/phcmon"
+)
+
+type fakeClock struct{}
+
+func (fakeClock) MeasureOffsetPrecise(ctx context.Context) (time.Duration, error) {
+	return 0, nil
+}
+
+func (fakeClock) String() string {
+	return "/dev/ptp9"
+}
+
+func TestCheck(t *testing.T) {
+	cfg := phcmon.Config{
+		Interval:  time.Second,
+		Nominal:   37 * time.Second,
+		MaxOffset: 10 * time.Microsecond,
+	}
+	offs := []time.Duration{
+		37*time.Second + 5*time.Microsecond,
+		37*time.Second - 11*time.Microsecond, // diverged
+		37*time.Second + 8*time.Microsecond,  // within bound, not yet recovered
+		37*time.Second - 4*time.Microsecond,  // recovered
+		0,                                    // PHC on UTC
+	}
+	want := []bool{false, true, true, false, true}
+	since := uint64(len(events.Events("", 0)))
+	got := phcmon.Check(fakeClock{}, cfg, offs)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("diverged after %v = %v; want %v", offs[i], got[i], want[i])
+		}
+	}
+	if n := len(events.Events(events.KindPHCDivergence, since)); n != 2 {
+		t.Errorf("recorded %d divergence events; want 2", n)
+	}
+	if n := len(events.Events(events.KindPHCRecovery, since)); n != 1 {
+		t.Errorf("recorded %d recovery events; want 1", n)
+	}
+}
+
+func TestLoggedFailures(t *testing.T) {
+	t0 := time.Unix(0, 0)
+	ts := []time.Time{
+		t0,
+		t0.Add(time.Second),
+		t0.Add(59 * time.Second),
+		t0.Add(time.Minute),
+		t0.Add(61 * time.Second),
+		t0.Add(3 * time.Minute),
+	}
+	want := []bool{true, false, false, true, false, true}
+	got := phcmon.LoggedFailures(fakeClock{}, ts)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("failure at %v logged = %v; want %v", ts[i].Sub(t0), got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package report
+
+import "time"
+
+var Collect = collect
+
+func Enable(maxDivergence time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	limit = maxDivergence
+	accs = make(map[string]*accumulator)
+}
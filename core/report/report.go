@@ -0,0 +1,305 @@
+package report
+
+// Compliance reports: the clock offsets measured by the clock sync and the
+// holdover periods are summarized per reporting period, e.g., for clock sync
+// audits under MiFID II RTS 25. Reports are signed with Ed25519 and written as
+// JSON documents to a directory, one file per period.
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/timemath"
+)
+
+const (
+	Version   = 1
+	Algorithm = "ed25519"
+)
+
+// Config configures the generation of reports. Periods are aligned to
+// multiples of Interval since the Unix epoch.
+type Config struct {
+	Directory     string
+	Interval      time.Duration
+	Reference     string
+	MaxDivergence time.Duration
+	Key           ed25519.PrivateKey
+}
+
+// Holdover is a holdover period. End is the end of the reporting period if the
+// holdover is still ongoing.
+type Holdover struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Ongoing bool      `json:"ongoing,omitempty"`
+}
+
+// Discipline summarizes the offsets of the local clock relative to the
+// sources of a clock discipline. Offsets are in nanoseconds.
+type Discipline struct {
+	Name             string        `json:"name"`
+	Samples          int           `json:"samples"`
+	MeanOffset       time.Duration `json:"mean_offset"`
+	RMSOffset        time.Duration `json:"rms_offset"`
+	MaxDivergence    time.Duration `json:"max_divergence"`
+	MaxDivergenceAt  time.Time     `json:"max_divergence_at,omitempty"`
+	Exceedances      int           `json:"exceedances"`
+	Holdover         []Holdover    `json:"holdover"`
+	HoldoverDuration time.Duration `json:"holdover_duration"`
+}
+
+type Report struct {
+	Version            int           `json:"version"`
+	Host               string        `json:"host"`
+	Start              time.Time     `json:"start"`
+	End                time.Time     `json:"end"`
+	Reference          string        `json:"reference"`
+	MaxDivergenceLimit time.Duration `json:"max_divergence_limit"`
+	Compliant          bool          `json:"compliant"`
+	Disciplines        []Discipline  `json:"disciplines"`
+}
+
+// Signed is a report together with its signature. The signature covers the
+// exact bytes of Report.
+type Signed struct {
+	Report    json.RawMessage `json:"report"`
+	Algorithm string          `json:"algorithm"`
+	PublicKey []byte          `json:"public_key"`
+	Signature []byte          `json:"signature"`
+}
+
+type accumulator struct {
+	n        int
+	sum      float64
+	sumSq    float64
+	maxAbs   time.Duration
+	maxAt    time.Time
+	exceed   int
+	holdover []Holdover
+	active   bool
+}
+
+var (
+	errUnexpectedAlgorithm = errors.New("unexpected signature algorithm")
+	errInvalidSignature    = errors.New("invalid report signature")
+
+	mu    sync.Mutex
+	limit time.Duration
+	accs  map[string]*accumulator
+)
+
+func accumulatorOf(discipline string) *accumulator {
+	a, ok := accs[discipline]
+	if !ok {
+		a = &accumulator{}
+		accs[discipline] = a
+	}
+	return a
+}
+
+// Observe records the offset of the local clock relative to the sources of
+// discipline measured at t. Observations are discarded unless reports are
+// generated.
+func Observe(discipline string, t time.Time, offset time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	if accs == nil {
+		return
+	}
+	a := accumulatorOf(discipline)
+	a.n++
+	x := float64(offset)
+	a.sum += x
+	a.sumSq += x * x
+	if abs := timemath.Abs(offset); abs > a.maxAbs || a.maxAt.IsZero() {
+		a.maxAbs, a.maxAt = abs, t
+	}
+	if limit != 0 && timemath.Abs(offset) > limit {
+		a.exceed++
+	}
+}
+
+// EnterHoldover records the start of a holdover of discipline at t.
+func EnterHoldover(discipline string, t time.Time) {
+	mu.Lock()
+	defer mu.Unlock()
+	if accs == nil {
+		return
+	}
+	a := accumulatorOf(discipline)
+	if !a.active {
+		a.active = true
+		a.holdover = append(a.holdover, Holdover{Start: t})
+	}
+}
+
+// ExitHoldover records the end of a holdover of discipline at t.
+func ExitHoldover(discipline string, t time.Time) {
+	mu.Lock()
+	defer mu.Unlock()
+	if accs == nil {
+		return
+	}
+	a := accumulatorOf(discipline)
+	if a.active {
+		a.active = false
+		a.holdover[len(a.holdover)-1].End = t
+	}
+}
+
+// collect summarizes the observations of the period from start to end and
+// starts the next period.
+func collect(host, reference string, start, end time.Time) Report {
+	mu.Lock()
+	defer mu.Unlock()
+	r := Report{
+		Version:            Version,
+		Host:               host,
+		Start:              start,
+		End:                end,
+		Reference:          reference,
+		MaxDivergenceLimit: limit,
+		Compliant:          true,
+		Disciplines:        []Discipline{},
+	}
+	for name, a := range accs {
+		d := Discipline{
+			Name:          name,
+			Samples:       a.n,
+			MaxDivergence: a.maxAbs,
+			Exceedances:   a.exceed,
+			Holdover:      []Holdover{},
+		}
+		if a.n != 0 {
+			d.MeanOffset = time.Duration(a.sum / float64(a.n))
+			d.RMSOffset = time.Duration(math.Sqrt(a.sumSq / float64(a.n)))
+			d.MaxDivergenceAt = a.maxAt
+		}
+		for _, h := range a.holdover {
+			if h.End.IsZero() {
+				h.End, h.Ongoing = end, true
+			}
+			d.Holdover = append(d.Holdover, h)
+			d.HoldoverDuration += h.End.Sub(h.Start)
+		}
+		if d.Exceedances != 0 {
+			r.Compliant = false
+		}
+		r.Disciplines = append(r.Disciplines, d)
+
+		next := &accumulator{active: a.active}
+		if a.active {
+			next.holdover = []Holdover{{Start: end}}
+		}
+		accs[name] = next
+	}
+	sort.Slice(r.Disciplines, func(i, j int) bool {
+		return r.Disciplines[i].Name < r.Disciplines[j].Name
+	})
+	return r
+}
+
+// Sign returns the signed JSON document of r.
+func Sign(r Report, key ed25519.PrivateKey) ([]byte, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	// Not indented, as indentation would also apply to the signed report.
+	return json.Marshal(Signed{
+		Report:    b,
+		Algorithm: Algorithm,
+		PublicKey: key.Public().(ed25519.PublicKey),
+		Signature: ed25519.Sign(key, b),
+	})
+}
+
+// Verify checks the signature of the signed JSON document b and returns the
+// report together with the public key that signed it. The caller must check
+// that the key is trusted.
+func Verify(b []byte) (Report, ed25519.PublicKey, error) {
+	var s Signed
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return Report{}, nil, err
+	}
+	if s.Algorithm != Algorithm {
+		return Report{}, nil, errUnexpectedAlgorithm
+	}
+	if len(s.PublicKey) != ed25519.PublicKeySize ||
+		!ed25519.Verify(ed25519.PublicKey(s.PublicKey), s.Report, s.Signature) {
+		return Report{}, nil, errInvalidSignature
+	}
+	var r Report
+	err = json.Unmarshal(s.Report, &r)
+	if err != nil {
+		return Report{}, nil, err
+	}
+	return r, ed25519.PublicKey(s.PublicKey), nil
+}
+
+func write(dir string, r Report, b []byte) error {
+	name := filepath.Join(dir, "report-"+r.Start.UTC().Format("20060102T150405Z")+".json")
+	tmp := name + ".tmp"
+	err := os.WriteFile(tmp, b, 0o644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// Start generates a report at the end of each period until ctx is done. The
+// first report covers the partial period since Start was called.
+func Start(ctx context.Context, log *zap.Logger, cfg Config) {
+	if cfg.Interval <= 0 || cfg.Key == nil {
+		panic("invalid compliance report configuration")
+	}
+	mu.Lock()
+	limit = cfg.MaxDivergence
+	accs = make(map[string]*accumulator)
+	mu.Unlock()
+	host, err := os.Hostname()
+	if err != nil {
+		log.Info("failed to get host name", zap.Error(err))
+	}
+	go run(ctx, log, cfg, host, time.Now().UTC())
+}
+
+func run(ctx context.Context, log *zap.Logger, cfg Config, host string, start time.Time) {
+	for {
+		end := start.Truncate(cfg.Interval).Add(cfg.Interval)
+		timer := time.NewTimer(time.Until(end))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		r := collect(host, cfg.Reference, start, end)
+		b, err := Sign(r, cfg.Key)
+		if err != nil {
+			log.Error("failed to sign compliance report", zap.Error(err))
+		} else {
+			err = write(cfg.Directory, r, b)
+			if err != nil {
+				log.Error("failed to write compliance report",
+					zap.String("dir", cfg.Directory), zap.Error(err))
+			} else {
+				log.Info("wrote compliance report",
+					zap.Time("start", r.Start), zap.Time("end", r.End), zap.Bool("compliant", r.Compliant))
+			}
+		}
+		start = end
+	}
+}
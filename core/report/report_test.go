@@ -0,0 +1,69 @@
+package report_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"example.com/scion-time/core/report"
+)
+
+func TestCollect(t *testing.T) {
+	report.Enable(100 * time.Microsecond)
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	report.Observe("global", t0.Add(1*time.Minute), 10*time.Microsecond)
+	report.Observe("global", t0.Add(2*time.Minute), -200*time.Microsecond)
+	report.EnterHoldover("global", t0.Add(3*time.Minute))
+	report.ExitHoldover("global", t0.Add(5*time.Minute))
+	report.EnterHoldover("global", t0.Add(50*time.Minute))
+
+	r := report.Collect("host", "UTC(PTB)", t0, t0.Add(time.Hour))
+	if r.Compliant || len(r.Disciplines) != 1 {
+		t.Fatalf("Collect() = %+v; want one non-compliant discipline", r)
+	}
+	d := r.Disciplines[0]
+	if d.Samples != 2 || d.Exceedances != 1 || d.MaxDivergence != 200*time.Microsecond ||
+		!d.MaxDivergenceAt.Equal(t0.Add(2*time.Minute)) {
+		t.Errorf("unexpected offset summary: %+v", d)
+	}
+	if len(d.Holdover) != 2 || !d.Holdover[1].Ongoing || d.HoldoverDuration != 12*time.Minute {
+		t.Errorf("unexpected holdover summary: %+v", d)
+	}
+
+	// The ongoing holdover continues in the next period
+	r = report.Collect("host", "UTC(PTB)", t0.Add(time.Hour), t0.Add(2*time.Hour))
+	d = r.Disciplines[0]
+	if !r.Compliant || d.Samples != 0 || d.HoldoverDuration != time.Hour {
+		t.Errorf("unexpected summary of next period: %+v", r)
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := report.Report{
+		Version:   report.Version,
+		Host:      "host",
+		Start:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:       time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Reference: "UTC(PTB)",
+		Compliant: true,
+	}
+	b, err := report.Sign(r, key)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	v, k, err := report.Verify(b)
+	if err != nil || !k.Equal(pub) || v.Reference != r.Reference || !v.End.Equal(r.End) {
+		t.Fatalf("Verify() = %+v, %v, %v; want %+v", v, k, err, r)
+	}
+
+	b = bytes.Replace(b, []byte("UTC(PTB)"), []byte("UTC(NPL)"), 1)
+	_, _, err = report.Verify(b)
+	if err == nil {
+		t.Errorf("Verify succeeded on modified report")
+	}
+}
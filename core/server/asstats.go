@@ -0,0 +1,183 @@
+package server
+
+// Request statistics of the SCION server aggregated per source ISD-AS. The
+// number of tracked ASes is bounded; requests from further ASes are
+// aggregated under "other".
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/scionproto/scion/pkg/addr"
+
+	"example.com/scion-time/base/metrics"
+)
+
+const (
+	asStatsMaxEntries = 4096
+	asStatsNumShards  = 16
+	asStatsRateWindow = 1 * time.Minute
+
+	asStatsOther = "other"
+)
+
+type asStatsItem struct {
+	reqs     uint64
+	authReqs uint64
+
+	// Requests counted in the current and in the previous rate window
+	window    time.Time
+	count     uint64
+	prevCount uint64
+
+	reqsCounters [2]prometheus.Counter // unauthenticated, authenticated
+}
+
+// asStatsShard holds the statistics of a subset of the ASes so that workers
+// serving clients from different ASes rarely contend for the same lock.
+type asStatsShard struct {
+	mu    sync.Mutex
+	items map[addr.IA]*asStatsItem
+	other *asStatsItem
+}
+
+type ASStats struct {
+	IA             string  `json:"ia"`
+	Requests       uint64  `json:"requests"`
+	AuthRequests   uint64  `json:"auth_requests"`
+	UnauthRequests uint64  `json:"unauth_requests"`
+	Rate           float64 `json:"rate"` // requests per second
+}
+
+var (
+	asStats     [asStatsNumShards]asStatsShard
+	asStatsReqs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: metrics.SCIONServerASReqsAcceptedN,
+		Help: metrics.SCIONServerASReqsAcceptedH,
+	}, []string{"ia", "auth"})
+)
+
+func newASStatsItem(k string, now time.Time) *asStatsItem {
+	return &asStatsItem{
+		window: now,
+		reqsCounters: [2]prometheus.Counter{
+			asStatsReqs.WithLabelValues(k, "false"),
+			asStatsReqs.WithLabelValues(k, "true"),
+		},
+	}
+}
+
+// advance moves the rate window of it forward to now. Counts are only shifted
+// when a window has passed, so that the rate decays lazily.
+func (it *asStatsItem) advance(now time.Time) {
+	d := now.Sub(it.window)
+	if d < asStatsRateWindow {
+		return
+	}
+	if d < 2*asStatsRateWindow {
+		it.prevCount = it.count
+		it.window = it.window.Add(asStatsRateWindow)
+	} else {
+		it.prevCount = 0
+		it.window = now
+	}
+	it.count = 0
+}
+
+// rate returns the request rate of it at time now, interpolating between the
+// previous and the current window.
+func (it asStatsItem) rate(now time.Time) float64 {
+	it.advance(now)
+	f := 1 - now.Sub(it.window).Seconds()/asStatsRateWindow.Seconds()
+	if f < 0 {
+		f = 0
+	}
+	return (f*float64(it.prevCount) + float64(it.count)) / asStatsRateWindow.Seconds()
+}
+
+// recordASRequest counts a request accepted from a client in AS ia.
+func recordASRequest(ia addr.IA, authenticated bool) {
+	now := time.Now()
+	sh := &asStats[uint64(ia)%asStatsNumShards]
+
+	sh.mu.Lock()
+	it, ok := sh.items[ia]
+	if !ok {
+		if len(sh.items) < asStatsMaxEntries/asStatsNumShards {
+			if sh.items == nil {
+				sh.items = make(map[addr.IA]*asStatsItem)
+			}
+			it = newASStatsItem(ia.String(), now)
+			sh.items[ia] = it
+		} else {
+			if sh.other == nil {
+				sh.other = newASStatsItem(asStatsOther, now)
+			}
+			it = sh.other
+		}
+	}
+	it.reqs++
+	if authenticated {
+		it.authReqs++
+	}
+	it.advance(now)
+	it.count++
+	c := it.reqsCounters[0]
+	if authenticated {
+		c = it.reqsCounters[1]
+	}
+	sh.mu.Unlock()
+
+	c.Inc()
+}
+
+func (it *asStatsItem) stats(k string, now time.Time) ASStats {
+	return ASStats{
+		IA:             k,
+		Requests:       it.reqs,
+		AuthRequests:   it.authReqs,
+		UnauthRequests: it.reqs - it.authReqs,
+		Rate:           it.rate(now),
+	}
+}
+
+// ASStatistics returns the request statistics of the n ASes with the most
+// requests, in descending order. A non-positive n returns all ASes.
+func ASStatistics(n int) []ASStats {
+	now := time.Now()
+	var ss []ASStats
+	var other ASStats
+	for i := range asStats {
+		sh := &asStats[i]
+		sh.mu.Lock()
+		for ia, it := range sh.items {
+			ss = append(ss, it.stats(ia.String(), now))
+		}
+		if sh.other != nil {
+			s := sh.other.stats(asStatsOther, now)
+			other.Requests += s.Requests
+			other.AuthRequests += s.AuthRequests
+			other.UnauthRequests += s.UnauthRequests
+			other.Rate += s.Rate
+		}
+		sh.mu.Unlock()
+	}
+	if other.Requests != 0 {
+		other.IA = asStatsOther
+		ss = append(ss, other)
+	}
+	sort.Slice(ss, func(i, j int) bool {
+		if ss[i].Requests != ss[j].Requests {
+			return ss[i].Requests > ss[j].Requests
+		}
+		return ss[i].IA < ss[j].IA
+	})
+	if n > 0 && n < len(ss) {
+		ss = ss[:n]
+	}
+	return ss
+}
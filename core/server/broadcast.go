@@ -0,0 +1,116 @@
+package server
+
+// Broadcast mode: packets in mode 5 are periodically sent to a broadcast or
+// multicast address to disseminate time to many hosts on a LAN with a single
+// packet per interval, see RFC 5905, Section 8. Clients calibrate the delay
+// from the server with regular unicast exchanges. Broadcast packets carry a MAC
+// computed with a symmetric key shared with the clients.
+//
+// Broadcast packets are not sent with generic segmentation offload, unlike the
+// bursts of the benchmark tool: GSO only pays off for several segments sent to
+// the same destination in one system call, but a broadcast server sends a
+// single packet per interval. The transmit timestamp of each packet is taken
+// immediately before it is written, so holding packets back to send them in a
+// batch would delay them by up to the batch duration after their timestamps
+// and bias the offsets measured by all clients.
+
+import (
+	"context"
+	"math/bits"
+	"net"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/metrics"
+
+	"example.com/scion-time/core/config"
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/net/ntp"
+	"example.com/scion-time/net/udp"
+)
+
+var broadcastsSent = promauto.NewCounter(prometheus.CounterOpts{
+	Name: metrics.ServerBroadcastsSentN,
+	Help: metrics.ServerBroadcastsSentH,
+})
+
+func broadcastPoll(interval time.Duration) int8 {
+	s := uint64(interval / time.Second)
+	if s == 0 {
+		return 0
+	}
+	return int8(bits.Len64(s) - 1)
+}
+
+func runBroadcastServer(ctx context.Context, log *zap.Logger,
+	conn *net.UDPConn, dstAddr *net.UDPAddr, interval time.Duration, key ntp.SymmetricKey) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var pkt ntp.Packet
+	var buf []byte
+	for {
+		pkt.SetLeapIndicator(leapIndicator(timebase.Now()))
+		pkt.SetVersion(ntp.VersionMax)
+		pkt.SetMode(ntp.ModeBroadcast)
+		ref := serverReference.Load()
+		pkt.Stratum = ref.stratum
+		pkt.Poll = broadcastPoll(interval)
+		pkt.Precision = serverPrecision
+		pkt.RootDispersion = rootDispersion()
+		pkt.ReferenceID = ref.refID
+
+		txt := ntp.Time64FromTime(timebase.Now())
+		pkt.ReferenceTime = txt
+		pkt.TransmitTime = txt
+
+		ntp.EncodePacket(&buf, &pkt)
+		ntp.AppendMAC(&buf, key)
+		n, err := conn.WriteToUDP(buf, dstAddr)
+		if err != nil || n != len(buf) {
+			log.Error("failed to write packet", zap.Error(err))
+		} else {
+			broadcastsSent.Inc()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// StartBroadcastServer starts sending broadcast packets from localHost to
+// dstAddr, a broadcast or multicast address, every interval. The packets are
+// authenticated with key.
+func StartBroadcastServer(ctx context.Context, log *zap.Logger,
+	localHost, dstAddr *net.UDPAddr, interval time.Duration, key ntp.SymmetricKey) {
+	log.Info("server broadcasting via IP",
+		zap.Stringer("ip", localHost.IP),
+		zap.Stringer("to", dstAddr),
+		zap.Duration("interval", interval),
+	)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: localHost.IP, Zone: localHost.Zone})
+	if err != nil {
+		log.Fatal("failed to listen for packets", zap.Error(err))
+	}
+	if !dstAddr.IP.IsMulticast() {
+		err = udp.EnableBroadcast(conn)
+		if err != nil {
+			log.Fatal("failed to enable broadcast", zap.Error(err))
+		}
+	}
+	err = udp.SetDSCP(conn, config.DSCP())
+	if err != nil {
+		log.Info("failed to set DSCP", zap.Error(err))
+	}
+	closeOnDone(ctx, conn)
+	go runBroadcastServer(ctx, log, conn, dstAddr, interval, key)
+}
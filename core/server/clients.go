@@ -0,0 +1,99 @@
+package server
+
+// Telemetry of downstream clients: requests of clients in interleaved mode
+// carry all four timestamps of their previous exchange with the server, from
+// which the server estimates the apparent clock offsets of these clients. The
+// latest estimates of a bounded number of clients are kept for inspection.
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/base/timemath"
+
+	"example.com/scion-time/net/ntp"
+)
+
+const clientStatsMaxEntries = 4096
+
+type ClientStats struct {
+	Client         string        `json:"client"`
+	Time           time.Time     `json:"time"`
+	Offset         time.Duration `json:"offset_ns"`
+	RoundTripDelay time.Duration `json:"round_trip_delay_ns"`
+	NumEstimates   uint64        `json:"num_estimates"`
+}
+
+var (
+	clientStatsMu sync.Mutex
+	clientStats   = make(map[string]*ClientStats)
+
+	clientOffsets = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name: metrics.ServerClientOffsetsN,
+		Help: metrics.ServerClientOffsetsH,
+		Buckets: []float64{
+			-1e-1, -1e-2, -1e-3, -1e-4, -1e-5, -1e-6,
+			1e-6, 1e-5, 1e-4, 1e-3, 1e-2, 1e-1,
+		},
+	})
+)
+
+// recordClientOffset estimates the clock offset of clientID relative to the
+// server from its previous exchange: sent at t0 and received at t3 by the
+// client, received at t1 and sent at t2 by the server.
+func recordClientOffset(clientID string, t0, t1, t2, t3 ntp.Time64) {
+	ct0, st1 := ntp.TimeFromTime64(t0), ntp.TimeFromTime64(t1)
+	st2, ct3 := ntp.TimeFromTime64(t2), ntp.TimeFromTime64(t3)
+	rtd := ntp.RoundTripDelay(ct0, st1, st2, ct3)
+	if rtd < 0 {
+		return
+	}
+	off := -ntp.ClockOffset(ct0, st1, st2, ct3)
+	clientOffsets.Observe(timemath.Seconds(off))
+
+	clientStatsMu.Lock()
+	defer clientStatsMu.Unlock()
+	s, ok := clientStats[clientID]
+	if !ok {
+		if len(clientStats) >= clientStatsMaxEntries {
+			// evict the client with the oldest estimate
+			var oldest *ClientStats
+			for _, x := range clientStats {
+				if oldest == nil || x.Time.Before(oldest.Time) {
+					oldest = x
+				}
+			}
+			delete(clientStats, oldest.Client)
+		}
+		s = &ClientStats{Client: clientID}
+		clientStats[clientID] = s
+	}
+	s.Time = st1
+	s.Offset = off
+	s.RoundTripDelay = rtd
+	s.NumEstimates++
+}
+
+// ClientStatistics returns the latest offset estimates of the downstream
+// clients, the largest absolute offsets first.
+func ClientStatistics() []ClientStats {
+	clientStatsMu.Lock()
+	ss := make([]ClientStats, 0, len(clientStats))
+	for _, s := range clientStats {
+		ss = append(ss, *s)
+	}
+	clientStatsMu.Unlock()
+	sort.Slice(ss, func(i, j int) bool {
+		oi, oj := timemath.Abs(ss[i].Offset), timemath.Abs(ss[j].Offset)
+		if oi != oj {
+			return oi > oj
+		}
+		return ss[i].Client < ss[j].Client
+	})
+	return ss
+}
@@ -1,13 +1,128 @@
 package server
 
 import (
+	"context"
+	"net"
+	"net/netip"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/scionproto/scion/pkg/slayers"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/net/ntp"
+)
+
+var (
+	DecodeFailed      = decodeFailed
+	UpdateTXTimestamp = updateTXTimestamp
+	ReducePrecision   = reducePrecision
+	ServedResolution  = servedResolution
 )
 
-var HandleRequest = handleRequest
+// ClearReducedPrecision serves all clients with full precision again.
+func ClearReducedPrecision() {
+	reducedResolution = 0
+	fullPrecisionACL = nil
+}
+
+func HandleRequest(clientID string, req *ntp.Packet, rxt, txt *time.Time, resp *ntp.Packet) {
+	handleRequest(nil, clientID, req, rxt, txt, resp)
+}
 
 func LogTSS(t *testing.T, prefix string) {
 	t.Helper()
 	t.Logf("%s:tss = %+v", prefix, tss)
 	t.Logf("%s:tssQ = %+v", prefix, tssQ)
 }
+
+var RecordASRequest = recordASRequest
+
+type PathCache = pathCache
+
+var NewPathCache = newPathCache
+
+func (c *PathCache) Reverse(s *slayers.SCION, srcPort uint16) error {
+	return c.reverse(s, srcPort)
+}
+
+type RequestQueue = requestQueue
+
+var NewRequestQueue = newRequestQueue
+
+func (q *RequestQueue) Push(buf []byte) {
+	q.push(buf, nil /* oob */, netip.AddrPort{}, time.Time{})
+}
+
+// Drain returns the payloads of all queued requests.
+func (q *RequestQueue) Drain() [][]byte {
+	var bufs [][]byte
+	q.close()
+	q.serve(func(r *queuedRequest) {
+		bufs = append(bufs, append([]byte(nil), r.buf...))
+	})
+	return bufs
+}
+
+const TierBucketsCap = tierBucketsCap
+
+func Admit(authenticated bool, clientID string, now time.Time) bool {
+	t, name := serviceTier(authenticated)
+	return admit(t, name, clientID, now)
+}
+
+type TXCorrection = txCorrection
+
+func NewTXCorrection() *TXCorrection {
+	return &txCorrection{gauge: prometheus.NewGauge(prometheus.GaugeOpts{Name: "test"})}
+}
+
+func (c *TXCorrection) Apply(txt time.Time) time.Time { return c.apply(txt) }
+func (c *TXCorrection) Update(txt0, txt1 time.Time)   { c.update(txt0, txt1) }
+
+// ASRequestRate returns the request rate at now of an AS with count requests
+// in the window starting at window and prevCount requests in the window
+// before.
+func ASRequestRate(window time.Time, count, prevCount uint64, now time.Time) float64 {
+	it := asStatsItem{window: window, count: count, prevCount: prevCount}
+	return it.rate(now)
+}
+
+const ASStatsRateWindow = asStatsRateWindow
+
+// ResetASStatistics discards the statistics recorded so far.
+func ResetASStatistics() {
+	for i := range asStats {
+		s := &asStats[i]
+		s.mu.Lock()
+		s.items = nil
+		s.other = nil
+		s.mu.Unlock()
+	}
+}
+
+func (c *PathCache) Len() int {
+	return c.lru.Len()
+}
+
+type SCIONSender = scionSender
+
+func NewSCIONSender(conn *net.UDPConn) *SCIONSender {
+	return &scionSender{conn: conn}
+}
+
+func (s *SCIONSender) Send(log *zap.Logger, b []byte, addr netip.AddrPort) (time.Time, bool, error) {
+	return s.send(log, b, addr)
+}
+
+// HandleSCIONPacket processes the SCION packet buf received from lastHop at
+// rxt with control data oob by a server on localHostPort, which sends its
+// response via conn.
+func HandleSCIONPacket(conn *net.UDPConn, localHostPort int, buf, oob []byte, lastHop netip.AddrPort, rxt time.Time) {
+	sender := &scionSender{conn: conn, txc: NewTXCorrection()}
+	h := newSCIONHandler(context.Background(), zap.NewNop(), scionMetrics.Load(), newWorkerMetrics("test", 0),
+		sender, netip.AddrPort{}, localHostPort, nil /* fetcher */, nil /* provider */)
+	h(buf, oob, lastHop, rxt)
+}
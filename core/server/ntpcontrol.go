@@ -0,0 +1,214 @@
+package server
+
+// Minimal read-only responder for NTP control messages (mode 6), sufficient
+// for queries like "ntpq -c rv". Disabled unless explicitly enabled, requests
+// are subject to an ACL and a global rate limit.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/net/ntp"
+)
+
+const (
+	controlRate  = 16.0
+	controlBurst = 32.0
+
+	controlLineLen = 72
+
+	controlStatusSourceOther = 7
+)
+
+type controlVar struct {
+	name, value string
+}
+
+var (
+	controlMu      sync.Mutex
+	controlACL     []netip.Prefix
+	controlTokens  float64
+	controlUpdated time.Time
+
+	controlLoopback = []netip.Prefix{
+		netip.MustParsePrefix("127.0.0.0/8"),
+		netip.MustParsePrefix("::1/128"),
+	}
+)
+
+// EnableControlResponder enables responses to mode 6 requests from addresses
+// in acl. If acl is empty, only requests from loopback addresses are served.
+func EnableControlResponder(acl []netip.Prefix) {
+	if len(acl) == 0 {
+		acl = controlLoopback
+	}
+	controlMu.Lock()
+	defer controlMu.Unlock()
+	controlACL = acl
+	controlTokens = controlBurst
+	controlUpdated = time.Now()
+}
+
+func controlPermitted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	controlMu.Lock()
+	defer controlMu.Unlock()
+	allowed := false
+	for _, p := range controlACL {
+		if p.Contains(addr) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return false
+	}
+	now := time.Now()
+	controlTokens += now.Sub(controlUpdated).Seconds() * controlRate
+	if controlTokens > controlBurst {
+		controlTokens = controlBurst
+	}
+	controlUpdated = now
+	if controlTokens < 1.0 {
+		return false
+	}
+	controlTokens--
+	return true
+}
+
+func formatTime64(t ntp.Time64) string {
+	return fmt.Sprintf("0x%08x.%08x", t.Seconds, t.Fraction)
+}
+
+func formatTime32(t ntp.Time32) string {
+	ms := float64(t.Seconds)*1e3 + float64(t.Fraction)*1e3/(1<<16)
+	return fmt.Sprintf("%.3f", ms)
+}
+
+func formatRefID(ref *reference) string {
+	b := binary.BigEndian.AppendUint32(nil, ref.refID)
+	if ref.stratum <= 1 {
+		return strings.TrimRight(string(b), "\x00")
+	}
+	return fmt.Sprintf("%d.%d.%d.%d", b[0], b[1], b[2], b[3])
+}
+
+func systemVariables() []controlVar {
+	now := ntp.Time64FromTime(timebase.Now())
+	ref := serverReference.Load()
+	return []controlVar{
+		{"version", `"scion-time"`},
+		{"processor", `"` + runtime.GOARCH + `"`},
+		{"system", `"` + runtime.GOOS + `"`},
+		{"leap", fmt.Sprint(leapIndicator(timebase.Now()))},
+		{"stratum", fmt.Sprint(ref.stratum)},
+		{"precision", fmt.Sprint(serverPrecision)},
+		{"rootdelay", formatTime32(ntp.Time32{})},
+		{"rootdisp", formatTime32(rootDispersion())},
+		{"refid", formatRefID(ref)},
+		{"clock", formatTime64(now)},
+	}
+}
+
+func systemStatus() uint16 {
+	return uint16(leapIndicator(timebase.Now()))<<14 | uint16(controlStatusSourceOther)<<8
+}
+
+func encodeVariables(vs []controlVar, names []string) ([]byte, bool) {
+	var b strings.Builder
+	n := 0
+	for _, v := range vs {
+		if len(names) != 0 {
+			found := false
+			for _, name := range names {
+				if name == v.name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		s := v.name + "=" + v.value
+		if b.Len() != 0 {
+			if n+len(s)+2 > controlLineLen {
+				b.WriteString(",\r\n")
+				n = 0
+			} else {
+				b.WriteString(", ")
+				n += 2
+			}
+		}
+		b.WriteString(s)
+		n += len(s)
+	}
+	if b.Len() != 0 {
+		b.WriteString("\r\n")
+	}
+	if b.Len() > ntp.ControlMaxDataLen {
+		return nil, false
+	}
+	return []byte(b.String()), true
+}
+
+func handleControlRequest(req, resp *ntp.ControlPacket) {
+	resp.LVM = req.LVM
+	resp.REMOp = ntp.ControlFlagResponse | req.Opcode()
+	resp.Sequence = req.Sequence
+	resp.AssociationID = req.AssociationID
+	resp.Offset = 0
+	resp.Data = nil
+
+	fail := func(code uint16) {
+		resp.REMOp |= ntp.ControlFlagError
+		resp.Status = code << 8
+	}
+
+	if req.REMOp&(ntp.ControlFlagResponse|ntp.ControlFlagError|ntp.ControlFlagMore) != 0 ||
+		req.Offset != 0 {
+		fail(ntp.ControlErrorBadFormat)
+		return
+	}
+
+	switch req.Opcode() {
+	case ntp.ControlOpReadStatus:
+		if req.AssociationID != 0 {
+			fail(ntp.ControlErrorUnknownAssociation)
+			return
+		}
+		resp.Status = systemStatus()
+	case ntp.ControlOpReadVariables:
+		if req.AssociationID != 0 {
+			fail(ntp.ControlErrorUnknownAssociation)
+			return
+		}
+		var names []string
+		for _, s := range strings.Split(string(req.Data), ",") {
+			s = strings.TrimSpace(s)
+			if s != "" {
+				names = append(names, s)
+			}
+		}
+		data, ok := encodeVariables(systemVariables(), names)
+		if !ok {
+			fail(ntp.ControlErrorUnspecified)
+			return
+		}
+		if len(names) != 0 && len(data) == 0 {
+			fail(ntp.ControlErrorUnknownVariable)
+			return
+		}
+		resp.Status = systemStatus()
+		resp.Data = data
+	default:
+		fail(ntp.ControlErrorUnknownOpcode)
+	}
+}
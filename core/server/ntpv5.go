@@ -0,0 +1,93 @@
+package server
+
+// Experimental NTPv5 support: NTPv5 requests are answered in basic mode and
+// NTPv4 clients offering NTPv5 are told that the server supports it. Requests
+// for TAI are answered in TAI if the TAI-UTC offset is known, otherwise in
+// UTC.
+
+import (
+	"net/netip"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/net/ntp"
+)
+
+var ntpv5Enabled atomic.Bool
+
+// EnableNTPv5 enables the experimental support for NTPv5.
+func EnableNTPv5() {
+	ntpv5Enabled.Store(true)
+}
+
+// negotiateV5 confirms the offer of NTPv5 in an NTPv4 request.
+func negotiateV5(req, resp *ntp.Packet) {
+	if ntpv5Enabled.Load() && req.ReferenceTime == ntp.NegotiationV5 {
+		resp.ReferenceTime = ntp.NegotiationV5
+	}
+}
+
+func handleRequestV5(txc *txCorrection, req *ntp.PacketV5, rxt, txt *time.Time, resp *ntp.PacketV5) {
+	resp.SetLeapIndicator(leapIndicator(*rxt))
+	resp.SetVersion(ntp.Version5)
+	resp.SetMode(ntp.ModeServer)
+	ref := serverReference.Load()
+	resp.Stratum = ref.stratum
+	resp.Poll = req.Poll
+	resp.Precision = serverPrecision
+	resp.Timescale = ntp.TimescaleUTC
+	resp.RootDispersion = ntp.Time32V5FromTime32(rootDispersion())
+	resp.ClientCookie = req.ClientCookie
+
+	*txt = txc.apply(timebase.Now())
+	if !rxt.Before(*txt) {
+		*txt = rxt.Add(1)
+	}
+
+	r, t := *rxt, *txt
+	if req.Timescale == ntp.TimescaleTAI {
+		var ok bool
+		if r, t, ok = taiTimestamps(r, t); ok {
+			resp.Timescale = ntp.TimescaleTAI
+		}
+	}
+	resp.Era = ntp.Era(r)
+	resp.ReceiveTime = ntp.Time64FromTime(r)
+	resp.TransmitTime = ntp.Time64FromTime(t)
+}
+
+// handleIPPacketV5 processes the NTPv5 packet in *buf, see handleIPPacket.
+func handleIPPacketV5(log *zap.Logger, mtrcs *ipServerMetrics, txc *txCorrection,
+	buf *[]byte, rxt time.Time, srcAddr netip.AddrPort, resp *ipResponse) bool {
+	if !ntpv5Enabled.Load() {
+		return false
+	}
+	var ntpreq ntp.PacketV5
+	err := ntp.DecodePacketV5(&ntpreq, *buf)
+	if err != nil {
+		decodeFailed(log, mtrcs.pktsMalformed, err)
+		return false
+	}
+	err = ntp.ValidateRequestV5(&ntpreq)
+	if err != nil {
+		log.Info("failed to validate packet payload", zap.Error(err))
+		return false
+	}
+
+	mtrcs.reqsAccepted.Inc()
+	log.Debug("received NTPv5 request",
+		zap.Time("at", rxt),
+		zap.Stringer("from", srcAddr),
+	)
+
+	var ntpresp ntp.PacketV5
+	resp.rxt = rxt
+	handleRequestV5(txc, &ntpreq, &resp.rxt, &resp.txt0, &ntpresp)
+	reducePrecisionV5(&ntpresp, servedResolution(0, srcAddr.Addr()))
+	ntp.EncodePacketV5(buf, &ntpresp)
+	return true
+}
@@ -74,11 +74,14 @@ func handleKeyExchangeTLS(log *zap.Logger, conn *tls.Conn, localPort int, provid
 	}
 }
 
-func runNTSKEServerTLS(log *zap.Logger, listener net.Listener, localPort int, provider *ntske.Provider) {
+func runNTSKEServerTLS(ctx context.Context, log *zap.Logger, listener net.Listener, localPort int, provider *ntske.Provider) {
 	defer listener.Close()
 	for {
 		conn, err := ntske.AcceptTLSConn(listener)
 		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			log.Info("failed to accept client", zap.Error(err))
 			continue
 		}
@@ -98,5 +101,6 @@ func StartNTSKEServerIP(ctx context.Context, log *zap.Logger, localIP net.IP, lo
 		log.Fatal("failed to create TLS listener")
 	}
 
-	go runNTSKEServerTLS(log, listener, localPort, provider)
+	closeOnDone(ctx, listener)
+	go runNTSKEServerTLS(ctx, log, listener, localPort, provider)
 }
@@ -84,8 +84,11 @@ func handleKeyExchangeQUIC(log *zap.Logger, conn quic.Connection, localPort int,
 func runNTSKEServerQUIC(ctx context.Context, log *zap.Logger, listener quic.Listener, localPort int, provider *ntske.Provider) {
 	defer listener.Close()
 	for {
-		conn, err := ntske.AcceptQUICConn(context.Background(), listener)
+		conn, err := ntske.AcceptQUICConn(ctx, listener)
 		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			log.Info("failed to accept connection", zap.Error(err))
 			continue
 		}
@@ -0,0 +1,141 @@
+package server
+
+// Cache of reversed SCION paths per client flow. A flow is identified by the
+// client's ISD-AS, host address and port, and the fingerprint of the path,
+// i.e., the sequence of interfaces it traverses. Requests of a flow usually
+// arrive with the same raw path bytes, so the reversed path of a previous
+// request can be reused for the response instead of reversing the path again.
+// If the raw path of a flow changes, e.g., after the path has been renewed,
+// its entry is replaced. Each SCION server worker has its own cache; entries
+// are evicted in least recently used order.
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/slayers/path"
+	scionpath "github.com/scionproto/scion/pkg/slayers/path/scion"
+
+	"example.com/scion-time/base/metrics"
+
+	"example.com/scion-time/net/scion"
+)
+
+const pathCacheCap = 1024
+
+type pathCacheEntry struct {
+	key  string
+	req  []byte // raw path of the request
+	path []byte // reversed path
+}
+
+type pathCache struct {
+	cap     int
+	entries map[string]*list.Element
+	lru     *list.List
+	key     []byte
+	req     []byte
+}
+
+var pathCacheMetrics = struct {
+	hits      prometheus.Counter
+	misses    prometheus.Counter
+	evictions prometheus.Counter
+}{
+	hits: promauto.NewCounter(prometheus.CounterOpts{
+		Name: metrics.SCIONServerPathCacheHitsN,
+		Help: metrics.SCIONServerPathCacheHitsH,
+	}),
+	misses: promauto.NewCounter(prometheus.CounterOpts{
+		Name: metrics.SCIONServerPathCacheMissesN,
+		Help: metrics.SCIONServerPathCacheMissesH,
+	}),
+	evictions: promauto.NewCounter(prometheus.CounterOpts{
+		Name: metrics.SCIONServerPathCacheEvictionsN,
+		Help: metrics.SCIONServerPathCacheEvictionsH,
+	}),
+}
+
+func newPathCache(cap int) *pathCache {
+	if cap <= 0 {
+		panic("invalid path cache capacity")
+	}
+	return &pathCache{
+		cap:     cap,
+		entries: make(map[string]*list.Element, cap),
+		lru:     list.New(),
+	}
+}
+
+// reverse reverses the path of s like scion.ReversePath for the response to
+// a request from the client at the destination of s, i.e., addresses must
+// have been swapped already, with source port srcPort. Standard SCION paths
+// are looked up in and added to the cache.
+func (c *pathCache) reverse(s *slayers.SCION, srcPort uint16) error {
+	p, ok := s.Path.(*scionpath.Raw)
+	if !ok || len(p.Raw) < scionpath.MetaLen+p.NumINF*path.InfoLen+p.NumHops*path.HopLen {
+		return scion.ReversePath(s)
+	}
+
+	c.key = c.key[:0]
+	c.key = binary.BigEndian.AppendUint64(c.key, uint64(s.DstIA))
+	c.key = binary.BigEndian.AppendUint16(c.key, srcPort)
+	c.key = append(c.key, byte(len(s.RawDstAddr)))
+	c.key = append(c.key, s.RawDstAddr...)
+	c.key = appendPathFingerprint(c.key, p)
+
+	e, ok := c.entries[string(c.key)]
+	if ok {
+		c.lru.MoveToFront(e)
+		x := e.Value.(*pathCacheEntry)
+		if bytes.Equal(x.req, p.Raw) {
+			pathCacheMetrics.hits.Inc()
+			copy(p.Raw, x.path)
+			return p.DecodeFromBytes(p.Raw)
+		}
+	}
+	pathCacheMetrics.misses.Inc()
+
+	c.req = append(c.req[:0], p.Raw...)
+	err := scion.ReversePath(s)
+	if err != nil {
+		return err
+	}
+	var x *pathCacheEntry
+	if ok {
+		// The path of the flow has changed
+		x = e.Value.(*pathCacheEntry)
+	} else {
+		if c.lru.Len() == c.cap {
+			e := c.lru.Back()
+			x = e.Value.(*pathCacheEntry)
+			delete(c.entries, x.key)
+			c.lru.Remove(e)
+			pathCacheMetrics.evictions.Inc()
+		} else {
+			x = &pathCacheEntry{}
+		}
+		x.key = string(c.key)
+		c.entries[x.key] = c.lru.PushFront(x)
+	}
+	x.req = append(x.req[:0], c.req...)
+	x.path = append(x.path[:0], p.Raw...)
+	return nil
+}
+
+// appendPathFingerprint appends the segment lengths and the interfaces of the
+// hop fields of p to b.
+func appendPathFingerprint(b []byte, p *scionpath.Raw) []byte {
+	b = append(b, p.PathMeta.SegLen[:]...)
+	off := scionpath.MetaLen + p.NumINF*path.InfoLen
+	for i := 0; i != p.NumHops; i++ {
+		h := off + i*path.HopLen
+		b = append(b, p.Raw[h+2:h+6]...) // ConsIngress, ConsEgress
+	}
+	return b
+}
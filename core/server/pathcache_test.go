@@ -0,0 +1,167 @@
+package server_test
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/slayers/path"
+	scionpath "github.com/scionproto/scion/pkg/slayers/path/scion"
+
+	"example.com/scion-time/core/server"
+)
+
+func newRequestLayer(t testing.TB, host string) *slayers.SCION {
+	return newRenewedRequestLayer(t, host, 0x100)
+}
+
+// newRenewedRequestLayer returns a request from host via a path whose first
+// segment has timestamp ts.
+func newRenewedRequestLayer(t testing.TB, host string, ts uint32) *slayers.SCION {
+	d := &scionpath.Decoded{
+		Base: scionpath.Base{
+			PathMeta: scionpath.MetaHdr{
+				CurrINF: 1,
+				CurrHF:  2,
+				SegLen:  [3]uint8{2, 1, 0},
+			},
+			NumINF:  2,
+			NumHops: 3,
+		},
+		InfoFields: []path.InfoField{
+			{SegID: 0x111, Timestamp: ts},
+			{SegID: 0x222, Timestamp: 0x200, ConsDir: true},
+		},
+		HopFields: []path.HopField{
+			{ExpTime: 63, ConsIngress: 0, ConsEgress: 1, Mac: [path.MacLen]byte{1, 2, 3, 4, 5, 6}},
+			{ExpTime: 63, ConsIngress: 2, ConsEgress: 0, Mac: [path.MacLen]byte{2, 3, 4, 5, 6, 7}},
+			{ExpTime: 63, ConsIngress: 0, ConsEgress: 3, Mac: [path.MacLen]byte{3, 4, 5, 6, 7, 8}},
+		},
+	}
+	b := make([]byte, d.Len())
+	err := d.SerializeTo(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &scionpath.Raw{}
+	err = p.DecodeFromBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &slayers.SCION{
+		PathType: scionpath.PathType,
+		Path:     p,
+		SrcIA:    addr.MustIAFrom(1, 0xff0000000110),
+		DstIA:    addr.MustIAFrom(1, 0xff0000000111),
+	}
+	err = s.SetSrcAddr(&net.IPAddr{IP: net.ParseIP("10.1.1.10").To4()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.SetDstAddr(&net.IPAddr{IP: net.ParseIP(host).To4()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestPathCache(t *testing.T) {
+	c := server.NewPathCache(1)
+
+	s0 := newRequestLayer(t, "10.1.1.11")
+	expected, err := s0.Path.Reverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b0 := make([]byte, expected.Len())
+	err = expected.SerializeTo(b0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// miss, hit, miss with eviction, miss
+	for _, host := range []string{"10.1.1.11", "10.1.1.11", "10.1.1.12", "10.1.1.11"} {
+		s := newRequestLayer(t, host)
+		err = c.Reverse(s, 123)
+		if err != nil {
+			t.Fatalf("Reverse failed: %v", err)
+		}
+		b1 := make([]byte, s.Path.Len())
+		err = s.Path.SerializeTo(b1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b0, b1) {
+			t.Errorf("Reverse() = %x, want %x", b1, b0)
+		}
+	}
+}
+
+func reversed(t testing.TB, s *slayers.SCION) []byte {
+	p, err := s.Path.Reverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, p.Len())
+	err = p.SerializeTo(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestPathCacheRenewedPath(t *testing.T) {
+	c := server.NewPathCache(2)
+
+	// Requests of one flow via a renewed path must neither reuse the stale
+	// reversed path nor evict the entries of other flows.
+	for _, x := range []struct {
+		host string
+		ts   uint32
+	}{{"10.1.1.11", 0x100}, {"10.1.1.12", 0x100}, {"10.1.1.11", 0x101}, {"10.1.1.12", 0x100}} {
+		want := reversed(t, newRenewedRequestLayer(t, x.host, x.ts))
+		s := newRenewedRequestLayer(t, x.host, x.ts)
+		err := c.Reverse(s, 123)
+		if err != nil {
+			t.Fatalf("Reverse failed: %v", err)
+		}
+		b := make([]byte, s.Path.Len())
+		err = s.Path.SerializeTo(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, want) {
+			t.Errorf("Reverse() = %x, want %x", b, want)
+		}
+	}
+	if n := c.Len(); n != 2 {
+		t.Errorf("cache has %d entries; want 2", n)
+	}
+}
+
+func BenchmarkPathCacheReverse(b *testing.B) {
+	c := server.NewPathCache(1024)
+	reqs := make([]*slayers.SCION, 64)
+	raws := make([][]byte, len(reqs))
+	for i := range reqs {
+		reqs[i] = newRequestLayer(b, fmt.Sprintf("10.1.2.%d", i))
+		raws[i] = append([]byte(nil), reqs[i].Path.(*scionpath.Raw).Raw...)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		j := i % len(reqs)
+		p := reqs[j].Path.(*scionpath.Raw)
+		copy(p.Raw, raws[j])
+		err := p.DecodeFromBytes(p.Raw)
+		if err != nil {
+			b.Fatal(err)
+		}
+		err = c.Reverse(reqs[j], 123)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+// Reduced precision for anonymous clients: operators serving public pools from
+// precise hardware may round the timestamps served to clients outside of an
+// allowlist. Such clients are served in basic mode only since the rounded
+// timestamps do not match the timestamp store of interleaved mode.
+
+import (
+	"math"
+	"net/netip"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+
+	"example.com/scion-time/net/ntp"
+)
+
+// FullPrecisionPrefix is an entry of the allowlist of clients served with
+// full precision. Entries with a zero IA match clients over IP, the others
+// match the hosts in Prefix of AS IA over SCION.
+type FullPrecisionPrefix struct {
+	IA     addr.IA
+	Prefix netip.Prefix
+}
+
+var (
+	reducedResolution time.Duration
+	fullPrecisionACL  []FullPrecisionPrefix
+)
+
+// SetReducedPrecision rounds the timestamps served to clients outside of allow
+// to multiples of resolution, which must divide a second evenly. It must be
+// called before any server is started.
+func SetReducedPrecision(resolution time.Duration, allow []FullPrecisionPrefix) {
+	if resolution <= 0 || time.Second%resolution != 0 {
+		panic("invalid timestamp resolution")
+	}
+	reducedResolution = resolution
+	fullPrecisionACL = allow
+}
+
+// servedResolution returns the resolution of the timestamps served to the
+// client at host in AS ia, or 0 for full precision. The IA of clients over IP
+// is zero.
+func servedResolution(ia addr.IA, host netip.Addr) time.Duration {
+	if reducedResolution == 0 {
+		return 0
+	}
+	host = host.Unmap()
+	for _, p := range fullPrecisionACL {
+		if p.IA == ia && p.Prefix.Contains(host) {
+			return 0
+		}
+	}
+	return reducedResolution
+}
+
+// roundTime64 rounds t to the nearest multiple of resolution. Unlike
+// truncation, rounding does not bias the offsets measured by clients.
+func roundTime64(t ntp.Time64, resolution time.Duration) ntp.Time64 {
+	return ntp.Time64FromTime(ntp.TimeFromTime64(t).Round(resolution))
+}
+
+func precisionOf(resolution time.Duration) int8 {
+	return int8(math.Ceil(math.Log2(resolution.Seconds())))
+}
+
+// reducePrecision rounds the timestamps of resp to multiples of resolution, if
+// not 0.
+func reducePrecision(resp *ntp.Packet, resolution time.Duration) {
+	if resolution == 0 {
+		return
+	}
+	resp.Precision = precisionOf(resolution)
+	resp.ReferenceTime = roundTime64(resp.ReferenceTime, resolution)
+	resp.ReceiveTime = roundTime64(resp.ReceiveTime, resolution)
+	resp.TransmitTime = roundTime64(resp.TransmitTime, resolution)
+}
+
+// reducePrecisionV5 is the NTPv5 variant of reducePrecision.
+func reducePrecisionV5(resp *ntp.PacketV5, resolution time.Duration) {
+	if resolution == 0 {
+		return
+	}
+	resp.Precision = precisionOf(resolution)
+	resp.ReceiveTime = roundTime64(resp.ReceiveTime, resolution)
+	resp.TransmitTime = roundTime64(resp.TransmitTime, resolution)
+}
@@ -0,0 +1,75 @@
+package server
+
+// Bounded queue of received requests, which are processed by a pool of
+// goroutines. If the queue is full, the oldest request is dropped in favor of
+// the newest one so that the delay of queued requests stays bounded under
+// bursty load.
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type queuedRequest struct {
+	buf     []byte
+	oob     []byte
+	lastHop netip.AddrPort
+	rxt     time.Time
+}
+
+type requestQueue struct {
+	reqs  chan *queuedRequest
+	free  sync.Pool
+	drops prometheus.Counter
+}
+
+func newRequestQueue(length, bufLen int, drops prometheus.Counter) *requestQueue {
+	if length <= 0 {
+		panic("invalid request queue length")
+	}
+	q := &requestQueue{
+		reqs:  make(chan *queuedRequest, length),
+		drops: drops,
+	}
+	q.free.New = func() any {
+		return &queuedRequest{buf: make([]byte, 0, bufLen)}
+	}
+	return q
+}
+
+// push enqueues a copy of the request in buf and its control data oob, dropping the oldest queued
+// request if the queue is full. push must not be called concurrently.
+func (q *requestQueue) push(buf, oob []byte, lastHop netip.AddrPort, rxt time.Time) {
+	r := q.free.Get().(*queuedRequest)
+	r.buf = append(r.buf[:0], buf...)
+	r.oob = append(r.oob[:0], oob...)
+	r.lastHop, r.rxt = lastHop, rxt
+	for {
+		select {
+		case q.reqs <- r:
+			return
+		default:
+		}
+		select {
+		case old := <-q.reqs:
+			q.drops.Inc()
+			q.free.Put(old)
+		default:
+		}
+	}
+}
+
+// serve processes queued requests with handle until the queue is closed.
+func (q *requestQueue) serve(handle func(r *queuedRequest)) {
+	for r := range q.reqs {
+		handle(r)
+		q.free.Put(r)
+	}
+}
+
+func (q *requestQueue) close() {
+	close(q.reqs)
+}
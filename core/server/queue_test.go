@@ -0,0 +1,25 @@
+package server_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"example.com/scion-time/core/server"
+)
+
+func TestRequestQueueDropsOldest(t *testing.T) {
+	drops := prometheus.NewCounter(prometheus.CounterOpts{Name: "drops"})
+	q := server.NewRequestQueue(2, 8, drops)
+	for _, b := range []string{"a", "b", "c", "d"} {
+		q.Push([]byte(b))
+	}
+	bufs := q.Drain()
+	if len(bufs) != 2 || string(bufs[0]) != "c" || string(bufs[1]) != "d" {
+		t.Errorf("unexpected queued requests: %q", bufs)
+	}
+	if n := testutil.ToFloat64(drops); n != 2 {
+		t.Errorf("unexpected number of drops: %v", n)
+	}
+}
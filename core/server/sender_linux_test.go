@@ -0,0 +1,58 @@
+package server_test
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/server"
+	"example.com/scion-time/net/udp"
+)
+
+func TestSCIONSenderConcurrentTXTimestamps(t *testing.T) {
+	rconn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rconn.Close()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	err = udp.EnableTimestamping(conn, "")
+	if err != nil {
+		t.Skipf("timestamping not supported: %v", err)
+	}
+
+	s := server.NewSCIONSender(conn)
+	addr := rconn.LocalAddr().(*net.UDPAddr).AddrPort()
+	const senders, packets = 8, 64
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var missing int
+	for i := 0; i != senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j != packets; j++ {
+				_, ok, err := s.Send(zap.NewNop(), []byte{0}, addr)
+				if err != nil {
+					t.Errorf("Send failed: %v", err)
+					return
+				}
+				if !ok {
+					mu.Lock()
+					missing++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if missing != 0 {
+		t.Errorf("%d of %d packets without TX timestamp", missing, senders*packets)
+	}
+}
@@ -2,13 +2,23 @@ package server
 
 import (
 	"container/heap"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/libp2p/go-reuseport"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 
+	"go.uber.org/zap"
+
 	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/base/systemd"
 
 	"example.com/scion-time/core/timebase"
 
@@ -16,11 +26,18 @@ import (
 )
 
 const (
-	serverRefID = 0x58535453
+	serverStratum   = 1
+	serverPrecision = -32
+	serverRefID     = 0x58535453
 
 	tssCap = 1 << 20
 )
 
+type reference struct {
+	stratum uint8
+	refID   uint32
+}
+
 type tssItem struct {
 	key string
 	buf [8]struct {
@@ -36,6 +53,12 @@ type tssMap map[string]*tssItem
 type tssQueue []*tssItem
 
 var (
+	serverRootDispersion atomic.Uint32
+	serverReference      atomic.Pointer[reference]
+
+	ipMetrics    atomic.Pointer[ipServerMetrics]
+	scionMetrics atomic.Pointer[scionServerMetrics]
+
 	tss        = make(tssMap)
 	tssQ       = make(tssQueue, 0, tssCap)
 	tssMetrics = struct {
@@ -74,6 +97,93 @@ var (
 	tssMu sync.Mutex
 )
 
+func init() {
+	ipMetrics.Store(newIPServerMetrics())
+	scionMetrics.Store(newSCIONServerMetrics())
+	serverReference.Store(&reference{stratum: serverStratum, refID: serverRefID})
+	storeRootDispersion(ntp.Time32{Seconds: 0, Fraction: 10})
+}
+
+// SetReference sets the stratum and reference ID served to clients.
+func SetReference(stratum uint8, refID uint32) {
+	if stratum == 0 || stratum > ntp.MaxStratum {
+		panic("unexpected stratum value")
+	}
+	serverReference.Store(&reference{stratum: stratum, refID: refID})
+}
+
+// SetRootDispersion sets the root dispersion served to clients, i.e., the
+// estimated maximum error of the local clock relative to the primary source.
+func SetRootDispersion(d time.Duration) {
+	storeRootDispersion(ntp.Time32FromDuration(d))
+}
+
+// decodeFailed logs the failure to decode a request payload. Structurally
+// malformed packets, e.g., from scans, are counted in malformed and logged
+// with the offending field at debug level only.
+func decodeFailed(log *zap.Logger, malformed prometheus.Counter, err error) {
+	var ferr *ntp.FormatError
+	if errors.As(err, &ferr) {
+		malformed.Inc()
+		log.Debug("dropped malformed packet", zap.String("field", ferr.Field), zap.Error(err))
+		return
+	}
+	log.Info("failed to decode packet payload", zap.Error(err))
+}
+
+func storeRootDispersion(t ntp.Time32) {
+	serverRootDispersion.Store(uint32(t.Seconds)<<16 | uint32(t.Fraction))
+}
+
+func rootDispersion() ntp.Time32 {
+	x := serverRootDispersion.Load()
+	return ntp.Time32{Seconds: uint16(x >> 16), Fraction: uint16(x)}
+}
+
+// listenUDP returns the sockets bound to localHost for n server workers. If
+// systemd passed sockets bound to localHost on socket activation, one worker
+// is run per inherited socket, up to n. Workers never share a socket since
+// each worker keeps track of the TX timestamps in the socket's error queue.
+func listenUDP(localHost *net.UDPAddr, n int) ([]*net.UDPConn, error) {
+	var activated []*net.UDPConn
+	for len(activated) != n {
+		conn, ok := systemd.ListenUDP(localHost)
+		if !ok {
+			break
+		}
+		activated = append(activated, conn)
+	}
+	if len(activated) != 0 {
+		return activated, nil
+	}
+	conns := make([]*net.UDPConn, n)
+	if n == 1 {
+		conn, err := net.ListenUDP("udp", localHost)
+		if err != nil {
+			return nil, err
+		}
+		conns[0] = conn
+		return conns, nil
+	}
+	for i := range conns {
+		conn, err := reuseport.ListenPacket("udp",
+			net.JoinHostPort(localHost.IP.String(), strconv.Itoa(localHost.Port)))
+		if err != nil {
+			return nil, err
+		}
+		conns[i] = conn.(*net.UDPConn)
+	}
+	return conns, nil
+}
+
+// closeOnDone closes c as soon as ctx is done, unblocking pending reads.
+func closeOnDone(ctx context.Context, c io.Closer) {
+	go func() {
+		<-ctx.Done()
+		_ = c.Close()
+	}()
+}
+
 func (q tssQueue) Len() int { return len(q) }
 
 func (q tssQueue) Less(i, j int) bool {
@@ -100,16 +210,18 @@ func (q *tssQueue) Pop() any {
 	return tssi
 }
 
-func handleRequest(clientID string, req *ntp.Packet, rxt, txt *time.Time, resp *ntp.Packet) {
+func handleRequest(txc *txCorrection, clientID string, req *ntp.Packet, rxt, txt *time.Time, resp *ntp.Packet) {
+	resp.SetLeapIndicator(leapIndicator(*rxt))
 	resp.SetVersion(ntp.VersionMax)
 	resp.SetMode(ntp.ModeServer)
-	resp.Stratum = 1
+	ref := serverReference.Load()
+	resp.Stratum = ref.stratum
 	resp.Poll = req.Poll
-	resp.Precision = -32
-	resp.RootDispersion = ntp.Time32{Seconds: 0, Fraction: 10}
-	resp.ReferenceID = serverRefID
+	resp.Precision = serverPrecision
+	resp.RootDispersion = rootDispersion()
+	resp.ReferenceID = ref.refID
 
-	*txt = timebase.Now()
+	*txt = txc.apply(timebase.Now())
 
 	rxt64 := ntp.Time64FromTime(*rxt)
 	txt64 := ntp.Time64FromTime(*txt)
@@ -180,6 +292,7 @@ func handleRequest(clientID string, req *ntp.Packet, rxt, txt *time.Time, resp *
 		resp.OriginTime = req.ReceiveTime
 		resp.TransmitTime = tssi.buf[o].txt
 		tssMetrics.reqsServedInterleaved.Inc()
+		recordClientOffset(clientID, req.TransmitTime, tssi.buf[o].rxt, tssi.buf[o].txt, req.ReceiveTime)
 	} else {
 		resp.OriginTime = req.TransmitTime
 		resp.TransmitTime = txt64
@@ -3,10 +3,9 @@ package server
 import (
 	"context"
 	"net"
-	"strconv"
+	"net/netip"
 	"time"
 
-	"github.com/libp2p/go-reuseport"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 
@@ -20,17 +19,25 @@ import (
 	"example.com/scion-time/net/ntp"
 	"example.com/scion-time/net/nts"
 	"example.com/scion-time/net/ntske"
+	"example.com/scion-time/net/pcap"
 	"example.com/scion-time/net/udp"
 )
 
-const (
-	ipServerNumGoroutine = 8
-)
+// maxGROLen is the size of the receive buffers with generic receive offload,
+// which coalesces packets up to the maximum IP packet size.
+const maxGROLen = 1<<16 - 1
 
 type ipServerMetrics struct {
-	pktsReceived prometheus.Counter
-	reqsAccepted prometheus.Counter
-	reqsServed   prometheus.Counter
+	pktsReceived  prometheus.Counter
+	pktsMalformed prometheus.Counter
+	reqsAccepted  prometheus.Counter
+	reqsServed    prometheus.Counter
+}
+
+type ipResponse struct {
+	clientID string
+	rxt      time.Time
+	txt0     time.Time
 }
 
 func newIPServerMetrics() *ipServerMetrics {
@@ -39,6 +46,10 @@ func newIPServerMetrics() *ipServerMetrics {
 			Name: metrics.IPServerPktsReceivedN,
 			Help: metrics.IPServerPktsReceivedH,
 		}),
+		pktsMalformed: promauto.NewCounter(prometheus.CounterOpts{
+			Name: metrics.IPServerPktsMalformedN,
+			Help: metrics.IPServerPktsMalformedH,
+		}),
 		reqsAccepted: promauto.NewCounter(prometheus.CounterOpts{
 			Name: metrics.IPServerReqsAcceptedN,
 			Help: metrics.IPServerReqsAcceptedH,
@@ -50,25 +61,48 @@ func newIPServerMetrics() *ipServerMetrics {
 	}
 }
 
-func runIPServer(log *zap.Logger, mtrcs *ipServerMetrics, conn *net.UDPConn, iface string, provider *ntske.Provider) {
-	defer conn.Close()
+func configureIPServerConn(log *zap.Logger, conn *net.UDPConn, iface string) {
 	err := udp.EnableTimestamping(conn, iface)
 	if err != nil {
 		log.Error("failed to enable timestamping", zap.Error(err))
 	}
-	err = udp.SetDSCP(conn, config.DSCP)
+	err = udp.SetDSCP(conn, config.DSCP())
 	if err != nil {
 		log.Info("failed to set DSCP", zap.Error(err))
 	}
+	if prio := config.SocketPriority(); prio != 0 {
+		err = udp.SetPriority(conn, prio)
+		if err != nil {
+			log.Info("failed to set socket priority", zap.Error(err))
+		}
+	}
+	if d := busyPoll(); d != 0 {
+		err = udp.SetBusyPoll(conn, d)
+		if err != nil {
+			log.Info("failed to enable busy polling", zap.Error(err))
+		}
+	}
+}
+
+func runIPServer(ctx context.Context, log *zap.Logger, mtrcs *ipServerMetrics, wmtrcs *workerMetrics,
+	conn *net.UDPConn, iface string, provider *ntske.Provider, keys ntp.SymmetricKeys) {
+	defer conn.Close()
+	configureIPServerConn(log, conn, iface)
 
+	localAddr := conn.LocalAddr().(*net.UDPAddr).AddrPort()
 	var txID uint32
-	buf := make([]byte, 2048)
+	txc := newTXCorrection(wmtrcs)
+	var resp ipResponse
+	buf := make([]byte, udp.MaxPayloadLen)
 	oob := make([]byte, udp.TimestampLen())
 	for {
 		buf = buf[:cap(buf)]
 		oob = oob[:cap(oob)]
 		n, oobn, flags, srcAddr, err := conn.ReadMsgUDPAddrPort(buf, oob)
 		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			log.Error("failed to read packet", zap.Error(err))
 			continue
 		}
@@ -82,150 +116,355 @@ func runIPServer(log *zap.Logger, mtrcs *ipServerMetrics, conn *net.UDPConn, ifa
 			oob = oob[:0]
 			rxt = timebase.Now()
 			log.Error("failed to read packet rx timestamp", zap.Error(err))
+		} else {
+			rxt = timebase.Interpolate(rxt)
 		}
 		buf = buf[:n]
 		mtrcs.pktsReceived.Inc()
+		wmtrcs.pktsReceived.Inc()
+		if pcap.Enabled() {
+			pcap.Write(rxt, srcAddr, localAddr, buf)
+		}
 
-		var ntpreq ntp.Packet
-		err = ntp.DecodePacket(&ntpreq, buf)
-		if err != nil {
-			log.Info("failed to decode packet payload", zap.Error(err))
+		if !handleIPPacket(log, mtrcs, txc, provider, keys, &buf, rxt, srcAddr, &resp) {
 			continue
 		}
 
-		var authenticated bool
-		var ntsreq nts.Packet
-		var serverCookie ntske.ServerCookie
-		if len(buf) > ntp.PacketLen {
-			err = nts.DecodePacket(&ntsreq, buf)
-			if err != nil {
-				log.Info("failed to decode NTS packet", zap.Error(err))
-				continue
+		n, err = conn.WriteToUDPAddrPort(buf, srcAddr)
+		if err != nil || n != len(buf) {
+			log.Error("failed to write packet", zap.Error(err))
+			continue
+		}
+		txt := resp.txt0
+		if resp.clientID != "" {
+			txt = completeIPResponse(log, mtrcs, wmtrcs, conn, txc, &txID, &resp)
+		} else {
+			skipIPTXTimestamp(log, conn, &txID)
+		}
+		if pcap.Enabled() {
+			if txt.IsZero() {
+				txt = timebase.Now()
 			}
+			pcap.Write(txt, localAddr, srcAddr, buf)
+		}
+	}
+}
 
-			cookie, err := ntsreq.GetFirstCookie()
-			if err != nil {
-				log.Info("failed to get cookie", zap.Error(err))
-				continue
-			}
+// runIPServerBatch serves requests like runIPServer but receives and sends
+// up to batchSize packets per system call. With generic receive offload,
+// each received buffer may contain multiple coalesced requests.
+func runIPServerBatch(ctx context.Context, log *zap.Logger, mtrcs *ipServerMetrics, wmtrcs *workerMetrics,
+	conn *net.UDPConn, iface string, provider *ntske.Provider, keys ntp.SymmetricKeys, batchSize int) {
+	defer conn.Close()
+	configureIPServerConn(log, conn, iface)
 
-			var encryptedCookie ntske.EncryptedServerCookie
-			err = encryptedCookie.Decode(cookie)
-			if err != nil {
-				log.Info("failed to decode cookie", zap.Error(err))
-				continue
-			}
+	bufLen := udp.MaxPayloadLen
+	if groEnabled() {
+		err := udp.EnableGRO(conn)
+		if err != nil {
+			log.Info("failed to enable generic receive offload", zap.Error(err))
+		} else {
+			bufLen = maxGROLen
+		}
+	}
 
-			key, ok := provider.Get(int(encryptedCookie.ID))
-			if !ok {
-				log.Info("failed to get key", zap.Error(err))
+	localAddr := conn.LocalAddr().(*net.UDPAddr).AddrPort()
+	var txID uint32
+	txc := newTXCorrection(wmtrcs)
+	bconn := udp.NewBatchConn(conn)
+	rms := udp.NewMessages(batchSize, bufLen)
+	wms := make([]udp.Message, batchSize)
+	for i := range wms {
+		wms[i].Buffers = make([][]byte, 1)
+	}
+	resps := make([]ipResponse, batchSize)
+	var segs [][]byte
+	for {
+		for i := range rms {
+			rms[i].Buffers[0] = rms[i].Buffers[0][:cap(rms[i].Buffers[0])]
+			rms[i].OOB = rms[i].OOB[:cap(rms[i].OOB)]
+		}
+		n, err := bconn.ReadBatch(rms)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Error("failed to read packets", zap.Error(err))
+			continue
+		}
+		k := 0
+		for i := 0; i != n; i++ {
+			m := &rms[i]
+			if m.Flags != 0 {
+				log.Error("failed to read packet", zap.Int("flags", m.Flags))
 				continue
 			}
-
-			serverCookie, err = encryptedCookie.Decrypt(key.Value)
+			oob := m.OOB[:m.NN]
+			rxt, err := udp.TimestampFromOOBData(oob)
 			if err != nil {
-				log.Info("failed to decrypt cookie", zap.Error(err))
-				continue
+				rxt = timebase.Now()
+				log.Error("failed to read packet rx timestamp", zap.Error(err))
+			} else {
+				rxt = timebase.Interpolate(rxt)
+			}
+			segs = append(segs[:0], m.Buffers[0][:m.N])
+			if segSize, ok := udp.SegmentSizeFromOOBData(oob); ok {
+				segs = udp.AppendSegments(segs[:0], m.Buffers[0][:m.N], segSize)
 			}
 
-			err = nts.ProcessRequest(buf, serverCookie.C2S, &ntsreq)
-			if err != nil {
-				log.Info("failed to process NTS packet", zap.Error(err))
-				continue
+			srcAddr := m.Addr.(*net.UDPAddr).AddrPort()
+			for _, buf := range segs {
+				mtrcs.pktsReceived.Inc()
+				wmtrcs.pktsReceived.Inc()
+				if pcap.Enabled() {
+					pcap.Write(rxt, srcAddr, localAddr, buf)
+				}
+				if k == len(wms) {
+					wms = append(wms, udp.Message{Buffers: make([][]byte, 1)})
+					resps = append(resps, ipResponse{})
+				}
+				if !handleIPPacket(log, mtrcs, txc, provider, keys, &buf, rxt, srcAddr, &resps[k]) {
+					continue
+				}
+				if cap(buf) > cap(m.Buffers[0]) {
+					// keep the grown buffer for subsequent reads
+					m.Buffers[0] = buf
+				}
+				wms[k].Buffers[0] = buf
+				wms[k].Addr = m.Addr
+				k++
 			}
-			authenticated = true
 		}
 
-		err = ntp.ValidateRequest(&ntpreq, srcAddr.Port())
+		err = bconn.WriteBatch(wms[:k])
 		if err != nil {
-			log.Info("failed to validate packet payload", zap.Error(err))
+			log.Error("failed to write packets", zap.Error(err))
 			continue
 		}
+		for i := 0; i != k; i++ {
+			txt := resps[i].txt0
+			if resps[i].clientID != "" {
+				txt = completeIPResponse(log, mtrcs, wmtrcs, conn, txc, &txID, &resps[i])
+			} else {
+				skipIPTXTimestamp(log, conn, &txID)
+			}
+			if pcap.Enabled() {
+				if txt.IsZero() {
+					txt = timebase.Now()
+				}
+				pcap.Write(txt, localAddr, wms[i].Addr.(*net.UDPAddr).AddrPort(), wms[i].Buffers[0])
+			}
+		}
+	}
+}
 
-		clientID := srcAddr.Addr().String()
+// handleIPPacket processes the packet in *buf received at rxt from srcAddr and
+// encodes the response into *buf. It reports whether a response is to be sent.
+// Responses to control requests have an empty client ID.
+func handleIPPacket(log *zap.Logger, mtrcs *ipServerMetrics, txc *txCorrection, provider *ntske.Provider, keys ntp.SymmetricKeys,
+	buf *[]byte, rxt time.Time, srcAddr netip.AddrPort, resp *ipResponse) bool {
+	var err error
+	*resp = ipResponse{}
+	if len(*buf) != 0 && (*buf)[0]&0b0000_0111 == ntp.ModeControl {
+		if !controlPermitted(srcAddr.Addr()) {
+			log.Debug("dropped control request", zap.Stringer("from", srcAddr))
+			return false
+		}
+		var creq, cresp ntp.ControlPacket
+		err = ntp.DecodeControlPacket(&creq, *buf)
+		if err != nil {
+			log.Info("failed to decode control packet", zap.Error(err))
+			return false
+		}
+		handleControlRequest(&creq, &cresp)
+		ntp.EncodeControlPacket(buf, &cresp)
+		return true
+	}
 
-		mtrcs.reqsAccepted.Inc()
-		log.Debug("received request",
-			zap.Time("at", rxt),
-			zap.String("from", clientID),
-			zap.Bool("ntsauth", authenticated),
-			zap.Object("data", ntp.PacketMarshaler{Pkt: &ntpreq}),
-		)
+	if ntp.IsVersion5(*buf) {
+		return handleIPPacketV5(log, mtrcs, txc, buf, rxt, srcAddr, resp)
+	}
 
-		var txt0 time.Time
-		var ntpresp ntp.Packet
-		handleRequest(clientID, &ntpreq, &rxt, &txt0, &ntpresp)
+	var ntpreq ntp.Packet
+	err = ntp.DecodePacket(&ntpreq, *buf)
+	if err != nil {
+		decodeFailed(log, mtrcs.pktsMalformed, err)
+		return false
+	}
 
-		ntp.EncodePacket(&buf, &ntpresp)
+	var authenticated bool
+	var ntsreq nts.Packet
+	var serverCookie ntske.ServerCookie
+	var symKey *ntp.SymmetricKey
+	if keys != nil && ntp.HasMAC(*buf) {
+		k, err := ntp.VerifyMAC(*buf, keys)
+		if err != nil {
+			log.Info("failed to verify MAC", zap.Error(err))
+			return false
+		}
+		symKey = &k
+	} else if len(*buf) > ntp.PacketLen {
+		err = nts.DecodePacket(&ntsreq, *buf)
+		if err != nil {
+			log.Info("failed to decode NTS packet", zap.Error(err))
+			return false
+		}
 
-		if authenticated {
-			var cookies [][]byte
-			key := provider.Current()
-			addedCookie := false
-			for i := 0; i < len(ntsreq.Cookies)+len(ntsreq.CookiePlaceholders); i++ {
-				encryptedCookie, err := serverCookie.EncryptWithNonce(key.Value, key.ID)
-				if err != nil {
-					log.Info("failed to encrypt cookie", zap.Error(err))
-					continue
-				}
-				cookie := encryptedCookie.Encode()
-				cookies = append(cookies, cookie)
-				addedCookie = true
-			}
-			if !addedCookie {
-				log.Info("failed to add at least one cookie")
-				continue
-			}
+		cookie, err := ntsreq.GetFirstCookie()
+		if err != nil {
+			log.Info("failed to get cookie", zap.Error(err))
+			return false
+		}
 
-			ntsresp := nts.NewResponsePacket(cookies, serverCookie.S2C, ntsreq.UniqueID.ID)
-			nts.EncodePacket(&buf, &ntsresp)
+		var encryptedCookie ntske.EncryptedServerCookie
+		err = encryptedCookie.Decode(cookie)
+		if err != nil {
+			log.Info("failed to decode cookie", zap.Error(err))
+			return false
 		}
 
-		n, err = conn.WriteToUDPAddrPort(buf, srcAddr)
-		if err != nil || n != len(buf) {
-			log.Error("failed to write packet", zap.Error(err))
-			continue
+		key, ok := provider.Get(int(encryptedCookie.ID))
+		if !ok {
+			log.Info("failed to get key", zap.Error(err))
+			return false
 		}
-		txt1, id, err := udp.ReadTXTimestamp(conn)
+
+		serverCookie, err = encryptedCookie.Decrypt(key.Value)
 		if err != nil {
-			txt1 = txt0
-			log.Error("failed to read packet tx timestamp", zap.Error(err))
-		} else if id != txID {
-			txt1 = txt0
-			log.Error("failed to read packet tx timestamp", zap.Uint32("id", id), zap.Uint32("expected", txID))
-			txID = id + 1
-		} else {
-			txID++
+			log.Info("failed to decrypt cookie", zap.Error(err))
+			return false
+		}
+
+		err = nts.ProcessRequest(*buf, serverCookie.C2S, &ntsreq)
+		if err != nil {
+			log.Info("failed to process NTS packet", zap.Error(err))
+			return false
+		}
+		authenticated = true
+	}
+
+	err = ntp.ValidateRequest(&ntpreq, srcAddr.Port())
+	if err != nil {
+		log.Info("failed to validate packet payload", zap.Error(err))
+		return false
+	}
+
+	clientID := srcAddr.Addr().String()
+
+	mtrcs.reqsAccepted.Inc()
+	log.Debug("received request",
+		zap.Time("at", rxt),
+		zap.String("from", clientID),
+		zap.Bool("ntsauth", authenticated),
+		zap.Bool("symauth", symKey != nil),
+		zap.Object("data", ntp.PacketMarshaler{Pkt: &ntpreq}),
+	)
+
+	var ntpresp ntp.Packet
+	resp.clientID = clientID
+	resp.rxt = rxt
+	handleRequest(txc, clientID, &ntpreq, &resp.rxt, &resp.txt0, &ntpresp)
+	reducePrecision(&ntpresp, servedResolution(0, srcAddr.Addr()))
+	negotiateV5(&ntpreq, &ntpresp)
+
+	ntp.EncodePacket(buf, &ntpresp)
+
+	if authenticated {
+		var cookies [][]byte
+		key := provider.Current()
+		addedCookie := false
+		for i := 0; i < len(ntsreq.Cookies)+len(ntsreq.CookiePlaceholders); i++ {
+			encryptedCookie, err := serverCookie.EncryptWithNonce(key.Value, key.ID)
+			if err != nil {
+				log.Info("failed to encrypt cookie", zap.Error(err))
+				continue
+			}
+			cookie := encryptedCookie.Encode()
+			cookies = append(cookies, cookie)
+			addedCookie = true
+		}
+		if !addedCookie {
+			log.Info("failed to add at least one cookie")
+			return false
 		}
-		updateTXTimestamp(clientID, rxt, &txt1)
 
-		mtrcs.reqsServed.Inc()
+		ntsresp := nts.NewResponsePacket(cookies, serverCookie.S2C, ntsreq.UniqueID.ID)
+		nts.EncodePacket(buf, &ntsresp)
+	} else if symKey != nil {
+		appendTAIOffset(buf, true /* macFollows */)
+		ntp.AppendMAC(buf, *symKey)
+	} else {
+		appendTAIOffset(buf, false /* macFollows */)
+	}
+
+	return true
+}
+
+// completeIPResponse finishes serving a response sent on conn: the transmit
+// timestamp is recorded for interleaved mode and returned.
+func completeIPResponse(log *zap.Logger, mtrcs *ipServerMetrics, wmtrcs *workerMetrics,
+	conn *net.UDPConn, txc *txCorrection, txID *uint32, resp *ipResponse) time.Time {
+	txt1, id, err := udp.ReadTXTimestamp(conn)
+	if err != nil {
+		txt1 = resp.txt0
+		log.Error("failed to read packet tx timestamp", zap.Error(err))
+	} else if id != *txID {
+		txt1 = resp.txt0
+		log.Error("failed to read packet tx timestamp", zap.Uint32("id", id), zap.Uint32("expected", *txID))
+		*txID = id + 1
+	} else {
+		*txID++
+		txt1 = timebase.Interpolate(txt1)
+		txc.update(resp.txt0, txt1)
+	}
+	updateTXTimestamp(resp.clientID, resp.rxt, &txt1)
+
+	mtrcs.reqsServed.Inc()
+	wmtrcs.reqsServed.Inc()
+
+	return txt1
+}
+
+// skipIPTXTimestamp consumes the transmit timestamp of a response sent on conn
+// that is not served in interleaved mode, e.g., a control response, so that
+// the transmit timestamps of subsequent responses are matched correctly.
+func skipIPTXTimestamp(log *zap.Logger, conn *net.UDPConn, txID *uint32) {
+	_, id, err := udp.ReadTXTimestamp(conn)
+	if err != nil {
+		log.Info("failed to read packet tx timestamp", zap.Error(err))
+		return
+	}
+	*txID = id + 1
+}
+
+func runIPServerWorker(ctx context.Context, log *zap.Logger, mtrcs *ipServerMetrics, wmtrcs *workerMetrics,
+	conn *net.UDPConn, iface string, provider *ntske.Provider, keys ntp.SymmetricKeys) {
+	if n := batchSize(); n > 1 || groEnabled() {
+		runIPServerBatch(ctx, log, mtrcs, wmtrcs, conn, iface, provider, keys, n)
+	} else {
+		runIPServer(ctx, log, mtrcs, wmtrcs, conn, iface, provider, keys)
 	}
 }
 
 func StartIPServer(ctx context.Context, log *zap.Logger,
-	localHost *net.UDPAddr, provider *ntske.Provider) {
+	localHost *net.UDPAddr, provider *ntske.Provider, keys ntp.SymmetricKeys) {
 	log.Info("server listening via IP",
 		zap.Stringer("ip", localHost.IP),
 		zap.Int("port", localHost.Port),
 	)
 
-	mtrcs := newIPServerMetrics()
+	mtrcs := ipMetrics.Load()
 
-	if ipServerNumGoroutine == 1 {
-		conn, err := net.ListenUDP("udp", localHost)
-		if err != nil {
-			log.Fatal("failed to listen for packets", zap.Error(err))
-		}
-		go runIPServer(log, mtrcs, conn, localHost.Zone, provider)
-	} else {
-		for i := ipServerNumGoroutine; i > 0; i-- {
-			conn, err := reuseport.ListenPacket("udp",
-				net.JoinHostPort(localHost.IP.String(), strconv.Itoa(localHost.Port)))
-			if err != nil {
-				log.Fatal("failed to listen for packets", zap.Error(err))
-			}
-			go runIPServer(log, mtrcs, conn.(*net.UDPConn), localHost.Zone, provider)
-		}
+	conns, err := listenUDP(localHost, numWorkers())
+	if err != nil {
+		log.Fatal("failed to listen for packets", zap.Error(err))
+	}
+	for i, conn := range conns {
+		closeOnDone(ctx, conn)
+		go func(i int, conn *net.UDPConn) {
+			startWorker(log, i)
+			runIPServerWorker(ctx, log, mtrcs, newWorkerMetrics(workerServerIP, i),
+				conn, localHost.Zone, provider, keys)
+		}(i, conn)
 	}
 }
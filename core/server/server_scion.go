@@ -3,20 +3,19 @@ package server
 import (
 	"context"
 	"crypto/subtle"
+	"io"
 	"net"
 	"net/netip"
-	"strconv"
+	"sync"
 	"time"
 
 	"github.com/google/gopacket"
 
-	"github.com/libp2p/go-reuseport"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 
 	"github.com/scionproto/scion/pkg/drkey"
 	"github.com/scionproto/scion/pkg/slayers"
-	"github.com/scionproto/scion/pkg/spao"
 
 	"go.uber.org/zap"
 
@@ -28,16 +27,25 @@ import (
 	"example.com/scion-time/net/ntp"
 	"example.com/scion-time/net/nts"
 	"example.com/scion-time/net/ntske"
+	"example.com/scion-time/net/pcap"
 	"example.com/scion-time/net/scion"
+	"example.com/scion-time/net/scion/spao"
 	"example.com/scion-time/net/udp"
 )
 
 const (
-	scionServerNumGoroutine = 8
+	// epochBoundaryWindow is the time around a DRKey epoch boundary in which
+	// requests are also authenticated with the keys of the adjacent epoch.
+	epochBoundaryWindow = 1 * time.Minute
+
+	// Maximum number of packets sent after a packet whose TX timestamp is
+	// still waiting to be claimed by its sender.
+	scionMaxPendingTX = 1024
 )
 
 type scionServerMetrics struct {
 	pktsReceived      prometheus.Counter
+	pktsMalformed     prometheus.Counter
 	pktsForwarded     prometheus.Counter
 	pktsAuthenticated prometheus.Counter
 	reqsAccepted      prometheus.Counter
@@ -50,6 +58,10 @@ func newSCIONServerMetrics() *scionServerMetrics {
 			Name: metrics.SCIONServerPktsReceivedN,
 			Help: metrics.SCIONServerPktsReceivedH,
 		}),
+		pktsMalformed: promauto.NewCounter(prometheus.CounterOpts{
+			Name: metrics.SCIONServerPktsMalformedN,
+			Help: metrics.SCIONServerPktsMalformedH,
+		}),
 		pktsForwarded: promauto.NewCounter(prometheus.CounterOpts{
 			Name: metrics.SCIONServerPktsForwardedN,
 			Help: metrics.SCIONServerPktsForwardedH,
@@ -69,23 +81,91 @@ func newSCIONServerMetrics() *scionServerMetrics {
 	}
 }
 
-func runSCIONServer(ctx context.Context, log *zap.Logger, mtrcs *scionServerMetrics,
-	conn *net.UDPConn, localHostIface string, localHostPort int,
-	fetcher *scion.Fetcher, provider *ntske.Provider) {
-	defer conn.Close()
-	err := udp.EnableTimestamping(conn, localHostIface)
-	if err != nil {
-		log.Error("failed to enable timestamping", zap.Error(err))
+// scionHandler processes the packet buf received from lastHop at rxt, which is
+// a kernel or hardware timestamp if it was taken from the control data oob.
+type scionHandler func(buf, oob []byte, lastHop netip.AddrPort, rxt time.Time)
+
+// scionSender sends packets via conn and reads their TX timestamps. Only the
+// writes are serialized, so that the ID of each TX timestamp is known; the
+// timestamps are read concurrently and those read on behalf of other senders
+// are handed over via pending. txc is the TX timestamp correction of conn.
+type scionSender struct {
+	mu      sync.Mutex
+	conn    *net.UDPConn
+	txID    uint32
+	pending map[uint32]time.Time
+	txc     *txCorrection
+}
+
+// claim returns the TX timestamp of packet id if it was read by another
+// sender.
+func (s *scionSender) claim(id uint32) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.pending[id]
+	if ok {
+		delete(s.pending, id)
 	}
-	err = udp.SetDSCP(conn, config.DSCP)
-	if err != nil {
-		log.Info("failed to set DSCP", zap.Error(err))
+	return t, ok
+}
+
+// handOver stores the TX timestamp t of packet id for its sender. Timestamps
+// that are not claimed within scionMaxPendingTX packets are dropped.
+func (s *scionSender) handOver(id uint32, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil {
+		s.pending = make(map[uint32]time.Time)
+	}
+	for x := range s.pending {
+		if s.txID-x > scionMaxPendingTX {
+			delete(s.pending, x)
+		}
 	}
+	s.pending[id] = t
+}
 
-	var txID uint32
-	buf := make([]byte, scion.MTU)
-	oob := make([]byte, udp.TimestampLen())
+// send writes the packet b to addr and returns its TX timestamp, if available.
+func (s *scionSender) send(log *zap.Logger, b []byte, addr netip.AddrPort) (time.Time, bool, error) {
+	s.mu.Lock()
+	n, err := s.conn.WriteToUDPAddrPort(b, addr)
+	id := s.txID
+	if err == nil {
+		s.txID++
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if n != len(b) {
+		return time.Time{}, false, io.ErrShortWrite
+	}
+	for {
+		if txt, ok := s.claim(id); ok {
+			return txt, true, nil
+		}
+		txt, rid, err := udp.ReadTXTimestamp(s.conn)
+		if err != nil {
+			// The timestamp may have been read by another sender meanwhile
+			if txt, ok := s.claim(id); ok {
+				return txt, true, nil
+			}
+			log.Error("failed to read packet tx timestamp", zap.Error(err))
+			return time.Time{}, false, nil
+		}
+		if rid == id {
+			return txt, true, nil
+		}
+		s.handOver(rid, txt)
+	}
+}
 
+// newSCIONHandler returns a handler for packets received on localAddr. Each
+// handler keeps its own decoding and serialization state and must therefore
+// only be used by a single goroutine.
+func newSCIONHandler(ctx context.Context, log *zap.Logger, mtrcs *scionServerMetrics, wmtrcs *workerMetrics,
+	sender *scionSender, localAddr netip.AddrPort, localHostPort int,
+	fetcher *scion.Fetcher, provider *ntske.Provider) scionHandler {
 	var (
 		scionLayer slayers.SCION
 		hbhLayer   slayers.HopByHopExtnSkipper
@@ -101,63 +181,46 @@ func runSCIONServer(ctx context.Context, log *zap.Logger, mtrcs *scionServerMetr
 	)
 	parser.IgnoreUnsupported = true
 	decoded := make([]gopacket.LayerType, 4)
+	pkt := make([]byte, scion.MTU)
 	buffer := gopacket.NewSerializeBuffer()
 	options := gopacket.SerializeOptions{
 		ComputeChecksums: true,
 		FixLengths:       true,
 	}
 
-	var authBuf, authMAC, authMockKey []byte
+	var authBuf, authMAC []byte
+	var respAuthOpt *slayers.EndToEndOption
 	if fetcher != nil {
 		authBuf = make([]byte, spao.MACBufferSize)
 		authMAC = make([]byte, scion.PacketAuthMACLen)
-		if scion.UseMockKeys() {
-			authMockKey = new(drkey.Key)[:]
-		}
+		respAuthOpt = &slayers.EndToEndOption{OptData: make([]byte, scion.PacketAuthOptDataLen)}
 	}
 	tsOpt := &slayers.EndToEndOption{}
+	rxtOpt := &slayers.EndToEndOption{}
+	paths := newPathCache(pathCacheCap)
 
-	for {
-		buf = buf[:cap(buf)]
-		oob = oob[:cap(oob)]
-		n, oobn, flags, lastHop, err := conn.ReadMsgUDPAddrPort(buf, oob)
-		if err != nil {
-			log.Error("failed to read packet", zap.Error(err))
-			continue
-		}
-		if flags != 0 {
-			log.Error("failed to read packet", zap.Int("flags", flags))
-			continue
-		}
-		oob = oob[:oobn]
-		rxt, err := udp.TimestampFromOOBData(oob)
-		if err != nil {
-			oob = oob[:0]
-			rxt = timebase.Now()
-			log.Error("failed to read packet rx timestamp", zap.Error(err))
-		}
-		buf = buf[:n]
-		mtrcs.pktsReceived.Inc()
-
-		err = parser.DecodeLayers(buf, &decoded)
+	return func(buf, oob []byte, lastHop netip.AddrPort, rxt time.Time) {
+		err := parser.DecodeLayers(buf, &decoded)
 		if err != nil {
 			log.Info("failed to decode packet", zap.Error(err))
-			continue
+			return
 		}
 		validType := len(decoded) >= 2 &&
 			decoded[len(decoded)-1] == slayers.LayerTypeSCIONUDP
 		if !validType {
 			log.Info("failed to decode packet", zap.String("cause", "unexpected type or structure"))
-			continue
+			return
 		}
 
 		srcAddr, ok := netip.AddrFromSlice(scionLayer.RawSrcAddr)
 		if !ok {
-			panic("unexpected IP address byte slice")
+			log.Info("failed to decode packet", zap.String("cause", "unexpected address"))
+			return
 		}
 		dstAddr, ok := netip.AddrFromSlice(scionLayer.RawDstAddr)
 		if !ok {
-			panic("unexpected IP address byte slice")
+			log.Info("failed to decode packet", zap.String("cause", "unexpected address"))
+			return
 		}
 
 		if int(udpLayer.DstPort) != localHostPort {
@@ -166,18 +229,21 @@ func runSCIONServer(ctx context.Context, log *zap.Logger, mtrcs *scionServerMetr
 
 			err = buffer.Clear()
 			if err != nil {
-				panic(err)
+				log.Info("failed to clear buffer", zap.Error(err))
+				return
 			}
 
 			err = payload.SerializeTo(buffer, options)
 			if err != nil {
-				panic(err)
+				log.Info("failed to serialize payload", zap.Error(err))
+				return
 			}
 			buffer.PushLayer(payload.LayerType())
 
 			err = udpLayer.SerializeTo(buffer, options)
 			if err != nil {
-				panic(err)
+				log.Info("failed to serialize UDP header", zap.Error(err))
+				return
 			}
 			buffer.PushLayer(udpLayer.LayerType())
 
@@ -200,37 +266,31 @@ func runSCIONServer(ctx context.Context, log *zap.Logger, mtrcs *scionServerMetr
 			if scionLayer.NextHdr == slayers.End2EndClass {
 				err = e2eLayer.SerializeTo(buffer, options)
 				if err != nil {
-					panic(err)
+					log.Info("failed to serialize end-to-end extension", zap.Error(err))
+					return
 				}
 				buffer.PushLayer(e2eLayer.LayerType())
 			}
 
 			err = scionLayer.SerializeTo(buffer, options)
 			if err != nil {
-				panic(err)
+				log.Info("failed to serialize SCION header", zap.Error(err))
+				return
 			}
 			buffer.PushLayer(scionLayer.LayerType())
 
-			m, err := conn.WriteToUDPAddrPort(buffer.Bytes(), dstAddrPort)
-			if err != nil || m != len(buffer.Bytes()) {
-				log.Error("failed to write packet", zap.Error(err))
-				continue
-			}
-			_, id, err := udp.ReadTXTimestamp(conn)
+			_, _, err = sender.send(log, buffer.Bytes(), dstAddrPort)
 			if err != nil {
-				log.Error("failed to read packet tx timestamp", zap.Error(err))
-			} else if id != txID {
-				log.Error("failed to read packet tx timestamp", zap.Uint32("id", id), zap.Uint32("expected", txID))
-				txID = id + 1
-			} else {
-				txID++
+				log.Error("failed to write packet", zap.Error(err))
+				return
 			}
 
 			mtrcs.pktsForwarded.Inc()
 		} else if localHostPort != scion.EndhostPort {
 			var (
-				authOpt *slayers.EndToEndOption
-				authKey []byte
+				authOpt  *slayers.EndToEndOption
+				authKey  []byte
+				authAlgo uint8
 			)
 			authenticated := false
 
@@ -238,56 +298,94 @@ func runSCIONServer(ctx context.Context, log *zap.Logger, mtrcs *scionServerMetr
 				decoded[len(decoded)-2] == slayers.LayerTypeEndToEndExtn {
 				authOpt, err = e2eLayer.FindOption(slayers.OptTypeAuthenticator)
 				if err == nil {
+					err = scion.ValidatePacketAuthOpt(authOpt)
+					if err != nil {
+						log.Info("failed to authenticate packet", zap.Error(err))
+						return
+					}
 					spi, algo := scion.PacketAuthOptMetadata(authOpt)
-					if spi == scion.PacketAuthSPIClient && algo == scion.PacketAuthAlgorithm {
-						hostASKey, err := fetcher.FetchHostASKey(ctx, drkey.HostASMeta{
+					if spi == scion.PacketAuthSPIClient && spao.Supported(algo) {
+						hostASMeta := drkey.HostASMeta{
 							ProtoId:  scion.DRKeyProtocolTS,
 							Validity: rxt,
 							SrcIA:    scionLayer.DstIA,
 							DstIA:    scionLayer.SrcIA,
 							SrcHost:  dstAddr.String(),
-						})
+						}
+						hostASKey, err := fetcher.FetchHostASKey(ctx, hostASMeta)
 						if err != nil {
 							log.Error("failed to fetch DRKey level 2: host-AS", zap.Error(err))
 						} else {
-							hostHostKey, err := scion.DeriveHostHostKey(hostASKey, srcAddr.String())
-							if err != nil {
-								panic(err)
-							}
-							authKey = hostHostKey.Key[:]
-							if authMockKey != nil {
-								authKey = authMockKey
+							pld := buf[len(buf)-int(udpLayer.Length):]
+							authKey, err = verifyRequestAuth(hostASKey, srcAddr.String(),
+								authOpt, &scionLayer, pld, authBuf, authMAC)
+							if err == nil && authKey == nil {
+								// The client may have sent the request close to an epoch
+								// boundary and used the key of an adjacent epoch
+								for _, t := range scion.BoundaryEpochs(hostASKey.Epoch, rxt, epochBoundaryWindow) {
+									hostASMeta.Validity = t
+									hostASKey, err = fetcher.FetchHostASKey(ctx, hostASMeta)
+									if err != nil {
+										log.Error("failed to fetch DRKey level 2: host-AS", zap.Error(err))
+										err = nil
+										continue
+									}
+									authKey, err = verifyRequestAuth(hostASKey, srcAddr.String(),
+										authOpt, &scionLayer, pld, authBuf, authMAC)
+									if err != nil || authKey != nil {
+										break
+									}
+								}
 							}
-							_, err = spao.ComputeAuthCMAC(
-								spao.MACInput{
-									Key:        authKey,
-									Header:     slayers.PacketAuthOption{EndToEndOption: authOpt},
-									ScionLayer: &scionLayer,
-									PldType:    slayers.L4UDP,
-									Pld:        buf[len(buf)-int(udpLayer.Length):],
-								},
-								authBuf,
-								authMAC,
-							)
 							if err != nil {
-								panic(err)
+								log.Info("failed to authenticate packet", zap.Error(err))
+								return
 							}
-							authenticated = subtle.ConstantTimeCompare(scion.PacketAuthOptMAC(authOpt), authMAC) != 0
-							if !authenticated {
+							if authKey == nil {
 								log.Info("failed to authenticate packet")
-								continue
+								return
 							}
+							authenticated = true
+							authAlgo = algo
 							mtrcs.pktsAuthenticated.Inc()
 						}
 					}
 				}
 			}
+			if fetcher != nil && !authenticated {
+				// Authenticate the response nevertheless if the key can be derived
+				// from a cached host-AS key, i.e., without a request to the SCION
+				// daemon on behalf of an unauthenticated client.
+				authOpt, authKey = nil, nil
+				hostASKey, ok := fetcher.CachedHostASKey(drkey.HostASMeta{
+					ProtoId:  scion.DRKeyProtocolTS,
+					Validity: rxt,
+					SrcIA:    scionLayer.DstIA,
+					DstIA:    scionLayer.SrcIA,
+					SrcHost:  dstAddr.String(),
+				})
+				if ok {
+					hostHostKey, err := scion.DeriveHostHostKey(hostASKey, srcAddr.String())
+					if err != nil {
+						log.Info("failed to derive DRKey level 3: host-host", zap.Error(err))
+					} else {
+						authOpt, authKey, authAlgo = respAuthOpt, hostHostKey.Key[:], spao.Algorithm()
+					}
+				}
+			}
+
+			var tsVersion uint8
+			tsCapable := false
+			if len(decoded) >= 3 &&
+				decoded[len(decoded)-2] == slayers.LayerTypeEndToEndExtn {
+				tsVersion, tsCapable = scion.TimestampCapability(e2eLayer.Options)
+			}
 
 			var ntpreq ntp.Packet
 			err = ntp.DecodePacket(&ntpreq, udpLayer.Payload)
 			if err != nil {
-				log.Info("failed to decode packet payload", zap.Error(err))
-				continue
+				decodeFailed(log, mtrcs.pktsMalformed, err)
+				return
 			}
 
 			ntsAuthenticated := false
@@ -297,52 +395,90 @@ func runSCIONServer(ctx context.Context, log *zap.Logger, mtrcs *scionServerMetr
 				err = nts.DecodePacket(&ntsreq, udpLayer.Payload)
 				if err != nil {
 					log.Info("failed to decode NTS packet", zap.Error(err))
-					continue
+					return
 				}
 
 				cookie, err := ntsreq.GetFirstCookie()
 				if err != nil {
 					log.Info("failed to get cookie", zap.Error(err))
-					continue
+					return
 				}
 
 				var encryptedCookie ntske.EncryptedServerCookie
 				err = encryptedCookie.Decode(cookie)
 				if err != nil {
 					log.Info("failed to decode cookie", zap.Error(err))
-					continue
+					return
 				}
 
 				key, ok := provider.Get(int(encryptedCookie.ID))
 				if !ok {
 					log.Info("failed to get key", zap.Error(err))
-					continue
+					return
 				}
 
 				serverCookie, err = encryptedCookie.Decrypt(key.Value)
 				if err != nil {
 					log.Info("failed to decrypt cookie", zap.Error(err))
-					continue
+					return
 				}
 
 				err = nts.ProcessRequest(udpLayer.Payload, serverCookie.C2S, &ntsreq)
 				if err != nil {
 					log.Info("failed to process NTS packet", zap.Error(err))
-					continue
+					return
 				}
 				ntsAuthenticated = true
 			}
 
-			err = ntp.ValidateRequest(&ntpreq, udpLayer.SrcPort)
+			symmetric := ntpreq.Mode() == ntp.ModeSymmetricActive
+			if symmetric {
+				if !isSymmetricPeer(scionLayer.SrcIA, srcAddr) {
+					log.Info("received symmetric request from unexpected peer",
+						zap.String("from", scionLayer.SrcIA.String()+","+srcAddr.String()))
+					return
+				}
+				err = ntp.ValidateSymmetricRequest(&ntpreq)
+			} else {
+				err = ntp.ValidateRequest(&ntpreq, udpLayer.SrcPort)
+			}
 			if err != nil {
 				log.Info("failed to validate packet payload", zap.Error(err))
-				continue
+				return
 			}
 
 			dscp := scionLayer.TrafficClass >> 2
 			clientID := scionLayer.SrcIA.String() + "," + srcAddr.String()
 
+			// Symmetric peers are configured explicitly and always fully served
+			tier := FullService
+			if !symmetric {
+				var tierName string
+				tier, tierName = serviceTier(authenticated || ntsAuthenticated)
+				if !admit(tier, tierName, clientID, rxt) {
+					log.Debug("refused request",
+						zap.String("from", clientID),
+						zap.String("tier", tierName),
+					)
+					return
+				}
+				if !tier.Interleaved {
+					// Serve in basic mode by not matching the timestamp store
+					ntpreq.ReceiveTime = ntpreq.TransmitTime
+				}
+				if !tier.HWTimestamps && len(oob) != 0 {
+					tsCapable = false
+					t, err := udp.SoftwareTimestampFromOOBData(oob)
+					if err == nil {
+						rxt = timebase.Interpolate(t)
+					} else {
+						rxt = timebase.Now()
+					}
+				}
+			}
+
 			mtrcs.reqsAccepted.Inc()
+			recordASRequest(scionLayer.SrcIA, authenticated || ntsAuthenticated)
 			log.Debug("received request",
 				zap.Time("at", rxt),
 				zap.String("from", clientID),
@@ -352,17 +488,32 @@ func runSCIONServer(ctx context.Context, log *zap.Logger, mtrcs *scionServerMetr
 				zap.Object("data", ntp.PacketMarshaler{Pkt: &ntpreq}),
 			)
 
+			// Only precise RX timestamps served with full resolution are
+			// included in a timestamp option
+			resolution := servedResolution(scionLayer.SrcIA, srcAddr)
+			if len(oob) == 0 || resolution != 0 {
+				tsCapable = false
+			}
+			if tsCapable {
+				scion.PrepareServerTimestampOpt(rxtOpt, tsVersion, rxt)
+			}
+
 			var txt0 time.Time
 			var ntpresp ntp.Packet
-			handleRequest(clientID, &ntpreq, &rxt, &txt0, &ntpresp)
+			handleRequest(sender.txc, clientID, &ntpreq, &rxt, &txt0, &ntpresp)
+			reducePrecision(&ntpresp, resolution)
+			if symmetric {
+				ntpresp.SetMode(ntp.ModeSymmetricPassive)
+			}
 
-			scionLayer.TrafficClass = config.DSCP << 2
+			scionLayer.TrafficClass = config.DSCP() << 2
 			scionLayer.DstIA, scionLayer.SrcIA = scionLayer.SrcIA, scionLayer.DstIA
 			scionLayer.DstAddrType, scionLayer.SrcAddrType = scionLayer.SrcAddrType, scionLayer.DstAddrType
 			scionLayer.RawDstAddr, scionLayer.RawSrcAddr = scionLayer.RawSrcAddr, scionLayer.RawDstAddr
-			scionLayer.Path, err = scionLayer.Path.Reverse()
+			err = paths.reverse(&scionLayer, udpLayer.SrcPort)
 			if err != nil {
-				panic(err)
+				log.Info("failed to reverse path", zap.Error(err))
+				return
 			}
 			scionLayer.NextHdr = slayers.L4UDP
 
@@ -385,89 +536,237 @@ func runSCIONServer(ctx context.Context, log *zap.Logger, mtrcs *scionServerMetr
 				}
 				if !addedCookie {
 					log.Info("failed to add at least one cookie")
-					continue
+					return
 				}
 
 				ntsresp := nts.NewResponsePacket(cookies, serverCookie.S2C, ntsreq.UniqueID.ID)
 				nts.EncodePacket(&udpLayer.Payload, &ntsresp)
+			} else if symmetric {
+				appendSyntonization(&udpLayer.Payload)
+			} else {
+				appendTAIOffset(&udpLayer.Payload, false /* macFollows */)
 			}
 
-			payload := gopacket.Payload(udpLayer.Payload)
-
-			err = buffer.Clear()
-			if err != nil {
-				panic(err)
-			}
-
-			err = payload.SerializeTo(buffer, options)
-			if err != nil {
-				panic(err)
-			}
-			buffer.PushLayer(payload.LayerType())
-
-			err = udpLayer.SerializeTo(buffer, options)
-			if err != nil {
-				panic(err)
-			}
-			buffer.PushLayer(udpLayer.LayerType())
-
-			if authenticated {
-				scion.PreparePacketAuthOpt(authOpt, scion.PacketAuthSPIServer, scion.PacketAuthAlgorithm)
-				_, err = spao.ComputeAuthCMAC(
-					spao.MACInput{
-						Key:        authKey,
-						Header:     slayers.PacketAuthOption{EndToEndOption: authOpt},
-						ScionLayer: &scionLayer,
-						PldType:    scionLayer.NextHdr,
-						Pld:        buffer.Bytes(),
-					},
-					authBuf,
-					scion.PacketAuthOptMAC(authOpt),
-				)
+			var resp []byte
+			if authOpt == nil && !tsCapable {
+				err = scion.EncodeUDPPacket(&pkt, &scionLayer, udpLayer.SrcPort, udpLayer.DstPort, udpLayer.Payload)
 				if err != nil {
-					panic(err)
+					log.Info("failed to encode packet", zap.Error(err))
+					return
 				}
-
-				e2eExtn := slayers.EndToEndExtn{}
-				e2eExtn.NextHdr = scionLayer.NextHdr
-				e2eExtn.Options = []*slayers.EndToEndOption{authOpt}
-
-				err = e2eExtn.SerializeTo(buffer, options)
+				resp = pkt
+			} else {
+				var opts []*slayers.EndToEndOption
+				if tsCapable {
+					opts = append(opts, rxtOpt)
+				}
+				resp, err = serializeResponse(buffer, options, &scionLayer, &udpLayer,
+					authOpt, authKey, authAlgo, authBuf, opts)
 				if err != nil {
-					panic(err)
+					log.Info("failed to serialize packet", zap.Error(err))
+					return
 				}
-				buffer.PushLayer(e2eExtn.LayerType())
-
-				scionLayer.NextHdr = slayers.End2EndClass
 			}
 
-			err = scionLayer.SerializeTo(buffer, options)
+			txt1, ok, err := sender.send(log, resp, lastHop)
 			if err != nil {
-				panic(err)
-			}
-			buffer.PushLayer(scionLayer.LayerType())
-
-			n, err = conn.WriteToUDPAddrPort(buffer.Bytes(), lastHop)
-			if err != nil || n != len(buffer.Bytes()) {
 				log.Error("failed to write packet", zap.Error(err))
-				continue
+				return
 			}
-			txt1, id, err := udp.ReadTXTimestamp(conn)
-			if err != nil {
-				txt1 = txt0
-				log.Error("failed to read packet tx timestamp", zap.Error(err))
-			} else if id != txID {
+			if !ok {
 				txt1 = txt0
-				log.Error("failed to read packet tx timestamp", zap.Uint32("id", id), zap.Uint32("expected", txID))
-				txID = id + 1
 			} else {
-				txID++
+				txt1 = timebase.Interpolate(txt1)
+				sender.txc.update(txt0, txt1)
+				if !tier.HWTimestamps {
+					txt1 = txt0
+				}
+			}
+			if pcap.Enabled() {
+				pcap.Write(txt1, localAddr, lastHop, resp)
 			}
 			updateTXTimestamp(clientID, rxt, &txt1)
 
 			mtrcs.reqsServed.Inc()
+			wmtrcs.reqsServed.Inc()
+		}
+	}
+}
+
+func runSCIONServer(ctx context.Context, log *zap.Logger, mtrcs *scionServerMetrics, wmtrcs *workerMetrics,
+	conn *net.UDPConn, localHostIface string, localHostPort int,
+	fetcher *scion.Fetcher, provider *ntske.Provider) {
+	defer conn.Close()
+	err := udp.EnableTimestamping(conn, localHostIface)
+	if err != nil {
+		log.Error("failed to enable timestamping", zap.Error(err))
+	}
+	err = udp.SetDSCP(conn, config.DSCP())
+	if err != nil {
+		log.Info("failed to set DSCP", zap.Error(err))
+	}
+	if prio := config.SocketPriority(); prio != 0 {
+		err = udp.SetPriority(conn, prio)
+		if err != nil {
+			log.Info("failed to set socket priority", zap.Error(err))
+		}
+	}
+
+	localAddr := conn.LocalAddr().(*net.UDPAddr).AddrPort()
+	sender := &scionSender{conn: conn, txc: newTXCorrection(wmtrcs)}
+	buf := make([]byte, scion.MTU)
+	oob := make([]byte, udp.TimestampLen())
+
+	var handle scionHandler
+	var queue *requestQueue
+	if n, m := requestQueueConfig(); n != 0 {
+		// Requests are processed by a pool of m goroutines while this goroutine
+		// only receives packets.
+		queue = newRequestQueue(n, scion.MTU, wmtrcs.queueDrops)
+		defer queue.close()
+		for i := 0; i != m; i++ {
+			h := newSCIONHandler(ctx, log, mtrcs, wmtrcs, sender, localAddr, localHostPort, fetcher, provider)
+			go queue.serve(func(r *queuedRequest) {
+				h(r.buf, r.oob, r.lastHop, r.rxt)
+			})
+		}
+	} else {
+		handle = newSCIONHandler(ctx, log, mtrcs, wmtrcs, sender, localAddr, localHostPort, fetcher, provider)
+	}
+
+	for {
+		buf = buf[:cap(buf)]
+		oob = oob[:cap(oob)]
+		n, oobn, flags, lastHop, err := conn.ReadMsgUDPAddrPort(buf, oob)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Error("failed to read packet", zap.Error(err))
+			continue
+		}
+		if flags != 0 {
+			log.Error("failed to read packet", zap.Int("flags", flags))
+			continue
+		}
+		oob = oob[:oobn]
+		rxt, err := udp.TimestampFromOOBData(oob)
+		if err != nil {
+			oob = oob[:0]
+			rxt = timebase.Now()
+			log.Error("failed to read packet rx timestamp", zap.Error(err))
+		} else {
+			rxt = timebase.Interpolate(rxt)
 		}
+		buf = buf[:n]
+		mtrcs.pktsReceived.Inc()
+		wmtrcs.pktsReceived.Inc()
+		if pcap.Enabled() {
+			pcap.Write(rxt, lastHop, localAddr, buf)
+		}
+
+		if queue != nil {
+			queue.push(buf, oob, lastHop, rxt)
+		} else {
+			handle(buf, oob, lastHop, rxt)
+		}
+	}
+}
+
+// verifyRequestAuth returns the host-host key derived from hostASKey if the
+// authenticator authOpt of a request from srcHost is valid under this key, and
+// nil otherwise.
+func verifyRequestAuth(hostASKey drkey.HostASKey, srcHost string,
+	authOpt *slayers.EndToEndOption, scionLayer *slayers.SCION, pld, authBuf, authMAC []byte) ([]byte, error) {
+	hostHostKey, err := scion.DeriveHostHostKey(hostASKey, srcHost)
+	if err != nil {
+		return nil, err
+	}
+	_, err = spao.ComputeAuthMAC(
+		spao.MACInput{
+			Key:        hostHostKey.Key[:],
+			Header:     slayers.PacketAuthOption{EndToEndOption: authOpt},
+			ScionLayer: scionLayer,
+			PldType:    slayers.L4UDP,
+			Pld:        pld,
+		},
+		authBuf,
+		authMAC,
+	)
+	if err != nil {
+		return nil, err
 	}
+	if subtle.ConstantTimeCompare(scion.PacketAuthOptMAC(authOpt), authMAC) == 0 {
+		return nil, nil
+	}
+	return hostHostKey.Key[:], nil
+}
+
+// serializeResponse serializes a response packet with an end-to-end extension
+// that contains opts and, if authOpt is not nil, a SCION Packet Authenticator
+// Option with a MAC computed using authKey and algorithm authAlgo. The MAC
+// does not cover opts.
+func serializeResponse(buffer gopacket.SerializeBuffer, options gopacket.SerializeOptions,
+	scionLayer *slayers.SCION, udpLayer *slayers.UDP,
+	authOpt *slayers.EndToEndOption, authKey []byte, authAlgo uint8, authBuf []byte,
+	opts []*slayers.EndToEndOption) ([]byte, error) {
+	payload := gopacket.Payload(udpLayer.Payload)
+
+	err := buffer.Clear()
+	if err != nil {
+		return nil, err
+	}
+
+	err = payload.SerializeTo(buffer, options)
+	if err != nil {
+		return nil, err
+	}
+	buffer.PushLayer(payload.LayerType())
+
+	err = udpLayer.SerializeTo(buffer, options)
+	if err != nil {
+		return nil, err
+	}
+	buffer.PushLayer(udpLayer.LayerType())
+
+	e2eExtn := slayers.EndToEndExtn{}
+	e2eExtn.NextHdr = scionLayer.NextHdr
+
+	if authOpt != nil {
+		scion.PreparePacketAuthOpt(authOpt, scion.PacketAuthSPIServer, authAlgo)
+		_, err = spao.ComputeAuthMAC(
+			spao.MACInput{
+				Key:        authKey,
+				Header:     slayers.PacketAuthOption{EndToEndOption: authOpt},
+				ScionLayer: scionLayer,
+				PldType:    scionLayer.NextHdr,
+				Pld:        buffer.Bytes(),
+			},
+			authBuf,
+			scion.PacketAuthOptMAC(authOpt),
+		)
+		if err != nil {
+			return nil, err
+		}
+		e2eExtn.Options = append(e2eExtn.Options, authOpt)
+	}
+	e2eExtn.Options = append(e2eExtn.Options, opts...)
+
+	err = e2eExtn.SerializeTo(buffer, options)
+	if err != nil {
+		return nil, err
+	}
+	buffer.PushLayer(e2eExtn.LayerType())
+
+	scionLayer.NextHdr = slayers.End2EndClass
+
+	err = scionLayer.SerializeTo(buffer, options)
+	if err != nil {
+		return nil, err
+	}
+	buffer.PushLayer(scionLayer.LayerType())
+
+	return buffer.Bytes(), nil
 }
 
 func StartSCIONServer(ctx context.Context, log *zap.Logger,
@@ -482,27 +781,26 @@ func StartSCIONServer(ctx context.Context, log *zap.Logger,
 	}
 
 	localHostPort := localHost.Port
-	localHost.Port = scion.EndhostPort
+	if r, ok := scion.EndhostPortRange(); ok && r.Contains(localHostPort) {
+		log.Info("server operating without dispatcher", zap.Stringer("port range", r))
+	} else {
+		localHost.Port = scion.EndhostPort
+	}
 
-	mtrcs := newSCIONServerMetrics()
+	mtrcs := scionMetrics.Load()
 
-	if scionServerNumGoroutine == 1 {
+	conns, err := listenUDP(localHost, numWorkers())
+	if err != nil {
+		log.Fatal("failed to listen for packets", zap.Error(err))
+	}
+	for i, conn := range conns {
 		fetcher := scion.NewFetcher(scion.NewDaemonConnector(ctx, daemonAddr))
-		conn, err := net.ListenUDP("udp", localHost)
-		if err != nil {
-			log.Fatal("failed to listen for packets", zap.Error(err))
-		}
-		go runSCIONServer(ctx, log, mtrcs, conn, localHost.Zone, localHostPort, fetcher, provider)
-	} else {
-		for i := scionServerNumGoroutine; i > 0; i-- {
-			fetcher := scion.NewFetcher(scion.NewDaemonConnector(ctx, daemonAddr))
-			conn, err := reuseport.ListenPacket("udp",
-				net.JoinHostPort(localHost.IP.String(), strconv.Itoa(localHost.Port)))
-			if err != nil {
-				log.Fatal("failed to listen for packets", zap.Error(err))
-			}
-			go runSCIONServer(ctx, log, mtrcs, conn.(*net.UDPConn), localHost.Zone, localHostPort, fetcher, provider)
-		}
+		closeOnDone(ctx, conn)
+		go func(i int, conn *net.UDPConn) {
+			startWorker(log, i)
+			runSCIONServer(ctx, log, mtrcs, newWorkerMetrics(workerServerSCION, i),
+				conn, localHost.Zone, localHostPort, fetcher, provider)
+		}(i, conn)
 	}
 }
 
@@ -519,11 +817,13 @@ func StartSCIONDispatcher(ctx context.Context, log *zap.Logger,
 
 	localHost.Port = scion.EndhostPort
 
-	mtrcs := newSCIONServerMetrics()
+	mtrcs := scionMetrics.Load()
 
-	conn, err := net.ListenUDP("udp", localHost)
+	conns, err := listenUDP(localHost, 1)
 	if err != nil {
 		log.Fatal("failed to listen for packets", zap.Error(err))
 	}
-	go runSCIONServer(ctx, log, mtrcs, conn, localHost.Zone, localHost.Port, nil /* DRKey fetcher */, nil /* NTSKE provider */)
+	closeOnDone(ctx, conns[0])
+	go runSCIONServer(ctx, log, mtrcs, newWorkerMetrics(workerServerDispatcher, 0),
+		conns[0], localHost.Zone, localHost.Port, nil /* DRKey fetcher */, nil /* NTSKE provider */)
 }
@@ -0,0 +1,181 @@
+package server
+
+// NTP over SCION streams: clients that cannot exchange NTP packets as UDP
+// datagrams, e.g., because middleboxes drop the larger authenticated packets,
+// send framed NTP requests on QUIC streams over SCION instead. Responses are
+// always in basic mode. Timestamps are taken when a frame has been read and
+// right before it is written, the configured stream overhead accounts for the
+// delay between these timestamps and the transmission of the underlying
+// packets. Requests are admitted like unauthenticated requests received as
+// datagrams, see ServiceTier, and the numbers of connections and of streams
+// per connection are bounded. QUIC is used as the stream transport since TCP
+// is not available over SCION, see client.SCIONStreamClient.
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/net/ntp"
+	"example.com/scion-time/net/scion"
+	"example.com/scion-time/net/udp"
+)
+
+const (
+	streamMaxConns   = 1024
+	streamMaxStreams = 4
+)
+
+var streamOverhead atomic.Int64
+
+// SetStreamOverhead sets the estimated delay added by the stream transport
+// between the timestamps of a frame and the transmission of its packets.
+func SetStreamOverhead(d time.Duration) {
+	streamOverhead.Store(int64(d))
+}
+
+func handleStreamSCION(log *zap.Logger, clientID string, stream quic.Stream) error {
+	defer stream.Close()
+	overhead := time.Duration(streamOverhead.Load())
+	var buf []byte
+	for {
+		err := ntp.ReadFrame(stream, &buf)
+		if err != nil {
+			return err
+		}
+		rxt := timebase.Now().Add(-overhead)
+
+		var ntpreq ntp.Packet
+		err = ntp.DecodePacket(&ntpreq, buf)
+		if err != nil {
+			decodeFailed(log, scionMetrics.Load().pktsMalformed, err)
+			return err
+		}
+		err = ntp.ValidateRequest(&ntpreq, 0 /* srcPort */)
+		if err != nil {
+			log.Info("failed to validate frame payload", zap.Error(err))
+			return err
+		}
+		tier, tierName := serviceTier(false /* authenticated */)
+		if !admit(tier, tierName, clientID, rxt) {
+			log.Debug("refused request",
+				zap.String("from", clientID),
+				zap.String("tier", tierName),
+				zap.String("transport", "stream"),
+			)
+			return nil
+		}
+		// Serve in basic mode by not matching the timestamp store
+		ntpreq.ReceiveTime = ntpreq.TransmitTime
+
+		log.Debug("received request",
+			zap.Time("at", rxt),
+			zap.String("from", clientID),
+			zap.String("transport", "stream"),
+			zap.Object("data", ntp.PacketMarshaler{Pkt: &ntpreq}),
+		)
+
+		var txt time.Time
+		var ntpresp ntp.Packet
+		handleRequest(nil, clientID, &ntpreq, &rxt, &txt, &ntpresp)
+		ntpresp.TransmitTime = ntp.Time64FromTime(txt.Add(overhead))
+
+		ntp.EncodePacket(&buf, &ntpresp)
+		err = ntp.WriteFrame(stream, buf)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handleConnSCIONStream serves the streams of conn until conn fails or ctx is
+// done. The number of concurrent streams is bounded by the QUIC configuration
+// of the listener.
+func handleConnSCIONStream(ctx context.Context, log *zap.Logger, conn quic.Connection) {
+	clientID := conn.RemoteAddr().String()
+	if a, ok := conn.RemoteAddr().(udp.UDPAddr); ok {
+		clientID = a.IA.String() + "," + a.Host.IP.String()
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer func() { _ = conn.CloseWithError(0, "") }()
+	for {
+		stream, err := conn.AcceptStream(ctx)
+		if err != nil {
+			var errApplication *quic.ApplicationError
+			if ctx.Err() == nil && !(errors.As(err, &errApplication) && errApplication.ErrorCode == 0) {
+				log.Info("failed to accept stream",
+					zap.String("from", clientID), zap.Error(err))
+			}
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := handleStreamSCION(log, clientID, stream)
+			if err != nil && !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				log.Info("failed to handle stream",
+					zap.String("from", clientID), zap.Error(err))
+			}
+		}()
+	}
+}
+
+func runSCIONStreamServer(ctx context.Context, log *zap.Logger, listener quic.Listener) {
+	defer listener.Close()
+	conns := make(chan struct{}, streamMaxConns)
+	for {
+		conn, err := listener.Accept(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Info("failed to accept connection", zap.Error(err))
+			continue
+		}
+		select {
+		case conns <- struct{}{}:
+		default:
+			log.Debug("refused connection", zap.Stringer("from", conn.RemoteAddr()))
+			_ = conn.CloseWithError(0, "too many connections")
+			continue
+		}
+		go func() {
+			defer func() { <-conns }()
+			handleConnSCIONStream(ctx, log, conn)
+		}()
+	}
+}
+
+// StartSCIONStreamServer serves framed NTP requests on QUIC streams over
+// SCION at port ntp.ServerPortSCIONStream.
+func StartSCIONStreamServer(ctx context.Context, log *zap.Logger, localAddr udp.UDPAddr, config *tls.Config) {
+	localAddr.Host.Port = ntp.ServerPortSCIONStream
+
+	log.Info("stream server listening via SCION",
+		zap.Stringer("ip", localAddr.Host.IP),
+		zap.Int("port", localAddr.Host.Port),
+	)
+
+	config = config.Clone()
+	config.NextProtos = []string{ntp.StreamALPN}
+
+	listener, err := scion.ListenQUIC(ctx, localAddr, config, &quic.Config{
+		MaxIncomingStreams:    streamMaxStreams,
+		MaxIncomingUniStreams: -1,
+	})
+	if err != nil {
+		log.Fatal("failed to create QUIC listener", zap.Error(err))
+	}
+
+	go runSCIONStreamServer(ctx, log, listener)
+}
@@ -0,0 +1,169 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/snet"
+	"github.com/scionproto/scion/pkg/snet/path"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/server"
+
+	"example.com/scion-time/net/ntp"
+	"example.com/scion-time/net/scion"
+	"example.com/scion-time/net/udp"
+)
+
+// selfSignedCert returns a self-signed certificate for localhost.
+func selfSignedCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// startStreamServer starts a stream server on the loopback interface and
+// returns the addresses of a client and of the server and the path between
+// them. The server is stopped when the test completes.
+func startStreamServer(t *testing.T) (context.Context, udp.UDPAddr, udp.UDPAddr, []snet.Path) {
+	// Deliver packets to the stream server port directly on the underlay
+	scion.SetEndhostPortRange(scion.PortRange{Min: ntp.ServerPortSCIONStream, Max: ntp.ServerPortSCIONStream})
+
+	ia := addr.MustIAFrom(1, 0xff0000000110)
+	localAddr := udp.UDPAddr{IA: ia, Host: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}}
+	remoteAddr := udp.UDPAddr{IA: ia, Host: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2)}}
+	ps := []snet.Path{path.Path{
+		Src:           ia,
+		Dst:           ia,
+		DataplanePath: path.Empty{},
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		// Wait for the listener to be closed
+		cancel()
+		for i := 0; i != 100; i++ {
+			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: remoteAddr.Host.IP, Port: ntp.ServerPortSCIONStream})
+			if err == nil {
+				conn.Close()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	serverAddr := udp.UDPAddr{IA: ia, Host: &net.UDPAddr{IP: remoteAddr.Host.IP}}
+	server.StartSCIONStreamServer(ctx, zap.NewNop(), serverAddr,
+		&tls.Config{Certificates: []tls.Certificate{selfSignedCert(t)}})
+	return ctx, localAddr, remoteAddr, ps
+}
+
+func TestSCIONStreamExchange(t *testing.T) {
+	ctx, localAddr, remoteAddr, ps := startStreamServer(t)
+
+	// A large overhead must not result in an invalid exchange
+	c := &client.SCIONStreamClient{
+		TLSConfig: tls.Config{InsecureSkipVerify: true},
+		Overhead:  time.Second,
+	}
+	for i := 0; i != 3; i++ {
+		mctx, mcancel := context.WithTimeout(ctx, 5*time.Second)
+		off, err := c.MeasureClockOffset(mctx, zap.NewNop(), localAddr, remoteAddr, ps)
+		mcancel()
+		if err != nil {
+			t.Fatalf("MeasureClockOffset failed: %v", err)
+		}
+		if d := off.Duration(); d < -10*time.Millisecond || d > 10*time.Millisecond {
+			t.Errorf("MeasureClockOffset = %v; want about 0", d)
+		}
+	}
+	s, ok := c.LastSample()
+	if !ok || s.Transport != client.TransportSCIONStream {
+		t.Errorf("LastSample() = %+v, %v; want a stream sample", s, ok)
+	}
+
+	// Stream requests are admitted like unauthenticated datagram requests
+	server.SetServiceTiers(server.FullService, server.ServiceTier{Refuse: true})
+	t.Cleanup(func() {
+		server.SetServiceTiers(server.FullService, server.FullService)
+	})
+	mctx, mcancel := context.WithTimeout(ctx, 5*time.Second)
+	defer mcancel()
+	_, err := c.MeasureClockOffset(mctx, zap.NewNop(), localAddr, remoteAddr, ps)
+	if err == nil {
+		t.Error("MeasureClockOffset succeeded; want refused request")
+	}
+}
+
+func TestSCIONStreamLargeRequest(t *testing.T) {
+	ctx, localAddr, remoteAddr, ps := startStreamServer(t)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	remoteAddr.Host = &net.UDPAddr{IP: remoteAddr.Host.IP, Port: ntp.ServerPortSCIONStream}
+	tlsCfg := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{ntp.StreamALPN}}
+	conn, err := scion.DialQUIC(ctx, localAddr, remoteAddr, ps[0], "" /* host */, tlsCfg, &quic.Config{})
+	if err != nil {
+		t.Fatalf("DialQUIC failed: %v", err)
+	}
+	defer func() { _ = conn.CloseWithError(0, "") }()
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("OpenStreamSync failed: %v", err)
+	}
+	defer stream.Close()
+
+	// Requests with extension fields that do not fit into a single datagram
+	// on a standard Ethernet path are carried in several QUIC packets
+	req := ntp.Packet{TransmitTime: ntp.Time64FromTime(time.Now())}
+	req.SetVersion(ntp.VersionMax)
+	req.SetMode(ntp.ModeClient)
+	var buf []byte
+	ntp.EncodePacket(&buf, &req)
+	ntp.EncodeExtensionFields(&buf, []ntp.ExtensionField{{Type: 0x0104, Value: make([]byte, 1800)}}, false /* macFollows */)
+	if len(buf) <= 1500 {
+		t.Fatalf("request of %d bytes fits into a single datagram", len(buf))
+	}
+	err = ntp.WriteFrame(stream, buf)
+	if err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+	err = ntp.ReadFrame(stream, &buf)
+	if err != nil {
+		t.Fatalf("ReadFrame failed: %v", err)
+	}
+	var resp ntp.Packet
+	err = ntp.DecodePacket(&resp, buf)
+	if err != nil {
+		t.Fatalf("DecodePacket failed: %v", err)
+	}
+	if resp.Mode() != ntp.ModeServer || resp.OriginTime != req.TransmitTime {
+		t.Errorf("response mode %d, origin %v; want mode %d, origin %v",
+			resp.Mode(), resp.OriginTime, ntp.ModeServer, req.TransmitTime)
+	}
+}
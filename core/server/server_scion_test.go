@@ -0,0 +1,149 @@
+package server_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/slayers/path/empty"
+
+	"example.com/scion-time/core/server"
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/net/ntp"
+	"example.com/scion-time/net/scion"
+)
+
+const testServerPort = 10123
+
+// encodeSCIONRequest returns a SCION/UDP packet carrying an NTP client
+// request and, if there are any, the end-to-end options opts.
+func encodeSCIONRequest(t *testing.T, opts []*slayers.EndToEndOption) []byte {
+	t.Helper()
+	ia := addr.MustIAFrom(1, 0xff0000000110)
+	scionLayer := slayers.SCION{
+		Version:  0,
+		SrcIA:    ia,
+		DstIA:    ia,
+		PathType: empty.PathType,
+		Path:     empty.Path{},
+		NextHdr:  slayers.L4UDP,
+	}
+	err := scionLayer.SetSrcAddr(&net.IPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = scionLayer.SetDstAddr(&net.IPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var req ntp.Packet
+	req.SetVersion(ntp.VersionMax)
+	req.SetMode(ntp.ModeClient)
+	req.TransmitTime = ntp.Time64FromTime(timebase.Now())
+	var payload []byte
+	ntp.EncodePacket(&payload, &req)
+
+	udpLayer := slayers.UDP{SrcPort: 31000, DstPort: testServerPort}
+	udpLayer.SetNetworkLayerForChecksum(&scionLayer)
+	layers := []gopacket.SerializableLayer{&scionLayer}
+	if len(opts) != 0 {
+		scionLayer.NextHdr = slayers.End2EndClass
+		e2eExtn := &slayers.EndToEndExtn{Options: opts}
+		e2eExtn.NextHdr = slayers.L4UDP
+		layers = append(layers, e2eExtn)
+	}
+	layers = append(layers, &udpLayer, gopacket.Payload(payload))
+	buffer := gopacket.NewSerializeBuffer()
+	err = gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{
+		ComputeChecksums: true,
+		FixLengths:       true,
+	}, layers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// exchangeSCION lets the server handle req with control data oob and returns
+// the end-to-end options of the response.
+func exchangeSCION(t *testing.T, req, oob []byte, rxt time.Time) ([]*slayers.EndToEndOption, bool) {
+	t.Helper()
+	rconn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rconn.Close()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	lastHop := rconn.LocalAddr().(*net.UDPAddr).AddrPort()
+	server.HandleSCIONPacket(conn, testServerPort, req, oob, lastHop, rxt)
+
+	buf := make([]byte, scion.MTU)
+	err = rconn.SetReadDeadline(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := rconn.Read(buf)
+	if err != nil {
+		t.Fatalf("no response: %v", err)
+	}
+	var (
+		scionLayer slayers.SCION
+		e2eLayer   slayers.EndToEndExtn
+		udpLayer   slayers.UDP
+	)
+	parser := gopacket.NewDecodingLayerParser(slayers.LayerTypeSCION, &scionLayer, &e2eLayer, &udpLayer)
+	parser.IgnoreUnsupported = true
+	decoded := make([]gopacket.LayerType, 3)
+	err = parser.DecodeLayers(buf[:n], &decoded)
+	if err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	var resp ntp.Packet
+	err = ntp.DecodePacket(&resp, udpLayer.Payload)
+	if err != nil {
+		t.Fatalf("failed to decode response payload: %v", err)
+	}
+	if len(decoded) == 3 && decoded[1] == slayers.LayerTypeEndToEndExtn {
+		return e2eLayer.Options, true
+	}
+	return nil, false
+}
+
+func TestSCIONServerTimestampOpt(t *testing.T) {
+	t.Cleanup(server.ResetASStatistics)
+
+	capOpt := &slayers.EndToEndOption{}
+	scion.PrepareTimestampCapabilityOpt(capOpt)
+	oob := []byte{0} // RX timestamp taken by the kernel
+	rxt := timebase.Now()
+
+	opts, ok := exchangeSCION(t, encodeSCIONRequest(t, []*slayers.EndToEndOption{capOpt}), oob, rxt)
+	if !ok {
+		t.Fatal("response to capable client without end-to-end extension")
+	}
+	if ts, ok := scion.FindServerTimestampOpt(opts); !ok || !ts.Equal(rxt) {
+		t.Errorf("server timestamp option = %v, %t; want %v, true", ts, ok, rxt)
+	}
+
+	// Responses to other clients stay on the fast path
+	if _, ok := exchangeSCION(t, encodeSCIONRequest(t, nil), oob, rxt); ok {
+		t.Error("response to client without capability with end-to-end extension")
+	}
+
+	// Only RX timestamps taken by the kernel or the NIC are included
+	opts, _ = exchangeSCION(t, encodeSCIONRequest(t, []*slayers.EndToEndOption{capOpt}), nil, rxt)
+	if _, ok := scion.FindServerTimestampOpt(opts); ok {
+		t.Error("server timestamp option without precise RX timestamp")
+	}
+}
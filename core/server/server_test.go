@@ -1,9 +1,18 @@
 package server_test
 
 import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/netip"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/scionproto/scion/pkg/addr"
+
 	"go.uber.org/zap"
 
 	"example.com/scion-time/core/server"
@@ -37,3 +46,213 @@ func TestSimpleRequest(t *testing.T) {
 
 	server.LogTSS(t, "post")
 }
+
+func TestASStatistics(t *testing.T) {
+	ia0 := addr.MustIAFrom(1, 0xff0000000110)
+	ia1 := addr.MustIAFrom(1, 0xff0000000111)
+	server.RecordASRequest(ia0, true)
+	server.RecordASRequest(ia1, false)
+	server.RecordASRequest(ia1, true)
+
+	ss := server.ASStatistics(1)
+	if len(ss) != 1 {
+		t.Fatalf("ASStatistics(1) returned %d entries", len(ss))
+	}
+	s := ss[0]
+	if s.IA != ia1.String() || s.Requests != 2 || s.AuthRequests != 1 || s.UnauthRequests != 1 {
+		t.Errorf("ASStatistics(1) = %+v; want 2 requests from %v, 1 authenticated", s, ia1)
+	}
+	if s.Rate <= 0 {
+		t.Errorf("ASStatistics(1) rate = %v; want > 0", s.Rate)
+	}
+}
+
+func TestASRequestRate(t *testing.T) {
+	w := server.ASStatsRateWindow
+	t0 := time.Unix(0, 0)
+	perWindow := func(r float64) float64 { return r * w.Seconds() }
+	for _, tc := range []struct {
+		now  time.Time
+		want float64
+	}{
+		{t0, 60 + 30},
+		{t0.Add(w / 2), 60 + 15},
+		{t0.Add(w), 60},
+		{t0.Add(3 * w / 2), 30},
+		{t0.Add(2 * w), 0},
+	} {
+		r := perWindow(server.ASRequestRate(t0, 60, 30, tc.now))
+		if math.Abs(r-tc.want) > 1e-9 {
+			t.Errorf("requests per window at %v = %v; want %v", tc.now.Sub(t0), r, tc.want)
+		}
+	}
+}
+
+func BenchmarkRecordASRequest(b *testing.B) {
+	ias := make([]addr.IA, 64)
+	for i := range ias {
+		ias[i] = addr.MustIAFrom(1, addr.AS(0xff0000000000+i))
+	}
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			server.RecordASRequest(ias[i%len(ias)], i%2 == 0)
+			i++
+		}
+	})
+}
+
+func TestClientOffsetEstimate(t *testing.T) {
+	const offset = 5 * time.Millisecond
+	clientID := "client-1"
+
+	rxt := timebase.Now().Add(-2 * time.Millisecond)
+	cTxTime := rxt.Add(-1 * time.Millisecond).Add(offset)
+	ntpreq := ntp.Packet{}
+	ntpreq.SetVersion(ntp.VersionMax)
+	ntpreq.SetMode(ntp.ModeClient)
+	ntpreq.TransmitTime = ntp.Time64FromTime(cTxTime)
+
+	var txt time.Time
+	var ntpresp ntp.Packet
+	server.HandleRequest(clientID, &ntpreq, &rxt, &txt, &ntpresp)
+	txt = txt.Add(10 * time.Microsecond) // kernel tx timestamp
+	server.UpdateTXTimestamp(clientID, rxt, &txt)
+	cRxTime := txt.Add(1 * time.Millisecond).Add(offset)
+
+	ntpreq.OriginTime = ntpresp.ReceiveTime
+	ntpreq.ReceiveTime = ntp.Time64FromTime(cRxTime)
+	rxt = timebase.Now()
+	server.HandleRequest(clientID, &ntpreq, &rxt, &txt, &ntpresp)
+
+	for _, s := range server.ClientStatistics() {
+		if s.Client != clientID {
+			continue
+		}
+		if d := s.Offset - offset; d < -time.Microsecond || d > time.Microsecond {
+			t.Errorf("estimated client offset %v; want %v", s.Offset, offset)
+		}
+		if d := s.RoundTripDelay - 2*time.Millisecond; d < -time.Microsecond || d > time.Microsecond {
+			t.Errorf("estimated round trip delay %v; want %v", s.RoundTripDelay, 2*time.Millisecond)
+		}
+		return
+	}
+	t.Errorf("no offset estimate for %s", clientID)
+}
+
+func TestReducePrecision(t *testing.T) {
+	const resolution = 100 * time.Microsecond
+	rxt := time.Unix(1700000000, 123456789)
+	ntpresp := ntp.Packet{
+		Precision:    -32,
+		ReceiveTime:  ntp.Time64FromTime(rxt),
+		TransmitTime: ntp.Time64FromTime(rxt.Add(1234 * time.Nanosecond)),
+	}
+	server.ReducePrecision(&ntpresp, resolution)
+	if ntpresp.Precision != -13 {
+		t.Errorf("precision %d; want %d", ntpresp.Precision, -13)
+	}
+	for _, ts := range []ntp.Time64{ntpresp.ReceiveTime, ntpresp.TransmitTime} {
+		x := ntp.TimeFromTime64(ts)
+		if d := x.Sub(rxt.Round(resolution)); d < -time.Nanosecond || d > time.Nanosecond {
+			t.Errorf("timestamp %v; want %v", x, rxt.Round(resolution))
+		}
+	}
+}
+
+func TestServedResolution(t *testing.T) {
+	const resolution = 100 * time.Microsecond
+	ia := addr.MustIAFrom(1, 0xff00_0000_0111)
+	server.SetReducedPrecision(resolution, []server.FullPrecisionPrefix{
+		{Prefix: netip.MustParsePrefix("10.0.0.0/8")},
+		{IA: ia, Prefix: netip.MustParsePrefix("192.0.2.0/24")},
+	})
+	t.Cleanup(server.ClearReducedPrecision)
+	for _, tc := range []struct {
+		ia   addr.IA
+		host string
+		want time.Duration
+	}{
+		{0, "10.1.1.1", 0},
+		{0, "::ffff:10.1.1.1", 0},
+		{0, "192.0.2.1", resolution},
+		{ia, "192.0.2.1", 0},
+		{ia, "10.1.1.1", resolution},
+		{addr.MustIAFrom(1, 0xff00_0000_0112), "192.0.2.1", resolution},
+	} {
+		got := server.ServedResolution(tc.ia, netip.MustParseAddr(tc.host))
+		if got != tc.want {
+			t.Errorf("ServedResolution(%v, %s) = %v; want %v", tc.ia, tc.host, got, tc.want)
+		}
+	}
+}
+
+func TestTXCorrectionPerSocket(t *testing.T) {
+	server.EnableTXTimestampCorrection()
+	c0, c1 := server.NewTXCorrection(), server.NewTXCorrection()
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i != 100; i++ {
+		c0.Update(c0.Apply(t0), t0.Add(80*time.Microsecond))
+	}
+	if d := c0.Apply(t0).Sub(t0); d < 70*time.Microsecond || d > 80*time.Microsecond {
+		t.Errorf("correction of updated socket = %v; want about 80µs", d)
+	}
+	if d := c1.Apply(t0).Sub(t0); d != 0 {
+		t.Errorf("correction of other socket = %v; want 0", d)
+	}
+	var c *server.TXCorrection
+	if d := c.Apply(t0).Sub(t0); d != 0 {
+		t.Errorf("nil correction = %v; want 0", d)
+	}
+}
+
+func TestBroadcastAuthentication(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	key := ntp.SymmetricKey{ID: 7, Type: ntp.SymmetricKeyTypeMD5, Value: []byte("broadcast")}
+	server.StartBroadcastServer(ctx, zap.NewNop(), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+		conn.LocalAddr().(*net.UDPAddr), time.Hour, key)
+
+	err = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := ntp.VerifyMAC(buf[:n], ntp.SymmetricKeys{key.ID: key})
+	if err != nil {
+		t.Fatalf("VerifyMAC() failed: %v", err)
+	}
+	if k.ID != key.ID {
+		t.Errorf("VerifyMAC() key ID = %d; want %d", k.ID, key.ID)
+	}
+	var pkt ntp.Packet
+	err = ntp.DecodePacket(&pkt, buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkt.Mode() != ntp.ModeBroadcast {
+		t.Errorf("mode = %d; want %d", pkt.Mode(), ntp.ModeBroadcast)
+	}
+}
+
+func TestDecodeFailedCountsMalformed(t *testing.T) {
+	malformed := prometheus.NewCounter(prometheus.CounterOpts{Name: "malformed"})
+	var pkt ntp.Packet
+	err := ntp.DecodePacket(&pkt, make([]byte, ntp.PacketLen-1))
+	server.DecodeFailed(zap.NewNop(), malformed, err)
+	server.DecodeFailed(zap.NewNop(), malformed, errors.New("decode failed"))
+	if n := testutil.ToFloat64(malformed); n != 1 {
+		t.Errorf("unexpected number of malformed packets: %v", n)
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+// AF_XDP fast path for plain NTP requests: unauthenticated client mode
+// requests are answered from the XDP sockets; everything else, including
+// NTS, MAC and SCION traffic, takes the regular path.
+
+import (
+	"context"
+	"net/netip"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/net/ntp"
+	"example.com/scion-time/net/xdp"
+)
+
+const workerServerXDP = "xdp"
+
+func handleXDPRequest(log *zap.Logger, mtrcs *ipServerMetrics, wmtrcs *workerMetrics,
+	buf []byte, srcAddr netip.AddrPort) bool {
+	rxt := timebase.Now()
+	mtrcs.pktsReceived.Inc()
+	wmtrcs.pktsReceived.Inc()
+
+	var ntpreq ntp.Packet
+	err := ntp.DecodePacket(&ntpreq, buf)
+	if err != nil {
+		decodeFailed(log, mtrcs.pktsMalformed, err)
+		return false
+	}
+	err = ntp.ValidateRequest(&ntpreq, srcAddr.Port())
+	if err != nil {
+		log.Info("failed to validate packet payload", zap.Error(err))
+		return false
+	}
+
+	clientID := srcAddr.Addr().String()
+
+	mtrcs.reqsAccepted.Inc()
+	log.Debug("received request",
+		zap.Time("at", rxt),
+		zap.String("from", clientID),
+		zap.Object("data", ntp.PacketMarshaler{Pkt: &ntpreq}),
+	)
+
+	var txt0 time.Time
+	var ntpresp ntp.Packet
+	handleRequest(nil, clientID, &ntpreq, &rxt, &txt0, &ntpresp)
+	reducePrecision(&ntpresp, servedResolution(0, srcAddr.Addr()))
+	ntp.EncodePacket(&buf, &ntpresp)
+
+	// No transmit timestamps are available on the XDP path, the best
+	// estimate for interleaved mode is the timestamp in the response.
+	updateTXTimestamp(clientID, rxt, &txt0)
+
+	mtrcs.reqsServed.Inc()
+	wmtrcs.reqsServed.Inc()
+	return true
+}
+
+// StartXDPServer answers plain NTP requests to localHost (any address if
+// unspecified) on numQueues receive queues of network interface iface via
+// AF_XDP sockets. It requires CAP_NET_ADMIN, CAP_NET_RAW and CAP_BPF (or
+// root).
+func StartXDPServer(ctx context.Context, log *zap.Logger,
+	iface string, numQueues int, localHost netip.AddrPort) {
+	log.Info("server listening via XDP",
+		zap.String("interface", iface),
+		zap.Int("queues", numQueues),
+		zap.Stringer("ip", localHost.Addr()),
+		zap.Uint16("port", localHost.Port()),
+	)
+
+	mtrcs := ipMetrics.Load()
+
+	prog, err := xdp.LoadProgram(xdp.Config{
+		Interface:      iface,
+		NumQueues:      numQueues,
+		Addr:           localHost.Addr(),
+		Port:           localHost.Port(),
+		PayloadLen:     ntp.PacketLen,
+		FirstByteMask:  0b0000_0111,
+		FirstByteValue: ntp.ModeClient,
+	})
+	if err != nil {
+		log.Fatal("failed to load XDP program", zap.Error(err))
+	}
+	go func() {
+		<-ctx.Done()
+		_ = prog.Close()
+	}()
+
+	for i := 0; i != numQueues; i++ {
+		sock, err := prog.Open(i)
+		if err != nil {
+			log.Fatal("failed to open XDP socket", zap.Int("queue", i), zap.Error(err))
+		}
+		go func(i int) {
+			defer sock.Close()
+			startWorker(log, i)
+			wmtrcs := newWorkerMetrics(workerServerXDP, i)
+			err := sock.Serve(ctx, func(buf []byte, srcAddr netip.AddrPort) bool {
+				return handleXDPRequest(log, mtrcs, wmtrcs, buf, srcAddr)
+			})
+			if err != nil {
+				log.Error("failed to serve via XDP", zap.Int("queue", i), zap.Error(err))
+			}
+		}(i)
+	}
+}
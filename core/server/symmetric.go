@@ -0,0 +1,69 @@
+package server
+
+// Symmetric mode between cooperating timeservices: configured SCION peers send
+// symmetric active requests (mode 1) which are answered in symmetric passive
+// mode (mode 2), including interleaved mode. Both peers run an active
+// association with each other so that they mutually discipline their clocks.
+// Responses to peers optionally carry a syntonization message with the
+// frequency error estimated by the clock sync.
+
+import (
+	"net/netip"
+	"sync/atomic"
+
+	"github.com/scionproto/scion/pkg/addr"
+
+	"example.com/scion-time/net/ntp"
+	"example.com/scion-time/net/udp"
+)
+
+type symmetricPeer struct {
+	ia   addr.IA
+	host netip.Addr
+}
+
+var (
+	symmetricPeers atomic.Pointer[map[symmetricPeer]struct{}]
+	syntonization  atomic.Pointer[ntp.Syntonization]
+)
+
+// SetSymmetricPeers sets the peers whose symmetric active requests are
+// answered. Requests in symmetric active mode from other hosts are dropped.
+func SetSymmetricPeers(peers []udp.UDPAddr) {
+	m := make(map[symmetricPeer]struct{}, len(peers))
+	for _, p := range peers {
+		host, ok := netip.AddrFromSlice(p.Host.IP)
+		if !ok {
+			panic("unexpected peer address")
+		}
+		m[symmetricPeer{ia: p.IA, host: host.Unmap()}] = struct{}{}
+	}
+	symmetricPeers.Store(&m)
+}
+
+func isSymmetricPeer(ia addr.IA, host netip.Addr) bool {
+	m := symmetricPeers.Load()
+	if m == nil {
+		return false
+	}
+	_, ok := (*m)[symmetricPeer{ia: ia, host: host.Unmap()}]
+	return ok
+}
+
+// SetSyntonization sets the syntonization message included in responses to
+// symmetric peers. If ok is false, no syntonization message is sent.
+func SetSyntonization(s ntp.Syntonization, ok bool) {
+	if !ok {
+		syntonization.Store(nil)
+		return
+	}
+	syntonization.Store(&s)
+}
+
+func appendSyntonization(b *[]byte) {
+	s := syntonization.Load()
+	if s == nil {
+		return
+	}
+	ntp.EncodeExtensionFields(b, []ntp.ExtensionField{ntp.EncodeSyntonization(*s)}, false /* macFollows */)
+}
@@ -0,0 +1,61 @@
+package server
+
+// TAI-aware responses: NTPv5 requests for the TAI timescale are answered in
+// TAI and, optionally, unauthenticated and symmetric-key authenticated
+// responses carry an experimental extension field with the TAI-UTC offset, as
+// far as the offset is known. Leap seconds scheduled in the TAI-UTC offset are
+// announced in the leap indicator of responses on the day of the leap second.
+
+import (
+	"sync/atomic"
+	"time"
+
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/net/ntp"
+)
+
+var taiOffsetExtension atomic.Bool
+
+// EnableTAIOffsetExtension enables the TAI offset extension field in
+// responses.
+func EnableTAIOffsetExtension() {
+	taiOffsetExtension.Store(true)
+}
+
+func appendTAIOffset(b *[]byte, macFollows bool) {
+	if !taiOffsetExtension.Load() {
+		return
+	}
+	o, ok := timebase.CurrentTAIOffset()
+	if !ok {
+		return
+	}
+	ef := ntp.EncodeTAIOffset(ntp.TAIOffset{
+		Offset:     o.Offset,
+		NextOffset: o.NextOffset,
+		NextAt:     o.NextAt,
+	})
+	ntp.EncodeExtensionFields(b, []ntp.ExtensionField{ef}, macFollows)
+}
+
+// leapIndicator returns the leap indicator of a response at t.
+func leapIndicator(t time.Time) uint8 {
+	switch timebase.Leap(t) {
+	case 1:
+		return ntp.LeapIndicatorInsertSecond
+	case -1:
+		return ntp.LeapIndicatorDeleteSecond
+	}
+	return ntp.LeapIndicatorNoWarning
+}
+
+// taiTimestamps converts the UTC timestamps rxt and txt to TAI, if the TAI-UTC
+// offset is known.
+func taiTimestamps(rxt, txt time.Time) (time.Time, time.Time, bool) {
+	off, ok := timebase.TAIOffsetAt(rxt)
+	if !ok {
+		return rxt, txt, false
+	}
+	return rxt.Add(off), txt.Add(off), true
+}
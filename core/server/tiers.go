@@ -0,0 +1,132 @@
+package server
+
+// Authorization tiers of the SCION server: requests authenticated via SPAO
+// with DRKey or via NTS may be served better than unauthenticated requests in
+// order to incentivize authenticated use. Each tier may refuse requests, limit
+// the request rate per client, and restrict requests to basic mode and to
+// software timestamps. Rate limited requests are dropped. The buckets of the
+// rate limit are evicted in least recently used order.
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"example.com/scion-time/base/metrics"
+)
+
+const (
+	tierAuthenticated   = "authenticated"
+	tierUnauthenticated = "unauthenticated"
+
+	tierBucketsCap = 1 << 16
+)
+
+// ServiceTier describes the service granted to the requests of a tier.
+type ServiceTier struct {
+	Refuse       bool    // drop all requests
+	Rate         float64 // requests per second per client, 0 for no limit
+	Burst        float64 // requests per client in excess of Rate, at least 1
+	Interleaved  bool    // serve requests in interleaved mode
+	HWTimestamps bool    // serve kernel or hardware timestamps
+}
+
+// FullService is the service tier of all requests by default.
+var FullService = ServiceTier{Interleaved: true, HWTimestamps: true}
+
+type serviceTiers struct {
+	authenticated   ServiceTier
+	unauthenticated ServiceTier
+}
+
+type tierBucket struct {
+	key     string
+	tokens  float64
+	updated time.Time
+}
+
+var (
+	tiers atomic.Pointer[serviceTiers]
+
+	tierMu      sync.Mutex
+	tierBuckets = make(map[string]*list.Element)
+	tierLRU     = list.New()
+
+	tierReqsRefused = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: metrics.SCIONServerReqsRefusedN,
+		Help: metrics.SCIONServerReqsRefusedH,
+	}, []string{"tier", "reason"})
+)
+
+func init() {
+	tiers.Store(&serviceTiers{authenticated: FullService, unauthenticated: FullService})
+}
+
+// SetServiceTiers sets the service tiers of authenticated and unauthenticated
+// requests received via SCION.
+func SetServiceTiers(authenticated, unauthenticated ServiceTier) {
+	for _, t := range []ServiceTier{authenticated, unauthenticated} {
+		if t.Rate < 0 || t.Rate != 0 && t.Burst < 1 {
+			panic("invalid service tier rate limit")
+		}
+	}
+	tiers.Store(&serviceTiers{authenticated: authenticated, unauthenticated: unauthenticated})
+	tierMu.Lock()
+	defer tierMu.Unlock()
+	tierBuckets = make(map[string]*list.Element)
+	tierLRU.Init()
+}
+
+// serviceTier returns the service tier of a request and its name.
+func serviceTier(authenticated bool) (ServiceTier, string) {
+	ts := tiers.Load()
+	if authenticated {
+		return ts.authenticated, tierAuthenticated
+	}
+	return ts.unauthenticated, tierUnauthenticated
+}
+
+// admit reports whether a request of clientID received at now is served
+// according to tier t named name.
+func admit(t ServiceTier, name, clientID string, now time.Time) bool {
+	if t.Refuse {
+		tierReqsRefused.WithLabelValues(name, "refused").Inc()
+		return false
+	}
+	if t.Rate == 0 {
+		return true
+	}
+	key := name + "/" + clientID
+	tierMu.Lock()
+	defer tierMu.Unlock()
+	var b *tierBucket
+	if e, ok := tierBuckets[key]; ok {
+		tierLRU.MoveToFront(e)
+		b = e.Value.(*tierBucket)
+	} else {
+		if len(tierBuckets) == tierBucketsCap {
+			e := tierLRU.Back()
+			delete(tierBuckets, e.Value.(*tierBucket).key)
+			tierLRU.Remove(e)
+		}
+		b = &tierBucket{key: key, tokens: t.Burst, updated: now}
+		tierBuckets[key] = tierLRU.PushFront(b)
+	}
+	if now.After(b.updated) {
+		b.tokens += now.Sub(b.updated).Seconds() * t.Rate
+		if b.tokens > t.Burst {
+			b.tokens = t.Burst
+		}
+		b.updated = now
+	}
+	if b.tokens < 1 {
+		tierReqsRefused.WithLabelValues(name, "rate").Inc()
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,70 @@
+package server_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"example.com/scion-time/core/server"
+)
+
+func TestServiceTiers(t *testing.T) {
+	defer server.SetServiceTiers(server.FullService, server.FullService)
+
+	unauth := server.FullService
+	unauth.Rate, unauth.Burst = 1, 2
+	server.SetServiceTiers(server.FullService, unauth)
+
+	t0 := time.Unix(0, 0)
+	for i := 0; i != 2; i++ {
+		if !server.Admit(false /* authenticated */, "client-0", t0) {
+			t.Fatalf("request %d within burst refused", i)
+		}
+	}
+	if server.Admit(false /* authenticated */, "client-0", t0) {
+		t.Error("request exceeding burst admitted")
+	}
+	if !server.Admit(false /* authenticated */, "client-1", t0) {
+		t.Error("request of other client refused")
+	}
+	if !server.Admit(true /* authenticated */, "client-0", t0) {
+		t.Error("authenticated request refused")
+	}
+	if !server.Admit(false /* authenticated */, "client-0", t0.Add(time.Second)) {
+		t.Error("request after refill refused")
+	}
+
+	unauth.Refuse = true
+	server.SetServiceTiers(server.FullService, unauth)
+	if server.Admit(false /* authenticated */, "client-2", t0) {
+		t.Error("request of refused tier admitted")
+	}
+}
+
+func TestServiceTiersEviction(t *testing.T) {
+	defer server.SetServiceTiers(server.FullService, server.FullService)
+
+	unauth := server.FullService
+	unauth.Rate, unauth.Burst = 1, 1
+	server.SetServiceTiers(server.FullService, unauth)
+
+	t0 := time.Unix(0, 0)
+	for _, c := range []string{"client-0", "client-1"} {
+		if !server.Admit(false /* authenticated */, c, t0) || server.Admit(false /* authenticated */, c, t0) {
+			t.Fatalf("%s: unexpected rate limit", c)
+		}
+	}
+	// Fill the buckets with other clients; client-1 stays recently used
+	for i := 0; i != server.TierBucketsCap-1; i++ {
+		server.Admit(false /* authenticated */, fmt.Sprintf("other-%d", i), t0)
+		if i == server.TierBucketsCap/2 && server.Admit(false /* authenticated */, "client-1", t0) {
+			t.Fatal("client-1: request exceeding burst admitted")
+		}
+	}
+	if !server.Admit(false /* authenticated */, "client-0", t0) {
+		t.Error("client-0: request after eviction of its bucket refused")
+	}
+	if server.Admit(false /* authenticated */, "client-1", t0) {
+		t.Error("client-1: request exceeding burst admitted after eviction of other buckets")
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+// One-step emulation of NIC transmit timestamp insertion: the transmit
+// timestamp of basic mode responses is advanced by the estimated delay between
+// taking the timestamp and the actual transmission, as measured by the
+// follow-up TX timestamps that are also stored for interleaved mode. The delay
+// depends on the NIC and queue of a socket, hence each socket keeps its own
+// correction.
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	txCorrectionGainShift = 3
+	txCorrectionMax       = 1 * time.Millisecond
+)
+
+var txCorrectionEnabled atomic.Bool
+
+// txCorrection is the transmit timestamp correction of a single socket. It may
+// be updated and applied concurrently.
+type txCorrection struct {
+	c     atomic.Int64
+	gauge prometheus.Gauge
+}
+
+// EnableTXTimestampCorrection enables the correction of transmit timestamps
+// in basic mode responses based on the TX timestamps of previous responses.
+func EnableTXTimestampCorrection() {
+	txCorrectionEnabled.Store(true)
+}
+
+func newTXCorrection(wmtrcs *workerMetrics) *txCorrection {
+	return &txCorrection{gauge: wmtrcs.txCorrection}
+}
+
+// apply returns txt advanced by the correction. Responses on sockets without
+// TX timestamps have a nil correction and are not corrected.
+func (c *txCorrection) apply(txt time.Time) time.Time {
+	if c == nil || !txCorrectionEnabled.Load() {
+		return txt
+	}
+	return txt.Add(time.Duration(c.c.Load()))
+}
+
+// update adjusts the correction by a fraction of the residual between the
+// transmit timestamp txt0 in a response and the actual transmit timestamp txt1
+// of that response.
+func (c *txCorrection) update(txt0, txt1 time.Time) {
+	if c == nil || !txCorrectionEnabled.Load() {
+		return
+	}
+	r := int64(txt1.Sub(txt0)) >> txCorrectionGainShift
+	for {
+		c0 := c.c.Load()
+		c1 := c0 + r
+		if c1 < 0 {
+			c1 = 0
+		} else if c1 > int64(txCorrectionMax) {
+			c1 = int64(txCorrectionMax)
+		}
+		if c.c.CompareAndSwap(c0, c1) {
+			c.gauge.Set(time.Duration(c1).Seconds())
+			return
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package server
+
+// Sharding of request processing across worker goroutines, each with its own
+// SO_REUSEPORT socket
+
+import (
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/metrics"
+)
+
+const (
+	defaultNumWorkers      = 8
+	defaultNumQueueWorkers = 4
+
+	workerServerIP         = "ip"
+	workerServerSCION      = "scion"
+	workerServerDispatcher = "dispatcher"
+)
+
+type workerConfig struct {
+	numWorkers int
+	pinCPUs    bool
+	batchSize  int
+	busyPoll   time.Duration
+	gro        bool
+	queueLen   int
+	queueProcs int
+}
+
+type workerMetrics struct {
+	pktsReceived prometheus.Counter
+	reqsServed   prometheus.Counter
+	queueDrops   prometheus.Counter
+	txCorrection prometheus.Gauge
+}
+
+var (
+	workers atomic.Pointer[workerConfig]
+
+	workerLbls         = []string{"server", "worker"}
+	workerPktsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: metrics.ServerWorkerPktsReceivedN,
+		Help: metrics.ServerWorkerPktsReceivedH,
+	}, workerLbls)
+	workerReqsServed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: metrics.ServerWorkerReqsServedN,
+		Help: metrics.ServerWorkerReqsServedH,
+	}, workerLbls)
+	workerQueueDrops = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: metrics.ServerWorkerQueueDropsN,
+		Help: metrics.ServerWorkerQueueDropsH,
+	}, workerLbls)
+	workerTxtCorrection = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: metrics.ServerTxtCorrectionN,
+		Help: metrics.ServerTxtCorrectionH,
+	}, workerLbls)
+)
+
+func init() {
+	workers.Store(&workerConfig{numWorkers: defaultNumWorkers, batchSize: 1})
+}
+
+// SetWorkers sets the number of worker goroutines per server. If pinCPUs is
+// set, each worker is locked to an OS thread bound to one CPU.
+func SetWorkers(numWorkers int, pinCPUs bool) {
+	if numWorkers <= 0 {
+		panic("invalid number of workers")
+	}
+	c := *workers.Load()
+	c.numWorkers = numWorkers
+	c.pinCPUs = pinCPUs
+	workers.Store(&c)
+}
+
+// SetBatching configures the IP server workers to receive and send up to
+// batchSize packets per system call (recvmmsg/sendmmsg on Linux) and to busy
+// poll for up to busyPoll while waiting for packets. A batchSize of 1 and a
+// busyPoll of 0 disable these modes.
+func SetBatching(batchSize int, busyPoll time.Duration) {
+	if batchSize <= 0 {
+		panic("invalid batch size")
+	}
+	if busyPoll < 0 {
+		panic("invalid busy poll duration")
+	}
+	c := *workers.Load()
+	c.batchSize = batchSize
+	c.busyPoll = busyPoll
+	workers.Store(&c)
+}
+
+// SetGRO configures the IP server workers to receive packets with generic
+// receive offload where supported. Coalesced packets are served by the batch
+// mode workers, also with a batch size of 1. Responses are still sent one by
+// one: each carries its own transmit timestamp, so they cannot be coalesced
+// with generic segmentation offload, which only the benchmark tool uses, see
+// also broadcast.go.
+func SetGRO(enabled bool) {
+	c := *workers.Load()
+	c.gro = enabled
+	workers.Store(&c)
+}
+
+// SetRequestQueue configures the SCION server workers to queue received
+// requests in a bounded queue of length queueLen, from which they are
+// processed by numProcs goroutines per worker (default 4 if 0). If the queue is
+// full, the oldest queued request is dropped. A queueLen of 0 disables the
+// queue and requests are processed serially by each worker.
+func SetRequestQueue(queueLen, numProcs int) {
+	if queueLen < 0 {
+		panic("invalid request queue length")
+	}
+	if numProcs < 0 {
+		panic("invalid number of request queue workers")
+	}
+	if numProcs == 0 {
+		numProcs = defaultNumQueueWorkers
+	}
+	c := *workers.Load()
+	c.queueLen = queueLen
+	c.queueProcs = numProcs
+	workers.Store(&c)
+}
+
+func numWorkers() int {
+	return workers.Load().numWorkers
+}
+
+func batchSize() int {
+	return workers.Load().batchSize
+}
+
+func busyPoll() time.Duration {
+	return workers.Load().busyPoll
+}
+
+func groEnabled() bool {
+	return workers.Load().gro
+}
+
+func requestQueueConfig() (queueLen, numProcs int) {
+	c := workers.Load()
+	return c.queueLen, c.queueProcs
+}
+
+func newWorkerMetrics(server string, worker int) *workerMetrics {
+	w := strconv.Itoa(worker)
+	return &workerMetrics{
+		pktsReceived: workerPktsReceived.WithLabelValues(server, w),
+		reqsServed:   workerReqsServed.WithLabelValues(server, w),
+		queueDrops:   workerQueueDrops.WithLabelValues(server, w),
+		txCorrection: workerTxtCorrection.WithLabelValues(server, w),
+	}
+}
+
+// startWorker prepares the calling goroutine to run worker number worker.
+func startWorker(log *zap.Logger, worker int) {
+	if !workers.Load().pinCPUs {
+		return
+	}
+	runtime.LockOSThread()
+	cpu := worker % runtime.NumCPU()
+	err := pinCPU(cpu)
+	if err != nil {
+		log.Info("failed to pin worker to CPU",
+			zap.Int("worker", worker), zap.Int("cpu", cpu), zap.Error(err))
+	}
+}
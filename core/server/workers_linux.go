@@ -0,0 +1,13 @@
+//go:build linux
+
+package server
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+func pinCPU(cpu int) error {
+	var set unix.CPUSet
+	set.Set(cpu)
+	return unix.SchedSetaffinity(0 /* calling thread */, &set)
+}
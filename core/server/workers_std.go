@@ -0,0 +1,13 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+)
+
+var errUnsupportedOperation = errors.New("unsupported operation")
+
+func pinCPU(cpu int) error {
+	return errUnsupportedOperation
+}
@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/audit"
+	"example.com/scion-time/core/timebase"
+)
+
+// auditedClock records all steps and adjustments of the local clock by a
+// discipline in the audit log.
+type auditedClock struct {
+	timebase.LocalClock
+	log        *zap.Logger
+	discipline string
+	round      uint64
+}
+
+func newAuditedClock(log *zap.Logger, lclk timebase.LocalClock, discipline string) *auditedClock {
+	return &auditedClock{LocalClock: lclk, log: log, discipline: discipline}
+}
+
+// nextRound starts the next sync round.
+func (c *auditedClock) nextRound() {
+	c.round++
+}
+
+func (c *auditedClock) record(op audit.Op, offset, duration time.Duration, frequency float64) {
+	err := audit.Record(audit.Entry{
+		Time:       c.LocalClock.Now(),
+		Op:         op,
+		Discipline: c.discipline,
+		Round:      c.round,
+		Offset:     offset,
+		Duration:   duration,
+		Frequency:  frequency,
+	})
+	if err != nil {
+		c.log.Error("failed to write audit log", zap.Error(err))
+	}
+}
+
+func (c *auditedClock) Step(offset time.Duration) {
+	c.record(audit.OpStep, offset, 0, 0)
+	c.LocalClock.Step(offset)
+}
+
+func (c *auditedClock) Adjust(offset, duration time.Duration, frequency float64) {
+	c.record(audit.OpAdjust, offset, duration, frequency)
+	c.LocalClock.Adjust(offset, duration, frequency)
+}
+
+// auditedDisciplinedClock records the steps and frequency adjustments of a
+// clock of the clock tree in the audit log. Unlike those of the local clock,
+// they may fail and are only recorded once applied.
+type auditedDisciplinedClock struct {
+	DisciplinedClock
+	log   *zap.Logger
+	round uint64
+}
+
+func newAuditedDisciplinedClock(log *zap.Logger, c DisciplinedClock) *auditedDisciplinedClock {
+	return &auditedDisciplinedClock{DisciplinedClock: c, log: log}
+}
+
+// nextRound starts the next round of the clock tree.
+func (c *auditedDisciplinedClock) nextRound() {
+	c.round++
+}
+
+func (c *auditedDisciplinedClock) record(op audit.Op, offset time.Duration, frequency float64) {
+	err := audit.Record(audit.Entry{
+		Time:       timebase.Now(),
+		Op:         op,
+		Discipline: treeDiscipline,
+		Clock:      c.DisciplinedClock.String(),
+		Round:      c.round,
+		Offset:     offset,
+		Frequency:  frequency,
+	})
+	if err != nil {
+		c.log.Error("failed to write audit log", zap.Error(err))
+	}
+}
+
+func (c *auditedDisciplinedClock) Step(offset time.Duration) error {
+	err := c.DisciplinedClock.Step(offset)
+	if err == nil {
+		c.record(audit.OpStep, offset, 0)
+	}
+	return err
+}
+
+func (c *auditedDisciplinedClock) SetFrequency(frequency float64) error {
+	err := c.DisciplinedClock.SetFrequency(frequency)
+	if err == nil {
+		c.record(audit.OpFrequency, 0, frequency)
+	}
+	return err
+}
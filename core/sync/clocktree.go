@@ -0,0 +1,116 @@
+package sync
+
+// Clock tree of secondary clocks, e.g., the PTP hardware clocks of several
+// network interfaces, that are disciplined to the local clock. Each clock has
+// its own PI servo, modeled after the servo of phc2sys from linuxptp: the
+// clock is stepped on the first update and on large offsets, otherwise its
+// frequency is adjusted.
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/base/timemath"
+)
+
+// DisciplinedClock is a clock that is disciplined to the local clock.
+type DisciplinedClock interface {
+	fmt.Stringer
+	// MeasureOffset returns the offset of the clock relative to the local
+	// clock.
+	MeasureOffset(ctx context.Context) (time.Duration, error)
+	Step(offset time.Duration) error
+	SetFrequency(frequency float64) error
+}
+
+const (
+	treeInterval      = 1 * time.Second
+	treeTimeout       = 500 * time.Millisecond
+	treeStepThreshold = 1 * time.Millisecond
+	treeKP            = 0.7
+	treeKI            = 0.3
+	treeMaxFrequency  = 500e-6
+
+	// Discipline of the clock tree in the audit log
+	treeDiscipline = "tree"
+)
+
+var treeOffset = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: metrics.SyncClockTreeOffsetN,
+	Help: metrics.SyncClockTreeOffsetH,
+}, []string{"clock"})
+
+type servo struct {
+	drift   float64
+	stepped bool
+}
+
+// update returns the step or the frequency adjustment of a clock with offset
+// off, measured treeInterval after the last update.
+func (s *servo) update(off time.Duration) (step time.Duration, freq float64) {
+	if !s.stepped || timemath.Abs(off) > treeStepThreshold {
+		s.stepped = true
+		return timemath.Inv(off), s.drift
+	}
+	x := timemath.Seconds(off)
+	s.drift = math.Max(-treeMaxFrequency, math.Min(s.drift-treeKI*x, treeMaxFrequency))
+	freq = math.Max(-treeMaxFrequency, math.Min(s.drift-treeKP*x, treeMaxFrequency))
+	return 0, freq
+}
+
+func disciplineClock(ctx context.Context, log *zap.Logger, c DisciplinedClock, s *servo) {
+	name := c.String()
+	ctx, cancel := context.WithTimeout(ctx, treeTimeout)
+	defer cancel()
+	off, err := c.MeasureOffset(ctx)
+	if err != nil {
+		log.Info("failed to measure clock offset", zap.String("clock", name), zap.Error(err))
+		return
+	}
+	treeOffset.WithLabelValues(name).Set(timemath.Seconds(off))
+	step, freq := s.update(off)
+	if step != 0 {
+		log.Debug("stepping clock", zap.String("clock", name), zap.Duration("offset", step))
+		err = c.Step(step)
+		if err != nil {
+			log.Info("failed to step clock", zap.String("clock", name), zap.Error(err))
+			s.stepped = false
+			return
+		}
+	}
+	err = c.SetFrequency(freq)
+	if err != nil {
+		log.Info("failed to adjust clock frequency", zap.String("clock", name), zap.Error(err))
+	}
+}
+
+// RunClockTree disciplines clks to the local clock until ctx is done.
+func RunClockTree(ctx context.Context, log *zap.Logger, clks []DisciplinedClock) {
+	servos := make([]servo, len(clks))
+	aclks := make([]*auditedDisciplinedClock, len(clks))
+	for i, c := range clks {
+		aclks[i] = newAuditedDisciplinedClock(log, c)
+	}
+	ticker := time.NewTicker(treeInterval)
+	defer ticker.Stop()
+	for {
+		for i, c := range aclks {
+			c.nextRound()
+			disciplineClock(ctx, log, c, &servos[i])
+		}
+		select {
+		case <-ctx.Done():
+			log.Info("stopped clock tree sync")
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package sync_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/audit"
+
+	"example.com/scion-time/core/sync"
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/driver/clock"
+)
+
+var errTestStep = errors.New("step failed")
+
+type fakeTreeClock struct {
+	off     time.Duration
+	stepErr error
+}
+
+func (c *fakeTreeClock) String() string {
+	return "/dev/ptp9"
+}
+
+func (c *fakeTreeClock) MeasureOffset(context.Context) (time.Duration, error) {
+	return c.off, nil
+}
+
+func (c *fakeTreeClock) Step(offset time.Duration) error {
+	if c.stepErr != nil {
+		return c.stepErr
+	}
+	c.off += offset
+	return nil
+}
+
+func (c *fakeTreeClock) SetFrequency(float64) error {
+	return nil
+}
+
+func TestClockTreeAudit(t *testing.T) {
+	timebase.RegisterClockIfUnset(&clock.SystemClock{Log: zap.NewNop()})
+	ctx := context.Background()
+	since := uint64(0)
+	if es := audit.Entries(0); len(es) != 0 {
+		since = es[len(es)-1].Seq + 1
+	}
+
+	fail := &fakeTreeClock{off: 5 * time.Millisecond, stepErr: errTestStep}
+	sync.NewTreeClock(fail).Discipline(ctx)
+	if es := audit.Entries(since); len(es) != 0 {
+		t.Fatalf("failed step recorded: %v", es)
+	}
+
+	c := &fakeTreeClock{off: 5 * time.Millisecond}
+	tc := sync.NewTreeClock(c)
+	tc.Discipline(ctx)
+	c.off = 10 * time.Microsecond
+	tc.Discipline(ctx)
+
+	es := audit.Entries(since)
+	want := []struct {
+		op     audit.Op
+		round  uint64
+		offset time.Duration
+	}{
+		{audit.OpStep, 1, -5 * time.Millisecond},
+		{audit.OpFrequency, 1, 0},
+		{audit.OpFrequency, 2, 0},
+	}
+	if len(es) != len(want) {
+		t.Fatalf("Entries = %v; want %d entries", es, len(want))
+	}
+	for i, w := range want {
+		e := es[i]
+		if e.Op != w.op || e.Round != w.round || e.Offset != w.offset ||
+			e.Clock != c.String() || e.Discipline != "tree" {
+			t.Errorf("entry %d = %+v; want %s in round %d with offset %v", i, e, w.op, w.round, w.offset)
+		}
+	}
+}
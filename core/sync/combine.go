@@ -0,0 +1,109 @@
+package sync
+
+// Weighted combination of the offsets of the reference clocks and peers: the
+// weighted median of the offsets, with the weights assigned by the client
+// filter, so that references with low delays influence the correction more.
+// The sum of the weights of the combined offsets is the weight of the
+// correction passed to the PLL.
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/timemath"
+)
+
+// defaultWeight is the PLL weight of corrections combined without filter
+// weights.
+const defaultWeight = 1000.0
+
+var weightedCombination atomic.Bool
+
+// SetWeightedCombination combines the offsets of the reference clocks and
+// peers by their weighted median instead of their median or fault tolerant
+// midpoint, see client.Weighting.
+func SetWeightedCombination(enabled bool) {
+	weightedCombination.Store(enabled)
+}
+
+// combineMedian returns the median of the offsets that are not outliers and
+// the indices of these offsets in offs.
+func combineMedian(log *zap.Logger, offs []timemath.FineDuration) (timemath.FineDuration, []int) {
+	used := fineInliers(log, offs)
+	xs := make([]timemath.FineDuration, len(used))
+	for j, i := range used {
+		xs[j] = offs[i]
+	}
+	return timemath.FineMedian(xs), used
+}
+
+// combineMidpoint returns the fault tolerant midpoint of the offsets that are
+// not outliers, see timemath.FaultTolerantMidpoint, and the indices of the
+// offsets in offs that remain after the lowest and highest offsets presumed
+// faulty are discarded.
+func combineMidpoint(log *zap.Logger, offs []time.Duration) (time.Duration, []int) {
+	idx := inliers(log, offs)
+	sort.SliceStable(idx, func(a, b int) bool {
+		return offs[idx[a]] < offs[idx[b]]
+	})
+	n := len(idx)
+	f := (n - 1) / 3
+	lo, hi := offs[idx[f]], offs[idx[n-1-f]]
+	return lo + (hi-lo)/2, idx[f : n-f]
+}
+
+// combineWeighted returns the weighted median of offs with weights ws after
+// outlier rejection, the indices of the offsets used, and the sum of their
+// weights. Offsets without filter weights, e.g., of hardware reference clocks,
+// count as much as the highest weighted offset. If no offset is weighted, the
+// weight of the median is defaultWeight.
+func combineWeighted(log *zap.Logger, offs []timemath.FineDuration, ws []float64) (
+	timemath.FineDuration, []int, float64) {
+	var max float64
+	for _, w := range ws {
+		if w > max {
+			max = w
+		}
+	}
+	for i, w := range ws {
+		if !(w > 0) {
+			ws[i] = max
+		}
+	}
+	used := fineInliers(log, offs)
+	xs := make([]timemath.FineDuration, len(used))
+	xws := make([]float64, len(used))
+	for j, i := range used {
+		xs[j], xws[j] = offs[i], ws[i]
+	}
+	m := timemath.FineWeightedMedian(xs, xws)
+	weight := defaultWeight
+	if max > 0 {
+		weight = 0
+		for _, w := range xws {
+			weight += w
+		}
+	}
+	log.Debug("combined weighted offsets",
+		zap.Int("count", len(xs)),
+		zap.Float64s("weights", xws),
+		zap.Float64("offset [s]", m.Seconds()),
+		zap.Float64("weight", weight),
+	)
+	return m, used, weight
+}
+
+// combineWeightedDurations is the variant of combineWeighted for offsets in
+// whole nanoseconds.
+func combineWeightedDurations(log *zap.Logger, offs []time.Duration, ws []float64) (
+	time.Duration, []int, float64) {
+	fs := make([]timemath.FineDuration, len(offs))
+	for i, off := range offs {
+		fs[i] = timemath.FineFromDuration(off)
+	}
+	m, used, weight := combineWeighted(log, fs, ws)
+	return m.Duration(), used, weight
+}
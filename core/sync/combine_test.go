@@ -0,0 +1,57 @@
+package sync_test
+
+import (
+	"testing"
+	"time"
+
+	"example.com/scion-time/core/sync"
+)
+
+func TestCombineWeighted(t *testing.T) {
+	const us = time.Microsecond
+	for _, tc := range []struct {
+		name       string
+		offs       []time.Duration
+		ws         []float64
+		wantOff    time.Duration
+		wantWeight float64
+	}{
+		{
+			name:       "weighted",
+			offs:       []time.Duration{300 * us, 100 * us, 200 * us},
+			ws:         []float64{10, 10, 1000},
+			wantOff:    200 * us,
+			wantWeight: 1020,
+		},
+		{
+			name:       "dominant",
+			offs:       []time.Duration{100 * us, 200 * us, 300 * us},
+			ws:         []float64{2000, 10, 10},
+			wantOff:    100 * us,
+			wantWeight: 2020,
+		},
+		{
+			// Unweighted offsets count as much as the highest weighted one
+			name:       "unweighted",
+			offs:       []time.Duration{0, 100 * us, 200 * us},
+			ws:         []float64{0, 10, 1000},
+			wantOff:    100 * us,
+			wantWeight: 2010,
+		},
+		{
+			name:       "none",
+			offs:       []time.Duration{100 * us, 300 * us, 200 * us},
+			ws:         []float64{0, 0, 0},
+			wantOff:    200 * us,
+			wantWeight: 1000,
+		},
+	} {
+		off, used, w := sync.CombineWeighted(tc.offs, tc.ws)
+		if off != tc.wantOff || w != tc.wantWeight {
+			t.Errorf("%s: CombineWeighted() = %v, %v; want %v, %v", tc.name, off, w, tc.wantOff, tc.wantWeight)
+		}
+		if len(used) != len(tc.offs) {
+			t.Errorf("%s: %d offsets used; want %d", tc.name, len(used), len(tc.offs))
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package sync
+
+// Cross-check of clock steps: a step exceeding a threshold is only applied if
+// the latest offsets measured from at least two independent sources, e.g., a
+// GNSS reference clock and a SCION peer, or two SCION peers reached via
+// disjoint paths, agree with it within a bound. Otherwise, the clock is held
+// and an alarm is raised, so that a single compromised server or link cannot
+// force a step. Independence is keyed on the source rather than the transport,
+// see client.Sample.Independent, so that a server reached via several
+// transports counts only once.
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/events"
+	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/base/timemath"
+
+	"example.com/scion-time/core/client"
+)
+
+const crossCheckMinSources = 2
+
+// CrossCheck requires steps larger than Threshold to be corroborated by the
+// offsets measured from independent sources within Bound. Only offsets
+// measured within MaxAge are considered.
+type CrossCheck struct {
+	Threshold time.Duration
+	Bound     time.Duration
+	MaxAge    time.Duration
+}
+
+var (
+	crossCheckMu sync.Mutex
+	crossCheck   *CrossCheck
+
+	stepsWithheld = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: metrics.SyncStepsWithheldN,
+		Help: metrics.SyncStepsWithheldH,
+	}, []string{"sync"})
+)
+
+// SetStepCrossCheck enables the cross-check of clock steps.
+func SetStepCrossCheck(c CrossCheck) {
+	if c.Threshold < 0 || c.Bound <= 0 || c.MaxAge <= 0 {
+		panic("invalid step cross-check")
+	}
+	crossCheckMu.Lock()
+	defer crossCheckMu.Unlock()
+	crossCheck = &c
+}
+
+// sampleSource returns the source of sample s for logging.
+func sampleSource(s client.Sample) string {
+	if s.IA != 0 {
+		return s.IA.String() + "," + s.Server
+	}
+	return s.Server
+}
+
+// corroboratingSources returns the largest set of pairwise independent
+// sources found among the samples of clks measured within maxAge before now
+// whose offsets are within bound of corr.
+func corroboratingSources(clks []client.ReferenceClock, corr, bound, maxAge time.Duration,
+	now time.Time) []string {
+	var ss []client.Sample
+	for _, c := range clks {
+		r, ok := c.(client.SampleReporter)
+		if !ok {
+			continue
+		}
+		s, ok := r.LastSample()
+		if !ok || s.Restored || s.Server == "" || now.Sub(s.Time) > maxAge {
+			continue
+		}
+		if timemath.Abs(s.Offset-corr) <= bound {
+			ss = append(ss, s)
+		}
+	}
+	sort.Slice(ss, func(i, j int) bool {
+		return sampleSource(ss[i]) < sampleSource(ss[j])
+	})
+	// Greedily extend the set starting from each sample, there are only few
+	var best []client.Sample
+	for i := range ss {
+		xs := []client.Sample{ss[i]}
+		for j := range ss {
+			independent := true
+			for _, x := range xs {
+				if !x.Independent(ss[j]) {
+					independent = false
+					break
+				}
+			}
+			if independent {
+				xs = append(xs, ss[j])
+			}
+		}
+		if len(xs) > len(best) {
+			best = xs
+		}
+	}
+	var xs []string
+	for _, s := range best {
+		xs = append(xs, sampleSource(s))
+	}
+	return xs
+}
+
+// stepCorroborated reports whether a step of the clock of sync name by corr
+// is corroborated by the sources of the instance at now. Withheld steps are
+// logged and recorded as events.
+func (s *SyncInstance) stepCorroborated(log *zap.Logger, name string, corr time.Duration, now time.Time) bool {
+	crossCheckMu.Lock()
+	cc := crossCheck
+	crossCheckMu.Unlock()
+	if cc == nil || timemath.Abs(corr) <= cc.Threshold {
+		return true
+	}
+	s.mu.Lock()
+	clks := append(append([]client.ReferenceClock{}, s.refClks...), s.netClks...)
+	s.mu.Unlock()
+	srcs := corroboratingSources(clks, corr, cc.Bound, cc.MaxAge, now)
+	if len(srcs) >= crossCheckMinSources {
+		return true
+	}
+	log.Warn("withholding clock step not corroborated by independent sources",
+		zap.String("sync", name),
+		zap.Duration("correction", corr),
+		zap.Strings("sources", srcs),
+	)
+	stepsWithheld.WithLabelValues(name).Inc()
+	events.Record(events.KindStepWithheld, name,
+		"step by %v corroborated by %d of %d required sources", corr, len(srcs), crossCheckMinSources)
+	return false
+}
@@ -0,0 +1,105 @@
+package sync_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/private/common"
+	"github.com/scionproto/scion/pkg/snet"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/sync"
+)
+
+func TestCorroboratingSources(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ia0 := addr.MustIAFrom(1, 0xff0000000110)
+	ia1 := addr.MustIAFrom(1, 0xff0000000111)
+	ia2 := addr.MustIAFrom(1, 0xff0000000112)
+	path := func(ifs ...snet.PathInterface) []snet.PathInterface { return ifs }
+	pi := func(ia addr.IA, id uint16) snet.PathInterface {
+		return snet.PathInterface{IA: ia, ID: common.IFIDType(id)}
+	}
+	sample := func(transport, server string, ia addr.IA, p []snet.PathInterface) client.ReferenceClock {
+		return &sourcePeer{s: client.Sample{
+			Time:      t0,
+			Offset:    time.Second,
+			Transport: transport,
+			Server:    server,
+			IA:        ia,
+			Path:      p,
+		}}
+	}
+	for _, tc := range []struct {
+		name string
+		clks []client.ReferenceClock
+		want []string
+	}{{
+		name: "single server via SCION datagrams and streams",
+		clks: []client.ReferenceClock{
+			sample(client.TransportSCION, "10.0.0.1", ia1, path(pi(ia0, 1), pi(ia1, 2))),
+			sample(client.TransportSCIONStream, "10.0.0.1", ia1, path(pi(ia0, 1), pi(ia1, 2))),
+		},
+		want: []string{"1-ff00:0:111,10.0.0.1"},
+	}, {
+		name: "single server via IP and SCION",
+		clks: []client.ReferenceClock{
+			sample(client.TransportIP, "10.0.0.1", 0, nil),
+			sample(client.TransportSCION, "10.0.0.1", ia1, path(pi(ia0, 1), pi(ia1, 2))),
+		},
+		want: []string{"1-ff00:0:111,10.0.0.1"},
+	}, {
+		name: "SCION peers via disjoint paths",
+		clks: []client.ReferenceClock{
+			sample(client.TransportSCION, "10.0.0.1", ia1, path(pi(ia0, 1), pi(ia1, 2))),
+			sample(client.TransportSCION, "10.0.0.2", ia2, path(pi(ia0, 3), pi(ia2, 4))),
+		},
+		want: []string{"1-ff00:0:111,10.0.0.1", "1-ff00:0:112,10.0.0.2"},
+	}, {
+		name: "SCION peers via shared link",
+		clks: []client.ReferenceClock{
+			sample(client.TransportSCION, "10.0.0.1", ia1, path(pi(ia0, 1), pi(ia1, 2))),
+			sample(client.TransportSCION, "10.0.0.2", ia2, path(pi(ia0, 1), pi(ia1, 2), pi(ia1, 5), pi(ia2, 4))),
+		},
+		want: []string{"1-ff00:0:111,10.0.0.1"},
+	}, {
+		name: "reference clock and SCION peer",
+		clks: []client.ReferenceClock{
+			sample(client.TransportRefClock, "/dev/mbgclock0", 0, nil),
+			sample(client.TransportSCION, "10.0.0.1", ia1, path(pi(ia0, 1), pi(ia1, 2))),
+			sample(client.TransportSCIONStream, "10.0.0.1", ia1, path(pi(ia0, 1), pi(ia1, 2))),
+		},
+		want: []string{"/dev/mbgclock0", "1-ff00:0:111,10.0.0.1"},
+	}} {
+		srcs := sync.CorroboratingSources(tc.clks, time.Second, time.Millisecond, time.Minute, t0)
+		if !reflect.DeepEqual(srcs, tc.want) {
+			t.Errorf("%s: CorroboratingSources = %v; want %v", tc.name, srcs, tc.want)
+		}
+	}
+}
+
+func TestStepCrossCheckSources(t *testing.T) {
+	defer sync.ClearStepCrossCheck()
+
+	t0 := time.Now()
+	sync.SetStepCrossCheck(sync.CrossCheck{Threshold: 0, Bound: time.Millisecond, MaxAge: time.Minute})
+	// A single server reached via two transports does not corroborate a step
+	peers := []client.ReferenceClock{
+		&sourcePeer{s: client.Sample{Time: t0, Offset: time.Second, Transport: client.TransportIP, Server: "10.0.0.1"}},
+		&sourcePeer{s: client.Sample{Time: t0, Offset: time.Second, Transport: client.TransportSCION, Server: "10.0.0.1",
+			IA: addr.MustIAFrom(1, 0xff0000000111)}},
+	}
+	s := newInstance(t, peers)
+	if stepped, withheld := s.DecideStep(time.Second, t0, true /* initial */); stepped || !withheld {
+		t.Errorf("DecideStep = %v, %v; want withheld step", stepped, withheld)
+	}
+
+	// A second server does
+	peers = append(peers, &sourcePeer{s: client.Sample{Time: t0, Offset: time.Second, Transport: client.TransportIP, Server: "10.0.0.2"}})
+	s = newInstance(t, peers)
+	if stepped, withheld := s.DecideStep(time.Second, t0, true /* initial */); !stepped || withheld {
+		t.Errorf("DecideStep = %v, %v; want corroborated step", stepped, withheld)
+	}
+}
@@ -0,0 +1,131 @@
+package sync
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/timebase"
+	"example.com/scion-time/net/ntp"
+)
+
+type History struct {
+	h *history
+}
+
+func NewHistory() *History {
+	return &History{newHistory(zap.NewNop(), "test", "source")}
+}
+
+func (h *History) Check(epoch uint64, off time.Duration, settled bool) bool {
+	return h.h.check(epoch, off, settled)
+}
+
+var (
+	UpdateReference      = updateReference
+	UpdateHoldover       = updateHoldover
+	CorroboratingSources = corroboratingSources
+)
+
+// ResetReference clears the selected sources, their quality, and orphan mode.
+func ResetReference() {
+	referenceMu.Lock()
+	defer referenceMu.Unlock()
+	localSource, globalSource, servedSource = selectedSource{}, selectedSource{}, selectedSource{}
+	localQuality, globalQuality = sourceQuality{}, sourceQuality{}
+	served = Quality{Class: QualityUnsynchronized}
+	orphanStratum, orphanThreshold = 0, 0
+}
+
+// FitFrequency fits a line through the phases measured at the times at.
+func FitFrequency(at []time.Time, phases []float64) (slope, se float64, ok bool) {
+	xs := make([]syntonizationSample, len(at))
+	for i := range at {
+		xs[i] = syntonizationSample{at: at[i], phase: phases[i]}
+	}
+	return fitFrequency(xs)
+}
+
+// SyntonizationMessage returns the syntonization message of a clock with
+// frequency correction freq and oscillator estimate est, if ok.
+func SyntonizationMessage(freq, est, skew float64, ok bool) ntp.Syntonization {
+	s := &syntonizer{freq: est, skew: skew, ok: ok}
+	return s.message(freq)
+}
+
+// TreeClock is a clock of the clock tree with its servo.
+type TreeClock struct {
+	c *auditedDisciplinedClock
+	s servo
+}
+
+func NewTreeClock(c DisciplinedClock) *TreeClock {
+	return &TreeClock{c: newAuditedDisciplinedClock(zap.NewNop(), c)}
+}
+
+// Discipline runs the next round of the clock tree for the clock.
+func (t *TreeClock) Discipline(ctx context.Context) {
+	t.c.nextRound()
+	disciplineClock(ctx, zap.NewNop(), t.c, &t.s)
+}
+
+// ClearStepCrossCheck disables the cross-check of clock steps.
+func ClearStepCrossCheck() {
+	crossCheckMu.Lock()
+	defer crossCheckMu.Unlock()
+	crossCheck = nil
+}
+
+// DecideStep reports whether the clock of the instance is stepped by corr at
+// now or whether the step is withheld.
+func (s *SyncInstance) DecideStep(corr time.Duration, now time.Time, initial bool) (stepped, withheld bool) {
+	return s.step(zap.NewNop(), "test", corr, now, initial)
+}
+
+// CombineWeighted returns the weighted median of offs with weights ws, the
+// indices of the offsets used, and the weight of the correction.
+func CombineWeighted(offs []time.Duration, ws []float64) (time.Duration, []int, float64) {
+	return combineWeightedDurations(zap.NewNop(), offs, ws)
+}
+
+// SelectRefClocks combines the measurement results rs of the reference clocks
+// of the instance and returns their selection states.
+func (s *SyncInstance) SelectRefClocks(rs []client.Measurement) (timemath.FineDuration, []string) {
+	n := 0
+	for _, r := range rs {
+		if r.Err == nil {
+			n++
+		}
+	}
+	copy(s.refClkResults, rs)
+	corr, _ := s.combineRefClockResults(zap.NewNop(), n)
+	return corr, selectionStates(s.refClks)
+}
+
+// SelectPeers combines samples of the peers clks with offsets offs, taken at
+// the current time of lclk, and returns the selection states of the peers.
+func SelectPeers(lclk timebase.LocalClock, clks []client.ReferenceClock, offs []time.Duration) (
+	time.Duration, []string) {
+	sched := newScheduler(zap.NewNop(), lclk, time.Second)
+	for i, c := range clks {
+		sched.peers[c] = &peer{
+			sample: peerSample{clk: c, off: offs[i], epoch: lclk.Epoch(), at: lclk.Now()},
+			ok:     true,
+		}
+	}
+	roundOffs, ws, _ := sched.offsets(clks, time.Second)
+	corr, _ := combinePeerOffsets(zap.NewNop(), "test", sched, clks, roundOffs, ws)
+	return corr, selectionStates(clks)
+}
+
+func selectionStates(clks []client.ReferenceClock) []string {
+	states := make([]string, len(clks))
+	for i, c := range clks {
+		sel, _ := selectionOf(c)
+		states[i] = sel.state
+	}
+	return states
+}
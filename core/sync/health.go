@@ -0,0 +1,65 @@
+package sync
+
+// Progress of the clock sync loops: first synchronization of the local clock
+// and liveness of the loops, e.g., for service manager notifications
+
+import (
+	"sync"
+	"time"
+
+	"example.com/scion-time/core/client"
+)
+
+// heartbeatGrace is the time a sync loop may exceed its expected round
+// duration before it is considered stalled.
+const heartbeatGrace = 10 * time.Second
+
+var (
+	syncedOnce sync.Once
+	synced     = make(chan struct{})
+
+	heartbeatMu sync.Mutex
+	heartbeats  = make(map[string]time.Time)
+)
+
+// Synchronized returns a channel that is closed as soon as the local clock has
+// been synchronized for the first time, i.e., after the initial step to the
+// reference clocks or after the first successful round of a sync loop.
+func Synchronized() <-chan struct{} {
+	return synced
+}
+
+func markSynchronized() {
+	syncedOnce.Do(func() {
+		close(synced)
+		client.ArmOffsetGate()
+	})
+}
+
+// heartbeat records that sync loop name is expected to complete its next
+// round within d.
+func heartbeat(name string, d time.Duration) {
+	heartbeatMu.Lock()
+	defer heartbeatMu.Unlock()
+	heartbeats[name] = time.Now().Add(d + heartbeatGrace)
+}
+
+func stopHeartbeat(name string) {
+	heartbeatMu.Lock()
+	defer heartbeatMu.Unlock()
+	delete(heartbeats, name)
+}
+
+// Alive reports whether all running sync loops have completed their rounds
+// in time.
+func Alive() bool {
+	now := time.Now()
+	heartbeatMu.Lock()
+	defer heartbeatMu.Unlock()
+	for _, deadline := range heartbeats {
+		if now.After(deadline) {
+			return false
+		}
+	}
+	return true
+}
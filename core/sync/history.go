@@ -0,0 +1,117 @@
+package sync
+
+// History of recent offsets with spike detection, modeled after the popcorn
+// spike suppressor of NTPv4, see RFC 5905, Appendix A.5.5.1: an offset that
+// deviates from the recent offsets by more than a multiple of their median
+// absolute deviation is ignored as a spike. If the deviation persists, e.g.,
+// because an upstream server has stepped its clock, the new offsets are
+// accepted as a step and the history restarts from them.
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/base/timemath"
+)
+
+const (
+	historyLen         = 16
+	historyMinLen      = 4                      // minimum number of offsets for spike detection
+	spikeGate          = 5.0                    // threshold in median absolute deviations
+	spikeMinDeviation  = 100 * time.Microsecond // lower bound of the deviation threshold
+	spikeLimit         = 3                      // number of consecutive spikes that make a step
+	historyCombinedKey = ""
+)
+
+var (
+	errOffsetSpike = errors.New("offset spike")
+
+	historyLbls   = []string{"sync", "source"}
+	spikesTotal   = promauto.NewCounterVec(prometheus.CounterOpts{Name: metrics.SyncSpikesN, Help: metrics.SyncSpikesH}, historyLbls)
+	stepsDetected = promauto.NewCounterVec(prometheus.CounterOpts{Name: metrics.SyncStepsDetectedN, Help: metrics.SyncStepsDetectedH}, historyLbls)
+)
+
+// history is a ring buffer of the recent offsets of a source, or of the
+// combined corrections of a sync loop if source is historyCombinedKey.
+type history struct {
+	log    *zap.Logger
+	sync   string
+	source string
+	epoch  uint64
+	offs   []time.Duration
+	next   int
+	spikes int
+}
+
+func newHistory(log *zap.Logger, sync, source string) *history {
+	return &history{log: log, sync: sync, source: source, offs: make([]time.Duration, 0, historyLen)}
+}
+
+func (h *history) reset(epoch uint64) {
+	h.epoch = epoch
+	h.offs = h.offs[:0]
+	h.next = 0
+	h.spikes = 0
+}
+
+func (h *history) add(off time.Duration) {
+	if len(h.offs) != historyLen {
+		h.offs = append(h.offs, off)
+	} else {
+		h.offs[h.next] = off
+	}
+	h.next = (h.next + 1) % historyLen
+}
+
+// check adds off, measured in clock epoch, to the history and reports whether
+// it is to be used, i.e., whether it is no spike. Offsets of earlier epochs
+// are discarded since the local clock has been stepped in the meantime. Until
+// the clock discipline has settled, the offsets are expected to change
+// systematically and no spikes are detected.
+func (h *history) check(epoch uint64, off time.Duration, settled bool) bool {
+	if epoch != h.epoch {
+		h.reset(epoch)
+	}
+	if settled && len(h.offs) >= historyMinLen {
+		offs := make([]time.Duration, len(h.offs))
+		copy(offs, h.offs)
+		m := timemath.Median(offs)
+		for i := range offs {
+			offs[i] = timemath.Abs(offs[i] - m)
+		}
+		gate := time.Duration(spikeGate * float64(timemath.Median(offs)))
+		if gate < spikeMinDeviation {
+			gate = spikeMinDeviation
+		}
+		if timemath.Abs(off-m) > gate {
+			h.spikes++
+			if h.spikes < spikeLimit {
+				h.log.Info("ignored offset spike",
+					zap.String("sync", h.sync),
+					zap.String("source", h.source),
+					zap.Duration("offset", off),
+					zap.Duration("median", m),
+				)
+				spikesTotal.WithLabelValues(h.sync, h.source).Inc()
+				return false
+			}
+			h.log.Warn("detected offset step",
+				zap.String("sync", h.sync),
+				zap.String("source", h.source),
+				zap.Duration("offset", off),
+				zap.Duration("median", m),
+			)
+			stepsDetected.WithLabelValues(h.sync, h.source).Inc()
+			h.reset(epoch)
+		}
+	}
+	h.spikes = 0
+	h.add(off)
+	return true
+}
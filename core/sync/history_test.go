@@ -0,0 +1,52 @@
+package sync_test
+
+import (
+	"testing"
+	"time"
+
+	"example.com/scion-time/core/sync"
+)
+
+func TestHistorySpikes(t *testing.T) {
+	h := sync.NewHistory()
+	for i := 0; i != 8; i++ {
+		if !h.Check(1, time.Duration(i%2)*time.Microsecond, true) {
+			t.Fatalf("offset %d rejected", i)
+		}
+	}
+	if h.Check(1, 10*time.Millisecond, true) {
+		t.Error("spike accepted")
+	}
+	if !h.Check(1, time.Microsecond, true) {
+		t.Error("offset after spike rejected")
+	}
+
+	// Persistent deviations are accepted as a step
+	for i := 0; i != 2; i++ {
+		if h.Check(1, 10*time.Millisecond, true) {
+			t.Errorf("spike %d accepted", i)
+		}
+	}
+	if !h.Check(1, 10*time.Millisecond, true) {
+		t.Error("step rejected")
+	}
+
+	// A new clock epoch restarts the history
+	h.Check(2, 0, true)
+	if !h.Check(2, 10*time.Millisecond, true) {
+		t.Error("offset rejected in new epoch")
+	}
+}
+
+func TestHistoryUnsettled(t *testing.T) {
+	// Converging offsets while the discipline settles are not spikes
+	for _, settled := range []bool{false, true} {
+		h := sync.NewHistory()
+		for i := 0; i != 4; i++ {
+			h.Check(1, 40*time.Millisecond, settled)
+		}
+		if ok := h.Check(1, time.Millisecond, settled); ok != !settled {
+			t.Errorf("settled = %v: Check() = %v; want %v", settled, ok, !settled)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package sync
+
+// Holdover on loss of all reference clocks and persistence of the estimated
+// frequency error in a drift file (same format as chrony's driftfile)
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/events"
+	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/core/report"
+	"example.com/scion-time/core/timebase"
+)
+
+const (
+	// Frequency tolerance, see RFC 5905, Section 7.3
+	holdoverDispersionRate = 15e-6
+
+	driftFileInterval = 1 * time.Hour
+	driftMax          = 500e-6
+)
+
+type holdover struct {
+	log    *zap.Logger
+	lclk   timebase.LocalClock
+	name   string
+	served bool // whether the holdover degrades the served clock quality
+	active bool
+	start  time.Time
+}
+
+var (
+	errInvalidDriftFile = errors.New("invalid drift file")
+
+	driftMu      sync.Mutex
+	driftFile    string
+	driftSavedAt time.Time
+
+	holdoverLbls       = []string{"sync"}
+	holdoverState      = promauto.NewGaugeVec(prometheus.GaugeOpts{Name: metrics.SyncHoldoverN, Help: metrics.SyncHoldoverH}, holdoverLbls)
+	holdoverDuration   = promauto.NewGaugeVec(prometheus.GaugeOpts{Name: metrics.SyncHoldoverDurationN, Help: metrics.SyncHoldoverDurationH}, holdoverLbls)
+	holdoverDispersion = promauto.NewGaugeVec(prometheus.GaugeOpts{Name: metrics.SyncHoldoverDispersionN, Help: metrics.SyncHoldoverDispersionH}, holdoverLbls)
+)
+
+// SetDriftFile sets the file in which the estimated frequency error of the
+// local clock is persisted.
+func SetDriftFile(name string) {
+	driftMu.Lock()
+	defer driftMu.Unlock()
+	driftFile = name
+}
+
+func loadDrift(name string) (float64, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return 0, err
+	}
+	fs := strings.Fields(string(b))
+	if len(fs) == 0 {
+		return 0, errInvalidDriftFile
+	}
+	ppm, err := strconv.ParseFloat(fs[0], 64)
+	if err != nil || math.IsNaN(ppm) || math.Abs(ppm*1e-6) > driftMax {
+		return 0, errInvalidDriftFile
+	}
+	return ppm * 1e-6, nil
+}
+
+func saveDrift(name string, freq float64) error {
+	tmp := name + ".tmp"
+	err := os.WriteFile(tmp, []byte(fmt.Sprintf("%.6f\n", freq*1e6)), 0o644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// restoreDrift initializes pll and lclk with the frequency error from the
+// drift file, if available.
+func restoreDrift(log *zap.Logger, lclk timebase.LocalClock, pll *pll) {
+	driftMu.Lock()
+	name := driftFile
+	driftMu.Unlock()
+	if name == "" {
+		return
+	}
+	freq, err := loadDrift(name)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Info("failed to load drift file", zap.String("file", name), zap.Error(err))
+		}
+		return
+	}
+	log.Info("loaded drift file", zap.String("file", name), zap.Float64("frequency", freq))
+	pll.i = freq
+	lclk.Adjust(0, 0, freq)
+}
+
+// persistDrift saves the frequency error estimated by pll at most once per
+// driftFileInterval unless force is set.
+func persistDrift(log *zap.Logger, pll *pll, now time.Time, force bool) {
+	if !pll.tracking() {
+		return
+	}
+	driftMu.Lock()
+	defer driftMu.Unlock()
+	if driftFile == "" {
+		return
+	}
+	if !force && !driftSavedAt.IsZero() && now.Sub(driftSavedAt) < driftFileInterval {
+		return
+	}
+	err := saveDrift(driftFile, pll.i)
+	if err != nil {
+		log.Info("failed to save drift file", zap.String("file", driftFile), zap.Error(err))
+		return
+	}
+	driftSavedAt = now
+}
+
+func newHoldover(log *zap.Logger, lclk timebase.LocalClock, name string, served bool) *holdover {
+	holdoverState.WithLabelValues(name).Set(0)
+	return &holdover{log: log, lclk: lclk, name: name, served: served}
+}
+
+// update keeps the local clock running at the last known frequency while no
+// reference clock is reachable.
+func (h *holdover) update(freq float64, interval time.Duration) {
+	now := h.lclk.Now()
+	if !h.active {
+		h.log.Warn("no reference clock reachable, entering holdover",
+			zap.String("sync", h.name), zap.Float64("frequency", freq))
+		h.active = true
+		h.start = now
+		events.Record(events.KindHoldoverEntry, h.name, "no reference clock reachable")
+		holdoverState.WithLabelValues(h.name).Set(1)
+		report.EnterHoldover(h.name, now)
+	}
+	d := timemath.Seconds(now.Sub(h.start))
+	holdoverDuration.WithLabelValues(h.name).Set(d)
+	holdoverDispersion.WithLabelValues(h.name).Set(holdoverDispersionRate * d)
+	if h.served {
+		updateHoldover(h.name == "global", now.Sub(h.start))
+	}
+	h.lclk.Adjust(0, interval, freq)
+}
+
+func (h *holdover) exit() {
+	if !h.active {
+		return
+	}
+	now := h.lclk.Now()
+	d := now.Sub(h.start)
+	h.log.Info("reference clock reachable, leaving holdover",
+		zap.String("sync", h.name), zap.Duration("duration", d))
+	events.Record(events.KindHoldoverExit, h.name, "reference clock reachable after %v", d)
+	h.active = false
+	report.ExitHoldover(h.name, now)
+	holdoverState.WithLabelValues(h.name).Set(0)
+	holdoverDuration.WithLabelValues(h.name).Set(0)
+	holdoverDispersion.WithLabelValues(h.name).Set(0)
+}
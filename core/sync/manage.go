@@ -0,0 +1,199 @@
+package sync
+
+// Runtime management of the clock synchronization: status of the reference
+// clocks and network peers, addition and removal of peers, and forced steps.
+// Except for forced steps, these apply to any sync instance.
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"example.com/scion-time/core/client"
+)
+
+// SourceStatus is the status of a reference clock (Global unset) or of a
+// network peer (Global set). Selection is the state of the source in the last
+// clock correction, see SelectionUsed, with the error that caused its
+// rejection, if any, in SelectionReason.
+type SourceStatus struct {
+	Name      string        `json:"name"`
+	Global    bool          `json:"global"`
+	Reachable bool          `json:"reachable"`
+	Stratum   uint8         `json:"stratum"`
+	RefID     uint32        `json:"refid"`
+	Time      time.Time     `json:"time,omitempty"`
+	Offset    time.Duration `json:"offset"`
+	Delay     time.Duration `json:"delay"`
+	Weight    float64       `json:"weight,omitempty"`
+	Transport string        `json:"transport,omitempty"`
+
+	Selection       string `json:"selection,omitempty"`
+	SelectionReason string `json:"selection_reason,omitempty"`
+}
+
+// TrackingStatus describes the source currently selected as the reference
+// for downstream clients.
+type TrackingStatus struct {
+	Synchronized bool    `json:"synchronized"`
+	Global       bool    `json:"global"`
+	Stratum      uint8   `json:"stratum"`
+	RefID        uint32  `json:"refid"`
+	StepPending  bool    `json:"step_pending"`
+	Quality      Quality `json:"quality"`
+}
+
+var (
+	errGlobalSyncDisabled = errors.New("global clock sync not enabled")
+	errPeerExists         = errors.New("peer already exists")
+	errUnknownPeer        = errors.New("unknown peer")
+)
+
+func clockName(c client.ReferenceClock) string {
+	if s, ok := c.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", c)
+}
+
+func sourceStatus(c client.ReferenceClock, global bool) SourceStatus {
+	st := SourceStatus{Name: clockName(c), Global: global}
+	if r, ok := c.(client.SourceReporter); ok {
+		src, ok := r.Source()
+		if ok {
+			st.Reachable = true
+			st.Stratum = src.Stratum
+			st.RefID = src.RefID
+		}
+	}
+	if r, ok := c.(client.SampleReporter); ok {
+		s, ok := r.LastSample()
+		if ok && !s.Restored {
+			st.Time = s.Time
+			st.Offset = s.Offset
+			st.Delay = s.Delay
+			st.Weight = s.Weight
+			st.Transport = s.Transport
+		}
+	}
+	if sel, ok := selectionOf(c); ok {
+		st.Selection = sel.state
+		st.SelectionReason = sel.reason
+	}
+	return st
+}
+
+// Sources returns the status of all reference clocks and network peers of the
+// default instance.
+func Sources() []SourceStatus {
+	return defaultInstance.Sources()
+}
+
+// Sources returns the status of all reference clocks and network peers of the
+// instance.
+func (s *SyncInstance) Sources() []SourceStatus {
+	s.mu.Lock()
+	rclks, nclks := s.refClks, s.netClks
+	s.mu.Unlock()
+
+	var ss []SourceStatus
+	for _, c := range rclks {
+		ss = append(ss, sourceStatus(c, false /* global */))
+	}
+	for _, c := range nclks {
+		if _, ok := c.(*localReferenceClock); ok {
+			continue
+		}
+		ss = append(ss, sourceStatus(c, true /* global */))
+	}
+	return ss
+}
+
+// Tracking returns the status of the currently selected source.
+func Tracking() TrackingStatus {
+	referenceMu.Lock()
+	best, _, global := bestSource()
+	q := served
+	referenceMu.Unlock()
+
+	var t TrackingStatus
+	if best.ok {
+		t.Synchronized = true
+		t.Global = global
+		t.Stratum = best.src.Stratum
+		t.RefID = best.src.RefID
+	}
+	t.Quality = q
+	stepMu.Lock()
+	t.StepPending = stepForced
+	stepMu.Unlock()
+	return t
+}
+
+// AddPeer adds c as a network peer to the global clock sync of the default
+// instance, see SyncInstance.AddPeer.
+func AddPeer(c client.ReferenceClock) error {
+	return defaultInstance.AddPeer(c)
+}
+
+// AddPeer adds c as a network peer to the global clock sync. Peers are
+// identified by their String method. Global clock sync must have been enabled
+// with at least one peer at startup.
+func (s *SyncInstance) AddPeer(c client.ReferenceClock) error {
+	name := clockName(c)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.netClks) == 0 {
+		return errGlobalSyncDisabled
+	}
+	for _, x := range s.netClks {
+		if clockName(x) == name {
+			return errPeerExists
+		}
+	}
+	// Keep the local reference clock last, netClks is replaced rather than
+	// modified in place since running measurements may still refer to it.
+	n := len(s.netClks)
+	clks := make([]client.ReferenceClock, 0, n+1)
+	clks = append(clks, s.netClks[:n-1]...)
+	clks = append(clks, c, s.netClks[n-1])
+	s.netClks = clks
+	return nil
+}
+
+// RemovePeer removes the network peer named name from the global clock sync
+// of the default instance.
+func RemovePeer(name string) error {
+	return defaultInstance.RemovePeer(name)
+}
+
+// RemovePeer removes the network peer named name from the global clock sync
+// and stops its background goroutines, if any.
+func (s *SyncInstance) RemovePeer(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.netClks {
+		if _, ok := c.(*localReferenceClock); ok {
+			continue
+		}
+		if clockName(c) == name {
+			clks := make([]client.ReferenceClock, 0, len(s.netClks)-1)
+			clks = append(clks, s.netClks[:i]...)
+			clks = append(clks, s.netClks[i+1:]...)
+			s.netClks = clks
+			if x, ok := c.(client.Stopper); ok {
+				x.Stop()
+			}
+			return nil
+		}
+	}
+	return errUnknownPeer
+}
+
+// ForceStep makes the next clock update step the clock, regardless of the
+// step policy.
+func ForceStep() {
+	stepMu.Lock()
+	defer stepMu.Unlock()
+	stepForced = true
+}
@@ -0,0 +1,60 @@
+package sync
+
+// Orphan mode: if all upstream sources have been lost for longer than a
+// threshold, the local clock is served as a source of its own at a degraded
+// stratum, similar to ntpd's orphan mode, so that clients in isolated networks
+// keep a common time.
+
+import (
+	"time"
+)
+
+const orphanRefID = 0x4c4f434c // "LOCL"
+
+var (
+	orphanStratum   uint8
+	orphanThreshold time.Duration
+)
+
+// SetOrphanMode enables orphan mode: after all sources have been lost for
+// threshold, stratum is served. It must be called before clock sync is started.
+func SetOrphanMode(stratum uint8, threshold time.Duration) {
+	if stratum == 0 || stratum > 15 || threshold < 0 {
+		panic("invalid orphan mode parameters")
+	}
+	referenceMu.Lock()
+	defer referenceMu.Unlock()
+	orphanStratum, orphanThreshold = stratum, threshold
+}
+
+// orphanQuality returns the quality served in orphan mode and reports whether
+// orphan mode is active, i.e., whether all syncs lost their sources for at
+// least orphanThreshold. It must be called with referenceMu held.
+func orphanQuality() (Quality, bool) {
+	if orphanStratum == 0 {
+		return Quality{}, false
+	}
+	var q sourceQuality
+	for _, x := range []struct {
+		src selectedSource
+		q   sourceQuality
+	}{
+		{localSource, localQuality},
+		{globalSource, globalQuality},
+	} {
+		if x.src.ok && !x.q.holdover {
+			return Quality{}, false
+		}
+		if x.q.holdover && x.q.holdoverFor > q.holdoverFor {
+			q = x.q
+		}
+	}
+	if !q.holdover || q.holdoverFor < orphanThreshold {
+		return Quality{}, false
+	}
+	return Quality{
+		Class:    QualityOrphan,
+		Stratum:  orphanStratum,
+		Accuracy: q.accuracy + q.dispersion,
+	}, true
+}
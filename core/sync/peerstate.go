@@ -0,0 +1,129 @@
+package sync
+
+// Persistence of the state of reference clocks and network peers in a peer
+// state file so that a restarting daemon converges quickly
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/client"
+)
+
+const peerStateInterval = 1 * time.Minute
+
+var (
+	peerStateMu      sync.Mutex
+	peerStateFile    string
+	peerStates       map[string]client.PeerState
+	peerStateSavedAt = make(map[string]time.Time)
+)
+
+// SetPeerStateFile sets the file in which the state of reference clocks and
+// network peers is persisted across restarts.
+func SetPeerStateFile(name string) {
+	peerStateMu.Lock()
+	defer peerStateMu.Unlock()
+	peerStateFile = name
+}
+
+func loadPeerStates(name string) (map[string]client.PeerState, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var ss map[string]client.PeerState
+	err = json.Unmarshal(b, &ss)
+	if err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+func savePeerStates(name string, ss map[string]client.PeerState) error {
+	b, err := json.Marshal(ss)
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	err = os.WriteFile(tmp, b, 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// loadedPeerStates returns the peer states from the peer state file, which is
+// read once. Must be called with peerStateMu held.
+func loadedPeerStates(log *zap.Logger) map[string]client.PeerState {
+	if peerStates == nil {
+		ss, err := loadPeerStates(peerStateFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Info("failed to load peer state file", zap.String("file", peerStateFile), zap.Error(err))
+		}
+		if ss == nil {
+			ss = make(map[string]client.PeerState)
+		}
+		peerStates = ss
+	}
+	return peerStates
+}
+
+// restorePeerStates restores the persisted state of clks.
+func restorePeerStates(log *zap.Logger, clks []client.ReferenceClock) {
+	peerStateMu.Lock()
+	defer peerStateMu.Unlock()
+	if peerStateFile == "" {
+		return
+	}
+	ss := loadedPeerStates(log)
+	var n int
+	for _, c := range clks {
+		k, ok := c.(client.PeerStateKeeper)
+		if !ok {
+			continue
+		}
+		s, ok := ss[clockName(c)]
+		if ok {
+			k.RestorePeerState(s)
+			n++
+		}
+	}
+	if n != 0 {
+		log.Info("loaded peer state file", zap.String("file", peerStateFile), zap.Int("peers", n))
+	}
+}
+
+// persistPeerStates saves the state of clks at most once per
+// peerStateInterval for each discipline unless force is set. The states of
+// peers that are not in clks, e.g., peers of other sync instances, are kept.
+func persistPeerStates(log *zap.Logger, discipline string, clks []client.ReferenceClock,
+	now time.Time, force bool) {
+	peerStateMu.Lock()
+	defer peerStateMu.Unlock()
+	if peerStateFile == "" {
+		return
+	}
+	t := peerStateSavedAt[discipline]
+	if !force && !t.IsZero() && now.Sub(t) < peerStateInterval {
+		return
+	}
+	ss := loadedPeerStates(log)
+	for _, c := range clks {
+		k, ok := c.(client.PeerStateKeeper)
+		if ok {
+			ss[clockName(c)] = k.PeerState()
+		}
+	}
+	err := savePeerStates(peerStateFile, ss)
+	if err != nil {
+		log.Info("failed to save peer state file", zap.String("file", peerStateFile), zap.Error(err))
+		return
+	}
+	peerStateSavedAt[discipline] = now
+}
@@ -8,31 +8,66 @@ import (
 
 	"go.uber.org/zap"
 
-	"example.com/scion-time/base/timebase"
 	"example.com/scion-time/base/timemath"
+
+	"example.com/scion-time/core/timebase"
 )
 
+const pllCaptureTime = 300 * time.Second
+
 type pll struct {
-	log     *zap.Logger
-	clk     timebase.LocalClock
-	epoch   uint64
-	mode    uint64
-	t0, t   time.Time
-	a, b, i float64
+	log      *zap.Logger
+	clk      timebase.LocalClock
+	estimate string // name of the published offset estimate, none if empty
+	epoch    uint64
+	mode     uint64
+	t0, t    time.Time
+	a, b, i  float64
+	steer    float64 // phase applied to the clock since steerAt, in seconds
+	steerAt  time.Time
 }
 
 func newPLL(log *zap.Logger, clk timebase.LocalClock) *pll {
 	return &pll{log: log, clk: clk}
 }
 
+func (l *pll) tracking() bool {
+	return l.mode == 3
+}
+
+// settled reports whether the PLL has been tracking for longer than the
+// capture time, after which offsets are expected to be centered around zero.
+func (l *pll) settled() bool {
+	return l.tracking() && l.t.Sub(l.t0) > pllCaptureTime
+}
+
+// steering returns the total phase, in seconds, that has been applied to the
+// clock by frequency and offset corrections up to now.
+func (l *pll) steering(now time.Time) float64 {
+	if !l.steerAt.IsZero() {
+		l.steer += l.i * timemath.Seconds(now.Sub(l.steerAt))
+	}
+	l.steerAt = now
+	return l.steer
+}
+
 func (l *pll) Do(offset time.Duration, weight float64) {
-	offset = timemath.Inv(offset)
+	l.DoFine(timemath.FineFromDuration(offset), weight)
+}
+
+// DoFine is the variant of Do for offsets with sub-nanosecond resolution,
+// which is retained in the proportional and integral terms. The phase
+// correction applied to the clock is rounded to whole nanoseconds.
+func (l *pll) DoFine(fine timemath.FineDuration, weight float64) {
+	fine = fine.Neg()
+	offset := fine.Duration()
 	if l.epoch != l.clk.Epoch() {
 		l.epoch = l.clk.Epoch()
 		l.mode = 0
 	}
 	var dt, p, d, a, b float64
 	now := l.clk.Now()
+	l.steering(now)
 	switch l.mode {
 	case 0: // startup
 		l.t0 = now
@@ -43,7 +78,7 @@ func (l *pll) Do(offset time.Duration, weight float64) {
 			panic("unexpected clock behavior")
 		}
 		if mdt > 2*time.Second && weight > 3 {
-			if timemath.Abs(offset) > 1*time.Millisecond {
+			if timemath.Abs(offset) > 1*time.Millisecond && initialStepEnabled() {
 				l.clk.Step(timemath.Inv(offset))
 			}
 			l.t0 = now
@@ -81,18 +116,17 @@ func (l *pll) Do(offset time.Duration, weight float64) {
 			b = 1e-3
 		} else {
 			const (
-				captureTime = 300 * time.Second
 				stiffenRate = 0.999
 				pLimit      = 0.03
 			)
-			if mdt > captureTime && l.a > pLimit {
+			if mdt > pllCaptureTime && l.a > pLimit {
 				l.a *= math.Pow(stiffenRate, dt)
 				l.b *= math.Pow(stiffenRate, dt)
 			}
 			a = l.a
 			b = l.b
 		}
-		p = timemath.Seconds(timemath.Inv(offset)) * a
+		p = fine.Neg().Seconds() * a
 		d = math.Ceil(dt)
 		l.i += p * b
 		if p > d*500e-6 {
@@ -108,7 +142,7 @@ func (l *pll) Do(offset time.Duration, weight float64) {
 	l.log.Debug("PLL iteration",
 		zap.Uint64("mode", l.mode),
 		zap.Float64("dt", dt),
-		zap.Float64("offset", timemath.Seconds(offset)),
+		zap.Float64("offset", fine.Seconds()),
 		zap.Float64("weight", weight),
 		zap.Float64("p", p),
 		zap.Float64("d", d),
@@ -118,5 +152,15 @@ func (l *pll) Do(offset time.Duration, weight float64) {
 	)
 	if d > 0.0 {
 		l.clk.Adjust(timemath.Duration(p), timemath.Duration(d), l.i)
+		l.steer += p
+		if l.estimate != "" {
+			timebase.UpdateOffsetEstimate(l.estimate, timebase.OffsetEstimate{
+				Epoch:      l.epoch,
+				Time:       now,
+				Offset:     timemath.Inv(offset),
+				Correction: timemath.Duration(p),
+				Duration:   timemath.Duration(d),
+			})
+		}
 	}
 }
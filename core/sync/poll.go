@@ -0,0 +1,148 @@
+package sync
+
+// Adaptive poll intervals, modeled after the poll adjustment of NTPv4, see
+// RFC 5905, Appendix A.5.5.7: the interval of a sync loop is doubled up to its
+// maximum while the corrections are small compared to their jitter and halved
+// down to its minimum otherwise or while the discipline is converging.
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/base/timemath"
+)
+
+// PollBounds are the bounds of the poll interval of a sync loop. Equal bounds
+// disable the adaptation.
+type PollBounds struct {
+	Min, Max time.Duration
+}
+
+type poller struct {
+	log      *zap.Logger
+	name     string
+	bounds   PollBounds
+	interval time.Duration
+	count    int
+	jitter   float64
+	prev     float64
+	ok       bool
+}
+
+const (
+	pollGate  = 4.0  // threshold for small corrections relative to jitter
+	pollLimit = 30   // poll adjustment hysteresis
+	pollAvg   = 4.0  // jitter averaging constant
+	minJitter = 1e-6 // lower bound of the jitter estimate in seconds
+)
+
+var (
+	errInvalidPollBounds = errors.New("invalid poll bounds")
+
+	pollMu          sync.Mutex
+	localPollBounds = PollBounds{Min: refClkInterval, Max: refClkInterval}
+	netPollBounds   = PollBounds{Min: netClkInterval, Max: netClkInterval}
+
+	pollInterval = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: metrics.SyncPollIntervalN,
+		Help: metrics.SyncPollIntervalH,
+	}, []string{"sync"})
+)
+
+// SetLocalPollBounds sets the bounds of the poll interval of the local clock
+// sync with the reference clocks. The minimum must be at least twice the
+// measurement timeout of 1s.
+func SetLocalPollBounds(b PollBounds) error {
+	if b.Min < 2*refClkTimeout || b.Max < b.Min {
+		return errInvalidPollBounds
+	}
+	pollMu.Lock()
+	defer pollMu.Unlock()
+	localPollBounds = b
+	return nil
+}
+
+// SetGlobalPollBounds sets the bounds of the poll interval of the global clock
+// sync with the network peers. The minimum must be at least twice the
+// measurement timeout of 5s.
+func SetGlobalPollBounds(b PollBounds) error {
+	if b.Min < 2*netClkTimeout || b.Min < refClkInterval || b.Max < b.Min {
+		return errInvalidPollBounds
+	}
+	pollMu.Lock()
+	defer pollMu.Unlock()
+	netPollBounds = b
+	return nil
+}
+
+func newPoller(log *zap.Logger, name string, b PollBounds) *poller {
+	p := &poller{log: log, name: name, bounds: b, interval: b.Min}
+	pollInterval.WithLabelValues(name).Set(timemath.Seconds(p.interval))
+	return p
+}
+
+// exp returns the log2 of the current interval in seconds, at least 1, which
+// weighs the adjustment count like the poll exponent in NTPv4.
+func (p *poller) exp() int {
+	e := int(math.Round(math.Log2(timemath.Seconds(p.interval))))
+	if e < 1 {
+		e = 1
+	}
+	return e
+}
+
+func (p *poller) setInterval(d time.Duration) {
+	if d < p.bounds.Min {
+		d = p.bounds.Min
+	}
+	if d > p.bounds.Max {
+		d = p.bounds.Max
+	}
+	if d != p.interval {
+		p.log.Debug("changed poll interval",
+			zap.String("sync", p.name),
+			zap.Duration("from", p.interval),
+			zap.Duration("to", d),
+		)
+		p.interval = d
+		pollInterval.WithLabelValues(p.name).Set(timemath.Seconds(d))
+	}
+	p.count = 0
+}
+
+// update adapts the poll interval after a clock correction corr. While the
+// discipline is not tracking yet, the interval is kept at its minimum.
+func (p *poller) update(corr time.Duration, tracking bool) {
+	if p.bounds.Min == p.bounds.Max {
+		return
+	}
+	x := timemath.Seconds(corr)
+	if p.ok {
+		d := x - p.prev
+		p.jitter = math.Sqrt(p.jitter*p.jitter + (d*d-p.jitter*p.jitter)/pollAvg)
+	}
+	p.prev, p.ok = x, true
+	if !tracking {
+		p.setInterval(p.bounds.Min)
+		return
+	}
+	if math.Abs(x) < pollGate*math.Max(p.jitter, minJitter) {
+		p.count += p.exp()
+		if p.count > pollLimit {
+			p.setInterval(2 * p.interval)
+		}
+	} else {
+		p.count -= 2 * p.exp()
+		if p.count < -pollLimit {
+			p.setInterval(p.interval / 2)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package sync
+
+// Clock quality served to downstream clients: the stratum of the selected
+// source and the estimated accuracy of the local clock, derived from the last
+// samples of the sources. The accuracy is bounded by the smallest half round
+// trip delay among the sources plus half the spread of their offsets and is
+// served as root dispersion. While the sync that provides the selected source
+// is in holdover, or while it only has unauthenticated network sources, the
+// served stratum is increased by one; in holdover, the accuracy additionally
+// degrades at the frequency tolerance of the local clock. In orphan mode, the
+// configured orphan stratum is served instead.
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/base/timemath"
+
+	"example.com/scion-time/core/client"
+)
+
+// Quality classes
+const (
+	QualityUnsynchronized  = "unsynchronized"
+	QualityLocked          = "locked"
+	QualityUnauthenticated = "unauthenticated"
+	QualityHoldover        = "holdover"
+	QualityOrphan          = "orphan"
+)
+
+// Quality describes the clock quality served to downstream clients.
+type Quality struct {
+	Class    string        `json:"class"`
+	Stratum  uint8         `json:"stratum"`
+	Accuracy time.Duration `json:"accuracy"`
+}
+
+type sourceQuality struct {
+	accuracy      time.Duration
+	authenticated bool
+	holdover      bool
+	holdoverFor   time.Duration
+	dispersion    time.Duration
+}
+
+var (
+	qualityClasses = []string{
+		QualityUnsynchronized, QualityLocked, QualityUnauthenticated, QualityHoldover, QualityOrphan}
+
+	qualityAccuracy = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: metrics.SyncClockAccuracyN,
+		Help: metrics.SyncClockAccuracyH,
+	})
+	qualityClass = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: metrics.SyncClockClassN,
+		Help: metrics.SyncClockClassH,
+	}, []string{"class"})
+	qualityStratum = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: metrics.SyncClockStratumN,
+		Help: metrics.SyncClockStratumH,
+	})
+)
+
+// estimateQuality estimates the accuracy achievable with the sources of clks
+// and reports whether any of them is authenticated. Reference clocks without
+// samples, e.g., local hardware clocks, are assumed to be exact and trusted.
+func estimateQuality(clks []client.ReferenceClock) sourceQuality {
+	var q sourceQuality
+	var lo, hi time.Duration
+	n := 0
+	for _, c := range clks {
+		r, ok := c.(client.SourceReporter)
+		if !ok {
+			continue
+		}
+		if _, ok := r.Source(); !ok {
+			continue
+		}
+		acc := time.Duration(0)
+		if sr, ok := c.(client.SampleReporter); ok {
+			s, ok := sr.LastSample()
+			if !ok || s.Restored {
+				continue
+			}
+			acc = s.Delay / 2
+			if n == 0 || s.Offset < lo {
+				lo = s.Offset
+			}
+			if n == 0 || s.Offset > hi {
+				hi = s.Offset
+			}
+			q.authenticated = q.authenticated || s.Authenticated
+		} else {
+			q.authenticated = true
+		}
+		if n == 0 || acc < q.accuracy {
+			q.accuracy = acc
+		}
+		n++
+	}
+	q.accuracy += (hi - lo) / 2
+	return q
+}
+
+// servedQuality returns the quality of the source src with quality q.
+func servedQuality(src selectedSource, q sourceQuality) Quality {
+	if !src.ok {
+		return Quality{Class: QualityUnsynchronized}
+	}
+	x := Quality{
+		Class:    QualityLocked,
+		Stratum:  src.src.Stratum + 1,
+		Accuracy: q.accuracy,
+	}
+	if q.holdover {
+		x.Class = QualityHoldover
+		x.Stratum++
+		x.Accuracy += q.dispersion
+	} else if !q.authenticated {
+		x.Class = QualityUnauthenticated
+		x.Stratum++
+	}
+	return x
+}
+
+func exportQuality(q Quality) {
+	qualityAccuracy.Set(timemath.Seconds(q.Accuracy))
+	qualityStratum.Set(float64(q.Stratum))
+	for _, c := range qualityClasses {
+		v := 0.0
+		if c == q.Class {
+			v = 1.0
+		}
+		qualityClass.WithLabelValues(c).Set(v)
+	}
+}
@@ -0,0 +1,101 @@
+package sync_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/sync"
+)
+
+// sourcePeer is a reference clock with an upstream source and a last sample.
+type sourcePeer struct {
+	src client.Source
+	s   client.Sample
+}
+
+func (p *sourcePeer) MeasureClockOffset(context.Context, *zap.Logger) (time.Duration, error) {
+	return p.s.Offset, nil
+}
+
+func (p *sourcePeer) Source() (client.Source, bool) {
+	return p.src, true
+}
+
+func (p *sourcePeer) LastSample() (client.Sample, bool) {
+	return p.s, true
+}
+
+func TestQuality(t *testing.T) {
+	t.Cleanup(sync.ResetReference)
+	peers := []client.ReferenceClock{
+		&sourcePeer{
+			src: client.Source{Stratum: 2, RefID: 1},
+			s:   client.Sample{Offset: 100 * time.Microsecond, Delay: 2 * time.Millisecond, Authenticated: true},
+		},
+		&sourcePeer{
+			src: client.Source{Stratum: 1, RefID: 2},
+			s:   client.Sample{Offset: -100 * time.Microsecond, Delay: 4 * time.Millisecond},
+		},
+	}
+	for _, tc := range []struct {
+		name     string
+		peers    []client.ReferenceClock
+		holdover time.Duration
+		want     sync.Quality
+	}{{
+		name:  "locked",
+		peers: peers,
+		want:  sync.Quality{Class: sync.QualityLocked, Stratum: 2, Accuracy: 1100 * time.Microsecond},
+	}, {
+		name:  "unauthenticated",
+		peers: peers[1:],
+		want:  sync.Quality{Class: sync.QualityUnauthenticated, Stratum: 3, Accuracy: 2 * time.Millisecond},
+	}, {
+		name:     "holdover",
+		peers:    peers,
+		holdover: 100 * time.Second,
+		want:     sync.Quality{Class: sync.QualityHoldover, Stratum: 3, Accuracy: 2600 * time.Microsecond},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			sync.ResetReference()
+			sync.UpdateReference(tc.peers, true /* global */)
+			if tc.holdover != 0 {
+				sync.UpdateHoldover(true /* global */, tc.holdover)
+			}
+			if q := sync.Tracking().Quality; q != tc.want {
+				t.Errorf("quality = %+v; want %+v", q, tc.want)
+			}
+		})
+	}
+}
+
+func TestOrphanMode(t *testing.T) {
+	t.Cleanup(sync.ResetReference)
+	sync.ResetReference()
+	sync.SetOrphanMode(10, time.Minute)
+	peers := []client.ReferenceClock{&sourcePeer{
+		src: client.Source{Stratum: 1, RefID: 1},
+		s:   client.Sample{Delay: 2 * time.Millisecond, Authenticated: true},
+	}}
+	sync.UpdateReference(peers, true /* global */)
+
+	sync.UpdateHoldover(true /* global */, 30*time.Second)
+	if q := sync.Tracking().Quality; q.Class != sync.QualityHoldover {
+		t.Errorf("quality before orphan threshold = %+v; want class %s", q, sync.QualityHoldover)
+	}
+
+	sync.UpdateHoldover(true /* global */, 2*time.Minute)
+	want := sync.Quality{Class: sync.QualityOrphan, Stratum: 10, Accuracy: 1*time.Millisecond + 1800*time.Microsecond}
+	if q := sync.Tracking().Quality; q != want {
+		t.Errorf("quality after orphan threshold = %+v; want %+v", q, want)
+	}
+
+	sync.UpdateReference(peers, true /* global */)
+	if q := sync.Tracking().Quality; q.Class == sync.QualityOrphan {
+		t.Errorf("quality after recovery = %+v; want no orphan mode", q)
+	}
+}
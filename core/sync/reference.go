@@ -0,0 +1,130 @@
+package sync
+
+// Stratum, reference ID, and root dispersion served to downstream clients,
+// derived from the upstream sources of the reference clocks and network peers
+
+import (
+	"sync"
+	"time"
+
+	"example.com/scion-time/base/events"
+	"example.com/scion-time/base/timemath"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/server"
+
+	"example.com/scion-time/net/ntp"
+)
+
+type selectedSource struct {
+	src client.Source
+	ok  bool
+}
+
+var (
+	referenceMu  sync.Mutex
+	localSource  selectedSource
+	globalSource selectedSource
+	servedSource selectedSource
+
+	localQuality  sourceQuality
+	globalQuality sourceQuality
+	served        = Quality{Class: QualityUnsynchronized}
+)
+
+func selectSource(clks []client.ReferenceClock) selectedSource {
+	var sel selectedSource
+	for _, c := range clks {
+		r, ok := c.(client.SourceReporter)
+		if !ok {
+			continue
+		}
+		src, ok := r.Source()
+		if !ok {
+			continue
+		}
+		if !sel.ok || src.Stratum < sel.src.Stratum {
+			sel = selectedSource{src: src, ok: true}
+		}
+	}
+	return sel
+}
+
+// bestSource returns the source with the lowest stratum among the sources
+// selected by local and global sync, together with its quality.
+func bestSource() (selectedSource, sourceQuality, bool) {
+	if !localSource.ok || (globalSource.ok && globalSource.src.Stratum < localSource.src.Stratum) {
+		return globalSource, globalQuality, true
+	}
+	return localSource, localQuality, false
+}
+
+// updateReference selects the source with the lowest stratum among clks and
+// serves its stratum incremented by one together with its reference ID and
+// the estimated clock quality.
+func updateReference(clks []client.ReferenceClock, global bool) {
+	sel := selectSource(clks)
+	q := estimateQuality(clks)
+	referenceMu.Lock()
+	defer referenceMu.Unlock()
+	if global {
+		globalSource, globalQuality = sel, q
+	} else {
+		localSource, localQuality = sel, q
+	}
+	serveReference()
+}
+
+// updateHoldover degrades the quality of the local or global sync, which has
+// been in holdover for d.
+func updateHoldover(global bool, d time.Duration) {
+	referenceMu.Lock()
+	defer referenceMu.Unlock()
+	q := &localQuality
+	if global {
+		q = &globalQuality
+	}
+	q.holdover, q.holdoverFor = true, d
+	q.dispersion = timemath.Duration(holdoverDispersionRate * timemath.Seconds(d))
+	serveReference()
+}
+
+func serveReference() {
+	if x, ok := orphanQuality(); ok {
+		if served.Class != QualityOrphan {
+			events.Record(events.KindSourceSelection, "orphan",
+				"all sources lost, serving orphan stratum %d", x.Stratum)
+			servedSource = selectedSource{}
+		}
+		serveQuality(x, orphanRefID)
+		return
+	}
+	best, q, global := bestSource()
+	if !best.ok {
+		return
+	}
+	if best != servedSource {
+		kind := "local"
+		if global {
+			kind = "global"
+		}
+		events.Record(events.KindSourceSelection, kind,
+			"selected source with stratum %d and reference ID %08x", best.src.Stratum, best.src.RefID)
+		servedSource = best
+	}
+	serveQuality(servedQuality(best, q), best.src.RefID)
+}
+
+func serveQuality(x Quality, refID uint32) {
+	if x.Stratum > ntp.MaxStratum {
+		x.Stratum = ntp.MaxStratum
+	}
+	if x.Class != served.Class {
+		events.Record(events.KindQualityChange, "",
+			"clock quality changed from %s to %s", served.Class, x.Class)
+	}
+	served = x
+	exportQuality(x)
+	server.SetReference(x.Stratum, refID)
+	server.SetRootDispersion(x.Accuracy)
+}
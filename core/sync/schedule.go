@@ -0,0 +1,233 @@
+package sync
+
+// Measurement scheduling of the global clock sync: each network peer is
+// polled on its own timer, with the peers spread evenly over the poll
+// interval, and the latest sample of each peer is kept until it has been
+// combined. Measurements run asynchronously so that slow peers do not delay
+// the others, while the combined offset is corrected once per poll interval.
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/core/client"
+)
+
+type peerSample struct {
+	clk    client.ReferenceClock
+	off    time.Duration
+	weight float64 // filter weight, see client.SampleWeight
+	err    error
+	epoch  uint64 // of the local clock when the measurement started
+	at     time.Time
+}
+
+type peer struct {
+	due      time.Time
+	pending  bool
+	sample   peerSample
+	ok       bool
+	combined uint64 // round in which the sample has been combined, 0 if none
+	slot     int    // index of the sample among the offsets of that round
+	err      error  // of the last measurement
+	hist     *history
+}
+
+type scheduler struct {
+	log     *zap.Logger
+	lclk    timebase.LocalClock
+	timeout time.Duration
+	epoch   uint64
+	round   uint64
+	slots   int  // number of offsets of the current round
+	settled bool // whether spikes are to be detected, see history.check
+	peers   map[client.ReferenceClock]*peer
+	results chan peerSample
+	pending int
+}
+
+func newScheduler(log *zap.Logger, lclk timebase.LocalClock, timeout time.Duration) *scheduler {
+	return &scheduler{
+		log:     log,
+		lclk:    lclk,
+		timeout: timeout,
+		epoch:   lclk.Epoch(),
+		peers:   make(map[client.ReferenceClock]*peer),
+		results: make(chan peerSample),
+	}
+}
+
+// update synchronizes the scheduled peers with clks. New peers are spread
+// evenly over interval, as are all peers after a clock step, which
+// invalidates the scheduled times.
+func (s *scheduler) update(clks []client.ReferenceClock, interval time.Duration) {
+	now := s.lclk.Now()
+	if e := s.lclk.Epoch(); e != s.epoch {
+		s.epoch = e
+		i := 0
+		for _, p := range s.peers {
+			p.due = now.Add(interval * time.Duration(i) / time.Duration(len(s.peers)))
+			i++
+		}
+	}
+	active := make(map[client.ReferenceClock]struct{}, len(clks))
+	var added []client.ReferenceClock
+	for _, c := range clks {
+		if _, ok := c.(*localReferenceClock); ok {
+			continue
+		}
+		active[c] = struct{}{}
+		if _, ok := s.peers[c]; !ok {
+			added = append(added, c)
+		}
+	}
+	for c := range s.peers {
+		if _, ok := active[c]; !ok {
+			delete(s.peers, c)
+		}
+	}
+	for i, c := range added {
+		s.peers[c] = &peer{
+			due:  now.Add(interval * time.Duration(i) / time.Duration(len(added))),
+			hist: newHistory(s.log, "global", clockName(c)),
+		}
+	}
+}
+
+// launch starts the measurements of all peers that are due.
+func (s *scheduler) launch(ctx context.Context, interval time.Duration) {
+	now := s.lclk.Now()
+	for c, p := range s.peers {
+		if p.pending || p.due.After(now) {
+			continue
+		}
+		p.due = p.due.Add(interval)
+		if !p.due.After(now) {
+			p.due = now.Add(interval)
+		}
+		p.pending = true
+		s.pending++
+		go func(ctx context.Context, c client.ReferenceClock, epoch uint64) {
+			ctx, cancel := context.WithTimeout(ctx, s.timeout)
+			defer cancel()
+			off, err := c.MeasureClockOffset(ctx, s.log)
+			s.results <- peerSample{clk: c, off: off, weight: client.SampleWeight(c, err), err: err, epoch: epoch}
+		}(ctx, c, s.lclk.Epoch())
+	}
+}
+
+// next returns the time at which the next measurement is due.
+func (s *scheduler) next() (time.Time, bool) {
+	var t time.Time
+	for _, p := range s.peers {
+		if !p.pending && (t.IsZero() || p.due.Before(t)) {
+			t = p.due
+		}
+	}
+	return t, !t.IsZero()
+}
+
+// receive waits at most d for the result of a pending measurement.
+func (s *scheduler) receive(ctx context.Context, d time.Duration) (peerSample, bool) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case r := <-s.results:
+		s.pending--
+		r.at = s.lclk.Now()
+		p, ok := s.peers[r.clk]
+		if !ok {
+			// Peer has been removed in the meantime
+			return peerSample{}, false
+		}
+		p.pending = false
+		if r.epoch != s.lclk.Epoch() {
+			// The clock has been stepped during the measurement
+			return peerSample{}, false
+		}
+		if r.err == nil && !p.hist.check(r.epoch, r.off, s.settled) {
+			r.err = errOffsetSpike
+		}
+		if r.err == nil {
+			p.sample, p.ok, p.combined = r, true, 0
+		}
+		p.err = r.err
+		return r, true
+	case <-ctx.Done():
+		return peerSample{}, false
+	case <-timer.C:
+		return peerSample{}, false
+	}
+}
+
+// fresh reports whether the sample of p may be combined. Samples that have
+// already been combined, whose offsets have thus been corrected, samples
+// taken before a clock step, and samples older than maxAge are excluded.
+func (s *scheduler) fresh(p *peer, now time.Time, maxAge time.Duration) bool {
+	return p.ok && p.combined == 0 &&
+		p.sample.epoch == s.lclk.Epoch() && now.Sub(p.sample.at) <= maxAge
+}
+
+// offsets starts a new combining round and returns the offsets and filter
+// weights of the fresh samples of clks, see fresh, and the number of such
+// samples. The local reference clock is always included, without a weight.
+// Each sample is combined at most once.
+func (s *scheduler) offsets(clks []client.ReferenceClock, maxAge time.Duration) (
+	[]time.Duration, []float64, int) {
+	s.round++
+	now := s.lclk.Now()
+	var offs []time.Duration
+	var ws []float64
+	n := 0
+	for _, c := range clks {
+		if _, ok := c.(*localReferenceClock); ok {
+			offs = append(offs, 0)
+			ws = append(ws, 0)
+			continue
+		}
+		p, ok := s.peers[c]
+		if !ok || !s.fresh(p, now, maxAge) {
+			continue
+		}
+		p.combined, p.slot = s.round, len(offs)
+		offs = append(offs, p.sample.off)
+		ws = append(ws, p.sample.weight)
+		n++
+	}
+	s.slots = len(offs)
+	return offs, ws, n
+}
+
+// status returns the index of the sample of c among the offsets of the
+// current round, or the error of the last measurement of c if it failed or no
+// sample of c has been combined. The result is only valid if c has been
+// measured at least once.
+func (s *scheduler) status(c client.ReferenceClock) (
+	slot int, measured bool, err error) {
+	p, ok := s.peers[c]
+	if !ok || (!p.ok && p.err == nil) {
+		return 0, false, nil
+	}
+	if p.err != nil {
+		return 0, true, p.err
+	}
+	if p.combined != s.round {
+		return 0, true, errSampleExpired
+	}
+	return p.slot, true, nil
+}
+
+// stop discards the results of the measurements still in progress.
+func (s *scheduler) stop() {
+	go func(n int) { // drain channel
+		for n != 0 {
+			<-s.results
+			n--
+		}
+	}(s.pending)
+	s.pending = 0
+}
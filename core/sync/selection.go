@@ -0,0 +1,145 @@
+package sync
+
+// Source selection status: whether the reference clocks and network peers
+// contributed to the last clock correction of their sync, or why they were
+// rejected, similar to the source states reported by chronyc sources.
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/core/client"
+)
+
+// Selection states of a source in the last clock correction of its sync.
+const (
+	SelectionUsed        = "used"         // contributed to the correction
+	SelectionOutlier     = "outlier"      // rejected as outlier or offset spike
+	SelectionStale       = "stale"        // no unexpired sample
+	SelectionTimeout     = "timeout"      // no valid response in time
+	SelectionAuthFailure = "auth_failure" // response failed authentication
+	SelectionKoD         = "kod"          // denied or rate limited by the server
+	SelectionError       = "error"        // measurement failed otherwise
+)
+
+type selection struct {
+	state  string
+	reason string
+}
+
+var (
+	errSampleExpired = errors.New("sample expired")
+
+	selectionMu sync.Mutex
+	selections  = make(map[client.ReferenceClock]selection)
+
+	selectionLbls    = []string{"sync", "source"}
+	sourceSelected   = promauto.NewGaugeVec(prometheus.GaugeOpts{Name: metrics.SyncSourceSelectedN, Help: metrics.SyncSourceSelectedH}, selectionLbls)
+	sourceRejections = promauto.NewCounterVec(prometheus.CounterOpts{Name: metrics.SyncSourceRejectionsN, Help: metrics.SyncSourceRejectionsH},
+		append(selectionLbls, "reason"))
+)
+
+// selectionState returns the selection state of a source whose last
+// measurement failed with err.
+func selectionState(err error) string {
+	switch {
+	case errors.Is(err, errOffsetSpike):
+		return SelectionOutlier
+	case errors.Is(err, errSampleExpired):
+		return SelectionStale
+	case errors.Is(err, client.ErrTimeout):
+		return SelectionTimeout
+	case errors.Is(err, client.ErrAuthFailed):
+		return SelectionAuthFailure
+	case errors.Is(err, client.ErrKoD):
+		return SelectionKoD
+	default:
+		return SelectionError
+	}
+}
+
+func recordSelection(discipline string, c client.ReferenceClock, err error, used bool) {
+	var sel selection
+	switch {
+	case err != nil:
+		sel.state = selectionState(err)
+		sel.reason = err.Error()
+	case used:
+		sel.state = SelectionUsed
+	default:
+		sel.state = SelectionOutlier
+	}
+	selectionMu.Lock()
+	selections[c] = sel
+	selectionMu.Unlock()
+
+	name := clockName(c)
+	if sel.state == SelectionUsed {
+		sourceSelected.WithLabelValues(discipline, name).Set(1)
+	} else {
+		sourceSelected.WithLabelValues(discipline, name).Set(0)
+		sourceRejections.WithLabelValues(discipline, name, sel.state).Inc()
+	}
+}
+
+func selectionOf(c client.ReferenceClock) (selection, bool) {
+	selectionMu.Lock()
+	defer selectionMu.Unlock()
+	sel, ok := selections[c]
+	return sel, ok
+}
+
+// usedIndices returns whether each of n combined offsets is among the offsets
+// with the indices used.
+func usedIndices(n int, used []int) []bool {
+	u := make([]bool, n)
+	for _, i := range used {
+		u[i] = true
+	}
+	return u
+}
+
+// recordRefClockSelections records the selection states of the reference
+// clocks of the instance after a round in which the offsets of the successful
+// measurements were combined, in the order of the reference clocks, and those
+// with the indices used contributed to the correction.
+func (s *SyncInstance) recordRefClockSelections(discipline string, used []int) {
+	var n int
+	for _, r := range s.refClkResults {
+		if r.Err == nil {
+			n++
+		}
+	}
+	u := usedIndices(n, used)
+	j := 0
+	for i, c := range s.refClks {
+		r := s.refClkResults[i]
+		if r.Err != nil {
+			recordSelection(discipline, c, r.Err, false)
+			continue
+		}
+		recordSelection(discipline, c, nil, u[j])
+		j++
+	}
+}
+
+// recordPeerSelections records the selection states of the network peers clks
+// after a round in which the offsets returned by sched.offsets were combined
+// and those with the indices used contributed to the correction.
+func recordPeerSelections(discipline string, sched *scheduler, clks []client.ReferenceClock,
+	used []int) {
+	u := usedIndices(sched.slots, used)
+	for _, c := range clks {
+		if _, ok := c.(*localReferenceClock); ok {
+			continue
+		}
+		slot, ok, err := sched.status(c)
+		if ok {
+			recordSelection(discipline, c, err, err == nil && u[slot])
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package sync_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/sync"
+)
+
+func newSimPeers(n int) []client.ReferenceClock {
+	clks := make([]client.ReferenceClock, n)
+	for i := range clks {
+		clks[i] = &simPeer{name: fmt.Sprintf("peer-%d", i)}
+	}
+	return clks
+}
+
+func TestPeerSelections(t *testing.T) {
+	const ms = time.Millisecond
+	t.Cleanup(func() {
+		sync.SetOutlierThreshold(0)
+	})
+	lclk := &simClock{now: time.Unix(0, 0)}
+	for _, tc := range []struct {
+		name     string
+		k        float64
+		offs     []time.Duration
+		wantCorr time.Duration
+		want     []string
+	}{
+		{
+			// The lowest and the highest offset are discarded as faulty
+			name:     "midpoint",
+			offs:     []time.Duration{4 * ms, 1 * ms, 3 * ms, 2 * ms},
+			wantCorr: 2500 * time.Microsecond,
+			want:     []string{sync.SelectionOutlier, sync.SelectionOutlier, sync.SelectionUsed, sync.SelectionUsed},
+		},
+		{
+			// Equal offsets are told apart by their sources
+			name:     "equal",
+			offs:     []time.Duration{1 * ms, 1 * ms, 2 * ms, 9 * ms},
+			wantCorr: 1500 * time.Microsecond,
+			want:     []string{sync.SelectionOutlier, sync.SelectionUsed, sync.SelectionUsed, sync.SelectionOutlier},
+		},
+		{
+			name:     "outlier",
+			k:        3,
+			offs:     []time.Duration{1 * ms, 2 * ms, 3 * ms, 1000 * ms, 4 * ms},
+			wantCorr: 2500 * time.Microsecond,
+			want: []string{sync.SelectionOutlier, sync.SelectionUsed, sync.SelectionUsed,
+				sync.SelectionOutlier, sync.SelectionOutlier},
+		},
+		{
+			name:     "single",
+			offs:     []time.Duration{7 * ms},
+			wantCorr: 7 * ms,
+			want:     []string{sync.SelectionUsed},
+		},
+	} {
+		sync.SetOutlierThreshold(tc.k)
+		clks := newSimPeers(len(tc.offs))
+		corr, got := sync.SelectPeers(lclk, clks, tc.offs)
+		if corr != tc.wantCorr {
+			t.Errorf("%s: correction = %v; want %v", tc.name, corr, tc.wantCorr)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: selections = %v; want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRefClockSelections(t *testing.T) {
+	const ms = time.Millisecond
+	sync.SetOutlierThreshold(3)
+	t.Cleanup(func() {
+		sync.SetOutlierThreshold(0)
+	})
+	off := func(d time.Duration) client.Measurement {
+		return client.Measurement{Offset: timemath.FineFromDuration(d)}
+	}
+	for _, tc := range []struct {
+		name     string
+		rs       []client.Measurement
+		wantCorr time.Duration
+		want     []string
+	}{
+		{
+			// Failed measurements do not shift the results of later ones
+			name:     "failed",
+			rs:       []client.Measurement{off(1 * ms), {Err: client.ErrTimeout}, off(3 * ms), off(50 * ms)},
+			wantCorr: 2 * ms,
+			want:     []string{sync.SelectionUsed, sync.SelectionTimeout, sync.SelectionUsed, sync.SelectionOutlier},
+		},
+		{
+			name:     "equal",
+			rs:       []client.Measurement{off(2 * ms), off(2 * ms), off(90 * ms), off(2 * ms)},
+			wantCorr: 2 * ms,
+			want:     []string{sync.SelectionUsed, sync.SelectionUsed, sync.SelectionOutlier, sync.SelectionUsed},
+		},
+	} {
+		s := sync.NewSyncInstance(fmt.Sprintf("%s-%s", t.Name(), tc.name), newSimPeers(len(tc.rs)), nil)
+		corr, got := s.SelectRefClocks(tc.rs)
+		if corr.Duration() != tc.wantCorr {
+			t.Errorf("%s: correction = %v; want %v", tc.name, corr.Duration(), tc.wantCorr)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: selections = %v; want %v", tc.name, got, tc.want)
+		}
+	}
+}
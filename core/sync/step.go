@@ -0,0 +1,132 @@
+package sync
+
+// Clock step policy, modeled after chrony's makestep and maxchange directives
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/timemath"
+)
+
+type StepMode int
+
+const (
+	// StepModeInitial steps the clock only once at startup.
+	StepModeInitial StepMode = iota
+	// StepModeThreshold steps the clock if the offset exceeds the threshold
+	// in one of the first Limit clock updates.
+	StepModeThreshold
+	// StepModeNever never steps the clock, offsets are only slewed.
+	StepModeNever
+)
+
+type StepPolicy struct {
+	Mode StepMode
+	// Threshold and Limit apply to StepModeThreshold. A negative Limit
+	// removes the restriction on the number of clock updates.
+	Threshold time.Duration
+	Limit     int
+	// If PanicThreshold is non-zero, corrections exceeding it are not applied
+	// and the service aborts after PanicIgnore such corrections have been
+	// ignored.
+	PanicThreshold time.Duration
+	PanicIgnore    int
+}
+
+var (
+	stepMu      sync.Mutex
+	stepPolicy  StepPolicy
+	stepUpdates int
+	stepPanics  int
+	stepForced  bool
+)
+
+func SetStepPolicy(p StepPolicy) {
+	switch p.Mode {
+	case StepModeInitial, StepModeNever:
+	case StepModeThreshold:
+		if p.Threshold < 0 {
+			panic("invalid step threshold")
+		}
+	default:
+		panic("unexpected step mode")
+	}
+	if p.PanicThreshold < 0 || p.PanicIgnore < 0 {
+		panic("invalid panic threshold")
+	}
+	stepMu.Lock()
+	defer stepMu.Unlock()
+	stepPolicy = p
+	stepUpdates = 0
+	stepPanics = 0
+}
+
+// acceptCorrection checks corr against the panic threshold and reports whether
+// it may be applied. The service is terminated once too many corrections have
+// been rejected.
+func acceptCorrection(log *zap.Logger, corr time.Duration) bool {
+	stepMu.Lock()
+	defer stepMu.Unlock()
+	if stepPolicy.PanicThreshold == 0 || timemath.Abs(corr) <= stepPolicy.PanicThreshold {
+		return true
+	}
+	if stepPanics == stepPolicy.PanicIgnore {
+		log.Fatal("clock correction exceeds panic threshold",
+			zap.Duration("correction", corr),
+			zap.Duration("threshold", stepPolicy.PanicThreshold))
+	}
+	stepPanics++
+	log.Warn("ignoring clock correction exceeding panic threshold",
+		zap.Duration("correction", corr),
+		zap.Duration("threshold", stepPolicy.PanicThreshold))
+	return false
+}
+
+// stepAllowed reports whether an offset of corr may be corrected by stepping
+// the clock. Each call counts as a clock update.
+func stepAllowed(corr time.Duration, initial bool) bool {
+	stepMu.Lock()
+	defer stepMu.Unlock()
+	n := stepUpdates
+	stepUpdates++
+	if stepForced {
+		stepForced = false
+		return true
+	}
+	return stepPolicyAllows(corr, initial, n)
+}
+
+// stepPermitted reports whether stepAllowed would permit a step by corr,
+// without counting a clock update or consuming a forced step.
+func stepPermitted(corr time.Duration, initial bool) bool {
+	stepMu.Lock()
+	defer stepMu.Unlock()
+	return stepForced || stepPolicyAllows(corr, initial, stepUpdates)
+}
+
+// stepPolicyAllows reports whether the step policy permits stepping the clock
+// by corr after n clock updates. stepMu must be held.
+func stepPolicyAllows(corr time.Duration, initial bool, n int) bool {
+	switch stepPolicy.Mode {
+	case StepModeInitial:
+		return initial
+	case StepModeThreshold:
+		return timemath.Abs(corr) > stepPolicy.Threshold &&
+			(stepPolicy.Limit < 0 || n < stepPolicy.Limit)
+	case StepModeNever:
+		return false
+	default:
+		panic("unexpected step mode")
+	}
+}
+
+// initialStepEnabled reports whether the clock may be stepped while the clock
+// discipline is starting up.
+func initialStepEnabled() bool {
+	stepMu.Lock()
+	defer stepMu.Unlock()
+	return stepPolicy.Mode != StepModeNever
+}
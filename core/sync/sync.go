@@ -2,18 +2,24 @@ package sync
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	"go.uber.org/zap"
 
+	"example.com/scion-time/base/events"
 	"example.com/scion-time/base/metrics"
-	"example.com/scion-time/base/timebase"
 	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/base/tracing"
+	"example.com/scion-time/core/timebase"
 
 	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/report"
 )
 
 const (
@@ -29,13 +35,40 @@ const (
 
 type localReferenceClock struct{}
 
-var (
+// SyncInstance disciplines a single local clock to its own set of reference
+// clocks and network peers. The default instance, set up with RegisterClocks,
+// disciplines the clock served to downstream clients. Further instances, e.g.,
+// for the clocks of containerized tenants, only discipline their local clock:
+// they neither select the served reference nor persist the drift, compensate
+// the temperature, or consume forced steps.
+type SyncInstance struct {
+	name    string
+	primary bool
+
+	mu            sync.Mutex
 	refClks       []client.ReferenceClock
-	refClkOffsets []time.Duration
+	refClkResults []client.Measurement
+	refClkOffsets []timemath.FineDuration
+	refClkWeights []float64
 	refClkClient  client.ReferenceClockClient
 	netClks       []client.ReferenceClock
-	netClkOffsets []time.Duration
-	netClkClient  client.ReferenceClockClient
+
+	stepUpdates int // guarded by stepMu
+}
+
+var (
+	defaultInstance = &SyncInstance{primary: true}
+
+	instancesMu sync.Mutex
+	instances   = make(map[string]*SyncInstance)
+
+	outlierMu sync.Mutex
+	outlierK  float64
+
+	instanceCorr = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: metrics.SyncInstanceCorrN,
+		Help: metrics.SyncInstanceCorrH,
+	}, []string{"instance", "sync"})
 )
 
 func (c *localReferenceClock) MeasureClockOffset(context.Context, *zap.Logger) (
@@ -43,36 +76,324 @@ func (c *localReferenceClock) MeasureClockOffset(context.Context, *zap.Logger) (
 	return 0, nil
 }
 
-func RegisterClocks(refClocks, netClocks []client.ReferenceClock) {
-	if refClks != nil || netClks != nil {
+func (s *SyncInstance) registerClocks(refClocks, netClocks []client.ReferenceClock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.refClks != nil || s.netClks != nil {
 		panic("reference clocks already registered")
 	}
 
-	refClks = refClocks
-	refClkOffsets = make([]time.Duration, len(refClks))
+	s.refClks = refClocks
+	s.refClkResults = make([]client.Measurement, len(s.refClks))
+	s.refClkOffsets = make([]timemath.FineDuration, len(s.refClks))
+	s.refClkWeights = make([]float64, len(s.refClks))
+
+	s.netClks = netClocks
+	if len(s.netClks) != 0 {
+		s.netClks = append(s.netClks, &localReferenceClock{})
+	}
+}
+
+// RegisterClocks sets the reference clocks and network peers of the default
+// instance.
+func RegisterClocks(refClocks, netClocks []client.ReferenceClock) {
+	defaultInstance.registerClocks(refClocks, netClocks)
+}
+
+// NewSyncInstance returns an additional instance named name which disciplines
+// a local clock to refClocks and netClocks independently of the default
+// instance.
+func NewSyncInstance(name string, refClocks, netClocks []client.ReferenceClock) *SyncInstance {
+	if name == "" {
+		panic("invalid sync instance name")
+	}
+	instancesMu.Lock()
+	defer instancesMu.Unlock()
+	if _, ok := instances[name]; ok {
+		panic("sync instance already exists")
+	}
+	s := &SyncInstance{name: name}
+	s.registerClocks(refClocks, netClocks)
+	instances[name] = s
+	return s
+}
+
+// Instance returns the additional instance named name, or the default
+// instance if name is empty.
+func Instance(name string) (*SyncInstance, bool) {
+	if name == "" {
+		return defaultInstance, true
+	}
+	instancesMu.Lock()
+	defer instancesMu.Unlock()
+	s, ok := instances[name]
+	return s, ok
+}
+
+// Name returns the name of the instance, which is empty for the default
+// instance.
+func (s *SyncInstance) Name() string {
+	return s.name
+}
+
+// discipline returns the name under which the local or global sync of the
+// instance is reported.
+func (s *SyncInstance) discipline(sync string) string {
+	if s.primary {
+		return sync
+	}
+	return s.name + "/" + sync
+}
+
+func (s *SyncInstance) corrGauge(sync string) prometheus.Gauge {
+	if !s.primary {
+		return instanceCorr.WithLabelValues(s.name, sync)
+	}
+	if sync == "local" {
+		return promauto.NewGauge(prometheus.GaugeOpts{
+			Name: metrics.SyncLocalCorrN,
+			Help: metrics.SyncLocalCorrH,
+		})
+	}
+	return promauto.NewGauge(prometheus.GaugeOpts{
+		Name: metrics.SyncGlobalCorrN,
+		Help: metrics.SyncGlobalCorrH,
+	})
+}
+
+func (s *SyncInstance) updateReference(clks []client.ReferenceClock, global bool) {
+	if s.primary {
+		updateReference(clks, global)
+	}
+}
+
+func (s *SyncInstance) markSynchronized() {
+	if s.primary {
+		markSynchronized()
+	}
+}
+
+func (s *SyncInstance) stepAllowed(corr time.Duration, initial bool) bool {
+	if s.primary {
+		return stepAllowed(corr, initial)
+	}
+	stepMu.Lock()
+	defer stepMu.Unlock()
+	n := s.stepUpdates
+	s.stepUpdates++
+	return stepPolicyAllows(corr, initial, n)
+}
+
+func (s *SyncInstance) stepPermitted(corr time.Duration, initial bool) bool {
+	if s.primary {
+		return stepPermitted(corr, initial)
+	}
+	stepMu.Lock()
+	defer stepMu.Unlock()
+	return stepPolicyAllows(corr, initial, s.stepUpdates)
+}
+
+// step reports whether the clock of sync name is to be stepped by corr, or
+// whether such a step is withheld as it is not corroborated. Only steps that
+// are not withheld count as clock updates and consume a forced step.
+func (s *SyncInstance) step(log *zap.Logger, name string, corr time.Duration, now time.Time, initial bool) (
+	stepped, withheld bool) {
+	if s.stepPermitted(corr, initial) && !s.stepCorroborated(log, name, corr, now) {
+		return false, true
+	}
+	return s.stepAllowed(corr, initial), false
+}
+
+func (s *SyncInstance) restoreDrift(log *zap.Logger, lclk timebase.LocalClock, pll *pll) {
+	if s.primary {
+		restoreDrift(log, lclk, pll)
+	}
+}
+
+func (s *SyncInstance) persistDrift(log *zap.Logger, pll *pll, now time.Time, force bool) {
+	if s.primary {
+		persistDrift(log, pll, now, force)
+	}
+}
+
+func (s *SyncInstance) restorePeerStates(log *zap.Logger, clks []client.ReferenceClock) {
+	if s.primary {
+		restorePeerStates(log, clks)
+	}
+}
+
+func (s *SyncInstance) persistPeerStates(log *zap.Logger, discipline string, clks []client.ReferenceClock,
+	now time.Time, force bool) {
+	if s.primary {
+		persistPeerStates(log, discipline, clks, now, force)
+	}
+}
 
-	netClks = netClocks
-	if len(netClks) != 0 {
-		netClks = append(netClks, &localReferenceClock{})
+func (s *SyncInstance) recordTemperature(log *zap.Logger, now time.Time, freq float64) {
+	if s.primary {
+		recordTemperature(log, now, freq)
 	}
-	netClkOffsets = make([]time.Duration, len(netClks))
 }
 
-func measureOffsetToRefClocks(log *zap.Logger, timeout time.Duration) time.Duration {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+func (s *SyncInstance) compensateTemperature(log *zap.Logger, freq float64) float64 {
+	if s.primary {
+		return compensateTemperature(log, freq)
+	}
+	return freq
+}
+
+// SetOutlierThreshold enables the rejection of offsets that are more than k
+// median absolute deviations away from the median before the offsets of the
+// reference clocks are combined. Outlier rejection is disabled if k is 0.
+func SetOutlierThreshold(k float64) {
+	if k < 0 {
+		panic("invalid outlier threshold")
+	}
+	outlierMu.Lock()
+	defer outlierMu.Unlock()
+	outlierK = k
+}
+
+func outlierThreshold() float64 {
+	outlierMu.Lock()
+	defer outlierMu.Unlock()
+	return outlierK
+}
+
+// inliers returns the indices of the offsets that are not rejected as
+// outliers, see SetOutlierThreshold.
+func inliers(log *zap.Logger, offs []time.Duration) []int {
+	k := outlierThreshold()
+	if k == 0 {
+		return allIndices(len(offs))
+	}
+	idx := timemath.Inliers(offs, k)
+	if len(idx) != len(offs) {
+		log.Debug("rejected outlier offsets", zap.Int("count", len(offs)-len(idx)))
+	}
+	return idx
+}
+
+func fineInliers(log *zap.Logger, offs []timemath.FineDuration) []int {
+	k := outlierThreshold()
+	if k == 0 {
+		return allIndices(len(offs))
+	}
+	idx := timemath.FineInliers(offs, k)
+	if len(idx) != len(offs) {
+		log.Debug("rejected outlier offsets", zap.Int("count", len(offs)-len(idx)))
+	}
+	return idx
+}
+
+func allIndices(n int) []int {
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	return idx
+}
+
+// sleep pauses for duration d on lclk and reports whether ctx is still active
+// afterwards.
+func sleep(ctx context.Context, lclk timebase.LocalClock, d time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		lclk.Sleep(d)
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-done:
+		return ctx.Err() == nil
+	}
+}
+
+func (s *SyncInstance) measureOffsetToRefClocks(ctx context.Context, log *zap.Logger, timeout time.Duration) (
+	timemath.FineDuration, float64, int) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	refClkClient.MeasureClockOffsets(ctx, log, refClks, refClkOffsets)
-	return timemath.Median(refClkOffsets)
+	n := s.refClkClient.MeasureClockOffsetResults(ctx, log, s.refClks, s.refClkResults)
+	corr, weight := s.combineRefClockResults(log, n)
+	return corr, weight, n
+}
+
+// combineRefClockResults combines the offsets of the n successful
+// measurements of the reference clocks and records their selection states.
+func (s *SyncInstance) combineRefClockResults(log *zap.Logger, n int) (timemath.FineDuration, float64) {
+	offs, ws := s.refClkOffsets[:0], s.refClkWeights[:0]
+	for _, r := range s.refClkResults {
+		if r.Err == nil {
+			offs = append(offs, r.Offset)
+			ws = append(ws, r.Weight)
+		}
+	}
+	var corr timemath.FineDuration
+	var used []int
+	weight := defaultWeight
+	if n != 0 {
+		if weightedCombination.Load() {
+			corr, used, weight = combineWeighted(log, offs, ws)
+		} else {
+			corr, used = combineMedian(log, offs)
+		}
+	}
+	s.recordRefClockSelections(s.discipline("local"), used)
+	return corr, weight
+}
+
+// combinePeerOffsets combines the offsets offs with weights ws returned by
+// sched.offsets for the network peers clks and records their selection states.
+func combinePeerOffsets(log *zap.Logger, name string, sched *scheduler, clks []client.ReferenceClock,
+	offs []time.Duration, ws []float64) (time.Duration, float64) {
+	var corr time.Duration
+	var used []int
+	weight := defaultWeight
+	if weightedCombination.Load() {
+		corr, used, weight = combineWeightedDurations(log, offs, ws)
+	} else {
+		corr, used = combineMidpoint(log, offs)
+	}
+	recordPeerSelections(name, sched, clks, used)
+	return corr, weight
 }
 
-func SyncToRefClocks(log *zap.Logger, lclk timebase.LocalClock) {
-	corr := measureOffsetToRefClocks(log, refClkTimeout)
-	if corr != 0 {
-		lclk.Step(corr)
+func SyncToRefClocks(ctx context.Context, log *zap.Logger, lclk timebase.LocalClock) {
+	defaultInstance.SyncToRefClocks(ctx, log, lclk)
+}
+
+// SyncToRefClocks steps lclk to the reference clocks of the instance once, if
+// permitted by the step policy.
+func (s *SyncInstance) SyncToRefClocks(ctx context.Context, log *zap.Logger, lclk timebase.LocalClock) {
+	name := s.discipline("local")
+	lclk = newAuditedClock(log, lclk, name)
+	fcorr, _, n := s.measureOffsetToRefClocks(ctx, log, refClkTimeout)
+	corr := fcorr.Duration()
+	if ctx.Err() != nil || n == 0 {
+		return
+	}
+	s.updateReference(s.refClks, false /* global */)
+	if corr != 0 && acceptCorrection(log, corr) {
+		stepped, withheld := s.step(log, name, corr, lclk.Now(), true /* initial */)
+		if withheld {
+			return
+		}
+		if stepped {
+			lclk.Step(corr)
+			events.Record(events.KindStep, name, "stepped clock by %v", corr)
+		}
 	}
+	s.markSynchronized()
+}
+
+func RunLocalClockSync(ctx context.Context, log *zap.Logger, lclk timebase.LocalClock) {
+	defaultInstance.RunLocalClockSync(ctx, log, lclk)
 }
 
-func RunLocalClockSync(log *zap.Logger, lclk timebase.LocalClock) {
+// RunLocalClockSync disciplines lclk to the reference clocks of the instance
+// until ctx is done.
+func (s *SyncInstance) RunLocalClockSync(ctx context.Context, log *zap.Logger, lclk timebase.LocalClock) {
 	if refClkImpact <= 1.0 {
 		panic("invalid reference clock impact factor")
 	}
@@ -82,38 +403,98 @@ func RunLocalClockSync(log *zap.Logger, lclk timebase.LocalClock) {
 	if refClkTimeout < 0 || refClkTimeout > refClkInterval/2 {
 		panic("invalid reference clock sync timeout")
 	}
-	maxCorr := refClkImpact * float64(lclk.MaxDrift(refClkInterval))
+	name := s.discipline("local")
+	pollMu.Lock()
+	poll := newPoller(log, name, localPollBounds)
+	pollMu.Unlock()
+	maxCorr := refClkImpact * float64(lclk.MaxDrift(poll.interval))
 	if maxCorr <= 0 {
 		panic("invalid reference clock max correction")
 	}
-	corrGauge := promauto.NewGauge(prometheus.GaugeOpts{
-		Name: metrics.SyncLocalCorrN,
-		Help: metrics.SyncLocalCorrH,
-	})
+	corrGauge := s.corrGauge("local")
+	aclk := newAuditedClock(log, lclk, name)
+	lclk = aclk
 	pll := newPLL(log, lclk)
+	if s.primary {
+		// Only the default instance disciplines the clock of timebase.Now
+		pll.estimate = name
+	}
+	s.restoreDrift(log, lclk, pll)
+	s.restorePeerStates(log, s.refClks)
+	hold := newHoldover(log, lclk, name, s.primary)
+	corrHist := newHistory(log, name, historyCombinedKey)
+	defer stopHeartbeat(name)
 	for {
+		aclk.nextRound()
+		heartbeat(name, refClkTimeout)
 		corrGauge.Set(0)
-		corr := measureOffsetToRefClocks(log, refClkTimeout)
-		if timemath.Abs(corr) > refClkCutoff {
-			if float64(timemath.Abs(corr)) > maxCorr {
-				corr = time.Duration(float64(timemath.Sign(corr)) * maxCorr)
+		rctx, span := tracing.StartSpan(ctx, "sync_round", attribute.String("sync", name))
+		fcorr, weight, n := s.measureOffsetToRefClocks(rctx, log, refClkTimeout)
+		corr := fcorr.Duration()
+		span.SetAttributes(attribute.Int("measurements", n))
+		if ctx.Err() != nil {
+			span.End()
+			break
+		}
+		if n == 0 {
+			hold.update(s.compensateTemperature(log, pll.i), poll.interval)
+		} else {
+			hold.exit()
+			s.updateReference(s.refClks, false /* global */)
+			report.Observe(name, lclk.Now(), corr)
+			var withheld bool
+			if corrHist.check(lclk.Epoch(), corr, pll.settled()) && acceptCorrection(log, corr) {
+				_, aspan := tracing.StartSpan(rctx, "adjust_clock", attribute.Int64("correction", int64(corr)))
+				var stepped bool
+				stepped, withheld = s.step(log, name, corr, lclk.Now(), false /* initial */)
+				poll.update(corr, pll.tracking() && !stepped && !withheld)
+				if withheld {
+					// Hold the clock until the step is corroborated
+				} else if stepped {
+					lclk.Step(corr)
+					events.Record(events.KindStep, name, "stepped clock by %v", corr)
+					corrGauge.Set(float64(corr))
+					client.ArmOffsetGate()
+				} else if timemath.Abs(corr) > refClkCutoff {
+					maxCorr = refClkImpact * float64(lclk.MaxDrift(poll.interval))
+					if float64(timemath.Abs(corr)) > maxCorr {
+						corr = time.Duration(float64(timemath.Sign(corr)) * maxCorr)
+						fcorr = timemath.FineFromDuration(corr)
+					}
+					// lclk.Adjust(corr, refClkInterval, 0)
+					pll.DoFine(fcorr, weight)
+					corrGauge.Set(float64(corr))
+				}
+				aspan.End()
+			}
+			s.persistDrift(log, pll, lclk.Now(), false /* force */)
+			s.persistPeerStates(log, name, s.refClks, lclk.Now(), false /* force */)
+			if pll.tracking() {
+				s.recordTemperature(log, lclk.Now(), pll.i)
+			}
+			if !withheld {
+				s.markSynchronized()
 			}
-			// lclk.Adjust(corr, refClkInterval, 0)
-			pll.Do(corr, 1000.0 /* weight */)
-			corrGauge.Set(float64(corr))
 		}
-		lclk.Sleep(refClkInterval)
+		span.End()
+		heartbeat(name, poll.interval+refClkTimeout)
+		if !sleep(ctx, lclk, poll.interval) {
+			break
+		}
 	}
+	s.persistDrift(log, pll, lclk.Now(), true /* force */)
+	s.persistPeerStates(log, name, s.refClks, lclk.Now(), true /* force */)
+	log.Info("stopped local clock sync", zap.String("sync", name))
 }
 
-func measureOffsetToNetClocks(log *zap.Logger, timeout time.Duration) time.Duration {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-	netClkClient.MeasureClockOffsets(ctx, log, netClks, netClkOffsets)
-	return timemath.FaultTolerantMidpoint(netClkOffsets)
+func RunGlobalClockSync(ctx context.Context, log *zap.Logger, lclk timebase.LocalClock) {
+	defaultInstance.RunGlobalClockSync(ctx, log, lclk)
 }
 
-func RunGlobalClockSync(log *zap.Logger, lclk timebase.LocalClock) {
+// RunGlobalClockSync disciplines lclk to the network peers of the instance
+// until ctx is done. Unlike RunLocalClockSync, it combines offsets in whole
+// nanoseconds, see package timemath.
+func (s *SyncInstance) RunGlobalClockSync(ctx context.Context, log *zap.Logger, lclk timebase.LocalClock) {
 	if netClkImpact <= 1.0 {
 		panic("invalid network clock impact factor")
 	}
@@ -126,26 +507,138 @@ func RunGlobalClockSync(log *zap.Logger, lclk timebase.LocalClock) {
 	if netClkTimeout < 0 || netClkTimeout > netClkInterval/2 {
 		panic("invalid network clock sync timeout")
 	}
-	maxCorr := netClkImpact * float64(lclk.MaxDrift(netClkInterval))
+	name := s.discipline("global")
+	pollMu.Lock()
+	poll := newPoller(log, name, netPollBounds)
+	pollMu.Unlock()
+	maxCorr := netClkImpact * float64(lclk.MaxDrift(poll.interval))
 	if maxCorr <= 0 {
 		panic("invalid network clock max correction")
 	}
-	corrGauge := promauto.NewGauge(prometheus.GaugeOpts{
-		Name: metrics.SyncGlobalCorrN,
-		Help: metrics.SyncGlobalCorrH,
-	})
+	corrGauge := s.corrGauge("global")
+	aclk := newAuditedClock(log, lclk, name)
+	lclk = aclk
 	pll := newPLL(log, lclk)
+	if s.primary {
+		pll.estimate = name
+	}
+	s.restoreDrift(log, lclk, pll)
+	s.mu.Lock()
+	peers := s.netClks
+	s.mu.Unlock()
+	s.restorePeerStates(log, peers)
+	hold := newHoldover(log, lclk, name, s.primary)
+	corrHist := newHistory(log, name, historyCombinedKey)
+	sched := newScheduler(log, lclk, netClkTimeout)
+	var synt *syntonizer
+	if s.primary {
+		synt = newSyntonizer(log)
+	}
+	defer sched.stop()
+	defer stopHeartbeat(name)
+	// Samples are collected as they arrive and combined once per poll
+	// interval.
+	prevRound := lclk.Now()
 	for {
+		nextRound := prevRound.Add(poll.interval)
+		s.mu.Lock()
+		clks := s.netClks
+		s.mu.Unlock()
+		sched.update(clks, poll.interval)
+		sched.settled = pll.settled()
+		sched.launch(ctx, poll.interval)
+		wait := nextRound.Sub(lclk.Now())
+		if t, ok := sched.next(); ok && t.Before(nextRound) {
+			wait = t.Sub(lclk.Now())
+		}
+		if wait < 0 {
+			wait = 0
+		}
+		heartbeat(name, wait+netClkTimeout)
+		if sched.pending != 0 {
+			r, ok := sched.receive(ctx, wait)
+			if ctx.Err() != nil {
+				break
+			}
+			if ok && r.err == nil && synt != nil {
+				synt.add(r.clk, r.epoch, r.at, r.off, pll.steering(r.at))
+			}
+		} else if !sleep(ctx, lclk, wait) {
+			break
+		}
+		now := lclk.Now()
+		if now.Before(nextRound) {
+			continue
+		}
+		aclk.nextRound()
+		offs, ws, n := sched.offsets(clks, poll.interval+netClkTimeout)
+		prevRound = now
+		if n == 0 {
+			// No fresh sample, the clock is only adjusted on loss of all peers
+			corrGauge.Set(0)
+			freq := pll.i
+			if synt != nil {
+				synt.reset()
+				synt.publish(false /* disciplined */, pll.i)
+				freq = synt.frequency(freq)
+			}
+			hold.update(s.compensateTemperature(log, freq), poll.interval)
+			continue
+		}
 		corrGauge.Set(0)
-		corr := measureOffsetToNetClocks(log, netClkTimeout)
-		if timemath.Abs(corr) > netClkCutoff {
-			if float64(timemath.Abs(corr)) > maxCorr {
-				corr = time.Duration(float64(timemath.Sign(corr)) * maxCorr)
+		_, span := tracing.StartSpan(ctx, "sync_round", attribute.String("sync", name))
+		span.SetAttributes(attribute.Int("measurements", n))
+		hold.exit()
+		s.updateReference(clks, true /* global */)
+		if synt != nil {
+			synt.update(clks)
+			synt.seed(pll, lclk.Now())
+		}
+		corr, weight := combinePeerOffsets(log, name, sched, clks, offs, ws)
+		report.Observe(name, lclk.Now(), corr)
+		var withheld bool
+		if corrHist.check(lclk.Epoch(), corr, pll.settled()) && acceptCorrection(log, corr) {
+			_, aspan := tracing.StartSpan(ctx, "adjust_clock", attribute.Int64("correction", int64(corr)))
+			var stepped bool
+			stepped, withheld = s.step(log, name, corr, lclk.Now(), false /* initial */)
+			poll.update(corr, pll.tracking() && !stepped && !withheld)
+			if withheld {
+				// Hold the clock until the step is corroborated
+			} else if stepped {
+				lclk.Step(corr)
+				events.Record(events.KindStep, name, "stepped clock by %v", corr)
+				corrGauge.Set(float64(corr))
+				client.ArmOffsetGate()
+				// Schedule the next round on the new time scale
+				prevRound = lclk.Now()
+			} else if timemath.Abs(corr) > netClkCutoff {
+				maxCorr = netClkImpact * float64(lclk.MaxDrift(poll.interval))
+				if float64(timemath.Abs(corr)) > maxCorr {
+					corr = time.Duration(float64(timemath.Sign(corr)) * maxCorr)
+				}
+				// lclk.Adjust(corr, netClkInterval, 0)
+				pll.Do(corr, weight)
+				corrGauge.Set(float64(corr))
 			}
-			// lclk.Adjust(corr, netClkInterval, 0)
-			pll.Do(corr, 1000.0 /* weight */)
-			corrGauge.Set(float64(corr))
+			aspan.End()
+		}
+		s.persistDrift(log, pll, lclk.Now(), false /* force */)
+		s.persistPeerStates(log, name, clks, lclk.Now(), false /* force */)
+		if pll.tracking() {
+			s.recordTemperature(log, lclk.Now(), pll.i)
+		}
+		if synt != nil {
+			synt.publish(pll.tracking(), pll.i)
+		}
+		if !withheld {
+			s.markSynchronized()
 		}
-		lclk.Sleep(netClkInterval)
+		span.End()
 	}
+	s.persistDrift(log, pll, lclk.Now(), true /* force */)
+	s.mu.Lock()
+	peers = s.netClks
+	s.mu.Unlock()
+	s.persistPeerStates(log, name, peers, lclk.Now(), true /* force */)
+	log.Info("stopped global clock sync", zap.String("sync", name))
 }
@@ -0,0 +1,241 @@
+package sync_test
+
+import (
+	"context"
+	"fmt"
+	gosync "sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/sync"
+)
+
+// simClock is a simulated local clock with an error relative to the reference
+// time. Sleep advances the simulated time instantly; once the simulated time
+// reaches end, done is called.
+type simClock struct {
+	mu      gosync.Mutex
+	epoch   uint64
+	now     time.Time
+	err     time.Duration // local clock time minus reference time
+	steps   []time.Duration
+	adjusts []time.Duration
+	end     time.Time
+	done    func()
+}
+
+func (c *simClock) Epoch() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.epoch
+}
+
+func (c *simClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *simClock) MaxDrift(duration time.Duration) time.Duration {
+	return duration / 1000
+}
+
+func (c *simClock) Step(offset time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	c.now = c.now.Add(offset)
+	c.err += offset
+	c.steps = append(c.steps, offset)
+}
+
+func (c *simClock) Adjust(offset, duration time.Duration, frequency float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.adjusts = append(c.adjusts, offset)
+}
+
+func (c *simClock) Sleep(duration time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(duration)
+	done := !c.now.Before(c.end)
+	c.mu.Unlock()
+	if done {
+		c.done()
+	}
+}
+
+// offset returns the offset of the reference time relative to the local clock.
+func (c *simClock) offset() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return -c.err
+}
+
+var instances atomic.Int64
+
+// newInstance returns a new sync instance with a unique name for t.
+func newInstance(t *testing.T, peers []client.ReferenceClock) *sync.SyncInstance {
+	return sync.NewSyncInstance(fmt.Sprintf("%s-%d", t.Name(), instances.Add(1)), nil, peers)
+}
+
+type simPeer struct {
+	name string
+	clk  *simClock
+}
+
+func (p *simPeer) MeasureClockOffset(context.Context, *zap.Logger) (time.Duration, error) {
+	return p.clk.offset(), nil
+}
+
+func (p *simPeer) String() string {
+	return p.name
+}
+
+func TestGlobalClockSyncSingleStep(t *testing.T) {
+	sync.SetStepPolicy(sync.StepPolicy{
+		Mode:      sync.StepModeThreshold,
+		Threshold: 100 * time.Millisecond,
+		Limit:     -1,
+	})
+	defer sync.SetStepPolicy(sync.StepPolicy{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := &simClock{
+		now:  t0,
+		err:  -time.Second,
+		end:  t0.Add(20 * time.Minute),
+		done: cancel,
+	}
+	var peers []client.ReferenceClock
+	for i := 0; i != 3; i++ {
+		peers = append(peers, &simPeer{name: fmt.Sprintf("peer-%d", i), clk: clk})
+	}
+	s := newInstance(t, peers)
+
+	stopped := make(chan struct{})
+	go func() {
+		s.RunGlobalClockSync(ctx, zap.NewNop(), clk)
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("global clock sync did not stop")
+	}
+
+	clk.mu.Lock()
+	defer clk.mu.Unlock()
+	if len(clk.steps) != 1 || clk.steps[0] != time.Second {
+		t.Errorf("steps = %v; want a single step by %v", clk.steps, time.Second)
+	}
+	for _, off := range clk.adjusts {
+		if off != 0 {
+			t.Errorf("adjustments = %v; want no further correction after the step", clk.adjusts)
+			break
+		}
+	}
+	if clk.err != 0 {
+		t.Errorf("clock error = %v; want 0", clk.err)
+	}
+}
+
+func TestSyncInstancesIndependent(t *testing.T) {
+	sync.SetStepPolicy(sync.StepPolicy{
+		Mode:      sync.StepModeThreshold,
+		Threshold: 100 * time.Millisecond,
+		Limit:     -1,
+	})
+	defer sync.SetStepPolicy(sync.StepPolicy{})
+
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	errs := []time.Duration{-time.Second, 2 * time.Second}
+	var clks []*simClock
+	var stopped []chan struct{}
+	for _, err := range errs {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		clk := &simClock{
+			now:  t0,
+			err:  err,
+			end:  t0.Add(20 * time.Minute),
+			done: cancel,
+		}
+		var peers []client.ReferenceClock
+		for i := 0; i != 3; i++ {
+			peers = append(peers, &simPeer{name: fmt.Sprintf("peer-%d", i), clk: clk})
+		}
+		s := newInstance(t, peers)
+		if x, ok := sync.Instance(s.Name()); !ok || x != s {
+			t.Fatalf("Instance(%q) = %p, %v; want %p, true", s.Name(), x, ok, s)
+		}
+		done := make(chan struct{})
+		go func() {
+			s.RunGlobalClockSync(ctx, zap.NewNop(), clk)
+			close(done)
+		}()
+		clks = append(clks, clk)
+		stopped = append(stopped, done)
+	}
+	for _, done := range stopped {
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("global clock sync did not stop")
+		}
+	}
+
+	// Each instance only corrects the error of its own clock
+	for i, clk := range clks {
+		clk.mu.Lock()
+		if len(clk.steps) != 1 || clk.steps[0] != -errs[i] {
+			t.Errorf("clock %d: steps = %v; want a single step by %v", i, clk.steps, -errs[i])
+		}
+		if clk.err != 0 {
+			t.Errorf("clock %d: error = %v; want 0", i, clk.err)
+		}
+		clk.mu.Unlock()
+	}
+}
+
+func TestWithheldStepKeepsStepState(t *testing.T) {
+	defer sync.SetStepPolicy(sync.StepPolicy{})
+	defer sync.ClearStepCrossCheck()
+
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sync.SetStepCrossCheck(sync.CrossCheck{Threshold: 0, Bound: time.Millisecond, MaxAge: time.Minute})
+
+	// The single clock update that may step is not consumed by a withheld step
+	sync.SetStepPolicy(sync.StepPolicy{
+		Mode:      sync.StepModeThreshold,
+		Threshold: 100 * time.Millisecond,
+		Limit:     1,
+	})
+	s := newInstance(t, nil)
+	if stepped, withheld := s.DecideStep(time.Second, t0, false /* initial */); stepped || !withheld {
+		t.Fatalf("DecideStep = %v, %v; want withheld step", stepped, withheld)
+	}
+	sync.ClearStepCrossCheck()
+	if stepped, withheld := s.DecideStep(time.Second, t0, false /* initial */); !stepped || withheld {
+		t.Fatalf("DecideStep = %v, %v; want step after cross-check", stepped, withheld)
+	}
+
+	// A forced step is not lost if withheld
+	sync.SetStepPolicy(sync.StepPolicy{Mode: sync.StepModeNever})
+	sync.SetStepCrossCheck(sync.CrossCheck{Threshold: 0, Bound: time.Millisecond, MaxAge: time.Minute})
+	sync.ForceStep()
+	d, _ := sync.Instance("")
+	if stepped, withheld := d.DecideStep(time.Second, t0, false /* initial */); stepped || !withheld {
+		t.Fatalf("DecideStep = %v, %v; want withheld forced step", stepped, withheld)
+	}
+	sync.ClearStepCrossCheck()
+	if stepped, withheld := d.DecideStep(time.Second, t0, false /* initial */); !stepped || withheld {
+		t.Fatalf("DecideStep = %v, %v; want forced step after cross-check", stepped, withheld)
+	}
+}
@@ -0,0 +1,215 @@
+package sync
+
+// Frequency transfer between peer timeservices: symmetric peers advertise the
+// frequency error of their clocks in syntonization messages. The frequency
+// error of the local oscillator is estimated by a linear fit over the offsets
+// to syntonized peers, with the corrections applied by the PLL removed. The
+// estimate seeds the PLL after a restart and replaces the frequency tracked by
+// the PLL in holdover, as it is much less affected by noisy offsets.
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/base/timemath"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/server"
+
+	"example.com/scion-time/net/ntp"
+)
+
+const (
+	syntonizationSamples     = 32
+	syntonizationMinSamples  = 4
+	syntonizationMinBaseline = 4 * time.Minute
+	syntonizationMaxSkew     = 1e-6
+
+	// Skew advertised while the clock is disciplined without an estimate of
+	// its own.
+	syntonizationDefaultSkew = 1e-7
+)
+
+type syntonizationSample struct {
+	at    time.Time
+	phase float64 // offset with the corrections of the PLL removed, in seconds
+}
+
+type syntonizer struct {
+	log     *zap.Logger
+	epoch   uint64
+	samples map[client.ReferenceClock][]syntonizationSample
+	freq    float64
+	skew    float64
+	ok      bool
+	seeded  bool
+}
+
+var (
+	frequencyTransfer atomic.Bool
+
+	syntonizationFreq = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: metrics.SyncSyntonizationFrequencyN,
+		Help: metrics.SyncSyntonizationFrequencyH,
+	})
+)
+
+// SetFrequencyTransfer enables the exchange of syntonization messages with
+// symmetric peers and the use of the transferred frequency by the global
+// clock sync.
+func SetFrequencyTransfer(enabled bool) {
+	frequencyTransfer.Store(enabled)
+}
+
+func newSyntonizer(log *zap.Logger) *syntonizer {
+	if !frequencyTransfer.Load() {
+		return nil
+	}
+	return &syntonizer{
+		log:     log,
+		samples: make(map[client.ReferenceClock][]syntonizationSample),
+	}
+}
+
+// add records the offset off to clk measured at local clock reading at in
+// epoch. steering is the phase applied by the PLL up to at.
+func (s *syntonizer) add(clk client.ReferenceClock, epoch uint64, at time.Time,
+	off time.Duration, steering float64) {
+	if _, ok := clk.(client.SyntonizationReporter); !ok {
+		return
+	}
+	if epoch != s.epoch {
+		s.epoch = epoch
+		s.reset()
+	}
+	xs := append(s.samples[clk], syntonizationSample{
+		at:    at,
+		phase: timemath.Seconds(off) + steering,
+	})
+	if len(xs) > syntonizationSamples {
+		xs = xs[len(xs)-syntonizationSamples:]
+	}
+	s.samples[clk] = xs
+}
+
+// reset discards all samples, e.g., after a clock step or when the clock has
+// been running at a frequency other than the one of the PLL. The last
+// estimate is kept.
+func (s *syntonizer) reset() {
+	s.samples = make(map[client.ReferenceClock][]syntonizationSample)
+}
+
+// update combines the frequency estimates relative to the syntonized peers
+// among clks, weighted by the inverse of their variance.
+func (s *syntonizer) update(clks []client.ReferenceClock) {
+	var sw, swf float64
+	for _, c := range clks {
+		r, ok := c.(client.SyntonizationReporter)
+		if !ok {
+			continue
+		}
+		peer, ok := r.Syntonization()
+		if !ok {
+			continue
+		}
+		slope, se, ok := fitFrequency(s.samples[c])
+		if !ok {
+			continue
+		}
+		v := se*se + peer.Skew*peer.Skew
+		if v == 0 {
+			continue
+		}
+		sw += 1 / v
+		swf += (slope - peer.Frequency) / v
+	}
+	if sw == 0 {
+		return
+	}
+	freq, skew := swf/sw, math.Sqrt(1/sw)
+	if skew > syntonizationMaxSkew || math.Abs(freq) > driftMax {
+		return
+	}
+	s.freq, s.skew, s.ok = freq, skew, true
+	syntonizationFreq.Set(freq)
+}
+
+// fitFrequency returns the slope of the least squares line through the phases
+// of xs and its standard error.
+func fitFrequency(xs []syntonizationSample) (slope, se float64, ok bool) {
+	n := len(xs)
+	if n < syntonizationMinSamples || xs[n-1].at.Sub(xs[0].at) < syntonizationMinBaseline {
+		return 0, 0, false
+	}
+	ts := make([]float64, n)
+	var mt, mp float64
+	for i, x := range xs {
+		ts[i] = timemath.Seconds(x.at.Sub(xs[0].at))
+		mt += ts[i]
+		mp += x.phase
+	}
+	mt /= float64(n)
+	mp /= float64(n)
+	var stt, stp float64
+	for i, x := range xs {
+		stt += (ts[i] - mt) * (ts[i] - mt)
+		stp += (ts[i] - mt) * (x.phase - mp)
+	}
+	slope = stp / stt
+	var sse float64
+	for i, x := range xs {
+		r := x.phase - mp - slope*(ts[i]-mt)
+		sse += r * r
+	}
+	se = math.Sqrt(sse / float64(n-2) / stt)
+	return slope, se, true
+}
+
+// seed sets the frequency of pll to the first available estimate.
+func (s *syntonizer) seed(pll *pll, now time.Time) {
+	if s.seeded || !s.ok {
+		return
+	}
+	s.seeded = true
+	s.log.Info("seeded frequency from syntonization",
+		zap.Float64("frequency", s.freq),
+		zap.Float64("skew", s.skew),
+		zap.Float64("previous", pll.i),
+	)
+	pll.steering(now)
+	pll.i = s.freq
+}
+
+// frequency returns the estimated frequency error of the local oscillator,
+// or freq if there is no estimate.
+func (s *syntonizer) frequency(freq float64) float64 {
+	if !s.ok {
+		return freq
+	}
+	return s.freq
+}
+
+// message returns the syntonization message of the clock disciplined with the
+// frequency correction freq of the PLL. Its frequency error is the difference
+// between freq and the estimated frequency error of the local oscillator, 0
+// without an estimate.
+func (s *syntonizer) message(freq float64) ntp.Syntonization {
+	if !s.ok {
+		return ntp.Syntonization{Skew: syntonizationDefaultSkew}
+	}
+	return ntp.Syntonization{Frequency: freq - s.freq, Skew: s.skew}
+}
+
+// publish advertises the frequency error of the clock, disciplined with the
+// frequency correction freq of the PLL, to symmetric peers as long as the
+// clock is disciplined.
+func (s *syntonizer) publish(disciplined bool, freq float64) {
+	server.SetSyntonization(s.message(freq), disciplined)
+}
@@ -0,0 +1,83 @@
+package sync_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"example.com/scion-time/core/sync"
+)
+
+func TestFitFrequency(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := func(n int, interval time.Duration, phase func(i int, s float64) float64) (
+		[]time.Time, []float64) {
+		at := make([]time.Time, n)
+		phases := make([]float64, n)
+		for i := range at {
+			at[i] = t0.Add(time.Duration(i) * interval)
+			phases[i] = phase(i, float64(i)*interval.Seconds())
+		}
+		return at, phases
+	}
+	for _, tc := range []struct {
+		name     string
+		n        int
+		interval time.Duration
+		phase    func(i int, s float64) float64
+		ok       bool
+		slope    float64
+		noisy    bool
+	}{
+		{
+			name: "too few samples", n: 3, interval: 5 * time.Minute,
+			phase: func(int, float64) float64 { return 0 },
+		},
+		{
+			name: "short baseline", n: 16, interval: 10 * time.Second,
+			phase: func(int, float64) float64 { return 0 },
+		},
+		{
+			name: "constant", n: 8, interval: time.Minute,
+			phase: func(int, float64) float64 { return 1e-3 },
+			ok:    true, slope: 0,
+		},
+		{
+			name: "linear", n: 8, interval: time.Minute,
+			phase: func(_ int, s float64) float64 { return 2e-3 + 5e-6*s },
+			ok:    true, slope: 5e-6,
+		},
+		{
+			name: "noisy", n: 16, interval: time.Minute,
+			phase: func(i int, s float64) float64 { return -3e-6*s + float64(i%2*2-1)*1e-6 },
+			ok:    true, slope: -3e-6, noisy: true,
+		},
+	} {
+		at, phases := samples(tc.n, tc.interval, tc.phase)
+		slope, se, ok := sync.FitFrequency(at, phases)
+		if ok != tc.ok {
+			t.Errorf("%s: ok = %t; want %t", tc.name, ok, tc.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if math.Abs(slope-tc.slope) > 1e-8 {
+			t.Errorf("%s: slope = %g; want %g", tc.name, slope, tc.slope)
+		}
+		if tc.noisy != (se > 1e-12) {
+			t.Errorf("%s: standard error = %g", tc.name, se)
+		}
+	}
+}
+
+func TestSyntonizationMessage(t *testing.T) {
+	s := sync.SyntonizationMessage(4e-6, 0, 0, false)
+	if s.Frequency != 0 || s.Skew <= 0 {
+		t.Errorf("message without estimate = %+v; want zero frequency and default skew", s)
+	}
+	s = sync.SyntonizationMessage(4e-6, 3e-6, 2e-8, true)
+	if math.Abs(s.Frequency-1e-6) > 1e-15 || s.Skew != 2e-8 {
+		t.Errorf("message = %+v; want frequency 1e-6, skew 2e-8", s)
+	}
+}
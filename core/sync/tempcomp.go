@@ -0,0 +1,171 @@
+package sync
+
+// Temperature compensation of the frequency error of the local clock, similar
+// to chrony's tempcomp directive: while the clock is disciplined, pairs of
+// temperature and estimated frequency error are collected and a linear
+// temperature-to-frequency model is fitted to them. In holdover, the last
+// frequency estimate is corrected by the change of the modeled frequency error
+// since the last clock update.
+
+import (
+	"errors"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/metrics"
+)
+
+// TemperatureSensor returns the current temperature in degrees Celsius.
+type TemperatureSensor func() (float64, error)
+
+const (
+	tempcompInterval   = time.Minute
+	tempcompMaxSamples = 1024
+	tempcompMinSamples = 32
+	tempcompMinRange   = 1.0  // minimum temperature range of the samples in °C
+	tempcompMaxSlope   = 1e-6 // maximum frequency change per °C
+)
+
+type tempSample struct {
+	temp, freq float64
+}
+
+var (
+	errInvalidTemperature = errors.New("invalid temperature")
+
+	tempcompMu       sync.Mutex
+	tempSensor       TemperatureSensor
+	tempSamples      []tempSample
+	tempNext         int
+	tempSlope        float64
+	tempSlopeOK      bool
+	tempLast         float64
+	tempLastOK       bool
+	tempRecordedAt   time.Time
+	temperatureGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: metrics.SyncTemperatureN,
+		Help: metrics.SyncTemperatureH,
+	})
+)
+
+// SetTemperatureSensor enables temperature compensation based on the
+// temperatures returned by s.
+func SetTemperatureSensor(s TemperatureSensor) {
+	tempcompMu.Lock()
+	defer tempcompMu.Unlock()
+	tempSensor = s
+}
+
+// FileTemperatureSensor returns a sensor that reads the temperature from file
+// name, e.g., a sysfs hwmon temperature input, and multiplies it by scale,
+// e.g., 0.001 for values in millidegrees Celsius.
+func FileTemperatureSensor(name string, scale float64) TemperatureSensor {
+	return func() (float64, error) {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return 0, err
+		}
+		t, err := strconv.ParseFloat(strings.TrimSpace(string(b)), 64)
+		if err != nil || math.IsNaN(t) || math.IsInf(t, 0) {
+			return 0, errInvalidTemperature
+		}
+		return t * scale, nil
+	}
+}
+
+func readTemperature(log *zap.Logger) (float64, bool) {
+	if tempSensor == nil {
+		return 0, false
+	}
+	t, err := tempSensor()
+	if err != nil {
+		log.Info("failed to read temperature", zap.Error(err))
+		return 0, false
+	}
+	temperatureGauge.Set(t)
+	return t, true
+}
+
+// fitTemperatureModel determines the slope of the least squares regression
+// line of the frequency errors over the temperatures.
+func fitTemperatureModel() (float64, bool) {
+	n := len(tempSamples)
+	if n < tempcompMinSamples {
+		return 0, false
+	}
+	var sumT, sumF float64
+	minT, maxT := math.Inf(1), math.Inf(-1)
+	for _, s := range tempSamples {
+		sumT += s.temp
+		sumF += s.freq
+		minT = math.Min(minT, s.temp)
+		maxT = math.Max(maxT, s.temp)
+	}
+	if maxT-minT < tempcompMinRange {
+		return 0, false
+	}
+	meanT, meanF := sumT/float64(n), sumF/float64(n)
+	var sxy, sxx float64
+	for _, s := range tempSamples {
+		sxy += (s.temp - meanT) * (s.freq - meanF)
+		sxx += (s.temp - meanT) * (s.temp - meanT)
+	}
+	slope := sxy / sxx
+	if math.Abs(slope) > tempcompMaxSlope {
+		slope = math.Copysign(tempcompMaxSlope, slope)
+	}
+	return slope, true
+}
+
+// recordTemperature adds the current temperature together with the frequency
+// error freq estimated by the discipline to the temperature model, at most
+// once per tempcompInterval.
+func recordTemperature(log *zap.Logger, now time.Time, freq float64) {
+	tempcompMu.Lock()
+	defer tempcompMu.Unlock()
+	if !tempRecordedAt.IsZero() && now.Sub(tempRecordedAt) < tempcompInterval {
+		return
+	}
+	t, ok := readTemperature(log)
+	if !ok {
+		return
+	}
+	s := tempSample{temp: t, freq: freq}
+	if len(tempSamples) != tempcompMaxSamples {
+		tempSamples = append(tempSamples, s)
+	} else {
+		tempSamples[tempNext] = s
+	}
+	tempNext = (tempNext + 1) % tempcompMaxSamples
+	tempLast, tempLastOK = t, true
+	tempRecordedAt = now
+	slope, ok := fitTemperatureModel()
+	if ok && (!tempSlopeOK || slope != tempSlope) {
+		log.Debug("updated temperature model", zap.Float64("slope", slope))
+	}
+	tempSlope, tempSlopeOK = slope, ok
+}
+
+// compensateTemperature returns the frequency error freq, estimated at the
+// last recorded temperature, corrected for the current temperature.
+func compensateTemperature(log *zap.Logger, freq float64) float64 {
+	tempcompMu.Lock()
+	defer tempcompMu.Unlock()
+	if !tempSlopeOK || !tempLastOK {
+		return freq
+	}
+	t, ok := readTemperature(log)
+	if !ok {
+		return freq
+	}
+	return freq + tempSlope*(t-tempLast)
+}
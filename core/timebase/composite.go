@@ -0,0 +1,78 @@
+package timebase
+
+// Composite clock: timestamps of the disciplined local clock with ordering
+// guarantees. The reading advances with the local monotonic clock and
+// corrections of the disciplined clock, i.e., steps and slews, are smeared
+// into it at a bounded rate. Readings are therefore strictly increasing, even
+// if the local clock is stepped backwards.
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultMaxCorrectionRate is the rate at which corrections are smeared into
+// the readings of a composite clock by default.
+const DefaultMaxCorrectionRate = 500e-6
+
+type CompositeClock struct {
+	// MaxCorrectionRate bounds the correction per elapsed time,
+	// DefaultMaxCorrectionRate if 0
+	MaxCorrectionRate float64
+	mu                sync.Mutex
+	mono              time.Time
+	last              time.Time
+	monotonic         func() time.Time
+}
+
+func (c *CompositeClock) rate() float64 {
+	if c.MaxCorrectionRate <= 0 {
+		return DefaultMaxCorrectionRate
+	}
+	return c.MaxCorrectionRate
+}
+
+// Now returns the current composite time. Successive readings of c are
+// strictly increasing.
+func (c *CompositeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.monotonic == nil {
+		c.monotonic = time.Now
+	}
+	m := c.monotonic()
+	t := Now()
+	if c.last.IsZero() {
+		c.mono, c.last = m, t
+		return t
+	}
+	elapsed := m.Sub(c.mono)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	next := c.last.Add(elapsed)
+	corr := t.Sub(next)
+	maxCorr := time.Duration(c.rate() * float64(elapsed))
+	if corr > maxCorr {
+		corr = maxCorr
+	} else if corr < -maxCorr {
+		corr = -maxCorr
+	}
+	next = next.Add(corr)
+	if !next.After(c.last) {
+		next = c.last.Add(1)
+	}
+	c.mono, c.last = m, next
+	return next
+}
+
+// Offset returns the correction of the local clock that has not yet been
+// smeared into the readings of c.
+func (c *CompositeClock) Offset() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last.IsZero() {
+		return 0
+	}
+	return Now().Sub(c.last.Add(c.monotonic().Sub(c.mono)))
+}
@@ -0,0 +1,61 @@
+package timebase
+
+import (
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Epoch() uint64                                    { return 0 }
+func (c *testClock) Now() time.Time                                   { return c.now }
+func (c *testClock) MaxDrift(duration time.Duration) time.Duration    { return 0 }
+func (c *testClock) Step(offset time.Duration)                        { c.now = c.now.Add(offset) }
+func (c *testClock) Adjust(offset, duration time.Duration, f float64) {}
+func (c *testClock) Sleep(duration time.Duration)                     { c.now = c.now.Add(duration) }
+
+func TestCompositeClock(t *testing.T) {
+	lclk := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	RegisterClock(lclk)
+	mono := time.Unix(0, 0)
+	c := &CompositeClock{
+		monotonic: func() time.Time { return mono },
+	}
+	advance := func(d time.Duration) {
+		mono = mono.Add(d)
+		lclk.Sleep(d)
+	}
+
+	t0 := c.Now()
+	advance(time.Second)
+	if t1 := c.Now(); t1.Sub(t0) != time.Second {
+		t.Fatalf("unexpected reading: %v", t1.Sub(t0))
+	}
+
+	lclk.Step(-time.Second)
+	prev := c.Now()
+	for i := 0; i != 2100; i++ {
+		advance(time.Second)
+		ts := c.Now()
+		if !ts.After(prev) {
+			t.Fatalf("non-monotonic reading: %v after %v", ts, prev)
+		}
+		if d := ts.Sub(prev); d < time.Second-time.Second*5/10000 {
+			t.Fatalf("unexpected correction: %v", time.Second-d)
+		}
+		prev = ts
+	}
+	if !prev.Equal(lclk.Now()) {
+		t.Fatalf("correction not applied: %v", prev.Sub(lclk.Now()))
+	}
+	if off := c.Offset(); off != 0 {
+		t.Fatalf("unexpected offset: %v", off)
+	}
+
+	c.Now()
+	if c.Now().Equal(c.Now()) {
+		t.Fatal("non-increasing readings")
+	}
+}
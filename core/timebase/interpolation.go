@@ -0,0 +1,89 @@
+package timebase
+
+// Interpolation of the local clock between adjustments: each clock discipline
+// publishes its offset estimate together with the adjustment in progress and
+// Now applies the part of the offset that has not yet been corrected by the
+// adjustment. Since a new adjustment supersedes the one in progress, the most
+// recent estimate of any discipline is used.
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OffsetEstimate is the offset of the reference time relative to the local
+// clock as estimated by the clock discipline at local clock reading Time. The
+// adjustment started at Time corrects Correction of Offset over Duration.
+type OffsetEstimate struct {
+	Epoch      uint64
+	Time       time.Time
+	Offset     time.Duration
+	Correction time.Duration
+	Duration   time.Duration
+}
+
+var (
+	interpolation atomic.Bool
+	estimatesMu   sync.Mutex
+	estimates     atomic.Pointer[map[string]OffsetEstimate]
+)
+
+// SetInterpolation enables or disables the interpolation of Now.
+func SetInterpolation(enabled bool) {
+	interpolation.Store(enabled)
+}
+
+// UpdateOffsetEstimate replaces the offset estimate of the clock discipline
+// named discipline with e.
+func UpdateOffsetEstimate(discipline string, e OffsetEstimate) {
+	estimatesMu.Lock()
+	defer estimatesMu.Unlock()
+	es := make(map[string]OffsetEstimate)
+	if x := estimates.Load(); x != nil {
+		for k, v := range *x {
+			es[k] = v
+		}
+	}
+	es[discipline] = e
+	estimates.Store(&es)
+}
+
+// residualOffset returns the estimated offset at local clock reading t in
+// epoch based on the most recent estimate. Estimates of earlier epochs, i.e.,
+// before a clock step, are ignored. The part of the offset left after the
+// adjustment decays to zero over another adjustment duration, by which time
+// the discipline is expected to have corrected it.
+func residualOffset(epoch uint64, t time.Time) time.Duration {
+	es := estimates.Load()
+	if es == nil {
+		return 0
+	}
+	var e OffsetEstimate
+	for _, x := range *es {
+		if x.Epoch == epoch && x.Duration > 0 && !x.Time.Before(e.Time) {
+			e = x
+		}
+	}
+	if e.Duration <= 0 {
+		return 0
+	}
+	dt := t.Sub(e.Time)
+	if dt < 0 || dt >= 2*e.Duration {
+		return 0
+	}
+	if dt <= e.Duration {
+		return e.Offset - time.Duration(float64(e.Correction)*float64(dt)/float64(e.Duration))
+	}
+	r := e.Offset - e.Correction
+	return time.Duration(float64(r) * float64(2*e.Duration-dt) / float64(e.Duration))
+}
+
+// Interpolate returns the raw local clock reading t, e.g., a packet timestamp,
+// on the time scale of Now.
+func Interpolate(t time.Time) time.Time {
+	if !interpolation.Load() {
+		return t
+	}
+	return t.Add(residualOffset(Epoch(), t))
+}
@@ -0,0 +1,78 @@
+package timebase
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResidualOffset(t *testing.T) {
+	estimates.Store(nil)
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	UpdateOffsetEstimate("local", OffsetEstimate{
+		Epoch:      1,
+		Time:       t0,
+		Offset:     10 * time.Millisecond,
+		Correction: 4 * time.Millisecond,
+		Duration:   4 * time.Second,
+	})
+	for _, tc := range []struct {
+		epoch uint64
+		dt    time.Duration
+		off   time.Duration
+	}{
+		{1, 0, 10 * time.Millisecond},
+		{1, 1 * time.Second, 9 * time.Millisecond},
+		{1, 4 * time.Second, 6 * time.Millisecond},
+		{1, 6 * time.Second, 3 * time.Millisecond},
+		{1, 7 * time.Second, 1500 * time.Microsecond},
+		{1, 8 * time.Second, 0},
+		{1, 9 * time.Second, 0},
+		{1, -time.Second, 0},
+		{2, time.Second, 0},
+	} {
+		off := residualOffset(tc.epoch, t0.Add(tc.dt))
+		if off != tc.off {
+			t.Errorf("residualOffset(%d, t0%+v) = %v; want %v", tc.epoch, tc.dt, off, tc.off)
+		}
+	}
+}
+
+func TestResidualOffsetPerDiscipline(t *testing.T) {
+	estimates.Store(nil)
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	UpdateOffsetEstimate("global", OffsetEstimate{
+		Epoch:      1,
+		Time:       t0.Add(time.Second),
+		Offset:     2 * time.Millisecond,
+		Correction: 2 * time.Millisecond,
+		Duration:   2 * time.Second,
+	})
+	UpdateOffsetEstimate("local", OffsetEstimate{
+		Epoch:      1,
+		Time:       t0,
+		Offset:     10 * time.Millisecond,
+		Correction: 10 * time.Millisecond,
+		Duration:   8 * time.Second,
+	})
+
+	// The later adjustment supersedes the earlier one, regardless of the
+	// order of the updates
+	if off := residualOffset(1, t0.Add(2*time.Second)); off != time.Millisecond {
+		t.Errorf("residualOffset() = %v; want %v", off, time.Millisecond)
+	}
+
+	// An update of one discipline doesn't replace the estimate of another
+	UpdateOffsetEstimate("local", OffsetEstimate{
+		Epoch:      2,
+		Time:       t0.Add(2 * time.Second),
+		Offset:     4 * time.Millisecond,
+		Correction: 4 * time.Millisecond,
+		Duration:   4 * time.Second,
+	})
+	if off := residualOffset(1, t0.Add(2*time.Second)); off != time.Millisecond {
+		t.Errorf("residualOffset() = %v; want %v", off, time.Millisecond)
+	}
+	if off := residualOffset(2, t0.Add(3*time.Second)); off != 3*time.Millisecond {
+		t.Errorf("residualOffset() = %v; want %v", off, 3*time.Millisecond)
+	}
+}
@@ -0,0 +1,89 @@
+package timebase
+
+// International Atomic Time (TAI): the offset of TAI relative to UTC, i.e.,
+// the number of leap seconds, is tracked separately from the local clock,
+// which keeps UTC. The offset is set from the configuration or learned from
+// upstream sources, e.g., PTP announce messages, which may also announce the
+// next leap second.
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// MaxTAIOffset bounds plausible TAI-UTC offsets in seconds.
+const MaxTAIOffset = 1000
+
+// TAIOffset is the TAI-UTC offset in seconds as known from Source. If NextAt
+// is not zero, the offset changes to NextOffset at NextAt, i.e., a leap second
+// is scheduled.
+type TAIOffset struct {
+	Offset     int
+	Source     string
+	NextOffset int
+	NextAt     time.Time
+}
+
+var taiOffset atomic.Pointer[TAIOffset]
+
+// SetTAIOffset replaces the current TAI-UTC offset with o.
+func SetTAIOffset(o TAIOffset) {
+	if o.Offset < 0 || o.Offset > MaxTAIOffset ||
+		!o.NextAt.IsZero() && (o.NextOffset < 0 || o.NextOffset > MaxTAIOffset) {
+		panic("unexpected TAI offset")
+	}
+	taiOffset.Store(&o)
+}
+
+// CurrentTAIOffset returns the current TAI-UTC offset, if known.
+func CurrentTAIOffset() (TAIOffset, bool) {
+	o := taiOffset.Load()
+	if o == nil {
+		return TAIOffset{}, false
+	}
+	return *o, true
+}
+
+// TAIOffsetAt returns the TAI-UTC offset in effect at UTC time t, if known.
+func TAIOffsetAt(t time.Time) (time.Duration, bool) {
+	o := taiOffset.Load()
+	if o == nil {
+		return 0, false
+	}
+	s := o.Offset
+	if !o.NextAt.IsZero() && !t.Before(o.NextAt) {
+		s = o.NextOffset
+	}
+	return time.Duration(s) * time.Second, true
+}
+
+// Leap returns 1 if a leap second is inserted at the end of the UTC day of t,
+// -1 if one is deleted, and 0 otherwise.
+func Leap(t time.Time) int {
+	o := taiOffset.Load()
+	if o == nil || o.NextAt.IsZero() || !o.NextAt.After(t) || o.NextAt.Sub(t) > 24*time.Hour {
+		return 0
+	}
+	switch {
+	case o.NextOffset > o.Offset:
+		return 1
+	case o.NextOffset < o.Offset:
+		return -1
+	}
+	return 0
+}
+
+// TAI converts UTC time t to TAI, if the TAI-UTC offset is known. The result
+// is in the UTC location, but denotes TAI.
+func TAI(t time.Time) (time.Time, bool) {
+	off, ok := TAIOffsetAt(t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return t.Add(off), true
+}
+
+// NowTAI returns the current time of the local clock in TAI, see Now.
+func NowTAI() (time.Time, bool) {
+	return TAI(Now())
+}
@@ -0,0 +1,32 @@
+package timebase
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTAIOffsetAt(t *testing.T) {
+	t0 := time.Date(2016, 12, 31, 0, 0, 0, 0, time.UTC)
+	next := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	SetTAIOffset(TAIOffset{Offset: 36, Source: "test", NextOffset: 37, NextAt: next})
+	for _, tc := range []struct {
+		t   time.Time
+		off time.Duration
+	}{
+		{t0, 36 * time.Second},
+		{next.Add(-1), 36 * time.Second},
+		{next, 37 * time.Second},
+	} {
+		off, ok := TAIOffsetAt(tc.t)
+		if !ok || off != tc.off {
+			t.Errorf("TAIOffsetAt(%v) = %v, %t; want %v, true", tc.t, off, ok, tc.off)
+		}
+	}
+	if Leap(t0.Add(-1)) != 0 || Leap(t0) != 1 || Leap(next) != 0 {
+		t.Errorf("Leap(...) = %d, %d, %d; want 0, 1, 0", Leap(t0.Add(-1)), Leap(t0), Leap(next))
+	}
+	tai, ok := TAI(t0)
+	if !ok || !tai.Equal(t0.Add(36*time.Second)) {
+		t.Errorf("TAI(%v) = %v, %t; want %v, true", t0, tai, ok, t0.Add(36*time.Second))
+	}
+}
@@ -3,15 +3,25 @@ package timebase
 import (
 	"sync/atomic"
 	"time"
-
-	"example.com/scion-time/base/timebase"
 )
 
+// LocalClock is the clock disciplined by the synchronization, e.g., the system
+// clock or a simulated clock. Drivers implement it and the registered instance
+// is shared by clients, servers, and the synchronization.
+type LocalClock interface {
+	Epoch() uint64
+	Now() time.Time
+	MaxDrift(duration time.Duration) time.Duration
+	Step(offset time.Duration)
+	Adjust(offset, duration time.Duration, frequency float64)
+	Sleep(duration time.Duration)
+}
+
 var (
 	lclk atomic.Value
 )
 
-func RegisterClock(c timebase.LocalClock) {
+func RegisterClock(c LocalClock) {
 	if c == nil {
 		panic("local clock must not be nil")
 	}
@@ -21,18 +31,47 @@ func RegisterClock(c timebase.LocalClock) {
 	}
 }
 
-func Now() time.Time {
-	c := lclk.Load().(timebase.LocalClock)
+// RegisterClockIfUnset registers c as the local clock unless a local clock
+// has already been registered and reports whether c has been registered.
+func RegisterClockIfUnset(c LocalClock) bool {
 	if c == nil {
-		panic("no local clock registered")
+		panic("local clock must not be nil")
 	}
-	return c.Now()
+	return lclk.CompareAndSwap(nil, c)
+}
+
+// Now returns the current time of the local clock, interpolated with the
+// current offset estimate if interpolation is enabled.
+func Now() time.Time {
+	c := Clock()
+	t := c.Now()
+	if interpolation.Load() {
+		t = t.Add(residualOffset(c.Epoch(), t))
+	}
+	return t
+}
+
+// RawNow returns the current reading of the local clock. Offset measurements
+// used to discipline the local clock must be based on raw readings.
+func RawNow() time.Time {
+	return Clock().Now()
 }
 
 func Epoch() uint64 {
-	c := lclk.Load().(timebase.LocalClock)
-	if c == nil {
+	return Clock().Epoch()
+}
+
+// Registered reports whether a local clock has been registered.
+func Registered() bool {
+	_, ok := lclk.Load().(LocalClock)
+	return ok
+}
+
+// Clock returns the registered local clock.
+func Clock() LocalClock {
+	c, ok := lclk.Load().(LocalClock)
+	if !ok {
 		panic("no local clock registered")
 	}
-	return c.Epoch()
+	return c
 }
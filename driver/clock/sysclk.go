@@ -0,0 +1,107 @@
+//go:build linux || darwin || freebsd || windows
+
+package clock
+
+// Based on Ntimed by Poul-Henning Kamp, https://github.com/bsdphk/Ntimed
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/core/timebase"
+)
+
+type adjustment struct {
+	clock     *SystemClock
+	duration  time.Duration
+	afterFreq float64
+}
+
+type SystemClock struct {
+	Log        *zap.Logger
+	mu         sync.Mutex
+	epoch      uint64
+	adjustment *adjustment
+}
+
+var _ timebase.LocalClock = (*SystemClock)(nil)
+
+func (c *SystemClock) Epoch() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.epoch
+}
+
+func (c *SystemClock) Now() time.Time {
+	return now(c.Log)
+}
+
+func (c *SystemClock) MaxDrift(duration time.Duration) time.Duration {
+	return math.MaxInt64
+}
+
+func (c *SystemClock) Step(offset time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.adjustment != nil {
+		setFrequency(c.Log, c.adjustment.afterFreq)
+		c.adjustment = nil
+	}
+	setTime(c.Log, offset)
+	if c.epoch == math.MaxUint64 {
+		panic("epoch overflow")
+	}
+	c.epoch++
+}
+
+func (c *SystemClock) Adjust(offset, duration time.Duration, frequency float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.adjustment != nil {
+		c.adjustment = nil
+	}
+	if duration < 0 {
+		panic("invalid duration value")
+	}
+	duration = duration / time.Second * time.Second
+	if duration == 0 {
+		duration = time.Second
+	}
+	setFrequency(c.Log, frequency+timemath.Seconds(offset)/timemath.Seconds(duration))
+	c.adjustment = &adjustment{
+		clock:     c,
+		duration:  duration,
+		afterFreq: frequency,
+	}
+	go func(log *zap.Logger, adj *adjustment) {
+		sleep(log, adj.duration)
+		adj.clock.mu.Lock()
+		defer adj.clock.mu.Unlock()
+		if adj == adj.clock.adjustment {
+			setFrequency(log, adj.afterFreq)
+		}
+	}(c.Log, c.adjustment)
+}
+
+// Stop ends any adjustment in progress, leaving the clock running at the
+// frequency it would have after the adjustment.
+func (c *SystemClock) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.adjustment != nil {
+		setFrequency(c.Log, c.adjustment.afterFreq)
+		c.adjustment = nil
+	}
+}
+
+func (c *SystemClock) Sleep(duration time.Duration) {
+	c.Log.Debug("sleeping", zap.Duration("duration", duration))
+	if duration < 0 {
+		panic("invalid duration value")
+	}
+	sleep(c.Log, duration)
+}
@@ -0,0 +1,75 @@
+//go:build darwin || freebsd
+
+package clock
+
+import (
+	"math"
+	"time"
+	"unsafe"
+
+	"go.uber.org/zap"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ntpModFrequency = 0x0002
+	ntpStaPLL       = 0x0001
+)
+
+// ntpTimex corresponds to struct timex in <sys/timex.h>, C long is mapped to
+// int
+type ntpTimex struct {
+	Modes     uint32
+	Offset    int
+	Freq      int
+	Maxerror  int
+	Esterror  int
+	Status    int32
+	Constant  int
+	Precision int
+	Tolerance int
+	Ppsfreq   int
+	Jitter    int
+	Shift     int32
+	Stabil    int
+	Jitcnt    int
+	Calcnt    int
+	Errcnt    int
+	Stbcnt    int
+}
+
+func now(log *zap.Logger) time.Time {
+	var ts unix.Timespec
+	err := unix.ClockGettime(unix.CLOCK_REALTIME, &ts)
+	if err != nil {
+		log.Fatal("unix.ClockGettime failed", zap.Error(err))
+	}
+	return time.Unix(ts.Unix()).UTC()
+}
+
+func sleep(log *zap.Logger, duration time.Duration) {
+	time.Sleep(duration)
+}
+
+func setTime(log *zap.Logger, offset time.Duration) {
+	log.Debug("setting time", zap.Duration("offset", offset))
+	tv := unix.NsecToTimeval(now(log).Add(offset).UnixNano())
+	err := unix.Settimeofday(&tv)
+	if err != nil {
+		log.Fatal("unix.Settimeofday failed", zap.Error(err))
+	}
+}
+
+func setFrequency(log *zap.Logger, frequency float64) {
+	log.Debug("setting frequency", zap.Float64("frequency", frequency))
+	tx := ntpTimex{
+		Modes:  ntpModFrequency,
+		Freq:   int(math.Floor(frequency * 65536 * 1e6)),
+		Status: ntpStaPLL,
+	}
+	_, _, errno := unix.Syscall(unix.SYS_NTP_ADJTIME, uintptr(unsafe.Pointer(&tx)), 0, 0)
+	if errno != 0 {
+		log.Fatal("ntp_adjtime failed", zap.Error(errno))
+	}
+}
@@ -6,32 +6,13 @@ package clock
 
 import (
 	"math"
-	"sync"
 	"time"
 
 	"go.uber.org/zap"
 
 	"golang.org/x/sys/unix"
-
-	"example.com/scion-time/base/timebase"
-	"example.com/scion-time/base/timemath"
 )
 
-type adjustment struct {
-	clock     *SystemClock
-	duration  time.Duration
-	afterFreq float64
-}
-
-type SystemClock struct {
-	Log        *zap.Logger
-	mu         sync.Mutex
-	epoch      uint64
-	adjustment *adjustment
-}
-
-var _ timebase.LocalClock = (*SystemClock)(nil)
-
 func now(log *zap.Logger) time.Time {
 	var ts unix.Timespec
 	err := unix.ClockGettime(unix.CLOCK_REALTIME, &ts)
@@ -111,68 +92,3 @@ func setFrequency(log *zap.Logger, frequency float64) {
 		log.Fatal("unix.ClockAdjtime failed", zap.Error(err))
 	}
 }
-
-func (c *SystemClock) Epoch() uint64 {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	return c.epoch
-}
-
-func (c *SystemClock) Now() time.Time {
-	return now(c.Log)
-}
-
-func (c *SystemClock) MaxDrift(duration time.Duration) time.Duration {
-	return math.MaxInt64
-}
-
-func (c *SystemClock) Step(offset time.Duration) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.adjustment != nil {
-		setFrequency(c.Log, c.adjustment.afterFreq)
-		c.adjustment = nil
-	}
-	setTime(c.Log, offset)
-	if c.epoch == math.MaxUint64 {
-		panic("epoch overflow")
-	}
-	c.epoch++
-}
-
-func (c *SystemClock) Adjust(offset, duration time.Duration, frequency float64) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.adjustment != nil {
-		c.adjustment = nil
-	}
-	if duration < 0 {
-		panic("invalid duration value")
-	}
-	duration = duration / time.Second * time.Second
-	if duration == 0 {
-		duration = time.Second
-	}
-	setFrequency(c.Log, frequency+timemath.Seconds(offset)/timemath.Seconds(duration))
-	c.adjustment = &adjustment{
-		clock:     c,
-		duration:  duration,
-		afterFreq: frequency,
-	}
-	go func(log *zap.Logger, adj *adjustment) {
-		sleep(log, adj.duration)
-		adj.clock.mu.Lock()
-		defer adj.clock.mu.Unlock()
-		if adj == adj.clock.adjustment {
-			setFrequency(log, adj.afterFreq)
-		}
-	}(c.Log, c.adjustment)
-}
-
-func (c *SystemClock) Sleep(duration time.Duration) {
-	c.Log.Debug("sleeping", zap.Duration("duration", duration))
-	if duration < 0 {
-		panic("invalid duration value")
-	}
-	sleep(c.Log, duration)
-}
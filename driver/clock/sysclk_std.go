@@ -1,4 +1,4 @@
-//go:build !linux
+//go:build !linux && !darwin && !freebsd && !windows
 
 package clock
 
@@ -8,7 +8,7 @@ import (
 
 	"go.uber.org/zap"
 
-	"example.com/scion-time/base/timebase"
+	"example.com/scion-time/core/timebase"
 )
 
 type SystemClock struct {
@@ -41,6 +41,10 @@ func (c *SystemClock) Adjust(offset, duration time.Duration, frequency float64)
 	)
 }
 
+func (c *SystemClock) Stop() {
+	c.Log.Debug("SystemClock.Stop, not yet implemented")
+}
+
 func (c *SystemClock) Sleep(duration time.Duration) {
 	c.Log.Debug("SystemClock.Sleep", zap.Duration("duration", duration))
 	time.Sleep(duration)
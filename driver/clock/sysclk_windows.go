@@ -0,0 +1,93 @@
+package clock
+
+import (
+	"math"
+	"sync"
+	"time"
+	"unsafe"
+
+	"go.uber.org/zap"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	kernel32 = windows.NewLazySystemDLL("kernel32.dll")
+	ntdll    = windows.NewLazySystemDLL("ntdll.dll")
+
+	procGetSystemTimeAdjustmentPrecise = kernel32.NewProc("GetSystemTimeAdjustmentPrecise")
+	procSetSystemTimeAdjustmentPrecise = kernel32.NewProc("SetSystemTimeAdjustmentPrecise")
+	procNtSetSystemTime                = ntdll.NewProc("NtSetSystemTime")
+
+	privilegeOnce sync.Once
+)
+
+// enableSystemtimePrivilege enables SeSystemtimePrivilege for the process, which
+// is required to change the system time and its adjustment.
+func enableSystemtimePrivilege(log *zap.Logger) {
+	var token windows.Token
+	err := windows.OpenProcessToken(windows.CurrentProcess(),
+		windows.TOKEN_ADJUST_PRIVILEGES|windows.TOKEN_QUERY, &token)
+	if err != nil {
+		log.Fatal("windows.OpenProcessToken failed", zap.Error(err))
+	}
+	defer token.Close()
+	var luid windows.LUID
+	err = windows.LookupPrivilegeValue(nil, windows.StringToUTF16Ptr("SeSystemtimePrivilege"), &luid)
+	if err != nil {
+		log.Fatal("windows.LookupPrivilegeValue failed", zap.Error(err))
+	}
+	privs := windows.Tokenprivileges{PrivilegeCount: 1}
+	privs.Privileges[0] = windows.LUIDAndAttributes{
+		Luid:       luid,
+		Attributes: windows.SE_PRIVILEGE_ENABLED,
+	}
+	err = windows.AdjustTokenPrivileges(token, false, &privs, 0, nil, nil)
+	if err != nil {
+		log.Fatal("windows.AdjustTokenPrivileges failed", zap.Error(err))
+	}
+}
+
+func now(log *zap.Logger) time.Time {
+	var ft windows.Filetime
+	windows.GetSystemTimePreciseAsFileTime(&ft)
+	return time.Unix(0, ft.Nanoseconds()).UTC()
+}
+
+func sleep(log *zap.Logger, duration time.Duration) {
+	time.Sleep(duration)
+}
+
+func setTime(log *zap.Logger, offset time.Duration) {
+	log.Debug("setting time", zap.Duration("offset", offset))
+	privilegeOnce.Do(func() { enableSystemtimePrivilege(log) })
+	ft := windows.NsecToFiletime(now(log).Add(offset).UnixNano())
+	t := int64(ft.HighDateTime)<<32 | int64(ft.LowDateTime)
+	status, _, _ := procNtSetSystemTime.Call(uintptr(unsafe.Pointer(&t)), 0)
+	if status != 0 {
+		log.Fatal("NtSetSystemTime failed", zap.Error(windows.NTStatus(status)))
+	}
+}
+
+func setFrequency(log *zap.Logger, frequency float64) {
+	log.Debug("setting frequency", zap.Float64("frequency", frequency))
+	privilegeOnce.Do(func() { enableSystemtimePrivilege(log) })
+	var adj, incr uint64
+	var disabled int32
+	r, _, err := procGetSystemTimeAdjustmentPrecise.Call(
+		uintptr(unsafe.Pointer(&adj)), uintptr(unsafe.Pointer(&incr)), uintptr(unsafe.Pointer(&disabled)))
+	if r == 0 {
+		log.Fatal("GetSystemTimeAdjustmentPrecise failed", zap.Error(err))
+	}
+	// The clock advances by adj per increment of the nominal length incr
+	adj = uint64(math.Round(float64(incr) * (1 + frequency)))
+	if unsafe.Sizeof(uintptr(0)) == 4 {
+		// DWORD64 arguments take two words on 32-bit platforms
+		r, _, err = procSetSystemTimeAdjustmentPrecise.Call(uintptr(adj), uintptr(adj>>32), 0 /* enable adjustment */)
+	} else {
+		r, _, err = procSetSystemTimeAdjustmentPrecise.Call(uintptr(adj), 0 /* enable adjustment */)
+	}
+	if r == 0 {
+		log.Fatal("SetSystemTimeAdjustmentPrecise failed", zap.Error(err))
+	}
+}
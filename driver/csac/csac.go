@@ -0,0 +1,276 @@
+//go:build linux
+
+package csac
+
+// Chip-scale atomic clocks and disciplined oscillators speaking the serial
+// protocol of the Microchip SA.45s CSAC, see
+// https://www.microchip.com/en-us/product/csac-sa45s
+//
+// The 1PPS input of the oscillator is expected to be driven by the local
+// clock, e.g., by the PPS output of a PHC disciplined to the system clock.
+// The phase of this input relative to the 1PPS output of the oscillator is
+// reported in the telemetry and is used as the clock offset.
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Steering resolution and range of the SA.45s
+	steerUnit = 1e-15
+	steerMax  = 2e-8
+
+	// Fields of the telemetry response to "!^"
+	fieldStatus = 0
+	fieldAlarm  = 1
+	fieldMode   = 3
+	fieldTemp   = 9
+	fieldSteer  = 10
+	fieldPhase  = 12
+	fieldDiscOK = 13
+	numFields   = 17
+
+	readTimeout = 1 * time.Second
+
+	// Maximum difference between the offset of a step and the 1PPS phase
+	// eliminated by synchronizing the 1PPS output.
+	stepTolerance = 10 * time.Microsecond
+)
+
+// Telemetry is the state of an oscillator.
+type Telemetry struct {
+	Status      int
+	Alarm       uint64
+	Mode        uint64
+	Temperature float64       // in degrees Celsius
+	Steer       float64       // frequency steer, dimensionless
+	Phase       time.Duration // of the 1PPS input relative to the 1PPS output
+	PhaseOK     bool
+	Disciplined bool
+}
+
+// Locked reports whether the oscillator is locked to the atomic resonance.
+func (t Telemetry) Locked() bool {
+	return t.Status == 0
+}
+
+type Clock struct {
+	Log *zap.Logger
+	dev string
+	mu  sync.Mutex
+	f   *os.File
+	r   *bufio.Reader
+}
+
+var (
+	errUnexpectedTelemetry = errors.New("unexpected telemetry")
+	errNoPhase             = errors.New("1PPS phase not available")
+	errStepMismatch        = errors.New("step does not match 1PPS phase")
+)
+
+// Open opens the serial device dev, e.g., /dev/ttyUSB0, with the default
+// line settings of the SA.45s (57600 baud, 8N1).
+func Open(log *zap.Logger, dev string) (*Clock, error) {
+	f, err := os.OpenFile(dev, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	t, err := unix.IoctlGetTermios(int(f.Fd()), unix.TCGETS)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP |
+		unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	t.Oflag &^= unix.OPOST
+	t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	t.Cflag &^= unix.CSIZE | unix.PARENB | unix.CSTOPB | unix.CRTSCTS | unix.CBAUD
+	t.Cflag |= unix.CS8 | unix.CREAD | unix.CLOCAL | unix.B57600
+	t.Ispeed, t.Ospeed = unix.B57600, unix.B57600
+	t.Cc[unix.VMIN], t.Cc[unix.VTIME] = 1, 0
+	err = unix.IoctlSetTermios(int(f.Fd()), unix.TCSETS, t)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &Clock{
+		Log: log,
+		dev: dev,
+		f:   f,
+		r:   bufio.NewReader(f),
+	}, nil
+}
+
+func (c *Clock) Close() error {
+	return c.f.Close()
+}
+
+func (c *Clock) String() string {
+	return c.dev
+}
+
+// command sends cmd and returns the response line. It must be called with
+// c.mu held.
+func (c *Clock) command(ctx context.Context, cmd string) (string, error) {
+	deadline := time.Now().Add(readTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	err := c.f.SetDeadline(deadline)
+	if err != nil {
+		return "", err
+	}
+	// Discard unsolicited output, e.g., a response that arrived after the
+	// deadline of the previous command.
+	c.r.Reset(c.f)
+	_, err = c.f.WriteString(cmd + "\r\n")
+	if err != nil {
+		return "", err
+	}
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimSpace(line)
+		// Skip the echo of the command
+		if line != "" && line != cmd {
+			return line, nil
+		}
+	}
+}
+
+func parseTelemetry(line string) (Telemetry, error) {
+	fs := strings.Split(line, ",")
+	if len(fs) < numFields {
+		return Telemetry{}, errUnexpectedTelemetry
+	}
+	for i := range fs {
+		fs[i] = strings.TrimSpace(fs[i])
+	}
+	var t Telemetry
+	var err error
+	t.Status, err = strconv.Atoi(fs[fieldStatus])
+	if err != nil {
+		return Telemetry{}, errUnexpectedTelemetry
+	}
+	t.Alarm, err = strconv.ParseUint(fs[fieldAlarm], 0, 64)
+	if err != nil {
+		return Telemetry{}, errUnexpectedTelemetry
+	}
+	t.Mode, err = strconv.ParseUint(fs[fieldMode], 0, 64)
+	if err != nil {
+		return Telemetry{}, errUnexpectedTelemetry
+	}
+	t.Temperature, err = strconv.ParseFloat(fs[fieldTemp], 64)
+	if err != nil {
+		return Telemetry{}, errUnexpectedTelemetry
+	}
+	steer, err := strconv.ParseInt(fs[fieldSteer], 10, 64)
+	if err != nil {
+		return Telemetry{}, errUnexpectedTelemetry
+	}
+	t.Steer = float64(steer) * steerUnit
+	if fs[fieldPhase] != "---" {
+		phase, err := strconv.ParseInt(fs[fieldPhase], 10, 64)
+		if err != nil {
+			return Telemetry{}, errUnexpectedTelemetry
+		}
+		t.Phase, t.PhaseOK = time.Duration(phase), true
+	}
+	t.Disciplined = fs[fieldDiscOK] == "1"
+	return t, nil
+}
+
+// Telemetry returns the current state of the oscillator.
+func (c *Clock) Telemetry(ctx context.Context) (Telemetry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	line, err := c.command(ctx, "!^")
+	if err != nil {
+		return Telemetry{}, err
+	}
+	t, err := parseTelemetry(line)
+	if err != nil {
+		c.Log.Debug("unexpected CSAC telemetry", zap.String("dev", c.dev), zap.String("line", line))
+		return Telemetry{}, err
+	}
+	return t, nil
+}
+
+// MeasureOffset returns the offset of the oscillator relative to the local
+// clock, based on the phase of the 1PPS input.
+func (c *Clock) MeasureOffset(ctx context.Context) (time.Duration, error) {
+	t, err := c.Telemetry(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !t.PhaseOK {
+		return 0, errNoPhase
+	}
+	c.Log.Debug("CSAC telemetry",
+		zap.String("dev", c.dev),
+		zap.Int("status", t.Status),
+		zap.Uint64("alarm", t.Alarm),
+		zap.Float64("temperature", t.Temperature),
+		zap.Float64("steer", t.Steer),
+		zap.Duration("phase", t.Phase),
+	)
+	return t.Phase, nil
+}
+
+// Step synchronizes the 1PPS output of the oscillator to the next edge of
+// its 1PPS input, which steps the oscillator by the inverse of its 1PPS phase.
+// The oscillator cannot be stepped by an arbitrary offset: Step fails unless
+// offset matches the current phase within stepTolerance.
+func (c *Clock) Step(offset time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	line, err := c.command(context.Background(), "!^")
+	if err != nil {
+		return err
+	}
+	t, err := parseTelemetry(line)
+	if err != nil {
+		return err
+	}
+	if !t.PhaseOK {
+		return errNoPhase
+	}
+	if !stepMatchesPhase(offset, t.Phase) {
+		return fmt.Errorf("%w: step %v, phase %v", errStepMismatch, offset, t.Phase)
+	}
+	c.Log.Debug("synchronizing CSAC 1PPS", zap.String("dev", c.dev), zap.Duration("offset", offset))
+	_, err = c.command(context.Background(), "!S")
+	return err
+}
+
+// stepMatchesPhase reports whether synchronizing the 1PPS output steps the
+// oscillator by offset given the 1PPS phase.
+func stepMatchesPhase(offset, phase time.Duration) bool {
+	d := offset + phase
+	return -stepTolerance <= d && d <= stepTolerance
+}
+
+// SetFrequency sets the absolute frequency steer of the oscillator, limited to
+// the steering range of the oscillator.
+func (c *Clock) SetFrequency(frequency float64) error {
+	frequency = math.Max(-steerMax, math.Min(frequency, steerMax))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.command(context.Background(), fmt.Sprintf("!FA%d", int64(math.Round(frequency/steerUnit))))
+	return err
+}
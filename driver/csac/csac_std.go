@@ -0,0 +1,60 @@
+//go:build !linux
+
+package csac
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type Telemetry struct {
+	Status      int
+	Alarm       uint64
+	Mode        uint64
+	Temperature float64
+	Steer       float64
+	Phase       time.Duration
+	PhaseOK     bool
+	Disciplined bool
+}
+
+func (t Telemetry) Locked() bool {
+	return t.Status == 0
+}
+
+type Clock struct {
+	Log *zap.Logger
+}
+
+var errUnsupportedOperation = errors.New("unsupported operation")
+
+func Open(log *zap.Logger, dev string) (*Clock, error) {
+	return nil, errUnsupportedOperation
+}
+
+func (c *Clock) Close() error {
+	return errUnsupportedOperation
+}
+
+func (c *Clock) String() string {
+	return ""
+}
+
+func (c *Clock) Telemetry(ctx context.Context) (Telemetry, error) {
+	return Telemetry{}, errUnsupportedOperation
+}
+
+func (c *Clock) MeasureOffset(ctx context.Context) (time.Duration, error) {
+	return 0, errUnsupportedOperation
+}
+
+func (c *Clock) Step(offset time.Duration) error {
+	return errUnsupportedOperation
+}
+
+func (c *Clock) SetFrequency(frequency float64) error {
+	return errUnsupportedOperation
+}
@@ -0,0 +1,73 @@
+//go:build linux
+
+package csac_test
+
+import (
+	"testing"
+	"time"
+
+	"example.com/scion-time/driver/csac"
+)
+
+func TestParseTelemetry(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		ok   bool
+		want csac.Telemetry
+	}{
+		{
+			// Locked and disciplined, 1PPS phase available
+			line: "0,0x0000,1325CS01234,0x0010,4084,0.92,1.63,10.58,1.35,36.72,-1544,---,-27,1,0,5,1.09",
+			ok:   true,
+			want: csac.Telemetry{
+				Status: 0, Alarm: 0, Mode: 0x10, Temperature: 36.72,
+				Steer: -1544e-15, Phase: -27, PhaseOK: true, Disciplined: true,
+			},
+		},
+		{
+			// Warming up, no 1PPS input
+			line: "4,0x0004,1325CS01234,0x0000,0,0.00,2.09,38.11,0.00,22.05,0,---,---,0,0,0,1.09",
+			ok:   true,
+			want: csac.Telemetry{
+				Status: 4, Alarm: 0x4, Mode: 0, Temperature: 22.05,
+			},
+		},
+		{
+			// With padding around the fields
+			line: " 0, 0x0000, 1325CS01234, 0x0018, 4090, 0.93, 1.61, 10.41, 1.36, 37.01, 250, ---, 1200, 0, 0, 12, 1.09",
+			ok:   true,
+			want: csac.Telemetry{
+				Mode: 0x18, Temperature: 37.01, Steer: 250e-15, Phase: 1200, PhaseOK: true,
+			},
+		},
+		{line: "0,0x0000,1325CS01234,0x0010,4084", ok: false},
+		{line: "x,0x0000,1325CS01234,0x0010,4084,0.92,1.63,10.58,1.35,36.72,-1544,---,-27,1,0,5,1.09", ok: false},
+		{line: "0,0x0000,1325CS01234,0x0010,4084,0.92,1.63,10.58,1.35,36.72,-1.5,---,-27,1,0,5,1.09", ok: false},
+		{line: "0,0x0000,1325CS01234,0x0010,4084,0.92,1.63,10.58,1.35,36.72,-1544,---,n/a,1,0,5,1.09", ok: false},
+	} {
+		got, err := csac.ParseTelemetry(tc.line)
+		if (err == nil) != tc.ok {
+			t.Errorf("ParseTelemetry(%q) = %v; want ok == %t", tc.line, err, tc.ok)
+			continue
+		}
+		if err == nil && got != tc.want {
+			t.Errorf("ParseTelemetry(%q) = %+v; want %+v", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestStepMatchesPhase(t *testing.T) {
+	for _, tc := range []struct {
+		offset, phase time.Duration
+		ok            bool
+	}{
+		{-3 * time.Millisecond, 3 * time.Millisecond, true},
+		{3*time.Millisecond + 5*time.Microsecond, -3 * time.Millisecond, true},
+		{3 * time.Millisecond, 3 * time.Millisecond, false},
+		{1 * time.Second, 0, false},
+	} {
+		if ok := csac.StepMatchesPhase(tc.offset, tc.phase); ok != tc.ok {
+			t.Errorf("StepMatchesPhase(%v, %v) = %t; want %t", tc.offset, tc.phase, ok, tc.ok)
+		}
+	}
+}
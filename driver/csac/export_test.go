@@ -0,0 +1,8 @@
+//go:build linux
+
+package csac
+
+var (
+	ParseTelemetry   = parseTelemetry
+	StepMatchesPhase = stepMatchesPhase
+)
@@ -0,0 +1,15 @@
+package mbg
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var errUnsupportedOperation = errors.New("unsupported operation")
+
+func MeasureClockOffset(ctx context.Context, log *zap.Logger, dev string) (time.Duration, error) {
+	return 0, errUnsupportedOperation
+}
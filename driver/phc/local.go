@@ -0,0 +1,113 @@
+package phc
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/core/timebase"
+)
+
+// LocalClock is a PHC disciplined as the local clock of a sync instance.
+// Like for the system clock, failures to read or adjust the PHC are fatal.
+type LocalClock struct {
+	clk       *Clock
+	mu        sync.Mutex
+	epoch     uint64
+	timer     *time.Timer
+	afterFreq float64
+}
+
+var _ timebase.LocalClock = (*LocalClock)(nil)
+
+// NewLocalClock returns clk as local clock.
+func NewLocalClock(clk *Clock) *LocalClock {
+	return &LocalClock{clk: clk}
+}
+
+func (c *LocalClock) String() string {
+	return c.clk.String()
+}
+
+func (c *LocalClock) Epoch() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.epoch
+}
+
+func (c *LocalClock) Now() time.Time {
+	t, err := c.clk.Now()
+	if err != nil {
+		c.clk.Log.Fatal("failed to read PHC", zap.String("dev", c.clk.String()), zap.Error(err))
+	}
+	return t
+}
+
+func (c *LocalClock) MaxDrift(duration time.Duration) time.Duration {
+	return math.MaxInt64
+}
+
+func (c *LocalClock) setFrequency(frequency float64) {
+	err := c.clk.SetFrequency(frequency)
+	if err != nil {
+		c.clk.Log.Fatal("failed to set PHC frequency", zap.String("dev", c.clk.String()), zap.Error(err))
+	}
+}
+
+func (c *LocalClock) Step(offset time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+		c.setFrequency(c.afterFreq)
+	}
+	err := c.clk.Step(offset)
+	if err != nil {
+		c.clk.Log.Fatal("failed to step PHC", zap.String("dev", c.clk.String()), zap.Error(err))
+	}
+	if c.epoch == math.MaxUint64 {
+		panic("epoch overflow")
+	}
+	c.epoch++
+}
+
+// Adjust slews the PHC by offset over duration, after which it runs at
+// frequency.
+func (c *LocalClock) Adjust(offset, duration time.Duration, frequency float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if duration < 0 {
+		panic("invalid duration value")
+	}
+	duration = duration / time.Second * time.Second
+	if duration == 0 {
+		duration = time.Second
+	}
+	c.setFrequency(frequency + timemath.Seconds(offset)/timemath.Seconds(duration))
+	c.afterFreq = frequency
+	var t *time.Timer
+	t = time.AfterFunc(duration, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.timer == t {
+			c.timer = nil
+			c.setFrequency(c.afterFreq)
+		}
+	})
+	c.timer = t
+}
+
+func (c *LocalClock) Sleep(duration time.Duration) {
+	if duration < 0 {
+		panic("invalid duration value")
+	}
+	time.Sleep(duration)
+}
@@ -0,0 +1,155 @@
+//go:build linux
+
+package phc
+
+// PTP hardware clocks (PHC) of network interfaces, see
+// https://docs.kernel.org/driver-api/ptp.html
+
+import (
+	"unsafe"
+
+	"context"
+	"math"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	clockFD = 3
+
+	ptpMaxSamples = 25
+
+	// _IOW('=', 5, struct ptp_sys_offset)
+	ptpSysOffset = 1<<30 | uint(unsafe.Sizeof(ptpSysOffsetReq{}))<<16 | '='<<8 | 5
+	// _IOWR('=', 8, struct ptp_sys_offset_precise)
+	ptpSysOffsetPrecise = 3<<30 | uint(unsafe.Sizeof(ptpSysOffsetPreciseReq{}))<<16 | '='<<8 | 8
+)
+
+type ptpClockTime struct {
+	sec      int64
+	nsec     uint32
+	reserved uint32
+}
+
+type ptpSysOffsetReq struct {
+	nSamples uint32
+	rsv      [3]uint32
+	ts       [2*ptpMaxSamples + 1]ptpClockTime
+}
+
+type ptpSysOffsetPreciseReq struct {
+	device      ptpClockTime
+	sysRealtime ptpClockTime
+	sysMonoraw  ptpClockTime
+	rsv         [4]uint32
+}
+
+type Clock struct {
+	Log *zap.Logger
+	dev string
+	f   *os.File
+	id  int32
+}
+
+// Open opens the PHC device dev, e.g., /dev/ptp0.
+func Open(log *zap.Logger, dev string) (*Clock, error) {
+	f, err := os.OpenFile(dev, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Clock{
+		Log: log,
+		dev: dev,
+		f:   f,
+		id:  int32((^f.Fd())<<3 | clockFD),
+	}, nil
+}
+
+func (c *Clock) Close() error {
+	return c.f.Close()
+}
+
+func (c *Clock) String() string {
+	return c.dev
+}
+
+func (c *Clock) Now() (time.Time, error) {
+	var ts unix.Timespec
+	err := unix.ClockGettime(c.id, &ts)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(ts.Unix()).UTC(), nil
+}
+
+// MeasureOffset returns the offset of the PHC relative to the system clock,
+// based on the sample with the shortest system clock interval.
+func (c *Clock) MeasureOffset(ctx context.Context) (time.Duration, error) {
+	req := ptpSysOffsetReq{nSamples: ptpMaxSamples}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, c.f.Fd(), uintptr(ptpSysOffset), uintptr(unsafe.Pointer(&req)))
+	if errno != 0 {
+		return 0, errno
+	}
+	ns := func(t ptpClockTime) int64 {
+		return t.sec*int64(time.Second) + int64(t.nsec)
+	}
+	var off time.Duration
+	minInterval := int64(math.MaxInt64)
+	for i := 0; i != int(req.nSamples); i++ {
+		t0 := ns(req.ts[2*i])
+		tp := ns(req.ts[2*i+1])
+		t1 := ns(req.ts[2*i+2])
+		if t1-t0 < minInterval {
+			minInterval = t1 - t0
+			off = time.Duration(tp - (t0 + (t1-t0)/2))
+		}
+	}
+	return off, nil
+}
+
+// MeasureOffsetPrecise returns the offset of the PHC relative to the system
+// clock based on cross timestamps taken by the device. Devices without support
+// for cross timestamps fall back to MeasureOffset.
+func (c *Clock) MeasureOffsetPrecise(ctx context.Context) (time.Duration, error) {
+	var req ptpSysOffsetPreciseReq
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, c.f.Fd(), uintptr(ptpSysOffsetPrecise), uintptr(unsafe.Pointer(&req)))
+	if errno == unix.EOPNOTSUPP || errno == unix.ENOTTY {
+		return c.MeasureOffset(ctx)
+	}
+	if errno != 0 {
+		return 0, errno
+	}
+	ns := func(t ptpClockTime) int64 {
+		return t.sec*int64(time.Second) + int64(t.nsec)
+	}
+	return time.Duration(ns(req.device) - ns(req.sysRealtime)), nil
+}
+
+func (c *Clock) Step(offset time.Duration) error {
+	c.Log.Debug("stepping PHC", zap.String("dev", c.dev), zap.Duration("offset", offset))
+	sec := offset.Nanoseconds() / 1e9
+	nsec := offset.Nanoseconds() % 1e9
+	if nsec < 0 {
+		sec -= 1
+		nsec += 1e9
+	}
+	tx := unix.Timex{
+		Modes: unix.ADJ_SETOFFSET | unix.ADJ_NANO,
+		Time:  unix.Timeval{Sec: sec, Usec: nsec},
+	}
+	_, err := unix.ClockAdjtime(c.id, &tx)
+	return err
+}
+
+func (c *Clock) SetFrequency(frequency float64) error {
+	tx := unix.Timex{
+		Modes: unix.ADJ_FREQUENCY,
+		Freq:  int64(math.Floor(frequency * 65536 * 1e6)),
+	}
+	_, err := unix.ClockAdjtime(c.id, &tx)
+	return err
+}
@@ -0,0 +1,49 @@
+//go:build !linux
+
+package phc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type Clock struct {
+	Log *zap.Logger
+}
+
+var errUnsupportedOperation = errors.New("unsupported operation")
+
+func Open(log *zap.Logger, dev string) (*Clock, error) {
+	return nil, errUnsupportedOperation
+}
+
+func (c *Clock) Close() error {
+	return errUnsupportedOperation
+}
+
+func (c *Clock) String() string {
+	return ""
+}
+
+func (c *Clock) Now() (time.Time, error) {
+	return time.Time{}, errUnsupportedOperation
+}
+
+func (c *Clock) MeasureOffset(ctx context.Context) (time.Duration, error) {
+	return 0, errUnsupportedOperation
+}
+
+func (c *Clock) MeasureOffsetPrecise(ctx context.Context) (time.Duration, error) {
+	return 0, errUnsupportedOperation
+}
+
+func (c *Clock) Step(offset time.Duration) error {
+	return errUnsupportedOperation
+}
+
+func (c *Clock) SetFrequency(frequency float64) error {
+	return errUnsupportedOperation
+}
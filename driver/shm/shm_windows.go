@@ -0,0 +1,14 @@
+package shm
+
+import (
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var errUnsupportedOperation = errors.New("unsupported operation")
+
+func StoreClockSamples(log *zap.Logger, refTime, sysTime time.Time) error {
+	return errUnsupportedOperation
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/net/ntp"
+)
+
+// fakeTransportClock is the reference clock of one transport of a dual
+// reference clock with a fixed offset.
+type fakeTransportClock struct {
+	transport string
+	off       time.Duration
+	err       error
+	reason    string
+	n         int
+}
+
+func (c *fakeTransportClock) MeasureClockOffset(ctx context.Context, log *zap.Logger) (
+	time.Duration, error) {
+	off, err := c.MeasureClockOffsetFine(ctx, log)
+	return off.Duration(), err
+}
+
+func (c *fakeTransportClock) MeasureClockOffsetFine(context.Context, *zap.Logger) (
+	timemath.FineDuration, error) {
+	c.n++
+	return timemath.FineFromDuration(c.off), c.err
+}
+
+func (c *fakeTransportClock) Source() (client.Source, bool) {
+	return client.Source{Stratum: 1}, c.err == nil
+}
+
+func (c *fakeTransportClock) LastSample() (client.Sample, bool) {
+	return client.Sample{Offset: c.off, Transport: c.transport}, c.n != 0
+}
+
+func (c *fakeTransportClock) Syntonization() (ntp.Syntonization, bool) {
+	return ntp.Syntonization{Frequency: 1e-6}, true
+}
+
+func (c *fakeTransportClock) PeerState() client.PeerState {
+	return client.PeerState{}
+}
+
+func (c *fakeTransportClock) RestorePeerState(client.PeerState) {}
+
+func (c *fakeTransportClock) Stop() {}
+
+func (c *fakeTransportClock) unavailable() string {
+	return c.reason
+}
+
+func (c *fakeTransportClock) String() string {
+	return c.transport
+}
+
+func TestDualFailover(t *testing.T) {
+	ctx, log := context.Background(), zap.NewNop()
+	scionclk := &fakeTransportClock{transport: client.TransportSCION, off: 1 * time.Millisecond}
+	ipclk := &fakeTransportClock{transport: client.TransportIP, off: 2 * time.Millisecond}
+	c := &ntpReferenceClockDual{scionclk: scionclk, ipclk: ipclk}
+
+	measure := func(want *fakeTransportClock) {
+		t.Helper()
+		off, err := c.MeasureClockOffset(ctx, log)
+		if err != nil || off != want.off {
+			t.Fatalf("MeasureClockOffset = %v, %v; want %v, nil", off, err, want.off)
+		}
+		if s, ok := c.LastSample(); !ok || s.Transport != want.transport {
+			t.Fatalf("LastSample = %v, %v; want sample via %s", s, ok, want.transport)
+		}
+	}
+
+	measure(scionclk)
+	if _, ok := c.Syntonization(); !ok {
+		t.Error("Syntonization via SCION not reported")
+	}
+
+	// A failed SCION measurement falls back to IP
+	scionclk.err = errTestMeasurement
+	measure(ipclk)
+	if scionclk.n != 2 || ipclk.n != 1 {
+		t.Errorf("measurements = %d, %d; want 2, 1", scionclk.n, ipclk.n)
+	}
+	if _, ok := c.Syntonization(); ok {
+		t.Error("Syntonization reported via IP")
+	}
+
+	// SCION is not retried before the hold-down time elapsed
+	scionclk.err = nil
+	measure(ipclk)
+	if scionclk.n != 2 {
+		t.Errorf("SCION measurements during hold-down = %d; want 2", scionclk.n)
+	}
+	c.fellBackAt = time.Now().Add(-dualTransportHoldDown)
+	measure(scionclk)
+
+	// Without SCION paths, SCION is not attempted at all
+	scionclk.reason = "no SCION paths available"
+	measure(ipclk)
+	if scionclk.n != 3 {
+		t.Errorf("SCION measurements without paths = %d; want 3", scionclk.n)
+	}
+
+	ipclk.err = errTestMeasurement
+	c.fellBackAt = time.Time{}
+	if _, err := c.MeasureClockOffset(ctx, log); !errors.Is(err, errTestMeasurement) {
+		t.Errorf("MeasureClockOffset with both transports failing = %v; want %v",
+			err, errTestMeasurement)
+	}
+}
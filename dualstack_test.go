@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/client"
+)
+
+var errTestMeasurement = errors.New("measurement failed")
+
+// fakeFamilyClock is the reference clock of one address family with a fixed
+// offset and delay.
+type fakeFamilyClock struct {
+	name  string
+	off   time.Duration
+	delay time.Duration
+	err   error
+	n     int
+}
+
+func (c *fakeFamilyClock) MeasureClockOffset(context.Context, *zap.Logger) (time.Duration, error) {
+	c.n++
+	return c.off, c.err
+}
+
+func (c *fakeFamilyClock) Source() (client.Source, bool) {
+	return client.Source{Stratum: 1}, c.err == nil
+}
+
+func (c *fakeFamilyClock) LastSample() (client.Sample, bool) {
+	return client.Sample{Offset: c.off, Delay: c.delay}, c.err == nil
+}
+
+func (c *fakeFamilyClock) String() string {
+	return c.name
+}
+
+func TestDualStackRace(t *testing.T) {
+	ctx, log := context.Background(), zap.NewNop()
+	v4 := &fakeFamilyClock{name: "v4", off: 1 * time.Millisecond, delay: 20 * time.Millisecond}
+	v6 := &fakeFamilyClock{name: "v6", off: 2 * time.Millisecond, delay: 10 * time.Millisecond}
+	c := &ntpReferenceClockDualStack{name: "dual", clks: [2]dualStackClock{v4, v6}}
+
+	for i := 0; i != 3; i++ {
+		off, err := c.MeasureClockOffset(ctx, log)
+		if err != nil || off != v6.off {
+			t.Fatalf("MeasureClockOffset = %v, %v; want %v, nil", off, err, v6.off)
+		}
+	}
+	if v4.n != 1 || v6.n != 3 {
+		t.Errorf("measurements = %d, %d; want 1, 3", v4.n, v6.n)
+	}
+	if s, ok := c.LastSample(); !ok || s.Delay != v6.delay {
+		t.Errorf("LastSample = %v, %v; want sample of IPv6", s, ok)
+	}
+
+	// A failure of the selected family leads to a new race
+	v6.err = errTestMeasurement
+	if _, err := c.MeasureClockOffset(ctx, log); !errors.Is(err, errTestMeasurement) {
+		t.Errorf("MeasureClockOffset = %v; want %v", err, errTestMeasurement)
+	}
+	off, err := c.MeasureClockOffset(ctx, log)
+	if err != nil || off != v4.off {
+		t.Errorf("MeasureClockOffset after failure = %v, %v; want %v, nil", off, err, v4.off)
+	}
+	if v4.n != 2 {
+		t.Errorf("IPv4 measurements = %d; want 2", v4.n)
+	}
+
+	// Races are repeated after dualStackRaceInterval
+	v6.err = nil
+	c.racedAt = time.Now().Add(-dualStackRaceInterval)
+	off, err = c.MeasureClockOffset(ctx, log)
+	if err != nil || off != v6.off {
+		t.Errorf("MeasureClockOffset after race interval = %v, %v; want %v, nil", off, err, v6.off)
+	}
+
+	v4.err, v6.err = errTestMeasurement, errTestMeasurement
+	c.racedAt = time.Time{}
+	if _, err := c.MeasureClockOffset(ctx, log); !errors.Is(err, errTestMeasurement) {
+		t.Errorf("MeasureClockOffset with both families failing = %v; want %v", err, errTestMeasurement)
+	}
+}
@@ -0,0 +1,223 @@
+//go:build integration
+
+package main
+
+// End-to-end test against a local SCION topology: timeservice servers run in
+// separate processes, re-executed from the test binary, in two dispatcherless
+// ASes with mock DRKeys. The test acts as the client instance in a third AS
+// whose clock is offset from the clocks of the server ASes. It performs SPAO
+// authenticated measurements, steps its clock to their midpoint, and checks
+// that its offset converges to zero.
+//
+// Run with: go test -tags=integration -run Integration .
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/snet"
+	"github.com/scionproto/scion/pkg/snet/path"
+
+	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/timebase"
+	"example.com/scion-time/driver/clock"
+	"example.com/scion-time/net/ntp"
+	"example.com/scion-time/net/scion"
+	"example.com/scion-time/net/udp"
+)
+
+const (
+	integrationServerEnv = "TIMESERVICE_INTEGRATION_SERVER"
+
+	integrationPortRange = "10100-10199" // includes ntp.ServerPortSCION
+	integrationClkOffset = 100 * time.Millisecond
+	integrationMaxOffset = 2 * time.Millisecond
+	integrationSamples   = 5
+	integrationRounds    = 3
+)
+
+// integrationServers are the server instances, each in an AS of its own.
+var integrationServers = []struct {
+	ia   addr.IA
+	host net.IP
+}{
+	{addr.MustIAFrom(1, 0xff0000000111), net.IPv4(127, 0, 0, 1)},
+	{addr.MustIAFrom(1, 0xff0000000112), net.IPv4(127, 0, 0, 2)},
+}
+
+func TestMain(m *testing.M) {
+	if cfg := os.Getenv(integrationServerEnv); cfg != "" {
+		os.Args = []string{os.Args[0], "server", "-config", cfg}
+		main()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// writeIntegrationCert writes a self-signed certificate for the NTS-KE server
+// to dir.
+func writeIntegrationCert(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func startIntegrationServer(t *testing.T, ctx context.Context, ia addr.IA, host net.IP) {
+	dir := t.TempDir()
+	certFile, keyFile := writeIntegrationCert(t, dir)
+	cfg := filepath.Join(dir, "server.toml")
+	err := os.WriteFile(cfg, []byte(fmt.Sprintf(`local_address = "%s,%s"
+metrics_address = "%s:8080"
+auth_modes = ["spao"]
+scion_dispatcherless = true
+scion_endhost_port_range = "%s"
+ntske_cert_file = "%s"
+ntske_key_file = "%s"
+ntske_server_name = "localhost"
+`, ia, host, host, integrationPortRange, certFile, keyFile)), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write server config: %v", err)
+	}
+	cmd := exec.CommandContext(ctx, os.Args[0])
+	cmd.Env = append(os.Environ(), integrationServerEnv+"="+cfg, "USE_MOCK_KEYS=true")
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+}
+
+func measureIntegrationOffset(t *testing.T, ctx context.Context, c *client.SCIONClient,
+	localAddr, remoteAddr udp.UDPAddr, ps []snet.Path) time.Duration {
+	var offs []time.Duration
+	for i := 0; i != integrationSamples; i++ {
+		mctx, cancel := context.WithTimeout(ctx, time.Second)
+		off, err := client.MeasureClockOffsetSCION(mctx, log, []*client.SCIONClient{c}, localAddr, remoteAddr, ps)
+		cancel()
+		if err != nil {
+			t.Logf("failed to measure clock offset: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		s, ok := c.LastSample()
+		if !ok || !s.Authenticated {
+			t.Fatalf("measurement not authenticated")
+		}
+		offs = append(offs, off)
+	}
+	if len(offs) == 0 {
+		t.Fatalf("failed to measure clock offset")
+	}
+	return timemath.Median(offs)
+}
+
+func TestIntegrationSCION(t *testing.T) {
+	initLogger(true /* verbose */)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	defer scion.SetMockKeys(scion.UseMockKeys(), 12*time.Hour)
+	scion.SetMockKeys(true, 12*time.Hour)
+	r, err := scion.ParsePortRange(integrationPortRange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scion.SetEndhostPortRange(r)
+
+	for _, s := range integrationServers {
+		startIntegrationServer(t, ctx, s.ia, s.host)
+	}
+
+	lclk := &clock.SystemClock{Log: log}
+	timebase.RegisterClock(lclk)
+
+	// The packets of the client and servers are all timestamped by the system
+	// clock. The clock of the client AS is therefore modeled as the system
+	// clock plus clkOff, which is stepped by the client.
+	clkOff := integrationClkOffset
+
+	ia := addr.MustIAFrom(1, 0xff0000000110)
+	localAddr := udp.UDPAddr{IA: ia, Host: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}}
+	remoteAddrs := make([]udp.UDPAddr, len(integrationServers))
+	ps := make([][]snet.Path, len(integrationServers))
+	cs := make([]*client.SCIONClient, len(integrationServers))
+	for i, s := range integrationServers {
+		remoteAddrs[i] = udp.UDPAddr{IA: s.ia, Host: &net.UDPAddr{IP: s.host, Port: ntp.ServerPortSCION}}
+		ps[i] = []snet.Path{path.Path{
+			Src:           ia,
+			Dst:           s.ia,
+			DataplanePath: path.Empty{},
+			NextHop:       &net.UDPAddr{IP: s.host, Port: scion.UnderlayPort(ntp.ServerPortSCION)},
+		}}
+		cs[i] = &client.SCIONClient{}
+		cs[i].Auth.Enabled = true
+		cs[i].Auth.DRKeyFetcher = scion.NewFetcher(nil)
+	}
+
+	// Give the servers some time to start up
+	time.Sleep(500 * time.Millisecond)
+
+	for i := 0; i != integrationRounds; i++ {
+		offs := make([]time.Duration, len(integrationServers))
+		for j := range integrationServers {
+			offs[j] = measureIntegrationOffset(t, ctx, cs[j], localAddr, remoteAddrs[j], ps[j]) - clkOff
+		}
+		corr := timemath.FaultTolerantMidpoint(offs)
+		t.Logf("round %d: offsets %v, correction %v", i, offs, corr)
+		if i == 0 && timemath.Abs(corr+integrationClkOffset) > integrationMaxOffset {
+			t.Fatalf("initial offset %v does not reflect clock offset %v", corr, integrationClkOffset)
+		}
+		clkOff += corr
+	}
+	if timemath.Abs(clkOff) > integrationMaxOffset {
+		t.Errorf("clock offset %v did not converge to within %v", clkOff, integrationMaxOffset)
+	}
+}
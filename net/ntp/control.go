@@ -0,0 +1,93 @@
+package ntp
+
+// NTP control messages (mode 6), see RFC 9327
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	ControlHeaderLen  = 12
+	ControlMaxDataLen = 468
+
+	ControlOpReadStatus    = 1
+	ControlOpReadVariables = 2
+
+	ControlFlagResponse = 0b1000_0000
+	ControlFlagError    = 0b0100_0000
+	ControlFlagMore     = 0b0010_0000
+
+	ControlErrorUnspecified        = 0
+	ControlErrorAuthentication     = 1
+	ControlErrorBadFormat          = 2
+	ControlErrorUnknownOpcode      = 3
+	ControlErrorUnknownAssociation = 4
+	ControlErrorUnknownVariable    = 5
+	ControlErrorProhibited         = 7
+)
+
+type ControlPacket struct {
+	LVM           uint8
+	REMOp         uint8
+	Sequence      uint16
+	Status        uint16
+	AssociationID uint16
+	Offset        uint16
+	Count         uint16
+	Data          []byte
+}
+
+var errUnexpectedControlPacket = errors.New("unexpected control packet structure")
+
+func (p *ControlPacket) Opcode() uint8 {
+	return p.REMOp & 0b0001_1111
+}
+
+func EncodeControlPacket(b *[]byte, pkt *ControlPacket) {
+	if len(pkt.Data) > ControlMaxDataLen {
+		panic("unexpected control packet data length")
+	}
+	n := ControlHeaderLen + (len(pkt.Data)+3)&^3
+	if cap(*b) < n {
+		*b = make([]byte, n)
+	} else {
+		*b = (*b)[:n]
+	}
+
+	(*b)[0] = pkt.LVM
+	(*b)[1] = pkt.REMOp
+	binary.BigEndian.PutUint16((*b)[2:], pkt.Sequence)
+	binary.BigEndian.PutUint16((*b)[4:], pkt.Status)
+	binary.BigEndian.PutUint16((*b)[6:], pkt.AssociationID)
+	binary.BigEndian.PutUint16((*b)[8:], pkt.Offset)
+	binary.BigEndian.PutUint16((*b)[10:], uint16(len(pkt.Data)))
+	m := copy((*b)[ControlHeaderLen:], pkt.Data)
+	for i := ControlHeaderLen + m; i != n; i++ {
+		(*b)[i] = 0
+	}
+}
+
+func DecodeControlPacket(pkt *ControlPacket, b []byte) error {
+	if len(b) < ControlHeaderLen {
+		return errUnexpectedPacketSize
+	}
+
+	pkt.LVM = b[0]
+	pkt.REMOp = b[1]
+	pkt.Sequence = binary.BigEndian.Uint16(b[2:])
+	pkt.Status = binary.BigEndian.Uint16(b[4:])
+	pkt.AssociationID = binary.BigEndian.Uint16(b[6:])
+	pkt.Offset = binary.BigEndian.Uint16(b[8:])
+	pkt.Count = binary.BigEndian.Uint16(b[10:])
+	if int(pkt.Count) > len(b)-ControlHeaderLen || pkt.Count > ControlMaxDataLen {
+		return errUnexpectedControlPacket
+	}
+	pkt.Data = b[ControlHeaderLen : ControlHeaderLen+int(pkt.Count)]
+
+	if (pkt.LVM & 0b0000_0111) != ModeControl {
+		return errUnexpectedControlPacket
+	}
+
+	return nil
+}
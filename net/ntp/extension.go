@@ -0,0 +1,101 @@
+package ntp
+
+// Extension fields in NTPv4 packets, see RFC 7822
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	ExtensionFieldHeaderLen = 4
+
+	// Minimum length of an extension field including its header.
+	ExtensionFieldMinLen = 16
+	// Minimum length of the last extension field if no MAC follows.
+	ExtensionFieldLastMinLen = 28
+
+	macLenMD5  = 20
+	macLenSHA1 = 24
+)
+
+type ExtensionField struct {
+	Type  uint16
+	Value []byte
+}
+
+var (
+	errUnexpectedExtensionFieldLen = errors.New("unexpected extension field length")
+	errUnexpectedMACLen            = errors.New("unexpected MAC length")
+)
+
+func extensionFieldLen(valueLen, minLen int) int {
+	n := ExtensionFieldHeaderLen + valueLen
+	n = (n + 3) &^ 3
+	if n < minLen {
+		n = minLen
+	}
+	return n
+}
+
+// EncodeExtensionFields appends efs to the NTP packet in *b. Values are
+// zero-padded to a multiple of 4 bytes and to the minimum field length. If
+// no MAC follows, the last field is padded to ExtensionFieldLastMinLen bytes.
+func EncodeExtensionFields(b *[]byte, efs []ExtensionField, macFollows bool) {
+	if len(*b) < PacketLen {
+		panic("unexpected NTP header")
+	}
+	for i, ef := range efs {
+		minLen := ExtensionFieldMinLen
+		if i == len(efs)-1 && !macFollows {
+			minLen = ExtensionFieldLastMinLen
+		}
+		n := extensionFieldLen(len(ef.Value), minLen)
+		if n > 0xffff {
+			panic("unexpected extension field value length")
+		}
+		pos := len(*b)
+		if cap(*b)-pos < n {
+			t := make([]byte, pos, 2*cap(*b)+n)
+			copy(t, *b)
+			*b = t
+		}
+		*b = (*b)[:pos+n]
+		binary.BigEndian.PutUint16((*b)[pos:], ef.Type)
+		binary.BigEndian.PutUint16((*b)[pos+2:], uint16(n))
+		m := copy((*b)[pos+ExtensionFieldHeaderLen:], ef.Value)
+		for j := pos + ExtensionFieldHeaderLen + m; j != pos+n; j++ {
+			(*b)[j] = 0
+		}
+	}
+}
+
+// DecodeExtensionFields parses the extension fields following the NTP header
+// in b. Trailing data of 20 or 24 bytes is returned as legacy MAC. Field
+// values alias b and include any padding.
+func DecodeExtensionFields(b []byte) (efs []ExtensionField, mac []byte, err error) {
+	if len(b) < PacketLen {
+		return nil, nil, errUnexpectedPacketSize
+	}
+	pos := PacketLen
+	for len(b)-pos > macLenSHA1 {
+		t := binary.BigEndian.Uint16(b[pos:])
+		n := int(binary.BigEndian.Uint16(b[pos+2:]))
+		if n < ExtensionFieldMinLen || n%4 != 0 || n > len(b)-pos {
+			return nil, nil, errUnexpectedExtensionFieldLen
+		}
+		efs = append(efs, ExtensionField{
+			Type:  t,
+			Value: b[pos+ExtensionFieldHeaderLen : pos+n],
+		})
+		pos += n
+	}
+	switch len(b) - pos {
+	case 0:
+	case macLenMD5, macLenSHA1:
+		mac = b[pos:]
+	default:
+		return nil, nil, errUnexpectedMACLen
+	}
+	return efs, mac, nil
+}
@@ -0,0 +1,85 @@
+package ntp_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"example.com/scion-time/net/ntp"
+)
+
+func TestExtensionFields(t *testing.T) {
+	efs := []ntp.ExtensionField{
+		{Type: 0x0104, Value: []byte{1, 2, 3, 4, 5}},
+		{Type: 0x2005, Value: []byte{6, 7}},
+	}
+	var b []byte
+	ntp.EncodePacket(&b, &ntp.Packet{})
+	ntp.EncodeExtensionFields(&b, efs, false /* macFollows */)
+	if len(b) != ntp.PacketLen+ntp.ExtensionFieldMinLen+ntp.ExtensionFieldLastMinLen {
+		t.Fatalf("EncodeExtensionFields produced %d bytes", len(b))
+	}
+	x, mac, err := ntp.DecodeExtensionFields(b)
+	if err != nil {
+		t.Fatalf("DecodeExtensionFields failed: %v", err)
+	}
+	if mac != nil || len(x) != len(efs) {
+		t.Fatalf("DecodeExtensionFields returned %d fields, MAC %v", len(x), mac)
+	}
+	for i := range efs {
+		if x[i].Type != efs[i].Type || !bytes.HasPrefix(x[i].Value, efs[i].Value) {
+			t.Errorf("DecodeExtensionFields: field %d == %v; want %v", i, x[i], efs[i])
+		}
+	}
+
+	b = append(b, make([]byte, 20)...)
+	_, mac, err = ntp.DecodeExtensionFields(b)
+	if err != nil || len(mac) != 20 {
+		t.Errorf("DecodeExtensionFields failed to recognize MAC: %v", err)
+	}
+}
+
+func TestSyntonization(t *testing.T) {
+	s := ntp.Syntonization{Frequency: -1.5e-6, Skew: 2e-8}
+	var b []byte
+	ntp.EncodePacket(&b, &ntp.Packet{})
+	ntp.EncodeExtensionFields(&b, []ntp.ExtensionField{
+		{Type: 0x0104, Value: []byte{1, 2, 3, 4}},
+		ntp.EncodeSyntonization(s),
+	}, false /* macFollows */)
+	efs, _, err := ntp.DecodeExtensionFields(b)
+	if err != nil {
+		t.Fatalf("DecodeExtensionFields failed: %v", err)
+	}
+	x, ok := ntp.DecodeSyntonization(efs)
+	if !ok || x != s {
+		t.Errorf("DecodeSyntonization() == %v, %t; want %v, true", x, ok, s)
+	}
+
+	_, ok = ntp.DecodeSyntonization([]ntp.ExtensionField{
+		ntp.EncodeSyntonization(ntp.Syntonization{Frequency: 1e-2}),
+	})
+	if ok {
+		t.Errorf("DecodeSyntonization accepted out of range frequency")
+	}
+}
+
+func TestTAIOffset(t *testing.T) {
+	o := ntp.TAIOffset{Offset: 36, NextOffset: 37, NextAt: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var b []byte
+	ntp.EncodePacket(&b, &ntp.Packet{})
+	ntp.EncodeExtensionFields(&b, []ntp.ExtensionField{ntp.EncodeTAIOffset(o)}, false /* macFollows */)
+	efs, _, err := ntp.DecodeExtensionFields(b)
+	if err != nil {
+		t.Fatalf("DecodeExtensionFields failed: %v", err)
+	}
+	x, ok := ntp.DecodeTAIOffset(efs)
+	if !ok || x.Offset != o.Offset || x.NextOffset != o.NextOffset || !x.NextAt.Equal(o.NextAt) {
+		t.Errorf("DecodeTAIOffset() == %v, %t; want %v, true", x, ok, o)
+	}
+
+	_, ok = ntp.DecodeTAIOffset([]ntp.ExtensionField{ntp.EncodeTAIOffset(ntp.TAIOffset{Offset: 5000})})
+	if ok {
+		t.Errorf("DecodeTAIOffset accepted out of range offset")
+	}
+}
@@ -0,0 +1,95 @@
+package ntp
+
+// Structural validation of NTP packets prior to decoding. Packets that fail
+// validation are rejected as a whole instead of being parsed on a best-effort
+// basis.
+
+import (
+	"errors"
+	"strconv"
+)
+
+const (
+	// Packets of eras beyond the next one can't be legitimate before 2172.
+	maxEra = 1
+)
+
+var (
+	errUnexpectedVersion   = errors.New("unexpected version")
+	errUnexpectedMode      = errors.New("unexpected mode")
+	errUnexpectedEra       = errors.New("unexpected era")
+	errUnexpectedTimescale = errors.New("unexpected timescale")
+)
+
+// A FormatError reports a structurally malformed NTP packet.
+type FormatError struct {
+	Field string
+	Err   error
+}
+
+func (e *FormatError) Error() string {
+	return "malformed NTP packet: " + e.Field + ": " + e.Err.Error()
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+func formatError(field string, err error) error {
+	return &FormatError{Field: field, Err: err}
+}
+
+// ValidatePacket checks the structure of the NTPv1-4 packet in b without
+// decoding it. Control packets and NTPv5 packets have their own decoders and
+// are rejected. Data following the header has to consist of RFC 7822
+// extension fields in NTPv4 packets and of at most a legacy MAC otherwise.
+func ValidatePacket(b []byte) error {
+	if len(b) < PacketLen {
+		return formatError("length "+strconv.Itoa(len(b)), errUnexpectedPacketSize)
+	}
+	vn := (b[0] >> 3) & 0b0000_0111
+	if vn < VersionMin || VersionMax < vn {
+		return formatError("version "+strconv.Itoa(int(vn)), errUnexpectedVersion)
+	}
+	mode := b[0] & 0b0000_0111
+	if mode == ModeControl || mode == ModeReserved7 ||
+		mode == ModeReserved0 && vn != 1 {
+		return formatError("mode "+strconv.Itoa(int(mode)), errUnexpectedMode)
+	}
+	if vn == VersionMax {
+		_, _, err := DecodeExtensionFields(b)
+		if err != nil {
+			return formatError("extension fields", err)
+		}
+		return nil
+	}
+	switch len(b) - PacketLen {
+	case 0, macLenMD5, macLenSHA1:
+	default:
+		return formatError("length "+strconv.Itoa(len(b)), errUnexpectedMACLen)
+	}
+	return nil
+}
+
+// ValidatePacketV5 checks the structure of the NTPv5 packet in b without
+// decoding it.
+func ValidatePacketV5(b []byte) error {
+	if len(b) < PacketLen || (len(b)-PacketLen)%4 != 0 {
+		return formatError("length "+strconv.Itoa(len(b)), errUnexpectedPacketSize)
+	}
+	vn := (b[0] >> 3) & 0b0000_0111
+	if vn != Version5 {
+		return formatError("version "+strconv.Itoa(int(vn)), errUnexpectedVersion)
+	}
+	mode := b[0] & 0b0000_0111
+	if mode != ModeClient && mode != ModeServer {
+		return formatError("mode "+strconv.Itoa(int(mode)), errUnexpectedMode)
+	}
+	if ts := b[4]; ts > TimescaleLeapSmearedUTC {
+		return formatError("timescale "+strconv.Itoa(int(ts)), errUnexpectedTimescale)
+	}
+	if era := b[5]; era > maxEra {
+		return formatError("era "+strconv.Itoa(int(era)), errUnexpectedEra)
+	}
+	return nil
+}
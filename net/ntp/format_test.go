@@ -0,0 +1,132 @@
+package ntp_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"example.com/scion-time/net/ntp"
+)
+
+func packet(lvm byte, n int) []byte {
+	b := make([]byte, n)
+	b[0] = lvm
+	return b
+}
+
+func TestValidatePacket(t *testing.T) {
+	ef := make([]byte, ntp.PacketLen)
+	ntp.EncodeExtensionFields(&ef, []ntp.ExtensionField{{Type: 0x0104, Value: make([]byte, 32)}}, false)
+	ef[0] = 4<<3 | ntp.ModeClient
+	tests := []struct {
+		b  []byte
+		ok bool
+	}{
+		{packet(4<<3|ntp.ModeClient, ntp.PacketLen), true},
+		{packet(4<<3|ntp.ModeServer, ntp.PacketLen+24), true},
+		{packet(3<<3|ntp.ModeClient, ntp.PacketLen+20), true},
+		{packet(1<<3|ntp.ModeReserved0, ntp.PacketLen), true},
+		{packet(4<<3|ntp.ModeSymmetricActive, ntp.PacketLen), true},
+		{ef, true},
+		{packet(4<<3|ntp.ModeClient, ntp.PacketLen-1), false},
+		{packet(0<<3|ntp.ModeClient, ntp.PacketLen), false},
+		{packet(5<<3|ntp.ModeClient, ntp.PacketLen), false},
+		{packet(4<<3|ntp.ModeReserved0, ntp.PacketLen), false},
+		{packet(4<<3|ntp.ModeControl, ntp.PacketLen), false},
+		{packet(4<<3|ntp.ModeReserved7, ntp.PacketLen), false},
+		{packet(4<<3|ntp.ModeClient, ntp.PacketLen+7), false},
+		{packet(3<<3|ntp.ModeClient, ntp.PacketLen+32), false},
+		{ef[:len(ef)-4], false},
+	}
+	for i, test := range tests {
+		err := ntp.ValidatePacket(test.b)
+		if test.ok && err != nil {
+			t.Errorf("#%d: ValidatePacket() failed: %v", i, err)
+		}
+		if !test.ok {
+			var ferr *ntp.FormatError
+			if !errors.As(err, &ferr) {
+				t.Errorf("#%d: ValidatePacket() = %v; want *FormatError", i, err)
+			}
+			var pkt ntp.Packet
+			if ntp.DecodePacket(&pkt, test.b) == nil {
+				t.Errorf("#%d: DecodePacket() succeeded; want error", i)
+			}
+		}
+	}
+}
+
+func TestValidatePacketV5(t *testing.T) {
+	valid := packet(ntp.Version5<<3|ntp.ModeServer, ntp.PacketLen)
+	valid[5] = 1
+	if err := ntp.ValidatePacketV5(valid); err != nil {
+		t.Errorf("ValidatePacketV5() failed: %v", err)
+	}
+
+	era := packet(ntp.Version5<<3|ntp.ModeServer, ntp.PacketLen)
+	era[5] = 2
+	timescale := packet(ntp.Version5<<3|ntp.ModeClient, ntp.PacketLen)
+	timescale[4] = ntp.TimescaleLeapSmearedUTC + 1
+	tests := [][]byte{
+		packet(ntp.Version5<<3|ntp.ModeClient, ntp.PacketLen-1),
+		packet(ntp.Version5<<3|ntp.ModeClient, ntp.PacketLen+2),
+		packet(4<<3|ntp.ModeClient, ntp.PacketLen),
+		packet(ntp.Version5<<3|ntp.ModeBroadcast, ntp.PacketLen),
+		era,
+		timescale,
+	}
+	for i, b := range tests {
+		var ferr *ntp.FormatError
+		if err := ntp.ValidatePacketV5(b); !errors.As(err, &ferr) {
+			t.Errorf("#%d: ValidatePacketV5() = %v; want *FormatError", i, err)
+		}
+		var pkt ntp.PacketV5
+		if ntp.DecodePacketV5(&pkt, b) == nil {
+			t.Errorf("#%d: DecodePacketV5() succeeded; want error", i)
+		}
+	}
+}
+
+func FuzzDecodePacket(f *testing.F) {
+	f.Add(packet(4<<3|ntp.ModeClient, ntp.PacketLen))
+	f.Add(packet(3<<3|ntp.ModeServer, ntp.PacketLen+20))
+	f.Add(packet(4<<3|ntp.ModeClient, ntp.PacketLen-1))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var pkt ntp.Packet
+		err := ntp.DecodePacket(&pkt, b)
+		if err != nil {
+			var ferr *ntp.FormatError
+			if !errors.As(err, &ferr) {
+				t.Fatalf("DecodePacket() = %v; want *FormatError", err)
+			}
+			return
+		}
+		var buf []byte
+		ntp.EncodePacket(&buf, &pkt)
+		if !bytes.Equal(buf, b[:ntp.PacketLen]) {
+			t.Fatalf("EncodePacket(DecodePacket(%x)) = %x", b[:ntp.PacketLen], buf)
+		}
+	})
+}
+
+func FuzzDecodePacketV5(f *testing.F) {
+	f.Add(packet(5<<3|ntp.ModeClient, ntp.PacketLen))
+	f.Add(packet(5<<3|ntp.ModeServer, ntp.PacketLen+4))
+	f.Add(packet(5<<3|ntp.ModeClient, ntp.PacketLen+3))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var pkt ntp.PacketV5
+		err := ntp.DecodePacketV5(&pkt, b)
+		if err != nil {
+			var ferr *ntp.FormatError
+			if !errors.As(err, &ferr) {
+				t.Fatalf("DecodePacketV5() = %v; want *FormatError", err)
+			}
+			return
+		}
+		var buf []byte
+		ntp.EncodePacketV5(&buf, &pkt)
+		if !bytes.Equal(buf, b[:ntp.PacketLen]) {
+			t.Fatalf("EncodePacketV5(DecodePacketV5(%x)) = %x", b[:ntp.PacketLen], buf)
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package ntp
+
+// Kiss-of-death packets, see RFC 5905, Section 7.4
+
+const (
+	KissCodeDENY = "DENY"
+	KissCodeRATE = "RATE"
+	KissCodeRSTR = "RSTR"
+)
+
+// IsKissOfDeath reports whether resp is a kiss-of-death packet, i.e., a
+// response with stratum 0.
+func IsKissOfDeath(resp *Packet) bool {
+	return resp.Stratum == 0
+}
+
+// KissCode returns the kiss code of a kiss-of-death packet, the ASCII string
+// in its reference ID.
+func KissCode(resp *Packet) string {
+	id := resp.ReferenceID
+	b := []byte{byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)}
+	for i, c := range b {
+		if c == 0 {
+			b = b[:i]
+			break
+		}
+		if c < 0x20 || c > 0x7e {
+			b[i] = '?'
+		}
+	}
+	return string(b)
+}
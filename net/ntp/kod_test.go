@@ -0,0 +1,30 @@
+package ntp_test
+
+import (
+	"testing"
+
+	"example.com/scion-time/net/ntp"
+)
+
+func TestKissCode(t *testing.T) {
+	tests := []struct {
+		refID uint32
+		code  string
+	}{
+		{0x52415445, ntp.KissCodeRATE},
+		{0x44454e59, ntp.KissCodeDENY},
+		{0x52535452, ntp.KissCodeRSTR},
+		{0x41435354, "ACST"},
+		{0x494e4900, "INI"},
+		{0x0a000000, "?"},
+	}
+	for _, tt := range tests {
+		resp := ntp.Packet{ReferenceID: tt.refID}
+		if !ntp.IsKissOfDeath(&resp) {
+			t.Errorf("IsKissOfDeath(%#x) = false", tt.refID)
+		}
+		if code := ntp.KissCode(&resp); code != tt.code {
+			t.Errorf("KissCode(%#x) = %q, want %q", tt.refID, code, tt.code)
+		}
+	}
+}
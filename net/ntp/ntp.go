@@ -4,6 +4,8 @@ import (
 	"encoding/binary"
 	"errors"
 	"time"
+
+	"example.com/scion-time/base/timemath"
 )
 
 const (
@@ -22,6 +24,8 @@ const (
 	VersionMin = 1
 	VersionMax = 4
 
+	MaxStratum = 15
+
 	ModeReserved0        = 0
 	ModeSymmetricActive  = 1
 	ModeSymmetricPassive = 2
@@ -78,6 +82,30 @@ func TimeFromTime64(t Time64) time.Time {
 			(int64(t.Fraction)*nanosecondsPerSecond+1<<31)>>32))
 }
 
+// FineTimeFromTime64 converts t without rounding it to nanoseconds.
+func FineTimeFromTime64(t Time64) timemath.FineTime {
+	x := uint64(t.Fraction) * uint64(nanosecondsPerSecond) // in 2^-32 ns
+	return timemath.FineTimeOf(
+		epoch.Add(time.Duration(int64(t.Seconds)*nanosecondsPerSecond+int64(x>>32))),
+		uint16(x>>(32-timemath.FineFracBits)))
+}
+
+// Time32FromDuration converts a non-negative duration to NTP short format,
+// rounded up and saturated at the maximum value.
+func Time32FromDuration(d time.Duration) Time32 {
+	if d <= 0 {
+		return Time32{}
+	}
+	if d >= 1<<16*time.Second {
+		return Time32{Seconds: 1<<16 - 1, Fraction: 1<<16 - 1}
+	}
+	x := (int64(d)<<16 + nanosecondsPerSecond - 1) / nanosecondsPerSecond
+	if x >= 1<<32 {
+		x = 1<<32 - 1
+	}
+	return Time32{Seconds: uint16(x >> 16), Fraction: uint16(x)}
+}
+
 func (t Time64) Before(u Time64) bool {
 	return t.Seconds < u.Seconds ||
 		t.Seconds == u.Seconds && t.Fraction < u.Fraction
@@ -96,6 +124,16 @@ func RoundTripDelay(t0, t1, t2, t3 time.Time) time.Duration {
 	return t3.Sub(t0) - t2.Sub(t1)
 }
 
+// ClockOffsetFine is the sub-nanosecond variant of ClockOffset.
+func ClockOffsetFine(t0, t1, t2, t3 timemath.FineTime) timemath.FineDuration {
+	return t1.Sub(t0).Add(t2.Sub(t3)).Half()
+}
+
+// RoundTripDelayFine is the sub-nanosecond variant of RoundTripDelay.
+func RoundTripDelayFine(t0, t1, t2, t3 timemath.FineTime) timemath.FineDuration {
+	return t3.Sub(t0).Sub(t2.Sub(t1))
+}
+
 func EncodePacket(b *[]byte, pkt *Packet) {
 	if cap(*b) < PacketLen {
 		*b = make([]byte, PacketLen)
@@ -122,9 +160,12 @@ func EncodePacket(b *[]byte, pkt *Packet) {
 	binary.BigEndian.PutUint32((*b)[44:], pkt.TransmitTime.Fraction)
 }
 
+// DecodePacket decodes the header of the NTPv1-4 packet in b. Malformed
+// packets are rejected with a *FormatError, see ValidatePacket.
 func DecodePacket(pkt *Packet, b []byte) error {
-	if len(b) < PacketLen {
-		return errUnexpectedPacketSize
+	err := ValidatePacket(b)
+	if err != nil {
+		return err
 	}
 
 	pkt.LVM = uint8(b[0])
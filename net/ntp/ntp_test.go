@@ -0,0 +1,47 @@
+package ntp_test
+
+import (
+	"testing"
+	"time"
+
+	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/net/ntp"
+)
+
+func TestTime32FromDuration(t *testing.T) {
+	tests := []struct {
+		d time.Duration
+		t ntp.Time32
+	}{
+		{-time.Second, ntp.Time32{}},
+		{0, ntp.Time32{}},
+		{time.Nanosecond, ntp.Time32{Fraction: 1}},
+		{500 * time.Millisecond, ntp.Time32{Fraction: 0x8000}},
+		{1500 * time.Millisecond, ntp.Time32{Seconds: 1, Fraction: 0x8000}},
+		{1 << 16 * time.Second, ntp.Time32{Seconds: 0xffff, Fraction: 0xffff}},
+	}
+	for _, test := range tests {
+		if x := ntp.Time32FromDuration(test.d); x != test.t {
+			t.Errorf("Time32FromDuration(%v) = %v; want %v", test.d, x, test.t)
+		}
+	}
+}
+
+func TestClockOffsetFine(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Server timestamps 1 s + 2^-32 s, i.e., about 0.23 ns, after t0
+	t1 := ntp.Time64FromTime(t0.Add(time.Second))
+	t1.Fraction++
+	t2 := t1
+	t3 := t0.Add(2 * time.Second)
+	off := ntp.ClockOffsetFine(timemath.FineTimeOf(t0, 0), ntp.FineTimeFromTime64(t1),
+		ntp.FineTimeFromTime64(t2), timemath.FineTimeOf(t3, 0))
+	if d := off.Nanoseconds() - 1e9/(1<<32); d < -1e-3 || d > 1e-3 {
+		t.Errorf("ClockOffsetFine == %v ns; want %v ns", off.Nanoseconds(), 1e9/(1<<32))
+	}
+	rtd := ntp.RoundTripDelayFine(timemath.FineTimeOf(t0, 0), ntp.FineTimeFromTime64(t1),
+		ntp.FineTimeFromTime64(t2), timemath.FineTimeOf(t3, 0))
+	if rtd.Duration() != 2*time.Second {
+		t.Errorf("RoundTripDelayFine == %v; want %v", rtd, 2*time.Second)
+	}
+}
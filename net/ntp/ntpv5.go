@@ -0,0 +1,198 @@
+package ntp
+
+// Experimental support for NTPv5, see draft-ietf-ntp-ntpv5-02. NTPv5 is only
+// used by the IP client and server; NTP over SCION remains on NTPv4, whose
+// authentication via SPAO and NTS does not depend on the NTP version.
+
+import (
+	"encoding/binary"
+	"time"
+
+	"example.com/scion-time/base/timemath"
+)
+
+const (
+	Version5 = 5
+
+	TimescaleUTC            = 0
+	TimescaleTAI            = 1
+	TimescaleUT1            = 2
+	TimescaleLeapSmearedUTC = 3
+
+	FlagV5UnknownLeap       = 0x0001
+	FlagV5InterleavedMode   = 0x0002
+	FlagV5AuthenticationNAK = 0x0004
+
+	eraLen = 1 << 32 * time.Second
+
+	time32V5FractionBits      = 28
+	time32V5FractionPerSecond = 1 << time32V5FractionBits
+)
+
+// NegotiationV5 is the reference timestamp with which NTPv4 clients offer
+// NTPv5 and with which servers supporting NTPv5 confirm the offer in their
+// response ("NTP5DRFT").
+var NegotiationV5 = Time64{Seconds: 0x4e545035, Fraction: 0x44524654}
+
+type PacketV5 struct {
+	LVM            uint8
+	Stratum        uint8
+	Poll           int8
+	Precision      int8
+	Timescale      uint8
+	Era            uint8
+	Flags          uint16
+	RootDelay      uint32 // in units of 2^-28 s
+	RootDispersion uint32 // in units of 2^-28 s
+	ServerCookie   uint64
+	ClientCookie   uint64
+	ReceiveTime    Time64
+	TransmitTime   Time64
+}
+
+// Era returns the NTP era of t, i.e., the number of 2^32 s periods since the
+// NTP epoch.
+func Era(t time.Time) uint8 {
+	return uint8(t.Sub(epoch) / eraLen)
+}
+
+// TimeFromTime64Era returns the time of timestamp t in era.
+func TimeFromTime64Era(t Time64, era uint8) time.Time {
+	x := TimeFromTime64(t)
+	for i := uint8(0); i != era; i++ {
+		x = x.Add(eraLen)
+	}
+	return x
+}
+
+// FineTimeFromTime64Era is the sub-nanosecond variant of TimeFromTime64Era.
+func FineTimeFromTime64Era(t Time64, era uint8) timemath.FineTime {
+	x := FineTimeFromTime64(t)
+	for i := uint8(0); i != era; i++ {
+		x = x.Add(eraLen)
+	}
+	return x
+}
+
+// Time32V5FromTime32 converts a root delay or dispersion in NTP short format
+// to the NTPv5 format.
+func Time32V5FromTime32(t Time32) uint32 {
+	return uint32(t.Seconds)<<time32V5FractionBits |
+		uint32(t.Fraction)<<(time32V5FractionBits-16)
+}
+
+func DurationFromTime32V5(t uint32) time.Duration {
+	return time.Duration(int64(t) * nanosecondsPerSecond / time32V5FractionPerSecond)
+}
+
+// IsVersion5 reports whether b starts with an NTPv5 header.
+func IsVersion5(b []byte) bool {
+	return len(b) != 0 && (b[0]>>3)&0b0000_0111 == Version5
+}
+
+func EncodePacketV5(b *[]byte, pkt *PacketV5) {
+	if cap(*b) < PacketLen {
+		*b = make([]byte, PacketLen)
+	} else {
+		*b = (*b)[:PacketLen]
+	}
+
+	(*b)[0] = byte(pkt.LVM)
+	(*b)[1] = byte(pkt.Stratum)
+	(*b)[2] = byte(pkt.Poll)
+	(*b)[3] = byte(pkt.Precision)
+	(*b)[4] = byte(pkt.Timescale)
+	(*b)[5] = byte(pkt.Era)
+	binary.BigEndian.PutUint16((*b)[6:], pkt.Flags)
+	binary.BigEndian.PutUint32((*b)[8:], pkt.RootDelay)
+	binary.BigEndian.PutUint32((*b)[12:], pkt.RootDispersion)
+	binary.BigEndian.PutUint64((*b)[16:], pkt.ServerCookie)
+	binary.BigEndian.PutUint64((*b)[24:], pkt.ClientCookie)
+	binary.BigEndian.PutUint32((*b)[32:], pkt.ReceiveTime.Seconds)
+	binary.BigEndian.PutUint32((*b)[36:], pkt.ReceiveTime.Fraction)
+	binary.BigEndian.PutUint32((*b)[40:], pkt.TransmitTime.Seconds)
+	binary.BigEndian.PutUint32((*b)[44:], pkt.TransmitTime.Fraction)
+}
+
+// DecodePacketV5 decodes the header of the NTPv5 packet in b. Malformed
+// packets are rejected with a *FormatError, see ValidatePacketV5.
+func DecodePacketV5(pkt *PacketV5, b []byte) error {
+	err := ValidatePacketV5(b)
+	if err != nil {
+		return err
+	}
+
+	pkt.LVM = uint8(b[0])
+	pkt.Stratum = uint8(b[1])
+	pkt.Poll = int8(b[2])
+	pkt.Precision = int8(b[3])
+	pkt.Timescale = uint8(b[4])
+	pkt.Era = uint8(b[5])
+	pkt.Flags = binary.BigEndian.Uint16(b[6:])
+	pkt.RootDelay = binary.BigEndian.Uint32(b[8:])
+	pkt.RootDispersion = binary.BigEndian.Uint32(b[12:])
+	pkt.ServerCookie = binary.BigEndian.Uint64(b[16:])
+	pkt.ClientCookie = binary.BigEndian.Uint64(b[24:])
+	pkt.ReceiveTime.Seconds = binary.BigEndian.Uint32(b[32:])
+	pkt.ReceiveTime.Fraction = binary.BigEndian.Uint32(b[36:])
+	pkt.TransmitTime.Seconds = binary.BigEndian.Uint32(b[40:])
+	pkt.TransmitTime.Fraction = binary.BigEndian.Uint32(b[44:])
+
+	return nil
+}
+
+func (p *PacketV5) LeapIndicator() uint8 {
+	return (p.LVM >> 6) & 0b0000_0011
+}
+
+func (p *PacketV5) SetLeapIndicator(l uint8) {
+	if l&0b0000_0011 != l {
+		panic("unexpected NTP leap indicator value")
+	}
+	p.LVM = (p.LVM & 0b0011_1111) | (l << 6)
+}
+
+func (p *PacketV5) Version() uint8 {
+	return (p.LVM >> 3) & 0b0000_0111
+}
+
+func (p *PacketV5) SetVersion(v uint8) {
+	if v&0b0000_0111 != v {
+		panic("unexpected NTP version value")
+	}
+	p.LVM = (p.LVM & 0b_1100_0111) | (v << 3)
+}
+
+func (p *PacketV5) Mode() uint8 {
+	return p.LVM & 0b0000_0111
+}
+
+func (p *PacketV5) SetMode(m uint8) {
+	if m&0b0000_0111 != m {
+		panic("unexpected NTP mode value")
+	}
+	p.LVM = (p.LVM & 0b1111_1000) | m
+}
+
+func ValidateRequestV5(req *PacketV5) error {
+	if req.Version() != Version5 || req.Mode() != ModeClient {
+		return errUnexpectedRequest
+	}
+	return nil
+}
+
+func ValidateResponseMetadataV5(resp *PacketV5) error {
+	if resp.Version() != Version5 || resp.Mode() != ModeServer {
+		return errUnexpectedResponse
+	}
+	if resp.Flags&FlagV5UnknownLeap != 0 {
+		return errUnexpectedResponse
+	}
+	if resp.Stratum == 0 || resp.Stratum > MaxStratum {
+		return errUnexpectedResponse
+	}
+	if resp.Timescale != TimescaleUTC {
+		return errUnexpectedResponse
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package ntp_test
+
+import (
+	"testing"
+	"time"
+
+	"example.com/scion-time/net/ntp"
+)
+
+func TestPacketV5RoundTrip(t *testing.T) {
+	var pkt ntp.PacketV5
+	pkt.SetLeapIndicator(ntp.LeapIndicatorInsertSecond)
+	pkt.SetVersion(ntp.Version5)
+	pkt.SetMode(ntp.ModeServer)
+	pkt.Stratum = 2
+	pkt.Poll = 6
+	pkt.Precision = -20
+	pkt.Timescale = ntp.TimescaleTAI
+	pkt.Era = 1
+	pkt.Flags = ntp.FlagV5InterleavedMode
+	pkt.RootDelay = 0x01234567
+	pkt.RootDispersion = 0x089abcde
+	pkt.ServerCookie = 0x0102030405060708
+	pkt.ClientCookie = 0x1112131415161718
+	pkt.ReceiveTime = ntp.Time64{Seconds: 0xe9000000, Fraction: 0x80000000}
+	pkt.TransmitTime = ntp.Time64{Seconds: 0xe9000001, Fraction: 0x00000001}
+
+	var b []byte
+	ntp.EncodePacketV5(&b, &pkt)
+	if len(b) != ntp.PacketLen {
+		t.Fatalf("len(EncodePacketV5()) = %d; want %d", len(b), ntp.PacketLen)
+	}
+	if !ntp.IsVersion5(b) {
+		t.Error("IsVersion5() = false; want true")
+	}
+	var x ntp.PacketV5
+	err := ntp.DecodePacketV5(&x, b)
+	if err != nil {
+		t.Fatalf("DecodePacketV5() failed: %v", err)
+	}
+	if x != pkt {
+		t.Errorf("DecodePacketV5() = %+v; want %+v", x, pkt)
+	}
+	if x.LeapIndicator() != ntp.LeapIndicatorInsertSecond ||
+		x.Version() != ntp.Version5 || x.Mode() != ntp.ModeServer {
+		t.Errorf("unexpected LI, VN, or mode: %d, %d, %d", x.LeapIndicator(), x.Version(), x.Mode())
+	}
+}
+
+func TestEra(t *testing.T) {
+	tests := []struct {
+		t   time.Time
+		era uint8
+	}{
+		{time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC), 0},
+		{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 0},
+		{time.Date(2036, 2, 7, 6, 28, 15, 0, time.UTC), 0},
+		{time.Date(2036, 2, 7, 6, 28, 16, 0, time.UTC), 1},
+		{time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC), 1},
+	}
+	for _, test := range tests {
+		era := ntp.Era(test.t)
+		if era != test.era {
+			t.Errorf("Era(%v) = %d; want %d", test.t, era, test.era)
+		}
+		x := ntp.TimeFromTime64Era(ntp.Time64FromTime(test.t), era)
+		if !x.Equal(test.t) {
+			t.Errorf("TimeFromTime64Era(Time64FromTime(%v), %d) = %v", test.t, era, x)
+		}
+		y := ntp.FineTimeFromTime64Era(ntp.Time64FromTime(test.t), era).Time()
+		if !y.Equal(test.t) {
+			t.Errorf("FineTimeFromTime64Era(Time64FromTime(%v), %d) = %v", test.t, era, y)
+		}
+	}
+}
+
+func TestTime32V5(t *testing.T) {
+	tests := []struct {
+		t ntp.Time32
+		d time.Duration
+	}{
+		{ntp.Time32{}, 0},
+		{ntp.Time32{Fraction: 0x8000}, 500 * time.Millisecond},
+		{ntp.Time32{Seconds: 3, Fraction: 0x4000}, 3250 * time.Millisecond},
+	}
+	for _, test := range tests {
+		d := ntp.DurationFromTime32V5(ntp.Time32V5FromTime32(test.t))
+		if d != test.d {
+			t.Errorf("DurationFromTime32V5(Time32V5FromTime32(%v)) = %v; want %v", test.t, d, test.d)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package ntp
+
+// Framing of NTP packets on byte streams: each packet, including extension
+// fields, is preceded by its length as a 16-bit unsigned integer in network
+// byte order.
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	ServerPortSCIONStream = 10124
+
+	// StreamALPN is the application protocol negotiated on connections that
+	// carry framed NTP packets.
+	StreamALPN = "ntp-stream/1"
+
+	MaxStreamFrameLen = 2048
+)
+
+var errUnexpectedFrameSize = errors.New("unexpected frame size")
+
+// WriteFrame writes b to w as a single frame.
+func WriteFrame(w io.Writer, b []byte) error {
+	if len(b) < PacketLen || len(b) > MaxStreamFrameLen {
+		return errUnexpectedFrameSize
+	}
+	buf := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(buf, uint16(len(b)))
+	copy(buf[2:], b)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadFrame reads a single frame from r into *b and truncates *b to the
+// length of the frame.
+func ReadFrame(r io.Reader, b *[]byte) error {
+	var hdr [2]byte
+	_, err := io.ReadFull(r, hdr[:])
+	if err != nil {
+		return err
+	}
+	n := int(binary.BigEndian.Uint16(hdr[:]))
+	if n < PacketLen || n > MaxStreamFrameLen {
+		return errUnexpectedFrameSize
+	}
+	if cap(*b) < n {
+		*b = make([]byte, n)
+	} else {
+		*b = (*b)[:n]
+	}
+	_, err = io.ReadFull(r, *b)
+	return err
+}
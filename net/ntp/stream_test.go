@@ -0,0 +1,47 @@
+package ntp_test
+
+import (
+	"bytes"
+	"testing"
+
+	"example.com/scion-time/net/ntp"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	var b bytes.Buffer
+	pkts := [][]byte{
+		make([]byte, ntp.PacketLen),
+		bytes.Repeat([]byte{0xa5}, ntp.PacketLen+28),
+	}
+	for _, p := range pkts {
+		if err := ntp.WriteFrame(&b, p); err != nil {
+			t.Fatalf("WriteFrame failed: %v", err)
+		}
+	}
+	var buf []byte
+	for _, p := range pkts {
+		if err := ntp.ReadFrame(&b, &buf); err != nil {
+			t.Fatalf("ReadFrame failed: %v", err)
+		}
+		if !bytes.Equal(buf, p) {
+			t.Errorf("ReadFrame() = %x; want %x", buf, p)
+		}
+	}
+	if err := ntp.ReadFrame(&b, &buf); err == nil {
+		t.Error("ReadFrame succeeded on empty stream")
+	}
+}
+
+func TestFrameSize(t *testing.T) {
+	var b bytes.Buffer
+	if err := ntp.WriteFrame(&b, make([]byte, ntp.PacketLen-1)); err == nil {
+		t.Error("WriteFrame accepted short packet")
+	}
+	if err := ntp.WriteFrame(&b, make([]byte, ntp.MaxStreamFrameLen+1)); err == nil {
+		t.Error("WriteFrame accepted long packet")
+	}
+	var buf []byte
+	if err := ntp.ReadFrame(bytes.NewReader([]byte{0x00, 0x02, 0x00, 0x00}), &buf); err == nil {
+		t.Error("ReadFrame accepted short frame")
+	}
+}
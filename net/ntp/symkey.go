@@ -0,0 +1,182 @@
+package ntp
+
+// Symmetric key authentication as used by classic NTP implementations, see
+// RFC 5905, Section 7.3, and RFC 8573 (AES-CMAC).
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dchest/cmac"
+)
+
+const (
+	SymmetricKeyTypeMD5        = "MD5"
+	SymmetricKeyTypeSHA1       = "SHA1"
+	SymmetricKeyTypeAES128CMAC = "AES128CMAC"
+)
+
+type SymmetricKey struct {
+	ID    uint32
+	Type  string
+	Value []byte
+}
+
+type SymmetricKeys map[uint32]SymmetricKey
+
+var (
+	errInvalidKeysFile = errors.New("invalid keys file")
+	errNoMAC           = errors.New("packet does not contain a MAC")
+	errUnknownKeyID    = errors.New("unknown key ID")
+	errInvalidMAC      = errors.New("invalid MAC")
+)
+
+func parseSymmetricKeyType(s string) (string, bool) {
+	switch strings.ToUpper(s) {
+	case "M", "MD5":
+		return SymmetricKeyTypeMD5, true
+	case "SHA1":
+		return SymmetricKeyTypeSHA1, true
+	case "AES128", "AES128CMAC", "AES-128-CMAC", "CMAC":
+		return SymmetricKeyTypeAES128CMAC, true
+	default:
+		return "", false
+	}
+}
+
+func parseSymmetricKeyValue(s string) ([]byte, error) {
+	if strings.HasPrefix(s, "HEX:") {
+		return hex.DecodeString(strings.TrimPrefix(s, "HEX:"))
+	}
+	if strings.HasPrefix(s, "ASCII:") {
+		return []byte(strings.TrimPrefix(s, "ASCII:")), nil
+	}
+	// ntpd: keys longer than 20 characters are hex encoded
+	if len(s) > 20 {
+		return hex.DecodeString(s)
+	}
+	return []byte(s), nil
+}
+
+// ParseSymmetricKeys reads keys in the format of ntpd and chrony keys files:
+// one key per line given as key ID, key type, and key value.
+func ParseSymmetricKeys(r io.Reader) (SymmetricKeys, error) {
+	keys := make(SymmetricKeys)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		l, _, _ := strings.Cut(s.Text(), "#")
+		fs := strings.Fields(l)
+		if len(fs) == 0 {
+			continue
+		}
+		if len(fs) < 3 {
+			return nil, errInvalidKeysFile
+		}
+		id, err := strconv.ParseUint(fs[0], 10, 32)
+		if err != nil || id == 0 {
+			return nil, errInvalidKeysFile
+		}
+		t, ok := parseSymmetricKeyType(fs[1])
+		if !ok {
+			return nil, errInvalidKeysFile
+		}
+		v, err := parseSymmetricKeyValue(fs[2])
+		if err != nil || len(v) == 0 {
+			return nil, errInvalidKeysFile
+		}
+		if t == SymmetricKeyTypeAES128CMAC && len(v) != 16 {
+			return nil, errInvalidKeysFile
+		}
+		if _, ok := keys[uint32(id)]; ok {
+			return nil, errInvalidKeysFile
+		}
+		keys[uint32(id)] = SymmetricKey{ID: uint32(id), Type: t, Value: v}
+	}
+	err := s.Err()
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func LoadSymmetricKeys(name string) (SymmetricKeys, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseSymmetricKeys(f)
+}
+
+func (k SymmetricKey) digest(b []byte) []byte {
+	var h hash.Hash
+	switch k.Type {
+	case SymmetricKeyTypeMD5:
+		h = md5.New()
+		h.Write(k.Value)
+	case SymmetricKeyTypeSHA1:
+		h = sha1.New()
+		h.Write(k.Value)
+	case SymmetricKeyTypeAES128CMAC:
+		c, err := aes.NewCipher(k.Value)
+		if err != nil {
+			panic(err)
+		}
+		h, err = cmac.New(c)
+		if err != nil {
+			panic(err)
+		}
+	default:
+		panic("unexpected symmetric key type")
+	}
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+// AppendMAC appends a MAC computed with key k over the packet in *b.
+func AppendMAC(b *[]byte, k SymmetricKey) {
+	if len(*b) < PacketLen {
+		panic("unexpected NTP header")
+	}
+	d := k.digest(*b)
+	*b = binary.BigEndian.AppendUint32(*b, k.ID)
+	*b = append(*b, d...)
+}
+
+// VerifyMAC checks the MAC at the end of the packet in b and returns the key
+// used.
+func VerifyMAC(b []byte, keys SymmetricKeys) (SymmetricKey, error) {
+	_, mac, err := DecodeExtensionFields(b)
+	if err != nil {
+		return SymmetricKey{}, err
+	}
+	if mac == nil {
+		return SymmetricKey{}, errNoMAC
+	}
+	k, ok := keys[binary.BigEndian.Uint32(mac)]
+	if !ok {
+		return SymmetricKey{}, errUnknownKeyID
+	}
+	d := k.digest(b[:len(b)-len(mac)])
+	if subtle.ConstantTimeCompare(mac[4:], d) != 1 {
+		return SymmetricKey{}, errInvalidMAC
+	}
+	return k, nil
+}
+
+// HasMAC reports whether the packet in b ends with a MAC.
+func HasMAC(b []byte) bool {
+	_, mac, err := DecodeExtensionFields(b)
+	return err == nil && mac != nil
+}
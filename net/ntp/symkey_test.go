@@ -0,0 +1,34 @@
+package ntp_test
+
+import (
+	"strings"
+	"testing"
+
+	"example.com/scion-time/net/ntp"
+)
+
+func TestSymmetricKeyMAC(t *testing.T) {
+	keys, err := ntp.ParseSymmetricKeys(strings.NewReader(`
+# id type key
+1 MD5 secret
+2 SHA1 HEX:0123456789abcdef0123456789abcdef01234567
+3 AES128 HEX:000102030405060708090a0b0c0d0e0f
+`))
+	if err != nil {
+		t.Fatalf("ParseSymmetricKeys failed: %v", err)
+	}
+	for id, k := range keys {
+		var b []byte
+		ntp.EncodePacket(&b, &ntp.Packet{})
+		ntp.AppendMAC(&b, k)
+		x, err := ntp.VerifyMAC(b, keys)
+		if err != nil || x.ID != id {
+			t.Errorf("VerifyMAC failed for key %d: %v", id, err)
+		}
+		b[0] ^= 1
+		_, err = ntp.VerifyMAC(b, keys)
+		if err == nil {
+			t.Errorf("VerifyMAC accepted modified packet for key %d", id)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package ntp
+
+// Syntonization messages between peer timeservices: an experimental extension
+// field in symmetric mode packets carrying the estimated frequency error of
+// the sender's clock relative to its sources.
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const (
+	// Extension field type from the range reserved for experimentation.
+	ExtensionFieldTypeSyntonization = 0xf5a1
+
+	syntonizationLen = 16
+	maxFrequency     = 500e-6
+)
+
+// Syntonization is the frequency error of the sender's clock relative to its
+// sources, positive if the clock runs fast, and the uncertainty of this
+// estimate. Both are dimensionless.
+type Syntonization struct {
+	Frequency float64
+	Skew      float64
+}
+
+func EncodeSyntonization(s Syntonization) ExtensionField {
+	v := make([]byte, syntonizationLen)
+	binary.BigEndian.PutUint64(v[0:], math.Float64bits(s.Frequency))
+	binary.BigEndian.PutUint64(v[8:], math.Float64bits(s.Skew))
+	return ExtensionField{Type: ExtensionFieldTypeSyntonization, Value: v}
+}
+
+// DecodeSyntonization returns the first valid syntonization message in efs.
+func DecodeSyntonization(efs []ExtensionField) (Syntonization, bool) {
+	for _, ef := range efs {
+		if ef.Type != ExtensionFieldTypeSyntonization || len(ef.Value) < syntonizationLen {
+			continue
+		}
+		s := Syntonization{
+			Frequency: math.Float64frombits(binary.BigEndian.Uint64(ef.Value[0:])),
+			Skew:      math.Float64frombits(binary.BigEndian.Uint64(ef.Value[8:])),
+		}
+		if !(math.Abs(s.Frequency) <= maxFrequency) || !(s.Skew >= 0 && s.Skew <= maxFrequency) {
+			continue
+		}
+		return s, true
+	}
+	return Syntonization{}, false
+}
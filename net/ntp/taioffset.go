@@ -0,0 +1,57 @@
+package ntp
+
+// TAI offset messages: an experimental extension field in server responses
+// carrying the TAI-UTC offset of the server and the next scheduled change of
+// it, for clients that need TAI.
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+const (
+	// Extension field type from the range reserved for experimentation.
+	ExtensionFieldTypeTAIOffset = 0xf5a2
+
+	taiOffsetLen = 12
+	maxTAIOffset = 1000
+)
+
+// TAIOffset is the TAI-UTC offset in seconds. If NextAt is not zero, the
+// offset changes to NextOffset at NextAt.
+type TAIOffset struct {
+	Offset     int
+	NextOffset int
+	NextAt     time.Time
+}
+
+func EncodeTAIOffset(o TAIOffset) ExtensionField {
+	v := make([]byte, taiOffsetLen)
+	binary.BigEndian.PutUint16(v[0:], uint16(o.Offset))
+	binary.BigEndian.PutUint16(v[2:], uint16(o.NextOffset))
+	if !o.NextAt.IsZero() {
+		binary.BigEndian.PutUint64(v[4:], uint64(o.NextAt.Unix()))
+	}
+	return ExtensionField{Type: ExtensionFieldTypeTAIOffset, Value: v}
+}
+
+// DecodeTAIOffset returns the first valid TAI offset message in efs.
+func DecodeTAIOffset(efs []ExtensionField) (TAIOffset, bool) {
+	for _, ef := range efs {
+		if ef.Type != ExtensionFieldTypeTAIOffset || len(ef.Value) < taiOffsetLen {
+			continue
+		}
+		o := TAIOffset{
+			Offset:     int(binary.BigEndian.Uint16(ef.Value[0:])),
+			NextOffset: int(binary.BigEndian.Uint16(ef.Value[2:])),
+		}
+		if at := int64(binary.BigEndian.Uint64(ef.Value[4:])); at != 0 {
+			o.NextAt = time.Unix(at, 0).UTC()
+		}
+		if o.Offset > maxTAIOffset || !o.NextAt.IsZero() && o.NextOffset > maxTAIOffset {
+			continue
+		}
+		return o, true
+	}
+	return TAIOffset{}, false
+}
@@ -11,6 +11,21 @@ var (
 )
 
 func ValidateResponseMetadata(resp *Packet) error {
+	return validateResponseMetadata(resp, ModeServer)
+}
+
+// ValidateSymmetricResponseMetadata validates the response of a peer to a
+// symmetric active request.
+func ValidateSymmetricResponseMetadata(resp *Packet) error {
+	return validateResponseMetadata(resp, ModeSymmetricPassive)
+}
+
+// ValidateBroadcastMetadata validates a packet of a broadcast server.
+func ValidateBroadcastMetadata(pkt *Packet) error {
+	return validateResponseMetadata(pkt, ModeBroadcast)
+}
+
+func validateResponseMetadata(resp *Packet, mode uint8) error {
 	// Based on Ntimed by Poul-Henning Kamp, https://github.com/bsdphk/Ntimed
 
 	if resp.LeapIndicator() == LeapIndicatorUnknown {
@@ -19,10 +34,10 @@ func ValidateResponseMetadata(resp *Packet) error {
 	if resp.Version() != 3 && resp.Version() != 4 {
 		return errUnexpectedResponse
 	}
-	if resp.Mode() != ModeServer {
+	if resp.Mode() != mode {
 		return errUnexpectedResponse
 	}
-	if resp.Stratum == 0 || resp.Stratum > 15 {
+	if resp.Stratum == 0 || resp.Stratum > MaxStratum {
 		return errUnexpectedResponse
 	}
 	return nil
@@ -53,3 +68,15 @@ func ValidateRequest(req *Packet, srcPort uint16) error {
 	}
 	return nil
 }
+
+// ValidateSymmetricRequest validates a symmetric active request of a peer.
+func ValidateSymmetricRequest(req *Packet) error {
+	li := req.LeapIndicator()
+	if li != LeapIndicatorNoWarning && li != LeapIndicatorUnknown {
+		return errUnexpectedRequest
+	}
+	if req.Version() != 4 || req.Mode() != ModeSymmetricActive {
+		return errUnexpectedRequest
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"net"
+	"sync"
 
 	"github.com/quic-go/quic-go"
 	"go.uber.org/zap"
@@ -20,12 +21,16 @@ type Fetcher struct {
 	Log       *zap.Logger
 	TLSConfig tls.Config
 	Port      string
-	QUIC      struct {
+	// Device is the network interface or VRF to which NTS-KE connections
+	// over TLS are bound, if not empty.
+	Device string
+	QUIC   struct {
 		Enabled    bool
 		DaemonAddr string
 		LocalAddr  udp.UDPAddr
 		RemoteAddr udp.UDPAddr
 	}
+	mu   sync.Mutex
 	data Data
 }
 
@@ -55,7 +60,7 @@ func (f *Fetcher) exchangeKeys() error {
 		var err error
 		var conn *tls.Conn
 		serverAddr := net.JoinHostPort(f.TLSConfig.ServerName, f.Port)
-		conn, f.data, err = dialTLS(serverAddr, &f.TLSConfig)
+		conn, f.data, err = dialTLS(serverAddr, &f.TLSConfig, f.Device)
 		if err != nil {
 			return err
 		}
@@ -82,7 +87,12 @@ func (f *Fetcher) exchangeKeys() error {
 	return nil
 }
 
+// FetchData returns the key exchange data for the next request, with a single
+// cookie. Keys are exchanged if no cookies are left. FetchData and StoreCookie
+// may be called concurrently.
 func (f *Fetcher) FetchData() (Data, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	if len(f.data.Cookie) == 0 {
 		err := f.exchangeKeys()
 		if err != nil {
@@ -95,5 +105,7 @@ func (f *Fetcher) FetchData() (Data, error) {
 }
 
 func (f *Fetcher) StoreCookie(cookie []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.data.Cookie = append(f.data.Cookie, cookie)
 }
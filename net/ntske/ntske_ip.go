@@ -11,6 +11,7 @@ import (
 	"go.uber.org/zap"
 
 	"example.com/scion-time/net/ntp"
+	"example.com/scion-time/net/udp"
 )
 
 func AcceptTLSConn(l net.Listener) (*tls.Conn, error) {
@@ -27,7 +28,7 @@ func AcceptTLSConn(l net.Listener) (*tls.Conn, error) {
 	return tlsConn, nil
 }
 
-func dialTLS(hostport string, config *tls.Config) (*tls.Conn, Data, error) {
+func dialTLS(hostport string, config *tls.Config, device string) (*tls.Conn, Data, error) {
 	config.NextProtos = []string{alpn}
 
 	_, _, err := net.SplitHostPort(hostport)
@@ -38,9 +39,13 @@ func dialTLS(hostport string, config *tls.Config) (*tls.Conn, Data, error) {
 		hostport = net.JoinHostPort(hostport, strconv.Itoa(ServerPortIP))
 	}
 
-	conn, err := tls.DialWithDialer(&net.Dialer{
+	dialer := &net.Dialer{
 		Timeout: time.Second * 5,
-	}, "tcp", hostport, config)
+	}
+	if device != "" {
+		dialer.Control = udp.BindToDeviceControl(device)
+	}
+	conn, err := tls.DialWithDialer(dialer, "tcp", hostport, config)
 	if err != nil {
 		return nil, Data{}, err
 	}
@@ -0,0 +1,150 @@
+package pcap
+
+// Capture of the packets sent and received by the time service for debugging,
+// e.g., with Wireshark. UDP payloads are written together with synthesized IP
+// and UDP headers and their kernel timestamps, if available, to a pcapng file.
+// The file may also be a named pipe to stream the packets live, e.g., to
+// `wireshark -k -i <pipe>`.
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+type writer struct {
+	mu  sync.Mutex
+	f   *os.File
+	w   *pcapgo.NgWriter
+	buf gopacket.SerializeBuffer
+}
+
+var capture atomic.Pointer[writer]
+
+// Open starts capturing packets to file name.
+func Open(name string) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	w, err := pcapgo.NewNgWriter(f, layers.LinkTypeRaw)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	err = w.Flush()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	old := capture.Swap(&writer{f: f, w: w, buf: gopacket.NewSerializeBuffer()})
+	if old != nil {
+		old.close()
+	}
+	return nil
+}
+
+// Close stops capturing packets.
+func Close() {
+	w := capture.Swap(nil)
+	if w != nil {
+		w.close()
+	}
+}
+
+func Enabled() bool {
+	return capture.Load() != nil
+}
+
+func (w *writer) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_ = w.w.Flush()
+	_ = w.f.Close()
+}
+
+// unmap returns the addresses of src and dst in the same address family.
+func unmap(src, dst netip.Addr) (netip.Addr, netip.Addr) {
+	src, dst = src.Unmap(), dst.Unmap()
+	if src.Is4() != dst.Is4() {
+		if !src.IsValid() || src.IsUnspecified() {
+			if dst.Is4() {
+				src = netip.IPv4Unspecified()
+			} else {
+				src = netip.IPv6Unspecified()
+			}
+		} else {
+			src, dst = netip.AddrFrom16(src.As16()), netip.AddrFrom16(dst.As16())
+		}
+	}
+	if !dst.IsValid() {
+		if src.Is4() {
+			dst = netip.IPv4Unspecified()
+		} else {
+			dst = netip.IPv6Unspecified()
+		}
+	}
+	return src, dst
+}
+
+// Write captures the UDP datagram with payload sent from src to dst at time t.
+// It does nothing if no capture is open.
+func Write(t time.Time, src, dst netip.AddrPort, payload []byte) {
+	w := capture.Load()
+	if w == nil {
+		return
+	}
+	srcAddr, dstAddr := unmap(src.Addr(), dst.Addr())
+	udp := &layers.UDP{
+		SrcPort: layers.UDPPort(src.Port()),
+		DstPort: layers.UDPPort(dst.Port()),
+	}
+	var ip gopacket.SerializableLayer
+	if srcAddr.Is4() {
+		ip4 := &layers.IPv4{
+			Version:  4,
+			TTL:      64,
+			Protocol: layers.IPProtocolUDP,
+			SrcIP:    net.IP(srcAddr.AsSlice()),
+			DstIP:    net.IP(dstAddr.AsSlice()),
+		}
+		_ = udp.SetNetworkLayerForChecksum(ip4)
+		ip = ip4
+	} else {
+		ip6 := &layers.IPv6{
+			Version:    6,
+			HopLimit:   64,
+			NextHeader: layers.IPProtocolUDP,
+			SrcIP:      net.IP(srcAddr.AsSlice()),
+			DstIP:      net.IP(dstAddr.AsSlice()),
+		}
+		_ = udp.SetNetworkLayerForChecksum(ip6)
+		ip = ip6
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := gopacket.SerializeLayers(w.buf,
+		gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true},
+		ip, udp, gopacket.Payload(payload))
+	if err != nil {
+		return
+	}
+	data := w.buf.Bytes()
+	err = w.w.WritePacket(gopacket.CaptureInfo{
+		Timestamp:     t,
+		CaptureLength: len(data),
+		Length:        len(data),
+	}, data)
+	if err != nil {
+		return
+	}
+	_ = w.w.Flush()
+}
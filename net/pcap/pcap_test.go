@@ -0,0 +1,57 @@
+package pcap_test
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"example.com/scion-time/net/pcap"
+)
+
+func TestWrite(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "ts.pcapng")
+	err := pcap.Open(name)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t0 := time.Unix(1700000000, 123456789)
+	src := netip.MustParseAddrPort("[::ffff:10.0.0.1]:123")
+	dst := netip.MustParseAddrPort("10.0.0.2:31000")
+	pcap.Write(t0, src, dst, []byte("payload"))
+	pcap.Close()
+	if pcap.Enabled() {
+		t.Fatal("capture still enabled after Close")
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := pcapgo.NewNgReader(f, pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		t.Fatalf("NewNgReader failed: %v", err)
+	}
+	data, ci, err := r.ReadPacketData()
+	if err != nil {
+		t.Fatalf("ReadPacketData failed: %v", err)
+	}
+	if !ci.Timestamp.Equal(t0) {
+		t.Errorf("timestamp = %v; want %v", ci.Timestamp, t0)
+	}
+	pkt := gopacket.NewPacket(data, layers.LayerTypeIPv4, gopacket.Default)
+	ip, ok := pkt.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	if !ok || ip.SrcIP.String() != "10.0.0.1" || ip.DstIP.String() != "10.0.0.2" {
+		t.Fatalf("unexpected IP layer: %v", pkt)
+	}
+	udp, ok := pkt.Layer(layers.LayerTypeUDP).(*layers.UDP)
+	if !ok || udp.SrcPort != 123 || udp.DstPort != 31000 || string(udp.Payload) != "payload" {
+		t.Errorf("unexpected UDP layer: %v", pkt)
+	}
+}
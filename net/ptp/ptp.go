@@ -0,0 +1,187 @@
+package ptp
+
+// Passive reception of PTP announce messages, see IEEE 1588-2019, Sections
+// 13.3 and 13.5, for the UTC offset and the leap second announcements of the
+// grandmaster, including alternate timescale offsets (Section 16.3).
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"go.uber.org/zap"
+)
+
+const (
+	GeneralPort = 320
+
+	headerLen   = 34
+	announceLen = 64
+	tlvHeadLen  = 4
+
+	MessageTypeAnnounce = 0xb
+
+	TLVTypeAlternateTimeOffsetIndicator = 0x0009
+
+	FlagLeap61                = 0x0001
+	FlagLeap59                = 0x0002
+	FlagCurrentUTCOffsetValid = 0x0004
+	FlagPTPTimescale          = 0x0008
+	FlagTimeTraceable         = 0x0010
+	FlagFrequencyTraceable    = 0x0020
+)
+
+// DefaultMulticastAddr is the IPv4 multicast address of PTP messages other
+// than peer delay messages.
+var DefaultMulticastAddr = net.IPv4(224, 0, 1, 129)
+
+// AlternateTimeOffset is the offset of an alternate timescale relative to the
+// PTP timescale, see IEEE 1588-2019, Section 16.3.3.
+type AlternateTimeOffset struct {
+	Key            uint8
+	CurrentOffset  int32  // in seconds
+	JumpSeconds    int32  // change of CurrentOffset at TimeOfNextJump
+	TimeOfNextJump uint64 // in seconds of the PTP timescale, 48 bits
+	DisplayName    string
+}
+
+type Announce struct {
+	Domain             uint8
+	Flags              uint16
+	SequenceID         uint16
+	CurrentUTCOffset   int16
+	GrandmasterID      uint64
+	StepsRemoved       uint16
+	TimeSource         uint8
+	AlternateTimescale []AlternateTimeOffset
+}
+
+var (
+	errUnexpectedMessage = errors.New("unexpected PTP message")
+	errUnexpectedTLV     = errors.New("unexpected PTP TLV")
+	errInvalidIdentity   = errors.New("invalid PTP clock identity")
+)
+
+// ParseClockIdentity parses a clock identity given as 16 hexadecimal digits,
+// optionally separated into groups by colons, dashes, or dots, e.g.,
+// "00:1b:21:ff:fe:12:34:56" or "001b21.fffe.123456".
+func ParseClockIdentity(s string) (uint64, error) {
+	var id uint64
+	n := 0
+	for i := 0; i != len(s); i++ {
+		c := s[i]
+		var d byte
+		switch {
+		case c >= '0' && c <= '9':
+			d = c - '0'
+		case c >= 'a' && c <= 'f':
+			d = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			d = c - 'A' + 10
+		case (c == ':' || c == '-' || c == '.') && i != 0 && i != len(s)-1:
+			continue
+		default:
+			return 0, errInvalidIdentity
+		}
+		id = id<<4 | uint64(d)
+		n++
+	}
+	if n != 16 {
+		return 0, errInvalidIdentity
+	}
+	return id, nil
+}
+
+// DecodeAnnounce parses the PTPv2 announce message in b including its TLVs.
+// TLVs other than alternate time offset indicators are skipped.
+func DecodeAnnounce(msg *Announce, b []byte) error {
+	if len(b) < announceLen || b[0]&0x0f != MessageTypeAnnounce || b[1]&0x0f != 2 {
+		return errUnexpectedMessage
+	}
+	n := int(binary.BigEndian.Uint16(b[2:]))
+	if n < announceLen || n > len(b) {
+		return errUnexpectedMessage
+	}
+	*msg = Announce{
+		Domain:           b[4],
+		Flags:            binary.BigEndian.Uint16(b[6:]),
+		SequenceID:       binary.BigEndian.Uint16(b[30:]),
+		CurrentUTCOffset: int16(binary.BigEndian.Uint16(b[44:])),
+		GrandmasterID:    binary.BigEndian.Uint64(b[53:]),
+		StepsRemoved:     binary.BigEndian.Uint16(b[61:]),
+		TimeSource:       b[63],
+	}
+	for pos := announceLen; pos != n; {
+		if n-pos < tlvHeadLen {
+			return errUnexpectedTLV
+		}
+		t := binary.BigEndian.Uint16(b[pos:])
+		l := int(binary.BigEndian.Uint16(b[pos+2:]))
+		if l > n-pos-tlvHeadLen {
+			return errUnexpectedTLV
+		}
+		v := b[pos+tlvHeadLen : pos+tlvHeadLen+l]
+		if t == TLVTypeAlternateTimeOffsetIndicator {
+			if len(v) < 16 || int(v[15]) > len(v)-16 {
+				return errUnexpectedTLV
+			}
+			msg.AlternateTimescale = append(msg.AlternateTimescale, AlternateTimeOffset{
+				Key:           v[0],
+				CurrentOffset: int32(binary.BigEndian.Uint32(v[1:])),
+				JumpSeconds:   int32(binary.BigEndian.Uint32(v[5:])),
+				TimeOfNextJump: uint64(binary.BigEndian.Uint16(v[9:]))<<32 |
+					uint64(binary.BigEndian.Uint32(v[11:])),
+				DisplayName: string(v[16 : 16+int(v[15])]),
+			})
+		}
+		pos += tlvHeadLen + l
+	}
+	return nil
+}
+
+// ListenAnnounce receives the PTP announce messages of domain multicast on
+// the network interface iface and passes them to handle until ctx is done.
+func ListenAnnounce(ctx context.Context, log *zap.Logger, iface string, domain uint8,
+	handle func(Announce)) error {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenMulticastUDP("udp4", ifi,
+		&net.UDPAddr{IP: DefaultMulticastAddr, Port: GeneralPort})
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+	go func() {
+		defer conn.Close()
+		buf := make([]byte, 1500)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Error("failed to read PTP message", zap.Error(err))
+				}
+				return
+			}
+			if n == 0 || buf[0]&0x0f != MessageTypeAnnounce {
+				continue
+			}
+			var msg Announce
+			err = DecodeAnnounce(&msg, buf[:n])
+			if err != nil {
+				log.Info("failed to decode PTP announce message", zap.Error(err))
+				continue
+			}
+			if msg.Domain != domain {
+				continue
+			}
+			handle(msg)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,72 @@
+package ptp_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"example.com/scion-time/net/ptp"
+)
+
+func TestDecodeAnnounce(t *testing.T) {
+	name := "JST"
+	tlv := make([]byte, 4+16+len(name)+1)
+	binary.BigEndian.PutUint16(tlv[0:], ptp.TLVTypeAlternateTimeOffsetIndicator)
+	binary.BigEndian.PutUint16(tlv[2:], uint16(len(tlv)-4))
+	tlv[4] = 1
+	binary.BigEndian.PutUint32(tlv[5:], 32400)
+	binary.BigEndian.PutUint32(tlv[9:], 0)
+	tlv[19] = byte(len(name))
+	copy(tlv[20:], name)
+
+	b := make([]byte, 64, 64+len(tlv))
+	b[0] = ptp.MessageTypeAnnounce
+	b[1] = 2
+	b[4] = 24
+	binary.BigEndian.PutUint16(b[6:], ptp.FlagCurrentUTCOffsetValid|ptp.FlagPTPTimescale|ptp.FlagLeap61)
+	binary.BigEndian.PutUint16(b[44:], 37)
+	binary.BigEndian.PutUint64(b[53:], 0x0123456789abcdef)
+	b = append(b, tlv...)
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)))
+
+	var msg ptp.Announce
+	err := ptp.DecodeAnnounce(&msg, b)
+	if err != nil {
+		t.Fatalf("DecodeAnnounce failed: %v", err)
+	}
+	if msg.Domain != 24 || msg.CurrentUTCOffset != 37 || msg.GrandmasterID != 0x0123456789abcdef ||
+		msg.Flags&ptp.FlagLeap61 == 0 {
+		t.Errorf("DecodeAnnounce() = %+v", msg)
+	}
+	if len(msg.AlternateTimescale) != 1 || msg.AlternateTimescale[0].CurrentOffset != 32400 ||
+		msg.AlternateTimescale[0].DisplayName != name {
+		t.Errorf("DecodeAnnounce() alternate timescales = %+v", msg.AlternateTimescale)
+	}
+
+	err = ptp.DecodeAnnounce(&msg, b[:len(b)-1])
+	if err == nil {
+		t.Errorf("DecodeAnnounce accepted truncated message")
+	}
+}
+
+func TestParseClockIdentity(t *testing.T) {
+	for _, tc := range []struct {
+		s  string
+		id uint64
+		ok bool
+	}{
+		{"001b21fffe123456", 0x001b21fffe123456, true},
+		{"00:1b:21:ff:fe:12:34:56", 0x001b21fffe123456, true},
+		{"00-1B-21-FF-FE-12-34-56", 0x001b21fffe123456, true},
+		{"001b21.fffe.123456", 0x001b21fffe123456, true},
+		{"001b21fffe1234", 0, false},
+		{"001b21fffe12345678", 0, false},
+		{":001b21fffe123456", 0, false},
+		{"001b21fffe12345g", 0, false},
+		{"", 0, false},
+	} {
+		id, err := ptp.ParseClockIdentity(tc.s)
+		if (err == nil) != tc.ok || id != tc.id {
+			t.Errorf("ParseClockIdentity(%q) = %x, %v; want %x, ok == %t", tc.s, id, err, tc.id, tc.ok)
+		}
+	}
+}
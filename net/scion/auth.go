@@ -1,7 +1,14 @@
 package scion
 
 import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+
 	"github.com/scionproto/scion/pkg/slayers"
+
+	"example.com/scion-time/net/scion/spao"
 )
 
 const (
@@ -20,9 +27,40 @@ const (
 	PacketAuthSPIServer = uint32(drkeyTypeHostHost)<<17 |
 		uint32(drkeyDirectionSenderSide)<<16 |
 		uint32(DRKeyProtocolTS)
-	PacketAuthAlgorithm = uint8(0) // AES-CMAC
+
+	packetAuthSeqLen  = 48 // bits of the SPAO timestamp/sequence number
+	packetAuthSeqMask = 1<<packetAuthSeqLen - 1
 )
 
+var (
+	ErrUnexpectedPacketAuthOpt = errors.New("unexpected authenticator option data")
+
+	// packetAuthSeq is the sequence number of the next AES-GMAC nonce. It
+	// starts with a random per-process prefix in its upper 16 bits so that
+	// nonces neither repeat within 2^48 packets nor, with high probability,
+	// across restarts.
+	packetAuthSeq atomic.Uint64
+)
+
+func init() {
+	var b [2]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		panic(err)
+	}
+	packetAuthSeq.Store(uint64(binary.BigEndian.Uint16(b[:])) << 32)
+}
+
+// ValidatePacketAuthOpt checks that a received authenticator option has the
+// expected length. It must be called before accessing the option's metadata
+// or MAC.
+func ValidatePacketAuthOpt(authOpt *slayers.EndToEndOption) error {
+	if authOpt == nil || len(authOpt.OptData) != PacketAuthOptDataLen {
+		return ErrUnexpectedPacketAuthOpt
+	}
+	return nil
+}
+
 func PacketAuthOptMetadata(authOpt *slayers.EndToEndOption) (spi uint32, algo uint8) {
 	authOptData := authOpt.OptData
 	if len(authOptData) != PacketAuthOptDataLen {
@@ -51,10 +89,17 @@ func PreparePacketAuthOpt(authOpt *slayers.EndToEndOption, spi uint32, algo uint
 	authOptData[2] = byte(spi >> 8)
 	authOptData[3] = byte(spi)
 	authOptData[4] = byte(algo)
-	// TODO: Timestamp and Sequence Number
+	// TODO: Timestamp
 	// See https://github.com/scionproto/scion/pull/4300
 	authOptData[5], authOptData[6], authOptData[7] = 0, 0, 0
 	authOptData[8], authOptData[9], authOptData[10], authOptData[11] = 0, 0, 0, 0
+	if algo == spao.AlgorithmAESGMAC {
+		// The option metadata is the AES-GMAC nonce and must not repeat
+		seq := packetAuthSeq.Add(1) & packetAuthSeqMask
+		authOptData[6], authOptData[7] = byte(seq>>40), byte(seq>>32)
+		authOptData[8], authOptData[9] = byte(seq>>24), byte(seq>>16)
+		authOptData[10], authOptData[11] = byte(seq>>8), byte(seq)
+	}
 	// Authenticator
 	authOptData[12], authOptData[13], authOptData[14], authOptData[15] = 0, 0, 0, 0
 	authOptData[16], authOptData[17], authOptData[18], authOptData[19] = 0, 0, 0, 0
@@ -0,0 +1,26 @@
+package scion_test
+
+import (
+	"testing"
+
+	"github.com/scionproto/scion/pkg/slayers"
+
+	"example.com/scion-time/net/scion"
+	"example.com/scion-time/net/scion/spao"
+)
+
+func TestPacketAuthNonceWrap(t *testing.T) {
+	nonces := make(map[string]bool)
+	for _, start := range []uint64{1<<24 - 4, 1<<32 - 4, 1<<40 - 4} {
+		scion.SetPacketAuthSeq(start)
+		for i := 0; i != 8; i++ {
+			authOpt := &slayers.EndToEndOption{OptData: make([]byte, scion.PacketAuthOptDataLen)}
+			scion.PreparePacketAuthOpt(authOpt, scion.PacketAuthSPIClient, spao.AlgorithmAESGMAC)
+			nonce := string(authOpt.OptData[:scion.PacketAuthMetadataLen])
+			if nonces[nonce] {
+				t.Fatalf("repeated nonce %x", nonce)
+			}
+			nonces[nonce] = true
+		}
+	}
+}
@@ -2,6 +2,7 @@ package scion
 
 import (
 	"context"
+	"time"
 
 	"github.com/scionproto/scion/pkg/daemon"
 	"github.com/scionproto/scion/pkg/drkey"
@@ -40,3 +41,24 @@ func FetchHostHostKey(ctx context.Context, dc daemon.Connector, meta drkey.HostH
 	drkey.HostHostKey, error) {
 	return dc.DRKeyGetHostHostKey(ctx, meta)
 }
+
+// AdjacentEpochs returns a point in time in the epoch before and one in the
+// epoch after e. Keys of these epochs are candidates for packets sent close to
+// an epoch boundary.
+func AdjacentEpochs(e drkey.Epoch) [2]time.Time {
+	return [2]time.Time{e.NotBefore.Add(-time.Nanosecond), e.NotAfter.Add(time.Nanosecond)}
+}
+
+// BoundaryEpochs returns the points in time of AdjacentEpochs(e) whose epoch
+// boundary is less than window away from t.
+func BoundaryEpochs(e drkey.Epoch, t time.Time, window time.Duration) []time.Time {
+	var ts []time.Time
+	adj := AdjacentEpochs(e)
+	if t.Sub(e.NotBefore) < window {
+		ts = append(ts, adj[0])
+	}
+	if e.NotAfter.Sub(t) < window {
+		ts = append(ts, adj[1])
+	}
+	return ts
+}
@@ -0,0 +1,142 @@
+package scion
+
+// Allocation-free encoding of SCION/UDP packets for the server's response path
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/slayers/path"
+	scionpath "github.com/scionproto/scion/pkg/slayers/path/scion"
+
+	"example.com/scion-time/net/udp"
+)
+
+var (
+	errInvalidHdrLen  = errors.New("invalid SCION header length")
+	errInvalidPayload = errors.New("invalid UDP payload length")
+	errInvalidRawPath = errors.New("invalid raw path")
+)
+
+// ReversePath reverses the path of s. Standard SCION paths are reversed in
+// place, without allocations; other path types are delegated to the path
+// implementation.
+func ReversePath(s *slayers.SCION) error {
+	p, ok := s.Path.(*scionpath.Raw)
+	if !ok {
+		var err error
+		s.Path, err = s.Path.Reverse()
+		return err
+	}
+	if p.NumINF == 0 || p.NumINF > scionpath.MaxINFs || p.NumHops == 0 ||
+		int(p.PathMeta.CurrINF) >= p.NumINF || int(p.PathMeta.CurrHF) >= p.NumHops ||
+		len(p.Raw) < scionpath.MetaLen+p.NumINF*path.InfoLen+p.NumHops*path.HopLen {
+		return errInvalidRawPath
+	}
+	infs := p.Raw[scionpath.MetaLen : scionpath.MetaLen+p.NumINF*path.InfoLen]
+	for i, j := 0, p.NumINF-1; i < j; i, j = i+1, j-1 {
+		swapFields(infs, i, j, path.InfoLen)
+		p.PathMeta.SegLen[i], p.PathMeta.SegLen[j] = p.PathMeta.SegLen[j], p.PathMeta.SegLen[i]
+	}
+	for i := 0; i < p.NumINF; i++ {
+		infs[i*path.InfoLen] ^= 0x1 // ConsDir flag
+	}
+	hfs := p.Raw[scionpath.MetaLen+p.NumINF*path.InfoLen:]
+	for i, j := 0, p.NumHops-1; i < j; i, j = i+1, j-1 {
+		swapFields(hfs, i, j, path.HopLen)
+	}
+	p.PathMeta.CurrINF = uint8(p.NumINF) - p.PathMeta.CurrINF - 1
+	p.PathMeta.CurrHF = uint8(p.NumHops) - p.PathMeta.CurrHF - 1
+	return p.PathMeta.SerializeTo(p.Raw[:scionpath.MetaLen])
+}
+
+func swapFields(b []byte, i, j, n int) {
+	x, y := b[i*n:(i+1)*n], b[j*n:(j+1)*n]
+	for k := 0; k != n; k++ {
+		x[k], y[k] = y[k], x[k]
+	}
+}
+
+// EncodeUDPPacket serializes a SCION/UDP packet with SCION header s, UDP ports
+// srcPort and dstPort, and payload into *b. The capacity of *b is reused and
+// only grown if required. Next header and length fields of s are updated.
+func EncodeUDPPacket(b *[]byte, s *slayers.SCION, srcPort, dstPort uint16, payload []byte) error {
+	hdrLen := slayers.CmnHdrLen + s.AddrHdrLen() + s.Path.Len()
+	if hdrLen > slayers.MaxHdrLen || hdrLen%slayers.LineLen != 0 {
+		return errInvalidHdrLen
+	}
+	udpLen := udp.HdrLen + len(payload)
+	if udpLen > 0xffff {
+		return errInvalidPayload
+	}
+	n := hdrLen + udpLen
+	if cap(*b) < n {
+		*b = make([]byte, n)
+	} else {
+		*b = (*b)[:n]
+	}
+	buf := *b
+
+	s.NextHdr = slayers.L4UDP
+	s.HdrLen = uint8(hdrLen / slayers.LineLen)
+	s.PayloadLen = uint16(udpLen)
+	binary.BigEndian.PutUint32(buf[0:],
+		uint32(s.Version&0xf)<<28|uint32(s.TrafficClass)<<20|s.FlowID&0xfffff)
+	buf[4] = uint8(s.NextHdr)
+	buf[5] = s.HdrLen
+	binary.BigEndian.PutUint16(buf[6:], s.PayloadLen)
+	buf[8] = uint8(s.PathType)
+	buf[9] = uint8(s.DstAddrType&0x7)<<4 | uint8(s.SrcAddrType&0x7)
+	buf[10], buf[11] = 0, 0
+	err := s.SerializeAddrHdr(buf[slayers.CmnHdrLen:])
+	if err != nil {
+		return err
+	}
+	err = s.Path.SerializeTo(buf[slayers.CmnHdrLen+s.AddrHdrLen() : hdrLen])
+	if err != nil {
+		return err
+	}
+
+	u := buf[hdrLen:]
+	binary.BigEndian.PutUint16(u[0:], srcPort)
+	binary.BigEndian.PutUint16(u[2:], dstPort)
+	binary.BigEndian.PutUint16(u[4:], uint16(udpLen))
+	u[6], u[7] = 0, 0
+	copy(u[udp.HdrLen:], payload)
+	binary.BigEndian.PutUint16(u[6:], checksum(s, u))
+	return nil
+}
+
+// checksum computes the UDP checksum over the SCION pseudo header of s and
+// the upper layer data b, see SCION header specification, Section 5.
+func checksum(s *slayers.SCION, b []byte) uint16 {
+	var csum uint32
+	var ia [addr.IABytes]byte
+	binary.BigEndian.PutUint64(ia[:], uint64(s.SrcIA))
+	csum = sum16(csum, ia[:])
+	binary.BigEndian.PutUint64(ia[:], uint64(s.DstIA))
+	csum = sum16(csum, ia[:])
+	csum = sum16(csum, s.RawSrcAddr)
+	csum = sum16(csum, s.RawDstAddr)
+	l := uint32(len(b))
+	csum += (l >> 16) + (l & 0xffff)
+	csum += uint32(slayers.L4UDP)
+	csum = sum16(csum, b)
+	for csum > 0xffff {
+		csum = (csum >> 16) + (csum & 0xffff)
+	}
+	return ^uint16(csum)
+}
+
+func sum16(csum uint32, b []byte) uint32 {
+	n := len(b) &^ 1
+	for i := 0; i < n; i += 2 {
+		csum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		csum += uint32(b[n]) << 8
+	}
+	return csum
+}
@@ -0,0 +1,134 @@
+package scion_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/slayers/path"
+	scionpath "github.com/scionproto/scion/pkg/slayers/path/scion"
+
+	"example.com/scion-time/net/scion"
+)
+
+func newRawPath(t *testing.T) *scionpath.Raw {
+	d := &scionpath.Decoded{
+		Base: scionpath.Base{
+			PathMeta: scionpath.MetaHdr{
+				CurrINF: 1,
+				CurrHF:  3,
+				SegLen:  [3]uint8{2, 2, 0},
+			},
+			NumINF:  2,
+			NumHops: 4,
+		},
+		InfoFields: []path.InfoField{
+			{SegID: 0x111, Timestamp: 0x100, ConsDir: false},
+			{SegID: 0x222, Timestamp: 0x200, ConsDir: true},
+		},
+		HopFields: []path.HopField{
+			{ExpTime: 63, ConsIngress: 0, ConsEgress: 1, Mac: [path.MacLen]byte{1, 2, 3, 4, 5, 6}},
+			{ExpTime: 63, ConsIngress: 2, ConsEgress: 0, Mac: [path.MacLen]byte{2, 3, 4, 5, 6, 7}},
+			{ExpTime: 63, ConsIngress: 0, ConsEgress: 3, Mac: [path.MacLen]byte{3, 4, 5, 6, 7, 8}},
+			{ExpTime: 63, ConsIngress: 4, ConsEgress: 0, Mac: [path.MacLen]byte{4, 5, 6, 7, 8, 9}},
+		},
+	}
+	b := make([]byte, d.Len())
+	err := d.SerializeTo(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &scionpath.Raw{}
+	err = p.DecodeFromBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func newSCIONLayer(t *testing.T, p *scionpath.Raw) *slayers.SCION {
+	s := &slayers.SCION{
+		Version:      0,
+		TrafficClass: 0xb8,
+		FlowID:       0x12345,
+		PathType:     scionpath.PathType,
+		Path:         p,
+		SrcIA:        addr.MustIAFrom(1, 0xff0000000111),
+		DstIA:        addr.MustIAFrom(1, 0xff0000000112),
+	}
+	err := s.SetSrcAddr(&net.IPAddr{IP: net.ParseIP("10.1.1.11").To4()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.SetDstAddr(&net.IPAddr{IP: net.ParseIP("fd00::12")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestReversePath(t *testing.T) {
+	p0 := newRawPath(t)
+	p1 := newRawPath(t)
+
+	expected, err := p0.Reverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSCIONLayer(t, p1)
+	err = scion.ReversePath(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b0 := make([]byte, expected.Len())
+	err = expected.SerializeTo(b0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1 := make([]byte, s.Path.Len())
+	err = s.Path.SerializeTo(b1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b0, b1) {
+		t.Errorf("ReversePath() = %x, want %x", b1, b0)
+	}
+}
+
+func TestEncodeUDPPacket(t *testing.T) {
+	payload := []byte{0x23, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+
+	s0 := newSCIONLayer(t, newRawPath(t))
+	s0.NextHdr = slayers.L4UDP
+	u := &slayers.UDP{SrcPort: 123, DstPort: 31000}
+	u.SetNetworkLayerForChecksum(s0)
+	buffer := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buffer,
+		gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true},
+		s0, u, gopacket.Payload(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s1 := newSCIONLayer(t, newRawPath(t))
+	var b []byte
+	err = scion.EncodeUDPPacket(&b, s1, 123, 31000, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, buffer.Bytes()) {
+		t.Errorf("EncodeUDPPacket() = %x, want %x", b, buffer.Bytes())
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = scion.EncodeUDPPacket(&b, s1, 123, 31000, payload)
+	})
+	if allocs != 0 {
+		t.Errorf("EncodeUDPPacket() allocates %v times per run", allocs)
+	}
+}
@@ -0,0 +1,6 @@
+package scion
+
+// SetPacketAuthSeq sets the sequence number of the next AES-GMAC nonce.
+func SetPacketAuthSeq(seq uint64) {
+	packetAuthSeq.Store(seq - 1)
+}
@@ -2,7 +2,10 @@ package scion
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
 	"os"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -40,9 +43,19 @@ func newFetcherMetrics() *fetcherMetrics {
 	}
 }
 
+const (
+	fetcherMaxEpochs        = 3 // number of cached epochs per key: previous, current, and next
+	fetcherRate             = 10.0
+	fetcherBurst            = 20.0
+	defaultMockKeysEpochLen = 12 * time.Hour
+)
+
 var (
-	fetcherMtrcs atomic.Pointer[fetcherMetrics]
-	useMockKeys  bool
+	errFetchRateLimited = errors.New("DRKey fetch rate limit exceeded")
+
+	fetcherMtrcs     atomic.Pointer[fetcherMetrics]
+	useMockKeys      bool
+	mockKeysEpochLen = defaultMockKeysEpochLen
 )
 
 func init() {
@@ -55,78 +68,187 @@ func UseMockKeys() bool {
 	return useMockKeys
 }
 
+// SetMockKeys enables or disables mock keys, which are derived locally instead
+// of being fetched from the SCION daemon. Mock key epochs have length
+// epochLen, e.g., a few seconds to simulate key rollovers in tests. It must be
+// called before any keys are fetched.
+func SetMockKeys(enabled bool, epochLen time.Duration) {
+	if epochLen <= 0 {
+		panic("invalid mock key epoch length")
+	}
+	useMockKeys = enabled
+	mockKeysEpochLen = epochLen
+}
+
+func mockEpoch(t time.Time) drkey.Epoch {
+	notBefore := t.Truncate(mockKeysEpochLen)
+	return drkey.Epoch{
+		Validity: cppki.Validity{
+			NotBefore: notBefore,
+			NotAfter:  notBefore.Add(mockKeysEpochLen - time.Nanosecond),
+		},
+	}
+}
+
+func mockHostASKey(meta drkey.HostASMeta) drkey.HostASKey {
+	hak := drkey.HostASKey{
+		ProtoId: meta.ProtoId,
+		SrcIA:   meta.SrcIA,
+		DstIA:   meta.DstIA,
+		Epoch:   mockEpoch(meta.Validity),
+		SrcHost: meta.SrcHost,
+	}
+	binary.BigEndian.PutUint64(hak.Key[:], uint64(hak.Epoch.NotBefore.UnixNano()))
+	return hak
+}
+
+// Fetcher fetches DRKeys from the SCION daemon and caches the host-AS keys of
+// the previous, current, and next epoch per AS and host. Requests to the SCION
+// daemon for host-AS keys are limited to fetcherRate per second with bursts of
+// up to fetcherBurst requests.
 type Fetcher struct {
-	dc   daemon.Connector
-	haks map[addr.IA]drkey.HostASKey
+	dc      daemon.Connector
+	mu      sync.Mutex
+	haks    map[addr.IA][]drkey.HostASKey
+	tokens  float64
+	updated time.Time
+	epoch   atomic.Int64
+}
+
+// ForceEpoch makes the fetcher fetch the keys of the epoch that contains t,
+// regardless of the validity time requested, e.g., to test key rollovers.
+// The zero time restores the default behavior.
+func (f *Fetcher) ForceEpoch(t time.Time) {
+	if t.IsZero() {
+		f.epoch.Store(0)
+	} else {
+		f.epoch.Store(t.UnixNano())
+	}
+}
+
+func (f *Fetcher) validity(t time.Time) time.Time {
+	if e := f.epoch.Load(); e != 0 {
+		return time.Unix(0, e)
+	}
+	return t
+}
+
+func matchHostASKey(hak drkey.HostASKey, meta drkey.HostASMeta) bool {
+	return hak.ProtoId == meta.ProtoId &&
+		hak.SrcIA == meta.SrcIA &&
+		hak.DstIA == meta.DstIA &&
+		hak.SrcHost == meta.SrcHost
+}
+
+func (f *Fetcher) lookupHostASKey(meta drkey.HostASMeta) (drkey.HostASKey, bool) {
+	for _, hak := range f.haks[meta.DstIA] {
+		if matchHostASKey(hak, meta) && hak.Epoch.Contains(meta.Validity) {
+			return hak, true
+		}
+	}
+	return drkey.HostASKey{}, false
+}
+
+func (f *Fetcher) insertHostASKey(meta drkey.HostASMeta, hak drkey.HostASKey) {
+	mtrcs := fetcherMtrcs.Load()
+	haks := f.haks[meta.DstIA]
+	n, oldest := 0, -1
+	for i, x := range haks {
+		if !matchHostASKey(x, meta) {
+			continue
+		}
+		if x.Epoch.NotBefore.Equal(hak.Epoch.NotBefore) {
+			haks[i] = hak
+			mtrcs.keysReplaced.Inc()
+			return
+		}
+		if oldest == -1 || x.Epoch.NotBefore.Before(haks[oldest].Epoch.NotBefore) {
+			oldest = i
+		}
+		n++
+	}
+	if n == fetcherMaxEpochs {
+		haks = append(haks[:oldest], haks[oldest+1:]...)
+		mtrcs.keysExpired.Inc()
+	}
+	f.haks[meta.DstIA] = append(haks, hak)
+	mtrcs.keysInserted.Inc()
+}
+
+// allowFetch reports whether a request to the SCION daemon is within the
+// fetch rate limit. It must be called with f.mu held.
+func (f *Fetcher) allowFetch(now time.Time) bool {
+	f.tokens += now.Sub(f.updated).Seconds() * fetcherRate
+	if f.tokens > fetcherBurst {
+		f.tokens = fetcherBurst
+	}
+	f.updated = now
+	if f.tokens < 1 {
+		return false
+	}
+	f.tokens--
+	return true
 }
 
 func (f *Fetcher) FetchHostASKey(ctx context.Context, meta drkey.HostASMeta) (
 	drkey.HostASKey, error) {
-	var err error
-	hak, ok := f.haks[meta.DstIA]
-	expired := ok && !hak.Epoch.Contains(meta.Validity)
-	if !ok || expired ||
-		hak.ProtoId != meta.ProtoId ||
-		hak.SrcIA != meta.SrcIA ||
-		hak.DstIA != meta.DstIA ||
-		hak.SrcHost != meta.SrcHost {
-		if useMockKeys {
-			now := time.Now()
-			hak = drkey.HostASKey{
-				ProtoId: meta.ProtoId,
-				SrcIA:   meta.SrcIA,
-				DstIA:   meta.DstIA,
-				Epoch: drkey.Epoch{
-					Validity: cppki.Validity{
-						NotBefore: now.Add(-6 * time.Hour),
-						NotAfter:  now.Add(6 * time.Hour),
-					},
-				},
-				SrcHost: meta.SrcHost,
-			}
-		} else {
-			hak, err = FetchHostASKey(ctx, f.dc, meta)
-		}
-		if err == nil {
-			f.haks[hak.DstIA] = hak
-			mtrcs := fetcherMtrcs.Load()
-			if !ok {
-				mtrcs.keysInserted.Inc()
-			} else {
-				if expired {
-					mtrcs.keysExpired.Inc()
-				}
-				mtrcs.keysReplaced.Inc()
-			}
+	meta.Validity = f.validity(meta.Validity)
+	f.mu.Lock()
+	hak, ok := f.lookupHostASKey(meta)
+	allowed := ok || useMockKeys || f.allowFetch(time.Now())
+	f.mu.Unlock()
+	if ok {
+		return hak, nil
+	}
+	if !allowed {
+		return drkey.HostASKey{}, errFetchRateLimited
+	}
+	if useMockKeys {
+		hak = mockHostASKey(meta)
+	} else {
+		var err error
+		hak, err = FetchHostASKey(ctx, f.dc, meta)
+		if err != nil {
+			return drkey.HostASKey{}, err
 		}
 	}
-	return hak, err
+	f.mu.Lock()
+	f.insertHostASKey(meta, hak)
+	f.mu.Unlock()
+	return hak, nil
+}
+
+// CachedHostASKey returns the host-AS key for meta if it is available without
+// a request to the SCION daemon.
+func (f *Fetcher) CachedHostASKey(meta drkey.HostASMeta) (drkey.HostASKey, bool) {
+	meta.Validity = f.validity(meta.Validity)
+	if useMockKeys {
+		return mockHostASKey(meta), true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lookupHostASKey(meta)
 }
 
 func (f *Fetcher) FetchHostHostKey(ctx context.Context, meta drkey.HostHostMeta) (
 	drkey.HostHostKey, error) {
+	meta.Validity = f.validity(meta.Validity)
 	if useMockKeys {
-		now := time.Now()
-		return drkey.HostHostKey{
-			ProtoId: meta.ProtoId,
-			SrcIA:   meta.SrcIA,
-			DstIA:   meta.DstIA,
-			Epoch: drkey.Epoch{
-				Validity: cppki.Validity{
-					NotBefore: now.Add(-6 * time.Hour),
-					NotAfter:  now.Add(6 * time.Hour),
-				},
-			},
-			SrcHost: meta.SrcHost,
-			DstHost: meta.DstHost,
-		}, nil
+		return DeriveHostHostKey(mockHostASKey(drkey.HostASMeta{
+			ProtoId:  meta.ProtoId,
+			Validity: meta.Validity,
+			SrcIA:    meta.SrcIA,
+			DstIA:    meta.DstIA,
+			SrcHost:  meta.SrcHost,
+		}), meta.DstHost)
 	}
 	return FetchHostHostKey(ctx, f.dc, meta)
 }
 
 func NewFetcher(c daemon.Connector) *Fetcher {
 	return &Fetcher{
-		dc:   c,
-		haks: make(map[addr.IA]drkey.HostASKey),
+		dc:     c,
+		haks:   make(map[addr.IA][]drkey.HostASKey),
+		tokens: fetcherBurst,
 	}
 }
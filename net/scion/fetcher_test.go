@@ -0,0 +1,167 @@
+package scion_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/daemon"
+	"github.com/scionproto/scion/pkg/drkey"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+
+	"example.com/scion-time/net/scion"
+)
+
+func TestFetcherEpochRollover(t *testing.T) {
+	defer scion.SetMockKeys(scion.UseMockKeys(), 12*time.Hour)
+	scion.SetMockKeys(true, time.Minute)
+
+	ctx := context.Background()
+	f := scion.NewFetcher(nil)
+	t0 := time.Unix(1700000000, 0)
+	meta := drkey.HostASMeta{
+		ProtoId:  scion.DRKeyProtocolTS,
+		Validity: t0,
+		SrcIA:    addr.MustIAFrom(1, 0xff0000000110),
+		DstIA:    addr.MustIAFrom(1, 0xff0000000111),
+		SrcHost:  "10.0.0.1",
+	}
+	hak0, err := f.FetchHostASKey(ctx, meta)
+	if err != nil {
+		t.Fatalf("FetchHostASKey failed: %v", err)
+	}
+	if !hak0.Epoch.Contains(t0) {
+		t.Fatalf("epoch %v does not contain %v", hak0.Epoch, t0)
+	}
+
+	f.ForceEpoch(t0.Add(time.Minute))
+	hak1, err := f.FetchHostASKey(ctx, meta)
+	if err != nil {
+		t.Fatalf("FetchHostASKey failed: %v", err)
+	}
+	f.ForceEpoch(time.Time{})
+	if hak1.Key == hak0.Key || !hak1.Epoch.Contains(t0.Add(time.Minute)) {
+		t.Errorf("forced epoch returned key of epoch %v", hak1.Epoch)
+	}
+
+	next := scion.AdjacentEpochs(hak0.Epoch)[1]
+	if !hak1.Epoch.Contains(next) {
+		t.Errorf("epoch %v does not contain next epoch time %v", hak1.Epoch, next)
+	}
+
+	hhk, err := f.FetchHostHostKey(ctx, drkey.HostHostMeta{
+		ProtoId:  meta.ProtoId,
+		Validity: next,
+		SrcIA:    meta.SrcIA,
+		DstIA:    meta.DstIA,
+		SrcHost:  meta.SrcHost,
+		DstHost:  "10.0.0.2",
+	})
+	if err != nil {
+		t.Fatalf("FetchHostHostKey failed: %v", err)
+	}
+	derived, err := scion.DeriveHostHostKey(hak1, "10.0.0.2")
+	if err != nil {
+		t.Fatalf("DeriveHostHostKey failed: %v", err)
+	}
+	if hhk.Key != derived.Key {
+		t.Error("host-host key does not match key derived from host-AS key")
+	}
+}
+
+// countingConnector serves host-AS keys of one hour epochs and counts the
+// requests made.
+type countingConnector struct {
+	daemon.Connector
+	n int
+}
+
+func (c *countingConnector) DRKeyGetHostASKey(ctx context.Context, meta drkey.HostASMeta) (
+	drkey.HostASKey, error) {
+	c.n++
+	notBefore := meta.Validity.Truncate(time.Hour)
+	hak := drkey.HostASKey{
+		ProtoId: meta.ProtoId,
+		SrcIA:   meta.SrcIA,
+		DstIA:   meta.DstIA,
+		SrcHost: meta.SrcHost,
+		Epoch: drkey.Epoch{Validity: cppki.Validity{
+			NotBefore: notBefore,
+			NotAfter:  notBefore.Add(time.Hour - time.Nanosecond),
+		}},
+	}
+	hak.Key[0] = byte(c.n)
+	return hak, nil
+}
+
+func TestFetcherCache(t *testing.T) {
+	ctx := context.Background()
+	dc := &countingConnector{}
+	f := scion.NewFetcher(dc)
+	t0 := time.Unix(1700000000, 0)
+	meta := drkey.HostASMeta{
+		ProtoId:  scion.DRKeyProtocolTS,
+		Validity: t0,
+		SrcIA:    addr.MustIAFrom(1, 0xff0000000110),
+		DstIA:    addr.MustIAFrom(1, 0xff0000000111),
+		SrcHost:  "10.0.0.1",
+	}
+	hosts := []string{"10.0.0.1", "10.0.0.2"}
+	for i := 0; i != 3; i++ {
+		for _, h := range hosts {
+			m := meta
+			m.SrcHost = h
+			_, err := f.FetchHostASKey(ctx, m)
+			if err != nil {
+				t.Fatalf("FetchHostASKey failed: %v", err)
+			}
+		}
+	}
+	if dc.n != len(hosts) {
+		t.Errorf("fetched %d keys; want %d", dc.n, len(hosts))
+	}
+}
+
+func TestFetcherRateLimit(t *testing.T) {
+	ctx := context.Background()
+	dc := &countingConnector{}
+	f := scion.NewFetcher(dc)
+	t0 := time.Unix(1700000000, 0)
+	meta := drkey.HostASMeta{
+		ProtoId: scion.DRKeyProtocolTS,
+		SrcIA:   addr.MustIAFrom(1, 0xff0000000110),
+		DstIA:   addr.MustIAFrom(1, 0xff0000000111),
+		SrcHost: "10.0.0.1",
+	}
+	var err error
+	for i := 0; i != 1000 && err == nil; i++ {
+		meta.Validity = t0.Add(time.Duration(i) * time.Hour)
+		_, err = f.FetchHostASKey(ctx, meta)
+	}
+	if err == nil {
+		t.Errorf("fetched %d keys without rate limit", dc.n)
+	}
+}
+
+func TestBoundaryEpochs(t *testing.T) {
+	t0 := time.Unix(1700000000, 0).Truncate(time.Hour)
+	e := drkey.Epoch{Validity: cppki.Validity{
+		NotBefore: t0,
+		NotAfter:  t0.Add(time.Hour - time.Nanosecond),
+	}}
+	adj := scion.AdjacentEpochs(e)
+	for _, tc := range []struct {
+		t    time.Time
+		want []time.Time
+	}{
+		{t0.Add(10 * time.Second), []time.Time{adj[0]}},
+		{t0.Add(30 * time.Minute), nil},
+		{t0.Add(time.Hour - 10*time.Second), []time.Time{adj[1]}},
+	} {
+		ts := scion.BoundaryEpochs(e, tc.t, time.Minute)
+		if len(ts) != len(tc.want) || len(ts) != 0 && !ts[0].Equal(tc.want[0]) {
+			t.Errorf("BoundaryEpochs(%v) = %v; want %v", tc.t, ts, tc.want)
+		}
+	}
+}
@@ -18,6 +18,7 @@ type Pather struct {
 	log     *zap.Logger
 	mu      sync.Mutex
 	localIA addr.IA
+	dstIAs  []addr.IA
 	paths   map[addr.IA][]snet.Path
 }
 
@@ -37,7 +38,27 @@ func (p *Pather) Paths(dst addr.IA) []snet.Path {
 	return append(make([]snet.Path, 0, len(paths)), paths...)
 }
 
-func update(ctx context.Context, p *Pather, dc daemon.Connector, dstIAs []addr.IA) {
+// AddDestination adds dstIA to the destinations for which paths are looked
+// up. Paths to dstIA are available after the next refresh.
+func (p *Pather) AddDestination(dstIA addr.IA) {
+	if dstIA.IsWildcard() {
+		panic("unexpected destination IA: wildcard.")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ia := range p.dstIAs {
+		if ia == dstIA {
+			return
+		}
+	}
+	p.dstIAs = append(p.dstIAs[:len(p.dstIAs):len(p.dstIAs)], dstIA)
+}
+
+func update(ctx context.Context, p *Pather, dc daemon.Connector) {
+	p.mu.Lock()
+	dstIAs := p.dstIAs
+	p.mu.Unlock()
+
 	localIA, err := dc.LocalIA(ctx)
 	if err != nil {
 		p.log.Info("failed to look up local IA", zap.Error(err))
@@ -63,14 +84,14 @@ func update(ctx context.Context, p *Pather, dc daemon.Connector, dstIAs []addr.I
 }
 
 func StartPather(ctx context.Context, log *zap.Logger, daemonAddr string, dstIAs []addr.IA) *Pather {
-	p := &Pather{log: log}
+	p := &Pather{log: log, dstIAs: dstIAs}
 	dc := NewDaemonConnector(ctx, daemonAddr)
-	update(ctx, p, dc, dstIAs)
-	go func(ctx context.Context, p *Pather, dc daemon.Connector, dstIAs []addr.IA) {
+	update(ctx, p, dc)
+	go func(ctx context.Context, p *Pather, dc daemon.Connector) {
 		ticker := time.NewTicker(pathRefreshPeriod)
 		for range ticker.C {
-			update(ctx, p, dc, dstIAs)
+			update(ctx, p, dc)
 		}
-	}(ctx, p, dc, dstIAs)
+	}(ctx, p, dc)
 	return p
 }
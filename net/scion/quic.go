@@ -411,7 +411,7 @@ func (c *clientConn) Close() error {
 }
 
 func dialUDP(ctx context.Context, localAddr, remoteAddr udp.UDPAddr, path snet.Path) (net.PacketConn, error) {
-	raw, err := net.ListenUDP("udp", &net.UDPAddr{IP: localAddr.Host.IP})
+	raw, err := ListenEndhostUDP(localAddr.Host.IP, "")
 	if err != nil {
 		return nil, err
 	}
@@ -420,7 +420,7 @@ func dialUDP(ctx context.Context, localAddr, remoteAddr udp.UDPAddr, path snet.P
 	if nextHop == nil && remoteAddr.IA == localAddr.IA {
 		nextHop = &net.UDPAddr{
 			IP:   remoteAddr.Host.IP,
-			Port: EndhostPort,
+			Port: UnderlayPort(remoteAddr.Host.Port),
 			Zone: remoteAddr.Host.Zone,
 		}
 	}
@@ -0,0 +1,216 @@
+package spao
+
+// MAC algorithms of the SCION Packet Authenticator Option (SPAO), see
+// https://docs.scion.org/en/latest/protocols/authenticator-option.html
+//
+// In addition to AES-CMAC, the algorithm defined by the specification, AES-GMAC
+// and HMAC-SHA256 are supported with algorithm numbers from the experimental
+// range. All MACs are 16 bytes long; HMAC-SHA256 is truncated accordingly.
+// AES-GMAC uses the 12 bytes of option metadata, including the sequence
+// number, as nonce.
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/slayers/path"
+	"github.com/scionproto/scion/pkg/slayers/path/empty"
+	"github.com/scionproto/scion/pkg/slayers/path/epic"
+	"github.com/scionproto/scion/pkg/slayers/path/onehop"
+	"github.com/scionproto/scion/pkg/slayers/path/scion"
+	"github.com/scionproto/scion/pkg/spao"
+)
+
+const (
+	AlgorithmAESCMAC    = uint8(slayers.PacketAuthCMAC)
+	AlgorithmAESGMAC    = uint8(253) // experimental
+	AlgorithmHMACSHA256 = uint8(254) // experimental
+
+	MACBufferSize = spao.MACBufferSize
+	MACLen        = 16
+
+	fixAuthDataInputLen = slayers.PacketAuthOptionMetadataLen + slayers.CmnHdrLen - slayers.LineLen
+)
+
+type MACInput = spao.MACInput
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported SPAO algorithm")
+
+	errInvalidHdrLen = errors.New("invalid SCION header length")
+
+	algorithm = AlgorithmAESCMAC
+
+	algorithmNames = map[string]uint8{
+		"aes-cmac":    AlgorithmAESCMAC,
+		"aes-gmac":    AlgorithmAESGMAC,
+		"hmac-sha256": AlgorithmHMACSHA256,
+	}
+)
+
+// ParseAlgorithm returns the algorithm with name s, i.e., "aes-cmac",
+// "aes-gmac", or "hmac-sha256".
+func ParseAlgorithm(s string) (uint8, error) {
+	algo, ok := algorithmNames[s]
+	if !ok {
+		return 0, ErrUnsupportedAlgorithm
+	}
+	return algo, nil
+}
+
+func Supported(algo uint8) bool {
+	return algo == AlgorithmAESCMAC || algo == AlgorithmAESGMAC || algo == AlgorithmHMACSHA256
+}
+
+// SetAlgorithm sets the algorithm used to authenticate outgoing packets that
+// are not responses to authenticated requests. It must be called before any
+// packets are authenticated.
+func SetAlgorithm(algo uint8) {
+	if !Supported(algo) {
+		panic("unsupported SPAO algorithm")
+	}
+	algorithm = algo
+}
+
+func Algorithm() uint8 {
+	return algorithm
+}
+
+// ComputeAuthMAC computes the authenticator of the packet described by input
+// with the algorithm given in the metadata of input.Header. The aux buffer
+// must be at least MACBufferSize long. The MAC is written to outBuffer and
+// returned as a slice of length MACLen.
+func ComputeAuthMAC(input MACInput, auxBuffer, outBuffer []byte) ([]byte, error) {
+	switch algo := uint8(input.Header.Algorithm()); algo {
+	case AlgorithmAESCMAC:
+		return spao.ComputeAuthCMAC(input, auxBuffer, outBuffer)
+	case AlgorithmAESGMAC:
+		n, err := serializeAuthenticatedData(auxBuffer, input)
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(input.Key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, n+len(input.Pld))
+		copy(data[copy(data, auxBuffer[:n]):], input.Pld)
+		nonce := input.Header.OptData[:slayers.PacketAuthOptionMetadataLen]
+		return aead.Seal(outBuffer[:0], nonce, nil, data), nil
+	case AlgorithmHMACSHA256:
+		n, err := serializeAuthenticatedData(auxBuffer, input)
+		if err != nil {
+			return nil, err
+		}
+		mac := hmac.New(sha256.New, input.Key)
+		mac.Write(auxBuffer[:n])
+		mac.Write(input.Pld)
+		return mac.Sum(outBuffer[:0])[:MACLen], nil
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedAlgorithm, algo)
+	}
+}
+
+// serializeAuthenticatedData writes the authenticated data of input, except
+// for the payload, to buf and returns its length, see
+// https://docs.scion.org/en/latest/protocols/authenticator-option.html#authenticated-data
+func serializeAuthenticatedData(buf []byte, input MACInput) (int, error) {
+	_ = buf[MACBufferSize-1]
+
+	s, opt := input.ScionLayer, input.Header
+	hdrLen := slayers.CmnHdrLen + s.AddrHdrLen() + s.Path.Len()
+	if hdrLen > slayers.MaxHdrLen || hdrLen%slayers.LineLen != 0 {
+		return 0, errInvalidHdrLen
+	}
+
+	buf[0] = byte(hdrLen / slayers.LineLen)
+	buf[1] = byte(input.PldType)
+	binary.BigEndian.PutUint16(buf[2:], uint16(len(input.Pld)))
+	buf[4] = byte(opt.Algorithm())
+	buf[5] = byte(opt.Timestamp() >> 16)
+	buf[6] = byte(opt.Timestamp() >> 8)
+	buf[7] = byte(opt.Timestamp())
+	buf[8] = 0
+	buf[9] = byte(opt.SequenceNumber() >> 16)
+	buf[10] = byte(opt.SequenceNumber() >> 8)
+	buf[11] = byte(opt.SequenceNumber())
+	binary.BigEndian.PutUint32(buf[12:],
+		uint32(s.Version&0xf)<<28|uint32(s.TrafficClass&0x3f)<<20|s.FlowID&0xfffff)
+	buf[16] = byte(s.PathType)
+	buf[17] = byte(s.DstAddrType&0x7)<<4 | byte(s.SrcAddrType&0x7)
+	binary.BigEndian.PutUint16(buf[18:], 0)
+	n := fixAuthDataInputLen
+
+	spi := opt.SPI()
+	if !spi.IsDRKey() {
+		binary.BigEndian.PutUint64(buf[n:], uint64(s.DstIA))
+		binary.BigEndian.PutUint64(buf[n+8:], uint64(s.SrcIA))
+		n += 16
+	}
+	if !spi.IsDRKey() ||
+		(spi.Type() == slayers.PacketAuthASHost && spi.Direction() == slayers.PacketAuthReceiverSide) {
+		n += copy(buf[n:], s.RawDstAddr)
+	}
+	if !spi.IsDRKey() ||
+		(spi.Type() == slayers.PacketAuthASHost && spi.Direction() == slayers.PacketAuthSenderSide) {
+		n += copy(buf[n:], s.RawSrcAddr)
+	}
+	err := zeroOutMutablePath(s.Path, buf[n:])
+	if err != nil {
+		return 0, err
+	}
+	n += s.Path.Len()
+	return n, nil
+}
+
+// zeroOutMutablePath serializes p to buf with the fields that are modified
+// en route set to zero.
+func zeroOutMutablePath(p path.Path, buf []byte) error {
+	err := p.SerializeTo(buf)
+	if err != nil {
+		return err
+	}
+	switch p := p.(type) {
+	case empty.Path:
+	case *scion.Raw:
+		zeroOutMutableFields(p.Base, buf)
+	case *scion.Decoded:
+		zeroOutMutableFields(p.Base, buf)
+	case *epic.Path:
+		zeroOutMutableFields(p.ScionPath.Base, buf[epic.MetadataLen:])
+	case *onehop.Path:
+		binary.BigEndian.PutUint16(buf[2:], 0) // SegID
+		buf[8] = 0                             // flags of the first hop field
+		for i := 20; i != 32; i++ {            // second hop field
+			buf[i] = 0
+		}
+	default:
+		return fmt.Errorf("unexpected path type %T", p)
+	}
+	return nil
+}
+
+func zeroOutMutableFields(base scion.Base, buf []byte) {
+	buf[0] = 0 // CurrINF and CurrHF
+	off := scion.MetaLen
+	for i := 0; i < base.NumINF; i++ {
+		binary.BigEndian.PutUint16(buf[off+2:], 0) // SegID
+		off += path.InfoLen
+	}
+	for i := 0; i < base.NumINF; i++ {
+		for j := 0; j < int(base.PathMeta.SegLen[i]); j++ {
+			buf[off] = 0 // flags of the hop field
+			off += path.HopLen
+		}
+	}
+}
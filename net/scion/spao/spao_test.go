@@ -0,0 +1,124 @@
+package spao
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/dchest/cmac"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/slayers/path"
+	scionpath "github.com/scionproto/scion/pkg/slayers/path/scion"
+)
+
+func newMACInput(t *testing.T, algo uint8) MACInput {
+	p := &scionpath.Decoded{
+		Base: scionpath.Base{
+			PathMeta: scionpath.MetaHdr{
+				CurrINF: 1,
+				CurrHF:  2,
+				SegLen:  [3]uint8{2, 1, 0},
+			},
+			NumINF:  2,
+			NumHops: 3,
+		},
+		InfoFields: []path.InfoField{
+			{SegID: 0x111, Timestamp: 0x100},
+			{SegID: 0x222, Timestamp: 0x200, ConsDir: true},
+		},
+		HopFields: []path.HopField{
+			{ExpTime: 63, ConsIngress: 0, ConsEgress: 1, EgressRouterAlert: true},
+			{ExpTime: 63, ConsIngress: 2, ConsEgress: 0},
+			{ExpTime: 63, ConsIngress: 0, ConsEgress: 3},
+		},
+	}
+	s := &slayers.SCION{
+		FlowID:   0x12345,
+		PathType: scionpath.PathType,
+		Path:     p,
+		SrcIA:    addr.MustIAFrom(1, 0xff0000000111),
+		DstIA:    addr.MustIAFrom(1, 0xff0000000112),
+	}
+	err := s.SetSrcAddr(&net.IPAddr{IP: net.ParseIP("10.1.1.11").To4()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.SetDstAddr(&net.IPAddr{IP: net.ParseIP("10.1.1.12").To4()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt, err := slayers.NewPacketAuthOption(slayers.PacketAuthOptionParams{
+		SPI:            slayers.PacketAuthSPI(1<<17 | 123),
+		Algorithm:      slayers.PacketAuthAlg(algo),
+		SequenceNumber: 42,
+		Auth:           make([]byte, MACLen),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return MACInput{
+		Key:        bytes.Repeat([]byte{0x2a}, 16),
+		Header:     opt,
+		ScionLayer: s,
+		PldType:    slayers.L4UDP,
+		Pld:        []byte("payload"),
+	}
+}
+
+func TestSerializeAuthenticatedData(t *testing.T) {
+	input := newMACInput(t, AlgorithmAESCMAC)
+	buf := make([]byte, MACBufferSize)
+	expected, err := ComputeAuthMAC(input, buf, make([]byte, MACLen))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := serializeAuthenticatedData(buf, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(input.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac, err := cmac.New(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac.Write(buf[:n])
+	mac.Write(input.Pld)
+	if !bytes.Equal(mac.Sum(nil), expected) {
+		t.Error("authenticated data differs from the reference implementation")
+	}
+}
+
+func TestComputeAuthMAC(t *testing.T) {
+	for _, algo := range []uint8{AlgorithmAESCMAC, AlgorithmAESGMAC, AlgorithmHMACSHA256} {
+		input := newMACInput(t, algo)
+		buf := make([]byte, MACBufferSize)
+		mac0, err := ComputeAuthMAC(input, buf, make([]byte, MACLen))
+		if err != nil {
+			t.Fatalf("ComputeAuthMAC(%d) failed: %v", algo, err)
+		}
+		if len(mac0) != MACLen {
+			t.Errorf("ComputeAuthMAC(%d) returned %d bytes", algo, len(mac0))
+		}
+		input.Pld = []byte("Payload")
+		mac1, err := ComputeAuthMAC(input, buf, make([]byte, MACLen))
+		if err != nil {
+			t.Fatalf("ComputeAuthMAC(%d) failed: %v", algo, err)
+		}
+		if bytes.Equal(mac0, mac1) {
+			t.Errorf("ComputeAuthMAC(%d) does not authenticate the payload", algo)
+		}
+	}
+
+	input := newMACInput(t, 1)
+	_, err := ComputeAuthMAC(input, make([]byte, MACBufferSize), make([]byte, MACLen))
+	if !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Errorf("ComputeAuthMAC(1) = %v; want %v", err, ErrUnsupportedAlgorithm)
+	}
+}
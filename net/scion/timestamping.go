@@ -1,5 +1,120 @@
 package scion
 
+// End-to-end timestamp options. Dispatchers forward the RX timestamp of a
+// packet to the end host in an OptTypeTimestamp option whose data is the
+// socket control message carrying the timestamp, see udp.TimestampFromOOBData.
+//
+// Servers include the kernel or hardware RX timestamp of a request in an
+// OptTypeServerTimestamp option of the response if the request carries a
+// capability option of the same type. The option data starts with a header of
+// the format version, the kind of the option, and two reserved bytes. The
+// capability announces the highest format version the client accepts, and the
+// server responds in the highest version both support. In version 1, the
+// timestamp follows the header as 8 bytes of seconds and 4 bytes of
+// nanoseconds since the Unix epoch, all in network byte order.
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/scionproto/scion/pkg/slayers"
+)
+
 const (
-	OptTypeTimestamp = 253 // experimental
+	OptTypeTimestamp       = 253 // experimental
+	OptTypeServerTimestamp = 254 // experimental
+
+	// TimestampOptVersion is the highest supported format version of
+	// OptTypeServerTimestamp options.
+	TimestampOptVersion = 1
+
+	timestampKindCapability = 0
+	timestampKindServerRX   = 1
+
+	timestampOptHdrLen  = 4
+	timestampOptDataLen = timestampOptHdrLen + 12
 )
+
+var errUnexpectedTimestampOpt = errors.New("unexpected timestamp option data")
+
+func prepareTimestampOpt(opt *slayers.EndToEndOption, n int) []byte {
+	if cap(opt.OptData) < n {
+		opt.OptData = make([]byte, n)
+	}
+	opt.OptType = OptTypeServerTimestamp
+	opt.OptData = opt.OptData[:n]
+	opt.OptAlign[0] = 0
+	opt.OptAlign[1] = 0
+	opt.OptDataLen = 0
+	opt.ActualLength = 0
+	return opt.OptData
+}
+
+// PrepareTimestampCapabilityOpt sets up opt as capability option announcing
+// that server RX timestamps up to TimestampOptVersion are accepted.
+func PrepareTimestampCapabilityOpt(opt *slayers.EndToEndOption) {
+	b := prepareTimestampOpt(opt, timestampOptHdrLen)
+	b[0] = TimestampOptVersion
+	b[1] = timestampKindCapability
+	b[2], b[3] = 0, 0
+}
+
+// PrepareServerTimestampOpt sets up opt as server RX timestamp option with
+// timestamp t in format version, see TimestampCapability.
+func PrepareServerTimestampOpt(opt *slayers.EndToEndOption, version uint8, t time.Time) {
+	if version != 1 {
+		panic("unexpected timestamp option version")
+	}
+	b := prepareTimestampOpt(opt, timestampOptDataLen)
+	b[0] = version
+	b[1] = timestampKindServerRX
+	b[2], b[3] = 0, 0
+	binary.BigEndian.PutUint64(b[4:], uint64(t.Unix()))
+	binary.BigEndian.PutUint32(b[12:], uint32(t.Nanosecond()))
+}
+
+// TimestampCapability returns the format version of server RX timestamps
+// negotiated by the first capability option in opts and reports whether
+// there is one.
+func TimestampCapability(opts []*slayers.EndToEndOption) (uint8, bool) {
+	for _, opt := range opts {
+		b := opt.OptData
+		if opt.OptType != OptTypeServerTimestamp || len(b) < timestampOptHdrLen ||
+			b[1] != timestampKindCapability || b[0] == 0 {
+			continue
+		}
+		if b[0] > TimestampOptVersion {
+			return TimestampOptVersion, true
+		}
+		return b[0], true
+	}
+	return 0, false
+}
+
+// ServerTimestampOpt returns the timestamp of server RX timestamp option opt.
+func ServerTimestampOpt(opt *slayers.EndToEndOption) (time.Time, error) {
+	b := opt.OptData
+	if opt.OptType != OptTypeServerTimestamp || len(b) != timestampOptDataLen ||
+		b[0] != 1 || b[1] != timestampKindServerRX {
+		return time.Time{}, errUnexpectedTimestampOpt
+	}
+	sec := binary.BigEndian.Uint64(b[4:])
+	nsec := binary.BigEndian.Uint32(b[12:])
+	if sec > 1<<63-1 || nsec >= 1e9 {
+		return time.Time{}, errUnexpectedTimestampOpt
+	}
+	return time.Unix(int64(sec), int64(nsec)), nil
+}
+
+// FindServerTimestampOpt returns the timestamp of the first valid server RX
+// timestamp option in opts and reports whether there is one.
+func FindServerTimestampOpt(opts []*slayers.EndToEndOption) (time.Time, bool) {
+	for _, opt := range opts {
+		t, err := ServerTimestampOpt(opt)
+		if err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,63 @@
+package scion_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/slayers"
+
+	"example.com/scion-time/net/scion"
+)
+
+func TestServerTimestampOptRoundTrip(t *testing.T) {
+	ts := time.Unix(1700000000, 123456789)
+	opt := &slayers.EndToEndOption{}
+	scion.PrepareServerTimestampOpt(opt, 1, ts)
+	ts0, err := scion.ServerTimestampOpt(opt)
+	if err != nil {
+		t.Fatalf("ServerTimestampOpt failed: %v", err)
+	}
+	if !ts0.Equal(ts) {
+		t.Errorf("ServerTimestampOpt = %v; want %v", ts0, ts)
+	}
+
+	// Options of other types and kinds are skipped
+	capOpt := &slayers.EndToEndOption{}
+	scion.PrepareTimestampCapabilityOpt(capOpt)
+	localOpt := &slayers.EndToEndOption{OptType: scion.OptTypeTimestamp, OptData: make([]byte, 16)}
+	opts := []*slayers.EndToEndOption{localOpt, capOpt, opt}
+	if ts0, ok := scion.FindServerTimestampOpt(opts); !ok || !ts0.Equal(ts) {
+		t.Errorf("FindServerTimestampOpt = %v, %t; want %v, true", ts0, ok, ts)
+	}
+	if _, ok := scion.FindServerTimestampOpt(opts[:2]); ok {
+		t.Error("FindServerTimestampOpt found timestamp in capability option")
+	}
+
+	opt.OptData[12] = 0xff // nanoseconds out of range
+	if _, err := scion.ServerTimestampOpt(opt); err == nil {
+		t.Error("ServerTimestampOpt accepted invalid nanoseconds")
+	}
+}
+
+func TestTimestampCapability(t *testing.T) {
+	capOpt := &slayers.EndToEndOption{}
+	scion.PrepareTimestampCapabilityOpt(capOpt)
+	if v, ok := scion.TimestampCapability([]*slayers.EndToEndOption{capOpt}); !ok || v != scion.TimestampOptVersion {
+		t.Errorf("TimestampCapability = %d, %t; want %d, true", v, ok, scion.TimestampOptVersion)
+	}
+
+	// Later versions announced by clients are answered in the supported one
+	capOpt.OptData[0] = scion.TimestampOptVersion + 1
+	if v, ok := scion.TimestampCapability([]*slayers.EndToEndOption{capOpt}); !ok || v != scion.TimestampOptVersion {
+		t.Errorf("TimestampCapability = %d, %t; want %d, true", v, ok, scion.TimestampOptVersion)
+	}
+
+	rxtOpt := &slayers.EndToEndOption{}
+	scion.PrepareServerTimestampOpt(rxtOpt, 1, time.Unix(0, 0))
+	if _, ok := scion.TimestampCapability([]*slayers.EndToEndOption{rxtOpt}); ok {
+		t.Error("TimestampCapability found capability in timestamp option")
+	}
+	if _, ok := scion.TimestampCapability(nil); ok {
+		t.Error("TimestampCapability found capability without options")
+	}
+}
@@ -1,9 +1,120 @@
 package scion
 
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/scionproto/scion/pkg/snet"
+
+	"example.com/scion-time/net/udp"
+)
+
 const (
 	EndhostPort = 30041
 
+	// Default range of end host ports to which border routers deliver packets
+	// directly, i.e., without going through the dispatcher.
+	EndhostPortRangeMin = 31000
+	EndhostPortRangeMax = 32767
+
 	// MTU supported by SCION.
 	// It's chosen as a common ethernet jumbo frame size minus IP/UDP headers.
-	MTU = 9216 - 20 - 8
+	MTU = udp.MaxPayloadLen
+)
+
+type PortRange struct {
+	Min, Max int
+}
+
+var (
+	errInvalidPortRange = errors.New("invalid port range")
+
+	endhostPortRange atomic.Pointer[PortRange]
 )
+
+func ParsePortRange(s string) (PortRange, error) {
+	lo, hi, ok := strings.Cut(s, "-")
+	if !ok {
+		return PortRange{}, errInvalidPortRange
+	}
+	min, err := strconv.Atoi(strings.TrimSpace(lo))
+	if err != nil {
+		return PortRange{}, errInvalidPortRange
+	}
+	max, err := strconv.Atoi(strings.TrimSpace(hi))
+	if err != nil {
+		return PortRange{}, errInvalidPortRange
+	}
+	r := PortRange{Min: min, Max: max}
+	if r.Min <= 0 || r.Max > 65535 || r.Min > r.Max {
+		return PortRange{}, errInvalidPortRange
+	}
+	return r, nil
+}
+
+// PathMTU returns the maximum size of SCION packets sent via p: the MTU from
+// the path metadata if available, MTU otherwise.
+func PathMTU(p snet.Path) int {
+	md := p.Metadata()
+	if md == nil || md.MTU == 0 || int(md.MTU) > MTU {
+		return MTU
+	}
+	return int(md.MTU)
+}
+
+func (r PortRange) Contains(port int) bool {
+	return r.Min <= port && port <= r.Max
+}
+
+func (r PortRange) String() string {
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// SetEndhostPortRange enables dispatcherless operation: border routers are
+// expected to deliver packets for ports in r directly to the end host.
+func SetEndhostPortRange(r PortRange) {
+	endhostPortRange.Store(&r)
+}
+
+func EndhostPortRange() (PortRange, bool) {
+	r := endhostPortRange.Load()
+	if r == nil {
+		return PortRange{}, false
+	}
+	return *r, true
+}
+
+// UnderlayPort returns the underlay port on which an end host receives SCION
+// packets addressed to the given SCION/UDP port.
+func UnderlayPort(port int) int {
+	r, ok := EndhostPortRange()
+	if ok && r.Contains(port) {
+		return port
+	}
+	return EndhostPort
+}
+
+// ListenEndhostUDP listens on an arbitrary local port. In dispatcherless mode
+// the port is chosen from the configured end host port range.
+func ListenEndhostUDP(ip net.IP, zone string) (*net.UDPConn, error) {
+	r, ok := EndhostPortRange()
+	if !ok {
+		return net.ListenUDP("udp", &net.UDPAddr{IP: ip, Zone: zone})
+	}
+	n := r.Max - r.Min + 1
+	p := rand.Intn(n)
+	var err error
+	for i := 0; i != n; i++ {
+		var conn *net.UDPConn
+		conn, err = net.ListenUDP("udp", &net.UDPAddr{IP: ip, Port: r.Min + (p+i)%n, Zone: zone})
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
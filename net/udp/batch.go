@@ -0,0 +1,58 @@
+package udp
+
+import (
+	"net"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Message is a packet with its out of band data, see BatchConn.
+type Message = ipv4.Message
+
+type batchReadWriter interface {
+	ReadBatch(ms []Message, flags int) (int, error)
+	WriteBatch(ms []Message, flags int) (int, error)
+}
+
+// BatchConn reads and writes batches of packets on a UDP connection using a
+// single system call per batch where supported (recvmmsg/sendmmsg on Linux).
+type BatchConn struct {
+	conn batchReadWriter
+}
+
+func NewBatchConn(conn *net.UDPConn) *BatchConn {
+	if conn.LocalAddr().(*net.UDPAddr).IP.To4() != nil {
+		return &BatchConn{conn: ipv4.NewPacketConn(conn)}
+	}
+	return &BatchConn{conn: ipv6.NewPacketConn(conn)}
+}
+
+// NewMessages allocates n messages with payload buffers of size bufLen and
+// out of band data buffers sized for timestamps and segment sizes.
+func NewMessages(n, bufLen int) []Message {
+	ms := make([]Message, n)
+	for i := range ms {
+		ms[i].Buffers = [][]byte{make([]byte, bufLen)}
+		ms[i].OOB = make([]byte, TimestampLen()+SegmentLen())
+	}
+	return ms
+}
+
+// ReadBatch reads at least one and at most len(ms) packets and returns the
+// number of messages received.
+func (c *BatchConn) ReadBatch(ms []Message) (int, error) {
+	return c.conn.ReadBatch(ms, 0)
+}
+
+// WriteBatch writes all packets in ms.
+func (c *BatchConn) WriteBatch(ms []Message) error {
+	for len(ms) != 0 {
+		n, err := c.conn.WriteBatch(ms, 0)
+		if err != nil {
+			return err
+		}
+		ms = ms[n:]
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package udp
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -8,16 +9,27 @@ import (
 	"github.com/scionproto/scion/pkg/addr"
 	"github.com/scionproto/scion/pkg/snet"
 
-	"golang.org/x/sys/unix"
+	"example.com/scion-time/base/crypto"
 )
 
 const (
 	HdrLen = 8
+
+	// Largest UDP payload on an IPv4 link with a common ethernet jumbo frame
+	// size.
+	MaxPayloadLen = 9216 - 20 - HdrLen
+
+	// IANA dynamic port range, see RFC 6335, section 6
+	dynamicPortMin = 49152
+	dynamicPortMax = 65535
+
+	maxNumListenAttempts = 32
 )
 
 var (
 	errTimestampNotFound = errors.New("failed to read timestamp from out of band data")
 	errUnexpectedData    = errors.New("failed to read out of band data")
+	errTTLNotFound       = errors.New("failed to read TTL from out of band data")
 )
 
 type UDPAddr struct {
@@ -41,38 +53,41 @@ func UDPAddrFromSnet(a *snet.UDPAddr) UDPAddr {
 	return UDPAddr{a.IA, snet.CopyUDPAddr(a.Host)}
 }
 
-// Timestamp handling based on studying code from the following projects:
-// - https://github.com/bsdphk/Ntimed, file udp.c
-// - https://github.com/golang/go, package "golang.org/x/sys/unix"
-// - https://github.com/google/gopacket, package "github.com/google/gopacket/pcapgo"
-// - https://github.com/facebook/time, package "github.com/facebook/time/ntp/protocol/ntp"
-
-func TimestampLen() int {
-	return unix.CmsgSpace(3 * 16)
-}
-
-func SetDSCP(conn *net.UDPConn, dscp uint8) error {
-	// Based on Meta's time libraries at https://github.com/facebook/time
-	if dscp > 63 {
-		panic("invalid argument: dscp must not be greater than 63")
+// ListenRandomPort listens on ip and a local port chosen
+// uniformly at random from the dynamic port range by a cryptographically
+// secure random number generator. This makes it harder for off-path attackers
+// to guess the port of a pending request. If device is not empty, the socket is
+// bound to the named network interface or VRF, see BindToDeviceControl.
+func ListenRandomPort(ctx context.Context, ip net.IP, device string) (*net.UDPConn, error) {
+	var lc net.ListenConfig
+	if device != "" {
+		lc.Control = BindToDeviceControl(device)
 	}
-	sconn, err := conn.SyscallConn()
-	if err != nil {
-		return err
-	}
-	var res struct {
-		err error
+	var err error
+	for i := 0; i != maxNumListenAttempts; i++ {
+		var n int
+		n, err = crypto.RandIntn(ctx, dynamicPortMax-dynamicPortMin+1)
+		if err != nil {
+			return nil, err
+		}
+		var conn net.PacketConn
+		conn, err = lc.ListenPacket(ctx, "udp", (&net.UDPAddr{IP: ip, Port: dynamicPortMin + n}).String())
+		if err == nil {
+			return conn.(*net.UDPConn), nil
+		}
 	}
-	err = sconn.Control(func(fd uintptr) {
-		ip := conn.LocalAddr().(*net.UDPAddr).IP
-		if ip.To4() == nil {
-			res.err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_TCLASS, int(dscp<<2))
-		} else {
-			res.err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_TOS, int(dscp<<2))
+	return nil, err
+}
+
+// AppendSegments splits the payload b of a packet received with segment size
+// n, see SegmentSizeFromOOBData, into the payloads of the coalesced packets and
+// appends them to segs. The capacity of each segment is limited to its length.
+func AppendSegments(segs [][]byte, b []byte, n int) [][]byte {
+	if n > 0 {
+		for len(b) > n {
+			segs = append(segs, b[:n:n])
+			b = b[n:]
 		}
-	})
-	if err != nil {
-		return err
 	}
-	return res.err
+	return append(segs, b[:len(b):len(b)])
 }
@@ -5,6 +5,8 @@ import (
 
 	"errors"
 	"net"
+	"net/netip"
+	"syscall"
 	"time"
 
 	"golang.org/x/sys/unix"
@@ -49,6 +51,12 @@ func TimestampFromOOBData(oob []byte) (time.Time, error) {
 	return time.Time{}, errTimestampNotFound
 }
 
+// SoftwareTimestampFromOOBData returns the RX timestamp in oob, which is always
+// a software timestamp.
+func SoftwareTimestampFromOOBData(oob []byte) (time.Time, error) {
+	return TimestampFromOOBData(oob)
+}
+
 func EnableTimestamping(conn *net.UDPConn, iface string) error {
 	return errUnsupportedOperation
 }
@@ -56,3 +64,58 @@ func EnableTimestamping(conn *net.UDPConn, iface string) error {
 func ReadTXTimestamp(conn *net.UDPConn) (time.Time, uint32, error) {
 	return time.Time{}, 0, errUnsupportedOperation
 }
+
+func SetBusyPoll(conn *net.UDPConn, d time.Duration) error {
+	return errUnsupportedOperation
+}
+
+func SetPriority(conn *net.UDPConn, prio int) error {
+	return errUnsupportedOperation
+}
+
+func EnableRecvTTL(conn *net.UDPConn) error {
+	return errUnsupportedOperation
+}
+
+func TTLFromOOBData(oob []byte) (int, error) {
+	return 0, errUnsupportedOperation
+}
+
+func EnableGRO(conn *net.UDPConn) error {
+	return errUnsupportedOperation
+}
+
+func SegmentSizeFromOOBData(oob []byte) (int, bool) {
+	return 0, false
+}
+
+func WriteSegments(conn *net.UDPConn, b []byte, n int, addr netip.AddrPort) error {
+	return errUnsupportedOperation
+}
+
+// BindToDeviceControl returns a control function for net.ListenConfig and
+// net.Dialer that binds sockets to the network interface named device, see
+// IP_BOUND_IF and IPV6_BOUND_IF.
+func BindToDeviceControl(device string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		ifi, err := net.InterfaceByName(device)
+		if err != nil {
+			return err
+		}
+		var res struct {
+			err error
+		}
+		err = c.Control(func(fd uintptr) {
+			switch network {
+			case "tcp4", "udp4":
+				res.err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_BOUND_IF, ifi.Index)
+			default:
+				res.err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_BOUND_IF, ifi.Index)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return res.err
+	}
+}
@@ -0,0 +1,157 @@
+package udp
+
+import (
+	"unsafe"
+
+	"errors"
+	"net"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	errUnsupportedOperation = errors.New("unsupported operation")
+)
+
+// EnableRxTimestamps enables kernel timestamps of received packets with
+// nanosecond resolution, see SO_TS_CLOCK in setsockopt(2).
+func EnableRxTimestamps(conn *net.UDPConn) error {
+	sconn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var res struct {
+		err error
+	}
+	err = sconn.Control(func(fd uintptr) {
+		res.err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_TS_CLOCK, unix.SO_TS_REALTIME)
+		if res.err != nil {
+			return
+		}
+		res.err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_TIMESTAMP, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return res.err
+}
+
+func TimestampFromOOBData(oob []byte) (time.Time, error) {
+	for unix.CmsgSpace(0) <= len(oob) {
+		h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		if h.Len < unix.SizeofCmsghdr || uint64(h.Len) > uint64(len(oob)) {
+			return time.Time{}, errUnexpectedData
+		}
+		if h.Level == unix.SOL_SOCKET {
+			switch h.Type {
+			case unix.SCM_REALTIME:
+				if h.Len != uint32(unix.CmsgLen(int(unsafe.Sizeof(unix.Timespec{})))) {
+					return time.Time{}, errUnexpectedData
+				}
+				ts := (*unix.Timespec)(unsafe.Pointer(&oob[unix.CmsgSpace(0)]))
+				return time.Unix(ts.Unix()), nil
+			case unix.SCM_TIMESTAMP:
+				if h.Len != uint32(unix.CmsgLen(int(unsafe.Sizeof(unix.Timeval{})))) {
+					return time.Time{}, errUnexpectedData
+				}
+				tv := (*unix.Timeval)(unsafe.Pointer(&oob[unix.CmsgSpace(0)]))
+				return time.Unix(tv.Unix()), nil
+			}
+		}
+		oob = oob[unix.CmsgSpace(int(h.Len))-unix.CmsgSpace(0):]
+	}
+	return time.Time{}, errTimestampNotFound
+}
+
+// SoftwareTimestampFromOOBData returns the RX timestamp in oob, which is always
+// a software timestamp.
+func SoftwareTimestampFromOOBData(oob []byte) (time.Time, error) {
+	return TimestampFromOOBData(oob)
+}
+
+// EnableTimestamping enables software timestamps of received packets, FreeBSD
+// supports neither hardware nor transmit timestamps for UDP sockets.
+func EnableTimestamping(conn *net.UDPConn, iface string) error {
+	return EnableRxTimestamps(conn)
+}
+
+func ReadTXTimestamp(conn *net.UDPConn) (time.Time, uint32, error) {
+	return time.Time{}, 0, errUnsupportedOperation
+}
+
+func SetBusyPoll(conn *net.UDPConn, d time.Duration) error {
+	return errUnsupportedOperation
+}
+
+func SetPriority(conn *net.UDPConn, prio int) error {
+	return errUnsupportedOperation
+}
+
+// EnableRecvTTL enables the reception of the TTL (IPv4) or hop limit (IPv6) of
+// packets received on conn as out of band data, see TTLFromOOBData.
+func EnableRecvTTL(conn *net.UDPConn) error {
+	sconn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var res struct {
+		err error
+	}
+	err = sconn.Control(func(fd uintptr) {
+		ip := conn.LocalAddr().(*net.UDPAddr).IP
+		if ip.To4() == nil {
+			res.err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_RECVHOPLIMIT, 1)
+		} else {
+			res.err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_RECVTTL, 1)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return res.err
+}
+
+func TTLFromOOBData(oob []byte) (int, error) {
+	for unix.CmsgSpace(0) <= len(oob) {
+		h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		if h.Len < unix.SizeofCmsghdr || uint64(h.Len) > uint64(len(oob)) {
+			return 0, errUnexpectedData
+		}
+		// The TTL is passed as a single byte, the hop limit as an int
+		if h.Level == unix.IPPROTO_IP && h.Type == unix.IP_RECVTTL {
+			if h.Len != uint32(unix.CmsgLen(1)) {
+				return 0, errUnexpectedData
+			}
+			return int(oob[unix.CmsgSpace(0)]), nil
+		}
+		if h.Level == unix.IPPROTO_IPV6 && h.Type == unix.IPV6_HOPLIMIT {
+			if h.Len != uint32(unix.CmsgLen(4)) {
+				return 0, errUnexpectedData
+			}
+			return int(*(*int32)(unsafe.Pointer(&oob[unix.CmsgSpace(0)]))), nil
+		}
+		oob = oob[unix.CmsgSpace(int(h.Len))-unix.CmsgSpace(0):]
+	}
+	return 0, errTTLNotFound
+}
+
+func EnableGRO(conn *net.UDPConn) error {
+	return errUnsupportedOperation
+}
+
+func SegmentSizeFromOOBData(oob []byte) (int, bool) {
+	return 0, false
+}
+
+func WriteSegments(conn *net.UDPConn, b []byte, n int, addr netip.AddrPort) error {
+	return errUnsupportedOperation
+}
+
+func BindToDeviceControl(device string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		return errUnsupportedOperation
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"errors"
 	"net"
+	"net/netip"
 	"syscall"
 	"time"
 
@@ -28,16 +29,44 @@ func EnableRxTimestamps(conn *net.UDPConn) error {
 	return res.err
 }
 
+// TimestampFromOOBData returns the RX timestamp in oob, preferring a hardware
+// timestamp over a software timestamp.
 func TimestampFromOOBData(oob []byte) (time.Time, error) {
+	sw, hw, err := rxTimestampsFromOOBData(oob)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !hw.IsZero() {
+		return hw, nil
+	}
+	return sw, nil
+}
+
+// SoftwareTimestampFromOOBData returns the software RX timestamp in oob, also
+// if a hardware timestamp is available.
+func SoftwareTimestampFromOOBData(oob []byte) (time.Time, error) {
+	sw, _, err := rxTimestampsFromOOBData(oob)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if sw.IsZero() {
+		return time.Time{}, errTimestampNotFound
+	}
+	return sw, nil
+}
+
+// rxTimestampsFromOOBData returns the software and hardware RX timestamps in
+// oob, which are zero if not available.
+func rxTimestampsFromOOBData(oob []byte) (sw, hw time.Time, err error) {
 	for unix.CmsgSpace(0) <= len(oob) {
 		h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
 		if h.Len < unix.SizeofCmsghdr || h.Len > uint64(len(oob)) {
-			return time.Time{}, errUnexpectedData
+			return time.Time{}, time.Time{}, errUnexpectedData
 		}
 		if h.Level == unix.SOL_SOCKET {
 			if h.Type == unix.SO_TIMESTAMPING_NEW {
 				if h.Len != uint64(unix.CmsgSpace(3*16)) {
-					return time.Time{}, errUnexpectedData
+					return time.Time{}, time.Time{}, errUnexpectedData
 				}
 				sec0 := *(*int64)(unsafe.Pointer(&oob[unix.CmsgSpace(0)]))
 				nsec0 := *(*int64)(unsafe.Pointer(&oob[unix.CmsgSpace(8)]))
@@ -45,30 +74,30 @@ func TimestampFromOOBData(oob []byte) (time.Time, error) {
 				nsec1 := *(*int64)(unsafe.Pointer(&oob[unix.CmsgSpace(24)]))
 				sec2 := *(*int64)(unsafe.Pointer(&oob[unix.CmsgSpace(32)]))
 				nsec2 := *(*int64)(unsafe.Pointer(&oob[unix.CmsgSpace(40)]))
-				var ts time.Time
+				if sec1 != 0 || nsec1 != 0 {
+					panic("unexpected timestamping behavior")
+				}
+				if sec0 == 0 && nsec0 == 0 && sec2 == 0 && nsec2 == 0 {
+					return time.Time{}, time.Time{}, errTimestampNotFound
+				}
+				if sec0 != 0 || nsec0 != 0 {
+					sw = time.Unix(sec0, nsec0)
+				}
 				if sec2 != 0 || nsec2 != 0 {
-					if sec0 != 0 || nsec0 != 0 || sec1 != 0 || nsec1 != 0 {
-						panic("unexpected timestamping behavior")
-					}
-					ts = time.Unix(sec2, nsec2)
-				} else {
-					if sec1 != 0 || nsec1 != 0 || sec2 != 0 || nsec2 != 0 {
-						panic("unexpected timestamping behavior")
-					}
-					ts = time.Unix(sec0, nsec0)
+					hw = time.Unix(sec2, nsec2)
 				}
-				return ts, nil
+				return sw, hw, nil
 			} else if h.Type == unix.SCM_TIMESTAMPNS {
 				if h.Len != uint64(unix.CmsgSpace(int(unsafe.Sizeof(unix.Timespec{})))) {
-					return time.Time{}, errUnexpectedData
+					return time.Time{}, time.Time{}, errUnexpectedData
 				}
 				ts := (*unix.Timespec)(unsafe.Pointer(&oob[unix.CmsgSpace(0)]))
-				return time.Unix(ts.Unix()), nil
+				return time.Unix(ts.Unix()), time.Time{}, nil
 			}
 		}
 		oob = oob[unix.CmsgSpace(int(h.Len))-unix.CmsgSpace(0):]
 	}
-	return time.Time{}, errTimestampNotFound
+	return time.Time{}, time.Time{}, errTimestampNotFound
 }
 
 // For details on hardware timestamping configuration, see
@@ -138,9 +167,13 @@ func EnableTimestamping(conn *net.UDPConn, iface string) error {
 		unix.SOF_TIMESTAMPING_OPT_TSONLY
 
 	if iface != "" {
+		// Software RX timestamps are reported as well for requests that are
+		// only served software timestamps, see SoftwareTimestampFromOOBData
 		sockopts |= unix.SOF_TIMESTAMPING_RAW_HARDWARE |
 			unix.SOF_TIMESTAMPING_RX_HARDWARE |
-			unix.SOF_TIMESTAMPING_TX_HARDWARE
+			unix.SOF_TIMESTAMPING_TX_HARDWARE |
+			unix.SOF_TIMESTAMPING_SOFTWARE |
+			unix.SOF_TIMESTAMPING_RX_SOFTWARE
 
 		err = sconn.Control(func(fd uintptr) {
 			err := initNetworkInterface(int(fd), iface, HWTSTAMP_FILTER_ALL)
@@ -194,7 +227,7 @@ func timestampFromOOBData(oob []byte) (time.Time, uint32, error) {
 				sec2 := *(*int64)(unsafe.Pointer(&oob[unix.CmsgSpace(32)]))
 				nsec2 := *(*int64)(unsafe.Pointer(&oob[unix.CmsgSpace(40)]))
 				if sec2 != 0 || nsec2 != 0 {
-					if sec0 != 0 || nsec0 != 0 || sec1 != 0 || nsec1 != 0 {
+					if sec1 != 0 || nsec1 != 0 {
 						panic("unexpected timestamping behavior")
 					}
 					ts = time.Unix(sec2, nsec2)
@@ -294,3 +327,166 @@ func ReadTXTimestamp(conn *net.UDPConn) (time.Time, uint32, error) {
 	}
 	return res.ts, res.id, res.err
 }
+
+// SetBusyPoll enables busy polling on conn for up to d when receiving packets,
+// see SO_BUSY_POLL in socket(7).
+func SetBusyPoll(conn *net.UDPConn, d time.Duration) error {
+	sconn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var res struct {
+		err error
+	}
+	err = sconn.Control(func(fd uintptr) {
+		res.err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_BUSY_POLL, int(d/time.Microsecond))
+	})
+	if err != nil {
+		return err
+	}
+	return res.err
+}
+
+// SetPriority sets the protocol-defined priority of packets sent on conn, see
+// SO_PRIORITY in socket(7).
+func SetPriority(conn *net.UDPConn, prio int) error {
+	sconn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var res struct {
+		err error
+	}
+	err = sconn.Control(func(fd uintptr) {
+		res.err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_PRIORITY, prio)
+	})
+	if err != nil {
+		return err
+	}
+	return res.err
+}
+
+// EnableRecvTTL enables the reception of the TTL (IPv4) or hop limit (IPv6) of
+// packets received on conn as out of band data, see TTLFromOOBData.
+func EnableRecvTTL(conn *net.UDPConn) error {
+	sconn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var res struct {
+		err error
+	}
+	err = sconn.Control(func(fd uintptr) {
+		ip := conn.LocalAddr().(*net.UDPAddr).IP
+		if ip.To4() == nil {
+			res.err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_RECVHOPLIMIT, 1)
+		} else {
+			res.err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_RECVTTL, 1)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return res.err
+}
+
+func TTLFromOOBData(oob []byte) (int, error) {
+	for unix.CmsgSpace(0) <= len(oob) {
+		h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		if h.Len < unix.SizeofCmsghdr || h.Len > uint64(len(oob)) {
+			return 0, errUnexpectedData
+		}
+		if h.Level == unix.IPPROTO_IP && h.Type == unix.IP_TTL ||
+			h.Level == unix.IPPROTO_IPV6 && h.Type == unix.IPV6_HOPLIMIT {
+			if h.Len != uint64(unix.CmsgLen(4)) {
+				return 0, errUnexpectedData
+			}
+			return int(*(*int32)(unsafe.Pointer(&oob[unix.CmsgSpace(0)]))), nil
+		}
+		oob = oob[unix.CmsgSpace(int(h.Len))-unix.CmsgSpace(0):]
+	}
+	return 0, errTTLNotFound
+}
+
+// EnableGRO enables generic receive offload on conn: consecutive packets of a
+// flow may be received coalesced into a single buffer, see
+// SegmentSizeFromOOBData and AppendSegments.
+func EnableGRO(conn *net.UDPConn) error {
+	sconn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var res struct {
+		err error
+	}
+	err = sconn.Control(func(fd uintptr) {
+		res.err = unix.SetsockoptInt(int(fd), unix.SOL_UDP, unix.UDP_GRO, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return res.err
+}
+
+// SegmentSizeFromOOBData returns the size of the packets coalesced into a
+// buffer received with generic receive offload. It returns false if the buffer
+// contains a single packet.
+func SegmentSizeFromOOBData(oob []byte) (int, bool) {
+	for unix.CmsgSpace(0) <= len(oob) {
+		h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		if h.Len < unix.SizeofCmsghdr || h.Len > uint64(len(oob)) {
+			return 0, false
+		}
+		if h.Level == unix.SOL_UDP && h.Type == unix.UDP_GRO {
+			if h.Len != uint64(unix.CmsgLen(4)) {
+				return 0, false
+			}
+			return int(*(*int32)(unsafe.Pointer(&oob[unix.CmsgSpace(0)]))), true
+		}
+		oob = oob[unix.CmsgSpace(int(h.Len))-unix.CmsgSpace(0):]
+	}
+	return 0, false
+}
+
+// WriteSegments sends the payload b to addr as packets of size n using generic
+// segmentation offload, i.e., with a single system call. The last packet may
+// be shorter.
+func WriteSegments(conn *net.UDPConn, b []byte, n int, addr netip.AddrPort) error {
+	if n <= 0 || n > 0xffff {
+		return errUnexpectedData
+	}
+	oob := make([]byte, unix.CmsgSpace(2))
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	h.Level = unix.SOL_UDP
+	h.Type = unix.UDP_SEGMENT
+	h.SetLen(unix.CmsgLen(2))
+	*(*uint16)(unsafe.Pointer(&oob[unix.CmsgSpace(0)])) = uint16(n)
+	m, _, err := conn.WriteMsgUDPAddrPort(b, oob, addr)
+	if err != nil {
+		return err
+	}
+	if m != len(b) {
+		return errUnexpectedData
+	}
+	return nil
+}
+
+// BindToDeviceControl returns a control function for net.ListenConfig and
+// net.Dialer that binds sockets to the network interface or VRF named device
+// before they are bound to a local address, see SO_BINDTODEVICE in socket(7).
+// Packets are then only sent and received via device. Before Linux 5.7, the
+// option requires CAP_NET_RAW.
+func BindToDeviceControl(device string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var res struct {
+			err error
+		}
+		err := c.Control(func(fd uintptr) {
+			res.err = unix.BindToDevice(int(fd), device)
+		})
+		if err != nil {
+			return err
+		}
+		return res.err
+	}
+}
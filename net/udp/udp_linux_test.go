@@ -0,0 +1,150 @@
+package udp_test
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"example.com/scion-time/net/udp"
+)
+
+func appendCmsg(oob []byte, level, typ int32, data []byte) []byte {
+	b := make([]byte, unix.CmsgSpace(len(data)))
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&b[0]))
+	h.Level = level
+	h.Type = typ
+	h.SetLen(unix.CmsgLen(len(data)))
+	copy(b[unix.CmsgSpace(0):], data)
+	return append(oob, b...)
+}
+
+func TestSegmentSizeFromOOBData(t *testing.T) {
+	var size [4]byte
+	*(*int32)(unsafe.Pointer(&size[0])) = 1200
+	gro := appendCmsg(nil, unix.SOL_UDP, unix.UDP_GRO, size[:])
+	ttl := appendCmsg(nil, unix.SOL_IP, unix.IP_TTL, []byte{64, 0, 0, 0})
+	ts := appendCmsg(nil, unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, make([]byte, 16))
+
+	tests := []struct {
+		name string
+		oob  []byte
+		n    int
+		ok   bool
+	}{
+		{name: "empty", oob: nil},
+		{name: "gro", oob: gro, n: 1200, ok: true},
+		{name: "other", oob: append(append([]byte(nil), ttl...), ts...)},
+		{name: "after other", oob: append(append([]byte(nil), ts...), gro...), n: 1200, ok: true},
+		{name: "bad length", oob: appendCmsg(nil, unix.SOL_UDP, unix.UDP_GRO, size[:2])},
+		{name: "truncated", oob: gro[:unix.CmsgSpace(0)]},
+	}
+	for _, tc := range tests {
+		n, ok := udp.SegmentSizeFromOOBData(tc.oob)
+		if n != tc.n || ok != tc.ok {
+			t.Errorf("%s: SegmentSizeFromOOBData = (%d, %t), want (%d, %t)",
+				tc.name, n, ok, tc.n, tc.ok)
+		}
+	}
+}
+
+// scmTimestamping returns the control message of RX timestamps sw and hw, which
+// are omitted if zero.
+func scmTimestamping(sw, hw time.Time) []byte {
+	var ts [3 * 16]byte
+	for i, t := range []time.Time{sw, {}, hw} {
+		if !t.IsZero() {
+			*(*int64)(unsafe.Pointer(&ts[16*i])) = t.Unix()
+			*(*int64)(unsafe.Pointer(&ts[16*i+8])) = int64(t.Nanosecond())
+		}
+	}
+	return appendCmsg(nil, unix.SOL_SOCKET, unix.SO_TIMESTAMPING_NEW, ts[:])
+}
+
+func TestTimestampFromOOBData(t *testing.T) {
+	sw := time.Unix(1700000000, 123)
+	hw := time.Unix(1700000000, 100)
+	tests := []struct {
+		name   string
+		oob    []byte
+		ts, sw time.Time
+		ok     bool
+	}{
+		{name: "software", oob: scmTimestamping(sw, time.Time{}), ts: sw, sw: sw, ok: true},
+		{name: "hardware", oob: scmTimestamping(time.Time{}, hw), ts: hw},
+		{name: "both", oob: scmTimestamping(sw, hw), ts: hw, sw: sw, ok: true},
+		{name: "none", oob: scmTimestamping(time.Time{}, time.Time{})},
+		{name: "empty", oob: nil},
+	}
+	for _, tc := range tests {
+		ts, err := udp.TimestampFromOOBData(tc.oob)
+		if !ts.Equal(tc.ts) || (err == nil) != !tc.ts.IsZero() {
+			t.Errorf("%s: TimestampFromOOBData = (%v, %v), want %v", tc.name, ts, err, tc.ts)
+		}
+		ts, err = udp.SoftwareTimestampFromOOBData(tc.oob)
+		if !ts.Equal(tc.sw) || (err == nil) != tc.ok {
+			t.Errorf("%s: SoftwareTimestampFromOOBData = (%v, %v), want %v", tc.name, ts, err, tc.sw)
+		}
+	}
+}
+
+func TestSegmentsLoopback(t *testing.T) {
+	rconn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rconn.Close()
+	if err := udp.EnableGRO(rconn); err != nil {
+		t.Skipf("GRO not supported: %v", err)
+	}
+	sconn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sconn.Close()
+
+	const n = 48
+	b := make([]byte, 3*n+10)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	addr := rconn.LocalAddr().(*net.UDPAddr).AddrPort()
+	addr = netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port())
+	if err := udp.WriteSegments(sconn, b, n, addr); err != nil {
+		t.Skipf("GSO not supported: %v", err)
+	}
+
+	var segs [][]byte
+	buf := make([]byte, 64*1024)
+	oob := make([]byte, 256)
+	err = rconn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for total := 0; total < len(b); {
+		m, oobn, _, _, err := rconn.ReadMsgUDPAddrPort(buf, oob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, _ := udp.SegmentSizeFromOOBData(oob[:oobn])
+		p := append([]byte(nil), buf[:m]...)
+		segs = udp.AppendSegments(segs, p, size)
+		total += m
+	}
+	if len(segs) != 4 {
+		t.Fatalf("got %d segments, want 4", len(segs))
+	}
+	for i, s := range segs {
+		end := (i + 1) * n
+		if end > len(b) {
+			end = len(b)
+		}
+		if !bytes.Equal(s, b[i*n:end]) {
+			t.Errorf("segment %d = %v, want %v", i, s, b[i*n:end])
+		}
+	}
+}
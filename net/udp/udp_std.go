@@ -0,0 +1,99 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package udp
+
+// Other operating systems provide neither kernel timestamps nor the other
+// socket options used by the service. Callers fall back to timestamps taken in
+// user space.
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+var (
+	errUnsupportedOperation = errors.New("unsupported operation")
+)
+
+func TimestampLen() int {
+	return 0
+}
+
+func TTLLen() int {
+	return 0
+}
+
+func SegmentLen() int {
+	return 0
+}
+
+func SetDSCP(conn *net.UDPConn, dscp uint8) error {
+	if dscp > 63 {
+		panic("invalid argument: dscp must not be greater than 63")
+	}
+	return errUnsupportedOperation
+}
+
+func EnableBroadcast(conn *net.UDPConn) error {
+	return errUnsupportedOperation
+}
+
+func EnableRxTimestamps(conn *net.UDPConn) error {
+	return errUnsupportedOperation
+}
+
+func TimestampFromOOBData(oob []byte) (time.Time, error) {
+	return time.Time{}, errTimestampNotFound
+}
+
+func SoftwareTimestampFromOOBData(oob []byte) (time.Time, error) {
+	return time.Time{}, errTimestampNotFound
+}
+
+func EnableTimestamping(conn *net.UDPConn, iface string) error {
+	return errUnsupportedOperation
+}
+
+func ReadTXTimestamp(conn *net.UDPConn) (time.Time, uint32, error) {
+	return time.Time{}, 0, errUnsupportedOperation
+}
+
+func SetBusyPoll(conn *net.UDPConn, d time.Duration) error {
+	return errUnsupportedOperation
+}
+
+func SetPriority(conn *net.UDPConn, prio int) error {
+	return errUnsupportedOperation
+}
+
+func EnableRecvTTL(conn *net.UDPConn) error {
+	return errUnsupportedOperation
+}
+
+func TTLFromOOBData(oob []byte) (int, error) {
+	return 0, errUnsupportedOperation
+}
+
+func EnableGRO(conn *net.UDPConn) error {
+	return errUnsupportedOperation
+}
+
+func SegmentSizeFromOOBData(oob []byte) (int, bool) {
+	return 0, false
+}
+
+func WriteSegments(conn *net.UDPConn, b []byte, n int, addr netip.AddrPort) error {
+	return errUnsupportedOperation
+}
+
+// BindToDeviceControl returns a control function for net.ListenConfig and
+// net.Dialer that fails since binding sockets to a network interface is not
+// supported on this operating system.
+func BindToDeviceControl(device string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		return errUnsupportedOperation
+	}
+}
@@ -0,0 +1,45 @@
+package udp_test
+
+import (
+	"bytes"
+	"testing"
+
+	"example.com/scion-time/net/udp"
+)
+
+func TestAppendSegments(t *testing.T) {
+	b := []byte("0123456789")
+	tests := []struct {
+		n    int
+		segs []string
+	}{
+		{n: 0, segs: []string{"0123456789"}},
+		{n: 10, segs: []string{"0123456789"}},
+		{n: 20, segs: []string{"0123456789"}},
+		{n: 5, segs: []string{"01234", "56789"}},
+		{n: 4, segs: []string{"0123", "4567", "89"}},
+		{n: 1, segs: []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}},
+	}
+	for _, tc := range tests {
+		segs := udp.AppendSegments(nil, b, tc.n)
+		if len(segs) != len(tc.segs) {
+			t.Fatalf("AppendSegments(%d): got %d segments, want %d", tc.n, len(segs), len(tc.segs))
+		}
+		for i, s := range segs {
+			if !bytes.Equal(s, []byte(tc.segs[i])) {
+				t.Errorf("AppendSegments(%d)[%d] = %q, want %q", tc.n, i, s, tc.segs[i])
+			}
+			if cap(s) != len(s) {
+				t.Errorf("AppendSegments(%d)[%d]: cap = %d, want %d", tc.n, i, cap(s), len(s))
+			}
+		}
+	}
+}
+
+func TestAppendSegmentsAppends(t *testing.T) {
+	segs := [][]byte{[]byte("x")}
+	segs = udp.AppendSegments(segs, []byte("abc"), 2)
+	if len(segs) != 3 || string(segs[0]) != "x" || string(segs[1]) != "ab" || string(segs[2]) != "c" {
+		t.Errorf("AppendSegments: got %q", segs)
+	}
+}
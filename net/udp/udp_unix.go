@@ -0,0 +1,76 @@
+//go:build linux || darwin || freebsd
+
+package udp
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// Timestamp handling based on studying code from the following projects:
+// - https://github.com/bsdphk/Ntimed, file udp.c
+// - https://github.com/golang/go, package "golang.org/x/sys/unix"
+// - https://github.com/google/gopacket, package "github.com/google/gopacket/pcapgo"
+// - https://github.com/facebook/time, package "github.com/facebook/time/ntp/protocol/ntp"
+
+func TimestampLen() int {
+	return unix.CmsgSpace(3 * 16)
+}
+
+// TTLLen returns the size of the out of band data required for the TTL or hop
+// limit of a received packet, see EnableRecvTTL.
+func TTLLen() int {
+	return unix.CmsgSpace(4)
+}
+
+// SegmentLen returns the size of the out of band data required for the segment
+// size of packets coalesced by generic receive offload, see EnableGRO.
+func SegmentLen() int {
+	return unix.CmsgSpace(4)
+}
+
+func SetDSCP(conn *net.UDPConn, dscp uint8) error {
+	// Based on Meta's time libraries at https://github.com/facebook/time
+	if dscp > 63 {
+		panic("invalid argument: dscp must not be greater than 63")
+	}
+	sconn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var res struct {
+		err error
+	}
+	err = sconn.Control(func(fd uintptr) {
+		ip := conn.LocalAddr().(*net.UDPAddr).IP
+		if ip.To4() == nil {
+			res.err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_TCLASS, int(dscp<<2))
+		} else {
+			res.err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_TOS, int(dscp<<2))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return res.err
+}
+
+// EnableBroadcast permits sending packets to broadcast addresses on conn, see
+// SO_BROADCAST in socket(7).
+func EnableBroadcast(conn *net.UDPConn) error {
+	sconn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var res struct {
+		err error
+	}
+	err = sconn.Control(func(fd uintptr) {
+		res.err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_BROADCAST, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return res.err
+}
@@ -0,0 +1,35 @@
+//go:build linux
+
+package xdp
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const RingSize = ringSize
+
+// Ring is a ring backed by regular memory instead of a mapping shared with the
+// kernel.
+type Ring struct {
+	r   ring
+	mem []unix.XDPDesc
+}
+
+func NewRing() *Ring {
+	mem := make([]unix.XDPDesc, ringSize)
+	return &Ring{
+		r: ring{
+			descs: unsafe.Pointer(&mem[0]),
+			mask:  ringSize - 1,
+		},
+		mem: mem,
+	}
+}
+
+func (r *Ring) SetAddr(i uint32, addr uint64) { *r.r.addr(i) = addr }
+func (r *Ring) Addr(i uint32) uint64          { return *r.r.addr(i) }
+
+func (r *Ring) SetDesc(i uint32, d unix.XDPDesc) { *r.r.desc(i) = d }
+func (r *Ring) Desc(i uint32) unix.XDPDesc       { return *r.r.desc(i) }
@@ -0,0 +1,3 @@
+package xdp
+
+var Reply = reply
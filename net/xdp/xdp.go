@@ -0,0 +1,119 @@
+package xdp
+
+// Kernel-bypass datapath for UDP request/response protocols based on AF_XDP
+// sockets: an XDP program redirects IPv4/UDP packets with a given destination
+// and payload length to AF_XDP sockets where they are answered in place. All
+// other traffic is passed on to the regular network stack.
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+)
+
+const (
+	ethHdrLen  = 14
+	ipv4HdrLen = 20
+	udpHdrLen  = 8
+
+	ethTypeIPv4   = 0x0800
+	ipProtocolUDP = 17
+	ipTTL         = 64
+)
+
+var (
+	errInvalidConfig = errors.New("invalid XDP configuration")
+	errUnsupported   = errors.New("XDP not supported")
+)
+
+// Config specifies the packets handled by the XDP datapath: IPv4/UDP packets
+// to Addr (any address if unspecified) and Port with a payload of PayloadLen
+// bytes whose first byte matches FirstByteValue under FirstByteMask.
+type Config struct {
+	Interface      string
+	NumQueues      int
+	Addr           netip.Addr
+	Port           uint16
+	PayloadLen     int
+	FirstByteMask  uint8
+	FirstByteValue uint8
+}
+
+// Handler processes the request in payload, received from src, and replaces
+// it with the response. It reports whether the response is to be sent.
+type Handler func(payload []byte, src netip.AddrPort) bool
+
+func (cfg *Config) validate() error {
+	if cfg.Interface == "" || cfg.NumQueues <= 0 || cfg.Port == 0 ||
+		cfg.PayloadLen <= 0 || cfg.PayloadLen > 0xffff-ipv4HdrLen-udpHdrLen ||
+		cfg.Addr.IsValid() && !cfg.Addr.Is4() {
+		return errInvalidConfig
+	}
+	return nil
+}
+
+func checksum(csum uint32, b []byte) uint32 {
+	n := len(b) &^ 1
+	for i := 0; i < n; i += 2 {
+		csum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		csum += uint32(b[n]) << 8
+	}
+	return csum
+}
+
+func fold(csum uint32) uint16 {
+	for csum > 0xffff {
+		csum = (csum >> 16) + (csum & 0xffff)
+	}
+	return ^uint16(csum)
+}
+
+// reply passes the UDP payload of the IPv4 packet in frame to h and turns the
+// frame into the response in place.
+func reply(frame []byte, payloadLen int, h Handler) bool {
+	if len(frame) != ethHdrLen+ipv4HdrLen+udpHdrLen+payloadLen {
+		return false
+	}
+	eth := frame[:ethHdrLen]
+	ip := frame[ethHdrLen : ethHdrLen+ipv4HdrLen]
+	udp := frame[ethHdrLen+ipv4HdrLen : ethHdrLen+ipv4HdrLen+udpHdrLen]
+	payload := frame[ethHdrLen+ipv4HdrLen+udpHdrLen:]
+	if binary.BigEndian.Uint16(eth[12:]) != ethTypeIPv4 || ip[0] != 0x45 || ip[9] != ipProtocolUDP {
+		return false
+	}
+
+	var srcIP [4]byte
+	copy(srcIP[:], ip[12:16])
+	src := netip.AddrPortFrom(netip.AddrFrom4(srcIP), binary.BigEndian.Uint16(udp[0:]))
+	if !h(payload, src) {
+		return false
+	}
+
+	for i := 0; i != 6; i++ {
+		eth[i], eth[6+i] = eth[6+i], eth[i]
+	}
+
+	ip[1] = ip[1] &^ 0b11 // clear ECN
+	binary.BigEndian.PutUint16(ip[6:], 0)
+	ip[8] = ipTTL
+	for i := 0; i != 4; i++ {
+		ip[12+i], ip[16+i] = ip[16+i], ip[12+i]
+	}
+	binary.BigEndian.PutUint16(ip[10:], 0)
+	binary.BigEndian.PutUint16(ip[10:], fold(checksum(0, ip)))
+
+	udp[0], udp[1], udp[2], udp[3] = udp[2], udp[3], udp[0], udp[1]
+	binary.BigEndian.PutUint16(udp[6:], 0)
+	csum := checksum(0, ip[12:20])
+	csum += ipProtocolUDP + uint32(udpHdrLen+len(payload))
+	csum = checksum(csum, udp)
+	csum = checksum(csum, payload)
+	c := fold(csum)
+	if c == 0 {
+		c = 0xffff
+	}
+	binary.BigEndian.PutUint16(udp[6:], c)
+	return true
+}
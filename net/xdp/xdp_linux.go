@@ -0,0 +1,481 @@
+//go:build linux
+
+package xdp
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Based on the AF_XDP documentation at
+// https://docs.kernel.org/networking/af_xdp.html
+
+const (
+	frameSize = 2048
+	numFrames = 4096
+	ringSize  = numFrames
+
+	pollTimeout = 100 // ms
+
+	// BPF instruction classes and operations, see
+	// https://docs.kernel.org/bpf/standardization/instruction-set.html
+	bpfLdxMemB         = 0x71
+	bpfLdxMemH         = 0x69
+	bpfLdxMemW         = 0x61
+	bpfLdImmDW         = 0x18
+	bpfMov64Reg        = 0xbf
+	bpfMov64Imm        = 0xb7
+	bpfAdd64Imm        = 0x07
+	bpfAnd64Imm        = 0x57
+	bpfJgtReg          = 0x2d
+	bpfJne32Imm        = 0x56
+	bpfCall            = 0x85
+	bpfExit            = 0x95
+	bpfFuncRedirectMap = 51
+
+	xdpPass = 2
+
+	xdpMdData         = 0
+	xdpMdDataEnd      = 4
+	xdpMdRxQueueIndex = 16
+)
+
+type bpfInsn struct {
+	code uint8
+	regs uint8
+	off  int16
+	imm  int32
+}
+
+type bpfMapCreateAttr struct {
+	mapType    uint32
+	keySize    uint32
+	valueSize  uint32
+	maxEntries uint32
+	mapFlags   uint32
+}
+
+type bpfMapUpdateAttr struct {
+	mapFd uint32
+	_     uint32
+	key   uint64
+	value uint64
+	flags uint64
+}
+
+type bpfProgLoadAttr struct {
+	progType           uint32
+	insnCnt            uint32
+	insns              uint64
+	license            uint64
+	logLevel           uint32
+	logSize            uint32
+	logBuf             uint64
+	kernVersion        uint32
+	progFlags          uint32
+	progName           [16]byte
+	progIfindex        uint32
+	expectedAttachType uint32
+}
+
+type bpfLinkCreateAttr struct {
+	progFd     uint32
+	targetFd   uint32
+	attachType uint32
+	flags      uint32
+}
+
+type ring struct {
+	mem      []byte
+	producer *uint32
+	consumer *uint32
+	flags    *uint32
+	descs    unsafe.Pointer
+	mask     uint32
+	cached   uint32
+}
+
+// Program is an XDP program attached to a network interface.
+type Program struct {
+	cfg    Config
+	mapFd  int
+	progFd int
+	linkFd int
+}
+
+// Socket is an AF_XDP socket bound to one queue of a network interface.
+type Socket struct {
+	fd         int
+	payloadLen int
+	umem       []byte
+	fill       ring
+	comp       ring
+	rx         ring
+	tx         ring
+}
+
+func bpf(cmd int, attr unsafe.Pointer, size uintptr) (int, error) {
+	r, _, errno := unix.Syscall(unix.SYS_BPF, uintptr(cmd), uintptr(attr), size)
+	runtime.KeepAlive(attr)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(r), nil
+}
+
+func ins(code, dst, src uint8, off int16, imm int32) bpfInsn {
+	return bpfInsn{code: code, regs: src<<4 | dst, off: off, imm: imm}
+}
+
+// nativeUint16 and nativeUint32 return the value of a big endian field as
+// loaded into a BPF register on the host.
+func nativeUint16(v uint16) int32 {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	return int32(*(*uint16)(unsafe.Pointer(&b[0])))
+}
+
+func nativeUint32(v uint32) int32 {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	return int32(*(*uint32)(unsafe.Pointer(&b[0])))
+}
+
+// program returns the instructions of the XDP program that redirects the
+// packets specified by cfg to the AF_XDP sockets in the map mapFd.
+func program(cfg *Config, mapFd int) []bpfInsn {
+	const (
+		r0, r1, r2, r3, r4, r5 = 0, 1, 2, 3, 4, 5
+	)
+	udpOff := ethHdrLen + ipv4HdrLen
+	payloadOff := udpOff + udpHdrLen
+	checks := []bpfInsn{
+		ins(bpfLdxMemH, r5, r2, 12, 0),
+		ins(bpfJne32Imm, r5, 0, 0, nativeUint16(ethTypeIPv4)),
+		ins(bpfLdxMemB, r5, r2, ethHdrLen, 0),
+		ins(bpfJne32Imm, r5, 0, 0, 0x45),
+		ins(bpfLdxMemB, r5, r2, ethHdrLen+9, 0),
+		ins(bpfJne32Imm, r5, 0, 0, ipProtocolUDP),
+		ins(bpfLdxMemH, r5, r2, ethHdrLen+6, 0),
+		ins(bpfAnd64Imm, r5, 0, 0, nativeUint16(0x3fff)), // fragment offset, MF flag
+		ins(bpfJne32Imm, r5, 0, 0, 0),
+		ins(bpfLdxMemH, r5, r2, int16(udpOff+2), 0),
+		ins(bpfJne32Imm, r5, 0, 0, nativeUint16(cfg.Port)),
+		ins(bpfLdxMemH, r5, r2, int16(udpOff+4), 0),
+		ins(bpfJne32Imm, r5, 0, 0, nativeUint16(uint16(udpHdrLen+cfg.PayloadLen))),
+		ins(bpfLdxMemB, r5, r2, int16(payloadOff), 0),
+		ins(bpfAnd64Imm, r5, 0, 0, int32(cfg.FirstByteMask)),
+		ins(bpfJne32Imm, r5, 0, 0, int32(cfg.FirstByteValue&cfg.FirstByteMask)),
+	}
+	if cfg.Addr.IsValid() && !cfg.Addr.IsUnspecified() {
+		a := cfg.Addr.As4()
+		checks = append(checks,
+			ins(bpfLdxMemW, r5, r2, ethHdrLen+16, 0),
+			ins(bpfJne32Imm, r5, 0, 0, nativeUint32(binary.BigEndian.Uint32(a[:]))),
+		)
+	}
+	redirect := []bpfInsn{
+		ins(bpfLdxMemW, r2, r1, xdpMdRxQueueIndex, 0),
+		ins(bpfLdImmDW, r1, unix.BPF_PSEUDO_MAP_FD, 0, int32(mapFd)),
+		ins(0, 0, 0, 0, 0),
+		ins(bpfMov64Imm, r3, 0, 0, xdpPass),
+		ins(bpfCall, 0, 0, 0, bpfFuncRedirectMap),
+		ins(bpfExit, 0, 0, 0, 0),
+	}
+	pass := []bpfInsn{
+		ins(bpfMov64Imm, r0, 0, 0, xdpPass),
+		ins(bpfExit, 0, 0, 0, 0),
+	}
+
+	var p []bpfInsn
+	p = append(p,
+		ins(bpfLdxMemW, r2, r1, xdpMdData, 0),
+		ins(bpfLdxMemW, r3, r1, xdpMdDataEnd, 0),
+		ins(bpfMov64Reg, r4, r2, 0, 0),
+		ins(bpfAdd64Imm, r4, 0, 0, int32(payloadOff+cfg.PayloadLen)),
+		ins(bpfJgtReg, r4, r3, 0, 0),
+	)
+	p = append(p, checks...)
+	p = append(p, redirect...)
+	passIdx := len(p)
+	p = append(p, pass...)
+	// Resolve jumps to the pass label
+	for i := range p {
+		if p[i].code == bpfJgtReg || p[i].code == bpfJne32Imm {
+			p[i].off = int16(passIdx - i - 1)
+		}
+	}
+	return p
+}
+
+// LoadProgram creates the XDP program for cfg and attaches it to the network
+// interface.
+func LoadProgram(cfg Config) (*Program, error) {
+	err := cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+	iface, err := net.InterfaceByName(cfg.Interface)
+	if err != nil {
+		return nil, err
+	}
+
+	mapAttr := bpfMapCreateAttr{
+		mapType:    unix.BPF_MAP_TYPE_XSKMAP,
+		keySize:    4,
+		valueSize:  4,
+		maxEntries: uint32(cfg.NumQueues),
+	}
+	mapFd, err := bpf(unix.BPF_MAP_CREATE, unsafe.Pointer(&mapAttr), unsafe.Sizeof(mapAttr))
+	if err != nil {
+		return nil, err
+	}
+
+	insns := program(&cfg, mapFd)
+	license := []byte("GPL\x00")
+	progAttr := bpfProgLoadAttr{
+		progType:           unix.BPF_PROG_TYPE_XDP,
+		insnCnt:            uint32(len(insns)),
+		insns:              uint64(uintptr(unsafe.Pointer(&insns[0]))),
+		license:            uint64(uintptr(unsafe.Pointer(&license[0]))),
+		expectedAttachType: unix.BPF_XDP,
+	}
+	copy(progAttr.progName[:], "timeservice")
+	progFd, err := bpf(unix.BPF_PROG_LOAD, unsafe.Pointer(&progAttr), unsafe.Sizeof(progAttr))
+	runtime.KeepAlive(insns)
+	runtime.KeepAlive(license)
+	if err != nil {
+		unix.Close(mapFd)
+		return nil, err
+	}
+
+	linkAttr := bpfLinkCreateAttr{
+		progFd:     uint32(progFd),
+		targetFd:   uint32(iface.Index),
+		attachType: unix.BPF_XDP,
+	}
+	linkFd, err := bpf(unix.BPF_LINK_CREATE, unsafe.Pointer(&linkAttr), unsafe.Sizeof(linkAttr))
+	if err != nil {
+		unix.Close(progFd)
+		unix.Close(mapFd)
+		return nil, err
+	}
+
+	return &Program{cfg: cfg, mapFd: mapFd, progFd: progFd, linkFd: linkFd}, nil
+}
+
+// Close detaches the program from the network interface.
+func (p *Program) Close() error {
+	err := unix.Close(p.linkFd)
+	_ = unix.Close(p.progFd)
+	_ = unix.Close(p.mapFd)
+	return err
+}
+
+func (p *Program) register(queue int, fd int) error {
+	key, value := uint32(queue), uint32(fd)
+	attr := bpfMapUpdateAttr{
+		mapFd: uint32(p.mapFd),
+		key:   uint64(uintptr(unsafe.Pointer(&key))),
+		value: uint64(uintptr(unsafe.Pointer(&value))),
+	}
+	_, err := bpf(unix.BPF_MAP_UPDATE_ELEM, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(&key)
+	runtime.KeepAlive(&value)
+	return err
+}
+
+func setsockopt(fd, opt int, v unsafe.Pointer, size uintptr) error {
+	_, _, errno := unix.Syscall6(unix.SYS_SETSOCKOPT,
+		uintptr(fd), unix.SOL_XDP, uintptr(opt), uintptr(v), size, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func mapRing(fd int, offset int64, off unix.XDPRingOffset, descSize uintptr) (ring, error) {
+	mem, err := unix.Mmap(fd, offset, int(off.Desc+uint64(ringSize*descSize)),
+		unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return ring{}, err
+	}
+	return ring{
+		mem:      mem,
+		producer: (*uint32)(unsafe.Pointer(&mem[off.Producer])),
+		consumer: (*uint32)(unsafe.Pointer(&mem[off.Consumer])),
+		flags:    (*uint32)(unsafe.Pointer(&mem[off.Flags])),
+		descs:    unsafe.Pointer(&mem[off.Desc]),
+		mask:     ringSize - 1,
+	}, nil
+}
+
+func (r *ring) addr(i uint32) *uint64 {
+	return (*uint64)(unsafe.Add(r.descs, uintptr(i&r.mask)*8))
+}
+
+func (r *ring) desc(i uint32) *unix.XDPDesc {
+	return (*unix.XDPDesc)(unsafe.Add(r.descs, uintptr(i&r.mask)*unsafe.Sizeof(unix.XDPDesc{})))
+}
+
+func (r *ring) needWakeup() bool {
+	return atomic.LoadUint32(r.flags)&unix.XDP_RING_NEED_WAKEUP != 0
+}
+
+// Open creates an AF_XDP socket for queue of the network interface of p and
+// registers it with the program.
+func (p *Program) Open(queue int) (*Socket, error) {
+	if queue < 0 || queue >= p.cfg.NumQueues {
+		return nil, errInvalidConfig
+	}
+	iface, err := net.InterfaceByName(p.cfg.Interface)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := unix.Socket(unix.AF_XDP, unix.SOCK_RAW|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	s := &Socket{fd: fd, payloadLen: p.cfg.PayloadLen}
+	err = s.init(iface.Index, queue)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	err = p.register(queue, fd)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Socket) init(ifindex, queue int) error {
+	var err error
+	s.umem, err = unix.Mmap(-1, 0, numFrames*frameSize,
+		unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS|unix.MAP_POPULATE)
+	if err != nil {
+		return err
+	}
+	reg := unix.XDPUmemReg{
+		Addr: uint64(uintptr(unsafe.Pointer(&s.umem[0]))),
+		Len:  uint64(len(s.umem)),
+		Size: frameSize,
+	}
+	err = setsockopt(s.fd, unix.XDP_UMEM_REG, unsafe.Pointer(&reg), unsafe.Sizeof(reg))
+	if err != nil {
+		return err
+	}
+	for _, opt := range []int{
+		unix.XDP_UMEM_FILL_RING, unix.XDP_UMEM_COMPLETION_RING, unix.XDP_RX_RING, unix.XDP_TX_RING,
+	} {
+		err = unix.SetsockoptInt(s.fd, unix.SOL_XDP, opt, ringSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	var off unix.XDPMmapOffsets
+	offLen := uint32(unsafe.Sizeof(off))
+	_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, uintptr(s.fd), unix.SOL_XDP, unix.XDP_MMAP_OFFSETS,
+		uintptr(unsafe.Pointer(&off)), uintptr(unsafe.Pointer(&offLen)), 0)
+	if errno != 0 {
+		return errno
+	}
+	s.fill, err = mapRing(s.fd, unix.XDP_UMEM_PGOFF_FILL_RING, off.Fr, 8)
+	if err != nil {
+		return err
+	}
+	s.comp, err = mapRing(s.fd, unix.XDP_UMEM_PGOFF_COMPLETION_RING, off.Cr, 8)
+	if err != nil {
+		return err
+	}
+	s.rx, err = mapRing(s.fd, unix.XDP_PGOFF_RX_RING, off.Rx, unsafe.Sizeof(unix.XDPDesc{}))
+	if err != nil {
+		return err
+	}
+	s.tx, err = mapRing(s.fd, unix.XDP_PGOFF_TX_RING, off.Tx, unsafe.Sizeof(unix.XDPDesc{}))
+	if err != nil {
+		return err
+	}
+
+	// All frames start out in the fill ring. A frame is either owned by the
+	// kernel or, in between receiving and sending a response, by the socket.
+	for i := uint32(0); i != numFrames; i++ {
+		*s.fill.addr(i) = uint64(i) * frameSize
+	}
+	atomic.StoreUint32(s.fill.producer, numFrames)
+
+	return unix.Bind(s.fd, &unix.SockaddrXDP{
+		Flags:   unix.XDP_USE_NEED_WAKEUP,
+		Ifindex: uint32(ifindex),
+		QueueID: uint32(queue),
+	})
+}
+
+// Close closes the socket and releases its memory.
+func (s *Socket) Close() error {
+	err := unix.Close(s.fd)
+	for _, r := range []*ring{&s.fill, &s.comp, &s.rx, &s.tx} {
+		if r.mem != nil {
+			_ = unix.Munmap(r.mem)
+		}
+	}
+	if s.umem != nil {
+		_ = unix.Munmap(s.umem)
+	}
+	return err
+}
+
+// Serve answers requests with h until ctx is done.
+func (s *Socket) Serve(ctx context.Context, h Handler) error {
+	pfds := []unix.PollFd{{Fd: int32(s.fd), Events: unix.POLLIN}}
+	for ctx.Err() == nil {
+		_, err := unix.Poll(pfds, pollTimeout)
+		if err != nil && err != unix.EINTR {
+			return err
+		}
+
+		rxProd := atomic.LoadUint32(s.rx.producer)
+		rxCons := *s.rx.consumer
+		fillProd := *s.fill.producer
+		txProd := *s.tx.producer
+		for ; rxCons != rxProd; rxCons++ {
+			d := s.rx.desc(rxCons)
+			frame := s.umem[d.Addr : d.Addr+uint64(d.Len)]
+			if reply(frame, s.payloadLen, h) {
+				*s.tx.desc(txProd) = unix.XDPDesc{Addr: d.Addr, Len: d.Len}
+				txProd++
+			} else {
+				*s.fill.addr(fillProd) = d.Addr
+				fillProd++
+			}
+		}
+		atomic.StoreUint32(s.rx.consumer, rxCons)
+		if txProd != *s.tx.producer {
+			atomic.StoreUint32(s.tx.producer, txProd)
+			if s.tx.needWakeup() {
+				_, _, errno := unix.Syscall6(unix.SYS_SENDTO, uintptr(s.fd), 0, 0, unix.MSG_DONTWAIT, 0, 0)
+				if errno != 0 && errno != unix.EAGAIN && errno != unix.EBUSY && errno != unix.ENOBUFS {
+					return errno
+				}
+			}
+		}
+
+		compProd := atomic.LoadUint32(s.comp.producer)
+		compCons := *s.comp.consumer
+		for ; compCons != compProd; compCons++ {
+			*s.fill.addr(fillProd) = *s.comp.addr(compCons)
+			fillProd++
+		}
+		atomic.StoreUint32(s.comp.consumer, compCons)
+		atomic.StoreUint32(s.fill.producer, fillProd)
+	}
+	return nil
+}
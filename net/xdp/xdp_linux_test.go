@@ -0,0 +1,46 @@
+//go:build linux
+
+package xdp_test
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"example.com/scion-time/net/xdp"
+)
+
+func TestRingAddr(t *testing.T) {
+	r := xdp.NewRing()
+	for i := uint32(0); i != xdp.RingSize; i++ {
+		r.SetAddr(i, uint64(i)+1)
+	}
+	for i := uint32(0); i != xdp.RingSize; i++ {
+		if a := r.Addr(i); a != uint64(i)+1 {
+			t.Fatalf("Addr(%d) = %d; want %d", i, a, uint64(i)+1)
+		}
+		if a := r.Addr(i + xdp.RingSize); a != uint64(i)+1 {
+			t.Fatalf("Addr(%d) = %d; want %d", i+xdp.RingSize, a, uint64(i)+1)
+		}
+	}
+}
+
+func TestRingIndexWrapAround(t *testing.T) {
+	// Producer and consumer indices are free-running and wrap around at 2^32
+	r := xdp.NewRing()
+	last, first := ^uint32(0), uint32(0)
+	r.SetDesc(last, unix.XDPDesc{Addr: 1, Len: 1})
+	r.SetDesc(first, unix.XDPDesc{Addr: 2, Len: 2})
+	if d := r.Desc(last); d.Addr != 1 || d.Len != 1 {
+		t.Errorf("Desc(%d) = %+v; want {Addr:1 Len:1}", last, d)
+	}
+	if d := r.Desc(xdp.RingSize - 1); d.Addr != 1 {
+		t.Errorf("Desc(%d) = %+v; want alias of Desc(%d)", xdp.RingSize-1, d, last)
+	}
+	if d := r.Desc(last + 1); d.Addr != 2 || d.Len != 2 {
+		t.Errorf("Desc(%d + 1) = %+v; want {Addr:2 Len:2}", last, d)
+	}
+	if n := first - last; n != 1 {
+		t.Errorf("number of entries between %d and %d = %d; want 1", last, first, n)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+
+package xdp
+
+import (
+	"context"
+)
+
+type Program struct{}
+
+type Socket struct{}
+
+func LoadProgram(cfg Config) (*Program, error) {
+	return nil, errUnsupported
+}
+
+func (p *Program) Close() error {
+	return errUnsupported
+}
+
+func (p *Program) Open(queue int) (*Socket, error) {
+	return nil, errUnsupported
+}
+
+func (s *Socket) Close() error {
+	return errUnsupported
+}
+
+func (s *Socket) Serve(ctx context.Context, h Handler) error {
+	return errUnsupported
+}
@@ -0,0 +1,130 @@
+package xdp_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"testing"
+
+	"example.com/scion-time/net/xdp"
+)
+
+const (
+	ethHdrLen  = 14
+	ipv4HdrLen = 20
+	udpHdrLen  = 8
+	payloadLen = 48
+)
+
+var (
+	clientMAC = []byte{0x02, 0, 0, 0, 0, 0x01}
+	serverMAC = []byte{0x02, 0, 0, 0, 0, 0x02}
+	clientIP  = netip.MustParseAddr("192.0.2.1")
+	serverIP  = netip.MustParseAddr("192.0.2.2")
+)
+
+func sum(b []byte) uint32 {
+	var s uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		s += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		s += uint32(b[len(b)-1]) << 8
+	}
+	for s > 0xffff {
+		s = s>>16 + s&0xffff
+	}
+	return s
+}
+
+func frame() []byte {
+	b := make([]byte, ethHdrLen+ipv4HdrLen+udpHdrLen+payloadLen)
+	copy(b[0:], serverMAC)
+	copy(b[6:], clientMAC)
+	binary.BigEndian.PutUint16(b[12:], 0x0800)
+	ip := b[ethHdrLen:]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], ipv4HdrLen+udpHdrLen+payloadLen)
+	ip[8] = 32
+	ip[9] = 17
+	copy(ip[12:], clientIP.AsSlice())
+	copy(ip[16:], serverIP.AsSlice())
+	udp := ip[ipv4HdrLen:]
+	binary.BigEndian.PutUint16(udp[0:], 50000)
+	binary.BigEndian.PutUint16(udp[2:], 123)
+	binary.BigEndian.PutUint16(udp[4:], udpHdrLen+payloadLen)
+	udp[udpHdrLen] = 0x23
+	return b
+}
+
+func TestReply(t *testing.T) {
+	b := frame()
+	var src netip.AddrPort
+	ok := xdp.Reply(b, payloadLen, func(payload []byte, s netip.AddrPort) bool {
+		src = s
+		payload[0] = 0x24
+		payload[payloadLen-1] = 0xff
+		return true
+	})
+	if !ok {
+		t.Fatal("Reply() = false; want true")
+	}
+	if want := netip.AddrPortFrom(clientIP, 50000); src != want {
+		t.Errorf("handler called with source %v; want %v", src, want)
+	}
+	if !bytes.Equal(b[0:6], clientMAC) || !bytes.Equal(b[6:12], serverMAC) {
+		t.Errorf("MAC addresses not swapped: % x", b[:12])
+	}
+	ip := b[ethHdrLen : ethHdrLen+ipv4HdrLen]
+	if !bytes.Equal(ip[12:16], serverIP.AsSlice()) || !bytes.Equal(ip[16:20], clientIP.AsSlice()) {
+		t.Errorf("IP addresses not swapped: % x", ip[12:20])
+	}
+	if s := sum(ip); s != 0xffff {
+		t.Errorf("IP header checksum invalid: sum = %#x", s)
+	}
+	udp := b[ethHdrLen+ipv4HdrLen:]
+	if binary.BigEndian.Uint16(udp[0:]) != 123 || binary.BigEndian.Uint16(udp[2:]) != 50000 {
+		t.Errorf("UDP ports not swapped: % x", udp[:4])
+	}
+	pseudo := append(append([]byte{}, ip[12:20]...), 0, 17, 0, udpHdrLen+payloadLen)
+	if s := sum(append(pseudo, udp...)); s != 0xffff {
+		t.Errorf("UDP checksum invalid: sum = %#x", s)
+	}
+}
+
+func TestReplyRejectsFrames(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(b []byte) []byte
+	}{
+		{"short", func(b []byte) []byte { return b[:len(b)-1] }},
+		{"long", func(b []byte) []byte { return append(b, 0) }},
+		{"ethertype", func(b []byte) []byte { b[12], b[13] = 0x86, 0xdd; return b }},
+		{"ip options", func(b []byte) []byte { b[ethHdrLen] = 0x46; return b }},
+		{"ip protocol", func(b []byte) []byte { b[ethHdrLen+9] = 6; return b }},
+	}
+	for _, test := range tests {
+		b := test.modify(frame())
+		orig := append([]byte{}, b...)
+		called := false
+		ok := xdp.Reply(b, payloadLen, func([]byte, netip.AddrPort) bool {
+			called = true
+			return true
+		})
+		if ok || called {
+			t.Errorf("%s: Reply() = %v, handler called = %v; want false, false", test.name, ok, called)
+		}
+		if !bytes.Equal(b, orig) {
+			t.Errorf("%s: Reply() modified rejected frame", test.name)
+		}
+	}
+
+	b := frame()
+	orig := append([]byte{}, b...)
+	if xdp.Reply(b, payloadLen, func([]byte, netip.AddrPort) bool { return false }) {
+		t.Error("Reply() = true for declined request; want false")
+	}
+	if !bytes.Equal(b, orig) {
+		t.Error("Reply() modified declined frame")
+	}
+}
@@ -0,0 +1,279 @@
+package scionntp
+
+// Library API to query SCION time servers from other Go programs without
+// running the time service. A Client measures the offset of the local system
+// clock relative to a single time server over one or more SCION paths:
+//
+//	scionntp.RegisterSystemClock(log)
+//	c, err := scionntp.Dial(ctx, scionntp.Config{
+//		DaemonAddr: "127.0.0.1:30255",
+//		LocalAddr:  "1-ff00:0:111,10.0.0.1",
+//		RemoteAddr: "1-ff00:0:110,10.0.0.2:123",
+//	})
+//	if err != nil {
+//		...
+//	}
+//	defer c.Close()
+//	m, err := c.MeasureOffset(ctx)
+//
+// Measurements never adjust the local clock.
+//
+// Clients share process-wide state with the time service packages they are
+// built on: the local clock used to timestamp measurements and the SCION end
+// host port range. Dial does not change either; programs opt in explicitly
+// with RegisterSystemClock and SetDispatcherless before dialing.
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/scionproto/scion/pkg/daemon"
+	"github.com/scionproto/scion/pkg/snet"
+	"github.com/scionproto/scion/pkg/snet/path"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/net/scion"
+	"example.com/scion-time/net/udp"
+)
+
+const defaultNumPaths = 1
+
+type Config struct {
+	// DaemonAddr is the address of the SCION daemon used for path lookups
+	DaemonAddr string
+	// LocalAddr is the local SCION address, e.g., "1-ff00:0:111,10.0.0.1"
+	LocalAddr string
+	// RemoteAddr is the SCION address of the time server, e.g.,
+	// "1-ff00:0:110,10.0.0.2:123"
+	RemoteAddr string
+	// NumPaths is the maximum number of paths used per measurement, 1 if 0
+	NumPaths int
+	// SPAO enables authentication via the SCION Packet Authenticator Option
+	SPAO bool
+	// NTSKEServer enables NTS authentication with keys from the given NTS-KE
+	// server, e.g., "time.example.com:4460"
+	NTSKEServer             string
+	NTSKEInsecureSkipVerify bool
+	// Log is used for diagnostic output, no output if nil
+	Log *zap.Logger
+}
+
+// Measurement is the result of a measurement over a single path.
+type Measurement struct {
+	Time          time.Time
+	Offset        time.Duration
+	Delay         time.Duration
+	Authenticated bool
+	Path          string // path fingerprint
+}
+
+type Client struct {
+	log       *zap.Logger
+	dc        daemon.Connector
+	laddr     *snet.UDPAddr
+	raddr     *snet.UDPAddr
+	n         int
+	newClient func() *client.SCIONClient
+	mu        sync.Mutex
+	// The interleaved mode state is kept per path, independent of the order
+	// in which the paths are returned by the daemon.
+	ntpcs map[snet.PathFingerprint]*client.SCIONClient
+}
+
+// Classes of measurement failures, to be tested with errors.Is.
+var (
+	ErrTimeout          = client.ErrTimeout
+	ErrAuthFailed       = client.ErrAuthFailed
+	ErrUnexpectedSource = client.ErrUnexpectedSource
+	ErrBadPacket        = client.ErrBadPacket
+	ErrKoD              = client.ErrKoD
+)
+
+var (
+	errInvalidNumPaths = errors.New("invalid number of paths")
+	errNoDaemon        = errors.New("failed to connect to SCION daemon")
+	errNoClock         = errors.New("no local clock registered")
+	errNoPaths         = errors.New("no paths available")
+	errNoMeasurement   = errors.New("no measurement available")
+	errClosed          = errors.New("client closed")
+)
+
+// Dial creates a client for the time server at cfg.RemoteAddr. It does not
+// modify process-wide state: a local clock must have been registered, e.g.,
+// with RegisterSystemClock, and dispatcherless operation must have been
+// enabled with SetDispatcherless if required.
+func Dial(ctx context.Context, cfg Config) (*Client, error) {
+	if !timebase.Registered() {
+		return nil, errNoClock
+	}
+	laddr, err := snet.ParseUDPAddr(cfg.LocalAddr)
+	if err != nil {
+		return nil, err
+	}
+	raddr, err := snet.ParseUDPAddr(cfg.RemoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	n := cfg.NumPaths
+	if n == 0 {
+		n = defaultNumPaths
+	}
+	if n < 0 {
+		return nil, errInvalidNumPaths
+	}
+	var ntskeHost, ntskePort string
+	if cfg.NTSKEServer != "" {
+		ntskeHost, ntskePort, err = net.SplitHostPort(cfg.NTSKEServer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	log := cfg.Log
+	if log == nil {
+		log = zap.NewNop()
+	}
+
+	dc := scion.NewDaemonConnector(ctx, cfg.DaemonAddr)
+	if dc == nil {
+		return nil, errNoDaemon
+	}
+
+	localAddr := udp.UDPAddrFromSnet(laddr)
+	remoteAddr := udp.UDPAddrFromSnet(raddr)
+	newClient := func() *client.SCIONClient {
+		ntpc := &client.SCIONClient{
+			InterleavedMode: true,
+		}
+		if cfg.SPAO {
+			ntpc.Auth.Enabled = true
+			ntpc.Auth.DRKeyFetcher = scion.NewFetcher(dc)
+		}
+		if cfg.NTSKEServer != "" {
+			ntpc.Auth.NTSEnabled = true
+			ntpc.Auth.NTSKEFetcher.TLSConfig = tls.Config{
+				NextProtos:         []string{"ntske/1"},
+				InsecureSkipVerify: cfg.NTSKEInsecureSkipVerify,
+				ServerName:         ntskeHost,
+				MinVersion:         tls.VersionTLS13,
+			}
+			ntpc.Auth.NTSKEFetcher.Port = ntskePort
+			ntpc.Auth.NTSKEFetcher.Log = log
+			ntpc.Auth.NTSKEFetcher.QUIC.Enabled = true
+			ntpc.Auth.NTSKEFetcher.QUIC.DaemonAddr = cfg.DaemonAddr
+			ntpc.Auth.NTSKEFetcher.QUIC.LocalAddr = localAddr
+			ntpc.Auth.NTSKEFetcher.QUIC.RemoteAddr = remoteAddr
+		}
+		return ntpc
+	}
+	return &Client{
+		log:       log,
+		dc:        dc,
+		laddr:     laddr,
+		raddr:     raddr,
+		n:         n,
+		newClient: newClient,
+		ntpcs:     make(map[snet.PathFingerprint]*client.SCIONClient),
+	}, nil
+}
+
+// clients returns the NTP clients for the paths ps. The state of paths no
+// longer in use is discarded.
+func (c *Client) clients(ps []snet.Path) []*client.SCIONClient {
+	ntpcs := make([]*client.SCIONClient, len(ps))
+	used := make(map[snet.PathFingerprint]*client.SCIONClient, len(ps))
+	for i, p := range ps {
+		fp := snet.Fingerprint(p)
+		ntpc, ok := c.ntpcs[fp]
+		if !ok {
+			ntpc = c.newClient()
+		}
+		used[fp] = ntpc
+		ntpcs[i] = ntpc
+	}
+	c.ntpcs = used
+	return ntpcs
+}
+
+func (c *Client) paths(ctx context.Context) ([]snet.Path, error) {
+	if c.raddr.IA.Equal(c.laddr.IA) {
+		return []snet.Path{path.Path{
+			Src:           c.raddr.IA,
+			Dst:           c.raddr.IA,
+			DataplanePath: path.Empty{},
+		}}, nil
+	}
+	ps, err := c.dc.Paths(ctx, c.raddr.IA, c.laddr.IA, daemon.PathReqFlags{Refresh: true})
+	if err != nil {
+		return nil, err
+	}
+	if len(ps) == 0 {
+		return nil, errNoPaths
+	}
+	if len(ps) > c.n {
+		ps = ps[:c.n]
+	}
+	return ps, nil
+}
+
+// MeasureOffset measures the offset of the local clock relative to the time
+// server over up to cfg.NumPaths paths. It returns the measurements of all
+// paths that succeeded and an error only if none did.
+func (c *Client) MeasureOffset(ctx context.Context) ([]Measurement, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dc == nil {
+		return nil, errClosed
+	}
+	ps, err := c.paths(ctx)
+	if err != nil {
+		return nil, err
+	}
+	localAddr := udp.UDPAddrFromSnet(c.laddr)
+	remoteAddr := udp.UDPAddrFromSnet(c.raddr)
+	ntpcs := c.clients(ps)
+	var ms []Measurement
+	for i, p := range ps {
+		ntpc := ntpcs[i]
+		_, err = client.MeasureClockOffsetSCION(ctx, c.log,
+			[]*client.SCIONClient{ntpc}, localAddr, remoteAddr, []snet.Path{p})
+		if err != nil {
+			continue
+		}
+		s, ok := ntpc.LastSample()
+		if !ok {
+			err = errNoMeasurement
+			continue
+		}
+		ms = append(ms, Measurement{
+			Time:          s.Time,
+			Offset:        s.Offset,
+			Delay:         s.Delay,
+			Authenticated: s.Authenticated,
+			Path:          snet.Fingerprint(p).String(),
+		})
+	}
+	if len(ms) == 0 {
+		return nil, err
+	}
+	return ms, nil
+}
+
+// Close releases the connection to the SCION daemon.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dc == nil {
+		return errClosed
+	}
+	err := c.dc.Close()
+	c.dc = nil
+	return err
+}
@@ -0,0 +1,116 @@
+package scionntp_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/private/common"
+	"github.com/scionproto/scion/pkg/snet"
+	"github.com/scionproto/scion/pkg/snet/path"
+
+	"google.golang.org/grpc"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/timebase"
+	"example.com/scion-time/net/scion"
+	"example.com/scion-time/pkg/scionntp"
+)
+
+func testPath(id int) snet.Path {
+	ia := addr.MustIAFrom(1, 0xff0000000110)
+	return path.Path{
+		Src:           ia,
+		Dst:           ia,
+		DataplanePath: path.Empty{},
+		Meta: snet.PathMetadata{
+			Interfaces: []snet.PathInterface{{IA: ia, ID: common.IFIDType(id)}},
+		},
+	}
+}
+
+func TestClientsKeyedByPath(t *testing.T) {
+	var n int
+	c := scionntp.NewTestClient(func() *client.SCIONClient {
+		n++
+		return &client.SCIONClient{InterleavedMode: true}
+	})
+
+	p1, p2, p3 := testPath(1), testPath(2), testPath(3)
+	cs := c.Clients([]snet.Path{p1, p2})
+	if n != 2 {
+		t.Fatalf("created %d clients; want 2", n)
+	}
+	c1, c2 := cs[0], cs[1]
+	if c1 == c2 {
+		t.Fatal("paths share a client")
+	}
+
+	// Reordered paths keep their clients
+	cs = c.Clients([]snet.Path{p2, p1})
+	if cs[0] != c2 || cs[1] != c1 {
+		t.Error("reordered paths did not keep their clients")
+	}
+	if n != 2 {
+		t.Errorf("created %d clients; want 2", n)
+	}
+
+	// A new path in the position of a previous one gets a new client
+	cs = c.Clients([]snet.Path{p3, p1})
+	if cs[0] == c1 || cs[0] == c2 || cs[1] != c1 {
+		t.Error("new path did not get a new client")
+	}
+	if n != 3 {
+		t.Errorf("created %d clients; want 3", n)
+	}
+
+	// The state of paths no longer in use is discarded
+	cs = c.Clients([]snet.Path{p2})
+	if cs[0] == c2 {
+		t.Error("path kept the client of a previous use after being dropped")
+	}
+	if n != 4 {
+		t.Errorf("created %d clients; want 4", n)
+	}
+}
+
+func TestDialProcessState(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// Dial only connects to the daemon, which need not serve any paths
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	daemon := grpc.NewServer()
+	go func() { _ = daemon.Serve(ln) }()
+	defer daemon.Stop()
+	cfg := scionntp.Config{
+		DaemonAddr: ln.Addr().String(),
+		LocalAddr:  "1-ff00:0:111,127.0.0.1",
+		RemoteAddr: "1-ff00:0:110,127.0.0.2:123",
+	}
+
+	// Dial neither registers a local clock nor enables dispatcherless mode
+	if !timebase.Registered() {
+		if _, err := scionntp.Dial(ctx, cfg); err == nil {
+			t.Error("Dial succeeded without a local clock")
+		}
+		if timebase.Registered() {
+			t.Error("Dial registered a local clock")
+		}
+		if !scionntp.RegisterSystemClock(nil) {
+			t.Fatal("RegisterSystemClock did not register the system clock")
+		}
+	}
+	c, err := scionntp.Dial(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+	if _, ok := scion.EndhostPortRange(); ok {
+		t.Error("Dial set the end host port range")
+	}
+}
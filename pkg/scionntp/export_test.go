@@ -0,0 +1,18 @@
+package scionntp
+
+import (
+	"github.com/scionproto/scion/pkg/snet"
+
+	"example.com/scion-time/core/client"
+)
+
+func NewTestClient(newClient func() *client.SCIONClient) *Client {
+	return &Client{
+		newClient: newClient,
+		ntpcs:     make(map[snet.PathFingerprint]*client.SCIONClient),
+	}
+}
+
+func (c *Client) Clients(ps []snet.Path) []*client.SCIONClient {
+	return c.clients(ps)
+}
@@ -0,0 +1,32 @@
+package scionntp
+
+import (
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/timebase"
+
+	"example.com/scion-time/driver/clock"
+
+	"example.com/scion-time/net/scion"
+)
+
+// RegisterSystemClock registers the system clock as the local clock of the
+// process unless the program has already registered one, and reports whether
+// it did. The local clock is used to timestamp the measurements of all
+// clients and must be registered before Dial.
+func RegisterSystemClock(log *zap.Logger) bool {
+	if log == nil {
+		log = zap.NewNop()
+	}
+	return timebase.RegisterClockIfUnset(&clock.SystemClock{Log: log})
+}
+
+// SetDispatcherless enables sending and receiving packets without a SCION
+// dispatcher for all clients of the process by setting the process-wide SCION
+// end host port range to the default one. It should be called before Dial.
+func SetDispatcherless() {
+	scion.SetEndhostPortRange(scion.PortRange{
+		Min: scion.EndhostPortRangeMin,
+		Max: scion.EndhostPortRangeMax,
+	})
+}
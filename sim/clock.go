@@ -0,0 +1,154 @@
+package sim
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/core/timebase"
+)
+
+// Clock is a virtual local clock. Its frequency error is given by Drift, its
+// readings are subject to Gaussian noise with standard deviation Jitter.
+// Sleeping advances virtual time immediately.
+type Clock struct {
+	Drift  float64
+	Jitter time.Duration
+
+	mu        sync.Mutex
+	rand      *rand.Rand
+	epoch     uint64
+	start     time.Time
+	t, l      time.Time
+	freq      float64
+	adjActive bool
+	adjEnd    time.Time
+	afterFreq float64
+	end       time.Time
+	stop      context.CancelFunc
+	samples   []Sample
+}
+
+var _ timebase.LocalClock = (*Clock)(nil)
+
+// NewClock returns a virtual clock that is initially off by offset from true
+// time. Random noise is derived from seed.
+func NewClock(offset time.Duration, seed int64) *Clock {
+	t := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	return &Clock{
+		rand:  rand.New(rand.NewSource(seed)),
+		start: t,
+		t:     t,
+		l:     t.Add(offset),
+	}
+}
+
+func (c *Clock) rate() float64 {
+	return 1.0 + c.Drift + c.freq
+}
+
+// advance lets local time progress by d and true time accordingly.
+func (c *Clock) advance(d time.Duration) {
+	for d > 0 {
+		step := d
+		if c.adjActive && c.adjEnd.Sub(c.l) < step {
+			step = c.adjEnd.Sub(c.l)
+		}
+		c.t = c.t.Add(timemath.Duration(timemath.Seconds(step) / c.rate()))
+		c.l = c.l.Add(step)
+		d -= step
+		if c.adjActive && !c.l.Before(c.adjEnd) {
+			c.freq = c.afterFreq
+			c.adjActive = false
+		}
+	}
+}
+
+func (c *Clock) endAdjustment() {
+	if c.adjActive {
+		c.freq = c.afterFreq
+		c.adjActive = false
+	}
+}
+
+// TrueTime returns the current virtual true time.
+func (c *Clock) TrueTime() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+// Offset returns the current offset of the clock from true time, ignoring
+// reading noise.
+func (c *Clock) Offset() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.l.Sub(c.t)
+}
+
+func (c *Clock) Epoch() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.epoch
+}
+
+// read returns the current local time with reading noise drawn from r.
+func (c *Clock) read(r *rand.Rand) time.Time {
+	return c.l.Add(timemath.Duration(r.NormFloat64() * timemath.Seconds(c.Jitter)))
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.read(c.rand)
+}
+
+func (c *Clock) MaxDrift(duration time.Duration) time.Duration {
+	return math.MaxInt64
+}
+
+func (c *Clock) Step(offset time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.endAdjustment()
+	c.l = c.l.Add(offset)
+	if c.epoch == math.MaxUint64 {
+		panic("epoch overflow")
+	}
+	c.epoch++
+}
+
+func (c *Clock) Adjust(offset, duration time.Duration, frequency float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if duration < 0 {
+		panic("invalid duration value")
+	}
+	duration = duration / time.Second * time.Second
+	if duration == 0 {
+		duration = time.Second
+	}
+	c.freq = frequency + timemath.Seconds(offset)/timemath.Seconds(duration)
+	c.adjActive = true
+	c.adjEnd = c.l.Add(duration)
+	c.afterFreq = frequency
+}
+
+func (c *Clock) Sleep(duration time.Duration) {
+	if duration < 0 {
+		panic("invalid duration value")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance(duration)
+	c.samples = append(c.samples, Sample{
+		Time:   c.t.Sub(c.start),
+		Offset: c.l.Sub(c.t),
+	})
+	if c.stop != nil && !c.t.Before(c.end) {
+		c.stop()
+	}
+}
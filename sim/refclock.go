@@ -0,0 +1,67 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/base/timemath"
+
+	"example.com/scion-time/core/client"
+)
+
+// ReferenceClock is a simulated reference clock measured over a network path
+// with the given base one-way delay, asymmetry between the forward and the
+// backward delay, exponentially distributed delay jitter, and packet loss
+// probability. Offset is the reference clock's own error from true time.
+type ReferenceClock struct {
+	Offset    time.Duration
+	Delay     time.Duration
+	Asymmetry time.Duration
+	Jitter    time.Duration
+	Loss      float64
+
+	clk  *Clock
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+var (
+	errPacketLoss = errors.New("simulated packet loss")
+
+	_ client.ReferenceClock = (*ReferenceClock)(nil)
+)
+
+// NewReferenceClock returns a reference clock against which clk is measured.
+// Random noise is derived from seed.
+func NewReferenceClock(clk *Clock, seed int64) *ReferenceClock {
+	return &ReferenceClock{
+		clk:  clk,
+		rand: rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (c *ReferenceClock) MeasureClockOffset(ctx context.Context, log *zap.Logger) (
+	time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Loss != 0 && c.rand.Float64() < c.Loss {
+		return 0, errPacketLoss
+	}
+	fwd := c.Delay + c.Asymmetry/2 +
+		timemath.Duration(c.rand.ExpFloat64()*timemath.Seconds(c.Jitter))
+	bwd := c.Delay - c.Asymmetry/2 +
+		timemath.Duration(c.rand.ExpFloat64()*timemath.Seconds(c.Jitter))
+	c.clk.mu.Lock()
+	t, l := c.clk.t, c.clk.read(c.rand)
+	c.clk.mu.Unlock()
+	// The offset derived from an NTP exchange is off by half the difference
+	// between forward and backward delay.
+	off := t.Add(c.Offset).Sub(l) + (fwd-bwd)/2
+	log.Debug("simulated measurement", zap.Duration("offset", off))
+	return off, nil
+}
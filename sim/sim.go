@@ -0,0 +1,57 @@
+package sim
+
+// Simulation harness running the clock synchronization algorithms of package
+// core/sync on virtual clocks, without network access and in virtual time.
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/sync"
+)
+
+// Sample is the offset of the simulated local clock from true time after the
+// given amount of virtual time has passed.
+type Sample struct {
+	Time   time.Duration
+	Offset time.Duration
+}
+
+// Run synchronizes clk to refClocks for the given amount of virtual time and
+// returns the resulting offset samples. If global is set, refClocks are
+// treated as network peers instead of local reference clocks. Since package
+// core/sync keeps its state globally, Run may only be called once per process.
+func Run(log *zap.Logger, clk *Clock, refClocks []*ReferenceClock, global bool,
+	duration time.Duration) []Sample {
+	clks := make([]client.ReferenceClock, len(refClocks))
+	for i, c := range refClocks {
+		if c.clk != clk {
+			panic("unexpected reference clock")
+		}
+		clks[i] = c
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clk.mu.Lock()
+	clk.end = clk.t.Add(duration)
+	clk.stop = cancel
+	clk.samples = nil
+	clk.mu.Unlock()
+
+	if global {
+		sync.RegisterClocks(nil, clks)
+		sync.RunGlobalClockSync(ctx, log, clk)
+	} else {
+		sync.RegisterClocks(clks, nil)
+		sync.SyncToRefClocks(ctx, log, clk)
+		sync.RunLocalClockSync(ctx, log, clk)
+	}
+
+	clk.mu.Lock()
+	defer clk.mu.Unlock()
+	return clk.samples
+}
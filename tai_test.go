@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+
+	"example.com/scion-time/core/leapsec"
+	"example.com/scion-time/core/timebase"
+	"example.com/scion-time/net/ptp"
+)
+
+func TestPTPTAIOffset(t *testing.T) {
+	if log == nil {
+		log = zap.NewNop()
+	}
+	const (
+		gm    = 0x0011223344556677
+		flags = ptp.FlagPTPTimescale | ptp.FlagCurrentUTCOffsetValid
+	)
+	timebase.SetTAIOffset(timebase.TAIOffset{Offset: 36, Source: "config"})
+	p := &ptpTAIOffset{grandmaster: gm}
+
+	steps := []struct {
+		name      string
+		msg       ptp.Announce
+		offset    int
+		source    string
+		disagrees bool
+	}{
+		{"other grandmaster", ptp.Announce{GrandmasterID: gm + 1, Flags: flags, CurrentUTCOffset: 37}, 36, "config", false},
+		{"offset not valid", ptp.Announce{GrandmasterID: gm, Flags: ptp.FlagPTPTimescale, CurrentUTCOffset: 37}, 36, "config", false},
+		{"valid", ptp.Announce{GrandmasterID: gm, Flags: flags, CurrentUTCOffset: 37}, 37, "ptp:0011223344556677", false},
+		{"implausible", ptp.Announce{GrandmasterID: gm, Flags: flags, CurrentUTCOffset: 30}, 37, "ptp:0011223344556677", false},
+		{"jump", ptp.Announce{GrandmasterID: gm, Flags: flags, CurrentUTCOffset: 39}, 37, "ptp:0011223344556677", true},
+		{"agrees again", ptp.Announce{GrandmasterID: gm, Flags: flags, CurrentUTCOffset: 37}, 37, "ptp:0011223344556677", false},
+	}
+	for _, s := range steps {
+		p.update(s.msg)
+		o, ok := timebase.CurrentTAIOffset()
+		if !ok || o.Offset != s.offset || o.Source != s.source {
+			t.Fatalf("%s: TAI offset = %d (%s), want %d (%s)", s.name, o.Offset, o.Source, s.offset, s.source)
+		}
+		if p.disagrees != s.disagrees {
+			t.Fatalf("%s: disagrees = %v, want %v", s.name, p.disagrees, s.disagrees)
+		}
+	}
+
+	timebase.SetTAIOffset(timebase.TAIOffset{Offset: 37, Source: leapsec.Source})
+	p.update(ptp.Announce{GrandmasterID: gm, Flags: flags, CurrentUTCOffset: 38})
+	o, _ := timebase.CurrentTAIOffset()
+	if o.Offset != 37 || o.Source != leapsec.Source || !p.disagrees {
+		t.Fatalf("TAI offset = %d (%s), disagrees = %v; want 37 (%s), true",
+			o.Offset, o.Source, p.disagrees, leapsec.Source)
+	}
+}
@@ -3,20 +3,32 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/csv"
 	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"flag"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/mmcloughlin/profile"
-	"github.com/pelletier/go-toml/v2"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/scionproto/scion/pkg/addr"
@@ -28,62 +40,188 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"example.com/scion-time/base/audit"
+	"example.com/scion-time/base/events"
+	"example.com/scion-time/base/metrics"
+	"example.com/scion-time/base/privilege"
+	"example.com/scion-time/base/seccomp"
+	"example.com/scion-time/base/systemd"
+	"example.com/scion-time/base/timemath"
+	"example.com/scion-time/base/tracing"
+
 	"example.com/scion-time/benchmark"
 
 	"example.com/scion-time/core/client"
+	"example.com/scion-time/core/config"
+	"example.com/scion-time/core/control"
+	"example.com/scion-time/core/discovery"
+	"example.com/scion-time/core/leapsec"
+	"example.com/scion-time/core/phcmon"
+	"example.com/scion-time/core/report"
 	"example.com/scion-time/core/server"
 	"example.com/scion-time/core/sync"
 	"example.com/scion-time/core/timebase"
 
 	"example.com/scion-time/driver/clock"
+	"example.com/scion-time/driver/csac"
 	"example.com/scion-time/driver/mbg"
+	"example.com/scion-time/driver/phc"
 
 	"example.com/scion-time/net/ntp"
 	"example.com/scion-time/net/ntske"
+	"example.com/scion-time/net/pcap"
+	"example.com/scion-time/net/ptp"
 	"example.com/scion-time/net/scion"
+	"example.com/scion-time/net/scion/spao"
 	"example.com/scion-time/net/udp"
+
+	"example.com/scion-time/sim"
 )
 
 const (
 	dispatcherModeExternal = "external"
 	dispatcherModeInternal = "internal"
-	authModeNTS            = "nts"
-	authModeSPAO           = "spao"
+	dispatcherModeNone     = "none"
+	toolFormatCSV          = "csv"
+	toolFormatJSON         = "json"
 
 	tlsCertReloadInterval = time.Minute * 10
+	shutdownTimeout       = time.Second * 5
 
 	scionRefClockNumClient = 5
+
+	// While falling back to NTP over SCION streams, every n-th measurement
+	// probes whether datagram exchanges succeed again.
+	scionStreamProbeInterval = 8
+
+	dualTransportSCION = 1
+	dualTransportIP    = 2
+
+	// After falling back to NTP over IP, a dual reference clock keeps using IP
+	// for this long before it retries SCION, so that a flapping SCION path
+	// does not alternate the transport in every round.
+	dualTransportHoldDown = time.Minute * 5
+
+	// The TAI-UTC offset has been 37 s since 2017 and is not expected to
+	// decrease. An offset announced via PTP may differ from a known offset
+	// by one leap second at most.
+	ptpMinTAIOffset       = 37
+	ptpMaxTAIOffsetChange = 1
+
+	dualStackRaceInterval  = time.Minute * 15
+	dualStackLookupTimeout = time.Second * 5
+
+	mbgRefID  = 0x47505300 // "GPS"
+	phcRefID  = 0x50484300 // "PHC"
+	csacRefID = 0x43534143 // "CSAC"
 )
 
-type svcConfig struct {
-	LocalAddr               string   `toml:"local_address,omitempty"`
-	DaemonAddr              string   `toml:"daemon_address,omitempty"`
-	RemoteAddr              string   `toml:"remote_address,omitempty"`
-	MBGReferenceClocks      []string `toml:"mbg_reference_clocks,omitempty"`
-	NTPReferenceClocks      []string `toml:"ntp_reference_clocks,omitempty"`
-	SCIONPeers              []string `toml:"scion_peers,omitempty"`
-	NTSKECertFile           string   `toml:"ntske_cert_file,omitempty"`
-	NTSKEKeyFile            string   `toml:"ntske_key_file,omitempty"`
-	NTSKEServerName         string   `toml:"ntske_server_name,omitempty"`
-	AuthModes               []string `toml:"auth_modes,omitempty"`
-	NTSKEInsecureSkipVerify bool     `toml:"ntske_insecure_skip_verify,omitempty"`
+type listener struct {
+	localAddr *snet.UDPAddr
+	ip, scion bool
+}
+
+// refClockSample records the last offset measured by a hardware reference
+// clock.
+type refClockSample struct {
+	last atomic.Pointer[client.Sample]
 }
 
 type mbgReferenceClock struct {
-	dev string
+	refClockSample
+	dev   string
+	valid atomic.Bool
+}
+
+type phcReferenceClock struct {
+	refClockSample
+	clk   *phc.Clock
+	valid atomic.Bool
+}
+
+type csacReferenceClock struct {
+	refClockSample
+	clk   *csac.Clock
+	valid atomic.Bool
+}
+
+// phcRelativeReferenceClock measures the offset of a reference clock relative
+// to the PHC disciplined by a sync instance instead of the system clock.
+type phcRelativeReferenceClock struct {
+	client.ReferenceClock
+	phc *phc.Clock
 }
 
 type ntpReferenceClockIP struct {
 	ntpc       *client.IPClient
 	localAddr  *net.UDPAddr
 	remoteAddr *net.UDPAddr
+	valid      atomic.Bool
 }
 
 type ntpReferenceClockSCION struct {
 	ntpcs      [scionRefClockNumClient]*client.SCIONClient
+	probec     *client.SCIONClient
 	localAddr  udp.UDPAddr
 	remoteAddr udp.UDPAddr
-	pather     *scion.Pather
+	pather     client.PathProvider
+	selector   *client.PathSelector
+	stop       context.CancelFunc
+	valid      atomic.Bool
+	streamc    *client.SCIONStreamClient
+	stream     atomic.Bool
+	streamN    atomic.Uint64
+	weight     atomic.Uint64 // bits of the weight of the median of the paths
+}
+
+// ntpReferenceClockDual measures the offset to a server via NTP over SCION
+// and falls back to NTP over IP while SCION is unavailable.
+type ntpReferenceClockDual struct {
+	scionclk   dualSCIONClock
+	ipclk      dualClock
+	transport  atomic.Int32
+	fellBackAt time.Time
+}
+
+// dualClock is the reference clock of one transport of a dual reference
+// clock.
+type dualClock interface {
+	client.FineReferenceClock
+	client.SourceReporter
+	client.SampleReporter
+	client.PeerStateKeeper
+	fmt.Stringer
+}
+
+// dualSCIONClock is the SCION reference clock of a dual reference clock.
+type dualSCIONClock interface {
+	dualClock
+	client.SyntonizationReporter
+	client.Stopper
+	// unavailable returns why no measurement can be attempted, if any.
+	unavailable() string
+}
+
+// ntpReferenceClockDualStack measures the offset to a server that has both
+// IPv4 and IPv6 addresses. It periodically races exchanges over both address
+// families and sticks to the one with the lower delay in between.
+type ntpReferenceClockDualStack struct {
+	name    string
+	clks    [2]dualStackClock // IPv4, IPv6
+	family  atomic.Int32      // index into clks plus one, 0 if unknown
+	racedAt time.Time
+}
+
+// dualStackClock is the reference clock of one address family of a dual-stack
+// server.
+type dualStackClock interface {
+	client.ReferenceClock
+	client.SourceReporter
+	client.SampleReporter
+	fmt.Stringer
 }
 
 type tlsCertCache struct {
@@ -95,6 +233,13 @@ type tlsCertCache struct {
 
 var (
 	log *zap.Logger
+
+	errInvalidPeerAddr   = errors.New("unexpected peer address")
+	errNoDualStackSample = errors.New("no dual-stack sample available")
+	errNoDaemon          = errors.New("SCION daemon not configured")
+	errCSACNotLocked     = errors.New("CSAC not locked")
+	errCSACNoPhase       = errors.New("CSAC 1PPS phase not available")
+	errUnknownTAIOffset  = errors.New("TAI-UTC offset unknown")
 )
 
 func contains(s []string, v string) bool {
@@ -128,10 +273,560 @@ func initLogger(verbose bool) {
 	}
 }
 
-func runMonitor(log *zap.Logger) {
+func runMonitor(ctx context.Context, log *zap.Logger, addr string) {
 	http.Handle("/metrics", promhttp.Handler())
-	err := http.ListenAndServe("127.0.0.1:8080", nil)
-	log.Fatal("failed to serve metrics", zap.Error(err))
+	srv := &http.Server{Addr: addr}
+	go func() {
+		<-ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			log.Info("failed to shut down metrics server", zap.Error(err))
+		}
+	}()
+	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal("failed to serve metrics", zap.Error(err))
+	}
+}
+
+// goDone runs f in a new goroutine and returns a channel that is closed when
+// f returns.
+func goDone(f func()) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	return done
+}
+
+// awaitShutdown serves metrics on metricsAddr until ctx is done, waits for the
+// sync loops to stop, and leaves the local clock in a defined state.
+func awaitShutdown(ctx context.Context, metricsAddr string, lclk *clock.SystemClock,
+	syncDone []<-chan struct{}) {
+	runMonitor(ctx, log, metricsAddr)
+	log.Info("shutting down")
+	err := systemd.Notify(systemd.Stopping)
+	if err != nil {
+		log.Info("failed to notify service manager", zap.Error(err))
+	}
+	for _, done := range syncDone {
+		<-done
+	}
+	lclk.Stop()
+	for _, s := range client.PathStatistics() {
+		log.Info("path statistics", zap.Any("stats", s))
+	}
+	log.Info("shutdown complete")
+}
+
+// notifyServiceManager signals readiness to systemd as soon as the local clock
+// has been synchronized, or immediately if no clock sync is running, and sends
+// watchdog keepalives as long as the sync loops make progress.
+func notifyServiceManager(ctx context.Context, syncing bool) {
+	go func() {
+		if syncing {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sync.Synchronized():
+			}
+		}
+		err := systemd.Notify(systemd.Ready)
+		if err != nil {
+			log.Error("failed to notify service manager", zap.Error(err))
+		}
+	}()
+	interval, ok := systemd.WatchdogInterval()
+	if !ok {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if !sync.Alive() {
+				log.Warn("clock sync stalled, skipping watchdog keepalive")
+				continue
+			}
+			err := systemd.Notify(systemd.Watchdog)
+			if err != nil {
+				log.Info("failed to notify service manager", zap.Error(err))
+			}
+		}
+	}()
+}
+
+// startClockTree disciplines the configured PHCs and CSACs to the system
+// clock. The devices are opened immediately, i.e., before privileges are
+// dropped.
+func startClockTree(ctx context.Context, cfg config.Service) {
+	if len(cfg.PHCClocks) == 0 && len(cfg.CSACClocks) == 0 {
+		return
+	}
+	var clks []sync.DisciplinedClock
+	for _, s := range cfg.PHCClocks {
+		c, err := phc.Open(log, s)
+		if err != nil {
+			log.Fatal("failed to open PHC", zap.String("dev", s), zap.Error(err))
+		}
+		clks = append(clks, c)
+	}
+	for _, s := range cfg.CSACClocks {
+		c, err := csac.Open(log, s)
+		if err != nil {
+			log.Fatal("failed to open CSAC", zap.String("dev", s), zap.Error(err))
+		}
+		clks = append(clks, c)
+	}
+	go sync.RunClockTree(ctx, log, clks)
+}
+
+// syncInstance is an additional sync instance with the PHC it disciplines.
+type syncInstance struct {
+	s         *sync.SyncInstance
+	lclk      *phc.LocalClock
+	refClocks int
+	netClocks int
+}
+
+// createSyncInstances sets up the configured additional sync instances. Their
+// PHCs are opened immediately, i.e., before privileges are dropped.
+func createSyncInstances(ctx context.Context, cfg config.Service, localAddr *snet.UDPAddr) []syncInstance {
+	var insts []syncInstance
+	for _, si := range cfg.SyncInstances {
+		c, err := phc.Open(log, si.Clock)
+		if err != nil {
+			log.Fatal("failed to open PHC", zap.String("dev", si.Clock), zap.Error(err))
+		}
+		// The reference clocks and peers of an instance are configured like
+		// those of the default instance
+		icfg := cfg
+		icfg.MBGReferenceClocks = nil
+		icfg.PHCReferenceClocks = si.PHCReferenceClocks
+		icfg.CSACReferenceClocks = nil
+		icfg.NTPReferenceClocks = si.NTPReferenceClocks
+		icfg.NTPBroadcastReferences = nil
+		icfg.NTPDualReferenceClocks = nil
+		icfg.SCIONPeers = si.SCIONPeers
+		icfg.SCIONSymmetricPeers = nil
+		refClocks, netClocks, _ := createClocks(ctx, icfg, localAddr)
+		for _, clks := range [][]client.ReferenceClock{refClocks, netClocks} {
+			for i := range clks {
+				clks[i] = &phcRelativeReferenceClock{ReferenceClock: clks[i], phc: c}
+			}
+		}
+		insts = append(insts, syncInstance{
+			s:         sync.NewSyncInstance(si.Name, refClocks, netClocks),
+			lclk:      phc.NewLocalClock(c),
+			refClocks: len(refClocks),
+			netClocks: len(netClocks),
+		})
+	}
+	return insts
+}
+
+// startSyncInstances steps the PHCs of insts to their reference clocks once
+// and disciplines them until ctx is done.
+func startSyncInstances(ctx context.Context, insts []syncInstance) []<-chan struct{} {
+	var done []<-chan struct{}
+	for _, x := range insts {
+		x := x
+		if x.refClocks != 0 {
+			done = append(done, goDone(func() {
+				x.s.SyncToRefClocks(ctx, log, x.lclk)
+				x.s.RunLocalClockSync(ctx, log, x.lclk)
+			}))
+		}
+		if x.netClocks != 0 {
+			done = append(done, goDone(func() { x.s.RunGlobalClockSync(ctx, log, x.lclk) }))
+		}
+	}
+	return done
+}
+
+// checkSyncInstancePeers terminates if one of insts has peers, which are only
+// supported in server mode.
+func checkSyncInstancePeers(insts []syncInstance) {
+	for _, x := range insts {
+		if x.netClocks != 0 {
+			log.Fatal("unexpected configuration",
+				zap.String("sync instance", x.s.Name()), zap.Int("number of peers", x.netClocks))
+		}
+	}
+}
+
+// dropPrivileges changes to the configured user and root directory once all
+// sockets have been bound, keeping only the capability to adjust the clock.
+// Files accessed afterwards, e.g., the drift file, must be accessible to the
+// user within the root directory.
+//
+// Client sockets are still opened per measurement afterwards. Hardware
+// timestamping on the interface of localAddr, which requires CAP_NET_ADMIN,
+// is therefore configured beforehand, and binding to ntp_client_device, which
+// requires CAP_NET_RAW before Linux 5.7, is checked afterwards.
+func dropPrivileges(cfg config.Service, localAddr *snet.UDPAddr) {
+	if cfg.User == "" && cfg.Chroot == "" {
+		return
+	}
+	if iface := localAddr.Host.Zone; iface != "" {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: localAddr.Host.IP, Zone: iface})
+		if err == nil {
+			err = udp.EnableTimestamping(conn, iface)
+			_ = conn.Close()
+		}
+		if err != nil {
+			log.Info("failed to enable timestamping", zap.String("interface", iface), zap.Error(err))
+		}
+	}
+	err := privilege.Drop(cfg.User, cfg.Chroot)
+	if err != nil {
+		log.Fatal("failed to drop privileges", zap.Error(err))
+	}
+	if cfg.NTPClientDevice != "" {
+		conn, err := udp.ListenRandomPort(context.Background(), nil /* ip */, cfg.NTPClientDevice)
+		if err != nil {
+			log.Fatal("failed to bind to client device without privileges",
+				zap.String("device", cfg.NTPClientDevice), zap.Error(err))
+		}
+		_ = conn.Close()
+	}
+	log.Info("dropped privileges",
+		zap.String("user", cfg.User),
+		zap.String("chroot", cfg.Chroot),
+	)
+}
+
+// restrictSyscalls installs the configured seccomp filter after
+// initialization.
+func restrictSyscalls(cfg config.Service) {
+	if cfg.Seccomp == "" || cfg.Seccomp == seccomp.ModeOff {
+		return
+	}
+	err := seccomp.Apply(cfg.Seccomp)
+	if err != nil {
+		log.Fatal("failed to install seccomp filter", zap.Error(err))
+	}
+	log.Info("installed seccomp filter", zap.String("mode", cfg.Seccomp))
+}
+
+func startControl(ctx context.Context, cfg config.Service,
+	newPeer func(string) (client.ReferenceClock, error)) {
+	if cfg.ControlSocket == "" && cfg.GRPCAddress == "" {
+		return
+	}
+	control.Register("paths", func(args url.Values) (any, error) {
+		ss := client.PathStatistics()
+		if peer := args.Get("peer"); peer != "" {
+			var xs []client.PathStats
+			for _, s := range ss {
+				if s.Peer == peer {
+					xs = append(xs, s)
+				}
+			}
+			ss = xs
+		}
+		return ss, nil
+	})
+	control.Register("sources", func(url.Values) (any, error) {
+		return sync.Sources(), nil
+	})
+	control.Register("tracking", func(url.Values) (any, error) {
+		return sync.Tracking(), nil
+	})
+	control.Register("add-peer", func(args url.Values) (any, error) {
+		c, err := newPeer(args.Get("peer"))
+		if err != nil {
+			return nil, err
+		}
+		err = sync.AddPeer(c)
+		if err != nil {
+			return nil, err
+		}
+		return sync.Sources(), nil
+	})
+	control.Register("remove-peer", func(args url.Values) (any, error) {
+		remoteAddr, err := snet.ParseUDPAddr(args.Get("peer"))
+		if err != nil {
+			return nil, err
+		}
+		err = sync.RemovePeer(udp.UDPAddrFromSnet(remoteAddr).String())
+		if err != nil {
+			return nil, err
+		}
+		return sync.Sources(), nil
+	})
+	control.Register("as-stats", func(args url.Values) (any, error) {
+		n := 10
+		if s := args.Get("n"); s != "" {
+			var err error
+			n, err = strconv.Atoi(s)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return server.ASStatistics(n), nil
+	})
+	control.Register("clients", func(url.Values) (any, error) {
+		return server.ClientStatistics(), nil
+	})
+	control.Register("events", func(args url.Values) (any, error) {
+		var since uint64
+		if s := args.Get("since"); s != "" {
+			var err error
+			since, err = strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return events.Events(events.Kind(args.Get("kind")), since), nil
+	})
+	control.Register("audit", func(args url.Values) (any, error) {
+		var since uint64
+		if s := args.Get("since"); s != "" {
+			var err error
+			since, err = strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return audit.Entries(since), nil
+	})
+	control.Register("tai", func(url.Values) (any, error) {
+		o, ok := timebase.CurrentTAIOffset()
+		if !ok {
+			return nil, errUnknownTAIOffset
+		}
+		now, _ := timebase.NowTAI()
+		return struct {
+			timebase.TAIOffset
+			Now time.Time
+		}{o, now}, nil
+	})
+	control.Register("step", func(url.Values) (any, error) {
+		sync.ForceStep()
+		return sync.Tracking(), nil
+	})
+	if cfg.ControlSocket != "" {
+		control.StartServer(ctx, log, cfg.ControlSocket)
+	}
+	if cfg.GRPCAddress != "" {
+		var roles []control.Role
+		for _, r := range cfg.GRPCRoles {
+			roles = append(roles, control.Role{
+				Name:     r.Name,
+				Clients:  r.Clients,
+				Commands: r.Commands,
+			})
+		}
+		control.StartGRPCServer(ctx, log, cfg.GRPCAddress, grpcTLSConfig(cfg), roles)
+	}
+}
+
+func startPeerDiscovery(ctx context.Context, cfg config.Service, localAddr *snet.UDPAddr,
+	newPeer func(string) (client.ReferenceClock, error)) {
+	dc := cfg.PeerDiscovery
+	if dc == nil {
+		return
+	}
+	policy := discovery.Policy{
+		LocalIA:  localAddr.IA,
+		MaxPeers: dc.MaxPeers,
+	}
+	for _, isd := range dc.ISDs {
+		policy.ISDs = append(policy.ISDs, addr.ISD(isd))
+	}
+	discovery.Start(ctx, log, dc.Registry, config.Duration(dc.Interval), policy, newPeer)
+}
+
+func startComplianceReport(ctx context.Context, cfg config.Service) {
+	rc := cfg.ComplianceReport
+	if rc == nil {
+		return
+	}
+	b, err := os.ReadFile(rc.KeyFile)
+	if err != nil {
+		log.Fatal("failed to load compliance report key", zap.Error(err))
+	}
+	p, _ := pem.Decode(b)
+	if p == nil {
+		log.Fatal("failed to load compliance report key", zap.String("file", rc.KeyFile))
+	}
+	k, err := x509.ParsePKCS8PrivateKey(p.Bytes)
+	if err != nil {
+		log.Fatal("failed to load compliance report key", zap.Error(err))
+	}
+	key, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		log.Fatal("unexpected compliance report key type", zap.String("file", rc.KeyFile))
+	}
+	report.Start(ctx, log, report.Config{
+		Directory:     rc.Directory,
+		Interval:      config.Duration(rc.Interval),
+		Reference:     rc.Reference,
+		MaxDivergence: config.Duration(rc.MaxDivergence),
+		Key:           key,
+	})
+}
+
+// phcDevicesInUse returns the PHCs configured as reference clocks or as clocks
+// disciplined by the time service.
+func phcDevicesInUse(cfg config.Service) []string {
+	var devs []string
+	devs = append(devs, cfg.PHCReferenceClocks...)
+	devs = append(devs, cfg.PHCClocks...)
+	for _, si := range cfg.SyncInstances {
+		devs = append(devs, si.Clock)
+		devs = append(devs, si.PHCReferenceClocks...)
+	}
+	return devs
+}
+
+// startPHCMonitor monitors the offsets of the PHCs in use and of the
+// additionally configured PHCs relative to the system clock. Without a
+// phc_monitor section, the PHCs in use are monitored with the default
+// interval and bound.
+func startPHCMonitor(ctx context.Context, cfg config.Service) {
+	m := cfg.PHCMonitor
+	if m == nil {
+		m = &config.PHCMonitor{
+			Interval:  config.DefaultPHCMonitorInterval.String(),
+			MaxOffset: config.DefaultPHCMonitorMaxOffset.String(),
+		}
+	}
+	var clks []phcmon.Clock
+	seen := make(map[string]bool)
+	for _, dev := range append(phcDevicesInUse(cfg), m.Devices...) {
+		if seen[dev] {
+			continue
+		}
+		seen[dev] = true
+		c, err := phc.Open(log, dev)
+		if err != nil {
+			log.Fatal("failed to open PHC", zap.String("dev", dev), zap.Error(err))
+		}
+		clks = append(clks, c)
+	}
+	phcmon.Start(ctx, log, clks, phcmon.Config{
+		Interval:  config.Duration(m.Interval),
+		Nominal:   config.Duration(m.Nominal),
+		MaxOffset: config.Duration(m.MaxOffset),
+	})
+}
+
+// startTAI sets the configured TAI-UTC offset and starts to track the offset
+// from the leap second list and the offset announced by the PTP grandmaster on
+// the configured network interface.
+func startTAI(ctx context.Context, cfg config.Service) {
+	if cfg.TAIOffset != 0 {
+		timebase.SetTAIOffset(timebase.TAIOffset{Offset: cfg.TAIOffset, Source: "config"})
+	}
+	if cfg.LeapSecondsList != "" {
+		leapsec.Start(ctx, log, cfg.LeapSecondsList, cfg.LeapSecondsCache, config.Duration(cfg.LeapSecondsRefresh))
+	}
+	if cfg.PTPAnnounceInterface == "" {
+		return
+	}
+	gm, err := ptp.ParseClockIdentity(cfg.PTPGrandmaster)
+	if err != nil {
+		log.Fatal("failed to parse PTP grandmaster identity", zap.Error(err))
+	}
+	p := &ptpTAIOffset{grandmaster: gm}
+	err = ptp.ListenAnnounce(ctx, log, cfg.PTPAnnounceInterface, uint8(cfg.PTPDomain), p.update)
+	if err != nil {
+		log.Fatal("failed to listen for PTP announce messages",
+			zap.String("interface", cfg.PTPAnnounceInterface), zap.Error(err))
+	}
+}
+
+// ptpTAIOffset tracks the TAI-UTC offset announced by the configured PTP
+// grandmaster. The offset of the leap second list takes precedence.
+type ptpTAIOffset struct {
+	grandmaster uint64
+	disagrees   bool
+}
+
+// update updates the TAI-UTC offset from the PTP announce message msg if it
+// is sent by the grandmaster, which uses the PTP timescale, and its UTC offset
+// is valid and plausible.
+func (p *ptpTAIOffset) update(msg ptp.Announce) {
+	const flags = ptp.FlagPTPTimescale | ptp.FlagCurrentUTCOffsetValid
+	if msg.GrandmasterID != p.grandmaster || msg.Flags&flags != flags ||
+		msg.CurrentUTCOffset < ptpMinTAIOffset || msg.CurrentUTCOffset > timebase.MaxTAIOffset {
+		return
+	}
+	prev, ok := timebase.CurrentTAIOffset()
+	if ok && (prev.Source == leapsec.Source ||
+		prev.Offset-int(msg.CurrentUTCOffset) > ptpMaxTAIOffsetChange ||
+		int(msg.CurrentUTCOffset)-prev.Offset > ptpMaxTAIOffsetChange) {
+		disagrees := prev.Offset != int(msg.CurrentUTCOffset)
+		if disagrees && !p.disagrees {
+			log.Warn("ignoring TAI-UTC offset announced via PTP",
+				zap.Int16("announced", msg.CurrentUTCOffset),
+				zap.Int("current", prev.Offset),
+				zap.String("source", prev.Source))
+			events.Record(events.KindTAIOffset, fmt.Sprintf("ptp:%016x", msg.GrandmasterID),
+				"announced TAI-UTC offset %d s disagrees with %d s of %s",
+				msg.CurrentUTCOffset, prev.Offset, prev.Source)
+		}
+		p.disagrees = disagrees
+		return
+	}
+	p.disagrees = false
+	o := timebase.TAIOffset{
+		Offset: int(msg.CurrentUTCOffset),
+		Source: fmt.Sprintf("ptp:%016x", msg.GrandmasterID),
+	}
+	// Leap seconds are announced until the end of the current UTC day
+	if leap := msg.Flags & (ptp.FlagLeap61 | ptp.FlagLeap59); leap != 0 {
+		o.NextOffset = o.Offset + 1
+		if leap == ptp.FlagLeap59 {
+			o.NextOffset = o.Offset - 1
+		}
+		o.NextAt = timebase.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	}
+	if ok && prev.Offset == o.Offset && prev.NextOffset == o.NextOffset && prev.NextAt.Equal(o.NextAt) {
+		return
+	}
+	timebase.SetTAIOffset(o)
+	if !ok || prev.Offset != o.Offset {
+		events.Record(events.KindTAIOffset, o.Source, "TAI-UTC offset %d s", o.Offset)
+	}
+	if !o.NextAt.IsZero() && (!ok || !prev.NextAt.Equal(o.NextAt)) {
+		events.Record(events.KindTAIOffset, o.Source, "leap second announced, TAI-UTC offset %d s at %v",
+			o.NextOffset, o.NextAt)
+	}
+}
+
+func grpcTLSConfig(cfg config.Service) *tls.Config {
+	if cfg.GRPCCertFile == "" || cfg.GRPCKeyFile == "" || cfg.GRPCClientCAFile == "" {
+		log.Fatal("missing parameters in configuration for gRPC server")
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.GRPCCertFile, cfg.GRPCKeyFile)
+	if err != nil {
+		log.Fatal("failed to load gRPC server certificate", zap.Error(err))
+	}
+	b, err := os.ReadFile(cfg.GRPCClientCAFile)
+	if err != nil {
+		log.Fatal("failed to load gRPC client CA certificates", zap.Error(err))
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(b) {
+		log.Fatal("failed to parse gRPC client CA certificates", zap.String("file", cfg.GRPCClientCAFile))
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		MinVersion:   tls.VersionTLS13,
+	}
 }
 
 func ntskeServerFromRemoteAddr(remoteAddr string) string {
@@ -155,9 +850,104 @@ func (c *tlsCertCache) loadCert(chi *tls.ClientHelloInfo) (*tls.Certificate, err
 	return c.cert, nil
 }
 
+func (s *refClockSample) store(dev string, off time.Duration, err error) {
+	if err == nil {
+		s.last.Store(&client.Sample{
+			Time:      timebase.Now(),
+			Offset:    off,
+			Transport: client.TransportRefClock,
+			Server:    dev,
+		})
+	}
+}
+
+func (s *refClockSample) LastSample() (client.Sample, bool) {
+	x := s.last.Load()
+	if x == nil {
+		return client.Sample{}, false
+	}
+	return *x, true
+}
+
 func (c *mbgReferenceClock) MeasureClockOffset(ctx context.Context, log *zap.Logger) (
 	time.Duration, error) {
-	return mbg.MeasureClockOffset(ctx, log, c.dev)
+	off, err := mbg.MeasureClockOffset(ctx, log, c.dev)
+	c.valid.Store(err == nil)
+	c.store(c.dev, off, err)
+	return off, err
+}
+
+func (c *mbgReferenceClock) Source() (client.Source, bool) {
+	return client.Source{Stratum: 0, RefID: mbgRefID}, c.valid.Load()
+}
+
+func (c *mbgReferenceClock) String() string {
+	return c.dev
+}
+
+func (c *phcReferenceClock) MeasureClockOffset(ctx context.Context, log *zap.Logger) (
+	time.Duration, error) {
+	off, err := c.clk.MeasureOffset(ctx)
+	c.valid.Store(err == nil)
+	c.store(c.clk.String(), off, err)
+	return off, err
+}
+
+func (c *phcReferenceClock) Source() (client.Source, bool) {
+	return client.Source{Stratum: 0, RefID: phcRefID}, c.valid.Load()
+}
+
+func (c *phcReferenceClock) String() string {
+	return c.clk.String()
+}
+
+func (c *phcRelativeReferenceClock) MeasureClockOffset(ctx context.Context, log *zap.Logger) (
+	time.Duration, error) {
+	off, err := c.ReferenceClock.MeasureClockOffset(ctx, log)
+	if err != nil {
+		return 0, err
+	}
+	phcOff, err := c.phc.MeasureOffsetPrecise(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return off - phcOff, nil
+}
+
+func (c *phcRelativeReferenceClock) String() string {
+	return fmt.Sprint(c.ReferenceClock)
+}
+
+// MeasureClockOffset returns the offset of the oscillator relative to the
+// local clock as long as the oscillator is locked, including holdover of the
+// oscillator itself.
+func (c *csacReferenceClock) MeasureClockOffset(ctx context.Context, log *zap.Logger) (
+	time.Duration, error) {
+	t, err := c.clk.Telemetry(ctx)
+	if err == nil && !t.Locked() {
+		err = errCSACNotLocked
+	} else if err == nil && !t.PhaseOK {
+		err = errCSACNoPhase
+	}
+	c.valid.Store(err == nil)
+	if err != nil {
+		return 0, err
+	}
+	log.Debug("CSAC clock offset",
+		zap.String("dev", c.clk.String()),
+		zap.Duration("offset", t.Phase),
+		zap.Bool("disciplined", t.Disciplined),
+	)
+	c.store(c.clk.String(), t.Phase, nil)
+	return t.Phase, nil
+}
+
+func (c *csacReferenceClock) Source() (client.Source, bool) {
+	return client.Source{Stratum: 0, RefID: csacRefID}, c.valid.Load()
+}
+
+func (c *csacReferenceClock) String() string {
+	return c.clk.String()
 }
 
 func configureIPClientNTS(c *client.IPClient, ntskeServer string, ntskeInsecureSkipVerify bool) {
@@ -176,6 +966,18 @@ func configureIPClientNTS(c *client.IPClient, ntskeServer string, ntskeInsecureS
 	c.Auth.NTSKEFetcher.Log = log
 }
 
+func configureIPClient(cfg config.Service, c *client.IPClient, keys ntp.SymmetricKeys, faults *client.FaultInjector) {
+	if cfg.NTPKeyID != 0 {
+		k := keys[cfg.NTPKeyID]
+		c.Auth.SymmetricKey = &k
+	}
+	c.MinTTL = cfg.NTPMinTTL
+	c.NTPv5 = cfg.NTPv5
+	c.Device = cfg.NTPClientDevice
+	c.Auth.NTSKEFetcher.Device = cfg.NTPClientDevice
+	c.Faults = faults
+}
+
 func newNTPReferenceClockIP(localAddr, remoteAddr *net.UDPAddr,
 	authModes []string, ntskeServer string, ntskeInsecureSkipVerify bool) *ntpReferenceClockIP {
 	c := &ntpReferenceClockIP{
@@ -185,7 +987,7 @@ func newNTPReferenceClockIP(localAddr, remoteAddr *net.UDPAddr,
 	c.ntpc = &client.IPClient{
 		InterleavedMode: true,
 	}
-	if contains(authModes, authModeNTS) {
+	if contains(authModes, config.AuthModeNTS) {
 		configureIPClientNTS(c.ntpc, ntskeServer, ntskeInsecureSkipVerify)
 	}
 	return c
@@ -193,7 +995,42 @@ func newNTPReferenceClockIP(localAddr, remoteAddr *net.UDPAddr,
 
 func (c *ntpReferenceClockIP) MeasureClockOffset(ctx context.Context, log *zap.Logger) (
 	time.Duration, error) {
-	return client.MeasureClockOffsetIP(ctx, log, c.ntpc, c.localAddr, c.remoteAddr)
+	off, err := c.MeasureClockOffsetFine(ctx, log)
+	return off.Duration(), err
+}
+
+func (c *ntpReferenceClockIP) MeasureClockOffsetFine(ctx context.Context, log *zap.Logger) (
+	timemath.FineDuration, error) {
+	off, err := client.MeasureClockOffsetIPFine(ctx, log, c.ntpc, c.localAddr, c.remoteAddr)
+	c.valid.Store(err == nil)
+	return off, err
+}
+
+func (c *ntpReferenceClockIP) Source() (client.Source, bool) {
+	if !c.valid.Load() {
+		return client.Source{}, false
+	}
+	return c.ntpc.Source()
+}
+
+func (c *ntpReferenceClockIP) LastSample() (client.Sample, bool) {
+	return c.ntpc.LastSample()
+}
+
+func (c *ntpReferenceClockIP) PeerState() client.PeerState {
+	s := c.ntpc.PeerState()
+	if !c.valid.Load() {
+		s.Source = nil
+	}
+	return s
+}
+
+func (c *ntpReferenceClockIP) RestorePeerState(s client.PeerState) {
+	c.ntpc.RestorePeerState(s)
+}
+
+func (c *ntpReferenceClockIP) String() string {
+	return c.remoteAddr.String()
 }
 
 func configureSCIONClientNTS(c *client.SCIONClient, ntskeServer string, ntskeInsecureSkipVerify bool, daemonAddr string, localAddr, remoteAddr udp.UDPAddr) {
@@ -216,6 +1053,27 @@ func configureSCIONClientNTS(c *client.SCIONClient, ntskeServer string, ntskeIns
 	c.Auth.NTSKEFetcher.QUIC.RemoteAddr = remoteAddr
 }
 
+// configureSCIONStream lets c fall back to NTP over SCION streams if
+// configured.
+func configureSCIONStream(cfg config.Service, c *ntpReferenceClockSCION, ntskeServer string) {
+	s := cfg.SCIONStream
+	if s == nil || !s.Fallback {
+		return
+	}
+	host, _, err := net.SplitHostPort(ntskeServer)
+	if err != nil {
+		log.Fatal("failed to split stream server host and port", zap.Error(err))
+	}
+	c.streamc = &client.SCIONStreamClient{
+		TLSConfig: tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: cfg.NTSKEInsecureSkipVerify,
+			MinVersion:         tls.VersionTLS13,
+		},
+		Overhead: config.Duration(s.Overhead),
+	}
+}
+
 func newNTPReferenceClockSCION(daemonAddr string, localAddr, remoteAddr udp.UDPAddr,
 	authModes []string, ntskeServer string, ntskeInsecureSkipVerify bool) *ntpReferenceClockSCION {
 	c := &ntpReferenceClockSCION{
@@ -226,45 +1084,444 @@ func newNTPReferenceClockSCION(daemonAddr string, localAddr, remoteAddr udp.UDPA
 		c.ntpcs[i] = &client.SCIONClient{
 			InterleavedMode: true,
 		}
-		if contains(authModes, authModeNTS) {
+		if contains(authModes, config.AuthModeNTS) {
 			configureSCIONClientNTS(c.ntpcs[i], ntskeServer, ntskeInsecureSkipVerify, daemonAddr, localAddr, remoteAddr)
 		}
 	}
+	c.probec = &client.SCIONClient{}
+	if contains(authModes, config.AuthModeNTS) {
+		configureSCIONClientNTS(c.probec, ntskeServer, ntskeInsecureSkipVerify, daemonAddr, localAddr, remoteAddr)
+	}
 	return c
 }
 
-func (c *ntpReferenceClockSCION) MeasureClockOffset(ctx context.Context, log *zap.Logger) (
-	time.Duration, error) {
-	paths := c.pather.Paths(c.remoteAddr.IA)
-	return client.MeasureClockOffsetSCION(ctx, log, c.ntpcs[:], c.localAddr, c.remoteAddr, paths)
+func (c *ntpReferenceClockSCION) setTrain(t client.Train) {
+	for i := 0; i != len(c.ntpcs); i++ {
+		c.ntpcs[i].Train = t
+	}
 }
 
-func loadConfig(configFile string) svcConfig {
-	raw, err := os.ReadFile(configFile)
-	if err != nil {
-		log.Fatal("failed to load configuration", zap.Error(err))
-	}
-	var cfg svcConfig
-	err = toml.NewDecoder(bytes.NewReader(raw)).DisallowUnknownFields().Decode(&cfg)
-	if err != nil {
-		log.Fatal("failed to decode configuration", zap.Error(err))
-	}
-	return cfg
+func (c *ntpReferenceClockSCION) paths() []snet.Path {
+	return c.pather.Paths(c.remoteAddr.IA)
 }
 
-func localAddress(cfg svcConfig) *snet.UDPAddr {
-	if cfg.LocalAddr == "" {
-		log.Fatal("local_address not specified in config")
+func (c *ntpReferenceClockSCION) unavailable() string {
+	if c.pather == nil {
+		return "SCION not configured"
 	}
-	var localAddr snet.UDPAddr
-	err := localAddr.Set(cfg.LocalAddr)
-	if err != nil {
-		log.Fatal("failed to parse local address")
+	if len(c.paths()) == 0 {
+		return "no SCION paths available"
 	}
-	return &localAddr
+	return ""
 }
 
-func remoteAddress(cfg svcConfig) *snet.UDPAddr {
+func (c *ntpReferenceClockSCION) MeasureClockOffset(ctx context.Context, log *zap.Logger) (
+	time.Duration, error) {
+	off, err := c.MeasureClockOffsetFine(ctx, log)
+	return off.Duration(), err
+}
+
+func (c *ntpReferenceClockSCION) MeasureClockOffsetFine(ctx context.Context, log *zap.Logger) (
+	timemath.FineDuration, error) {
+	paths := c.paths()
+	if c.selector != nil {
+		paths = c.selector.Select(paths, len(c.ntpcs))
+	}
+	if c.streamc != nil && c.stream.Load() && c.streamN.Add(1)%scionStreamProbeInterval != 0 {
+		return c.measureStream(ctx, log, paths)
+	}
+	off, weight, err := client.MeasureWeightedClockOffsetSCION(ctx, log, c.ntpcs[:], c.localAddr, c.remoteAddr, paths)
+	c.valid.Store(err == nil)
+	if err == nil {
+		c.weight.Store(math.Float64bits(weight))
+	}
+	if c.streamc != nil {
+		if err == nil {
+			c.setStream(false, "datagram exchange succeeded")
+			return off, nil
+		}
+		log.Debug("failed to measure clock offset via SCION datagrams, falling back to streams",
+			zap.Stringer("to", c.remoteAddr), zap.Error(err))
+		c.setStream(true, "datagram exchange failed")
+		if ctx.Err() == nil {
+			return c.measureStream(ctx, log, paths)
+		}
+	}
+	return off, err
+}
+
+func (c *ntpReferenceClockSCION) measureStream(ctx context.Context, log *zap.Logger, paths []snet.Path) (
+	timemath.FineDuration, error) {
+	off, err := c.streamc.MeasureClockOffset(ctx, log, c.localAddr, c.remoteAddr, paths)
+	c.valid.Store(err == nil)
+	return off, err
+}
+
+func (c *ntpReferenceClockSCION) setStream(stream bool, reason string) {
+	if c.stream.Swap(stream) != stream {
+		name := client.TransportSCION
+		if stream {
+			name = client.TransportSCIONStream
+		}
+		events.Record(events.KindTransportSwitch, c.String(),
+			"switched to NTP over %s (%s)", name, reason)
+	}
+}
+
+func (c *ntpReferenceClockSCION) Source() (client.Source, bool) {
+	if !c.valid.Load() {
+		return client.Source{}, false
+	}
+	if c.stream.Load() {
+		return c.streamc.Source()
+	}
+	for _, ntpc := range c.ntpcs {
+		src, ok := ntpc.Source()
+		if ok {
+			return src, true
+		}
+	}
+	return client.Source{}, false
+}
+
+// LastSample returns the most recent sample of the paths or the stream. The
+// weight of a path sample is that of the median of the last measurement via
+// multiple paths, which the offset of the reference clock is taken from.
+func (c *ntpReferenceClockSCION) LastSample() (client.Sample, bool) {
+	var last client.Sample
+	var ok bool
+	for _, ntpc := range c.ntpcs {
+		x, xok := ntpc.LastSample()
+		if xok && (!ok || x.Time.After(last.Time)) {
+			last, ok = x, true
+		}
+	}
+	if ok && !last.Restored {
+		if w := math.Float64frombits(c.weight.Load()); w != 0 {
+			last.Weight = w
+		}
+	}
+	if c.streamc != nil {
+		x, xok := c.streamc.LastSample()
+		if xok && (!ok || x.Time.After(last.Time)) {
+			last, ok = x, true
+		}
+	}
+	return last, ok
+}
+
+// Syntonization returns the syntonization message received with the most
+// recent sample of a symmetric peer.
+func (c *ntpReferenceClockSCION) Syntonization() (ntp.Syntonization, bool) {
+	var last time.Time
+	var s ntp.Syntonization
+	var ok bool
+	for _, ntpc := range c.ntpcs {
+		x, xok := ntpc.LastSample()
+		if !xok || (ok && !x.Time.After(last)) {
+			continue
+		}
+		y, yok := ntpc.Syntonization()
+		if yok {
+			last, s, ok = x.Time, y, true
+		}
+	}
+	return s, ok
+}
+
+// PeerState returns the last sample and source of the peer, the interleaved
+// mode states of all clients, and the delay statistics of the paths.
+func (c *ntpReferenceClockSCION) PeerState() client.PeerState {
+	var s client.PeerState
+	if x, ok := c.LastSample(); ok {
+		s.Sample = &x
+	}
+	if x, ok := c.Source(); ok {
+		s.Source = &x
+	}
+	for _, ntpc := range c.ntpcs {
+		s.Interleaved = append(s.Interleaved, ntpc.PeerState().Interleaved...)
+	}
+	s.Paths = client.PathStates(c.remoteAddr.String())
+	return s
+}
+
+// RestorePeerState distributes the interleaved mode states of s over the
+// clients and seeds the path selector with the delay statistics of s.
+func (c *ntpReferenceClockSCION) RestorePeerState(s client.PeerState) {
+	ss := make([]client.PeerState, len(c.ntpcs))
+	ss[0].Sample, ss[0].Source = s.Sample, s.Source
+	for i, x := range s.Interleaved {
+		j := i % len(ss)
+		ss[j].Interleaved = append(ss[j].Interleaved, x)
+	}
+	for i, ntpc := range c.ntpcs {
+		ntpc.RestorePeerState(ss[i])
+	}
+	client.RestorePathStates(c.remoteAddr.String(), s.Paths)
+	if c.selector != nil {
+		c.selector.RestorePathStates(s.Paths)
+	}
+}
+
+func (c *ntpReferenceClockSCION) String() string {
+	return c.remoteAddr.String()
+}
+
+// Stop stops the path selector of c, if any.
+func (c *ntpReferenceClockSCION) Stop() {
+	if c.stop != nil {
+		c.stop()
+	}
+}
+
+func (c *ntpReferenceClockDual) Stop() {
+	c.scionclk.Stop()
+}
+
+func (c *ntpReferenceClockDual) setTransport(t int32, reason string) {
+	prev := c.transport.Swap(t)
+	if prev != 0 && prev != t {
+		name := client.TransportIP
+		if t == dualTransportSCION {
+			name = client.TransportSCION
+		}
+		events.Record(events.KindTransportSwitch, c.String(),
+			"switched to NTP over %s (%s)", name, reason)
+	}
+}
+
+func (c *ntpReferenceClockDual) MeasureClockOffset(ctx context.Context, log *zap.Logger) (
+	time.Duration, error) {
+	off, err := c.MeasureClockOffsetFine(ctx, log)
+	return off.Duration(), err
+}
+
+func (c *ntpReferenceClockDual) MeasureClockOffsetFine(ctx context.Context, log *zap.Logger) (
+	timemath.FineDuration, error) {
+	if c.transport.Load() == dualTransportIP && time.Since(c.fellBackAt) < dualTransportHoldDown {
+		return c.ipclk.MeasureClockOffsetFine(ctx, log)
+	}
+	reason := c.scionclk.unavailable()
+	if reason == "" {
+		off, err := c.scionclk.MeasureClockOffsetFine(ctx, log)
+		if err == nil {
+			c.setTransport(dualTransportSCION, "SCION paths available")
+			return off, nil
+		}
+		log.Debug("failed to measure clock offset via SCION, falling back to IP",
+			zap.Stringer("to", c.scionclk), zap.Error(err))
+		reason = "SCION measurement failed"
+	}
+	c.fellBackAt = time.Now()
+	off, err := c.ipclk.MeasureClockOffsetFine(ctx, log)
+	if err == nil {
+		c.setTransport(dualTransportIP, reason)
+	}
+	return off, err
+}
+
+func (c *ntpReferenceClockDual) Source() (client.Source, bool) {
+	switch c.transport.Load() {
+	case dualTransportSCION:
+		return c.scionclk.Source()
+	case dualTransportIP:
+		return c.ipclk.Source()
+	default:
+		return client.Source{}, false
+	}
+}
+
+func (c *ntpReferenceClockDual) LastSample() (client.Sample, bool) {
+	switch c.transport.Load() {
+	case dualTransportSCION:
+		return c.scionclk.LastSample()
+	case dualTransportIP:
+		return c.ipclk.LastSample()
+	default:
+		return client.Sample{}, false
+	}
+}
+
+// Syntonization returns the syntonization message received with the most
+// recent sample if it was measured via SCION.
+func (c *ntpReferenceClockDual) Syntonization() (ntp.Syntonization, bool) {
+	if c.transport.Load() != dualTransportSCION {
+		return ntp.Syntonization{}, false
+	}
+	return c.scionclk.Syntonization()
+}
+
+func (c *ntpReferenceClockDual) PeerState() client.PeerState {
+	if c.transport.Load() == dualTransportIP {
+		return c.ipclk.PeerState()
+	}
+	return c.scionclk.PeerState()
+}
+
+// RestorePeerState restores s to the clock of the transport over which its
+// last sample was measured.
+func (c *ntpReferenceClockDual) RestorePeerState(s client.PeerState) {
+	if s.Sample == nil {
+		return
+	}
+	switch s.Sample.Transport {
+	case client.TransportSCION:
+		c.scionclk.RestorePeerState(s)
+		c.transport.CompareAndSwap(0, dualTransportSCION)
+	case client.TransportIP:
+		c.ipclk.RestorePeerState(s)
+		c.transport.CompareAndSwap(0, dualTransportIP)
+	}
+}
+
+func (c *ntpReferenceClockDual) String() string {
+	return c.scionclk.String()
+}
+
+// lookupDualStack resolves the host of the IP reference clock address s and
+// returns one IPv4 and one IPv6 address if the host has both and the client
+// can use either. With NTS, the NTS-KE server determines the NTP server
+// address instead.
+func lookupDualStack(ctx context.Context, cfg config.Service, localIP net.IP, s string) (
+	v4, v6 *net.UDPAddr, ok bool) {
+	if !localIP.IsUnspecified() || contains(cfg.AuthModes, config.AuthModeNTS) {
+		return nil, nil, false
+	}
+	host, port, err := net.SplitHostPort(ntskeServerFromRemoteAddr(s))
+	if err != nil || net.ParseIP(host) != nil {
+		return nil, nil, false
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, nil, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, dualStackLookupTimeout)
+	defer cancel()
+	ips4, err := net.DefaultResolver.LookupNetIP(ctx, "ip4", host)
+	if err != nil || len(ips4) == 0 {
+		return nil, nil, false
+	}
+	ips6, err := net.DefaultResolver.LookupNetIP(ctx, "ip6", host)
+	if err != nil || len(ips6) == 0 {
+		return nil, nil, false
+	}
+	v4 = &net.UDPAddr{IP: net.IP(ips4[0].AsSlice()), Port: p}
+	v6 = &net.UDPAddr{IP: net.IP(ips6[0].AsSlice()), Port: p, Zone: ips6[0].Zone()}
+	return v4, v6, true
+}
+
+func (c *ntpReferenceClockDualStack) setFamily(f int32) {
+	prev := c.family.Swap(f)
+	if prev != 0 && prev != f {
+		events.Record(events.KindTransportSwitch, c.name,
+			"switched to %s (lower delay)", c.clks[f-1])
+	}
+}
+
+func (c *ntpReferenceClockDualStack) race(ctx context.Context, log *zap.Logger) (
+	time.Duration, error) {
+	c.racedAt = time.Now()
+	var offs [len(c.clks)]time.Duration
+	var errs [len(c.clks)]error
+	done := make(chan struct{}, len(c.clks))
+	for i := range c.clks {
+		go func(i int) {
+			offs[i], errs[i] = c.clks[i].MeasureClockOffset(ctx, log)
+			done <- struct{}{}
+		}(i)
+	}
+	for range c.clks {
+		<-done
+	}
+	best := -1
+	var bestDelay time.Duration
+	for i, clk := range c.clks {
+		if errs[i] != nil {
+			log.Debug("failed to measure clock offset",
+				zap.Stringer("to", clk), zap.Error(errs[i]))
+			continue
+		}
+		s, ok := clk.LastSample()
+		if ok && (best == -1 || s.Delay < bestDelay) {
+			best, bestDelay = i, s.Delay
+		}
+	}
+	if best == -1 {
+		c.racedAt = time.Time{}
+		for _, err := range errs {
+			if err != nil {
+				return 0, err
+			}
+		}
+		return 0, errNoDualStackSample
+	}
+	c.setFamily(int32(best + 1))
+	return offs[best], nil
+}
+
+func (c *ntpReferenceClockDualStack) MeasureClockOffset(ctx context.Context, log *zap.Logger) (
+	time.Duration, error) {
+	f := c.family.Load()
+	if f == 0 || time.Since(c.racedAt) >= dualStackRaceInterval {
+		return c.race(ctx, log)
+	}
+	off, err := c.clks[f-1].MeasureClockOffset(ctx, log)
+	if err != nil {
+		// Race both address families again in the next round
+		c.racedAt = time.Time{}
+	}
+	return off, err
+}
+
+func (c *ntpReferenceClockDualStack) Source() (client.Source, bool) {
+	f := c.family.Load()
+	if f == 0 {
+		return client.Source{}, false
+	}
+	return c.clks[f-1].Source()
+}
+
+func (c *ntpReferenceClockDualStack) LastSample() (client.Sample, bool) {
+	f := c.family.Load()
+	if f == 0 {
+		return client.Sample{}, false
+	}
+	return c.clks[f-1].LastSample()
+}
+
+func (c *ntpReferenceClockDualStack) String() string {
+	return c.name
+}
+
+func loadConfig(configFile string) config.Service {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		var errs config.Errors
+		if errors.As(err, &errs) {
+			for _, e := range errs {
+				log.Error("invalid configuration", zap.String("file", configFile), zap.Error(e))
+			}
+			log.Fatal("failed to load configuration", zap.Int("errors", len(errs)))
+		}
+		log.Fatal("failed to load configuration", zap.Error(err))
+	}
+	return cfg
+}
+
+func localAddress(cfg config.Service) *snet.UDPAddr {
+	if cfg.LocalAddr == "" {
+		log.Fatal("local_address not specified in config")
+	}
+	var localAddr snet.UDPAddr
+	err := localAddr.Set(cfg.LocalAddr)
+	if err != nil {
+		log.Fatal("failed to parse local address")
+	}
+	return &localAddr
+}
+
+func remoteAddress(cfg config.Service) *snet.UDPAddr {
 	if cfg.RemoteAddr == "" {
 		log.Fatal("remote_address not specified in config")
 	}
@@ -276,11 +1533,318 @@ func remoteAddress(cfg svcConfig) *snet.UDPAddr {
 	return &remoteAddr
 }
 
-func daemonAddress(cfg svcConfig) string {
+func daemonAddress(cfg config.Service) string {
 	return cfg.DaemonAddr
 }
 
-func tlsConfig(cfg svcConfig) *tls.Config {
+func metricsAddress(cfg config.Service) string {
+	if cfg.MetricsAddress == "" {
+		return config.DefaultMetricsAddress
+	}
+	return cfg.MetricsAddress
+}
+
+func pathProbeInterval(cfg config.Service) time.Duration {
+	return config.Duration(cfg.PathProbeInterval)
+}
+
+func configureSocketOptions(cfg config.Service) {
+	if cfg.DSCP != "" {
+		dscp, _ := config.ParseDSCP(cfg.DSCP)
+		config.SetDSCP(dscp)
+	}
+	config.SetSocketPriority(cfg.SocketPriority)
+}
+
+func durations(ss []string) []time.Duration {
+	if ss == nil {
+		return nil
+	}
+	ds := make([]time.Duration, len(ss))
+	for i, s := range ss {
+		ds[i] = config.Duration(s)
+	}
+	return ds
+}
+
+func configureHistograms(cfg config.Service) {
+	client.SetHistogramBuckets(durations(cfg.OffsetHistogramBuckets), durations(cfg.DelayHistogramBuckets))
+}
+
+func configureFilterWeighting(cfg config.Service) {
+	switch cfg.FilterWeighting {
+	case config.FilterWeightingDelaySquared:
+		client.SetWeighting(client.SquaredDelayWeighting)
+	case config.FilterWeightingDispersion:
+		client.SetWeighting(client.DispersionWeighting)
+	case config.FilterWeightingUniform:
+		client.SetWeighting(client.UniformWeighting)
+	}
+}
+
+func configurePathDiversity(cfg config.Service) {
+	if d := cfg.PathDiversity; d != nil {
+		client.SetPathDiversity(client.PathDiversity{
+			RotatePaths:    d.RotatePaths,
+			RotateFlowIDs:  d.RotateFlowIDs,
+			PinInterleaved: d.PinInterleaved,
+		})
+	}
+}
+
+func configurePacketAuth(cfg config.Service) {
+	if cfg.SPAOAlgorithm != "" {
+		algo, _ := spao.ParseAlgorithm(cfg.SPAOAlgorithm)
+		spao.SetAlgorithm(algo)
+	}
+}
+
+func configureDispatcher(cfg config.Service) {
+	if !cfg.Dispatcherless {
+		return
+	}
+	r := scion.PortRange{Min: scion.EndhostPortRangeMin, Max: scion.EndhostPortRangeMax}
+	if cfg.EndhostPortRange != "" {
+		r, _ = scion.ParsePortRange(cfg.EndhostPortRange)
+	}
+	scion.SetEndhostPortRange(r)
+}
+
+func symmetricKeys(cfg config.Service) ntp.SymmetricKeys {
+	if cfg.NTPKeysFile == "" {
+		return nil
+	}
+	keys, err := ntp.LoadSymmetricKeys(cfg.NTPKeysFile)
+	if err != nil {
+		log.Fatal("failed to load NTP keys file", zap.String("file", cfg.NTPKeysFile), zap.Error(err))
+	}
+	if cfg.NTPKeyID != 0 {
+		if _, ok := keys[cfg.NTPKeyID]; !ok {
+			log.Fatal("NTP key not found", zap.Uint32("id", cfg.NTPKeyID))
+		}
+	}
+	return keys
+}
+
+func broadcastKey(keys ntp.SymmetricKeys, id uint32) ntp.SymmetricKey {
+	k, ok := keys[id]
+	if !ok {
+		log.Fatal("NTP broadcast key not found", zap.Uint32("id", id))
+	}
+	return k
+}
+
+func configureNTPControl(cfg config.Service) {
+	if !cfg.NTPControl {
+		return
+	}
+	server.EnableControlResponder(parsePrefixes(cfg.NTPControlAllow))
+}
+
+// parsePrefixes parses validated IP prefixes or addresses.
+func parsePrefixes(ss []string) []netip.Prefix {
+	var ps []netip.Prefix
+	for _, s := range ss {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			a, _ := netip.ParseAddr(s)
+			p = netip.PrefixFrom(a, a.BitLen())
+		}
+		ps = append(ps, p.Masked())
+	}
+	return ps
+}
+
+func configureReducedPrecision(cfg config.Service) {
+	if d := config.Duration(cfg.ServerReducedPrecision); d != 0 {
+		var allow []server.FullPrecisionPrefix
+		for _, s := range cfg.ServerFullPrecisionAllow {
+			ia, p, _ := config.ParsePrefix(s)
+			allow = append(allow, server.FullPrecisionPrefix{IA: ia, Prefix: p})
+		}
+		server.SetReducedPrecision(d, allow)
+	}
+}
+
+func configureServerWorkers(cfg config.Service) {
+	if cfg.ServerWorkers != 0 {
+		server.SetWorkers(cfg.ServerWorkers, cfg.ServerCPUAffinity)
+	}
+	busyPoll := config.Duration(cfg.ServerBusyPoll)
+	if cfg.ServerBatchSize != 0 || busyPoll != 0 {
+		batchSize := cfg.ServerBatchSize
+		if batchSize == 0 {
+			batchSize = 1
+		}
+		server.SetBatching(batchSize, busyPoll)
+	}
+	server.SetGRO(cfg.ServerGRO)
+	server.SetRequestQueue(cfg.ServerQueueLength, cfg.ServerQueueWorkers)
+	if cfg.ServerTiers != nil {
+		server.SetServiceTiers(
+			serviceTier(cfg.ServerTiers.Authenticated),
+			serviceTier(cfg.ServerTiers.Unauthenticated))
+	}
+}
+
+func serviceTier(t *config.ServerTier) server.ServiceTier {
+	s := server.FullService
+	if t == nil {
+		return s
+	}
+	s.Refuse = t.Refuse
+	s.Rate = t.Rate
+	if t.Rate != 0 {
+		s.Burst = float64(t.Burst)
+		if s.Burst < 1 {
+			s.Burst = 1
+		}
+	}
+	s.Interleaved = !t.NoInterleaved
+	s.HWTimestamps = !t.SoftwareTimestamps
+	return s
+}
+
+func configureMetrics(ctx context.Context, cfg config.Service) func() {
+	if cfg.MetricsExporter == "" {
+		return func() {}
+	}
+	shutdown, err := metrics.Start(ctx, log, cfg.MetricsExporter, cfg.MetricsEndpoint,
+		config.Duration(cfg.MetricsExportInterval))
+	if err != nil {
+		log.Fatal("failed to start metrics export", zap.String("exporter", cfg.MetricsExporter), zap.Error(err))
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err := shutdown(ctx)
+		if err != nil {
+			log.Info("failed to stop metrics export", zap.Error(err))
+		}
+	}
+}
+
+func configureTracing(ctx context.Context, cfg config.Service) func() {
+	if cfg.TracingExporter == "" {
+		return func() {}
+	}
+	shutdown, err := tracing.Start(ctx, cfg.TracingExporter, cfg.TracingEndpoint, cfg.TracingSampleRatio)
+	if err != nil {
+		log.Fatal("failed to start tracing", zap.String("exporter", cfg.TracingExporter), zap.Error(err))
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err := shutdown(ctx)
+		if err != nil {
+			log.Info("failed to stop tracing", zap.Error(err))
+		}
+	}
+}
+
+func configureEvents(cfg config.Service) {
+	if cfg.EventLogSize != 0 {
+		events.SetCapacity(cfg.EventLogSize)
+	}
+	if cfg.EventLogSyslog {
+		err := events.EnableSyslog("timeservice")
+		if err != nil {
+			log.Fatal("failed to connect to syslog", zap.Error(err))
+		}
+	}
+	if cfg.AuditLogFile != "" {
+		err := audit.SetFile(cfg.AuditLogFile)
+		if err != nil {
+			log.Fatal("failed to open audit log", zap.String("file", cfg.AuditLogFile), zap.Error(err))
+		}
+	}
+}
+
+func configureCapture(cfg config.Service) func() {
+	if cfg.PcapFile == "" {
+		return func() {}
+	}
+	err := pcap.Open(cfg.PcapFile)
+	if err != nil {
+		log.Fatal("failed to open packet capture", zap.String("file", cfg.PcapFile), zap.Error(err))
+	}
+	log.Warn("capturing time service packets", zap.String("file", cfg.PcapFile))
+	return pcap.Close
+}
+
+func configureClockSync(cfg config.Service) {
+	var p sync.StepPolicy
+	switch cfg.ClockStepMode {
+	case config.ClockStepModeInitial:
+		p.Mode = sync.StepModeInitial
+	case config.ClockStepModeThreshold:
+		p.Mode = sync.StepModeThreshold
+		p.Threshold = config.Duration(cfg.ClockStepThreshold)
+		p.Limit = cfg.ClockStepLimit
+	case config.ClockStepModeNever:
+		p.Mode = sync.StepModeNever
+	}
+	p.PanicThreshold = config.Duration(cfg.ClockPanicThreshold)
+	p.PanicIgnore = cfg.ClockPanicIgnore
+	sync.SetStepPolicy(p)
+	if cc := cfg.ClockStepCrossCheck; cc != nil {
+		sync.SetStepCrossCheck(sync.CrossCheck{
+			Threshold: config.Duration(cc.Threshold),
+			Bound:     config.Duration(cc.Bound),
+			MaxAge:    config.Duration(cc.MaxAge),
+		})
+	}
+	if cfg.DriftFile != "" {
+		sync.SetDriftFile(cfg.DriftFile)
+	}
+	if cfg.PeerStateFile != "" {
+		sync.SetPeerStateFile(cfg.PeerStateFile)
+	}
+	timebase.SetInterpolation(cfg.ClockInterpolation)
+	sync.SetOutlierThreshold(cfg.OutlierThreshold)
+	sync.SetWeightedCombination(cfg.WeightedCombination)
+	sync.SetFrequencyTransfer(cfg.FrequencyTransfer)
+	if cfg.OrphanStratum != 0 {
+		sync.SetOrphanMode(uint8(cfg.OrphanStratum), config.Duration(cfg.OrphanThreshold))
+	}
+	if cfg.TemperatureSensor != "" {
+		sync.SetTemperatureSensor(sync.FileTemperatureSensor(cfg.TemperatureSensor, cfg.TemperatureScale))
+	}
+	if cfg.LocalMinPoll != "" {
+		b := sync.PollBounds{Min: config.Duration(cfg.LocalMinPoll), Max: config.Duration(cfg.LocalMaxPoll)}
+		err := sync.SetLocalPollBounds(b)
+		if err != nil {
+			log.Fatal("unexpected configuration", zap.Duration("local_min_poll", b.Min),
+				zap.Duration("local_max_poll", b.Max), zap.Error(err))
+		}
+	}
+	if cfg.GlobalMinPoll != "" {
+		b := sync.PollBounds{Min: config.Duration(cfg.GlobalMinPoll), Max: config.Duration(cfg.GlobalMaxPoll)}
+		err := sync.SetGlobalPollBounds(b)
+		if err != nil {
+			log.Fatal("unexpected configuration", zap.Duration("global_min_poll", b.Min),
+				zap.Duration("global_max_poll", b.Max), zap.Error(err))
+		}
+	}
+}
+
+func faultInjector(cfg config.Service) *client.FaultInjector {
+	if cfg.FaultInjection == nil {
+		return nil
+	}
+	fc := cfg.FaultInjection
+	p := client.FaultPolicy{
+		Drop:      fc.Drop,
+		Duplicate: fc.Duplicate,
+		Corrupt:   fc.Corrupt,
+		Delay:     fc.Delay,
+	}
+	p.MaxDelay = config.Duration(fc.MaxDelay)
+	log.Warn("fault injection enabled", zap.Any("policy", p), zap.Int64("seed", fc.Seed))
+	return client.NewFaultInjector(p, fc.Seed)
+}
+
+func tlsConfig(cfg config.Service) *tls.Config {
 	if cfg.NTSKEServerName == "" || cfg.NTSKECertFile == "" || cfg.NTSKEKeyFile == "" {
 		log.Fatal("missing parameters in configuration for NTSKE server")
 	}
@@ -296,8 +1860,8 @@ func tlsConfig(cfg svcConfig) *tls.Config {
 	}
 }
 
-func createClocks(cfg svcConfig, localAddr *snet.UDPAddr) (
-	refClocks, netClocks []client.ReferenceClock) {
+func createClocks(ctx context.Context, cfg config.Service, localAddr *snet.UDPAddr) (
+	refClocks, netClocks []client.ReferenceClock, newPeer func(string) (client.ReferenceClock, error)) {
 
 	for _, s := range cfg.MBGReferenceClocks {
 		refClocks = append(refClocks, &mbgReferenceClock{
@@ -305,6 +1869,53 @@ func createClocks(cfg svcConfig, localAddr *snet.UDPAddr) (
 		})
 	}
 
+	for _, s := range cfg.PHCReferenceClocks {
+		c, err := phc.Open(log, s)
+		if err != nil {
+			log.Fatal("failed to open PHC", zap.String("dev", s), zap.Error(err))
+		}
+		refClocks = append(refClocks, &phcReferenceClock{
+			clk: c,
+		})
+	}
+
+	for _, s := range cfg.CSACReferenceClocks {
+		c, err := csac.Open(log, s)
+		if err != nil {
+			log.Fatal("failed to open CSAC", zap.String("dev", s), zap.Error(err))
+		}
+		refClocks = append(refClocks, &csacReferenceClock{
+			clk: c,
+		})
+	}
+
+	keys := symmetricKeys(cfg)
+	faults := faultInjector(cfg)
+	if d := config.Duration(cfg.NTPInterleavedMaxAge); d != 0 {
+		client.SetInterleavedMaxAge(d)
+	}
+	client.SetServerTimestamps(cfg.ServerTimestamps)
+	if cfg.NTPRetryBudget != 0 || cfg.NTPAttemptTimeout != "" {
+		b := client.RetryBudget{
+			MaxRetries:     client.DefaultMaxRetries,
+			AttemptTimeout: config.Duration(cfg.NTPAttemptTimeout),
+		}
+		switch cfg.NTPRetryBudget {
+		case 0:
+		case config.NoRetries:
+			b.MaxRetries = 0
+		default:
+			b.MaxRetries = cfg.NTPRetryBudget
+		}
+		client.SetRetryBudget(b)
+	}
+	if cfg.OffsetGateFraction != 0 || cfg.OffsetGateBudget != "" {
+		client.SetOffsetGate(client.OffsetGate{
+			Fraction: cfg.OffsetGateFraction,
+			Budget:   config.Duration(cfg.OffsetGateBudget),
+		})
+	}
+
 	var dstIAs []addr.IA
 	for _, s := range cfg.NTPReferenceClocks {
 		remoteAddr, err := snet.ParseUDPAddr(s)
@@ -313,236 +1924,655 @@ func createClocks(cfg svcConfig, localAddr *snet.UDPAddr) (
 				zap.String("address", s), zap.Error(err))
 		}
 		ntskeServer := ntskeServerFromRemoteAddr(s)
+		train := packetTrain(cfg, s)
 		if !remoteAddr.IA.IsZero() {
-			refClocks = append(refClocks, newNTPReferenceClockSCION(
+			c := newNTPReferenceClockSCION(
 				cfg.DaemonAddr,
 				udp.UDPAddrFromSnet(localAddr),
 				udp.UDPAddrFromSnet(remoteAddr),
 				cfg.AuthModes,
 				ntskeServer,
 				cfg.NTSKEInsecureSkipVerify,
-			))
+			)
+			c.setTrain(train)
+			configureSCIONStream(cfg, c, ntskeServer)
+			refClocks = append(refClocks, c)
 			dstIAs = append(dstIAs, remoteAddr.IA)
+		} else if v4, v6, ok := lookupDualStack(ctx, cfg, localAddr.Host.IP, s); ok {
+			c := &ntpReferenceClockDualStack{name: ntskeServer}
+			for i, a := range []struct{ local, remote *net.UDPAddr }{
+				{&net.UDPAddr{IP: net.IPv4zero}, v4},
+				{&net.UDPAddr{IP: net.IPv6unspecified}, v6},
+			} {
+				clk := newNTPReferenceClockIP(
+					a.local,
+					a.remote,
+					cfg.AuthModes,
+					ntskeServer,
+					cfg.NTSKEInsecureSkipVerify,
+				)
+				configureIPClient(cfg, clk.ntpc, keys, faults)
+				clk.ntpc.Train = train
+				c.clks[i] = clk
+			}
+			refClocks = append(refClocks, c)
 		} else {
-			refClocks = append(refClocks, newNTPReferenceClockIP(
+			c := newNTPReferenceClockIP(
 				localAddr.Host,
 				remoteAddr.Host,
 				cfg.AuthModes,
 				ntskeServer,
 				cfg.NTSKEInsecureSkipVerify,
-			))
+			)
+			configureIPClient(cfg, c.ntpc, keys, faults)
+			c.ntpc.Train = train
+			refClocks = append(refClocks, c)
+		}
+	}
+
+	for _, bc := range cfg.NTPBroadcastReferences {
+		groupAddr, err := net.ResolveUDPAddr("udp", bc.Address)
+		if err != nil {
+			log.Fatal("failed to parse broadcast address",
+				zap.String("address", bc.Address), zap.Error(err))
+		}
+		serverAddr, err := snet.ParseUDPAddr(bc.Server)
+		if err != nil || !serverAddr.IA.IsZero() {
+			log.Fatal("failed to parse broadcast server address",
+				zap.String("address", bc.Server), zap.Error(err))
+		}
+		c := newNTPReferenceClockIP(
+			localAddr.Host,
+			serverAddr.Host,
+			cfg.AuthModes,
+			ntskeServerFromRemoteAddr(bc.Server),
+			cfg.NTSKEInsecureSkipVerify,
+		)
+		configureIPClient(cfg, c.ntpc, keys, faults)
+		bclk, err := client.StartBroadcastClient(ctx, log,
+			localAddr.Host, groupAddr, serverAddr.Host, c.ntpc, broadcastKey(keys, bc.KeyID))
+		if err != nil {
+			log.Fatal("failed to listen for broadcast packets",
+				zap.String("address", bc.Address), zap.Error(err))
+		}
+		refClocks = append(refClocks, bclk)
+	}
+
+	for i, r := range cfg.NTPDualReferenceClocks {
+		scionAddr, err := snet.ParseUDPAddr(r.SCION)
+		if err != nil || scionAddr.IA.IsZero() {
+			log.Fatal("failed to parse dual reference clock SCION address",
+				zap.Int("index", i), zap.String("address", r.SCION), zap.Error(err))
+		}
+		ipAddr, err := snet.ParseUDPAddr(r.IP)
+		if err != nil || !ipAddr.IA.IsZero() {
+			log.Fatal("failed to parse dual reference clock IP address",
+				zap.Int("index", i), zap.String("address", r.IP), zap.Error(err))
+		}
+		scionclk := newNTPReferenceClockSCION(
+			cfg.DaemonAddr,
+			udp.UDPAddrFromSnet(localAddr),
+			udp.UDPAddrFromSnet(scionAddr),
+			cfg.AuthModes,
+			ntskeServerFromRemoteAddr(r.SCION),
+			cfg.NTSKEInsecureSkipVerify,
+		)
+		ipclk := newNTPReferenceClockIP(
+			localAddr.Host,
+			ipAddr.Host,
+			cfg.AuthModes,
+			ntskeServerFromRemoteAddr(r.IP),
+			cfg.NTSKEInsecureSkipVerify,
+		)
+		configureIPClient(cfg, ipclk.ntpc, keys, faults)
+		configureSCIONStream(cfg, scionclk, ntskeServerFromRemoteAddr(r.SCION))
+		refClocks = append(refClocks, &ntpReferenceClockDual{scionclk: scionclk, ipclk: ipclk})
+		dstIAs = append(dstIAs, scionAddr.IA)
+	}
+
+	for _, s := range cfg.SCIONPeers {
+		c, err := newSCIONPeer(cfg, localAddr, s)
+		if err != nil {
+			log.Fatal("failed to parse peer address", zap.String("address", s), zap.Error(err))
+		}
+		netClocks = append(netClocks, c)
+		dstIAs = append(dstIAs, c.remoteAddr.IA)
+	}
+
+	for _, s := range cfg.SCIONSymmetricPeers {
+		c, err := newSCIONPeer(cfg, localAddr, s)
+		if err != nil {
+			log.Fatal("failed to parse peer address", zap.String("address", s), zap.Error(err))
+		}
+		for i := 0; i != len(c.ntpcs); i++ {
+			c.ntpcs[i].Symmetric = true
+		}
+		// The stream server only answers client mode requests
+		c.streamc = nil
+		netClocks = append(netClocks, c)
+		dstIAs = append(dstIAs, c.remoteAddr.IA)
+	}
+
+	daemonAddr := daemonAddress(cfg)
+	if daemonAddr != "" {
+		pather := scion.StartPather(ctx, log, daemonAddr, dstIAs)
+		var drkeyFetcher *scion.Fetcher
+		if contains(cfg.AuthModes, config.AuthModeSPAO) {
+			drkeyFetcher = scion.NewFetcher(scion.NewDaemonConnector(ctx, daemonAddr))
+		}
+		probeInterval := pathProbeInterval(cfg)
+		configure := func(scionclk *ntpReferenceClockSCION) {
+			for i := 0; i != len(scionclk.ntpcs); i++ {
+				scionclk.ntpcs[i].Faults = faults
+			}
+			scionclk.pather = pather
+			if drkeyFetcher != nil {
+				for i := 0; i != len(scionclk.ntpcs); i++ {
+					scionclk.ntpcs[i].Auth.Enabled = true
+					scionclk.ntpcs[i].Auth.DRKeyFetcher = drkeyFetcher
+				}
+				scionclk.probec.Auth.Enabled = true
+				scionclk.probec.Auth.DRKeyFetcher = drkeyFetcher
+			}
+			if probeInterval != 0 {
+				var sctx context.Context
+				sctx, scionclk.stop = context.WithCancel(ctx)
+				scionclk.selector = client.StartPathSelector(sctx, log, scionclk.probec,
+					scionclk.localAddr, scionclk.remoteAddr, scionclk.paths, probeInterval,
+					cfg.DelayAttackDetection)
+			}
+		}
+		for _, c := range append(append([]client.ReferenceClock{}, refClocks...), netClocks...) {
+			switch c := c.(type) {
+			case *ntpReferenceClockSCION:
+				configure(c)
+			case *ntpReferenceClockDual:
+				if scionclk, ok := c.scionclk.(*ntpReferenceClockSCION); ok {
+					configure(scionclk)
+				}
+			}
+		}
+		newPeer = func(s string) (client.ReferenceClock, error) {
+			c, err := newSCIONPeer(cfg, localAddr, s)
+			if err != nil {
+				return nil, err
+			}
+			pather.AddDestination(c.remoteAddr.IA)
+			configure(c)
+			return c, nil
+		}
+	} else {
+		newPeer = func(string) (client.ReferenceClock, error) {
+			return nil, errNoDaemon
+		}
+	}
+
+	return
+}
+
+func newSCIONPeer(cfg config.Service, localAddr *snet.UDPAddr, s string) (*ntpReferenceClockSCION, error) {
+	remoteAddr, err := snet.ParseUDPAddr(s)
+	if err != nil {
+		return nil, err
+	}
+	if remoteAddr.IA.IsZero() {
+		return nil, errInvalidPeerAddr
+	}
+	ntskeServer := ntskeServerFromRemoteAddr(s)
+	c := newNTPReferenceClockSCION(
+		cfg.DaemonAddr,
+		udp.UDPAddrFromSnet(localAddr),
+		udp.UDPAddrFromSnet(remoteAddr),
+		cfg.AuthModes,
+		ntskeServer,
+		cfg.NTSKEInsecureSkipVerify,
+	)
+	c.setTrain(packetTrain(cfg, s))
+	configureSCIONStream(cfg, c, ntskeServer)
+	return c, nil
+}
+
+// packetTrain returns the packet train configured for the reference clock or
+// peer s, if any.
+func packetTrain(cfg config.Service, s string) client.Train {
+	for _, t := range cfg.PacketTrains {
+		if t.Peer == s {
+			return client.Train{Len: t.Length, Spacing: config.Duration(t.Spacing)}
 		}
 	}
+	return client.Train{}
+}
 
-	for _, s := range cfg.SCIONPeers {
-		remoteAddr, err := snet.ParseUDPAddr(s)
+func copyIP(ip net.IP) net.IP {
+	return append(ip[:0:0], ip...)
+}
+
+func listeners(cfg config.Service, localAddr *snet.UDPAddr) []listener {
+	if len(cfg.Listeners) == 0 {
+		return []listener{{
+			localAddr: localAddr,
+			ip:        true,
+			scion:     true,
+		}}
+	}
+	var ls []listener
+	for _, lc := range cfg.Listeners {
+		var l listener
+		l.localAddr = new(snet.UDPAddr)
+		err := l.localAddr.Set(lc.LocalAddr)
 		if err != nil {
-			log.Fatal("failed to parse peer address", zap.String("address", s), zap.Error(err))
+			log.Fatal("failed to parse listener address",
+				zap.String("address", lc.LocalAddr), zap.Error(err))
 		}
-		if remoteAddr.IA.IsZero() {
-			log.Fatal("unexpected peer address", zap.String("address", s), zap.Error(err))
+		for _, p := range lc.Protocols {
+			switch p {
+			case config.ListenerProtocolIP:
+				l.ip = true
+			case config.ListenerProtocolSCION:
+				l.scion = true
+			}
 		}
-		ntskeServer := ntskeServerFromRemoteAddr(s)
-		netClocks = append(netClocks, newNTPReferenceClockSCION(
-			cfg.DaemonAddr,
-			udp.UDPAddrFromSnet(localAddr),
-			udp.UDPAddrFromSnet(remoteAddr),
-			cfg.AuthModes,
-			ntskeServer,
-			cfg.NTSKEInsecureSkipVerify,
-		))
-		dstIAs = append(dstIAs, remoteAddr.IA)
+		ls = append(ls, l)
 	}
+	return ls
+}
 
-	daemonAddr := daemonAddress(cfg)
-	if daemonAddr != "" {
-		ctx := context.Background()
-		pather := scion.StartPather(ctx, log, daemonAddr, dstIAs)
-		var drkeyFetcher *scion.Fetcher
-		if contains(cfg.AuthModes, authModeSPAO) {
-			drkeyFetcher = scion.NewFetcher(scion.NewDaemonConnector(ctx, daemonAddr))
+func startServers(ctx context.Context, cfg config.Service, localAddr *snet.UDPAddr, daemonAddr string,
+	tlsConfig *tls.Config, provider *ntske.Provider) {
+	keys := symmetricKeys(cfg)
+	if cfg.NTPv5 {
+		server.EnableNTPv5()
+	}
+	if cfg.NTPTAIOffsetExtension {
+		server.EnableTAIOffsetExtension()
+	}
+	if cfg.ServerTXTimestampCorrection {
+		server.EnableTXTimestampCorrection()
+	}
+	if s := cfg.SCIONStream; s != nil {
+		server.SetStreamOverhead(config.Duration(s.Overhead))
+	}
+	if len(cfg.SCIONSymmetricPeers) != 0 {
+		var peers []udp.UDPAddr
+		for _, s := range cfg.SCIONSymmetricPeers {
+			remoteAddr, err := snet.ParseUDPAddr(s)
+			if err != nil || remoteAddr.IA.IsZero() {
+				log.Fatal("failed to parse peer address", zap.String("address", s), zap.Error(err))
+			}
+			peers = append(peers, udp.UDPAddrFromSnet(remoteAddr))
 		}
-		for _, c := range refClocks {
-			scionclk, ok := c.(*ntpReferenceClockSCION)
-			if ok {
-				scionclk.pather = pather
-				if drkeyFetcher != nil {
-					for i := 0; i != len(scionclk.ntpcs); i++ {
-						scionclk.ntpcs[i].Auth.Enabled = true
-						scionclk.ntpcs[i].Auth.DRKeyFetcher = drkeyFetcher
-					}
-				}
+		server.SetSymmetricPeers(peers)
+	}
+	for _, bc := range cfg.NTPBroadcast {
+		dstAddr, err := net.ResolveUDPAddr("udp", bc.Address)
+		if err != nil {
+			log.Fatal("failed to parse broadcast address",
+				zap.String("address", bc.Address), zap.Error(err))
+		}
+		server.StartBroadcastServer(ctx, log, snet.CopyUDPAddr(localAddr.Host), dstAddr,
+			config.Duration(bc.Interval), broadcastKey(keys, bc.KeyID))
+	}
+	for _, l := range listeners(cfg, localAddr) {
+		laddr := *l.localAddr
+		laddr.Host = snet.CopyUDPAddr(l.localAddr.Host)
+		if l.ip {
+			laddr.Host.Port = ntp.ServerPortIP
+			server.StartNTSKEServerIP(ctx, log, copyIP(laddr.Host.IP), laddr.Host.Port, tlsConfig, provider)
+			server.StartIPServer(ctx, log, snet.CopyUDPAddr(laddr.Host), provider, keys)
+			if cfg.XDPInterface != "" {
+				startXDPServer(ctx, cfg, laddr.Host)
 			}
 		}
-		for _, c := range netClocks {
-			scionclk, ok := c.(*ntpReferenceClockSCION)
-			if ok {
-				scionclk.pather = pather
-				if drkeyFetcher != nil {
-					for i := 0; i != len(scionclk.ntpcs); i++ {
-						scionclk.ntpcs[i].Auth.Enabled = true
-						scionclk.ntpcs[i].Auth.DRKeyFetcher = drkeyFetcher
-					}
-				}
+		if l.scion {
+			laddr.Host.Port = ntp.ServerPortSCION
+			server.StartNTSKEServerSCION(ctx, log, udp.UDPAddrFromSnet(&laddr), tlsConfig, provider)
+			server.StartSCIONServer(ctx, log, daemonAddr, snet.CopyUDPAddr(laddr.Host), provider)
+			if s := cfg.SCIONStream; s != nil && s.Serve {
+				server.StartSCIONStreamServer(ctx, log, udp.UDPAddrFromSnet(&laddr), tlsConfig)
 			}
 		}
 	}
-
-	return
 }
 
-func copyIP(ip net.IP) net.IP {
-	return append(ip[:0:0], ip...)
+func startXDPServer(ctx context.Context, cfg config.Service, localHost *net.UDPAddr) {
+	numQueues := cfg.XDPQueues
+	if numQueues == 0 {
+		numQueues = 1
+	} else if numQueues < 0 {
+		log.Fatal("unexpected configuration", zap.Int("xdp_queues", cfg.XDPQueues))
+	}
+	addr, ok := netip.AddrFromSlice(localHost.IP)
+	if !ok || !addr.Unmap().Is4() {
+		log.Fatal("unexpected configuration: xdp_interface requires an IPv4 local address",
+			zap.Stringer("local_address", localHost))
+	}
+	server.StartXDPServer(ctx, log, cfg.XDPInterface, numQueues,
+		netip.AddrPortFrom(addr.Unmap(), uint16(localHost.Port)))
 }
 
 func runServer(configFile string) {
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	cfg := loadConfig(configFile)
+	stopTracing := configureTracing(ctx, cfg)
+	defer stopTracing()
+	stopMetrics := configureMetrics(ctx, cfg)
+	defer stopMetrics()
+	stopCapture := configureCapture(cfg)
+	defer stopCapture()
+	configureDispatcher(cfg)
+	configurePacketAuth(cfg)
+	configureSocketOptions(cfg)
+	configureHistograms(cfg)
+	configureFilterWeighting(cfg)
+	configurePathDiversity(cfg)
+	configureEvents(cfg)
 	localAddr := localAddress(cfg)
 	daemonAddr := daemonAddress(cfg)
 
 	localAddr.Host.Port = 0
-	refClocks, netClocks := createClocks(cfg, localAddr)
+	refClocks, netClocks, newPeer := createClocks(ctx, cfg, localAddr)
 	sync.RegisterClocks(refClocks, netClocks)
+	insts := createSyncInstances(ctx, cfg, localAddr)
 
 	lclk := &clock.SystemClock{Log: log}
 	timebase.RegisterClock(lclk)
+	configureClockSync(cfg)
 
-	if len(refClocks) != 0 {
-		sync.SyncToRefClocks(log, lclk)
-		go sync.RunLocalClockSync(log, lclk)
-	}
+	startControl(ctx, cfg, newPeer)
+	startPeerDiscovery(ctx, cfg, localAddr, newPeer)
+	startComplianceReport(ctx, cfg)
+	startPHCMonitor(ctx, cfg)
+	startTAI(ctx, cfg)
 
-	if len(netClocks) != 0 {
-		go sync.RunGlobalClockSync(log, lclk)
+	if len(refClocks) != 0 {
+		sync.SyncToRefClocks(ctx, log, lclk)
 	}
 
 	tlsConfig := tlsConfig(cfg)
 	provider := ntske.NewProvider()
 
-	localAddr.Host.Port = ntp.ServerPortIP
-	server.StartNTSKEServerIP(ctx, log, copyIP(localAddr.Host.IP), localAddr.Host.Port, tlsConfig, provider)
-	server.StartIPServer(ctx, log, snet.CopyUDPAddr(localAddr.Host), provider)
+	configureNTPControl(cfg)
+	configureReducedPrecision(cfg)
+	configureServerWorkers(cfg)
+	startServers(ctx, cfg, localAddr, daemonAddr, tlsConfig, provider)
+	startClockTree(ctx, cfg)
+	dropPrivileges(cfg, localAddr)
+	restrictSyscalls(cfg)
+
+	var syncDone []<-chan struct{}
+	if len(refClocks) != 0 {
+		syncDone = append(syncDone, goDone(func() { sync.RunLocalClockSync(ctx, log, lclk) }))
+	}
 
-	localAddr.Host.Port = ntp.ServerPortSCION
-	server.StartNTSKEServerSCION(ctx, log, udp.UDPAddrFromSnet(localAddr), tlsConfig, provider)
-	server.StartSCIONServer(ctx, log, daemonAddr, snet.CopyUDPAddr(localAddr.Host), provider)
+	if len(netClocks) != 0 {
+		syncDone = append(syncDone, goDone(func() { sync.RunGlobalClockSync(ctx, log, lclk) }))
+	}
+	syncDone = append(syncDone, startSyncInstances(ctx, insts)...)
+	notifyServiceManager(ctx, len(syncDone) != 0)
 
-	runMonitor(log)
+	awaitShutdown(ctx, metricsAddress(cfg), lclk, syncDone)
 }
 
 func runRelay(configFile string) {
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	cfg := loadConfig(configFile)
+	stopTracing := configureTracing(ctx, cfg)
+	defer stopTracing()
+	stopMetrics := configureMetrics(ctx, cfg)
+	defer stopMetrics()
+	stopCapture := configureCapture(cfg)
+	defer stopCapture()
+	configureDispatcher(cfg)
+	configurePacketAuth(cfg)
+	configureSocketOptions(cfg)
+	configureHistograms(cfg)
+	configureFilterWeighting(cfg)
+	configurePathDiversity(cfg)
+	configureEvents(cfg)
 	localAddr := localAddress(cfg)
 	daemonAddr := daemonAddress(cfg)
 
 	localAddr.Host.Port = 0
-	refClocks, netClocks := createClocks(cfg, localAddr)
+	refClocks, netClocks, newPeer := createClocks(ctx, cfg, localAddr)
 	sync.RegisterClocks(refClocks, netClocks)
+	insts := createSyncInstances(ctx, cfg, localAddr)
 
 	lclk := &clock.SystemClock{Log: log}
 	timebase.RegisterClock(lclk)
+	configureClockSync(cfg)
 
-	if len(refClocks) != 0 {
-		sync.SyncToRefClocks(log, lclk)
-		go sync.RunLocalClockSync(log, lclk)
-	}
+	startControl(ctx, cfg, newPeer)
+	startPeerDiscovery(ctx, cfg, localAddr, newPeer)
+	startComplianceReport(ctx, cfg)
+	startPHCMonitor(ctx, cfg)
+	startTAI(ctx, cfg)
 
 	if len(netClocks) != 0 {
 		log.Fatal("unexpected configuration", zap.Int("number of peers", len(netClocks)))
 	}
+	checkSyncInstancePeers(insts)
+
+	if len(refClocks) != 0 {
+		sync.SyncToRefClocks(ctx, log, lclk)
+	}
 
 	tlsConfig := tlsConfig(cfg)
 	provider := ntske.NewProvider()
 
-	localAddr.Host.Port = ntp.ServerPortIP
-	server.StartNTSKEServerIP(ctx, log, copyIP(localAddr.Host.IP), localAddr.Host.Port, tlsConfig, provider)
-	server.StartIPServer(ctx, log, snet.CopyUDPAddr(localAddr.Host), provider)
+	configureNTPControl(cfg)
+	configureReducedPrecision(cfg)
+	configureServerWorkers(cfg)
+	startServers(ctx, cfg, localAddr, daemonAddr, tlsConfig, provider)
+	startClockTree(ctx, cfg)
+	dropPrivileges(cfg, localAddr)
+	restrictSyscalls(cfg)
 
-	localAddr.Host.Port = ntp.ServerPortSCION
-	server.StartNTSKEServerSCION(ctx, log, udp.UDPAddrFromSnet(localAddr), tlsConfig, provider)
-	server.StartSCIONServer(ctx, log, daemonAddr, snet.CopyUDPAddr(localAddr.Host), provider)
+	var syncDone []<-chan struct{}
+	if len(refClocks) != 0 {
+		syncDone = append(syncDone, goDone(func() { sync.RunLocalClockSync(ctx, log, lclk) }))
+	}
+	syncDone = append(syncDone, startSyncInstances(ctx, insts)...)
+	notifyServiceManager(ctx, len(syncDone) != 0)
 
-	runMonitor(log)
+	awaitShutdown(ctx, metricsAddress(cfg), lclk, syncDone)
 }
 
 func runClient(configFile string) {
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	cfg := loadConfig(configFile)
+	stopTracing := configureTracing(ctx, cfg)
+	defer stopTracing()
+	stopMetrics := configureMetrics(ctx, cfg)
+	defer stopMetrics()
+	stopCapture := configureCapture(cfg)
+	defer stopCapture()
+	configureDispatcher(cfg)
+	configurePacketAuth(cfg)
+	configureSocketOptions(cfg)
+	configureHistograms(cfg)
+	configureFilterWeighting(cfg)
+	configurePathDiversity(cfg)
+	configureEvents(cfg)
 	localAddr := localAddress(cfg)
 
 	localAddr.Host.Port = 0
-	refClocks, netClocks := createClocks(cfg, localAddr)
+	refClocks, netClocks, newPeer := createClocks(ctx, cfg, localAddr)
 	sync.RegisterClocks(refClocks, netClocks)
+	insts := createSyncInstances(ctx, cfg, localAddr)
 
 	lclk := &clock.SystemClock{Log: log}
 	timebase.RegisterClock(lclk)
+	configureClockSync(cfg)
+
+	startControl(ctx, cfg, newPeer)
+	startPeerDiscovery(ctx, cfg, localAddr, newPeer)
+	startComplianceReport(ctx, cfg)
+	startPHCMonitor(ctx, cfg)
+	startTAI(ctx, cfg)
 
 	scionClocksAvailable := false
 	for _, c := range refClocks {
-		_, ok := c.(*ntpReferenceClockSCION)
-		if ok {
+		switch c.(type) {
+		case *ntpReferenceClockSCION, *ntpReferenceClockDual:
 			scionClocksAvailable = true
-			break
 		}
 	}
-	if scionClocksAvailable {
+	for _, si := range cfg.SyncInstances {
+		for _, s := range si.NTPReferenceClocks {
+			if a, err := snet.ParseUDPAddr(s); err == nil && !a.IA.IsZero() {
+				scionClocksAvailable = true
+			}
+		}
+	}
+	if scionClocksAvailable && !cfg.Dispatcherless {
 		server.StartSCIONDispatcher(ctx, log, snet.CopyUDPAddr(localAddr.Host))
 	}
 
 	if len(refClocks) != 0 {
-		sync.SyncToRefClocks(log, lclk)
-		go sync.RunLocalClockSync(log, lclk)
+		sync.SyncToRefClocks(ctx, log, lclk)
+	}
+	startClockTree(ctx, cfg)
+	dropPrivileges(cfg, localAddr)
+	restrictSyscalls(cfg)
+
+	var syncDone []<-chan struct{}
+	if len(refClocks) != 0 {
+		syncDone = append(syncDone, goDone(func() { sync.RunLocalClockSync(ctx, log, lclk) }))
 	}
 
 	if len(netClocks) != 0 {
 		log.Fatal("unexpected configuration", zap.Int("number of peers", len(netClocks)))
 	}
+	checkSyncInstancePeers(insts)
+	syncDone = append(syncDone, startSyncInstances(ctx, insts)...)
+	notifyServiceManager(ctx, len(syncDone) != 0)
 
-	runMonitor(log)
+	awaitShutdown(ctx, metricsAddress(cfg), lclk, syncDone)
 }
 
-func runIPTool(localAddr, remoteAddr *snet.UDPAddr,
-	authModes []string, ntskeServer string, ntskeInsecureSkipVerify bool) {
-	var err error
-	ctx := context.Background()
+type toolConfig struct {
+	count    int
+	interval time.Duration
+	timeout  time.Duration
+	format   string
+	numPaths int
+}
 
-	lclk := &clock.SystemClock{Log: log}
-	timebase.RegisterClock(lclk)
+type toolRecord struct {
+	Time   time.Time `json:"time"`
+	Server string    `json:"server"`
+	Path   string    `json:"path,omitempty"`
+	Offset float64   `json:"offset"`
+	Delay  float64   `json:"delay"`
+	Auth   bool      `json:"auth"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type toolTarget func(ctx context.Context) []toolRecord
+
+type toolWriter interface {
+	write(r toolRecord) error
+	flush() error
+}
+
+type csvToolWriter struct {
+	w *csv.Writer
+}
+
+type jsonToolWriter struct {
+	e *json.Encoder
+}
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func newToolRecord(name, path string, s client.Sample, err error) toolRecord {
+	r := toolRecord{
+		Server: name,
+		Path:   path,
+	}
+	if err != nil {
+		r.Time = time.Now().UTC()
+		r.Error = err.Error()
+		return r
+	}
+	r.Time = s.Time.UTC()
+	r.Offset = timemath.Seconds(s.Offset)
+	r.Delay = timemath.Seconds(s.Delay)
+	r.Auth = s.Authenticated
+	return r
+}
+
+func newCSVToolWriter() *csvToolWriter {
+	w := csv.NewWriter(os.Stdout)
+	_ = w.Write([]string{"time", "server", "path", "offset", "delay", "auth", "error"})
+	return &csvToolWriter{w: w}
+}
+
+func (w *csvToolWriter) write(r toolRecord) error {
+	return w.w.Write([]string{
+		r.Time.Format(time.RFC3339Nano),
+		r.Server,
+		r.Path,
+		strconv.FormatFloat(r.Offset, 'g', -1, 64),
+		strconv.FormatFloat(r.Delay, 'g', -1, 64),
+		strconv.FormatBool(r.Auth),
+		r.Error,
+	})
+}
+
+func (w *csvToolWriter) flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *jsonToolWriter) write(r toolRecord) error {
+	return w.e.Encode(r)
+}
+
+func (w *jsonToolWriter) flush() error {
+	return nil
+}
 
+func newIPToolTarget(localAddr, remoteAddr *snet.UDPAddr,
+	authModes []string, ntskeServer string, ntskeInsecureSkipVerify bool) toolTarget {
 	laddr := localAddr.Host
 	raddr := remoteAddr.Host
 	c := &client.IPClient{
 		InterleavedMode: true,
 	}
-	if contains(authModes, authModeNTS) {
+	if contains(authModes, config.AuthModeNTS) {
 		configureIPClientNTS(c, ntskeServer, ntskeInsecureSkipVerify)
 	}
-
-	_, err = client.MeasureClockOffsetIP(ctx, log, c, laddr, raddr)
-	if err != nil {
-		log.Fatal("failed to measure clock offset", zap.Stringer("to", raddr), zap.Error(err))
+	name := raddr.String()
+	return func(ctx context.Context) []toolRecord {
+		var s client.Sample
+		_, err := client.MeasureClockOffsetIP(ctx, log, c, laddr, raddr)
+		if err == nil {
+			s, _ = c.LastSample()
+		}
+		return []toolRecord{newToolRecord(name, "", s, err)}
 	}
 }
 
-func runSCIONTool(daemonAddr, dispatcherMode string, localAddr, remoteAddr *snet.UDPAddr,
-	authModes []string, ntskeServer string, ntskeInsecureSkipVerify bool) {
+func newSCIONToolTarget(ctx context.Context, dc daemon.Connector, daemonAddr string,
+	localAddr, remoteAddr *snet.UDPAddr, numPaths int,
+	authModes []string, ntskeServer string, ntskeInsecureSkipVerify bool) toolTarget {
 	var err error
-	ctx := context.Background()
-
-	lclk := &clock.SystemClock{Log: log}
-	timebase.RegisterClock(lclk)
-
-	if dispatcherMode == dispatcherModeInternal {
-		server.StartSCIONDispatcher(ctx, log, snet.CopyUDPAddr(localAddr.Host))
-	}
-
-	dc := scion.NewDaemonConnector(ctx, daemonAddr)
-
 	var ps []snet.Path
 	if remoteAddr.IA.Equal(localAddr.IA) {
 		ps = []snet.Path{path.Path{
@@ -560,32 +2590,123 @@ func runSCIONTool(daemonAddr, dispatcherMode string, localAddr, remoteAddr *snet
 		}
 	}
 	log.Debug("available paths", zap.Stringer("to", remoteAddr.IA), zap.Array("via", scion.PathArrayMarshaler{Paths: ps}))
+	if len(ps) > numPaths {
+		ps = ps[:numPaths]
+	}
 
 	laddr := udp.UDPAddrFromSnet(localAddr)
 	raddr := udp.UDPAddrFromSnet(remoteAddr)
-	c := &client.SCIONClient{
-		InterleavedMode: true,
+	cs := make([]*client.SCIONClient, len(ps))
+	for i := range cs {
+		cs[i] = &client.SCIONClient{
+			InterleavedMode: true,
+		}
+		if contains(authModes, config.AuthModeSPAO) {
+			cs[i].Auth.Enabled = true
+			cs[i].Auth.DRKeyFetcher = scion.NewFetcher(dc)
+		}
+		if contains(authModes, config.AuthModeNTS) {
+			configureSCIONClientNTS(cs[i], ntskeServer, ntskeInsecureSkipVerify, daemonAddr, laddr, raddr)
+		}
+	}
+	name := raddr.String()
+	return func(ctx context.Context) []toolRecord {
+		rs := make([]toolRecord, len(cs))
+		for i, c := range cs {
+			var s client.Sample
+			_, err := client.MeasureClockOffsetSCION(ctx, log, []*client.SCIONClient{c}, laddr, raddr, ps[i:i+1])
+			if err == nil {
+				s, _ = c.LastSample()
+			}
+			rs[i] = newToolRecord(name, snet.Fingerprint(ps[i]).String(), s, err)
+		}
+		return rs
+	}
+}
+
+func startToolDispatcher(ctx context.Context, dispatcherMode string, localAddr *snet.UDPAddr) {
+	switch dispatcherMode {
+	case dispatcherModeInternal:
+		server.StartSCIONDispatcher(ctx, log, snet.CopyUDPAddr(localAddr.Host))
+	case dispatcherModeNone:
+		scion.SetEndhostPortRange(scion.PortRange{Min: scion.EndhostPortRangeMin, Max: scion.EndhostPortRangeMax})
 	}
-	if contains(authModes, authModeSPAO) {
-		c.Auth.Enabled = true
-		c.Auth.DRKeyFetcher = scion.NewFetcher(dc)
+}
+
+func runTool(daemonAddr, dispatcherMode string, localAddr *snet.UDPAddr, remoteAddrStrs []string,
+	authModes []string, ntskeInsecureSkipVerify bool, cfg toolConfig) {
+	ctx := context.Background()
+
+	lclk := &clock.SystemClock{Log: log}
+	timebase.RegisterClock(lclk)
+
+	var dc daemon.Connector
+	ts := make([]toolTarget, len(remoteAddrStrs))
+	for i, remoteAddrStr := range remoteAddrStrs {
+		var remoteAddr snet.UDPAddr
+		err := remoteAddr.Set(remoteAddrStr)
+		if err != nil {
+			log.Fatal("failed to parse remote address", zap.String("remote", remoteAddrStr), zap.Error(err))
+		}
+		ntskeServer := ntskeServerFromRemoteAddr(remoteAddrStr)
+		if !remoteAddr.IA.IsZero() {
+			if dc == nil {
+				startToolDispatcher(ctx, dispatcherMode, localAddr)
+				dc = scion.NewDaemonConnector(ctx, daemonAddr)
+			}
+			ts[i] = newSCIONToolTarget(ctx, dc, daemonAddr, localAddr, &remoteAddr, cfg.numPaths,
+				authModes, ntskeServer, ntskeInsecureSkipVerify)
+		} else {
+			ts[i] = newIPToolTarget(localAddr, &remoteAddr, authModes, ntskeServer, ntskeInsecureSkipVerify)
+		}
 	}
-	if contains(authModes, authModeNTS) {
-		configureSCIONClientNTS(c, ntskeServer, ntskeInsecureSkipVerify, daemonAddr, laddr, raddr)
+
+	var w toolWriter
+	switch cfg.format {
+	case toolFormatCSV:
+		w = newCSVToolWriter()
+	case toolFormatJSON:
+		w = &jsonToolWriter{e: json.NewEncoder(os.Stdout)}
 	}
 
-	_, err = client.MeasureClockOffsetSCION(ctx, log, []*client.SCIONClient{c}, laddr, raddr, ps)
-	if err != nil {
-		log.Fatal("failed to measure clock offset",
-			zap.Stringer("remoteIA", raddr.IA),
-			zap.Stringer("remoteHost", raddr.Host),
-			zap.Error(err),
-		)
+	var nerr int
+	for i := 0; i != cfg.count; i++ {
+		if i != 0 {
+			lclk.Sleep(cfg.interval)
+		}
+		for _, t := range ts {
+			tctx, cancel := context.WithTimeout(ctx, cfg.timeout)
+			rs := t(tctx)
+			cancel()
+			for _, r := range rs {
+				if r.Error != "" {
+					nerr++
+				}
+				if w != nil {
+					err := w.write(r)
+					if err == nil {
+						err = w.flush()
+					}
+					if err != nil {
+						log.Fatal("failed to write measurement", zap.Error(err))
+					}
+				} else if r.Error != "" {
+					log.Error("failed to measure clock offset",
+						zap.String("to", r.Server), zap.String("via", r.Path), zap.String("error", r.Error))
+				}
+			}
+		}
+	}
+	if nerr != 0 {
+		os.Exit(1)
 	}
 }
 
-func runBenchmark(configFile string) {
+func runBenchmark(configFile string, benchmarkCfg benchmark.Config) {
 	cfg := loadConfig(configFile)
+	configureDispatcher(cfg)
+	configurePacketAuth(cfg)
+	configureSocketOptions(cfg)
 	localAddr := localAddress(cfg)
 	daemonAddr := daemonAddress(cfg)
 	remoteAddr := remoteAddress(cfg)
@@ -594,25 +2715,25 @@ func runBenchmark(configFile string) {
 	ntskeServer := ntskeServerFromRemoteAddr(cfg.RemoteAddr)
 
 	if !remoteAddr.IA.IsZero() {
-		runSCIONBenchmark(daemonAddr, localAddr, remoteAddr, cfg.AuthModes, ntskeServer, log)
+		runSCIONBenchmark(benchmarkCfg, daemonAddr, localAddr, remoteAddr, cfg.AuthModes, ntskeServer, log)
 	} else {
 		if daemonAddr != "" {
 			exitWithUsage()
 		}
-		runIPBenchmark(localAddr, remoteAddr, cfg.AuthModes, ntskeServer, log)
+		runIPBenchmark(benchmarkCfg, localAddr, remoteAddr, cfg.AuthModes, ntskeServer, log)
 	}
 }
 
-func runIPBenchmark(localAddr, remoteAddr *snet.UDPAddr, authModes []string, ntskeServer string, log *zap.Logger) {
+func runIPBenchmark(benchmarkCfg benchmark.Config, localAddr, remoteAddr *snet.UDPAddr, authModes []string, ntskeServer string, log *zap.Logger) {
 	lclk := &clock.SystemClock{Log: zap.NewNop()}
 	timebase.RegisterClock(lclk)
-	benchmark.RunIPBenchmark(localAddr.Host, remoteAddr.Host, authModes, ntskeServer, log)
+	benchmark.RunIPBenchmark(benchmarkCfg, localAddr.Host, remoteAddr.Host, authModes, ntskeServer, log)
 }
 
-func runSCIONBenchmark(daemonAddr string, localAddr, remoteAddr *snet.UDPAddr, authModes []string, ntskeServer string, log *zap.Logger) {
+func runSCIONBenchmark(benchmarkCfg benchmark.Config, daemonAddr string, localAddr, remoteAddr *snet.UDPAddr, authModes []string, ntskeServer string, log *zap.Logger) {
 	lclk := &clock.SystemClock{Log: zap.NewNop()}
 	timebase.RegisterClock(lclk)
-	benchmark.RunSCIONBenchmark(daemonAddr, localAddr, remoteAddr, authModes, ntskeServer, log)
+	benchmark.RunSCIONBenchmark(benchmarkCfg, daemonAddr, localAddr, remoteAddr, authModes, ntskeServer, log)
 }
 
 func runDRKeyDemo(daemonAddr string, serverMode bool, serverAddr, clientAddr *snet.UDPAddr) {
@@ -667,6 +2788,198 @@ func runDRKeyDemo(daemonAddr string, serverMode bool, serverAddr, clientAddr *sn
 	}
 }
 
+type drkeyCheckConfig struct {
+	exchange bool
+	timeout  time.Duration
+}
+
+func drkeyDigest(k drkey.Key) string {
+	h := sha256.Sum256(k[:])
+	return hex.EncodeToString(h[:8])
+}
+
+// runDRKeyCheck fetches the host-host key a client at localAddr would use to
+// authenticate its exchanges with remoteAddr and optionally performs a single
+// SPAO authenticated exchange with it. Instead of the key itself, only a digest
+// is printed so that the output can be compared with the one on the server.
+func runDRKeyCheck(daemonAddr, dispatcherMode string, localAddr, remoteAddr *snet.UDPAddr,
+	cfg drkeyCheckConfig) {
+	ctx := context.Background()
+
+	lclk := &clock.SystemClock{Log: log}
+	timebase.RegisterClock(lclk)
+
+	if cfg.exchange {
+		startToolDispatcher(ctx, dispatcherMode, localAddr)
+	}
+	dc := scion.NewDaemonConnector(ctx, daemonAddr)
+	f := scion.NewFetcher(dc)
+
+	meta := drkey.HostHostMeta{
+		ProtoId:  scion.DRKeyProtocolTS,
+		Validity: time.Now(),
+		SrcIA:    remoteAddr.IA,
+		DstIA:    localAddr.IA,
+		SrcHost:  remoteAddr.Host.IP.String(),
+		DstHost:  localAddr.Host.IP.String(),
+	}
+	fmt.Printf("host-host key\t%s,%s -> %s,%s\n", meta.SrcIA, meta.SrcHost, meta.DstIA, meta.DstHost)
+
+	kctx, cancel := context.WithTimeout(ctx, cfg.timeout)
+	t0 := time.Now()
+	k, err := f.FetchHostHostKey(kctx, meta)
+	cancel()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error fetching host-host key:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("duration\t%s\n", time.Since(t0))
+	fmt.Printf("epoch\t%s - %s\n", k.Epoch.NotBefore.UTC().Format(time.RFC3339), k.Epoch.NotAfter.UTC().Format(time.RFC3339))
+	fmt.Printf("valid for\t%s\n", time.Until(k.Epoch.NotAfter).Truncate(time.Second))
+	fmt.Printf("key digest\t%s\n", drkeyDigest(k.Key))
+
+	var nerr int
+	for i, t := range scion.AdjacentEpochs(k.Epoch) {
+		label := "previous epoch"
+		if i == 1 {
+			label = "next epoch"
+		}
+		m := meta
+		m.Validity = t
+		kctx, cancel := context.WithTimeout(ctx, cfg.timeout)
+		ak, err := f.FetchHostHostKey(kctx, m)
+		cancel()
+		if err != nil {
+			// Keys of the next epoch are commonly not available before the
+			// epoch has started, so this is not treated as a failure.
+			fmt.Printf("%s\tunavailable (%v)\n", label, err)
+			continue
+		}
+		fmt.Printf("%s\t%s - %s, key digest %s\n", label,
+			ak.Epoch.NotBefore.UTC().Format(time.RFC3339), ak.Epoch.NotAfter.UTC().Format(time.RFC3339),
+			drkeyDigest(ak.Key))
+	}
+
+	if cfg.exchange {
+		t := newSCIONToolTarget(ctx, dc, daemonAddr, localAddr, remoteAddr, 1,
+			[]string{config.AuthModeSPAO}, "", false /* ntskeInsecureSkipVerify */)
+		tctx, cancel := context.WithTimeout(ctx, cfg.timeout)
+		rs := t(tctx)
+		cancel()
+		for _, r := range rs {
+			switch {
+			case r.Error != "":
+				nerr++
+				fmt.Printf("exchange\tfailed via %s: %s\n", r.Path, r.Error)
+			case !r.Auth:
+				nerr++
+				fmt.Printf("exchange\tunauthenticated response via %s\n", r.Path)
+			default:
+				fmt.Printf("exchange\tauthenticated via %s, offset %.9f s, delay %.9f s\n",
+					r.Path, r.Offset, r.Delay)
+			}
+		}
+	}
+	if nerr != 0 {
+		os.Exit(1)
+	}
+}
+
+type simConfig struct {
+	duration             time.Duration
+	seed                 int64
+	global               bool
+	numRefClocks         int
+	clkOffset, clkJitter time.Duration
+	clkDrift             float64
+	delay, asymmetry     time.Duration
+	jitter               time.Duration
+	loss                 float64
+}
+
+func runSimulation(cfg simConfig) {
+	clk := sim.NewClock(cfg.clkOffset, cfg.seed)
+	clk.Drift = cfg.clkDrift
+	clk.Jitter = cfg.clkJitter
+	var refClocks []*sim.ReferenceClock
+	for i := 0; i != cfg.numRefClocks; i++ {
+		c := sim.NewReferenceClock(clk, cfg.seed+1+int64(i))
+		c.Delay = cfg.delay
+		c.Asymmetry = cfg.asymmetry
+		c.Jitter = cfg.jitter
+		c.Loss = cfg.loss
+		refClocks = append(refClocks, c)
+	}
+	samples := sim.Run(log, clk, refClocks, cfg.global, cfg.duration)
+	fmt.Println("time,offset")
+	for _, s := range samples {
+		fmt.Printf("%.3f,%.9f\n", s.Time.Seconds(), s.Offset.Seconds())
+	}
+}
+
+func controlArgs(args []string) (string, url.Values) {
+	vals := url.Values{}
+	for _, arg := range args[1:] {
+		k, v, ok := strings.Cut(arg, "=")
+		if !ok {
+			exitWithUsage()
+		}
+		vals.Add(k, v)
+	}
+	return args[0], vals
+}
+
+func runControl(socketPath string, args []string) {
+	cmd, vals := controlArgs(args)
+	res, err := control.Query(socketPath, cmd, vals)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	fmt.Print(string(res))
+}
+
+type controlGRPCConfig struct {
+	addr, certFile, keyFile, caFile string
+}
+
+func runControlGRPC(cfg controlGRPCConfig, args []string) {
+	cmd, vals := controlArgs(args)
+	cert, err := tls.LoadX509KeyPair(cfg.certFile, cfg.keyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: failed to load client certificate:", err)
+		os.Exit(1)
+	}
+	b, err := os.ReadFile(cfg.caFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: failed to load CA certificates:", err)
+		os.Exit(1)
+	}
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(b) {
+		fmt.Fprintln(os.Stderr, "Error: failed to parse CA certificates")
+		os.Exit(1)
+	}
+	conn, err := grpc.Dial(cfg.addr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      rootCAs,
+		MinVersion:   tls.VersionTLS13,
+	})))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	res, err := control.QueryGRPC(ctx, conn, cmd, vals)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(res))
+}
+
 func exitWithUsage() {
 	fmt.Println("<usage>")
 	os.Exit(1)
@@ -678,7 +2991,7 @@ func main() {
 		configFile              string
 		daemonAddr              string
 		localAddr               snet.UDPAddr
-		remoteAddrStr           string
+		remoteAddrStrs          stringList
 		dispatcherMode          string
 		drkeyMode               string
 		drkeyServerAddr         snet.UDPAddr
@@ -686,6 +2999,12 @@ func main() {
 		authModesStr            string
 		ntskeInsecureSkipVerify bool
 		profileCPU              bool
+		controlSocket           string
+		controlGRPC             controlGRPCConfig
+		toolCfg                 toolConfig
+		drkeyCheckCfg           drkeyCheckConfig
+		simCfg                  simConfig
+		benchmarkCfg            benchmark.Config
 	)
 
 	serverFlags := flag.NewFlagSet("server", flag.ExitOnError)
@@ -694,6 +3013,9 @@ func main() {
 	toolFlags := flag.NewFlagSet("tool", flag.ExitOnError)
 	benchmarkFlags := flag.NewFlagSet("benchmark", flag.ExitOnError)
 	drkeyFlags := flag.NewFlagSet("drkey", flag.ExitOnError)
+	drkeyCheckFlags := flag.NewFlagSet("check", flag.ExitOnError)
+	controlFlags := flag.NewFlagSet("control", flag.ExitOnError)
+	simFlags := flag.NewFlagSet("sim", flag.ExitOnError)
 
 	serverFlags.BoolVar(&verbose, "verbose", false, "Verbose logging")
 	serverFlags.StringVar(&configFile, "config", "", "Config file")
@@ -709,12 +3031,21 @@ func main() {
 	toolFlags.StringVar(&daemonAddr, "daemon", "", "Daemon address")
 	toolFlags.StringVar(&dispatcherMode, "dispatcher", "", "Dispatcher mode")
 	toolFlags.Var(&localAddr, "local", "Local address")
-	toolFlags.StringVar(&remoteAddrStr, "remote", "", "Remote address")
+	toolFlags.Var(&remoteAddrStrs, "remote", "Remote address (repeatable)")
 	toolFlags.StringVar(&authModesStr, "auth", "", "Authentication modes")
 	toolFlags.BoolVar(&ntskeInsecureSkipVerify, "ntske-insecure-skip-verify", false, "Skip NTSKE verification")
+	toolFlags.IntVar(&toolCfg.count, "count", 1, "Number of measurements per remote address")
+	toolFlags.DurationVar(&toolCfg.interval, "interval", time.Second, "Interval between measurements")
+	toolFlags.DurationVar(&toolCfg.timeout, "timeout", time.Second, "Timeout per measurement")
+	toolFlags.StringVar(&toolCfg.format, "format", "", "Output format (csv or json)")
+	toolFlags.IntVar(&toolCfg.numPaths, "paths", 1, "Number of SCION paths to measure per remote address")
 
 	benchmarkFlags.BoolVar(&verbose, "verbose", false, "Verbose logging")
 	benchmarkFlags.StringVar(&configFile, "config", "", "Config file")
+	benchmarkFlags.IntVar(&benchmarkCfg.NumClients, "clients", 1, "Number of concurrent clients")
+	benchmarkFlags.IntVar(&benchmarkCfg.NumRequests, "requests", 20_000, "Number of measurements per client")
+	benchmarkFlags.DurationVar(&benchmarkCfg.Timeout, "timeout", time.Second, "Timeout per measurement")
+	benchmarkFlags.IntVar(&benchmarkCfg.Burst, "burst", 1, "Number of requests sent per burst (IP only, using UDP GSO)")
 
 	drkeyFlags.BoolVar(&verbose, "verbose", false, "Verbose logging")
 	drkeyFlags.StringVar(&daemonAddr, "daemon", "", "Daemon address")
@@ -722,6 +3053,33 @@ func main() {
 	drkeyFlags.Var(&drkeyServerAddr, "server", "Server address")
 	drkeyFlags.Var(&drkeyClientAddr, "client", "Client address")
 
+	drkeyCheckFlags.BoolVar(&verbose, "verbose", false, "Verbose logging")
+	drkeyCheckFlags.StringVar(&configFile, "config", "", "Config file (provides daemon and local address)")
+	drkeyCheckFlags.StringVar(&daemonAddr, "daemon", "", "Daemon address")
+	drkeyCheckFlags.StringVar(&dispatcherMode, "dispatcher", "", "Dispatcher mode")
+	drkeyCheckFlags.Var(&localAddr, "local", "Local address")
+	drkeyCheckFlags.BoolVar(&drkeyCheckCfg.exchange, "exchange", false, "Perform one authenticated exchange")
+	drkeyCheckFlags.DurationVar(&drkeyCheckCfg.timeout, "timeout", time.Second, "Timeout per request")
+
+	controlFlags.StringVar(&controlSocket, "socket", "", "Control socket")
+	controlFlags.StringVar(&controlGRPC.addr, "grpc", "", "gRPC control server address")
+	controlFlags.StringVar(&controlGRPC.certFile, "cert", "", "gRPC client certificate file")
+	controlFlags.StringVar(&controlGRPC.keyFile, "key", "", "gRPC client key file")
+	controlFlags.StringVar(&controlGRPC.caFile, "ca", "", "gRPC server CA certificate file")
+
+	simFlags.BoolVar(&verbose, "verbose", false, "Verbose logging")
+	simFlags.DurationVar(&simCfg.duration, "duration", time.Hour, "Simulated duration")
+	simFlags.Int64Var(&simCfg.seed, "seed", 1, "Random seed")
+	simFlags.BoolVar(&simCfg.global, "global", false, "Simulate network peers instead of reference clocks")
+	simFlags.IntVar(&simCfg.numRefClocks, "refclocks", 1, "Number of reference clocks")
+	simFlags.DurationVar(&simCfg.clkOffset, "offset", 0, "Initial offset of the local clock")
+	simFlags.Float64Var(&simCfg.clkDrift, "drift", 0, "Frequency error of the local clock")
+	simFlags.DurationVar(&simCfg.clkJitter, "clock-jitter", 0, "Reading noise of the local clock")
+	simFlags.DurationVar(&simCfg.delay, "delay", 0, "One-way network delay")
+	simFlags.DurationVar(&simCfg.asymmetry, "asymmetry", 0, "Network delay asymmetry")
+	simFlags.DurationVar(&simCfg.jitter, "jitter", 0, "Network delay jitter")
+	simFlags.Float64Var(&simCfg.loss, "loss", 0, "Packet loss probability")
+
 	if len(os.Args) < 2 {
 		exitWithUsage()
 	}
@@ -765,25 +3123,36 @@ func main() {
 		if err != nil || toolFlags.NArg() != 0 {
 			exitWithUsage()
 		}
-		var remoteAddr snet.UDPAddr
-		err = remoteAddr.Set(remoteAddrStr)
-		if err != nil {
+		if len(remoteAddrStrs) == 0 || toolCfg.count <= 0 || toolCfg.interval < 0 ||
+			toolCfg.timeout <= 0 || toolCfg.numPaths <= 0 {
+			exitWithUsage()
+		}
+		if toolCfg.format != "" && toolCfg.format != toolFormatCSV && toolCfg.format != toolFormatJSON {
 			exitWithUsage()
 		}
+		var scionRemote bool
+		for _, remoteAddrStr := range remoteAddrStrs {
+			var remoteAddr snet.UDPAddr
+			err = remoteAddr.Set(remoteAddrStr)
+			if err != nil {
+				exitWithUsage()
+			}
+			if !remoteAddr.IA.IsZero() {
+				scionRemote = true
+			}
+		}
 		authModes := strings.Split(authModesStr, ",")
 		for i := range authModes {
 			authModes[i] = strings.TrimSpace(authModes[i])
 		}
-		if !remoteAddr.IA.IsZero() {
+		if scionRemote {
 			if dispatcherMode == "" {
 				dispatcherMode = dispatcherModeExternal
 			} else if dispatcherMode != dispatcherModeExternal &&
-				dispatcherMode != dispatcherModeInternal {
+				dispatcherMode != dispatcherModeInternal &&
+				dispatcherMode != dispatcherModeNone {
 				exitWithUsage()
 			}
-			ntskeServer := ntskeServerFromRemoteAddr(remoteAddrStr)
-			initLogger(verbose)
-			runSCIONTool(daemonAddr, dispatcherMode, &localAddr, &remoteAddr, authModes, ntskeServer, ntskeInsecureSkipVerify)
 		} else {
 			if daemonAddr != "" {
 				exitWithUsage()
@@ -791,21 +3160,58 @@ func main() {
 			if dispatcherMode != "" {
 				exitWithUsage()
 			}
-			ntskeServer := ntskeServerFromRemoteAddr(remoteAddrStr)
-			initLogger(verbose)
-			runIPTool(&localAddr, &remoteAddr, authModes, ntskeServer, ntskeInsecureSkipVerify)
 		}
+		initLogger(verbose)
+		runTool(daemonAddr, dispatcherMode, &localAddr, remoteAddrStrs, authModes, ntskeInsecureSkipVerify, toolCfg)
 	case benchmarkFlags.Name():
 		err := benchmarkFlags.Parse(os.Args[2:])
 		if err != nil || benchmarkFlags.NArg() != 0 {
 			exitWithUsage()
 		}
-		if configFile == "" {
+		if configFile == "" || benchmarkCfg.NumClients <= 0 || benchmarkCfg.NumRequests <= 0 ||
+			benchmarkCfg.Timeout <= 0 {
 			exitWithUsage()
 		}
 		initLogger(verbose)
-		runBenchmark(configFile)
+		runBenchmark(configFile, benchmarkCfg)
 	case drkeyFlags.Name():
+		if len(os.Args) > 2 && os.Args[2] == drkeyCheckFlags.Name() {
+			err := drkeyCheckFlags.Parse(os.Args[3:])
+			if err != nil || drkeyCheckFlags.NArg() != 1 {
+				exitWithUsage()
+			}
+			var remoteAddr snet.UDPAddr
+			err = remoteAddr.Set(drkeyCheckFlags.Arg(0))
+			if err != nil || remoteAddr.IA.IsZero() {
+				exitWithUsage()
+			}
+			if drkeyCheckCfg.timeout <= 0 {
+				exitWithUsage()
+			}
+			if dispatcherMode == "" {
+				dispatcherMode = dispatcherModeExternal
+			} else if dispatcherMode != dispatcherModeExternal &&
+				dispatcherMode != dispatcherModeInternal &&
+				dispatcherMode != dispatcherModeNone {
+				exitWithUsage()
+			}
+			initLogger(verbose)
+			if configFile != "" {
+				cfg := loadConfig(configFile)
+				if daemonAddr == "" {
+					daemonAddr = daemonAddress(cfg)
+				}
+				if localAddr.IA.IsZero() {
+					localAddr = *localAddress(cfg)
+					localAddr.Host.Port = 0
+				}
+			}
+			if localAddr.IA.IsZero() || localAddr.Host == nil {
+				exitWithUsage()
+			}
+			runDRKeyCheck(daemonAddr, dispatcherMode, &localAddr, &remoteAddr, drkeyCheckCfg)
+			break
+		}
 		err := drkeyFlags.Parse(os.Args[2:])
 		if err != nil || drkeyFlags.NArg() != 0 {
 			exitWithUsage()
@@ -816,6 +3222,32 @@ func main() {
 		serverMode := drkeyMode == "server"
 		initLogger(verbose)
 		runDRKeyDemo(daemonAddr, serverMode, &drkeyServerAddr, &drkeyClientAddr)
+	case controlFlags.Name():
+		err := controlFlags.Parse(os.Args[2:])
+		if err != nil || controlFlags.NArg() == 0 {
+			exitWithUsage()
+		}
+		if (controlSocket == "") == (controlGRPC.addr == "") {
+			exitWithUsage()
+		}
+		if controlGRPC.addr != "" {
+			if controlGRPC.certFile == "" || controlGRPC.keyFile == "" || controlGRPC.caFile == "" {
+				exitWithUsage()
+			}
+			runControlGRPC(controlGRPC, controlFlags.Args())
+		} else {
+			runControl(controlSocket, controlFlags.Args())
+		}
+	case simFlags.Name():
+		err := simFlags.Parse(os.Args[2:])
+		if err != nil || simFlags.NArg() != 0 {
+			exitWithUsage()
+		}
+		if simCfg.duration <= 0 || simCfg.numRefClocks <= 0 {
+			exitWithUsage()
+		}
+		initLogger(verbose)
+		runSimulation(simCfg)
 	case "x":
 		runX()
 	default: